@@ -36,8 +36,13 @@ const EnvVaultWrapTTL = "VAULT_WRAP_TTL"
 const EnvVaultMaxRetries = "VAULT_MAX_RETRIES"
 const EnvVaultToken = "VAULT_TOKEN"
 const EnvVaultMFA = "VAULT_MFA"
+const EnvVaultNamespace = "VAULT_NAMESPACE"
 const EnvRateLimit = "VAULT_RATE_LIMIT"
 
+// namespaceHeaderName is the name of the header carrying the namespace of a
+// request
+const namespaceHeaderName = "X-Vault-Namespace"
+
 // WrappingLookupFunc is a function that, given an HTTP verb and a path,
 // returns an optional string duration to be used for response wrapping (e.g.
 // "15s", or simply "15"). The path will not begin with "/v1/" or "v1/" or "/",
@@ -378,6 +383,10 @@ func NewClient(c *Config) (*Client, error) {
 		client.token = token
 	}
 
+	if namespace := os.Getenv(EnvVaultNamespace); namespace != "" {
+		client.setNamespace(namespace)
+	}
+
 	return client, nil
 }
 
@@ -498,6 +507,55 @@ func (c *Client) SetHeaders(headers http.Header) {
 	c.headers = headers
 }
 
+// SetNamespace sets the namespace that future requests are made in. Request
+// paths are then relative to the namespace. Setting this on a client will
+// override the value of the VAULT_NAMESPACE environment variable.
+func (c *Client) SetNamespace(namespace string) {
+	c.modifyLock.Lock()
+	defer c.modifyLock.Unlock()
+
+	c.setNamespace(namespace)
+}
+
+func (c *Client) setNamespace(namespace string) {
+	// Copy the headers since they may be shared with previous requests
+	headers := make(http.Header)
+	for k, v := range c.headers {
+		headers[k] = v
+	}
+	headers.Set(namespaceHeaderName, namespace)
+	c.headers = headers
+}
+
+// ClearNamespace removes the namespace so that future requests are made in
+// the root namespace.
+func (c *Client) ClearNamespace() {
+	c.modifyLock.Lock()
+	defer c.modifyLock.Unlock()
+
+	if c.headers == nil {
+		return
+	}
+	headers := make(http.Header)
+	for k, v := range c.headers {
+		headers[k] = v
+	}
+	headers.Del(namespaceHeaderName)
+	c.headers = headers
+}
+
+// Namespace returns the namespace requests are made in, or the empty string
+// for the root namespace.
+func (c *Client) Namespace() string {
+	c.modifyLock.RLock()
+	defer c.modifyLock.RUnlock()
+
+	if c.headers == nil {
+		return ""
+	}
+	return c.headers.Get(namespaceHeaderName)
+}
+
 // SetBackoff sets the backoff function to be used for future requests.
 func (c *Client) SetBackoff(backoff retryablehttp.Backoff) {
 	c.modifyLock.RLock()
@@ -508,14 +566,18 @@ func (c *Client) SetBackoff(backoff retryablehttp.Backoff) {
 	c.config.Backoff = backoff
 }
 
-// Clone creates a new client with the same configuration. Note that the same
-// underlying http.Client is used; modifying the client from more than one
-// goroutine at once may not be safe, so modify the client as needed and then
-// clone.
+// Clone creates a new client with the same configuration and headers,
+// including the namespace. Note that the same underlying http.Client is used;
+// modifying the client from more than one goroutine at once may not be safe,
+// so modify the client as needed and then clone.
 func (c *Client) Clone() (*Client, error) {
 	c.modifyLock.RLock()
 	c.config.modifyLock.RLock()
 	config := c.config
+	headers := make(http.Header, len(c.headers))
+	for k, v := range c.headers {
+		headers[k] = v
+	}
 	c.modifyLock.RUnlock()
 
 	newConfig := &Config{
@@ -528,7 +590,13 @@ func (c *Client) Clone() (*Client, error) {
 	}
 	config.modifyLock.RUnlock()
 
-	return NewClient(newConfig)
+	client, err := NewClient(newConfig)
+	if err != nil {
+		return nil, err
+	}
+	client.SetHeaders(headers)
+
+	return client, nil
 }
 
 // SetPolicyOverride sets whether requests should be sent with the policy
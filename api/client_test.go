@@ -280,3 +280,25 @@ func TestClone(t *testing.T) {
 
 	_ = client2
 }
+
+func TestClone_Namespace(t *testing.T) {
+	client1, err := NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client1.SetNamespace("ns1")
+
+	client2, err := client1.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns := client2.Namespace(); ns != "ns1" {
+		t.Fatalf("expected namespace ns1 on the clone, got %q", ns)
+	}
+
+	// The clone's headers are its own
+	client2.SetNamespace("ns2")
+	if ns := client1.Namespace(); ns != "ns1" {
+		t.Fatalf("expected namespace ns1 on the original, got %q", ns)
+	}
+}
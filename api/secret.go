@@ -239,8 +239,9 @@ type SecretAuth struct {
 	Policies    []string          `json:"policies"`
 	Metadata    map[string]string `json:"metadata"`
 
-	LeaseDuration int  `json:"lease_duration"`
-	Renewable     bool `json:"renewable"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+	TokenType     string `json:"token_type"`
 }
 
 // ParseSecret is used to parse a secret value from JSON from an io.Reader.
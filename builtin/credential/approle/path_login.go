@@ -280,6 +280,7 @@ func (b *backend) pathLoginUpdate(ctx context.Context, req *logical.Request, dat
 		Alias: &logical.Alias{
 			Name: role.RoleID,
 		},
+		BoundCIDRs: role.TokenBoundCIDRs,
 	}
 
 	return &logical.Response{
@@ -2,9 +2,11 @@ package approle
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
+	sockaddr "github.com/hashicorp/go-sockaddr"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -151,3 +153,108 @@ func generateRenewRequest(s logical.Storage, auth *logical.Auth) *logical.Reques
 
 	return renewReq
 }
+
+func TestAppRole_TokenBoundCIDRs(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	roleReq := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/role1",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"policies":          "a,b",
+			"token_bound_cidrs": "127.0.0.1/32,10.0.0.0/8",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/role1/role-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	roleID := resp.Data["role_id"]
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	secretID := resp.Data["secret_id"]
+
+	loginReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "login",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		},
+		Connection: &logical.Connection{
+			RemoteAddr: "127.0.0.1",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), loginReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Auth == nil {
+		t.Fatalf("expected a non-nil auth object in the response")
+	}
+
+	var boundCIDRs []string
+	for _, cidr := range resp.Auth.BoundCIDRs {
+		boundCIDRs = append(boundCIDRs, cidr.String())
+	}
+	expected := []string{"127.0.0.1", "10.0.0.0/8"}
+	if !reflect.DeepEqual(boundCIDRs, expected) {
+		t.Fatalf("bad: token bound CIDRs; expected: %#v\nactual: %#v", expected, boundCIDRs)
+	}
+
+	// Invalid CIDR blocks are rejected
+	roleReq.Path = "role/role1/token-bound-cidrs"
+	roleReq.Operation = logical.UpdateOperation
+	roleReq.Data = map[string]interface{}{
+		"token_bound_cidrs": "not-a-cidr",
+	}
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: err:%v resp:%#v", err, resp)
+	}
+
+	// Deleting the field unbinds the tokens
+	roleReq.Operation = logical.DeleteOperation
+	roleReq.Data = nil
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	roleReq.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if cidrs := resp.Data["token_bound_cidrs"].([]*sockaddr.SockAddrMarshaler); len(cidrs) != 0 {
+		t.Fatalf("expected no token bound CIDRs, got %v", cidrs)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), loginReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if len(resp.Auth.BoundCIDRs) != 0 {
+		t.Fatalf("expected no token bound CIDRs, got %v", resp.Auth.BoundCIDRs)
+	}
+}
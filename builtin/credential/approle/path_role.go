@@ -7,10 +7,12 @@ import (
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-sockaddr"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/cidrutil"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
@@ -61,6 +63,15 @@ type roleStorageEntry struct {
 	// A constraint, if set, specifies the CIDR blocks from which logins should be allowed
 	BoundCIDRList []string `json:"bound_cidr_list_list" mapstructure:"bound_cidr_list"`
 
+	// A constraint, if set, specifies the CIDR blocks from which the tokens
+	// issued by logins against this role can be used
+	TokenBoundCIDRs []*sockaddr.SockAddrMarshaler `json:"token_bound_cidrs" mapstructure:"token_bound_cidrs"`
+
+	// A constraint, if set, requires SecretIDs of this role to be fetched
+	// response-wrapped, so that they can only be delivered through a
+	// wrapping token
+	SecretIDWrappingRequired bool `json:"secret_id_wrapping_required" mapstructure:"secret_id_wrapping_required"`
+
 	// Period, if set, indicates that the token generated using this role
 	// should never expire. The token should be renewed within the duration
 	// specified by this value. The renewal duration will be fixed if the
@@ -95,6 +106,7 @@ type roleIDStorageEntry struct {
 // role/<role_name>/token-num-uses - For updating the param
 // role/<role_name>/bind-secret-id - For updating the param
 // role/<role_name>/bound-cidr-list - For updating the param
+// role/<role_name>/token-bound-cidrs - For updating the param
 // role/<role_name>/period - For updating the param
 // role/<role_name>/role-id - For fetching the role_id of an role
 // role/<role_name>/secret-id - For issuing a secret_id against an role, also to list the secret_id_accessors
@@ -129,6 +141,16 @@ func rolePaths(b *backend) []*framework.Path {
 					Type: framework.TypeCommaStringSlice,
 					Description: `Comma separated string or list of CIDR blocks. If set, specifies the blocks of
 IP addresses which can perform the login operation.`,
+				},
+				"token_bound_cidrs": &framework.FieldSchema{
+					Type: framework.TypeCommaStringSlice,
+					Description: `Comma separated string or list of CIDR blocks. If set, specifies the blocks of
+IP addresses which can use the tokens issued by logins against this role.`,
+				},
+				"secret_id_wrapping_required": &framework.FieldSchema{
+					Type: framework.TypeBool,
+					Description: `If set, SecretIDs of this role can only be fetched with response wrapping,
+so that they are only ever delivered through a wrapping token.`,
 				},
 				"policies": &framework.FieldSchema{
 					Type:        framework.TypeCommaStringSlice,
@@ -243,6 +265,27 @@ IP addresses which can perform the login operation.`,
 			HelpSynopsis:    strings.TrimSpace(roleHelp["role-bound-cidr-list"][0]),
 			HelpDescription: strings.TrimSpace(roleHelp["role-bound-cidr-list"][1]),
 		},
+		&framework.Path{
+			Pattern: "role/" + framework.GenericNameRegex("role_name") + "/token-bound-cidrs$",
+			Fields: map[string]*framework.FieldSchema{
+				"role_name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the role.",
+				},
+				"token_bound_cidrs": &framework.FieldSchema{
+					Type: framework.TypeCommaStringSlice,
+					Description: `Comma separated string or list of CIDR blocks. If set, specifies the blocks of
+IP addresses which can use the tokens issued by logins against this role.`,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathRoleTokenBoundCIDRsUpdate,
+				logical.ReadOperation:   b.pathRoleTokenBoundCIDRsRead,
+				logical.DeleteOperation: b.pathRoleTokenBoundCIDRsDelete,
+			},
+			HelpSynopsis:    strings.TrimSpace(roleHelp["role-token-bound-cidrs"][0]),
+			HelpDescription: strings.TrimSpace(roleHelp["role-token-bound-cidrs"][1]),
+		},
 		&framework.Path{
 			Pattern: "role/" + framework.GenericNameRegex("role_name") + "/bind-secret-id$",
 			Fields: map[string]*framework.FieldSchema{
@@ -863,6 +906,17 @@ func (b *backend) pathRoleCreateUpdate(ctx context.Context, req *logical.Request
 		}
 	}
 
+	if tokenBoundCIDRsRaw, ok := data.GetOk("token_bound_cidrs"); ok {
+		role.TokenBoundCIDRs, err = parseutil.ParseAddrs(tokenBoundCIDRsRaw)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid token_bound_cidrs: %v", err)), nil
+		}
+	}
+
+	if secretIDWrappingRequiredRaw, ok := data.GetOk("secret_id_wrapping_required"); ok {
+		role.SecretIDWrappingRequired = secretIDWrappingRequiredRaw.(bool)
+	}
+
 	if policiesRaw, ok := data.GetOk("policies"); ok {
 		role.Policies = policyutil.ParsePolicies(policiesRaw)
 	} else if req.Operation == logical.CreateOperation {
@@ -955,22 +1009,27 @@ func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *
 	}
 
 	respData := map[string]interface{}{
-		"bind_secret_id":     role.BindSecretID,
-		"bound_cidr_list":    role.BoundCIDRList,
-		"period":             role.Period / time.Second,
-		"policies":           role.Policies,
-		"secret_id_num_uses": role.SecretIDNumUses,
-		"secret_id_ttl":      role.SecretIDTTL / time.Second,
-		"token_max_ttl":      role.TokenMaxTTL / time.Second,
-		"token_num_uses":     role.TokenNumUses,
-		"token_ttl":          role.TokenTTL / time.Second,
-		"local_secret_ids":   false,
+		"bind_secret_id":              role.BindSecretID,
+		"bound_cidr_list":             role.BoundCIDRList,
+		"period":                      role.Period / time.Second,
+		"policies":                    role.Policies,
+		"secret_id_num_uses":          role.SecretIDNumUses,
+		"secret_id_ttl":               role.SecretIDTTL / time.Second,
+		"secret_id_wrapping_required": role.SecretIDWrappingRequired,
+		"token_max_ttl":               role.TokenMaxTTL / time.Second,
+		"token_num_uses":              role.TokenNumUses,
+		"token_ttl":                   role.TokenTTL / time.Second,
+		"local_secret_ids":            false,
 	}
 
 	if role.SecretIDPrefix == secretIDLocalPrefix {
 		respData["local_secret_ids"] = true
 	}
 
+	if len(role.TokenBoundCIDRs) > 0 {
+		respData["token_bound_cidrs"] = role.TokenBoundCIDRs
+	}
+
 	resp := &logical.Response{
 		Data: respData,
 	}
@@ -1396,6 +1455,86 @@ func (b *backend) pathRoleBoundCIDRListDelete(ctx context.Context, req *logical.
 	return nil, b.setRoleEntry(ctx, req.Storage, role.name, role, "")
 }
 
+func (b *backend) pathRoleTokenBoundCIDRsUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role_name").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role_name"), nil
+	}
+
+	lock := b.roleLock(roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Re-read the role after grabbing the lock
+	role, err := b.roleEntry(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	tokenBoundCIDRsRaw, ok := data.GetOk("token_bound_cidrs")
+	if !ok {
+		return logical.ErrorResponse("missing token_bound_cidrs"), nil
+	}
+	role.TokenBoundCIDRs, err = parseutil.ParseAddrs(tokenBoundCIDRsRaw)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid token_bound_cidrs: %v", err)), nil
+	}
+
+	return nil, b.setRoleEntry(ctx, req.Storage, role.name, role, "")
+}
+
+func (b *backend) pathRoleTokenBoundCIDRsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role_name").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role_name"), nil
+	}
+
+	lock := b.roleLock(roleName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	role, err := b.roleEntry(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"token_bound_cidrs": role.TokenBoundCIDRs,
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleTokenBoundCIDRsDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role_name").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role_name"), nil
+	}
+
+	lock := b.roleLock(roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := b.roleEntry(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	// Deleting a field implies setting the value to it's default value.
+	role.TokenBoundCIDRs = nil
+
+	return nil, b.setRoleEntry(ctx, req.Storage, role.name, role, "")
+}
+
 func (b *backend) pathRoleBindSecretIDUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	roleName := data.Get("role_name").(string)
 	if roleName == "" {
@@ -2123,6 +2262,10 @@ func (b *backend) handleRoleSecretIDCommon(ctx context.Context, req *logical.Req
 		return logical.ErrorResponse("bind_secret_id is not set on the role"), nil
 	}
 
+	if role.SecretIDWrappingRequired && (req.WrapInfo == nil || req.WrapInfo.TTL == 0) {
+		return logical.ErrorResponse("secret_id_wrapping_required is set on the role; secret IDs must be requested with response wrapping"), nil
+	}
+
 	secretIDCIDRs := data.Get("cidr_list").([]string)
 
 	// Validate the list of CIDR blocks
@@ -2271,6 +2414,13 @@ addresses which can perform the login operation`,
 		`During login, the IP address of the client will be checked to see if it
 belongs to the CIDR blocks specified. If CIDR blocks were set and if the
 IP is not encompassed by it, login fails`,
+	},
+	"role-token-bound-cidrs": {
+		`Comma separated list of CIDR blocks, if set, specifies blocks of IP
+addresses which can use the tokens issued by this role`,
+		`Tokens issued by logins against this role are bound to these CIDR blocks;
+requests made with such a token from an IP address outside of them are
+denied.`,
 	},
 	"role-policies": {
 		"Policies of the role.",
@@ -1116,6 +1116,83 @@ func TestAppRole_RoleSecretID(t *testing.T) {
 	}
 }
 
+func TestAppRole_RoleSecretIDWrappingRequired(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	roleReq := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/role1",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"policies":                    "p,q,r,s",
+			"secret_id_wrapping_required": true,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Unwrapped requests are refused, for both generated and custom secret IDs
+	for _, path := range []string{"role/role1/secret-id", "role/role1/custom-secret-id"} {
+		roleSecretIDReq := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"secret_id": "abcd123",
+			},
+		}
+		resp, err = b.HandleRequest(context.Background(), roleSecretIDReq)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: err:%v resp:%#v", err, resp)
+		}
+		if !strings.Contains(resp.Error().Error(), "secret_id_wrapping_required") {
+			t.Fatalf("unexpected error: %v", resp.Error())
+		}
+
+		roleSecretIDReq.WrapInfo = &logical.RequestWrapInfo{
+			TTL: time.Minute,
+		}
+		resp, err = b.HandleRequest(context.Background(), roleSecretIDReq)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		if resp.Data["secret_id"].(string) == "" {
+			t.Fatalf("failed to generate secret_id")
+		}
+	}
+
+	roleReq.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !resp.Data["secret_id_wrapping_required"].(bool) {
+		t.Fatalf("expected secret_id_wrapping_required to be set")
+	}
+
+	// Lifting the requirement allows unwrapped requests again
+	roleReq.Operation = logical.UpdateOperation
+	roleReq.Data = map[string]interface{}{
+		"secret_id_wrapping_required": false,
+	}
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+}
+
 func TestAppRole_RoleCRUD(t *testing.T) {
 	var resp *logical.Response
 	var err error
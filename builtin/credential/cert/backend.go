@@ -2,11 +2,15 @@ package cert
 
 import (
 	"context"
+	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	cache "github.com/patrickmn/go-cache"
 )
 
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
@@ -39,6 +43,9 @@ func Backend() *backend {
 	}
 
 	b.crlUpdateMutex = &sync.RWMutex{}
+	b.ocspCache = cache.New(cache.NoExpiration, time.Minute)
+	b.ocspClient = cleanhttp.DefaultPooledClient()
+	b.ocspClient.Timeout = 10 * time.Second
 
 	return &b
 }
@@ -49,6 +56,11 @@ type backend struct {
 
 	crls           map[string]CRLInfo
 	crlUpdateMutex *sync.RWMutex
+
+	// ocspCache holds the OCSP statuses of certificates until their next
+	// update, keyed by issuer and serial number
+	ocspCache  *cache.Cache
+	ocspClient *http.Client
 }
 
 func (b *backend) invalidate(_ context.Context, key string) {
@@ -11,13 +11,17 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/big"
 	"net"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,6 +38,7 @@ import (
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	"github.com/hashicorp/vault/vault"
 	"github.com/mitchellh/mapstructure"
+	"golang.org/x/crypto/ocsp"
 )
 
 const (
@@ -1757,3 +1762,297 @@ func Test_Renew(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+// testGenerateCA returns a fresh self-signed CA and its key
+func testGenerateCA(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, caKey
+}
+
+// testClientConnState issues a client certificate from the template and
+// returns a connection state presenting it
+func testClientConnState(t *testing.T, template *x509.Certificate, ca *x509.Certificate, caKey *rsa.PrivateKey) tls.ConnectionState {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+}
+
+func TestBackend_OCSP(t *testing.T) {
+	// Generate a CA and client certificates pointing at a local OCSP
+	// responder
+	ca, caKey := testGenerateCA(t)
+	caDER := ca.Raw
+
+	revoked := big.NewInt(3)
+	var requests int
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.Write(ocsp.MalformedRequestErrorResponse)
+			return
+		}
+
+		template := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if req.SerialNumber.Cmp(revoked) == 0 {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = time.Now().Add(-time.Minute)
+		}
+		resp, err := ocsp.CreateResponse(ca, ca, template, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	clientConnState := func(serial int64, ocspServers []string) tls.ConnectionState {
+		return testClientConnState(t, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "client"},
+			OCSPServer:   ocspServers,
+		}, ca, caKey)
+	}
+
+	b := testFactory(t)
+	storage := &logical.InmemStorage{}
+
+	writeCert := func(data map[string]interface{}) {
+		data["certificate"] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+		data["policies"] = "default"
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "certs/ca",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+	login := func(connState tls.ConnectionState) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login",
+			Storage:   storage,
+			Connection: &logical.Connection{
+				ConnState:  &connState,
+				RemoteAddr: "127.0.0.1",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	writeCert(map[string]interface{}{
+		"ocsp_enabled": true,
+	})
+
+	// A good certificate is allowed, and its status is cached
+	good := clientConnState(2, []string{responder.URL})
+	for i := 0; i < 2; i++ {
+		resp := login(good)
+		if resp == nil || resp.IsError() || resp.Auth == nil {
+			t.Fatalf("expected login to succeed, got %#v", resp)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("expected a single OCSP request, got %d", requests)
+	}
+
+	// A revoked certificate is refused with the reason
+	resp := login(clientConnState(3, []string{responder.URL}))
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "OCSP: certificate is revoked") {
+		t.Fatalf("expected revocation error, got %#v", resp)
+	}
+
+	// Without a reachable responder, logins fail closed...
+	unreachable := clientConnState(4, []string{"http://127.0.0.1:1/ocsp"})
+	resp = login(unreachable)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "OCSP: unable to verify") {
+		t.Fatalf("expected OCSP error, got %#v", resp)
+	}
+
+	// ...unless configured to fail open
+	writeCert(map[string]interface{}{
+		"ocsp_enabled":   true,
+		"ocsp_fail_open": true,
+	})
+	resp = login(unreachable)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("expected login to succeed, got %#v", resp)
+	}
+
+	// Configured responders take precedence over the AIA of the certificate
+	writeCert(map[string]interface{}{
+		"ocsp_enabled":          true,
+		"ocsp_servers_override": responder.URL,
+	})
+	resp = login(clientConnState(5, []string{"http://127.0.0.1:1/ocsp"}))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("expected login to succeed, got %#v", resp)
+	}
+	resp = login(clientConnState(3, []string{"http://127.0.0.1:1/ocsp"}))
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "OCSP: certificate is revoked") {
+		t.Fatalf("expected revocation error, got %#v", resp)
+	}
+
+	// Revoked certificates are refused even when failing open
+	writeCert(map[string]interface{}{
+		"ocsp_enabled":   true,
+		"ocsp_fail_open": true,
+	})
+	resp = login(clientConnState(3, []string{responder.URL}))
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected revocation error, got %#v", resp)
+	}
+
+	// Reading the entry returns the OCSP settings
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "certs/ca",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if resp.Data["ocsp_enabled"] != true || resp.Data["ocsp_fail_open"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBackend_organizationalUnitsAndMatchedNames(t *testing.T) {
+	ca, caKey := testGenerateCA(t)
+	spiffeID, err := url.Parse("spiffe://example.org/ns/prod/sa/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connState := testClientConnState(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			CommonName:         "web",
+			OrganizationalUnit: []string{"engineering", "mesh"},
+		},
+		DNSNames: []string{"web.example.org"},
+		URIs:     []*url.URL{spiffeID},
+	}, ca, caKey)
+
+	b := testFactory(t)
+	storage := &logical.InmemStorage{}
+
+	login := func(data map[string]interface{}) *logical.Response {
+		data["certificate"] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}))
+		data["policies"] = "default"
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "certs/mesh",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login",
+			Storage:   storage,
+			Connection: &logical.Connection{
+				ConnState:  &connState,
+				RemoteAddr: "127.0.0.1",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Unconstrained names are not recorded
+	resp := login(map[string]interface{}{})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("expected login to succeed, got %#v", resp)
+	}
+	if resp.Auth.Alias.Metadata != nil {
+		t.Fatalf("unexpected alias metadata: %#v", resp.Auth.Alias.Metadata)
+	}
+
+	// Matched names are recorded on the alias
+	resp = login(map[string]interface{}{
+		"allowed_organizational_units": "sales,mes*",
+		"allowed_uri_sans":             "spiffe://example.org/ns/prod/*",
+		"allowed_dns_sans":             "*.example.org",
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("expected login to succeed, got %#v", resp)
+	}
+	expected := map[string]string{
+		"matched_organizational_unit": "mesh",
+		"matched_uri_san":             spiffeID.String(),
+		"matched_dns_san":             "web.example.org",
+	}
+	if !reflect.DeepEqual(resp.Auth.Alias.Metadata, expected) {
+		t.Fatalf("bad alias metadata: expected %#v, got %#v", expected, resp.Auth.Alias.Metadata)
+	}
+
+	// Certificates outside the allowed organizational units are refused
+	resp = login(map[string]interface{}{
+		"allowed_organizational_units": "sales",
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "allowed_organizational_units") {
+		t.Fatalf("expected organizational unit error, got %#v", resp)
+	}
+
+	// As are URI SANs outside the allowed patterns
+	resp = login(map[string]interface{}{
+		"allowed_uri_sans": "spiffe://example.org/ns/staging/*",
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "allowed_uri_sans") {
+		t.Fatalf("expected URI SAN error, got %#v", resp)
+	}
+}
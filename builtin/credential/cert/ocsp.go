@@ -0,0 +1,146 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	multierror "github.com/hashicorp/go-multierror"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// ocspMaxResponseSize bounds the size of responses read from OCSP
+	// responders
+	ocspMaxResponseSize = 1024 * 1024
+
+	// ocspClockSkew is the tolerated difference between the clock of an OCSP
+	// responder and the local clock
+	ocspClockSkew = 5 * time.Minute
+)
+
+// checkOCSP checks the revocation status of cert with OCSP. Revoked
+// certificates are always refused; if no status can be obtained, the login
+// is refused unless the entry is set to fail open.
+func (b *backend) checkOCSP(ctx context.Context, entry *CertEntry, cert *x509.Certificate, issuer *x509.Certificate) error {
+	status, err := b.ocspStatus(ctx, entry, cert, issuer)
+	switch {
+	case err != nil && entry.OcspFailOpen:
+		b.Logger().Warn("unable to verify the OCSP status of the certificate, allowing login as the certificate role fails open", "cert_name", entry.Name, "serial_number", cert.SerialNumber.String(), "error", err)
+		return nil
+	case err != nil:
+		return errwrap.Wrapf("OCSP: unable to verify the certificate status: {{err}}", err)
+	case status == ocsp.Revoked:
+		return errors.New("OCSP: certificate is revoked")
+	}
+	return nil
+}
+
+// ocspStatus returns the status of cert, either from the cache or from the
+// first configured responder giving a definite answer. Statuses are cached
+// until their next update.
+func (b *backend) ocspStatus(ctx context.Context, entry *CertEntry, cert *x509.Certificate, issuer *x509.Certificate) (int, error) {
+	if issuer == nil {
+		return 0, errors.New("issuer of the certificate not found")
+	}
+
+	cacheKey := fmt.Sprintf("%x/%s", sha256.Sum256(issuer.Raw), cert.SerialNumber.String())
+	if status, ok := b.ocspCache.Get(cacheKey); ok {
+		return status.(int), nil
+	}
+
+	servers := entry.OcspServersOverride
+	if len(servers) == 0 {
+		servers = cert.OCSPServer
+	}
+	if len(servers) == 0 {
+		return 0, errors.New("no OCSP responders configured or found in the certificate")
+	}
+
+	ocspReq, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs *multierror.Error
+	for _, server := range servers {
+		resp, err := b.queryOCSP(ctx, server, ocspReq, cert, issuer)
+		if err != nil {
+			errs = multierror.Append(errs, errwrap.Wrapf(fmt.Sprintf("error querying %q: {{err}}", server), err))
+			continue
+		}
+		if resp.Status == ocsp.Unknown {
+			errs = multierror.Append(errs, fmt.Errorf("%q does not know the certificate", server))
+			continue
+		}
+
+		if !resp.NextUpdate.IsZero() {
+			b.ocspCache.Set(cacheKey, resp.Status, time.Until(resp.NextUpdate))
+		}
+		return resp.Status, nil
+	}
+
+	return 0, errs.ErrorOrNil()
+}
+
+// queryOCSP sends the request to an OCSP responder and returns its verified
+// response
+func (b *backend) queryOCSP(ctx context.Context, server string, ocspReq []byte, cert *x509.Certificate, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := http.NewRequest("POST", server, bytes.NewReader(ocspReq))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	httpResp, err := b.ocspClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %q", httpResp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if resp.ThisUpdate.After(now.Add(ocspClockSkew)) {
+		return nil, errors.New("response is not valid yet")
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Add(ocspClockSkew).Before(now) {
+		return nil, errors.New("response is stale")
+	}
+
+	return resp, nil
+}
+
+// findIssuer returns the certificate among candidates that signed cert
+func findIssuer(cert *x509.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range candidates {
+		if candidate.Equal(cert) {
+			continue
+		}
+		if cert.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+	return nil
+}
@@ -74,6 +74,12 @@ At least one must exist in the SANs. Supports globbing.`,
 At least one must exist in the SANs. Supports globbing.`,
 			},
 
+			"allowed_organizational_units": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of Organizational Units names.
+At least one must exist in the OU field. Supports globbing.`,
+			},
+
 			"required_extensions": &framework.FieldSchema{
 				Type: framework.TypeCommaStringSlice,
 				Description: `A comma-separated string or array of extensions
@@ -123,6 +129,24 @@ TTL will be set to the value of this parameter.`,
 				Description: `Comma separated string or list of CIDR blocks. If set, specifies the blocks of
 IP addresses which can perform the login operation.`,
 			},
+
+			"ocsp_enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Whether to check the revocation status of client certificates with OCSP.`,
+			},
+
+			"ocsp_servers_override": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of OCSP responder URLs to query, in order.
+If not set, the responders listed in the AIA extension of the client
+certificate are used.`,
+			},
+
+			"ocsp_fail_open": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, logins are allowed when no OCSP responder gives the status of
+the client certificate. Revoked certificates are always refused.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -179,18 +203,22 @@ func (b *backend) pathCertRead(ctx context.Context, req *logical.Request, d *fra
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"certificate":          cert.Certificate,
-			"display_name":         cert.DisplayName,
-			"policies":             cert.Policies,
-			"ttl":                  cert.TTL / time.Second,
-			"max_ttl":              cert.MaxTTL / time.Second,
-			"period":               cert.Period / time.Second,
-			"allowed_names":        cert.AllowedNames,
-			"allowed_common_names": cert.AllowedCommonNames,
-			"allowed_dns_sans":     cert.AllowedDNSSANs,
-			"allowed_email_sans":   cert.AllowedEmailSANs,
-			"allowed_uri_sans":     cert.AllowedURISANs,
-			"required_extensions":  cert.RequiredExtensions,
+			"certificate":                  cert.Certificate,
+			"display_name":                 cert.DisplayName,
+			"policies":                     cert.Policies,
+			"ttl":                          cert.TTL / time.Second,
+			"max_ttl":                      cert.MaxTTL / time.Second,
+			"period":                       cert.Period / time.Second,
+			"allowed_names":                cert.AllowedNames,
+			"allowed_common_names":         cert.AllowedCommonNames,
+			"allowed_dns_sans":             cert.AllowedDNSSANs,
+			"allowed_email_sans":           cert.AllowedEmailSANs,
+			"allowed_uri_sans":             cert.AllowedURISANs,
+			"allowed_organizational_units": cert.AllowedOrganizationalUnits,
+			"required_extensions":          cert.RequiredExtensions,
+			"ocsp_enabled":                 cert.OcspEnabled,
+			"ocsp_servers_override":        cert.OcspServersOverride,
+			"ocsp_fail_open":               cert.OcspFailOpen,
 		},
 	}, nil
 }
@@ -205,7 +233,11 @@ func (b *backend) pathCertWrite(ctx context.Context, req *logical.Request, d *fr
 	allowedDNSSANs := d.Get("allowed_dns_sans").([]string)
 	allowedEmailSANs := d.Get("allowed_email_sans").([]string)
 	allowedURISANs := d.Get("allowed_uri_sans").([]string)
+	allowedOrganizationalUnits := d.Get("allowed_organizational_units").([]string)
 	requiredExtensions := d.Get("required_extensions").([]string)
+	ocspEnabled := d.Get("ocsp_enabled").(bool)
+	ocspServersOverride := d.Get("ocsp_servers_override").([]string)
+	ocspFailOpen := d.Get("ocsp_fail_open").(bool)
 
 	var resp logical.Response
 
@@ -278,20 +310,24 @@ func (b *backend) pathCertWrite(ctx context.Context, req *logical.Request, d *fr
 	}
 
 	certEntry := &CertEntry{
-		Name:               name,
-		Certificate:        certificate,
-		DisplayName:        displayName,
-		Policies:           policies,
-		AllowedNames:       allowedNames,
-		AllowedCommonNames: allowedCommonNames,
-		AllowedDNSSANs:     allowedDNSSANs,
-		AllowedEmailSANs:   allowedEmailSANs,
-		AllowedURISANs:     allowedURISANs,
-		RequiredExtensions: requiredExtensions,
-		TTL:                ttl,
-		MaxTTL:             maxTTL,
-		Period:             period,
-		BoundCIDRs:         parsedCIDRs,
+		Name:                       name,
+		Certificate:                certificate,
+		DisplayName:                displayName,
+		Policies:                   policies,
+		AllowedNames:               allowedNames,
+		AllowedCommonNames:         allowedCommonNames,
+		AllowedDNSSANs:             allowedDNSSANs,
+		AllowedEmailSANs:           allowedEmailSANs,
+		AllowedURISANs:             allowedURISANs,
+		AllowedOrganizationalUnits: allowedOrganizationalUnits,
+		RequiredExtensions:         requiredExtensions,
+		TTL:                        ttl,
+		MaxTTL:                     maxTTL,
+		Period:                     period,
+		BoundCIDRs:                 parsedCIDRs,
+		OcspEnabled:                ocspEnabled,
+		OcspServersOverride:        ocspServersOverride,
+		OcspFailOpen:               ocspFailOpen,
 	}
 
 	// Store it
@@ -311,20 +347,25 @@ func (b *backend) pathCertWrite(ctx context.Context, req *logical.Request, d *fr
 }
 
 type CertEntry struct {
-	Name               string
-	Certificate        string
-	DisplayName        string
-	Policies           []string
-	TTL                time.Duration
-	MaxTTL             time.Duration
-	Period             time.Duration
-	AllowedNames       []string
-	AllowedCommonNames []string
-	AllowedDNSSANs     []string
-	AllowedEmailSANs   []string
-	AllowedURISANs     []string
-	RequiredExtensions []string
-	BoundCIDRs         []*sockaddr.SockAddrMarshaler
+	Name                       string
+	Certificate                string
+	DisplayName                string
+	Policies                   []string
+	TTL                        time.Duration
+	MaxTTL                     time.Duration
+	Period                     time.Duration
+	AllowedNames               []string
+	AllowedCommonNames         []string
+	AllowedDNSSANs             []string
+	AllowedEmailSANs           []string
+	AllowedURISANs             []string
+	AllowedOrganizationalUnits []string
+	RequiredExtensions         []string
+	BoundCIDRs                 []*sockaddr.SockAddrMarshaler
+
+	OcspEnabled         bool
+	OcspServersOverride []string
+	OcspFailOpen        bool
 }
 
 const pathCertHelpSyn = `
@@ -14,6 +14,7 @@ import (
 
 	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 
@@ -105,7 +106,8 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 				MaxTTL:    matched.Entry.MaxTTL,
 			},
 			Alias: &logical.Alias{
-				Name: clientCerts[0].Subject.CommonName,
+				Name:     clientCerts[0].Subject.CommonName,
+				Metadata: matchedNames(clientCerts[0], matched.Entry),
 			},
 			BoundCIDRs: matched.Entry.BoundCIDRs,
 		},
@@ -200,6 +202,16 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 		return nil, nil, err
 	}
 
+	// The reasons the certificate was rejected by each entry, reported when
+	// no entry matches
+	var rejections []string
+	reject := func(trust *ParsedCert, err error) {
+		rejection := fmt.Sprintf("%q: %v", trust.Entry.Name, err)
+		if !strutil.StrListContains(rejections, rejection) {
+			rejections = append(rejections, rejection)
+		}
+	}
+
 	// If trustedNonCAs is not empty it means that client had registered a non-CA cert
 	// with the backend.
 	if len(trustedNonCAs) != 0 {
@@ -207,8 +219,11 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 			tCert := trustedNonCA.Certificates[0]
 			// Check for client cert being explicitly listed in the config (and matching other constraints)
 			if tCert.SerialNumber.Cmp(clientCert.SerialNumber) == 0 &&
-				bytes.Equal(tCert.AuthorityKeyId, clientCert.AuthorityKeyId) &&
-				b.matchesConstraints(clientCert, trustedNonCA.Certificates, trustedNonCA) {
+				bytes.Equal(tCert.AuthorityKeyId, clientCert.AuthorityKeyId) {
+				if err := b.checkConstraints(ctx, clientCert, trustedNonCA.Certificates, connState.PeerCertificates, trustedNonCA); err != nil {
+					reject(trustedNonCA, err)
+					continue
+				}
 				return trustedNonCA, nil, nil
 			}
 		}
@@ -217,6 +232,9 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 	// If no trusted chain was found, client is not authenticated
 	// This check happens after checking for a matching configured non-CA certs
 	if len(trustedChains) == 0 {
+		if len(rejections) != 0 {
+			return nil, logical.ErrorResponse(fmt.Sprintf("certificate rejected by %s", strings.Join(rejections, "; "))), nil
+		}
 		return nil, logical.ErrorResponse("invalid certificate or no client certificate supplied"), nil
 	}
 
@@ -226,11 +244,16 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 		for _, tCert := range trust.Certificates { // For each certificate in the entry
 			for _, chain := range trustedChains { // For each root chain that we matched
 				for _, cCert := range chain { // For each cert in the matched chain
-					if tCert.Equal(cCert) && // ParsedCert intersects with matched chain
-						b.matchesConstraints(clientCert, chain, trust) { // validate client cert + matched chain against the config
-						// Add the match to the list
-						matches = append(matches, trust)
+					if !tCert.Equal(cCert) { // ParsedCert intersects with matched chain
+						continue
+					}
+					// validate client cert + matched chain against the config
+					if err := b.checkConstraints(ctx, clientCert, chain, chain, trust); err != nil {
+						reject(trust, err)
+						continue
 					}
+					// Add the match to the list
+					matches = append(matches, trust)
 				}
 			}
 		}
@@ -238,6 +261,9 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 
 	// Fail on no matches
 	if len(matches) == 0 {
+		if len(rejections) != 0 {
+			return nil, logical.ErrorResponse(fmt.Sprintf("no chain matching all constraints could be found for this login certificate: rejected by %s", strings.Join(rejections, "; "))), nil
+		}
 		return nil, logical.ErrorResponse("no chain matching all constraints could be found for this login certificate"), nil
 	}
 
@@ -245,14 +271,34 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 	return matches[0], nil, nil
 }
 
-func (b *backend) matchesConstraints(clientCert *x509.Certificate, trustedChain []*x509.Certificate, config *ParsedCert) bool {
-	return !b.checkForChainInCRLs(trustedChain) &&
-		b.matchesNames(clientCert, config) &&
-		b.matchesCommonName(clientCert, config) &&
-		b.matchesDNSSANs(clientCert, config) &&
-		b.matchesEmailSANs(clientCert, config) &&
-		b.matchesURISANs(clientCert, config) &&
-		b.matchesCertificateExtensions(clientCert, config)
+// checkConstraints validates the client certificate and its chain against
+// the configured entry, returning the check that rejected it if any. OCSP is
+// checked last as it is the only check that reaches out to other servers;
+// the issuer of the client certificate is looked up in issuerCandidates.
+func (b *backend) checkConstraints(ctx context.Context, clientCert *x509.Certificate, trustedChain []*x509.Certificate, issuerCandidates []*x509.Certificate, config *ParsedCert) error {
+	switch {
+	case b.checkForChainInCRLs(trustedChain):
+		return errors.New("certificate or its chain is revoked by a configured CRL")
+	case !b.matchesNames(clientCert, config):
+		return errors.New("no name matches allowed_names")
+	case !b.matchesCommonName(clientCert, config):
+		return errors.New("common name does not match allowed_common_names")
+	case !b.matchesDNSSANs(clientCert, config):
+		return errors.New("no DNS SAN matches allowed_dns_sans")
+	case !b.matchesEmailSANs(clientCert, config):
+		return errors.New("no email SAN matches allowed_email_sans")
+	case !b.matchesURISANs(clientCert, config):
+		return errors.New("no URI SAN matches allowed_uri_sans")
+	case !b.matchesOrganizationalUnits(clientCert, config):
+		return errors.New("no organizational unit matches allowed_organizational_units")
+	case !b.matchesCertificateExtensions(clientCert, config):
+		return errors.New("certificate extensions do not match required_extensions")
+	}
+
+	if config.Entry.OcspEnabled {
+		return b.checkOCSP(ctx, config.Entry, clientCert, findIssuer(clientCert, issuerCandidates))
+	}
+	return nil
 }
 
 // matchesNames verifies that the certificate matches at least one configured
@@ -309,15 +355,8 @@ func (b *backend) matchesDNSSANs(clientCert *x509.Certificate, config *ParsedCer
 		return true
 	}
 	// At least one pattern must match at least one name if any patterns are specified
-	for _, allowedDNS := range config.Entry.AllowedDNSSANs {
-		for _, name := range clientCert.DNSNames {
-			if glob.Glob(allowedDNS, name) {
-				return true
-			}
-		}
-	}
-
-	return false
+	_, ok := matchGlobs(config.Entry.AllowedDNSSANs, clientCert.DNSNames)
+	return ok
 }
 
 // matchesEmailSANs verifies that the certificate matches at least one configured
@@ -328,15 +367,8 @@ func (b *backend) matchesEmailSANs(clientCert *x509.Certificate, config *ParsedC
 		return true
 	}
 	// At least one pattern must match at least one name if any patterns are specified
-	for _, allowedEmail := range config.Entry.AllowedEmailSANs {
-		for _, email := range clientCert.EmailAddresses {
-			if glob.Glob(allowedEmail, email) {
-				return true
-			}
-		}
-	}
-
-	return false
+	_, ok := matchGlobs(config.Entry.AllowedEmailSANs, clientCert.EmailAddresses)
+	return ok
 }
 
 // matchesURISANs verifies that the certificate matches at least one configured
@@ -347,15 +379,66 @@ func (b *backend) matchesURISANs(clientCert *x509.Certificate, config *ParsedCer
 		return true
 	}
 	// At least one pattern must match at least one name if any patterns are specified
-	for _, allowedURI := range config.Entry.AllowedURISANs {
-		for _, name := range clientCert.URIs {
-			if glob.Glob(allowedURI, name.String()) {
-				return true
+	_, ok := matchGlobs(config.Entry.AllowedURISANs, uriStrings(clientCert))
+	return ok
+}
+
+// matchesOrganizationalUnits verifies that the certificate matches at least
+// one configured allowed organizational unit
+func (b *backend) matchesOrganizationalUnits(clientCert *x509.Certificate, config *ParsedCert) bool {
+	// Default behavior (no OUs) is to allow all OUs
+	if len(config.Entry.AllowedOrganizationalUnits) == 0 {
+		return true
+	}
+	// At least one pattern must match at least one OU if any patterns are specified
+	_, ok := matchGlobs(config.Entry.AllowedOrganizationalUnits, clientCert.Subject.OrganizationalUnit)
+	return ok
+}
+
+// matchedNames returns the SANs and organizational unit of the certificate
+// that matched the constraints of the entry, to be recorded on the alias so
+// that policies can be templated on them. Unconstrained names are omitted.
+func matchedNames(clientCert *x509.Certificate, entry *CertEntry) map[string]string {
+	metadata := make(map[string]string)
+	record := func(key string, patterns []string, values []string) {
+		if len(patterns) == 0 {
+			return
+		}
+		if value, ok := matchGlobs(patterns, values); ok {
+			metadata[key] = value
+		}
+	}
+
+	record("matched_dns_san", entry.AllowedDNSSANs, clientCert.DNSNames)
+	record("matched_email_san", entry.AllowedEmailSANs, clientCert.EmailAddresses)
+	record("matched_uri_san", entry.AllowedURISANs, uriStrings(clientCert))
+	record("matched_organizational_unit", entry.AllowedOrganizationalUnits, clientCert.Subject.OrganizationalUnit)
+
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// matchGlobs returns the first value matching any of the patterns
+func matchGlobs(patterns []string, values []string) (string, bool) {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if glob.Glob(pattern, value) {
+				return value, true
 			}
 		}
 	}
+	return "", false
+}
 
-	return false
+// uriStrings returns the URI SANs of the certificate as strings
+func uriStrings(clientCert *x509.Certificate) []string {
+	uris := make([]string, 0, len(clientCert.URIs))
+	for _, uri := range clientCert.URIs {
+		uris = append(uris, uri.String())
+	}
+	return uris
 }
 
 // matchesCertificateExtensions verifies that the certificate matches configured
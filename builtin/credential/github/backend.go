@@ -35,7 +35,15 @@ func Backend() *backend {
 		DefaultKey: "default",
 	}
 
+	b.AppMap = &framework.PolicyMap{
+		PathMap: framework.PathMap{
+			Name: "apps",
+		},
+		DefaultKey: "default",
+	}
+
 	allPaths := append(b.TeamMap.Paths(), b.UserMap.Paths()...)
+	allPaths = append(allPaths, b.AppMap.Paths()...)
 	b.Backend = &framework.Backend{
 		Help: backendHelp,
 
@@ -62,6 +70,10 @@ type backend struct {
 	TeamMap *framework.PolicyMap
 
 	UserMap *framework.PolicyMap
+
+	// AppMap maps the slugs of GitHub Apps logging in with installation
+	// tokens to policies
+	AppMap *framework.PolicyMap
 }
 
 // Client returns the GitHub client to communicate to GitHub via the
@@ -91,7 +103,12 @@ The GitHub credential provider allows authentication via GitHub.
 Users provide a personal access token to log in, and the credential
 provider verifies they're part of the correct organization and then
 maps the user to a set of Vault policies according to the teams they're
-part of.
+part of. Teams are mapped by slug.
+
+GitHub Apps, such as CI bots, log in with an installation token and
+the "installation" token type. The installation must have access to
+repositories of the organization, and the app is mapped to policies
+by its slug through "map/apps".
 
 After enabling the credential provider, use the "config" route to
 configure it.
@@ -3,7 +3,10 @@ package github
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -199,3 +202,199 @@ func testAccLogin(t *testing.T, policies []string) logicaltest.TestStep {
 		Check: logicaltest.TestCheckAuth(policies),
 	}
 }
+
+func TestBackend_stubbedAPI(t *testing.T) {
+	const orgID = 10
+	userInOrg := true
+
+	mux := http.NewServeMux()
+	requireToken := func(w http.ResponseWriter, r *http.Request, token string) bool {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		if requireToken(w, r, "user-token") {
+			fmt.Fprint(w, `{"login": "alice", "id": 1}`)
+		}
+	})
+	mux.HandleFunc("/api/v3/user/orgs", func(w http.ResponseWriter, r *http.Request) {
+		if !requireToken(w, r, "user-token") {
+			return
+		}
+		if userInOrg {
+			fmt.Fprintf(w, `[{"login": "Example", "id": %d}]`, orgID)
+		} else {
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	mux.HandleFunc("/api/v3/user/teams", func(w http.ResponseWriter, r *http.Request) {
+		if requireToken(w, r, "user-token") {
+			fmt.Fprintf(w, `[
+				{"name": "Site Reliability", "slug": "site-reliability", "organization": {"id": %d}},
+				{"name": "elsewhere", "slug": "elsewhere", "organization": {"id": 11}}
+			]`, orgID)
+		}
+	})
+	mux.HandleFunc("/api/v3/installation/repositories", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer installation-token":
+			fmt.Fprintf(w, `{"total_count": 1, "repositories": [{"name": "app", "owner": {"login": "example", "id": %d}}]}`, orgID)
+		case "Bearer other-installation-token":
+			fmt.Fprint(w, `{"total_count": 1, "repositories": [{"name": "app", "owner": {"login": "other", "id": 11}}]}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+	mux.HandleFunc("/api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.Header.Get("Authorization") {
+		case "Bearer installation-token", "Bearer other-installation-token":
+			fmt.Fprint(w, `{"data": {"viewer": {"login": "ci-bot[bot]"}}}`)
+		default:
+			fmt.Fprint(w, `{"data": {"viewer": {"login": "alice"}}}`)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	storage := &logical.InmemStorage{}
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+
+	ctx := context.Background()
+	b, err := Factory(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   storage,
+		})
+	}
+
+	// The base URL of GitHub Enterprise is used with or without a trailing
+	// slash
+	resp, err := write("config", map[string]interface{}{
+		"organization": "example",
+		"base_url":     server.URL + "/api/v3",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.Data["base_url"] != server.URL+"/api/v3/" {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	for path, policy := range map[string]string{
+		"map/teams/site-reliability": "sre",
+		"map/teams/elsewhere":        "elsewhere",
+		"map/users/alice":            "alice",
+		"map/apps/ci-bot":            "ci",
+	} {
+		if resp, err := write(path, map[string]interface{}{"value": policy}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+
+	// Users are mapped by team slug
+	resp, err = write("login", map[string]interface{}{"token": "user-token"})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if !reflect.DeepEqual(resp.Auth.Policies, []string{"sre", "alice"}) {
+		t.Fatalf("bad: policies: %#v", resp.Auth.Policies)
+	}
+	if resp.Auth.Metadata["username"] != "alice" || resp.Auth.Metadata["org"] != "Example" {
+		t.Fatalf("bad: metadata: %#v", resp.Auth.Metadata)
+	}
+	var groups []string
+	for _, alias := range resp.Auth.GroupAliases {
+		groups = append(groups, alias.Name)
+	}
+	if !reflect.DeepEqual(groups, []string{"site-reliability", "Site Reliability"}) {
+		t.Fatalf("bad: group aliases: %#v", groups)
+	}
+
+	// Renewals verify the membership of the organization again
+	renew := func(auth *logical.Auth) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.RenewOperation,
+			Path:      "login",
+			Auth:      auth,
+			Storage:   storage,
+		})
+	}
+	userAuth := resp.Auth
+	if resp, err := renew(userAuth); err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	userInOrg = false
+	if resp, err := renew(userAuth); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected renewal failure, got resp: %#v", resp)
+	}
+
+	// GitHub Apps are mapped by slug
+	resp, err = write("login", map[string]interface{}{
+		"token":      "installation-token",
+		"token_type": "installation",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if !reflect.DeepEqual(resp.Auth.Policies, []string{"ci"}) {
+		t.Fatalf("bad: policies: %#v", resp.Auth.Policies)
+	}
+	expectedMetadata := map[string]string{
+		"username": "ci-bot[bot]",
+		"org":      "example",
+		"app_slug": "ci-bot",
+	}
+	if !reflect.DeepEqual(resp.Auth.Metadata, expectedMetadata) || resp.Auth.Alias.Name != "ci-bot[bot]" {
+		t.Fatalf("bad: metadata: %#v", resp.Auth.Metadata)
+	}
+	if resp, err := renew(resp.Auth); err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Installations must have access to repositories of the organization
+	resp, err = write("login", map[string]interface{}{
+		"token":      "other-installation-token",
+		"token_type": "installation",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Personal tokens are not taken as installation tokens
+	resp, err = write("login", map[string]interface{}{
+		"token":      "user-token",
+		"token_type": "installation",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error, got resp: %#v", resp)
+	}
+
+	resp, err = write("login", map[string]interface{}{
+		"token":      "user-token",
+		"token_type": "oauth",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got resp: %#v\nerr: %v", resp, err)
+	}
+}
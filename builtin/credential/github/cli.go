@@ -52,10 +52,15 @@ func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (*api.Secret, erro
 		}
 	}
 
-	path := fmt.Sprintf("auth/%s/login", mount)
-	secret, err := c.Logical().Write(path, map[string]interface{}{
+	data := map[string]interface{}{
 		"token": strings.TrimSpace(token),
-	})
+	}
+	if tokenType, ok := m["token_type"]; ok {
+		data["token_type"] = tokenType
+	}
+
+	path := fmt.Sprintf("auth/%s/login", mount)
+	secret, err := c.Logical().Write(path, data)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +83,10 @@ Usage: vault login -method=github [CONFIG K=V...]
 
       $ vault login -method=github token=abcd1234
 
+  Authenticate a GitHub App using an installation token:
+
+      $ vault login -method=github token_type=installation token=v1.abcd1234
+
 Configuration:
 
   mount=<string>
@@ -89,6 +98,11 @@ Configuration:
   token=<string>
       GitHub personal access token to use for authentication. If not provided,
       Vault will prompt for the value.
+
+  token_type=<string>
+      Type of the token: "personal" for personal access tokens, or
+      "installation" for installation tokens of GitHub Apps. The default value
+      is "personal".
 `
 
 	return strings.TrimSpace(help)
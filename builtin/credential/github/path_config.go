@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/errwrap"
@@ -24,7 +25,9 @@ func pathConfig(b *backend) *framework.Path {
 				Type: framework.TypeString,
 				Description: `The API endpoint to use. Useful if you
 are running GitHub Enterprise or an
-API-compatible authentication server.`,
+API-compatible authentication server.
+For GitHub Enterprise, this is of the form
+https://github.example.com/api/v3/`,
 			},
 			"ttl": &framework.FieldSchema{
 				Type:        framework.TypeString,
@@ -47,10 +50,11 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, dat
 	organization := data.Get("organization").(string)
 	baseURL := data.Get("base_url").(string)
 	if len(baseURL) != 0 {
-		_, err := url.Parse(baseURL)
+		parsedURL, err := parseBaseURL(baseURL)
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf("Error parsing given base_url: %s", err)), nil
 		}
+		baseURL = parsedURL.String()
 	}
 
 	var ttl time.Duration
@@ -135,6 +139,25 @@ func (b *backend) Config(ctx context.Context, s logical.Storage) (*config, error
 	return &result, nil
 }
 
+// parseBaseURL parses the API endpoint, adding the trailing slash that
+// relative API paths are resolved against
+func parseBaseURL(baseURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", parsedURL.Scheme)
+	}
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	if !strings.HasSuffix(parsedURL.Path, "/") {
+		parsedURL.Path += "/"
+	}
+	return parsedURL, nil
+}
+
 type config struct {
 	Organization string        `json:"organization" structs:"organization" mapstructure:"organization"`
 	BaseURL      string        `json:"base_url" structs:"base_url" mapstructure:"base_url"`
@@ -3,7 +3,6 @@ package github
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"strings"
 
 	"github.com/google/go-github/github"
@@ -13,13 +12,28 @@ import (
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+const (
+	tokenTypePersonal     = "personal"
+	tokenTypeInstallation = "installation"
+
+	// botLoginSuffix ends the logins of the bot accounts of GitHub Apps
+	botLoginSuffix = "[bot]"
+)
+
 func pathLogin(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "login",
 		Fields: map[string]*framework.FieldSchema{
 			"token": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "GitHub personal API token",
+				Description: "GitHub personal API token, or GitHub App installation token",
+			},
+
+			"token_type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: tokenTypePersonal,
+				Description: `Type of the token: "personal" for personal API tokens of users, or
+"installation" for installation tokens of GitHub Apps. Defaults to "personal".`,
 			},
 		},
 
@@ -32,9 +46,10 @@ func pathLogin(b *backend) *framework.Path {
 
 func (b *backend) pathLoginAliasLookahead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	token := data.Get("token").(string)
+	tokenType := data.Get("token_type").(string)
 
 	var verifyResp *verifyCredentialsResp
-	if verifyResponse, resp, err := b.verifyCredentials(ctx, req, token); err != nil {
+	if verifyResponse, resp, err := b.verifyCredentials(ctx, req, token, tokenType); err != nil {
 		return nil, err
 	} else if resp != nil {
 		return resp, nil
@@ -53,9 +68,10 @@ func (b *backend) pathLoginAliasLookahead(ctx context.Context, req *logical.Requ
 
 func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	token := data.Get("token").(string)
+	tokenType := data.Get("token_type").(string)
 
 	var verifyResp *verifyCredentialsResp
-	if verifyResponse, resp, err := b.verifyCredentials(ctx, req, token); err != nil {
+	if verifyResponse, resp, err := b.verifyCredentials(ctx, req, token, tokenType); err != nil {
 		return nil, err
 	} else if resp != nil {
 		return resp, nil
@@ -71,7 +87,8 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 	resp := &logical.Response{
 		Auth: &logical.Auth{
 			InternalData: map[string]interface{}{
-				"token": token,
+				"token":      token,
+				"token_type": tokenType,
 			},
 			Policies: verifyResp.Policies,
 			Metadata: map[string]string{
@@ -90,6 +107,10 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, data *fra
 		},
 	}
 
+	if verifyResp.AppSlug != "" {
+		resp.Auth.Metadata["app_slug"] = verifyResp.AppSlug
+	}
+
 	for _, teamName := range verifyResp.TeamNames {
 		if teamName == "" {
 			continue
@@ -113,8 +134,16 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 	}
 	token := tokenRaw.(string)
 
+	// Tokens created before installation tokens were supported are personal
+	tokenType := tokenTypePersonal
+	if tokenTypeRaw, ok := req.Auth.InternalData["token_type"]; ok {
+		tokenType = tokenTypeRaw.(string)
+	}
+
+	// Verifying the credentials again ensures that the user or the app is
+	// still part of the organization
 	var verifyResp *verifyCredentialsResp
-	if verifyResponse, resp, err := b.verifyCredentials(ctx, req, token); err != nil {
+	if verifyResponse, resp, err := b.verifyCredentials(ctx, req, token, tokenType); err != nil {
 		return nil, err
 	} else if resp != nil {
 		return resp, nil
@@ -146,7 +175,7 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 	return resp, nil
 }
 
-func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, token string) (*verifyCredentialsResp, *logical.Response, error) {
+func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, token string, tokenType string) (*verifyCredentialsResp, *logical.Response, error) {
 	config, err := b.Config(ctx, req.Storage)
 	if err != nil {
 		return nil, nil, err
@@ -162,13 +191,21 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, t
 	}
 
 	if config.BaseURL != "" {
-		parsedURL, err := url.Parse(config.BaseURL)
+		parsedURL, err := parseBaseURL(config.BaseURL)
 		if err != nil {
 			return nil, nil, errwrap.Wrapf("successfully parsed base_url when set but failing to parse now: {{err}}", err)
 		}
 		client.BaseURL = parsedURL
 	}
 
+	switch tokenType {
+	case tokenTypePersonal:
+	case tokenTypeInstallation:
+		return b.verifyInstallation(ctx, req.Storage, client, config)
+	default:
+		return nil, logical.ErrorResponse(fmt.Sprintf("invalid token_type %q", tokenType)), nil
+	}
+
 	// Get the user
 	user, _, err := client.Users.Get(ctx, "")
 	if err != nil {
@@ -231,10 +268,12 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, t
 			continue
 		}
 
-		// Append the names so we can get the policies
-		teamNames = append(teamNames, *t.Name)
+		// Teams are mapped by slug, as team names may contain characters
+		// that cannot be used in paths. Names are still looked up for
+		// mappings made by name.
+		teamNames = append(teamNames, *t.Slug)
 		if *t.Name != *t.Slug {
-			teamNames = append(teamNames, *t.Slug)
+			teamNames = append(teamNames, *t.Name)
 		}
 	}
 
@@ -258,9 +297,110 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, t
 	}, nil, nil
 }
 
+// verifyInstallation verifies a GitHub App installation token. The
+// installation must have access to repositories of the organization, and the
+// app is identified by the bot account the token acts as.
+func (b *backend) verifyInstallation(ctx context.Context, s logical.Storage, client *github.Client, config *config) (*verifyCredentialsResp, *logical.Response, error) {
+	var org *github.Organization
+
+	repoOpt := &github.ListOptions{
+		PerPage: 100,
+	}
+
+	for org == nil {
+		repos, resp, err := client.Apps.ListRepos(ctx, repoOpt)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, repo := range repos {
+			owner := repo.GetOwner()
+			if strings.ToLower(owner.GetLogin()) == strings.ToLower(config.Organization) {
+				org = &github.Organization{
+					Login: owner.Login,
+					ID:    owner.ID,
+				}
+				break
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		repoOpt.Page = resp.NextPage
+	}
+	if org == nil {
+		return nil, logical.ErrorResponse("installation is not part of required org"), nil
+	}
+
+	login, err := viewerLogin(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	appSlug := strings.TrimSuffix(login, botLoginSuffix)
+	if appSlug == login {
+		return nil, logical.ErrorResponse("token is not a GitHub App installation token"), nil
+	}
+
+	policies, err := b.AppMap.Policies(ctx, s, appSlug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &verifyCredentialsResp{
+		User: &github.User{
+			Login: &login,
+		},
+		Org:      org,
+		Policies: policies,
+		AppSlug:  appSlug,
+	}, nil, nil
+}
+
+// viewerLogin returns the login of the account the token acts as. The GraphQL
+// API is used as installation tokens cannot query the authenticated user
+// through the REST API.
+func viewerLogin(ctx context.Context, client *github.Client) (string, error) {
+	endpoint := "graphql"
+	if strings.HasSuffix(client.BaseURL.Path, "/v3/") {
+		// GitHub Enterprise serves GraphQL at /api/graphql, next to /api/v3
+		endpoint = "../graphql"
+	}
+
+	req, err := client.NewRequest("POST", endpoint, map[string]string{
+		"query": "query { viewer { login } }",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Data struct {
+			Viewer struct {
+				Login string `json:"login"`
+			} `json:"viewer"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &result); err != nil {
+		return "", err
+	}
+	if len(result.Errors) > 0 {
+		return "", fmt.Errorf("error querying the login of the token: %s", result.Errors[0].Message)
+	}
+	if result.Data.Viewer.Login == "" {
+		return "", fmt.Errorf("no login returned for the token")
+	}
+
+	return result.Data.Viewer.Login, nil
+}
+
 type verifyCredentialsResp struct {
 	User      *github.User
 	Org       *github.Organization
 	Policies  []string
 	TeamNames []string
+
+	// AppSlug is the slug of the GitHub App, for installation tokens
+	AppSlug string
 }
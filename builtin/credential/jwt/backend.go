@@ -0,0 +1,212 @@
+package jwtauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	cache "github.com/patrickmn/go-cache"
+)
+
+const (
+	configPath = "config"
+	rolePrefix = "role/"
+
+	// oidcStateTimeout is how long an OIDC authorization request can take
+	// before the callback is refused
+	oidcStateTimeout = 10 * time.Minute
+)
+
+func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
+	b := Backend()
+	if err := b.Setup(ctx, conf); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func Backend() *backend {
+	var b backend
+	b.oidcStates = cache.New(oidcStateTimeout, time.Minute)
+	b.providerCtx, b.providerCtxCancel = context.WithCancel(context.Background())
+
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+				"oidc/auth_url",
+				"oidc/callback",
+			},
+		},
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathRoleList(&b),
+			pathRole(&b),
+			pathLogin(&b),
+			pathOIDCAuthURL(&b),
+			pathOIDCCallback(&b),
+		},
+		AuthRenew:   b.pathLoginRenew,
+		Invalidate:  b.invalidate,
+		Clean:       b.cleanup,
+		BackendType: logical.TypeCredential,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	l            sync.RWMutex
+	cachedConfig *jwtConfig
+	provider     *oidc.Provider
+	keySet       oidc.KeySet
+
+	// providerCtx is used by the OIDC provider and the remote key set to
+	// fetch keys in the background; it is canceled when the backend is
+	// unloaded
+	providerCtx       context.Context
+	providerCtxCancel context.CancelFunc
+
+	// oidcStates holds the OIDC authorization requests waiting for their
+	// callback, keyed by state
+	oidcStates *cache.Cache
+}
+
+func (b *backend) cleanup(_ context.Context) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.providerCtxCancel != nil {
+		b.providerCtxCancel()
+	}
+}
+
+func (b *backend) invalidate(_ context.Context, key string) {
+	switch key {
+	case configPath:
+		b.reset()
+	}
+}
+
+// reset drops the cached configuration along with the provider and key set
+// built from it
+func (b *backend) reset() {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	b.cachedConfig = nil
+	b.provider = nil
+	b.keySet = nil
+}
+
+// config returns the configuration of the backend, caching it along with
+// its parsed public keys
+func (b *backend) config(ctx context.Context, s logical.Storage) (*jwtConfig, error) {
+	b.l.RLock()
+	if b.cachedConfig != nil {
+		defer b.l.RUnlock()
+		return b.cachedConfig, nil
+	}
+	b.l.RUnlock()
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.cachedConfig != nil {
+		return b.cachedConfig, nil
+	}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	for _, pem := range config.JWTValidationPubKeys {
+		key, err := parsePublicKeyPEM([]byte(pem))
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing public key: {{err}}", err)
+		}
+		config.parsedJWTPubKeys = append(config.parsedJWTPubKeys, key)
+	}
+
+	b.cachedConfig = config
+	return config, nil
+}
+
+// getProvider returns the OIDC provider of the configured discovery URL,
+// creating it on first use
+func (b *backend) getProvider(config *jwtConfig) (*oidc.Provider, error) {
+	b.l.RLock()
+	provider := b.provider
+	b.l.RUnlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.provider != nil {
+		return b.provider, nil
+	}
+
+	provider, err := b.createProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	b.provider = provider
+	return provider, nil
+}
+
+func (b *backend) createProvider(config *jwtConfig) (*oidc.Provider, error) {
+	ctx, err := b.createCAContext(b.providerCtx, config.OIDCDiscoveryCAPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.OIDCDiscoveryURL)
+	if err != nil {
+		return nil, errwrap.Wrapf("error creating provider with given values: {{err}}", err)
+	}
+	return provider, nil
+}
+
+// getKeySet returns the key set of the configured JWKS URL, creating it on
+// first use. Keys are fetched lazily and cached by the key set.
+func (b *backend) getKeySet(config *jwtConfig) (oidc.KeySet, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.keySet != nil {
+		return b.keySet, nil
+	}
+
+	ctx, err := b.createCAContext(b.providerCtx, config.JWKSCAPEM)
+	if err != nil {
+		return nil, err
+	}
+	b.keySet = oidc.NewRemoteKeySet(ctx, config.JWKSURL)
+	return b.keySet, nil
+}
+
+const backendHelp = `
+The JWT backend plugin allows authentication using JWTs (including OIDC).
+
+Tokens are verified against statically configured public keys, the keys
+published at a JWKS URL, or the keys of an OIDC provider found through
+discovery. Roles bind the claims a token must carry and map its claims to the
+alias metadata and group aliases of the login.
+
+With an OIDC provider, users can also log in through the browser using the
+authorization code flow.
+`
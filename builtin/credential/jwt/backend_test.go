@@ -0,0 +1,438 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func getBackend(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("unable to create backend: %v", err)
+	}
+
+	return b.(*backend), config.StorageView
+}
+
+func testKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubBytes,
+	})
+
+	return privKey, string(pubPEM)
+}
+
+func signJWT(t *testing.T, key crypto.Signer, keyID string, claims ...interface{}) string {
+	signingKey := jose.SigningKey{
+		Algorithm: jose.ES256,
+		Key: &jose.JSONWebKey{
+			Key:   key,
+			KeyID: keyID,
+		},
+	}
+	sig, err := jose.NewSigner(signingKey, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := jwt.Signed(sig)
+	for _, c := range claims {
+		builder = builder.Claims(c)
+	}
+	token, err := builder.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func doRequest(t *testing.T, b *backend, storage logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   storage,
+		Data:      data,
+		Connection: &logical.Connection{
+			RemoteAddr: "127.0.0.1",
+		},
+	})
+	if err != nil && err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	return resp
+}
+
+func TestConfig(t *testing.T) {
+	b, storage := getBackend(t)
+	_, pubPEM := testKey(t)
+
+	for name, data := range map[string]map[string]interface{}{
+		"no method": {
+			"bound_issuer": "https://example.com",
+		},
+		"two methods": {
+			"jwt_validation_pubkeys": pubPEM,
+			"jwks_url":               "https://example.com/certs",
+		},
+		"bad public key": {
+			"jwt_validation_pubkeys": "not a key",
+		},
+		"client id without discovery": {
+			"jwt_validation_pubkeys": pubPEM,
+			"oidc_client_id":         "abc",
+			"oidc_client_secret":     "def",
+		},
+		"client id without secret": {
+			"oidc_discovery_url": "https://example.com",
+			"oidc_client_id":     "abc",
+		},
+		"unsupported algorithm": {
+			"jwt_validation_pubkeys": pubPEM,
+			"jwt_supported_algs":     "HS256",
+		},
+	} {
+		resp := doRequest(t, b, storage, logical.UpdateOperation, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+
+	resp := doRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"jwt_validation_pubkeys": pubPEM,
+		"jwt_supported_algs":     "ES256",
+		"bound_issuer":           "https://example.com",
+		"default_role":           "dev",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error: %v", resp.Error())
+	}
+
+	resp = doRequest(t, b, storage, logical.ReadOperation, "config", nil)
+	if resp == nil {
+		t.Fatal("expected config")
+	}
+	if !reflect.DeepEqual(resp.Data["jwt_validation_pubkeys"], []string{strings.TrimSpace(pubPEM)}) {
+		t.Fatalf("bad: %#v", resp.Data["jwt_validation_pubkeys"])
+	}
+	if resp.Data["bound_issuer"] != "https://example.com" || resp.Data["default_role"] != "dev" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["oidc_client_secret"]; ok {
+		t.Fatal("client secret should not be returned")
+	}
+}
+
+func TestRole_CRUD(t *testing.T) {
+	b, storage := getBackend(t)
+
+	// A JWT role needs at least one binding
+	resp := doRequest(t, b, storage, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"user_claim": "sub",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	// An OIDC role needs allowed redirect URIs
+	resp = doRequest(t, b, storage, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"role_type":  "oidc",
+		"user_claim": "sub",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	// The user claim is required
+	resp = doRequest(t, b, storage, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"bound_subject": "alice",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	resp = doRequest(t, b, storage, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"user_claim":      "email",
+		"groups_claim":    "groups",
+		"bound_audiences": "vault",
+		"bound_claims": map[string]interface{}{
+			"/org/team": []interface{}{"a", "b"},
+		},
+		"claim_mappings": map[string]interface{}{
+			"name": "display_name",
+		},
+		"policies": "dev,ops",
+		"ttl":      "1h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error: %v", resp.Error())
+	}
+
+	resp = doRequest(t, b, storage, logical.ReadOperation, "role/dev", nil)
+	if resp == nil {
+		t.Fatal("expected role")
+	}
+	expected := map[string]interface{}{
+		"role_type":             "jwt",
+		"policies":              []string{"dev", "ops"},
+		"num_uses":              0,
+		"period":                int64(0),
+		"ttl":                   int64(3600),
+		"max_ttl":               int64(0),
+		"bound_audiences":       []string{"vault"},
+		"bound_subject":         "",
+		"bound_claims":          map[string]interface{}{"/org/team": []interface{}{"a", "b"}},
+		"claim_mappings":        map[string]string{"name": "display_name"},
+		"user_claim":            "email",
+		"groups_claim":          "groups",
+		"oidc_scopes":           []string(nil),
+		"allowed_redirect_uris": []string(nil),
+	}
+	delete(resp.Data, "bound_cidrs")
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad role:\n%#v\nexpected:\n%#v", resp.Data, expected)
+	}
+
+	resp = doRequest(t, b, storage, logical.ListOperation, "role/", nil)
+	if resp == nil || !reflect.DeepEqual(resp.Data["keys"], []string{"dev"}) {
+		t.Fatalf("bad list: %#v", resp)
+	}
+
+	doRequest(t, b, storage, logical.DeleteOperation, "role/dev", nil)
+	resp = doRequest(t, b, storage, logical.ReadOperation, "role/dev", nil)
+	if resp != nil {
+		t.Fatalf("expected role to be deleted, got %#v", resp)
+	}
+}
+
+func setupJWTLogin(t *testing.T, b *backend, storage logical.Storage, config map[string]interface{}) {
+	resp := doRequest(t, b, storage, logical.UpdateOperation, "config", config)
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error: %v", resp.Error())
+	}
+
+	resp = doRequest(t, b, storage, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"user_claim":      "email",
+		"groups_claim":    "/org/groups",
+		"bound_audiences": "vault",
+		"bound_subject":   "alice",
+		"bound_claims": map[string]interface{}{
+			"/org/team": []interface{}{"a", "b"},
+		},
+		"claim_mappings": map[string]interface{}{
+			"name":      "display_name",
+			"/org/team": "team",
+		},
+		"policies": "dev",
+		"ttl":      "1h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error: %v", resp.Error())
+	}
+}
+
+func testLoginClaims(issuer string) (jwt.Claims, map[string]interface{}) {
+	now := time.Now()
+	claims := jwt.Claims{
+		Issuer:    issuer,
+		Subject:   "alice",
+		Audience:  jwt.Audience{"vault"},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+		Expiry:    jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	}
+	private := map[string]interface{}{
+		"email": "alice@example.com",
+		"name":  "Alice",
+		"org": map[string]interface{}{
+			"team":   "b",
+			"groups": []string{"eng", "ops"},
+		},
+	}
+	return claims, private
+}
+
+func TestLogin_JWT(t *testing.T) {
+	b, storage := getBackend(t)
+	key, pubPEM := testKey(t)
+
+	setupJWTLogin(t, b, storage, map[string]interface{}{
+		"jwt_validation_pubkeys": pubPEM,
+		"jwt_supported_algs":     "ES256",
+		"bound_issuer":           "https://example.com",
+	})
+
+	claims, private := testLoginClaims("https://example.com")
+	resp := doRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "dev",
+		"jwt":  signJWT(t, key, "", claims, private),
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("expected auth, got %#v", resp)
+	}
+
+	auth := resp.Auth
+	if auth.Alias.Name != "alice@example.com" || auth.DisplayName != "alice@example.com" {
+		t.Fatalf("bad alias: %#v", auth.Alias)
+	}
+	expectedMetadata := map[string]string{
+		"display_name": "Alice",
+		"team":         "b",
+	}
+	if !reflect.DeepEqual(auth.Alias.Metadata, expectedMetadata) {
+		t.Fatalf("bad alias metadata: %#v", auth.Alias.Metadata)
+	}
+	if auth.Metadata["role"] != "dev" || auth.Metadata["display_name"] != "Alice" {
+		t.Fatalf("bad metadata: %#v", auth.Metadata)
+	}
+	var groups []string
+	for _, alias := range auth.GroupAliases {
+		groups = append(groups, alias.Name)
+	}
+	sort.Strings(groups)
+	if !reflect.DeepEqual(groups, []string{"eng", "ops"}) {
+		t.Fatalf("bad group aliases: %#v", groups)
+	}
+	if !reflect.DeepEqual(auth.Policies, []string{"dev"}) || auth.TTL != time.Hour {
+		t.Fatalf("bad auth: %#v", auth)
+	}
+
+	// Tokens failing any of the checks are refused
+	otherKey, _ := testKey(t)
+	for name, token := range map[string]string{
+		"wrong key": signJWT(t, otherKey, "", claims, private),
+		"wrong audience": func() string {
+			c := claims
+			c.Audience = jwt.Audience{"other"}
+			return signJWT(t, key, "", c, private)
+		}(),
+		"wrong subject": func() string {
+			c := claims
+			c.Subject = "bob"
+			return signJWT(t, key, "", c, private)
+		}(),
+		"wrong issuer": func() string {
+			c := claims
+			c.Issuer = "https://other.example.com"
+			return signJWT(t, key, "", c, private)
+		}(),
+		"expired": func() string {
+			c := claims
+			c.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			return signJWT(t, key, "", c, private)
+		}(),
+		"bound claim mismatch": signJWT(t, key, "", claims, map[string]interface{}{
+			"email": "alice@example.com",
+			"org": map[string]interface{}{
+				"team":   "c",
+				"groups": []string{"eng"},
+			},
+		}),
+		"missing user claim": signJWT(t, key, "", claims, map[string]interface{}{
+			"org": map[string]interface{}{
+				"team":   "a",
+				"groups": []string{"eng"},
+			},
+		}),
+	} {
+		resp := doRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+			"role": "dev",
+			"jwt":  token,
+		})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+
+	// Renewal checks the role
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   storage,
+		Auth:      auth,
+	}
+	resp, err := b.HandleRequest(context.Background(), renewReq)
+	if err != nil || resp == nil || resp.Auth.TTL != time.Hour {
+		t.Fatalf("bad renewal: %#v, %v", resp, err)
+	}
+
+	doRequest(t, b, storage, logical.DeleteOperation, "role/dev", nil)
+	if _, err := b.HandleRequest(context.Background(), renewReq); err == nil {
+		t.Fatal("expected renewal to fail once the role is deleted")
+	}
+}
+
+func TestLogin_JWKS(t *testing.T) {
+	b, storage := getBackend(t)
+	key, _ := testKey(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keySet := jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{
+				{
+					Key:       &key.PublicKey,
+					KeyID:     "test-key",
+					Algorithm: string(jose.ES256),
+					Use:       "sig",
+				},
+			},
+		}
+		json.NewEncoder(w).Encode(keySet)
+	}))
+	defer srv.Close()
+
+	setupJWTLogin(t, b, storage, map[string]interface{}{
+		"jwks_url":           srv.URL,
+		"jwt_supported_algs": "ES256",
+	})
+
+	claims, private := testLoginClaims("https://example.com")
+	resp := doRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "dev",
+		"jwt":  signJWT(t, key, "test-key", claims, private),
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("expected auth, got %#v", resp)
+	}
+	if resp.Auth.Alias.Name != "alice@example.com" {
+		t.Fatalf("bad alias: %#v", resp.Auth.Alias)
+	}
+
+	otherKey, _ := testKey(t)
+	resp = doRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "dev",
+		"jwt":  signJWT(t, otherKey, "test-key", claims, private),
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+}
@@ -0,0 +1,152 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// getClaim returns the value of the named claim. Names starting with a "/"
+// are JSON pointers to a value nested in the claims, such as "/a/b/0".
+func getClaim(allClaims map[string]interface{}, claim string) interface{} {
+	if !strings.HasPrefix(claim, "/") {
+		return allClaims[claim]
+	}
+
+	var current interface{} = allClaims
+	for _, token := range strings.Split(claim[1:], "/") {
+		// Unescape as per RFC 6901
+		token = strings.Replace(token, "~1", "/", -1)
+		token = strings.Replace(token, "~0", "~", -1)
+
+		switch v := current.(type) {
+		case map[string]interface{}:
+			value, ok := v[token]
+			if !ok {
+				return nil
+			}
+			current = value
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			current = v[i]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// claimString returns a scalar claim value as a string
+func claimString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// claimStrings returns a claim value that is either a single string or a
+// list of strings as a string slice
+func claimStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("list values must be strings, got %T", item)
+			}
+			ret = append(ret, s)
+		}
+		return ret, nil
+	case []string:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("value must be a string or a list of strings, got %T", value)
+	}
+}
+
+// boundClaimValues returns the values accepted for a bound claim
+func boundClaimValues(value interface{}) ([]string, error) {
+	values, err := claimStrings(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("at least one value is required")
+	}
+	return values, nil
+}
+
+// validateBoundClaims checks that every bound claim is present with one of
+// its accepted values. For claims that are lists, any of their values may
+// match.
+func validateBoundClaims(boundClaims map[string]interface{}, allClaims map[string]interface{}) error {
+	for claim, expected := range boundClaims {
+		expectedValues, err := boundClaimValues(expected)
+		if err != nil {
+			return fmt.Errorf("invalid value for bound claim %q: %v", claim, err)
+		}
+
+		value := getClaim(allClaims, claim)
+		if value == nil {
+			return fmt.Errorf("claim %q is missing", claim)
+		}
+
+		var actualValues []string
+		if s, ok := claimString(value); ok {
+			actualValues = []string{s}
+		} else if actualValues, err = claimStrings(value); err != nil {
+			return fmt.Errorf("claim %q cannot be matched: %v", claim, err)
+		}
+
+		matched := false
+		for _, actual := range actualValues {
+			if strutil.StrListContains(expectedValues, actual) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("claim %q does not match any associated bound claim values", claim)
+		}
+	}
+	return nil
+}
+
+// extractMetadata builds the alias metadata from the role's claim mappings.
+// Claims that are missing are skipped; claims that are not scalar values are
+// an error.
+func extractMetadata(allClaims map[string]interface{}, claimMappings map[string]string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for claim, metadataKey := range claimMappings {
+		value := getClaim(allClaims, claim)
+		if value == nil {
+			continue
+		}
+		s, ok := claimString(value)
+		if !ok {
+			return nil, fmt.Errorf("error converting claim %q to string", claim)
+		}
+		metadata[metadataKey] = s
+	}
+	return metadata, nil
+}
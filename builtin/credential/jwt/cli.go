@@ -0,0 +1,219 @@
+package jwtauth
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	defaultMount         = "oidc"
+	defaultListenAddress = "localhost"
+	defaultPort          = "8250"
+	defaultCallbackPath  = "/oidc/callback"
+)
+
+type CLIHandler struct{}
+
+type loginResp struct {
+	secret *api.Secret
+	err    error
+}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (*api.Secret, error) {
+	mount, ok := m["mount"]
+	if !ok {
+		mount = defaultMount
+	}
+
+	listenAddress, ok := m["listenaddress"]
+	if !ok {
+		listenAddress = defaultListenAddress
+	}
+
+	port, ok := m["port"]
+	if !ok {
+		port = defaultPort
+	}
+
+	role := m["role"]
+	redirectURI := fmt.Sprintf("http://%s:%s%s", listenAddress, port, defaultCallbackPath)
+
+	authURL, err := fetchAuthURL(c, role, mount, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(listenAddress, port))
+	if err != nil {
+		return nil, errwrap.Wrapf("error listening for the OIDC callback: {{err}}", err)
+	}
+	defer listener.Close()
+
+	doneCh := make(chan loginResp, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(defaultCallbackPath, func(w http.ResponseWriter, req *http.Request) {
+		var response string
+
+		query := req.URL.Query()
+		data := map[string]interface{}{
+			"state":             query.Get("state"),
+			"code":              query.Get("code"),
+			"error":             query.Get("error"),
+			"error_description": query.Get("error_description"),
+		}
+
+		secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/oidc/callback", mount), data)
+		if err != nil {
+			response = fmt.Sprintf(failureHTML, html.EscapeString(err.Error()))
+		} else {
+			response = successHTML
+		}
+
+		w.Write([]byte(response))
+		doneCh <- loginResp{secret, err}
+	})
+
+	// Serve the callback in the background so that the login can be
+	// interrupted
+	go http.Serve(listener, mux)
+
+	sigintCh := make(chan os.Signal, 1)
+	signal.Notify(sigintCh, os.Interrupt)
+	defer signal.Stop(sigintCh)
+
+	fmt.Fprintf(os.Stderr, "Complete the login via your OIDC provider. Launching browser to:\n\n    %s\n\n\n", authURL)
+	if err := openURL(authURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Error attempting to automatically open browser: '%s'.\nPlease visit the authorization URL manually.", err)
+	}
+
+	// Wait for either the callback to finish or SIGINT to be received
+	select {
+	case s := <-doneCh:
+		if s.err == nil && s.secret == nil {
+			return nil, errors.New("empty response from credential provider")
+		}
+		return s.secret, s.err
+	case <-sigintCh:
+		return nil, errors.New("interrupted")
+	}
+}
+
+// fetchAuthURL asks Vault for the URL of the OIDC provider to log in with
+func fetchAuthURL(c *api.Client, role, mount, redirectURI string) (string, error) {
+	data := map[string]interface{}{
+		"role":         role,
+		"redirect_uri": redirectURI,
+	}
+
+	secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/oidc/auth_url", mount), data)
+	if err != nil {
+		return "", err
+	}
+
+	var authURL string
+	if secret != nil {
+		authURL, _ = secret.Data["auth_url"].(string)
+	}
+	if authURL == "" {
+		return "", fmt.Errorf("unable to retrieve an authorization URL from the %q mount", mount)
+	}
+
+	return authURL, nil
+}
+
+// openURL opens the specified URL in the default browser of the user
+func openURL(url string) error {
+	var cmd string
+	var args []string
+
+	switch runtime.GOOS {
+	case "windows":
+		cmd = "cmd"
+		args = []string{"/c", "start"}
+		url = strings.Replace(url, "&", "^&", -1)
+	case "darwin":
+		cmd = "open"
+	default: // "linux", "freebsd", "openbsd", "netbsd"
+		cmd = "xdg-open"
+	}
+	args = append(args, url)
+	return exec.Command(cmd, args...).Start()
+}
+
+func (h *CLIHandler) Help() string {
+	help := `
+Usage: vault login -method=oidc [CONFIG K=V...]
+
+  The OIDC auth method allows users to authenticate using an OIDC provider.
+  The provider must be configured as part of a role by the operator.
+
+  Authenticate using role "engineering":
+
+      $ vault login -method=oidc role=engineering
+      Complete the login via your OIDC provider. Launching browser to:
+
+          https://accounts.google.com/o/oauth2/v2/...
+
+  The default browser will be opened for the user to complete the login.
+  Alternatively, the user may visit the provided URL directly.
+
+Configuration:
+
+  mount=<string>
+      Path where the OIDC credential method is mounted. This is usually
+      provided via the -path flag in the "vault login" command, but it can be
+      specified here as well. If specified here, it takes precedence over the
+      value for -path. The default value is "oidc".
+
+  role=<string>
+      Vault role of type "oidc" to use for authentication. If not provided,
+      the default role of the mount is used.
+
+  listenaddress=<string>
+      Optional address to bind the OIDC callback listener to. The default
+      value is "localhost".
+
+  port=<string>
+      Optional port to bind the OIDC callback listener to. The default value
+      is "8250". The role must allow "http://localhost:8250/oidc/callback"
+      (adjusted for these settings) as a redirect URI.
+`
+
+	return strings.TrimSpace(help)
+}
+
+const successHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Vault Authentication Succeeded</title>
+</head>
+<body>
+  <h1>Vault Authentication Succeeded</h1>
+  <p>You can close this window and return to the CLI.</p>
+</body>
+</html>
+`
+
+const failureHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Vault Authentication Failed</title>
+</head>
+<body>
+  <h1>Vault Authentication Failed</h1>
+  <p>Authentication failed with the following error:</p>
+  <pre>%s</pre>
+</body>
+</html>
+`
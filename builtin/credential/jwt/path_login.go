@@ -0,0 +1,312 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/cidrutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `login$`,
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "The role to log in against.",
+			},
+			"jwt": {
+				Type:        framework.TypeString,
+				Description: "The signed JWT to validate.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("could not load configuration"), nil
+	}
+
+	roleName := d.Get("role").(string)
+	if roleName == "" {
+		roleName = config.DefaultRole
+	}
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	role, err := b.role(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q could not be found", roleName)), nil
+	}
+	if role.RoleType == roleTypeOIDC {
+		return logical.ErrorResponse("role with oidc role_type is not allowed"), nil
+	}
+
+	token := d.Get("jwt").(string)
+	if token == "" {
+		return logical.ErrorResponse("missing token"), nil
+	}
+
+	if len(role.BoundCIDRs) > 0 {
+		if req.Connection == nil {
+			b.Logger().Warn("token bound CIDRs found but no connection information available for validation")
+			return nil, logical.ErrPermissionDenied
+		}
+		if !cidrutil.RemoteAddrIsOk(req.Connection.RemoteAddr, role.BoundCIDRs) {
+			return nil, logical.ErrPermissionDenied
+		}
+	}
+
+	allClaims, err := b.verifyJWT(ctx, config, token)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	auth, err := b.createAuth(roleName, role, allClaims)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+// verifyJWT verifies the signature and the registered claims of the token
+// using the configured keys and returns all of its claims
+func (b *backend) verifyJWT(ctx context.Context, config *jwtConfig, token string) (map[string]interface{}, error) {
+	var allClaims map[string]interface{}
+
+	if config.OIDCDiscoveryURL != "" {
+		provider, err := b.getProvider(config)
+		if err != nil {
+			return nil, errwrap.Wrapf("error getting provider for login operation: {{err}}", err)
+		}
+
+		verifier := provider.Verifier(&oidc.Config{
+			SkipClientIDCheck:    true,
+			SupportedSigningAlgs: config.JWTSupportedAlgs,
+		})
+		idToken, err := verifier.Verify(ctx, token)
+		if err != nil {
+			return nil, errwrap.Wrapf("error validating signature: {{err}}", err)
+		}
+		if err := idToken.Claims(&allClaims); err != nil {
+			return nil, errwrap.Wrapf("unable to successfully parse all claims from token: {{err}}", err)
+		}
+		return allClaims, nil
+	}
+
+	parsed, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing token: {{err}}", err)
+	}
+	if len(parsed.Signatures) != 1 {
+		return nil, errors.New("token must have exactly one signature")
+	}
+
+	algs := config.JWTSupportedAlgs
+	if len(algs) == 0 {
+		algs = []string{string(jose.RS256)}
+	}
+	if !strutil.StrListContains(algs, parsed.Signatures[0].Header.Algorithm) {
+		return nil, fmt.Errorf("token signed with unsupported algorithm %q", parsed.Signatures[0].Header.Algorithm)
+	}
+
+	var payload []byte
+	switch {
+	case config.JWKSURL != "":
+		keySet, err := b.getKeySet(config)
+		if err != nil {
+			return nil, errwrap.Wrapf("error fetching jwks keyset: {{err}}", err)
+		}
+		payload, err = keySet.VerifySignature(ctx, token)
+		if err != nil {
+			return nil, errwrap.Wrapf("error verifying token signature: {{err}}", err)
+		}
+
+	default:
+		for _, key := range config.parsedJWTPubKeys {
+			if payload, err = parsed.Verify(key); err == nil {
+				break
+			}
+		}
+		if payload == nil {
+			return nil, errors.New("no known key successfully validated the token signature")
+		}
+	}
+
+	if err := json.Unmarshal(payload, &allClaims); err != nil {
+		return nil, errwrap.Wrapf("unable to successfully parse all claims from token: {{err}}", err)
+	}
+
+	var claims jwt.Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errwrap.Wrapf("unable to successfully parse claims from token: {{err}}", err)
+	}
+	expected := jwt.Expected{
+		Issuer: config.BoundIssuer,
+		Time:   time.Now(),
+	}
+	if err := claims.Validate(expected); err != nil {
+		return nil, errwrap.Wrapf("error validating claims: {{err}}", err)
+	}
+
+	return allClaims, nil
+}
+
+// createAuth checks the claims of a verified token against the bindings of
+// the role and builds the auth of the login, mapping claims to the alias
+// metadata and group aliases
+func (b *backend) createAuth(roleName string, role *jwtRole, allClaims map[string]interface{}) (*logical.Auth, error) {
+	audiences, err := claimStrings(allClaims["aud"])
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid audience claim: {{err}}", err)
+	}
+	switch {
+	case len(role.BoundAudiences) > 0:
+		matched := false
+		for _, audience := range audiences {
+			if strutil.StrListContains(role.BoundAudiences, audience) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, errors.New("aud claim does not match any bound audience")
+		}
+	case role.RoleType == roleTypeJWT && len(audiences) > 0:
+		return nil, errors.New("audience claim found in JWT but no audiences bound to the role")
+	}
+
+	if role.BoundSubject != "" {
+		if subject, _ := allClaims["sub"].(string); subject != role.BoundSubject {
+			return nil, errors.New("sub claim does not match bound subject")
+		}
+	}
+
+	if err := validateBoundClaims(role.BoundClaims, allClaims); err != nil {
+		return nil, err
+	}
+
+	userName, ok := claimString(getClaim(allClaims, role.UserClaim))
+	if !ok || userName == "" {
+		return nil, fmt.Errorf("claim %q not found in token", role.UserClaim)
+	}
+
+	metadata, err := extractMetadata(allClaims, role.ClaimMappings)
+	if err != nil {
+		return nil, err
+	}
+
+	var groupAliases []*logical.Alias
+	if role.GroupsClaim != "" {
+		groupsClaim := getClaim(allClaims, role.GroupsClaim)
+		if groupsClaim == nil {
+			return nil, fmt.Errorf("%q claim not found in token", role.GroupsClaim)
+		}
+		groups, err := claimStrings(groupsClaim)
+		if err != nil {
+			return nil, fmt.Errorf("%q claim could not be converted to string list: %v", role.GroupsClaim, err)
+		}
+		for _, group := range groups {
+			if group == "" {
+				continue
+			}
+			groupAliases = append(groupAliases, &logical.Alias{
+				Name: group,
+			})
+		}
+	}
+
+	tokenMetadata := map[string]string{"role": roleName}
+	for k, v := range metadata {
+		tokenMetadata[k] = v
+	}
+
+	return &logical.Auth{
+		Policies:    role.Policies,
+		DisplayName: userName,
+		Period:      role.Period,
+		NumUses:     role.NumUses,
+		BoundCIDRs:  role.BoundCIDRs,
+		Alias: &logical.Alias{
+			Name:     userName,
+			Metadata: metadata,
+		},
+		GroupAliases: groupAliases,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata: tokenMetadata,
+		LeaseOptions: logical.LeaseOptions{
+			Renewable: true,
+			TTL:       role.TTL,
+			MaxTTL:    role.MaxTTL,
+		},
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, errors.New("failed to fetch role_name during renewal")
+	}
+
+	// Ensure that the Role still exists.
+	role, err := b.role(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to validate role %q during renewal: {{err}}", roleName), err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %q does not exist during renewal", roleName)
+	}
+
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, errors.New("policies on role have changed, cannot renew")
+	}
+
+	resp := &logical.Response{Auth: req.Auth}
+	resp.Auth.TTL = role.TTL
+	resp.Auth.MaxTTL = role.MaxTTL
+	resp.Auth.Period = role.Period
+	return resp, nil
+}
+
+const (
+	pathLoginHelpSyn = `
+	Authenticates to Vault using a JWT (or OIDC) token.
+	`
+	pathLoginHelpDesc = `
+Authenticates JWTs. The token is verified against the configured keys, and its
+claims are checked against the bindings of the given role, or of the default
+role if none is given.
+`
+)
@@ -0,0 +1,273 @@
+package jwtauth
+
+import (
+	"context"
+	"fmt"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/cidrutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/oauth2"
+)
+
+// oidcState is an OIDC authorization request waiting for its callback
+type oidcState struct {
+	rolename    string
+	nonce       string
+	redirectURI string
+}
+
+func pathOIDCAuthURL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `oidc/auth_url`,
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "The role to issue an OIDC authorization URL against.",
+			},
+			"redirect_uri": {
+				Type:        framework.TypeString,
+				Description: "The OAuth redirect_uri to use in the authorization URL.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.authURL,
+		},
+
+		HelpSynopsis:    pathOIDCAuthURLHelpSyn,
+		HelpDescription: pathOIDCAuthURLHelpDesc,
+	}
+}
+
+func pathOIDCCallback(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `oidc/callback`,
+		Fields: map[string]*framework.FieldSchema{
+			"state": {
+				Type:        framework.TypeString,
+				Description: "The state returned by the OIDC provider.",
+			},
+			"code": {
+				Type:        framework.TypeString,
+				Description: "The authorization code returned by the OIDC provider.",
+			},
+			"error": {
+				Type:        framework.TypeString,
+				Description: "The error returned by the OIDC provider, if any.",
+			},
+			"error_description": {
+				Type:        framework.TypeString,
+				Description: "The description of the error returned by the OIDC provider, if any.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathCallback,
+			logical.UpdateOperation: b.pathCallback,
+		},
+
+		HelpSynopsis:    pathOIDCCallbackHelpSyn,
+		HelpDescription: pathOIDCCallbackHelpDesc,
+	}
+}
+
+// authURL returns the URL of the OIDC provider the user is sent to in order
+// to log in. The state and nonce of the request are kept until the callback.
+func (b *backend) authURL(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("could not load configuration"), nil
+	}
+	if config.OIDCClientID == "" || config.OIDCDiscoveryURL == "" {
+		return logical.ErrorResponse("OIDC login is not configured for this mount"), nil
+	}
+
+	roleName := d.Get("role").(string)
+	if roleName == "" {
+		roleName = config.DefaultRole
+	}
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	redirectURI := d.Get("redirect_uri").(string)
+	if redirectURI == "" {
+		return logical.ErrorResponse("missing redirect_uri"), nil
+	}
+
+	role, err := b.role(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q could not be found", roleName)), nil
+	}
+	if role.RoleType != roleTypeOIDC {
+		return logical.ErrorResponse(fmt.Sprintf("role %q is not an OIDC role", roleName)), nil
+	}
+	if !strutil.StrListContains(role.AllowedRedirectURIs, redirectURI) {
+		return logical.ErrorResponse(fmt.Sprintf("unauthorized redirect_uri: %s", redirectURI)), nil
+	}
+
+	provider, err := b.getProvider(config)
+	if err != nil {
+		return nil, errwrap.Wrapf("error getting provider for login operation: {{err}}", err)
+	}
+
+	state, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	oauth2Config := oauth2.Config{
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  redirectURI,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, role.OIDCScopes...),
+	}
+
+	b.oidcStates.SetDefault(state, &oidcState{
+		rolename:    roleName,
+		nonce:       nonce,
+		redirectURI: redirectURI,
+	})
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"auth_url": oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce)),
+		},
+	}, nil
+}
+
+// pathCallback completes an OIDC login: the authorization code is exchanged
+// for an ID token, which is verified and checked against the role the login
+// was started with
+func (b *backend) pathCallback(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	stateID := d.Get("state").(string)
+	raw, ok := b.oidcStates.Get(stateID)
+	if !ok || stateID == "" {
+		return logical.ErrorResponse("expired or missing OAuth state"), nil
+	}
+	b.oidcStates.Delete(stateID)
+	state := raw.(*oidcState)
+
+	if errCode := d.Get("error").(string); errCode != "" {
+		return logical.ErrorResponse(fmt.Sprintf("error from OIDC provider: %s: %s", errCode, d.Get("error_description").(string))), nil
+	}
+
+	code := d.Get("code").(string)
+	if code == "" {
+		return logical.ErrorResponse("missing code"), nil
+	}
+
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("could not load configuration"), nil
+	}
+
+	role, err := b.role(ctx, req.Storage, state.rolename)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q could not be found", state.rolename)), nil
+	}
+
+	if len(role.BoundCIDRs) > 0 {
+		if req.Connection == nil {
+			b.Logger().Warn("token bound CIDRs found but no connection information available for validation")
+			return nil, logical.ErrPermissionDenied
+		}
+		if !cidrutil.RemoteAddrIsOk(req.Connection.RemoteAddr, role.BoundCIDRs) {
+			return nil, logical.ErrPermissionDenied
+		}
+	}
+
+	provider, err := b.getProvider(config)
+	if err != nil {
+		return nil, errwrap.Wrapf("error getting provider for login operation: {{err}}", err)
+	}
+
+	oidcCtx, err := b.createCAContext(ctx, config.OIDCDiscoveryCAPEM)
+	if err != nil {
+		return nil, errwrap.Wrapf("error preparing context for login operation: {{err}}", err)
+	}
+
+	oauth2Config := oauth2.Config{
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  state.redirectURI,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, role.OIDCScopes...),
+	}
+
+	oauth2Token, err := oauth2Config.Exchange(oidcCtx, code)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error exchanging oidc code: %v", err)), nil
+	}
+
+	// Extract the ID Token from OAuth2 token.
+	rawToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		return logical.ErrorResponse("no id_token found in response"), nil
+	}
+
+	verifier := provider.Verifier(&oidc.Config{
+		ClientID:             config.OIDCClientID,
+		SupportedSigningAlgs: config.JWTSupportedAlgs,
+	})
+	idToken, err := verifier.Verify(oidcCtx, rawToken)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error validating id_token: %v", err)), nil
+	}
+	if idToken.Nonce != state.nonce {
+		return logical.ErrorResponse("invalid ID token nonce"), nil
+	}
+
+	var allClaims map[string]interface{}
+	if err := idToken.Claims(&allClaims); err != nil {
+		return nil, err
+	}
+
+	auth, err := b.createAuth(state.rolename, role, allClaims)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+const (
+	pathOIDCAuthURLHelpSyn  = `Request an authorization URL to start an OIDC login flow.`
+	pathOIDCAuthURLHelpDesc = `
+Returns the URL of the OIDC provider to send the user to in order to log in
+with the given role. The redirect_uri must be one of the allowed redirect URIs
+of the role; the provider sends the user back to it with the state and code
+to pass to the callback endpoint.
+`
+
+	pathOIDCCallbackHelpSyn  = `Callback endpoint to complete an OIDC login.`
+	pathOIDCCallbackHelpDesc = `
+Completes an OIDC login started with the auth_url endpoint. The authorization
+code is exchanged for an ID token, whose claims are checked against the role
+the login was started with.
+`
+)
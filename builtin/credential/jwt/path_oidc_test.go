@@ -0,0 +1,267 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// oidcProvider is a minimal OIDC provider serving the discovery document,
+// its keys and a token endpoint that issues an ID token for a known code
+type oidcProvider struct {
+	t        *testing.T
+	server   *httptest.Server
+	key      *ecdsa.PrivateKey
+	clientID string
+	code     string
+	nonce    string
+	claims   map[string]interface{}
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	key, _ := testKey(t)
+	p := &oidcProvider{
+		t:        t,
+		key:      key,
+		clientID: "abc",
+		code:     "deadbeef",
+	}
+	p.server = httptest.NewServer(p)
+	return p
+}
+
+func (p *oidcProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		fmt.Fprintf(w, `{
+			"issuer": "%[1]s",
+			"authorization_endpoint": "%[1]s/auth",
+			"token_endpoint": "%[1]s/token",
+			"jwks_uri": "%[1]s/certs",
+			"id_token_signing_alg_values_supported": ["ES256"]
+		}`, p.server.URL)
+
+	case "/certs":
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{
+				{
+					Key:       &p.key.PublicKey,
+					KeyID:     "test-key",
+					Algorithm: string(jose.ES256),
+					Use:       "sig",
+				},
+			},
+		})
+
+	case "/token":
+		if err := r.ParseForm(); err != nil {
+			p.t.Fatal(err)
+		}
+		if r.PostForm.Get("code") != p.code {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+
+		now := time.Now()
+		claims := jwt.Claims{
+			Issuer:   p.server.URL,
+			Subject:  "alice",
+			Audience: jwt.Audience{p.clientID},
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		}
+		private := map[string]interface{}{
+			"nonce": p.nonce,
+		}
+		for k, v := range p.claims {
+			private[k] = v
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "bearer",
+			"expires_in":   300,
+			"id_token":     signJWT(p.t, p.key, "test-key", claims, private),
+		})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setupOIDCLogin(t *testing.T, p *oidcProvider) (*backend, logical.Storage) {
+	b, storage := getBackend(t)
+
+	resp := doRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"oidc_discovery_url": p.server.URL,
+		"oidc_client_id":     p.clientID,
+		"oidc_client_secret": "secret",
+		"jwt_supported_algs": "ES256",
+		"default_role":       "dev",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error: %v", resp.Error())
+	}
+
+	resp = doRequest(t, b, storage, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"role_type":             "oidc",
+		"user_claim":            "email",
+		"groups_claim":          "groups",
+		"oidc_scopes":           "email,profile",
+		"allowed_redirect_uris": "http://localhost:8250/oidc/callback",
+		"bound_claims": map[string]interface{}{
+			"team": "eng",
+		},
+		"claim_mappings": map[string]interface{}{
+			"name": "display_name",
+		},
+		"policies": "dev",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error: %v", resp.Error())
+	}
+
+	return b, storage
+}
+
+// startLogin requests an authorization URL and returns the state and nonce
+// the provider would receive
+func startLogin(t *testing.T, b *backend, storage logical.Storage) (string, string) {
+	resp := doRequest(t, b, storage, logical.UpdateOperation, "oidc/auth_url", map[string]interface{}{
+		"redirect_uri": "http://localhost:8250/oidc/callback",
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected auth URL, got %#v", resp)
+	}
+
+	authURL, err := url.Parse(resp.Data["auth_url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+	if query.Get("client_id") != "abc" ||
+		query.Get("redirect_uri") != "http://localhost:8250/oidc/callback" ||
+		query.Get("scope") != "openid email profile" {
+		t.Fatalf("bad auth URL: %s", authURL)
+	}
+
+	return query.Get("state"), query.Get("nonce")
+}
+
+func TestOIDC_Login(t *testing.T) {
+	p := newOIDCProvider(t)
+	defer p.server.Close()
+	b, storage := setupOIDCLogin(t, p)
+
+	state, nonce := startLogin(t, b, storage)
+	p.nonce = nonce
+	p.claims = map[string]interface{}{
+		"email":  "alice@example.com",
+		"name":   "Alice",
+		"team":   "eng",
+		"groups": []string{"a", "b"},
+	}
+
+	resp := doRequest(t, b, storage, logical.ReadOperation, "oidc/callback", map[string]interface{}{
+		"state": state,
+		"code":  p.code,
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("expected auth, got %#v", resp)
+	}
+	if resp.Auth.Alias.Name != "alice@example.com" || resp.Auth.Alias.Metadata["display_name"] != "Alice" {
+		t.Fatalf("bad alias: %#v", resp.Auth.Alias)
+	}
+	if len(resp.Auth.GroupAliases) != 2 {
+		t.Fatalf("bad group aliases: %#v", resp.Auth.GroupAliases)
+	}
+
+	// A state can only be used once
+	resp = doRequest(t, b, storage, logical.ReadOperation, "oidc/callback", map[string]interface{}{
+		"state": state,
+		"code":  p.code,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	// OIDC roles cannot be used with the JWT login
+	resp = doRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "dev",
+		"jwt":  "a.b.c",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+}
+
+func TestOIDC_LoginFailures(t *testing.T) {
+	p := newOIDCProvider(t)
+	defer p.server.Close()
+	b, storage := setupOIDCLogin(t, p)
+
+	// Redirect URIs must be allowed by the role
+	resp := doRequest(t, b, storage, logical.UpdateOperation, "oidc/auth_url", map[string]interface{}{
+		"redirect_uri": "http://evil.example.com/oidc/callback",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	for name, tc := range map[string]struct {
+		code   string
+		nonce  string
+		claims map[string]interface{}
+	}{
+		"bad code": {
+			code:   "wrong",
+			claims: map[string]interface{}{"email": "alice@example.com", "team": "eng"},
+		},
+		"bad nonce": {
+			code:   p.code,
+			nonce:  "wrong",
+			claims: map[string]interface{}{"email": "alice@example.com", "team": "eng"},
+		},
+		"bound claim mismatch": {
+			code:   p.code,
+			claims: map[string]interface{}{"email": "alice@example.com", "team": "ops"},
+		},
+	} {
+		state, nonce := startLogin(t, b, storage)
+		p.nonce = nonce
+		if tc.nonce != "" {
+			p.nonce = tc.nonce
+		}
+		p.claims = tc.claims
+
+		resp := doRequest(t, b, storage, logical.ReadOperation, "oidc/callback", map[string]interface{}{
+			"state": state,
+			"code":  tc.code,
+		})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+
+	// Errors from the provider are reported
+	state, _ := startLogin(t, b, storage)
+	resp = doRequest(t, b, storage, logical.ReadOperation, "oidc/callback", map[string]interface{}{
+		"state": state,
+		"error": "access_denied",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+}
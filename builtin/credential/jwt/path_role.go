@@ -0,0 +1,373 @@
+package jwtauth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sockaddr "github.com/hashicorp/go-sockaddr"
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	roleTypeJWT  = "jwt"
+	roleTypeOIDC = "oidc"
+)
+
+func pathRoleList(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    strings.TrimSpace(roleHelp["role-list"][0]),
+		HelpDescription: strings.TrimSpace(roleHelp["role-list"][1]),
+	}
+}
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"role_type": {
+				Type:        framework.TypeString,
+				Description: "Type of the role, either 'jwt' or 'oidc'.",
+			},
+			"policies": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "List of policies on the role.",
+			},
+			"num_uses": {
+				Type:        framework.TypeInt,
+				Description: `Number of times issued tokens can be used`,
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: `Duration in seconds after which the issued token should expire. Defaults to 0, in which case the value will fall back to the system/mount defaults.`,
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: `Duration in seconds after which the issued token should not be allowed to be renewed. Defaults to 0, in which case the value will fall back to the system/mount defaults.`,
+			},
+			"period": {
+				Type: framework.TypeDurationSecond,
+				Description: `If set, indicates that the token generated using this role
+should never expire. The token should be renewed within the
+duration specified by this value. At each renewal, the token's
+TTL will be set to the value of this parameter.`,
+			},
+			"bound_cidrs": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma separated string or list of CIDR blocks. If set, specifies the blocks of
+IP addresses which can perform the login operation.`,
+			},
+			"bound_audiences": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of 'aud' claims that are valid for login; any match is sufficient`,
+			},
+			"bound_subject": {
+				Type:        framework.TypeString,
+				Description: `The 'sub' claim that is valid for login. Optional.`,
+			},
+			"bound_claims": {
+				Type:        framework.TypeMap,
+				Description: `Map of claims/values which must match for login. A value may be a string or a list of strings, any of which is accepted. Claims may be JSON pointers to nested values, such as "/a/b".`,
+			},
+			"claim_mappings": {
+				Type:        framework.TypeKVPairs,
+				Description: `Mappings of claims (key) that will be copied to a metadata field (value)`,
+			},
+			"user_claim": {
+				Type:        framework.TypeString,
+				Description: `The claim to use for the Identity entity alias name`,
+			},
+			"groups_claim": {
+				Type:        framework.TypeString,
+				Description: `The claim to use for the Identity group alias names`,
+			},
+			"oidc_scopes": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of OIDC scopes to request in addition to "openid"`,
+			},
+			"allowed_redirect_uris": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of allowed values for redirect_uri`,
+			},
+		},
+		ExistenceCheck: b.pathRoleExistenceCheck,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    strings.TrimSpace(roleHelp["role"][0]),
+		HelpDescription: strings.TrimSpace(roleHelp["role"][1]),
+	}
+}
+
+type jwtRole struct {
+	RoleType string `json:"role_type"`
+
+	// Policies that are to be required by the token to access this role
+	Policies []string `json:"policies"`
+
+	// TokenNumUses defines the number of allowed uses of the token issued
+	NumUses int `json:"num_uses"`
+
+	// Duration before which an issued token must be renewed
+	TTL time.Duration `json:"ttl"`
+
+	// Duration after which an issued token should not be allowed to be renewed
+	MaxTTL time.Duration `json:"max_ttl"`
+
+	// Period, if set, indicates that the token generated using this role
+	// should never expire. The token should be renewed within the duration
+	// specified by this value. The renewal duration will be fixed if the
+	// value is not modified on the role. If the `Period` in the role is
+	// modified, a token will pick up the new value during its next renewal.
+	Period time.Duration `json:"period"`
+
+	BoundCIDRs []*sockaddr.SockAddrMarshaler `json:"bound_cidrs"`
+
+	// Role binding properties
+	BoundAudiences      []string               `json:"bound_audiences"`
+	BoundSubject        string                 `json:"bound_subject"`
+	BoundClaims         map[string]interface{} `json:"bound_claims"`
+	ClaimMappings       map[string]string      `json:"claim_mappings"`
+	UserClaim           string                 `json:"user_claim"`
+	GroupsClaim         string                 `json:"groups_claim"`
+	OIDCScopes          []string               `json:"oidc_scopes"`
+	AllowedRedirectURIs []string               `json:"allowed_redirect_uris"`
+}
+
+// role takes a storage backend and the name and returns the role's storage
+// entry
+func (b *backend) role(ctx context.Context, s logical.Storage, name string) (*jwtRole, error) {
+	raw, err := s.Get(ctx, rolePrefix+strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	role := new(jwtRole)
+	if err := raw.DecodeJSON(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (b *backend) pathRoleExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	role, err := b.role(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(ctx, rolePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"role_type":             role.RoleType,
+			"policies":              role.Policies,
+			"num_uses":              role.NumUses,
+			"period":                int64(role.Period.Seconds()),
+			"ttl":                   int64(role.TTL.Seconds()),
+			"max_ttl":               int64(role.MaxTTL.Seconds()),
+			"bound_cidrs":           role.BoundCIDRs,
+			"bound_audiences":       role.BoundAudiences,
+			"bound_subject":         role.BoundSubject,
+			"bound_claims":          role.BoundClaims,
+			"claim_mappings":        role.ClaimMappings,
+			"user_claim":            role.UserClaim,
+			"groups_claim":          role.GroupsClaim,
+			"oidc_scopes":           role.OIDCScopes,
+			"allowed_redirect_uris": role.AllowedRedirectURIs,
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, rolePrefix+strings.ToLower(data.Get("name").(string)))
+}
+
+func (b *backend) pathRoleCreateUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(data.Get("name").(string))
+
+	// Check if the role already exists
+	role, err := b.role(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new entry object if this is a CreateOperation
+	if role == nil {
+		if req.Operation == logical.UpdateOperation {
+			return nil, fmt.Errorf("role entry not found during update operation")
+		}
+		role = new(jwtRole)
+	}
+
+	if roleType, ok := data.GetOk("role_type"); ok {
+		role.RoleType = roleType.(string)
+	} else if req.Operation == logical.CreateOperation {
+		role.RoleType = roleTypeJWT
+	}
+	switch role.RoleType {
+	case roleTypeJWT, roleTypeOIDC:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid 'role_type': %s", role.RoleType)), nil
+	}
+
+	if policiesRaw, ok := data.GetOk("policies"); ok {
+		role.Policies = policyutil.ParsePolicies(policiesRaw)
+	}
+
+	if tokenNumUsesRaw, ok := data.GetOk("num_uses"); ok {
+		role.NumUses = tokenNumUsesRaw.(int)
+	}
+	if role.NumUses < 0 {
+		return logical.ErrorResponse("num_uses cannot be negative"), nil
+	}
+
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+	if periodRaw, ok := data.GetOk("period"); ok {
+		role.Period = time.Duration(periodRaw.(int)) * time.Second
+	}
+
+	// Check that the TTL value provided is less than the MaxTTL.
+	// Sanitizing the TTL and MaxTTL is not required now and can be performed
+	// at credential issue time.
+	if role.MaxTTL > time.Duration(0) && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl should not be greater than max_ttl"), nil
+	}
+
+	if boundCIDRs, ok := data.GetOk("bound_cidrs"); ok {
+		parsedCIDRs, err := parseutil.ParseAddrs(boundCIDRs)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		role.BoundCIDRs = parsedCIDRs
+	}
+
+	if boundAudiences, ok := data.GetOk("bound_audiences"); ok {
+		role.BoundAudiences = boundAudiences.([]string)
+	}
+	if boundSubject, ok := data.GetOk("bound_subject"); ok {
+		role.BoundSubject = boundSubject.(string)
+	}
+	if boundClaims, ok := data.GetOk("bound_claims"); ok {
+		role.BoundClaims = boundClaims.(map[string]interface{})
+		for claim, value := range role.BoundClaims {
+			if _, err := boundClaimValues(value); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("invalid value for bound claim %q: %v", claim, err)), nil
+			}
+		}
+	}
+	if claimMappings, ok := data.GetOk("claim_mappings"); ok {
+		role.ClaimMappings = claimMappings.(map[string]string)
+
+		// Mapping two claims to the same metadata key would make the
+		// result depend on the order in which they are processed
+		targets := make(map[string]bool)
+		for _, target := range role.ClaimMappings {
+			if targets[target] {
+				return logical.ErrorResponse(fmt.Sprintf("multiple keys are mapped to metadata key %q", target)), nil
+			}
+			targets[target] = true
+		}
+	}
+
+	if userClaim, ok := data.GetOk("user_claim"); ok {
+		role.UserClaim = userClaim.(string)
+	}
+	if role.UserClaim == "" {
+		return logical.ErrorResponse("a user claim must be defined on the role"), nil
+	}
+
+	if groupsClaim, ok := data.GetOk("groups_claim"); ok {
+		role.GroupsClaim = groupsClaim.(string)
+	}
+
+	if oidcScopes, ok := data.GetOk("oidc_scopes"); ok {
+		role.OIDCScopes = oidcScopes.([]string)
+	}
+	if allowedRedirectURIs, ok := data.GetOk("allowed_redirect_uris"); ok {
+		role.AllowedRedirectURIs = allowedRedirectURIs.([]string)
+	}
+
+	switch role.RoleType {
+	case roleTypeJWT:
+		if len(role.BoundAudiences) == 0 && len(role.BoundCIDRs) == 0 && role.BoundSubject == "" && len(role.BoundClaims) == 0 {
+			return logical.ErrorResponse("must have at least one bound constraint when creating/updating a role"), nil
+		}
+	case roleTypeOIDC:
+		if len(role.AllowedRedirectURIs) == 0 {
+			return logical.ErrorResponse("'allowed_redirect_uris' must be set if 'role_type' is 'oidc'"), nil
+		}
+	}
+
+	// Store the entry.
+	entry, err := logical.StorageEntryJSON(rolePrefix+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err = req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+var roleHelp = map[string][2]string{
+	"role-list": {
+		"Lists all the roles registered with the backend.",
+		"The list will contain the names of the roles.",
+	},
+	"role": {
+		"Register an role with the backend.",
+		`
+A role is required to authenticate with this backend. The role binds
+JWT token information with token policies and settings.
+The bindings, token polices and token settings can all be configured
+using this endpoint.
+
+Roles of type "jwt" are used to log in with a JWT directly and need at least
+one bound constraint. Roles of type "oidc" are used for the browser OIDC flow
+and need at least one allowed redirect URI.
+		`,
+	},
+}
@@ -58,18 +58,20 @@ type backend struct {
 	*framework.Backend
 }
 
-func (b *backend) Login(ctx context.Context, req *logical.Request, username string, password string) ([]string, *logical.Response, []string, error) {
+// Login authenticates the user against the LDAP server and returns the
+// policies, groups and alias metadata of the user
+func (b *backend) Login(ctx context.Context, req *logical.Request, username string, password string) ([]string, *logical.Response, []string, map[string]string, error) {
 
 	cfg, err := b.Config(ctx, req)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	if cfg == nil {
-		return nil, logical.ErrorResponse("ldap backend not configured"), nil, nil
+		return nil, logical.ErrorResponse("ldap backend not configured"), nil, nil, nil
 	}
 
 	if cfg.DenyNullBind && len(password) == 0 {
-		return nil, logical.ErrorResponse("password cannot be of zero length when passwordless binds are being denied"), nil, nil
+		return nil, logical.ErrorResponse("password cannot be of zero length when passwordless binds are being denied"), nil, nil, nil
 	}
 
 	ldapClient := ldaputil.Client{
@@ -79,10 +81,10 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 
 	c, err := ldapClient.DialLDAP(cfg)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil, nil
+		return nil, logical.ErrorResponse(err.Error()), nil, nil, nil
 	}
 	if c == nil {
-		return nil, logical.ErrorResponse("invalid connection returned from LDAP dial"), nil, nil
+		return nil, logical.ErrorResponse("invalid connection returned from LDAP dial"), nil, nil, nil
 	}
 
 	// Clean connection
@@ -93,7 +95,7 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 		if b.Logger().IsDebug() {
 			b.Logger().Debug("error getting user bind DN", "error", err)
 		}
-		return nil, logical.ErrorResponse("ldap operation failed"), nil, nil
+		return nil, logical.ErrorResponse("ldap operation failed"), nil, nil, nil
 	}
 
 	if b.Logger().IsDebug() {
@@ -110,7 +112,7 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 		if b.Logger().IsDebug() {
 			b.Logger().Debug("ldap bind failed", "error", err)
 		}
-		return nil, logical.ErrorResponse("ldap operation failed"), nil, nil
+		return nil, logical.ErrorResponse("ldap operation failed"), nil, nil, nil
 	}
 
 	// We re-bind to the BindDN if it's defined because we assume
@@ -120,7 +122,7 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 			if b.Logger().IsDebug() {
 				b.Logger().Debug("error while attempting to re-bind with the BindDN User", "error", err)
 			}
-			return nil, logical.ErrorResponse("ldap operation failed"), nil, nil
+			return nil, logical.ErrorResponse("ldap operation failed"), nil, nil, nil
 		}
 		if b.Logger().IsDebug() {
 			b.Logger().Debug("re-bound to original binddn")
@@ -129,17 +131,22 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 
 	userDN, err := ldapClient.GetUserDN(cfg, c, userBindDN)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil, nil
+		return nil, logical.ErrorResponse(err.Error()), nil, nil, nil
 	}
 
 	ldapGroups, err := ldapClient.GetLdapGroups(cfg, c, userDN, username)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil, nil
+		return nil, logical.ErrorResponse(err.Error()), nil, nil, nil
 	}
 	if b.Logger().IsDebug() {
 		b.Logger().Debug("groups fetched from server", "num_server_groups", len(ldapGroups), "server_groups", ldapGroups)
 	}
 
+	userMetadata, err := ldapClient.GetUserAttributes(cfg, c, userDN)
+	if err != nil {
+		return nil, logical.ErrorResponse(err.Error()), nil, nil, nil
+	}
+
 	ldapResponse := &logical.Response{
 		Data: map[string]interface{}{},
 	}
@@ -197,10 +204,10 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 		}
 
 		ldapResponse.Data["error"] = errStr
-		return nil, ldapResponse, nil, nil
+		return nil, ldapResponse, nil, nil, nil
 	}
 
-	return policies, ldapResponse, allGroups, nil
+	return policies, ldapResponse, allGroups, userMetadata, nil
 }
 
 const backendHelp = `
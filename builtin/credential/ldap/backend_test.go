@@ -280,6 +280,169 @@ func TestLdapAuthBackend_UserPolicies(t *testing.T) {
 	}
 }
 
+func TestLdapAuthBackend_PagingNestedGroupsAndMetadata(t *testing.T) {
+	const (
+		userDN   = "uid=alice,ou=users,dc=example,dc=com"
+		groupsDN = "ou=groups,dc=example,dc=com"
+	)
+	entries := []*testLDAPEntry{
+		{
+			DN: userDN,
+			Attributes: map[string][]string{
+				"uid":        {"alice"},
+				"mail":       {"alice@example.com"},
+				"department": {"engineering", "security"},
+				"employeeID": {"42"},
+			},
+		},
+	}
+	var directGroups []string
+	for i := 1; i <= 12; i++ {
+		name := fmt.Sprintf("direct%02d", i)
+		directGroups = append(directGroups, name)
+		entries = append(entries, &testLDAPEntry{
+			DN:         fmt.Sprintf("cn=%s,%s", name, groupsDN),
+			Attributes: map[string][]string{"cn": {name}, "member": {userDN}},
+		})
+	}
+	// nested2 and cyclic are members of each other
+	entries = append(entries,
+		&testLDAPEntry{
+			DN:         "cn=nested1," + groupsDN,
+			Attributes: map[string][]string{"cn": {"nested1"}, "member": {"cn=direct01," + groupsDN}},
+		},
+		&testLDAPEntry{
+			DN:         "cn=nested2," + groupsDN,
+			Attributes: map[string][]string{"cn": {"nested2"}, "member": {"cn=nested1," + groupsDN, "cn=cyclic," + groupsDN}},
+		},
+		&testLDAPEntry{
+			DN:         "cn=cyclic," + groupsDN,
+			Attributes: map[string][]string{"cn": {"cyclic"}, "member": {"cn=nested2," + groupsDN}},
+		},
+	)
+
+	server := newTestLDAPServer(t, entries, map[string]string{userDN: "password"})
+	defer server.Close()
+	server.SizeLimit = 10
+
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	for group, policy := range map[string]string{"direct01": "directpolicy", "nested2": "nestedpolicy"} {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "groups/" + group,
+			Data:      map[string]interface{}{"policies": policy},
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+
+	configure := func(data map[string]interface{}) {
+		t.Helper()
+		data["url"] = server.URL()
+		data["userattr"] = "uid"
+		data["userdn"] = "ou=users,dc=example,dc=com"
+		data["groupdn"] = groupsDN
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Data:      data,
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+
+	login := func() (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login/alice",
+			Data:      map[string]interface{}{"password": "password"},
+			Storage:   storage,
+		})
+	}
+
+	checkLogin := func(expectedPolicies []string, expectedGroups []string) *logical.Response {
+		t.Helper()
+		resp, err := login()
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		if !reflect.DeepEqual(expectedPolicies, resp.Auth.Policies) {
+			t.Fatalf("bad: policies: expected: %q, actual: %q", expectedPolicies, resp.Auth.Policies)
+		}
+		var groups []string
+		for _, alias := range resp.Auth.GroupAliases {
+			groups = append(groups, alias.Name)
+		}
+		sort.Strings(groups)
+		sort.Strings(expectedGroups)
+		if !reflect.DeepEqual(expectedGroups, groups) {
+			t.Fatalf("bad: groups: expected: %q, actual: %q", expectedGroups, groups)
+		}
+		return resp
+	}
+
+	// Without paging, the group search exceeds the size limit of the server
+	configure(map[string]interface{}{})
+	resp, err := login()
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected size limit error, got resp:%#v", resp)
+	}
+
+	configure(map[string]interface{}{"max_page_size": 5})
+	resp = checkLogin([]string{"directpolicy"}, directGroups)
+	if server.PagedSearches() < 3 {
+		t.Fatalf("expected the group search to be paged, got %d paged searches", server.PagedSearches())
+	}
+	if resp.Auth.Alias.Metadata != nil {
+		t.Fatalf("unexpected alias metadata: %#v", resp.Auth.Alias.Metadata)
+	}
+
+	allGroups := append([]string{"nested1", "nested2", "cyclic"}, directGroups...)
+	for _, resolution := range []string{"walk", "in_chain"} {
+		configure(map[string]interface{}{
+			"max_page_size":           5,
+			"nested_group_resolution": resolution,
+		})
+		checkLogin([]string{"directpolicy", "nestedpolicy"}, allGroups)
+	}
+
+	configure(map[string]interface{}{
+		"max_page_size":            5,
+		"user_metadata_attributes": []string{"mail=email", "department=department", "missing=missing"},
+	})
+	resp = checkLogin([]string{"directpolicy"}, directGroups)
+	expectedMetadata := map[string]string{
+		"email":      "alice@example.com",
+		"department": "engineering,security",
+	}
+	if !reflect.DeepEqual(expectedMetadata, resp.Auth.Alias.Metadata) {
+		t.Fatalf("bad: alias metadata: expected: %#v, actual: %#v", expectedMetadata, resp.Auth.Alias.Metadata)
+	}
+
+	// Invalid settings are refused
+	for _, data := range []map[string]interface{}{
+		{"max_page_size": -1},
+		{"nested_group_resolution": "recursive"},
+	} {
+		data["url"] = server.URL()
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Data:      data,
+			Storage:   storage,
+		})
+		if err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("expected error for %#v", data)
+		}
+	}
+}
+
 /*
  * Acceptance test for LDAP Auth Method
  *
@@ -0,0 +1,364 @@
+package ldap
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+const (
+	ldapOpBindRequest       = 0
+	ldapOpBindResponse      = 1
+	ldapOpUnbindRequest     = 2
+	ldapOpSearchRequest     = 3
+	ldapOpSearchResultEntry = 4
+	ldapOpSearchResultDone  = 5
+	ldapOpExtendedRequest   = 23
+	ldapOpExtendedResponse  = 24
+
+	ldapMatchingRuleInChain = "1.2.840.113556.1.4.1941"
+)
+
+// testLDAPEntry is an entry of the directory of testLDAPServer. Attribute
+// names are case insensitive.
+type testLDAPEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+func (e *testLDAPEntry) values(attribute string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// testLDAPServer is a minimal in-process LDAP server, supporting simple binds
+// and searches with the paged results control over a fixed directory. Like
+// Active Directory, unpaged searches returning more than SizeLimit entries
+// fail.
+type testLDAPServer struct {
+	t         *testing.T
+	listener  net.Listener
+	entries   []*testLDAPEntry
+	passwords map[string]string
+
+	// SizeLimit is the maximum number of entries returned by unpaged
+	// searches, if non-zero
+	SizeLimit int
+
+	l             sync.Mutex
+	pagedSearches int
+}
+
+func newTestLDAPServer(t *testing.T, entries []*testLDAPEntry, passwords map[string]string) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testLDAPServer{
+		t:         t,
+		listener:  listener,
+		entries:   entries,
+		passwords: passwords,
+	}
+	go s.serve()
+	return s
+}
+
+// URL returns the URL to connect to the server
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// PagedSearches returns the number of pages requested from the server
+func (s *testLDAPServer) PagedSearches() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.pagedSearches
+}
+
+func (s *testLDAPServer) Close() {
+	s.listener.Close()
+}
+
+func (s *testLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			// Clients may close the connection without unbinding
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		var controls []goldap.Control
+		if len(packet.Children) > 2 {
+			for _, child := range packet.Children[2].Children {
+				controls = append(controls, goldap.DecodeControl(child))
+			}
+		}
+
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldapOpBindRequest:
+			responses = append(responses, s.bind(messageID, op))
+		case ldapOpUnbindRequest:
+			return
+		case ldapOpSearchRequest:
+			responses = s.search(messageID, op, controls)
+		case ldapOpExtendedRequest:
+			responses = append(responses, testLDAPMessage(messageID, testLDAPResult(ldapOpExtendedResponse, goldap.LDAPResultProtocolError, "extended operations are not supported")))
+		default:
+			return
+		}
+
+		for _, response := range responses {
+			if _, err := conn.Write(response.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *testLDAPServer) bind(messageID int64, op *ber.Packet) *ber.Packet {
+	dn := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+
+	code := int(goldap.LDAPResultInvalidCredentials)
+	switch {
+	case dn == "" && password == "":
+		code = 0
+	case password == "":
+		code = goldap.LDAPResultUnwillingToPerform
+	default:
+		for entryDN, entryPassword := range s.passwords {
+			if strings.EqualFold(entryDN, dn) && entryPassword == password {
+				code = 0
+			}
+		}
+	}
+
+	return testLDAPMessage(messageID, testLDAPResult(ldapOpBindResponse, code, ""))
+}
+
+func (s *testLDAPServer) search(messageID int64, op *ber.Packet, controls []goldap.Control) []*ber.Packet {
+	baseDN := op.Children[0].Value.(string)
+	scope := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var attributes []string
+	for _, child := range op.Children[7].Children {
+		attributes = append(attributes, child.Value.(string))
+	}
+
+	var matches []*testLDAPEntry
+	for _, entry := range s.entries {
+		if !testLDAPInScope(entry.DN, baseDN, scope) {
+			continue
+		}
+		if s.matches(entry, filter) {
+			matches = append(matches, entry)
+		}
+	}
+
+	var responseControls []goldap.Control
+	paging, _ := goldap.FindControl(controls, goldap.ControlTypePaging).(*goldap.ControlPaging)
+	switch {
+	case paging != nil:
+		s.l.Lock()
+		s.pagedSearches++
+		s.l.Unlock()
+
+		total := len(matches)
+		offset, _ := strconv.Atoi(string(paging.Cookie))
+		if offset > total {
+			offset = total
+		}
+		end := offset + int(paging.PagingSize)
+		if end > total {
+			end = total
+		}
+		matches = matches[offset:end]
+
+		// An empty cookie ends the search, as does a zero page size
+		responsePaging := goldap.NewControlPaging(0)
+		if paging.PagingSize > 0 && end < total {
+			responsePaging.SetCookie([]byte(strconv.Itoa(end)))
+		}
+		responseControls = append(responseControls, responsePaging)
+
+	case s.SizeLimit > 0 && len(matches) > s.SizeLimit:
+		return []*ber.Packet{
+			testLDAPMessage(messageID, testLDAPResult(ldapOpSearchResultDone, goldap.LDAPResultSizeLimitExceeded, "size limit exceeded")),
+		}
+	}
+
+	var responses []*ber.Packet
+	for _, entry := range matches {
+		responses = append(responses, testLDAPMessage(messageID, testLDAPSearchEntry(entry, attributes)))
+	}
+	responses = append(responses, testLDAPMessage(messageID, testLDAPResult(ldapOpSearchResultDone, 0, ""), responseControls...))
+	return responses
+}
+
+// matches evaluates a search filter against an entry. Substring and ordering
+// filters are not supported and never match.
+func (s *testLDAPServer) matches(entry *testLDAPEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !s.matches(entry, child) {
+				return false
+			}
+		}
+		return true
+
+	case goldap.FilterOr:
+		for _, child := range filter.Children {
+			if s.matches(entry, child) {
+				return true
+			}
+		}
+		return false
+
+	case goldap.FilterNot:
+		return !s.matches(entry, filter.Children[0])
+
+	case goldap.FilterEqualityMatch:
+		return testLDAPContains(entry.values(filter.Children[0].Value.(string)), filter.Children[1].Value.(string))
+
+	case goldap.FilterPresent:
+		attribute := filter.Data.String()
+		return strings.EqualFold(attribute, "objectClass") || len(entry.values(attribute)) > 0
+
+	case goldap.FilterExtensibleMatch:
+		var rule, attribute, value string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case goldap.MatchingRuleAssertionMatchingRule:
+				rule = child.Data.String()
+			case goldap.MatchingRuleAssertionType:
+				attribute = child.Data.String()
+			case goldap.MatchingRuleAssertionMatchValue:
+				value = child.Data.String()
+			}
+		}
+		if rule == ldapMatchingRuleInChain {
+			return s.inChain(entry, attribute, value, map[string]bool{})
+		}
+		return testLDAPContains(entry.values(attribute), value)
+	}
+
+	return false
+}
+
+// inChain returns whether value is reachable from the entry by following
+// attribute through the directory
+func (s *testLDAPServer) inChain(entry *testLDAPEntry, attribute, value string, seen map[string]bool) bool {
+	if seen[strings.ToLower(entry.DN)] {
+		return false
+	}
+	seen[strings.ToLower(entry.DN)] = true
+
+	for _, dn := range entry.values(attribute) {
+		if strings.EqualFold(dn, value) {
+			return true
+		}
+		for _, next := range s.entries {
+			if strings.EqualFold(next.DN, dn) && s.inChain(next, attribute, value, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func testLDAPInScope(dn, baseDN string, scope int64) bool {
+	dn, baseDN = strings.ToLower(dn), strings.ToLower(baseDN)
+	switch scope {
+	case goldap.ScopeBaseObject:
+		return dn == baseDN
+	case goldap.ScopeSingleLevel:
+		parts := strings.SplitN(dn, ",", 2)
+		return len(parts) == 2 && parts[1] == baseDN
+	default:
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+func testLDAPContains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func testLDAPMessage(messageID int64, op *ber.Packet, controls ...goldap.Control) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(op)
+	if len(controls) > 0 {
+		encoded := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, control := range controls {
+			encoded.AppendChild(control.Encode())
+		}
+		packet.AppendChild(encoded)
+	}
+	return packet
+}
+
+func testLDAPResult(tag ber.Tag, code int, message string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return packet
+}
+
+func testLDAPSearchEntry(entry *testLDAPEntry, attributes []string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapOpSearchResultEntry, nil, "Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.Attributes {
+		if len(attributes) > 0 && !testLDAPContains(attributes, name) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+	packet.AppendChild(attrs)
+	return packet
+}
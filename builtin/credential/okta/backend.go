@@ -3,6 +3,7 @@ package okta
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/chrismalek/oktasdk-go/okta"
@@ -52,11 +53,55 @@ func Backend() *backend {
 	return &b
 }
 
+const (
+	// groupsPageLimit is the number of groups requested per page when listing
+	// the groups of a user
+	groupsPageLimit = 200
+
+	// mfaPushPollInterval is the interval between checks of the result of
+	// an Okta Verify push
+	mfaPushPollInterval = 500 * time.Millisecond
+)
+
+type mfaFactor struct {
+	Id       string `json:"id"`
+	Type     string `json:"factorType"`
+	Provider string `json:"provider"`
+}
+
+type embeddedResult struct {
+	User    okta.User   `json:"user"`
+	Factors []mfaFactor `json:"factors"`
+}
+
+type authResult struct {
+	Embedded     embeddedResult `json:"_embedded"`
+	Status       string         `json:"status"`
+	FactorResult string         `json:"factorResult"`
+	StateToken   string         `json:"stateToken"`
+}
+
 type backend struct {
 	*framework.Backend
+
+	// baseURL, if set, replaces the URL of the Okta API built from the
+	// configuration. It is only set in tests.
+	baseURL *url.URL
 }
 
-func (b *backend) Login(ctx context.Context, req *logical.Request, username string, password string) ([]string, *logical.Response, []string, error) {
+func (b *backend) oktaClient(cfg *ConfigEntry) *okta.Client {
+	client := cfg.OktaClient()
+	if b.baseURL != nil {
+		client.BaseURL = b.baseURL
+	}
+	return client
+}
+
+// Login authenticates the user with Okta, verifying the Okta Verify push or
+// TOTP factor when Okta requires MFA. totp is the passcode of the TOTP factor,
+// if any; without it, a push is sent. Renewals cannot answer MFA challenges,
+// so they only check the password, skipping MFA.
+func (b *backend) Login(ctx context.Context, req *logical.Request, username, password, totp string, renewal bool) ([]string, *logical.Response, []string, error) {
 	cfg, err := b.Config(ctx, req.Storage)
 	if err != nil {
 		return nil, nil, nil, err
@@ -65,25 +110,7 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 		return nil, logical.ErrorResponse("Okta auth method not configured"), nil, nil
 	}
 
-	client := cfg.OktaClient()
-
-	type mfaFactor struct {
-		Id       string `json:"id"`
-		Type     string `json:"factorType"`
-		Provider string `json:"provider"`
-	}
-
-	type embeddedResult struct {
-		User    okta.User   `json:"user"`
-		Factors []mfaFactor `json:"factors"`
-	}
-
-	type authResult struct {
-		Embedded     embeddedResult `json:"_embedded"`
-		Status       string         `json:"status"`
-		FactorResult string         `json:"factorResult"`
-		StateToken   string         `json:"stateToken"`
-	}
+	client := b.oktaClient(cfg)
 
 	authReq, err := client.NewRequest("POST", "authn", map[string]interface{}{
 		"username": username,
@@ -142,72 +169,14 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 		// active factor enrollment). This bypass removes visibility
 		// into the authenticating user's password expiry, but still ensures the
 		// credentials are valid and the user is not locked out.
-		if cfg.BypassOktaMFA {
+		if cfg.BypassOktaMFA || renewal {
 			result.Status = "SUCCESS"
 			break
 		}
 
-		factorAvailable := false
-
-		var selectedFactor mfaFactor
-		// only okta push is currently supported
-		for _, v := range result.Embedded.Factors {
-			if v.Type == "push" && v.Provider == "OKTA" {
-				factorAvailable = true
-				selectedFactor = v
-			}
-		}
-
-		if !factorAvailable {
-			return nil, logical.ErrorResponse("Okta Verify Push factor is required in order to perform MFA"), nil, nil
-		}
-
-		requestPath := fmt.Sprintf("authn/factors/%s/verify", selectedFactor.Id)
-		payload := map[string]interface{}{
-			"stateToken": result.StateToken,
-		}
-		verifyReq, err := client.NewRequest("POST", requestPath, payload)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-
-		rsp, err := client.Do(verifyReq, &result)
-		if err != nil {
-			return nil, logical.ErrorResponse(fmt.Sprintf("Okta auth failed: %v", err)), nil, nil
-		}
-		if rsp == nil {
-			return nil, logical.ErrorResponse("okta auth backend unexpected failure"), nil, nil
-		}
-		for result.Status == "MFA_CHALLENGE" {
-			switch result.FactorResult {
-			case "WAITING":
-				verifyReq, err := client.NewRequest("POST", requestPath, payload)
-				rsp, err := client.Do(verifyReq, &result)
-				if err != nil {
-					return nil, logical.ErrorResponse(fmt.Sprintf("Okta auth failed checking loop: %v", err)), nil, nil
-				}
-				if rsp == nil {
-					return nil, logical.ErrorResponse("okta auth backend unexpected failure"), nil, nil
-				}
-
-				select {
-				case <-time.After(500 * time.Millisecond):
-					// Continue
-				case <-ctx.Done():
-					return nil, logical.ErrorResponse("exiting pending mfa challenge"), nil, nil
-				}
-			case "REJECTED":
-				return nil, logical.ErrorResponse("multi-factor authentication denied"), nil, nil
-			case "TIMEOUT":
-				return nil, logical.ErrorResponse("failed to complete multi-factor authentication"), nil, nil
-			case "SUCCESS":
-				// Allowed
-			default:
-				if b.Logger().IsDebug() {
-					b.Logger().Debug("unhandled result status", "status", result.Status, "factorstatus", result.FactorResult)
-				}
-				return nil, logical.ErrorResponse("okta authentication failed"), nil, nil
-			}
+		resp, err := b.verifyMFA(ctx, client, &result, totp)
+		if err != nil || resp != nil {
+			return nil, resp, nil, err
 		}
 
 	case "SUCCESS":
@@ -296,17 +265,111 @@ func (b *backend) Login(ctx context.Context, req *logical.Request, username stri
 	return policies, oktaResponse, allGroups, nil
 }
 
-func (b *backend) getOktaGroups(client *okta.Client, user *okta.User) ([]string, error) {
-	rsp, err := client.Users.PopulateGroups(user)
-	if err != nil {
-		return nil, err
+// verifyMFA verifies a factor of the user in the MFA_REQUIRED state, updating
+// result with the outcome. A TOTP factor is verified with the passcode if one
+// is given, otherwise an Okta Verify push is sent and polled until the user
+// answers it. A response is returned if the verification failed.
+func (b *backend) verifyMFA(ctx context.Context, client *okta.Client, result *authResult, totp string) (*logical.Response, error) {
+	var factor *mfaFactor
+	for i, v := range result.Embedded.Factors {
+		switch {
+		case totp == "" && v.Type == "push" && v.Provider == "OKTA":
+			factor = &result.Embedded.Factors[i]
+		case totp != "" && v.Type == "token:software:totp":
+			// Prefer Okta Verify over other authenticator apps
+			if factor == nil || v.Provider == "OKTA" {
+				factor = &result.Embedded.Factors[i]
+			}
+		}
 	}
-	if rsp == nil {
-		return nil, fmt.Errorf("okta auth method unexpected failure")
+
+	if factor == nil {
+		if totp != "" {
+			return logical.ErrorResponse("a TOTP factor is required in order to perform MFA with a passcode"), nil
+		}
+		for _, v := range result.Embedded.Factors {
+			if v.Type == "token:software:totp" {
+				return logical.ErrorResponse("Okta Verify Push factor is not enrolled; a TOTP passcode must be provided in order to perform MFA"), nil
+			}
+		}
+		return logical.ErrorResponse("Okta Verify Push or TOTP factor is required in order to perform MFA"), nil
+	}
+
+	requestPath := fmt.Sprintf("authn/factors/%s/verify", factor.Id)
+	payload := map[string]interface{}{
+		"stateToken": result.StateToken,
 	}
-	oktaGroups := make([]string, 0, len(user.Groups))
-	for _, group := range user.Groups {
-		oktaGroups = append(oktaGroups, group.Profile.Name)
+	if totp != "" {
+		payload["passCode"] = totp
+	}
+
+	for {
+		verifyReq, err := client.NewRequest("POST", requestPath, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err := client.Do(verifyReq, result)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Okta auth failed: %v", err)), nil
+		}
+		if rsp == nil {
+			return logical.ErrorResponse("okta auth backend unexpected failure"), nil
+		}
+
+		if result.Status != "MFA_CHALLENGE" {
+			return nil, nil
+		}
+
+		switch result.FactorResult {
+		case "WAITING":
+			select {
+			case <-time.After(mfaPushPollInterval):
+				// Continue
+			case <-ctx.Done():
+				return logical.ErrorResponse("exiting pending mfa challenge"), nil
+			}
+		case "REJECTED":
+			return logical.ErrorResponse("multi-factor authentication denied"), nil
+		case "TIMEOUT":
+			return logical.ErrorResponse("failed to complete multi-factor authentication"), nil
+		default:
+			if b.Logger().IsDebug() {
+				b.Logger().Debug("unhandled result status", "status", result.Status, "factorstatus", result.FactorResult)
+			}
+			return logical.ErrorResponse("okta authentication failed"), nil
+		}
+	}
+}
+
+// getOktaGroups returns the names of the Okta groups of the user, following
+// the pages of the groups listing
+func (b *backend) getOktaGroups(client *okta.Client, user *okta.User) ([]string, error) {
+	var oktaGroups []string
+	next := fmt.Sprintf("users/%s/groups?limit=%d", url.PathEscape(user.ID), groupsPageLimit)
+	for next != "" {
+		req, err := client.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var groups []okta.Group
+		rsp, err := client.Do(req, &groups)
+		if err != nil {
+			return nil, err
+		}
+		if rsp == nil {
+			return nil, fmt.Errorf("okta auth method unexpected failure")
+		}
+
+		for _, group := range groups {
+			oktaGroups = append(oktaGroups, group.Profile.Name)
+		}
+
+		next = ""
+		if rsp.NextURL != nil {
+			next = rsp.NextURL.String()
+		}
 	}
 	if b.Logger().IsDebug() {
 		b.Logger().Debug("Groups fetched from Okta", "num_groups", len(oktaGroups), "groups", fmt.Sprintf("%#v", oktaGroups))
@@ -317,7 +380,8 @@ func (b *backend) getOktaGroups(client *okta.Client, user *okta.User) ([]string,
 const backendHelp = `
 The Okta credential provider allows authentication querying,
 checking username and password, and associating policies.  If an api token is
-configured groups are pulled down from Okta.
+configured groups are pulled down from Okta. When Okta requires MFA, an Okta
+Verify push is sent, or the TOTP passcode given at login is verified.
 
 Configuration of the connection is done through the "config" and "policies"
 endpoints by a user with root access. Authentication is then done
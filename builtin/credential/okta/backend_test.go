@@ -2,9 +2,15 @@ package okta
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	log "github.com/hashicorp/go-hclog"
@@ -195,3 +201,243 @@ func testAccLogin(t *testing.T, user, password string, keys []string) logicaltes
 		Check: logicaltest.TestCheckAuth(keys),
 	}
 }
+
+func TestBackend_stubbedAPI(t *testing.T) {
+	var l sync.Mutex
+	var pushPolls int
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	writeJSON := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	factors := map[string][]map[string]interface{}{
+		"alice": nil,
+		"bob": {
+			{"id": "sms-factor", "factorType": "sms", "provider": "OKTA"},
+			{"id": "push-factor", "factorType": "push", "provider": "OKTA"},
+		},
+		"carol": {
+			{"id": "google-factor", "factorType": "token:software:totp", "provider": "GOOGLE"},
+		},
+		"dave": {
+			{"id": "reject-factor", "factorType": "push", "provider": "OKTA"},
+		},
+	}
+
+	mux.HandleFunc("/api/v1/authn", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		userFactors, ok := factors[body["username"]]
+		if !ok || body["password"] != "password" {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"errorCode":    "E0000004",
+				"errorSummary": "Authentication failed",
+			})
+			return
+		}
+
+		user := map[string]interface{}{"id": body["username"] + "-id"}
+		if userFactors == nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"status":    "SUCCESS",
+				"_embedded": map[string]interface{}{"user": user},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":     "MFA_REQUIRED",
+			"stateToken": "state-" + body["username"],
+			"_embedded":  map[string]interface{}{"user": user, "factors": userFactors},
+		})
+	})
+
+	mux.HandleFunc("/api/v1/authn/factors/", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		username := strings.TrimPrefix(body["stateToken"], "state-")
+		user := map[string]interface{}{"id": username + "-id"}
+		success := map[string]interface{}{
+			"status":    "SUCCESS",
+			"_embedded": map[string]interface{}{"user": user},
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/authn/factors/push-factor/verify":
+			l.Lock()
+			pushPolls++
+			polls := pushPolls
+			l.Unlock()
+			if polls < 3 {
+				writeJSON(w, http.StatusOK, map[string]interface{}{
+					"status":       "MFA_CHALLENGE",
+					"factorResult": "WAITING",
+					"stateToken":   body["stateToken"],
+				})
+				return
+			}
+			writeJSON(w, http.StatusOK, success)
+
+		case "/api/v1/authn/factors/reject-factor/verify":
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"status":       "MFA_CHALLENGE",
+				"factorResult": "REJECTED",
+				"stateToken":   body["stateToken"],
+			})
+
+		case "/api/v1/authn/factors/google-factor/verify":
+			if body["passCode"] != "123456" {
+				writeJSON(w, http.StatusForbidden, map[string]interface{}{
+					"errorCode":    "E0000068",
+					"errorSummary": "Invalid Passcode/Answer",
+				})
+				return
+			}
+			writeJSON(w, http.StatusOK, success)
+
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// Groups are returned two per page, following the Link header
+	mux.HandleFunc("/api/v1/users/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "200" {
+			t.Errorf("unexpected groups limit: %q", r.URL.Query().Get("limit"))
+		}
+		var groups []string
+		switch r.URL.Path {
+		case "/api/v1/users/alice-id/groups":
+			groups = []string{"everyone", "admins", "devs", "ops", "qa"}
+		case "/api/v1/users/bob-id/groups", "/api/v1/users/carol-id/groups":
+			groups = []string{"devs"}
+		}
+
+		after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+		end := after + 2
+		if end >= len(groups) {
+			end = len(groups)
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?after=%d&limit=200>; rel="next"`, server.URL, r.URL.Path, end))
+		}
+		var page []map[string]interface{}
+		for _, group := range groups[after:end] {
+			page = append(page, map[string]interface{}{
+				"id":      group + "-id",
+				"profile": map[string]interface{}{"name": group},
+			})
+		}
+		writeJSON(w, http.StatusOK, page)
+	})
+
+	baseURL, err := url.Parse(server.URL + "/api/v1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Backend()
+	b.baseURL = baseURL
+	if err := b.Setup(context.Background(), &logical.BackendConfig{
+		Logger: logging.NewVaultLogger(log.Trace),
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     2 * time.Hour,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   storage,
+		})
+	}
+
+	if resp, err := write("config", map[string]interface{}{
+		"org_name":  "test",
+		"api_token": "token",
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	for group, policy := range map[string]string{"qa": "qa-policy", "devs": "dev-policy"} {
+		if resp, err := write("groups/"+group, map[string]interface{}{"policies": policy}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+
+	// All pages of groups are fetched
+	resp, err := write("login/alice", map[string]interface{}{"password": "password"})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if !policyutil.EquivalentPolicies(resp.Auth.Policies, []string{"dev-policy", "qa-policy"}) {
+		t.Fatalf("bad: policies: %#v", resp.Auth.Policies)
+	}
+	if len(resp.Auth.GroupAliases) != 5 {
+		t.Fatalf("bad: group aliases: %#v", resp.Auth.GroupAliases)
+	}
+
+	// The push is polled until accepted
+	resp, err = write("login/bob", map[string]interface{}{"password": "password"})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if pushPolls != 3 {
+		t.Fatalf("bad: push polls: %d", pushPolls)
+	}
+
+	// Renewals do not require MFA again
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login/bob",
+		Auth:      resp.Auth,
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if pushPolls != 3 {
+		t.Fatalf("bad: push polls: %d", pushPolls)
+	}
+
+	// A rejected push fails the login
+	resp, err = write("login/dave", map[string]interface{}{"password": "password"})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "denied") {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// TOTP factors require a passcode
+	for passcode, expected := range map[string]string{
+		"":       "a TOTP passcode must be provided",
+		"654321": "E0000068",
+		"123456": "",
+	} {
+		resp, err = write("login/carol", map[string]interface{}{"password": "password", "totp": passcode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected == "" {
+			if resp == nil || resp.IsError() || !policyutil.EquivalentPolicies(resp.Auth.Policies, []string{"dev-policy"}) {
+				t.Fatalf("bad: resp: %#v", resp)
+			}
+			continue
+		}
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), expected) {
+			t.Fatalf("bad: passcode %q: resp: %#v", passcode, resp)
+		}
+	}
+
+	// Passcodes cannot be used without a TOTP factor
+	resp, err = write("login/bob", map[string]interface{}{"password": "password", "totp": "123456"})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "TOTP factor is required") {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+}
@@ -38,6 +38,11 @@ func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (*api.Secret, erro
 		"password": password,
 	}
 
+	totp, ok := m["totp"]
+	if ok {
+		data["totp"] = totp
+	}
+
 	mfa_method, ok := m["method"]
 	if ok {
 		data["method"] = mfa_method
@@ -75,12 +80,21 @@ Usage: vault login -method=okta [CONFIG K=V...]
 
       $ vault login -method=okta username=bob password=password
 
+  Authenticate as "sally" with a TOTP passcode when Okta requires MFA, instead
+  of an Okta Verify push:
+
+      $ vault login -method=okta username=sally totp=123456
+
 Configuration:
 
   password=<string>
       Okta password to use for authentication. If not provided, the CLI will
       prompt for this on stdin.
 
+  totp=<string>
+      TOTP passcode to use when Okta requires MFA. If not provided, an Okta
+      Verify push is sent.
+
   username=<string>
       Okta username to use for authentication.
 `
@@ -25,6 +25,11 @@ func pathLogin(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Password for this user.",
 			},
+
+			"totp": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "TOTP passcode of the Okta Verify or Google Authenticator factor of the user, if Okta requires MFA. If not set, an Okta Verify push is sent instead.",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -55,8 +60,9 @@ func (b *backend) pathLoginAliasLookahead(ctx context.Context, req *logical.Requ
 func (b *backend) pathLogin(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	username := d.Get("username").(string)
 	password := d.Get("password").(string)
+	totp := d.Get("totp").(string)
 
-	policies, resp, groupNames, err := b.Login(ctx, req, username, password)
+	policies, resp, groupNames, err := b.Login(ctx, req, username, password, totp, false)
 	// Handle an internal error
 	if err != nil {
 		return nil, err
@@ -113,7 +119,7 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 	username := req.Auth.Metadata["username"]
 	password := req.Auth.InternalData["password"].(string)
 
-	loginPolicies, resp, groupNames, err := b.Login(ctx, req, username, password)
+	loginPolicies, resp, groupNames, err := b.Login(ctx, req, username, password, "", true)
 	if len(loginPolicies) == 0 {
 		return resp, err
 	}
@@ -163,4 +169,8 @@ Log in with a username and password.
 
 const pathLoginDesc = `
 This endpoint authenticates using a username and password.
+
+If Okta requires MFA, the TOTP passcode of the user is verified if given in
+"totp". Otherwise, an Okta Verify push is sent, and the login waits for the
+user to answer it. Renewals do not require MFA again.
 `
@@ -1,17 +1,26 @@
 package radius
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	dockertest "gopkg.in/ory-am/dockertest.v3"
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
 )
 
 const (
@@ -324,3 +333,207 @@ func testAccUserLoginPolicy(t *testing.T, user string, data map[string]interface
 		},
 	}
 }
+
+func TestMSCHAPv2_rfc2759(t *testing.T) {
+	// Test vectors from section 9.2 of RFC 2759
+	authenticatorChallenge, _ := hex.DecodeString("5B5D7C7D7B3F2F3E3C2C602132262628")
+	peerChallenge, _ := hex.DecodeString("21402324255E262A28295F2B3A337C7E")
+	exchange := newMSCHAPv2Exchange("User", "clientPass", authenticatorChallenge, peerChallenge)
+
+	if actual := hex.EncodeToString(exchange.challengeHash()); actual != "d02e4386bce91226" {
+		t.Fatalf("bad: challenge hash: %s", actual)
+	}
+	if actual := hex.EncodeToString(exchange.passwordHash); actual != "44ebba8d5312b8d611474411f56989ae" {
+		t.Fatalf("bad: password hash: %s", actual)
+	}
+	if actual := hex.EncodeToString(exchange.ntResponse); actual != "82309ecd8d708b5ea08faa3981cd83544233114a3d85d6df" {
+		t.Fatalf("bad: NT-Response: %s", actual)
+	}
+	if actual := exchange.authenticatorResponse(); actual != "S=407A5589115FD0D6209F510FE9C04566932CDA56" {
+		t.Fatalf("bad: authenticator response: %s", actual)
+	}
+}
+
+func TestBackend_stubbedServer(t *testing.T) {
+	const (
+		secret    = "testing123"
+		password  = "password"
+		pin       = "1234"
+		tokenCode = "567890"
+	)
+
+	var l sync.Mutex
+	var nasIdentifiers []string
+	var badAuthenticator bool
+
+	handler := func(w radius.ResponseWriter, r *radius.Request) {
+		username := rfc2865.UserName_GetString(r.Packet)
+		l.Lock()
+		nasIdentifiers = append(nasIdentifiers, rfc2865.NASIdentifier_GetString(r.Packet))
+		l.Unlock()
+
+		// The user "token" answers challenges with token codes
+		expected := password
+		if username == "token" {
+			expected = pin
+			if state := rfc2865.State_GetString(r.Packet); state != "" {
+				if state != "token-state" {
+					w.Write(r.Response(radius.CodeAccessReject))
+					return
+				}
+				expected = tokenCode
+			}
+		}
+
+		response := r.Response(radius.CodeAccessReject)
+		switch {
+		case rfc2865.CHAPPassword_Get(r.Packet) != nil:
+			chap := rfc2865.CHAPPassword_Get(r.Packet)
+			hash := md5.New()
+			hash.Write(chap[:1])
+			hash.Write([]byte(expected))
+			hash.Write(rfc2865.CHAPChallenge_Get(r.Packet))
+			if bytes.Equal(hash.Sum(nil), chap[1:]) {
+				response = r.Response(radius.CodeAccessAccept)
+			}
+
+		case msVendorAttribute(r.Packet, msCHAP2Response) != nil:
+			mschap := msVendorAttribute(r.Packet, msCHAP2Response)
+			exchange := newMSCHAPv2Exchange(username, expected, msVendorAttribute(r.Packet, msCHAPChallenge), mschap[2:18])
+			if bytes.Equal(exchange.ntResponse, mschap[26:]) {
+				response = r.Response(radius.CodeAccessAccept)
+				authenticatorResponse := exchange.authenticatorResponse()
+				l.Lock()
+				if badAuthenticator {
+					authenticatorResponse = "S=0000000000000000000000000000000000000000"
+				}
+				l.Unlock()
+				value := append([]byte{msCHAP2Success, byte(len(authenticatorResponse) + 3), mschap[0]}, authenticatorResponse...)
+				vsa, _ := radius.NewVendorSpecific(vendorMicrosoft, value)
+				response.Add(radiusTypeVendor, vsa)
+			}
+
+		default:
+			if rfc2865.UserPassword_GetString(r.Packet) == expected {
+				response = r.Response(radius.CodeAccessAccept)
+			}
+		}
+
+		if username == "token" && expected == pin && response.Code == radius.CodeAccessAccept {
+			response = r.Response(radius.CodeAccessChallenge)
+			rfc2865.State_SetString(response, "token-state")
+			rfc2865.ReplyMessage_SetString(response, "Enter the next token code")
+		}
+		w.Write(response)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &radius.PacketServer{
+		SecretSource: radius.StaticSecretSource([]byte(secret)),
+		Handler:      radius.HandlerFunc(handler),
+	}
+	go server.Serve(conn)
+	defer server.Shutdown(context.Background())
+
+	b, err := Factory(context.Background(), &logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: testSysTTL,
+			MaxLeaseTTLVal:     testSysMaxTTL,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   storage,
+		})
+	}
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	if resp, err := write("config", map[string]interface{}{
+		"host":                       "127.0.0.1",
+		"port":                       port,
+		"secret":                     secret,
+		"unregistered_user_policies": "policy1",
+		"nas_identifier":             "vault-test",
+		"read_timeout":               2,
+		"auth_type":                  "eap",
+	}); err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid auth_type error, got resp: %#v\nerr: %v", resp, err)
+	}
+
+	for _, authType := range []string{"pap", "chap", "mschapv2"} {
+		if resp, err := write("config", map[string]interface{}{
+			"host":                       "127.0.0.1",
+			"port":                       port,
+			"secret":                     secret,
+			"unregistered_user_policies": "policy1",
+			"nas_identifier":             "vault-test",
+			"read_timeout":               2,
+			"auth_type":                  authType,
+		}); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+
+		resp, err := write("login/alice", map[string]interface{}{"password": password})
+		if err != nil || resp == nil || resp.IsError() || resp.Auth == nil {
+			t.Fatalf("bad: %s: resp: %#v\nerr: %v", authType, resp, err)
+		}
+		if !resp.Auth.Renewable {
+			t.Fatalf("bad: %s: expected renewable token", authType)
+		}
+
+		resp, err = write("login/alice", map[string]interface{}{"password": "wrong"})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("bad: %s: resp: %#v\nerr: %v", authType, resp, err)
+		}
+
+		// Challenges are answered with another login
+		resp, err = write("login/token", map[string]interface{}{"password": pin})
+		if err != nil || resp == nil || resp.IsError() || resp.Auth != nil {
+			t.Fatalf("bad: %s: resp: %#v\nerr: %v", authType, resp, err)
+		}
+		if resp.Data["challenge_message"] != "Enter the next token code" {
+			t.Fatalf("bad: %s: challenge: %#v", authType, resp.Data)
+		}
+		state := resp.Data["state"].(string)
+		if decoded, _ := base64.StdEncoding.DecodeString(state); string(decoded) != "token-state" {
+			t.Fatalf("bad: %s: state: %q", authType, state)
+		}
+
+		resp, err = write("login/token", map[string]interface{}{"password": tokenCode, "state": state})
+		if err != nil || resp == nil || resp.IsError() || resp.Auth == nil {
+			t.Fatalf("bad: %s: resp: %#v\nerr: %v", authType, resp, err)
+		}
+		if resp.Auth.Renewable || resp.Auth.InternalData["password"] != nil {
+			t.Fatalf("bad: %s: tokens of challenges must not be renewable: %#v", authType, resp.Auth)
+		}
+	}
+
+	// The authenticator response of MS-CHAPv2 is verified
+	l.Lock()
+	badAuthenticator = true
+	l.Unlock()
+	resp, err := write("login/alice", map[string]interface{}{"password": password})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "invalid authenticator response") {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	for _, nasIdentifier := range nasIdentifiers {
+		if nasIdentifier != "vault-test" {
+			t.Fatalf("bad: NAS identifiers: %#v", nasIdentifiers)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package radius
+
+import (
+	"bytes"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+	"layeh.com/radius"
+	. "layeh.com/radius/rfc2865"
+)
+
+const (
+	authTypePAP      = "pap"
+	authTypeCHAP     = "chap"
+	authTypeMSCHAPv2 = "mschapv2"
+
+	// Microsoft vendor specific attributes, from RFC 2548
+	vendorMicrosoft  = 311
+	msCHAPChallenge  = 11
+	msCHAP2Response  = 25
+	msCHAP2Success   = 26
+	radiusTypeVendor = 26
+)
+
+var (
+	// Constants of the authenticator response of MS-CHAPv2, from RFC 2759
+	msCHAPv2Magic1 = []byte("Magic server to client signing constant")
+	msCHAPv2Magic2 = []byte("Pad to make it do more than one iteration")
+)
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// padPassword pads the password with nulls to a multiple of 16 octets, as
+// RFC 2865 requires for the User-Password attribute
+func padPassword(password string) []byte {
+	length := (len(password) + 15) / 16 * 16
+	if length == 0 {
+		length = 16
+	}
+	padded := make([]byte, length)
+	copy(padded, password)
+	return padded
+}
+
+// setCHAPPassword sets the CHAP-Password and CHAP-Challenge attributes of the
+// packet, as described in RFC 2865
+func setCHAPPassword(packet *radius.Packet, password string) error {
+	challenge, err := randomBytes(17)
+	if err != nil {
+		return err
+	}
+	ident, challenge := challenge[0], challenge[1:]
+
+	return setCHAPPasswordWithChallenge(packet, password, ident, challenge)
+}
+
+func setCHAPPasswordWithChallenge(packet *radius.Packet, password string, ident byte, challenge []byte) error {
+	hash := md5.New()
+	hash.Write([]byte{ident})
+	hash.Write([]byte(password))
+	hash.Write(challenge)
+
+	if err := CHAPPassword_Set(packet, append([]byte{ident}, hash.Sum(nil)...)); err != nil {
+		return err
+	}
+	return CHAPChallenge_Set(packet, challenge)
+}
+
+// msCHAPv2Exchange holds the state of an MS-CHAPv2 authentication needed to
+// verify the response of the server
+type msCHAPv2Exchange struct {
+	username               string
+	passwordHash           []byte
+	authenticatorChallenge []byte
+	peerChallenge          []byte
+	ntResponse             []byte
+}
+
+// setMSCHAPv2Response sets the MS-CHAP-Challenge and MS-CHAP2-Response vendor
+// specific attributes of the packet, as described in RFC 2548 and RFC 2759
+func setMSCHAPv2Response(packet *radius.Packet, username, password string) (*msCHAPv2Exchange, error) {
+	challenges, err := randomBytes(33)
+	if err != nil {
+		return nil, err
+	}
+
+	exchange := newMSCHAPv2Exchange(username, password, challenges[1:17], challenges[17:])
+	ident := challenges[0]
+
+	// The response is made of the identifier, flags, peer challenge, 8
+	// reserved octets and NT-Response
+	response := make([]byte, 0, 50)
+	response = append(response, ident, 0)
+	response = append(response, exchange.peerChallenge...)
+	response = append(response, make([]byte, 8)...)
+	response = append(response, exchange.ntResponse...)
+
+	for _, attr := range []struct {
+		vendorType byte
+		value      []byte
+	}{
+		{msCHAPChallenge, exchange.authenticatorChallenge},
+		{msCHAP2Response, response},
+	} {
+		value := append([]byte{attr.vendorType, byte(len(attr.value) + 2)}, attr.value...)
+		vsa, err := radius.NewVendorSpecific(vendorMicrosoft, value)
+		if err != nil {
+			return nil, err
+		}
+		packet.Add(radiusTypeVendor, vsa)
+	}
+
+	return exchange, nil
+}
+
+func newMSCHAPv2Exchange(username, password string, authenticatorChallenge, peerChallenge []byte) *msCHAPv2Exchange {
+	e := &msCHAPv2Exchange{
+		username:               username,
+		passwordHash:           ntPasswordHash(password),
+		authenticatorChallenge: authenticatorChallenge,
+		peerChallenge:          peerChallenge,
+	}
+	e.ntResponse = challengeResponse(e.challengeHash(), e.passwordHash)
+	return e
+}
+
+// challengeHash returns the 8 octet challenge of the NT-Response
+func (e *msCHAPv2Exchange) challengeHash() []byte {
+	hash := sha1.New()
+	hash.Write(e.peerChallenge)
+	hash.Write(e.authenticatorChallenge)
+	hash.Write([]byte(e.username))
+	return hash.Sum(nil)[:8]
+}
+
+// authenticatorResponse returns the response the server must send to prove
+// that it knows the password
+func (e *msCHAPv2Exchange) authenticatorResponse() string {
+	hashHash := md4.New()
+	hashHash.Write(e.passwordHash)
+
+	hash := sha1.New()
+	hash.Write(hashHash.Sum(nil))
+	hash.Write(e.ntResponse)
+	hash.Write(msCHAPv2Magic1)
+	digest := hash.Sum(nil)
+
+	hash = sha1.New()
+	hash.Write(digest)
+	hash.Write(e.challengeHash())
+	hash.Write(msCHAPv2Magic2)
+
+	return "S=" + strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
+}
+
+// verify checks the MS-CHAP2-Success attribute of the Access-Accept sent by
+// the server
+func (e *msCHAPv2Exchange) verify(packet *radius.Packet) error {
+	success := msVendorAttribute(packet, msCHAP2Success)
+	// The attribute holds the identifier followed by the authenticator
+	// response
+	if len(success) < 2 {
+		return errors.New("missing MS-CHAP2-Success attribute in response")
+	}
+	if !bytes.HasPrefix(success[1:], []byte(e.authenticatorResponse())) {
+		return errors.New("invalid authenticator response in MS-CHAP2-Success attribute")
+	}
+	return nil
+}
+
+// msVendorAttribute returns the value of the first Microsoft vendor specific
+// attribute of the given type in the packet
+func msVendorAttribute(packet *radius.Packet, vendorType byte) []byte {
+	for _, attr := range packet.Attributes[radiusTypeVendor] {
+		vendorID, value, err := radius.VendorSpecific(attr)
+		if err != nil || vendorID != vendorMicrosoft {
+			continue
+		}
+		for len(value) >= 2 && int(value[1]) >= 2 && int(value[1]) <= len(value) {
+			if value[0] == vendorType {
+				return value[2:value[1]]
+			}
+			value = value[value[1]:]
+		}
+	}
+	return nil
+}
+
+// ntPasswordHash returns the MD4 hash of the UTF-16 little endian encoding of
+// the password
+func ntPasswordHash(password string) []byte {
+	encoded := utf16.Encode([]rune(password))
+	b := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		b[2*i] = byte(r)
+		b[2*i+1] = byte(r >> 8)
+	}
+
+	hash := md4.New()
+	hash.Write(b)
+	return hash.Sum(nil)
+}
+
+// challengeResponse encrypts the challenge with three DES keys made of the
+// password hash
+func challengeResponse(challenge, passwordHash []byte) []byte {
+	padded := make([]byte, 21)
+	copy(padded, passwordHash)
+
+	response := make([]byte, 24)
+	for i := 0; i < 3; i++ {
+		block, err := des.NewCipher(desKey(padded[7*i : 7*i+7]))
+		if err != nil {
+			// Keys are always 8 bytes long
+			panic(fmt.Sprintf("unexpected DES error: %v", err))
+		}
+		block.Encrypt(response[8*i:], challenge)
+	}
+	return response
+}
+
+// desKey expands 7 bytes into a DES key, inserting a parity bit after every 7
+// bits
+func desKey(b []byte) []byte {
+	key := make([]byte, 8)
+	key[0] = b[0]
+	for i := 1; i < 7; i++ {
+		key[i] = b[i-1]<<(8-uint(i)) | b[i]>>uint(i)
+	}
+	key[7] = b[6] << 1
+	for i := range key {
+		key[i] &^= 1
+	}
+	return key
+}
@@ -2,6 +2,7 @@ package radius
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/hashicorp/vault/logical"
@@ -46,6 +47,16 @@ func pathConfig(b *backend) *framework.Path {
 				Default:     10,
 				Description: "RADIUS NAS port field (default: 10)",
 			},
+			"nas_identifier": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "",
+				Description: "RADIUS NAS Identifier field (optional)",
+			},
+			"auth_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     authTypePAP,
+				Description: `Authentication protocol of the Access-Requests: "pap", "chap" or "mschapv2" (default: pap)`,
+			},
 		},
 
 		ExistenceCheck: b.configExistenceCheck,
@@ -110,6 +121,8 @@ func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, d *f
 			"dial_timeout":               cfg.DialTimeout,
 			"read_timeout":               cfg.ReadTimeout,
 			"nas_port":                   cfg.NasPort,
+			"nas_identifier":             cfg.NasIdentifier,
+			"auth_type":                  cfg.authType(),
 		},
 	}
 	return resp, nil
@@ -190,6 +203,25 @@ func (b *backend) pathConfigCreateUpdate(ctx context.Context, req *logical.Reque
 		cfg.NasPort = d.Get("nas_port").(int)
 	}
 
+	nasIdentifier, ok := d.GetOk("nas_identifier")
+	if ok {
+		cfg.NasIdentifier = nasIdentifier.(string)
+	} else if req.Operation == logical.CreateOperation {
+		cfg.NasIdentifier = d.Get("nas_identifier").(string)
+	}
+
+	authType, ok := d.GetOk("auth_type")
+	if ok {
+		cfg.AuthType = strings.ToLower(authType.(string))
+	} else if req.Operation == logical.CreateOperation {
+		cfg.AuthType = d.Get("auth_type").(string)
+	}
+	switch cfg.AuthType {
+	case authTypePAP, authTypeCHAP, authTypeMSCHAPv2:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid auth_type %q; must be %q, %q or %q", cfg.AuthType, authTypePAP, authTypeCHAP, authTypeMSCHAPv2)), nil
+	}
+
 	entry, err := logical.StorageEntryJSON("config", cfg)
 	if err != nil {
 		return nil, err
@@ -209,6 +241,17 @@ type ConfigEntry struct {
 	DialTimeout              int      `json:"dial_timeout" structs:"dial_timeout" mapstructure:"dial_timeout"`
 	ReadTimeout              int      `json:"read_timeout" structs:"read_timeout" mapstructure:"read_timeout"`
 	NasPort                  int      `json:"nas_port" structs:"nas_port" mapstructure:"nas_port"`
+	NasIdentifier            string   `json:"nas_identifier" structs:"nas_identifier" mapstructure:"nas_identifier"`
+	AuthType                 string   `json:"auth_type" structs:"auth_type" mapstructure:"auth_type"`
+}
+
+// authType returns the authentication protocol, which is PAP for
+// configurations written before it could be set
+func (c *ConfigEntry) authType() string {
+	if c.AuthType == "" {
+		return authTypePAP
+	}
+	return c.AuthType
 }
 
 const pathConfigHelpSyn = `
@@ -218,4 +261,9 @@ Configure the RADIUS server to connect to, along with its options.
 const pathConfigHelpDesc = `
 This endpoint allows you to configure the RADIUS server to connect to and its
 configuration options.
+
+The password of the Access-Requests is sent with PAP by default. CHAP and
+MS-CHAPv2 can be used instead with "auth_type", if the RADIUS server knows the
+passwords of the users in cleartext. With MS-CHAPv2, the response of the
+server is verified to make sure it knows the password too.
 `
@@ -2,6 +2,7 @@ package radius
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"net"
 	"strconv"
@@ -34,6 +35,11 @@ func pathLogin(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Password for this user.",
 			},
+
+			"state": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "State returned by a previous login request answered with a challenge, when the password answers the challenge.",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -76,7 +82,16 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, d *framew
 		return logical.ErrorResponse("password cannot be empty"), nil
 	}
 
-	policies, resp, err := b.RadiusLogin(ctx, req, username, password)
+	var state []byte
+	if stateRaw := d.Get("state").(string); stateRaw != "" {
+		var err error
+		state, err = base64.StdEncoding.DecodeString(stateRaw)
+		if err != nil {
+			return logical.ErrorResponse("state must be base64 encoded"), nil
+		}
+	}
+
+	policies, resp, err := b.RadiusLogin(ctx, req, username, password, state)
 	// Handle an internal error
 	if err != nil {
 		return nil, err
@@ -86,6 +101,10 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, d *framew
 		if resp.IsError() {
 			return resp, nil
 		}
+		// Handle a challenge, answered by another login request
+		if _, ok := resp.Data["state"]; ok {
+			return resp, nil
+		}
 	}
 
 	resp.Auth = &logical.Auth{
@@ -105,6 +124,14 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, d *framew
 			Name: username,
 		},
 	}
+
+	// Passwords answering challenges are usually one-time passcodes, which
+	// cannot be used to renew the token
+	if state != nil {
+		delete(resp.Auth.InternalData, "password")
+		resp.Auth.LeaseOptions.Renewable = false
+	}
+
 	return resp, nil
 }
 
@@ -112,15 +139,21 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 	var err error
 
 	username := req.Auth.Metadata["username"]
-	password := req.Auth.InternalData["password"].(string)
+	password, ok := req.Auth.InternalData["password"].(string)
+	if !ok {
+		return nil, fmt.Errorf("tokens of logins answering a challenge cannot be renewed")
+	}
 
 	var resp *logical.Response
 	var loginPolicies []string
 
-	loginPolicies, resp, err = b.RadiusLogin(ctx, req, username, password)
+	loginPolicies, resp, err = b.RadiusLogin(ctx, req, username, password, nil)
 	if err != nil || (resp != nil && resp.IsError()) {
 		return resp, err
 	}
+	if _, ok := resp.Data["state"]; ok {
+		return nil, fmt.Errorf("authentication server requires a challenge to be answered, not renewing")
+	}
 
 	if !policyutil.EquivalentPolicies(loginPolicies, req.Auth.Policies) {
 		return nil, fmt.Errorf("policies have changed, not renewing")
@@ -129,7 +162,11 @@ func (b *backend) pathLoginRenew(ctx context.Context, req *logical.Request, d *f
 	return &logical.Response{Auth: req.Auth}, nil
 }
 
-func (b *backend) RadiusLogin(ctx context.Context, req *logical.Request, username string, password string) ([]string, *logical.Response, error) {
+// RadiusLogin sends an Access-Request for the user to the RADIUS server,
+// with the state of the challenge answered by the password, if any. If the
+// server answers with an Access-Challenge, the response holds the challenge
+// message and the state to send with the answer.
+func (b *backend) RadiusLogin(ctx context.Context, req *logical.Request, username string, password string, state []byte) ([]string, *logical.Response, error) {
 
 	cfg, err := b.Config(ctx, req)
 	if err != nil {
@@ -143,8 +180,30 @@ func (b *backend) RadiusLogin(ctx context.Context, req *logical.Request, usernam
 
 	packet := radius.New(radius.CodeAccessRequest, []byte(cfg.Secret))
 	UserName_SetString(packet, username)
-	UserPassword_SetString(packet, password)
+
+	var exchange *msCHAPv2Exchange
+	switch cfg.authType() {
+	case authTypeCHAP:
+		err = setCHAPPassword(packet, password)
+	case authTypeMSCHAPv2:
+		exchange, err = setMSCHAPv2Response(packet, username, password)
+	default:
+		if len(password) > 128 {
+			return nil, logical.ErrorResponse("password must be at most 128 characters long"), nil
+		}
+		err = UserPassword_Set(packet, padPassword(password))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
 	packet.Add(5, radius.NewInteger(uint32(cfg.NasPort)))
+	if cfg.NasIdentifier != "" {
+		NASIdentifier_SetString(packet, cfg.NasIdentifier)
+	}
+	if state != nil {
+		State_Set(packet, state)
+	}
 
 	client := radius.Client{
 		Dialer: net.Dialer{
@@ -157,10 +216,32 @@ func (b *backend) RadiusLogin(ctx context.Context, req *logical.Request, usernam
 	if err != nil {
 		return nil, logical.ErrorResponse(err.Error()), nil
 	}
-	if received.Code != radius.CodeAccessAccept {
+
+	switch received.Code {
+	case radius.CodeAccessAccept:
+		// Allowed
+	case radius.CodeAccessChallenge:
+		receivedState := State_Get(received)
+		if receivedState == nil {
+			return nil, logical.ErrorResponse("challenge of the authentication server has no state"), nil
+		}
+		messages, _ := ReplyMessage_GetStrings(received)
+		return nil, &logical.Response{
+			Data: map[string]interface{}{
+				"challenge_message": strings.Join(messages, "\n"),
+				"state":             base64.StdEncoding.EncodeToString(receivedState),
+			},
+		}, nil
+	default:
 		return nil, logical.ErrorResponse("access denied by the authentication server"), nil
 	}
 
+	if exchange != nil {
+		if err := exchange.verify(received); err != nil {
+			return nil, logical.ErrorResponse(fmt.Sprintf("failed to verify the authentication server: %v", err)), nil
+		}
+	}
+
 	var policies []string
 	// Retrieve user entry from storage
 	user, err := b.user(ctx, req.Storage, username)
@@ -187,4 +268,10 @@ Log in with a username and password.
 const pathLoginDesc = `
 This endpoint authenticates using a username and password. Please be sure to
 read the note on escaping from the path-help for the 'config' endpoint.
+
+If the RADIUS server answers with a challenge, such as a request for the next
+token code, the response holds the "challenge_message" of the server and a
+"state". The challenge is answered by logging in again with the answer as the
+password and the "state". Tokens obtained by answering a challenge cannot be
+renewed.
 `
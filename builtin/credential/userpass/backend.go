@@ -3,6 +3,7 @@ package userpass
 import (
 	"context"
 
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/helper/mfa"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -18,6 +19,7 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 
 func Backend() *backend {
 	var b backend
+	b.lockoutLocks = locksutil.CreateLocks()
 	b.Backend = &framework.Backend{
 		Help: backendHelp,
 
@@ -27,6 +29,10 @@ func Backend() *backend {
 			Unauthenticated: []string{
 				"login/*",
 			},
+
+			LocalStorage: []string{
+				lockoutPrefix,
+			},
 		},
 
 		Paths: append([]*framework.Path{
@@ -34,12 +40,15 @@ func Backend() *backend {
 			pathUsersList(&b),
 			pathUserPolicies(&b),
 			pathUserPassword(&b),
+			pathUserUnlock(&b),
+			pathConfig(&b),
 		},
 			mfa.MFAPaths(b.Backend, pathLogin(&b))...,
 		),
 
-		AuthRenew:   b.pathLoginRenew,
-		BackendType: logical.TypeCredential,
+		AuthRenew:    b.pathLoginRenew,
+		PeriodicFunc: b.periodicFunc,
+		BackendType:  logical.TypeCredential,
 	}
 
 	return &b
@@ -47,6 +56,17 @@ func Backend() *backend {
 
 type backend struct {
 	*framework.Backend
+
+	// lockoutLocks serialize the login attempts of usernames while lockouts
+	// are enabled, so that concurrent attempts are all counted
+	lockoutLocks []*locksutil.LockEntry
+}
+
+// periodicFunc of the backend will be invoked once a minute by the
+// RollbackManager. It deletes the failed login counters and lockouts that
+// expired.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	return b.tidyLockouts(ctx, req.Storage)
 }
 
 const backendHelp = `
@@ -57,4 +77,7 @@ are supported.
 The username/password combination is configured using the "users/"
 endpoints by a user with root access. Authentication is then done
 by supplying the two fields for "login".
+
+Password policies and lockouts after failed login attempts are
+configured using the "config" endpoint.
 `
@@ -318,3 +318,276 @@ func testAccStepReadUser(t *testing.T, name string, policies string) logicaltest
 		},
 	}
 }
+
+func TestBackend_passwordPolicy(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+
+	ctx := context.Background()
+
+	b, err := Factory(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"password_min_length":        10,
+			"password_require_uppercase": true,
+			"password_require_digits":    true,
+			"password_require_symbols":   true,
+			"password_history":           3,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Path:      "config",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+	if resp.Data["password_min_length"].(int) != 10 || resp.Data["password_require_lowercase"].(bool) || resp.Data["lockout_window"].(int64) != 900 {
+		t.Fatalf("bad: config: %#v", resp.Data)
+	}
+
+	setPassword := func(path string, operation logical.Operation, password string) *logical.Response {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Path:      path,
+			Operation: operation,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"password": password,
+			},
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	for _, password := range []string{"Sh0rt!", "longpassword1!", "LongPassword!!", "LongPassword11"} {
+		if resp := setPassword("users/testuser", logical.CreateOperation, password); resp == nil || !resp.IsError() {
+			t.Fatalf("expected password %q to be refused", password)
+		}
+	}
+
+	if resp := setPassword("users/testuser", logical.CreateOperation, "LongPassword1!"); resp != nil && resp.IsError() {
+		t.Fatalf("bad: resp: %#v", resp)
+	}
+
+	for _, password := range []string{"LongPassword2!", "LongPassword3!"} {
+		if resp := setPassword("users/testuser/password", logical.UpdateOperation, password); resp != nil && resp.IsError() {
+			t.Fatalf("bad: resp: %#v", resp)
+		}
+	}
+
+	// The last three passwords cannot be reused, nor can policies be bypassed
+	// through the password endpoint
+	for _, password := range []string{"LongPassword1!", "LongPassword2!", "LongPassword3!", "weak"} {
+		if resp := setPassword("users/testuser/password", logical.UpdateOperation, password); resp == nil || !resp.IsError() {
+			t.Fatalf("expected password %q to be refused", password)
+		}
+	}
+
+	if resp := setPassword("users/testuser/password", logical.UpdateOperation, "LongPassword4!"); resp != nil && resp.IsError() {
+		t.Fatalf("bad: resp: %#v", resp)
+	}
+	if resp := setPassword("users/testuser", logical.UpdateOperation, "LongPassword1!"); resp != nil && resp.IsError() {
+		t.Fatalf("bad: resp: %#v", resp)
+	}
+}
+
+func TestBackend_lockout(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+
+	ctx := context.Background()
+
+	b, err := Factory(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"lockout_threshold": 3,
+			"lockout_duration":  0,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Path:      "users/testuser",
+		Operation: logical.CreateOperation,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"password": "testpassword",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+
+	login := func(username, password string) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Path:      "login/" + username,
+			Operation: logical.UpdateOperation,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"password": password,
+			},
+			Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		})
+	}
+
+	checkSuccess := func(resp *logical.Response, err error) {
+		t.Helper()
+		if err != nil || resp == nil || resp.IsError() || resp.Auth == nil {
+			t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+		}
+	}
+
+	// Failed logins get the same error response whether lockouts are enabled
+	// or not, while the counts are kept in storage
+	checkFailure := func(username, password, expected string, attempts int, locked bool) {
+		t.Helper()
+		resp, err := login(username, password)
+		if err != nil || resp == nil || !resp.IsError() || resp.Data["error"] != expected {
+			t.Fatalf("expected error %q, got resp: %#v\nerr: %v\n", expected, resp, err)
+		}
+		lockout, err := b.(*backend).lockoutEntry(ctx, storage, username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lockout == nil || lockout.FailedAttempts != attempts || lockout.LockedAt.IsZero() == locked {
+			t.Fatalf("expected %d failed attempts, locked out %t, got: %#v", attempts, locked, lockout)
+		}
+	}
+
+	checkFailure("testuser", "wrong", "invalid username or password", 1, false)
+	checkFailure("testuser", "wrong", "invalid username or password", 2, false)
+
+	// A successful login resets the count
+	checkSuccess(login("testuser", "testpassword"))
+	checkFailure("testuser", "wrong", "invalid username or password", 1, false)
+	checkFailure("testuser", "wrong", "invalid username or password", 2, false)
+	checkFailure("testuser", "wrong", "invalid username or password", 3, true)
+
+	// Once locked, the right password is refused too
+	checkFailure("testuser", "testpassword", "user is locked out", 3, true)
+
+	// Unknown users are counted alike, so that lockouts do not reveal which
+	// users exist
+	checkFailure("unknown", "wrong", "invalid username or password", 1, false)
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Path:      "users/testuser",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+	if resp.Data["locked"] != true || resp.Data["failed_login_attempts"] != 3 {
+		t.Fatalf("bad: user: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Path:      "users/testuser/unlock",
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+	checkSuccess(login("testuser", "testpassword"))
+
+	// Failed attempts older than the window are forgotten
+	checkFailure("testuser", "wrong", "invalid username or password", 1, false)
+	backend := b.(*backend)
+	lockout, err := backend.lockoutEntry(ctx, storage, "testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockout.WindowStart = lockout.WindowStart.Add(-time.Hour)
+	if err := backend.setLockoutEntry(ctx, storage, "testuser", lockout); err != nil {
+		t.Fatal(err)
+	}
+	checkFailure("testuser", "wrong", "invalid username or password", 1, false)
+
+	// Unknown usernames are counted in storage as well, and survive
+	// reloading the backend
+	b, err = Factory(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFailure("unknown", "wrong", "invalid username or password", 2, false)
+	checkFailure("unknown", "wrong", "invalid username or password", 3, true)
+	checkFailure("unknown", "wrong", "user is locked out", 3, true)
+
+	// Their entries expire after unknownLockoutTTL, even with lockouts that
+	// never expire
+	lockout, err = backend.lockoutEntry(ctx, storage, "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout == nil || !lockout.UnknownUser {
+		t.Fatalf("bad: lockout entry of an unknown username: %#v", lockout)
+	}
+	lockout.WindowStart = lockout.WindowStart.Add(-unknownLockoutTTL)
+	lockout.LockedAt = lockout.LockedAt.Add(-unknownLockoutTTL)
+	if err := backend.setLockoutEntry(ctx, storage, "unknown", lockout); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired entries are tidied, including those of usernames with slashes
+	expired := &lockoutEntry{
+		FailedAttempts: 1,
+		WindowStart:    time.Now().Add(-time.Hour),
+	}
+	if err := backend.setLockoutEntry(ctx, storage, "team/alice", expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	usernames, err := logical.CollectKeys(ctx, &lockoutView{storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(usernames, []string{"testuser"}) {
+		t.Fatalf("bad: lockout entries: %#v", usernames)
+	}
+
+	// Without lockouts, failed logins get the same response
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Path:      "config",
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"lockout_threshold": 0,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+	resp, err = login("testuser", "wrong")
+	if err != nil || resp == nil || !resp.IsError() || resp.Data["error"] != "invalid username or password" {
+		t.Fatalf("bad: resp: %#v\nerr: %v\n", resp, err)
+	}
+}
@@ -0,0 +1,152 @@
+package userpass
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	lockoutPrefix = "lockout/"
+
+	// unknownLockoutTTL bounds the lifetime of the lockout entries of
+	// usernames that do not exist, so that they do not pile up in storage
+	// when lockouts or their windows do not expire
+	unknownLockoutTTL = 24 * time.Hour
+)
+
+// lockoutEntry counts the failed login attempts of a username. Unknown
+// usernames are counted alike, so that lockouts do not reveal which users
+// exist, but their entries expire after unknownLockoutTTL at most.
+type lockoutEntry struct {
+	FailedAttempts int       `json:"failed_attempts"`
+	WindowStart    time.Time `json:"window_start"`
+
+	// LockedAt is the time the username was locked out, if it is
+	LockedAt time.Time `json:"locked_at"`
+
+	// UnknownUser is set if the username did not exist when the entry was
+	// created
+	UnknownUser bool `json:"unknown_user"`
+}
+
+// expired returns whether the entry no longer applies: either the lockout
+// or the window of the failed attempts has ended, or the entry of an unknown
+// username outlived unknownLockoutTTL.
+func (e *lockoutEntry) expired(config *config, now time.Time) bool {
+	if e.UnknownUser {
+		lastChange := e.WindowStart
+		if e.LockedAt.After(lastChange) {
+			lastChange = e.LockedAt
+		}
+		if !now.Before(lastChange.Add(unknownLockoutTTL)) {
+			return true
+		}
+	}
+	if !e.LockedAt.IsZero() {
+		return config.LockoutDuration != 0 && !now.Before(e.LockedAt.Add(config.LockoutDuration))
+	}
+	return config.LockoutWindow != 0 && !now.Before(e.WindowStart.Add(config.LockoutWindow))
+}
+
+// locked returns whether the username is currently locked out
+func (e *lockoutEntry) locked(config *config, now time.Time) bool {
+	return !e.LockedAt.IsZero() && !e.expired(config, now)
+}
+
+func (b *backend) lockoutEntry(ctx context.Context, s logical.Storage, username string) (*lockoutEntry, error) {
+	entry, err := s.Get(ctx, lockoutPrefix+username)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result lockoutEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) setLockoutEntry(ctx context.Context, s logical.Storage, username string, lockout *lockoutEntry) error {
+	entry, err := logical.StorageEntryJSON(lockoutPrefix+username, lockout)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// recordFailedLogin counts a failed login attempt of the username, locking it
+// out once the threshold is reached. The counts are logged rather than
+// returned, so that failed logins get the same response whether lockouts are
+// enabled or not. The lock for the username must be held.
+func (b *backend) recordFailedLogin(ctx context.Context, s logical.Storage, config *config, username string, exists bool, lockout *lockoutEntry) error {
+	now := time.Now()
+	if lockout == nil || lockout.expired(config, now) {
+		lockout = &lockoutEntry{
+			WindowStart: now,
+			UnknownUser: !exists,
+		}
+	}
+	lockout.FailedAttempts++
+
+	if lockout.FailedAttempts >= config.LockoutThreshold {
+		lockout.LockedAt = now
+		b.Logger().Warn("locking out user after too many failed login attempts", "username", username, "failed_login_attempts", lockout.FailedAttempts)
+	} else {
+		b.Logger().Info("failed login attempt", "username", username, "failed_login_attempts", lockout.FailedAttempts)
+	}
+
+	return b.setLockoutEntry(ctx, s, username, lockout)
+}
+
+// tidyLockouts deletes the lockout entries that no longer apply. Usernames
+// may contain slashes, so the whole prefix is walked.
+func (b *backend) tidyLockouts(ctx context.Context, s logical.Storage) error {
+	config, err := b.config(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	usernames, err := logical.CollectKeys(ctx, &lockoutView{s})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, username := range usernames {
+		lock := locksutil.LockForKey(b.lockoutLocks, username)
+		lock.Lock()
+
+		lockout, err := b.lockoutEntry(ctx, s, username)
+		if err == nil && lockout != nil && (config.LockoutThreshold == 0 || lockout.expired(config, now)) {
+			err = s.Delete(ctx, lockoutPrefix+username)
+		}
+
+		lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockoutView exposes the lockout entries keyed by username
+type lockoutView struct {
+	s logical.Storage
+}
+
+func (v *lockoutView) List(ctx context.Context, prefix string) ([]string, error) {
+	return v.s.List(ctx, lockoutPrefix+prefix)
+}
+
+func (v *lockoutView) Delete(ctx context.Context, key string) error {
+	return v.s.Delete(ctx, lockoutPrefix+key)
+}
@@ -0,0 +1,246 @@
+package userpass
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	defaultLockoutWindow   = 15 * time.Minute
+	defaultLockoutDuration = 15 * time.Minute
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"password_min_length": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "Minimum number of characters of passwords. Defaults to 0, meaning no minimum.",
+			},
+
+			"password_require_lowercase": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "If set, passwords must contain at least one lowercase letter.",
+			},
+
+			"password_require_uppercase": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "If set, passwords must contain at least one uppercase letter.",
+			},
+
+			"password_require_digits": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "If set, passwords must contain at least one digit.",
+			},
+
+			"password_require_symbols": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "If set, passwords must contain at least one character that is neither a letter nor a digit.",
+			},
+
+			"password_history": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `Number of most recent passwords of a user, including the current one, that
+cannot be reused when setting a new password. Defaults to 0, meaning passwords
+can be reused.`,
+			},
+
+			"lockout_threshold": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `Number of failed login attempts within lockout_window after which the
+username is locked out. Defaults to 0, disabling lockouts.`,
+			},
+
+			"lockout_window": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `Duration over which failed login attempts are counted. If 0, failed
+attempts are counted until a successful login. Defaults to 15 minutes.`,
+			},
+
+			"lockout_duration": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `Duration of lockouts. If 0, locked out usernames stay locked until
+unlocked through "users/<username>/unlock". Defaults to 15 minutes.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"password_min_length":        config.PasswordMinLength,
+			"password_require_lowercase": config.PasswordRequireLowercase,
+			"password_require_uppercase": config.PasswordRequireUppercase,
+			"password_require_digits":    config.PasswordRequireDigits,
+			"password_require_symbols":   config.PasswordRequireSymbols,
+			"password_history":           config.PasswordHistory,
+			"lockout_threshold":          config.LockoutThreshold,
+			"lockout_window":             int64(config.LockoutWindow.Seconds()),
+			"lockout_duration":           int64(config.LockoutDuration.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if minLength, ok := d.GetOk("password_min_length"); ok {
+		config.PasswordMinLength = minLength.(int)
+	}
+	if requireLowercase, ok := d.GetOk("password_require_lowercase"); ok {
+		config.PasswordRequireLowercase = requireLowercase.(bool)
+	}
+	if requireUppercase, ok := d.GetOk("password_require_uppercase"); ok {
+		config.PasswordRequireUppercase = requireUppercase.(bool)
+	}
+	if requireDigits, ok := d.GetOk("password_require_digits"); ok {
+		config.PasswordRequireDigits = requireDigits.(bool)
+	}
+	if requireSymbols, ok := d.GetOk("password_require_symbols"); ok {
+		config.PasswordRequireSymbols = requireSymbols.(bool)
+	}
+	if history, ok := d.GetOk("password_history"); ok {
+		config.PasswordHistory = history.(int)
+	}
+	if threshold, ok := d.GetOk("lockout_threshold"); ok {
+		config.LockoutThreshold = threshold.(int)
+	}
+	if window, ok := d.GetOk("lockout_window"); ok {
+		config.LockoutWindow = time.Duration(window.(int)) * time.Second
+	}
+	if duration, ok := d.GetOk("lockout_duration"); ok {
+		config.LockoutDuration = time.Duration(duration.(int)) * time.Second
+	}
+
+	switch {
+	case config.PasswordMinLength < 0:
+		return logical.ErrorResponse("password_min_length must not be negative"), nil
+	case config.PasswordHistory < 0:
+		return logical.ErrorResponse("password_history must not be negative"), nil
+	case config.LockoutThreshold < 0:
+		return logical.ErrorResponse("lockout_threshold must not be negative"), nil
+	case config.LockoutWindow < 0:
+		return logical.ErrorResponse("lockout_window must not be negative"), nil
+	case config.LockoutDuration < 0:
+		return logical.ErrorResponse("lockout_duration must not be negative"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// config returns the configuration of the backend, or the default
+// configuration if none was written
+func (b *backend) config(ctx context.Context, s logical.Storage) (*config, error) {
+	result := &config{
+		LockoutWindow:   defaultLockoutWindow,
+		LockoutDuration: defaultLockoutDuration,
+	}
+
+	entry, err := s.Get(ctx, "config")
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(result); err != nil {
+			return nil, errwrap.Wrapf("error reading configuration: {{err}}", err)
+		}
+	}
+
+	return result, nil
+}
+
+type config struct {
+	PasswordMinLength        int  `json:"password_min_length"`
+	PasswordRequireLowercase bool `json:"password_require_lowercase"`
+	PasswordRequireUppercase bool `json:"password_require_uppercase"`
+	PasswordRequireDigits    bool `json:"password_require_digits"`
+	PasswordRequireSymbols   bool `json:"password_require_symbols"`
+
+	// PasswordHistory is the number of most recent passwords, including the
+	// current one, that cannot be reused
+	PasswordHistory int `json:"password_history"`
+
+	LockoutThreshold int           `json:"lockout_threshold"`
+	LockoutWindow    time.Duration `json:"lockout_window"`
+	LockoutDuration  time.Duration `json:"lockout_duration"`
+}
+
+// validatePassword checks the password against the password policy
+func (c *config) validatePassword(password string) error {
+	if utf8.RuneCountInString(password) < c.PasswordMinLength {
+		return fmt.Errorf("password must be at least %d characters long", c.PasswordMinLength)
+	}
+
+	var lowercase, uppercase, digits, symbols bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lowercase = true
+		case unicode.IsUpper(r):
+			uppercase = true
+		case unicode.IsDigit(r):
+			digits = true
+		case !unicode.IsLetter(r):
+			symbols = true
+		}
+	}
+
+	switch {
+	case c.PasswordRequireLowercase && !lowercase:
+		return fmt.Errorf("password must contain a lowercase letter")
+	case c.PasswordRequireUppercase && !uppercase:
+		return fmt.Errorf("password must contain an uppercase letter")
+	case c.PasswordRequireDigits && !digits:
+		return fmt.Errorf("password must contain a digit")
+	case c.PasswordRequireSymbols && !symbols:
+		return fmt.Errorf("password must contain a character that is neither a letter nor a digit")
+	}
+
+	return nil
+}
+
+const pathConfigHelpSyn = `
+Configure password policies and lockouts.
+`
+
+const pathConfigHelpDesc = `
+This endpoint configures the strength requirements of passwords, the number
+of previous passwords that cannot be reused, and the lockout of usernames
+after repeated failed login attempts.
+
+Password requirements apply when passwords are set, and do not affect
+existing passwords.
+`
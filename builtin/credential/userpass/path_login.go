@@ -2,15 +2,15 @@ package userpass
 
 import (
 	"context"
-	"crypto/subtle"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/helper/cidrutil"
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func pathLogin(b *backend) *framework.Path {
@@ -61,30 +61,62 @@ func (b *backend) pathLogin(ctx context.Context, req *logical.Request, d *framew
 		return nil, fmt.Errorf("missing password")
 	}
 
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// With lockouts enabled, the attempts of a username are serialized for
+	// the whole check so that concurrent guesses cannot exceed the threshold
+	if config.LockoutThreshold > 0 {
+		lock := locksutil.LockForKey(b.lockoutLocks, username)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
 	// Get the user and validate auth
 	user, err := b.user(ctx, req.Storage, username)
 	if err != nil {
 		return nil, err
 	}
-	if user == nil {
+
+	var lockout *lockoutEntry
+	if config.LockoutThreshold > 0 {
+		lockout, err = b.lockoutEntry(ctx, req.Storage, username)
+		if err != nil {
+			return nil, err
+		}
+		if lockout != nil && lockout.locked(config, time.Now()) {
+			b.Logger().Info("login attempt of locked out user", "username", username, "failed_login_attempts", lockout.FailedAttempts)
+			return logical.ErrorResponse("user is locked out"), nil
+		}
+	}
+
+	loginFailed := func() (*logical.Response, error) {
+		if config.LockoutThreshold > 0 {
+			if err := b.recordFailedLogin(ctx, req.Storage, config, username, user != nil, lockout); err != nil {
+				return nil, err
+			}
+		}
 		return logical.ErrorResponse("invalid username or password"), nil
 	}
 
+	if user == nil {
+		return loginFailed()
+	}
+
 	// Check for a CIDR match.
 	if !cidrutil.RemoteAddrIsOk(req.Connection.RemoteAddr, user.BoundCIDRs) {
 		return logical.ErrorResponse("login request originated from invalid CIDR"), nil
 	}
 
-	// Check for a password match. Check for a hash collision for Vault 0.2+,
-	// but handle the older legacy passwords with a constant time comparison.
-	passwordBytes := []byte(password)
-	if user.PasswordHash != nil {
-		if err := bcrypt.CompareHashAndPassword(user.PasswordHash, passwordBytes); err != nil {
-			return logical.ErrorResponse("invalid username or password"), nil
-		}
-	} else {
-		if subtle.ConstantTimeCompare([]byte(user.Password), passwordBytes) != 1 {
-			return logical.ErrorResponse("invalid username or password"), nil
+	if !user.passwordMatches(password) {
+		return loginFailed()
+	}
+
+	if lockout != nil {
+		if err := req.Storage.Delete(ctx, lockoutPrefix+username); err != nil {
+			return nil, err
 		}
 	}
 
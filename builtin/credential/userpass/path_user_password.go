@@ -2,6 +2,7 @@ package userpass
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 
 	"golang.org/x/crypto/bcrypt"
@@ -45,10 +46,15 @@ func (b *backend) pathUserPasswordUpdate(ctx context.Context, req *logical.Reque
 		return nil, fmt.Errorf("username does not exist")
 	}
 
-	userErr, intErr := b.updateUserPassword(req, d, userEntry)
-	if intErr != nil {
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
 		return nil, err
 	}
+
+	userErr, intErr := b.updateUserPassword(req, d, userEntry, config)
+	if intErr != nil {
+		return nil, intErr
+	}
 	if userErr != nil {
 		return logical.ErrorResponse(userErr.Error()), logical.ErrInvalidRequest
 	}
@@ -56,24 +62,74 @@ func (b *backend) pathUserPasswordUpdate(ctx context.Context, req *logical.Reque
 	return nil, b.setUser(ctx, req.Storage, username, userEntry)
 }
 
-func (b *backend) updateUserPassword(req *logical.Request, d *framework.FieldData, userEntry *UserEntry) (error, error) {
+func (b *backend) updateUserPassword(req *logical.Request, d *framework.FieldData, userEntry *UserEntry, config *config) (error, error) {
 	password := d.Get("password").(string)
 	if password == "" {
 		return fmt.Errorf("missing password"), nil
 	}
+	if err := config.validatePassword(password); err != nil {
+		return err, nil
+	}
+	if config.PasswordHistory > 0 && userEntry.passwordReused(password, config.PasswordHistory) {
+		return fmt.Errorf("password must differ from the last %d passwords", config.PasswordHistory), nil
+	}
+
 	// Generate a hash of the password
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
+
+	// Keep only the hashes of the previous passwords needed to enforce the
+	// history, the current password being the most recent one
+	var history [][]byte
+	if config.PasswordHistory > 1 {
+		if userEntry.PasswordHash != nil {
+			history = append(history, userEntry.PasswordHash)
+		}
+		history = append(history, userEntry.PasswordHistory...)
+		if len(history) > config.PasswordHistory-1 {
+			history = history[:config.PasswordHistory-1]
+		}
+	}
+
 	userEntry.PasswordHash = hash
+	userEntry.PasswordHistory = history
 	return nil, nil
 }
 
+// passwordMatches checks the password of the user. Check for a hash collision
+// for Vault 0.2+, but handle the older legacy passwords with a constant time
+// comparison.
+func (u *UserEntry) passwordMatches(password string) bool {
+	if u.PasswordHash != nil {
+		return bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+}
+
+// passwordReused returns whether the password is one of the last n passwords
+// of the user
+func (u *UserEntry) passwordReused(password string, n int) bool {
+	if (u.PasswordHash != nil || u.Password != "") && u.passwordMatches(password) {
+		return true
+	}
+	for i, hash := range u.PasswordHistory {
+		if i >= n-1 {
+			break
+		}
+		if bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
 const pathUserPasswordHelpSyn = `
 Reset user's password.
 `
 
 const pathUserPasswordHelpDesc = `
-This endpoint allows resetting the user's password.
+This endpoint allows resetting the user's password. The new password must
+satisfy the password policy set through the "config" endpoint.
 `
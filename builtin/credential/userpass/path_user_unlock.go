@@ -0,0 +1,60 @@
+package userpass
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathUserUnlock(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "users/" + framework.GenericNameRegex("username") + "/unlock$",
+		Fields: map[string]*framework.FieldSchema{
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Username for this user.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathUserUnlockUpdate,
+		},
+
+		HelpSynopsis:    pathUserUnlockHelpSyn,
+		HelpDescription: pathUserUnlockHelpDesc,
+	}
+}
+
+func (b *backend) pathUserUnlockUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	username := strings.ToLower(d.Get("username").(string))
+
+	lock := locksutil.LockForKey(b.lockoutLocks, username)
+	lock.Lock()
+	defer lock.Unlock()
+
+	lockout, err := b.lockoutEntry(ctx, req.Storage, username)
+	if err != nil {
+		return nil, err
+	}
+	if lockout == nil {
+		return nil, nil
+	}
+
+	if !lockout.LockedAt.IsZero() {
+		b.Logger().Info("unlocking user", "username", username)
+	}
+
+	return nil, req.Storage.Delete(ctx, lockoutPrefix+username)
+}
+
+const pathUserUnlockHelpSyn = `
+Unlock a user locked out after failed login attempts.
+`
+
+const pathUserUnlockHelpDesc = `
+This endpoint unlocks a username locked out after too many failed login
+attempts, and resets its count of failed login attempts.
+`
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-sockaddr"
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/logical"
@@ -124,16 +125,27 @@ func (b *backend) pathUserList(ctx context.Context, req *logical.Request, d *fra
 }
 
 func (b *backend) pathUserDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete(ctx, "user/"+strings.ToLower(d.Get("username").(string)))
+	username := strings.ToLower(d.Get("username").(string))
+	err := req.Storage.Delete(ctx, "user/"+username)
 	if err != nil {
 		return nil, err
 	}
 
+	// Forget failed login attempts, so that a new user with the same name
+	// starts unlocked
+	lock := locksutil.LockForKey(b.lockoutLocks, username)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := req.Storage.Delete(ctx, lockoutPrefix+username); err != nil {
+		return nil, err
+	}
+
 	return nil, nil
 }
 
 func (b *backend) pathUserRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	user, err := b.user(ctx, req.Storage, strings.ToLower(d.Get("username").(string)))
+	username := strings.ToLower(d.Get("username").(string))
+	user, err := b.user(ctx, req.Storage, username)
 	if err != nil {
 		return nil, err
 	}
@@ -141,12 +153,29 @@ func (b *backend) pathUserRead(ctx context.Context, req *logical.Request, d *fra
 		return nil, nil
 	}
 
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	lockout, err := b.lockoutEntry(ctx, req.Storage, username)
+	if err != nil {
+		return nil, err
+	}
+	var failedAttempts int
+	var locked bool
+	if config.LockoutThreshold > 0 && lockout != nil && !lockout.expired(config, time.Now()) {
+		failedAttempts = lockout.FailedAttempts
+		locked = lockout.locked(config, time.Now())
+	}
+
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"policies":    user.Policies,
-			"ttl":         user.TTL.Seconds(),
-			"max_ttl":     user.MaxTTL.Seconds(),
-			"bound_cidrs": user.BoundCIDRs,
+			"policies":              user.Policies,
+			"ttl":                   user.TTL.Seconds(),
+			"max_ttl":               user.MaxTTL.Seconds(),
+			"bound_cidrs":           user.BoundCIDRs,
+			"failed_login_attempts": failedAttempts,
+			"locked":                locked,
 		},
 	}, nil
 }
@@ -163,10 +192,15 @@ func (b *backend) userCreateUpdate(ctx context.Context, req *logical.Request, d
 	}
 
 	if _, ok := d.GetOk("password"); ok {
-		userErr, intErr := b.updateUserPassword(req, d, userEntry)
-		if intErr != nil {
+		config, err := b.config(ctx, req.Storage)
+		if err != nil {
 			return nil, err
 		}
+
+		userErr, intErr := b.updateUserPassword(req, d, userEntry, config)
+		if intErr != nil {
+			return nil, intErr
+		}
 		if userErr != nil {
 			return logical.ErrorResponse(userErr.Error()), logical.ErrInvalidRequest
 		}
@@ -212,6 +246,10 @@ type UserEntry struct {
 	// used instead of the actual password in Vault 0.2+.
 	PasswordHash []byte
 
+	// PasswordHistory holds the bcrypt hashes of the previous passwords,
+	// most recent first, as needed to enforce the password history
+	PasswordHistory [][]byte
+
 	Policies []string
 
 	// Duration after which the user will be revoked unless renewed
@@ -0,0 +1,612 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	acmeAccountPrefix       = "acme/accounts/"
+	acmeAccountKeyPrefix    = "acme/account-keys/"
+	acmeOrderPrefix         = "acme/orders/"
+	acmeAuthorizationPrefix = "acme/authorizations/"
+	acmeCertPrefix          = "acme/certs/"
+
+	acmeStatusPending     = "pending"
+	acmeStatusReady       = "ready"
+	acmeStatusProcessing  = "processing"
+	acmeStatusValid       = "valid"
+	acmeStatusInvalid     = "invalid"
+	acmeStatusDeactivated = "deactivated"
+	acmeStatusExpired     = "expired"
+	acmeStatusRevoked     = "revoked"
+
+	acmeChallengeHTTP01 = "http-01"
+	acmeChallengeDNS01  = "dns-01"
+
+	acmeNonceLifetime = 15 * time.Minute
+	acmeOrderLifetime = 24 * time.Hour
+
+	// The number of outstanding nonces held; past it the oldest nonces are
+	// dropped, and clients retry their requests with a fresh nonce
+	acmeMaxNonces = 8192
+
+	// Requests of the validation of challenges cannot outlive this
+	acmeValidationTimeout = 10 * time.Second
+)
+
+// Signature algorithms accepted for the requests of ACME clients, which
+// excludes "none" and MACs as required by RFC 8555
+var acmeSignatureAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.RS384): true,
+	string(jose.RS512): true,
+	string(jose.PS256): true,
+	string(jose.PS384): true,
+	string(jose.PS512): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+type acmeAccount struct {
+	ID         string           `json:"id"`
+	Status     string           `json:"status"`
+	Contact    []string         `json:"contact"`
+	Key        *jose.JSONWebKey `json:"key"`
+	Thumbprint string           `json:"thumbprint"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type acmeOrder struct {
+	ID                string           `json:"id"`
+	AccountID         string           `json:"account_id"`
+	Role              string           `json:"role"`
+	Status            string           `json:"status"`
+	Expires           time.Time        `json:"expires"`
+	Identifiers       []acmeIdentifier `json:"identifiers"`
+	AuthorizationIDs  []string         `json:"authorization_ids"`
+	Error             *acmeProblem     `json:"error,omitempty"`
+	CertificateSerial string           `json:"certificate_serial"`
+	Certificate       string           `json:"certificate"`
+}
+
+type acmeAuthorization struct {
+	ID         string           `json:"id"`
+	AccountID  string           `json:"account_id"`
+	OrderID    string           `json:"order_id"`
+	Identifier acmeIdentifier   `json:"identifier"`
+	Wildcard   bool             `json:"wildcard"`
+	Status     string           `json:"status"`
+	Expires    time.Time        `json:"expires"`
+	Challenges []*acmeChallenge `json:"challenges"`
+}
+
+type acmeChallenge struct {
+	Type      string       `json:"type"`
+	Token     string       `json:"token"`
+	Status    string       `json:"status"`
+	Validated time.Time    `json:"validated"`
+	Error     *acmeProblem `json:"error,omitempty"`
+}
+
+// acmeCertEntry links an issued certificate to its order, for revocation
+type acmeCertEntry struct {
+	AccountID string `json:"account_id"`
+	OrderID   string `json:"order_id"`
+}
+
+// acmeProblem is an error reported to ACME clients as a problem document, as
+// described in RFC 7807
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+func (p *acmeProblem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+func acmeError(typ string, status int, format string, args ...interface{}) *acmeProblem {
+	return &acmeProblem{
+		Type:   "urn:ietf:params:acme:error:" + typ,
+		Detail: fmt.Sprintf(format, args...),
+		Status: status,
+	}
+}
+
+// acmeRequest is an authenticated request of an ACME client
+type acmeRequest struct {
+	*logical.Request
+
+	config  *acmeConfig
+	account *acmeAccount
+	jwk     *jose.JSONWebKey
+	payload []byte
+}
+
+// postAsGet returns whether the request is a POST-as-GET request, which has an
+// empty payload
+func (r *acmeRequest) postAsGet() bool {
+	return len(r.payload) == 0
+}
+
+// acmeResult is the response to an ACME request
+type acmeResult struct {
+	status      int
+	body        interface{}
+	contentType string
+	rawBody     []byte
+	location    string
+	links       []string
+}
+
+// acmeNonces holds the nonces handed to ACME clients, each of which can be
+// used by a single request. At most acmeMaxNonces are held, so that clients
+// requesting nonces without using them cannot exhaust memory.
+type acmeNonces struct {
+	sync.Mutex
+	nonces *lru.Cache
+}
+
+func newACMENonces() *acmeNonces {
+	nonces, _ := lru.New(acmeMaxNonces)
+	return &acmeNonces{
+		nonces: nonces,
+	}
+}
+
+func (n *acmeNonces) issue() (string, error) {
+	nonce, err := acmeRandomToken()
+	if err != nil {
+		return "", err
+	}
+	n.nonces.Add(nonce, time.Now().Add(acmeNonceLifetime))
+	return nonce, nil
+}
+
+func (n *acmeNonces) redeem(nonce string) bool {
+	n.Lock()
+	defer n.Unlock()
+
+	expires, ok := n.nonces.Peek(nonce)
+	if !ok {
+		return false
+	}
+	n.nonces.Remove(nonce)
+	return time.Now().Before(expires.(time.Time))
+}
+
+func acmeRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// acmeURL returns the URL of the given path of the ACME server
+func acmeURL(config *acmeConfig, path ...string) string {
+	return config.BaseURL + "/acme/" + strings.Join(path, "/")
+}
+
+// acmeResponse builds the raw response to an ACME request, which carries a
+// fresh nonce as all responses of the ACME server
+func (b *backend) acmeResponse(config *acmeConfig, result *acmeResult) (*logical.Response, error) {
+	nonce, err := b.acmeNonces.issue()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string][]string{
+		"Replay-Nonce":  []string{nonce},
+		"Cache-Control": []string{"no-store"},
+	}
+	if config.BaseURL != "" {
+		headers["Link"] = []string{fmt.Sprintf("<%s>;rel=\"index\"", acmeURL(config, "directory"))}
+	}
+	if result.location != "" {
+		headers["Location"] = []string{result.location}
+	}
+	for _, link := range result.links {
+		headers["Link"] = append(headers["Link"], link)
+	}
+
+	body := result.rawBody
+	contentType := result.contentType
+	if result.body != nil {
+		body, err = json.Marshal(result.body)
+		if err != nil {
+			return nil, err
+		}
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+
+	// Responses without a body, such as those of revocations, are sent
+	// without content type
+	data := map[string]interface{}{
+		logical.HTTPStatusCode:  result.status,
+		logical.HTTPHeaders:     headers,
+		logical.HTTPContentType: contentType,
+		logical.HTTPRawBody:     body,
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+// acmeProblemResponse reports the error to the ACME client. Errors other than
+// problems are logged and reported as internal errors.
+func (b *backend) acmeProblemResponse(config *acmeConfig, err error) (*logical.Response, error) {
+	problem, ok := err.(*acmeProblem)
+	if !ok {
+		switch err.(type) {
+		case errutil.UserError:
+			problem = acmeError("malformed", http.StatusBadRequest, "%s", err)
+		default:
+			b.Logger().Error("error serving ACME request", "error", err)
+			problem = acmeError("serverInternal", http.StatusInternalServerError, "internal error")
+		}
+	}
+
+	return b.acmeResponse(config, &acmeResult{
+		status:      problem.Status,
+		body:        problem,
+		contentType: "application/problem+json",
+	})
+}
+
+// acmeProtectedHeader is the protected header of the JWS of ACME requests.
+// It is decoded separately from the verification of the JWS, so that the
+// fields used to authenticate requests are only read from the protected
+// header.
+type acmeProtectedHeader struct {
+	Algorithm string          `json:"alg"`
+	Nonce     string          `json:"nonce"`
+	URL       string          `json:"url"`
+	KeyID     string          `json:"kid"`
+	JWK       json.RawMessage `json:"jwk"`
+}
+
+// acmeVerifyRequest authenticates the JWS of the request. Requests creating
+// accounts carry the key of the account in the "jwk" header, while others
+// reference their account with the "kid" header; revocation requests may use
+// either, which is allowed by allowJWK and requireJWK.
+func (b *backend) acmeVerifyRequest(ctx context.Context, req *logical.Request, config *acmeConfig, allowJWK, requireJWK bool) (*acmeRequest, error) {
+	fields := make(map[string]string, 3)
+	for _, k := range []string{"protected", "payload", "signature"} {
+		v, ok := req.Data[k].(string)
+		if !ok {
+			return nil, acmeError("malformed", http.StatusBadRequest, "request must be a JWS using the flattened JSON serialization")
+		}
+		fields[k] = v
+	}
+	if _, ok := req.Data["header"]; ok {
+		return nil, acmeError("malformed", http.StatusBadRequest, "JWS must not have an unprotected header")
+	}
+
+	protectedBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(fields["protected"], "="))
+	if err != nil {
+		return nil, acmeError("malformed", http.StatusBadRequest, "unable to decode protected header: %s", err)
+	}
+	var header acmeProtectedHeader
+	if err := json.Unmarshal(protectedBytes, &header); err != nil {
+		return nil, acmeError("malformed", http.StatusBadRequest, "unable to decode protected header: %s", err)
+	}
+
+	if !acmeSignatureAlgorithms[header.Algorithm] {
+		return nil, acmeError("badSignatureAlgorithm", http.StatusBadRequest, "unsupported signature algorithm %q", header.Algorithm)
+	}
+	if expected := config.BaseURL + "/" + req.Path; header.URL != expected {
+		return nil, acmeError("unauthorized", http.StatusUnauthorized, "URL of the JWS %q does not match the requested URL %q", header.URL, expected)
+	}
+
+	jwsBody, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	jws, err := jose.ParseSigned(string(jwsBody))
+	if err != nil {
+		return nil, acmeError("malformed", http.StatusBadRequest, "unable to parse JWS: %s", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, acmeError("malformed", http.StatusBadRequest, "JWS must have a single signature")
+	}
+
+	r := &acmeRequest{
+		Request: req,
+		config:  config,
+	}
+
+	switch {
+	case len(header.JWK) > 0 && header.KeyID != "":
+		return nil, acmeError("malformed", http.StatusBadRequest, `JWS must not have both "jwk" and "kid" headers`)
+
+	case len(header.JWK) > 0:
+		if !allowJWK {
+			return nil, acmeError("malformed", http.StatusBadRequest, `requests to this endpoint must reference their account with the "kid" header`)
+		}
+		r.jwk = &jose.JSONWebKey{}
+		if err := json.Unmarshal(header.JWK, r.jwk); err != nil {
+			return nil, acmeError("malformed", http.StatusBadRequest, "unable to parse JWK: %s", err)
+		}
+		if !r.jwk.Valid() || !r.jwk.IsPublic() {
+			return nil, acmeError("malformed", http.StatusBadRequest, "JWK must be a valid public key")
+		}
+
+	case header.KeyID != "":
+		if requireJWK {
+			return nil, acmeError("malformed", http.StatusBadRequest, `requests to this endpoint must carry their key in the "jwk" header`)
+		}
+		accountPrefix := acmeURL(config, "account") + "/"
+		if !strings.HasPrefix(header.KeyID, accountPrefix) {
+			return nil, acmeError("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		account, err := b.acmeFetchAccount(ctx, req.Storage, strings.TrimPrefix(header.KeyID, accountPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			return nil, acmeError("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		if account.Status != acmeStatusValid {
+			return nil, acmeError("unauthorized", http.StatusUnauthorized, "account is %s", account.Status)
+		}
+		r.account = account
+		r.jwk = account.Key
+
+	default:
+		return nil, acmeError("malformed", http.StatusBadRequest, `JWS must have either a "jwk" or a "kid" header`)
+	}
+
+	payload, err := jws.Verify(r.jwk.Key)
+	if err != nil {
+		return nil, acmeError("malformed", http.StatusBadRequest, "invalid JWS signature")
+	}
+
+	// The nonce is checked last, so that only authenticated requests use up
+	// nonces
+	if header.Nonce == "" || !b.acmeNonces.redeem(header.Nonce) {
+		return nil, acmeError("badNonce", http.StatusBadRequest, "invalid or expired nonce")
+	}
+
+	r.payload = payload
+	return r, nil
+}
+
+// decodePayload decodes the JSON payload of the request
+func (r *acmeRequest) decodePayload(out interface{}) error {
+	if r.postAsGet() {
+		return nil
+	}
+	if err := json.Unmarshal(r.payload, out); err != nil {
+		return acmeError("malformed", http.StatusBadRequest, "unable to decode payload: %s", err)
+	}
+	return nil
+}
+
+// keyAuthorization returns the key authorization of the challenge token for
+// the account key, as described in section 8.1 of RFC 8555
+func keyAuthorization(token string, key *jose.JSONWebKey) (string, error) {
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return token + "." + base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+func acmeGet(ctx context.Context, s logical.Storage, key string, out interface{}) (bool, error) {
+	entry, err := s.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+	if err := entry.DecodeJSON(out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func acmePut(ctx context.Context, s logical.Storage, key string, v interface{}) error {
+	entry, err := logical.StorageEntryJSON(key, v)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func (b *backend) acmeFetchAccount(ctx context.Context, s logical.Storage, id string) (*acmeAccount, error) {
+	var account acmeAccount
+	ok, err := acmeGet(ctx, s, acmeAccountPrefix+id, &account)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (b *backend) acmeFetchOrder(ctx context.Context, s logical.Storage, id string) (*acmeOrder, error) {
+	var order acmeOrder
+	ok, err := acmeGet(ctx, s, acmeOrderPrefix+id, &order)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (b *backend) acmeFetchAuthorization(ctx context.Context, s logical.Storage, id string) (*acmeAuthorization, error) {
+	var authz acmeAuthorization
+	ok, err := acmeGet(ctx, s, acmeAuthorizationPrefix+id, &authz)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if authz.Status == acmeStatusPending && time.Now().After(authz.Expires) {
+		authz.Status = acmeStatusExpired
+	}
+	return &authz, nil
+}
+
+// acmeUpdateOrderStatus moves pending orders to ready once all of their
+// authorizations are valid, or to invalid once one of them cannot be.
+func (b *backend) acmeUpdateOrderStatus(ctx context.Context, s logical.Storage, order *acmeOrder) error {
+	if order.Status != acmeStatusPending && order.Status != acmeStatusReady {
+		return nil
+	}
+
+	status := order.Status
+	switch {
+	case time.Now().After(order.Expires):
+		status = acmeStatusInvalid
+		order.Error = acmeError("unauthorized", http.StatusForbidden, "order expired")
+
+	case order.Status == acmeStatusPending:
+		status = acmeStatusReady
+		for _, id := range order.AuthorizationIDs {
+			authz, err := b.acmeFetchAuthorization(ctx, s, id)
+			if err != nil {
+				return err
+			}
+			if authz == nil {
+				return fmt.Errorf("authorization %s of order %s not found", id, order.ID)
+			}
+			switch authz.Status {
+			case acmeStatusValid:
+			case acmeStatusPending:
+				status = acmeStatusPending
+			default:
+				status = acmeStatusInvalid
+				order.Error = acmeError("unauthorized", http.StatusForbidden, "authorization of %s is %s", authz.Identifier.Value, authz.Status)
+			}
+			if status == acmeStatusInvalid {
+				break
+			}
+		}
+	}
+
+	if status == order.Status {
+		return nil
+	}
+	order.Status = status
+	return acmePut(ctx, s, acmeOrderPrefix+order.ID, order)
+}
+
+// acmeTXTResolver looks up the TXT records of dns-01 challenges. It is
+// implemented by net.Resolver.
+type acmeTXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+func (b *backend) acmeResolver(config *acmeConfig) acmeTXTResolver {
+	if b.acmeTXTResolver != nil {
+		return b.acmeTXTResolver
+	}
+	if config.DNSResolver == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, config.DNSResolver)
+		},
+	}
+}
+
+func (b *backend) acmeValidationClient() *http.Client {
+	if b.acmeHTTPClient != nil {
+		return b.acmeHTTPClient
+	}
+	return &http.Client{
+		Timeout: acmeValidationTimeout,
+	}
+}
+
+// acmeValidateChallenge checks that the client fulfilled the challenge for
+// the identifier of the authorization, returning a problem otherwise
+func (b *backend) acmeValidateChallenge(ctx context.Context, config *acmeConfig, authz *acmeAuthorization, challenge *acmeChallenge, key *jose.JSONWebKey) error {
+	keyAuth, err := keyAuthorization(challenge.Token, key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, acmeValidationTimeout)
+	defer cancel()
+
+	domain := authz.Identifier.Value
+	switch challenge.Type {
+	case acmeChallengeHTTP01:
+		url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", domain, challenge.Token)
+		httpReq, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := b.acmeValidationClient().Do(httpReq.WithContext(ctx))
+		if err != nil {
+			return acmeError("connection", http.StatusBadRequest, "unable to fetch %s: %s", url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return acmeError("unauthorized", http.StatusForbidden, "unexpected status fetching %s: %d", url, resp.StatusCode)
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		if err != nil {
+			return acmeError("connection", http.StatusBadRequest, "unable to read %s: %s", url, err)
+		}
+		if strings.TrimSpace(string(body)) != keyAuth {
+			return acmeError("incorrectResponse", http.StatusForbidden, "key authorization served at %s does not match", url)
+		}
+
+	case acmeChallengeDNS01:
+		name := "_acme-challenge." + domain
+		records, err := b.acmeResolver(config).LookupTXT(ctx, name)
+		if err != nil {
+			return acmeError("dns", http.StatusBadRequest, "unable to look up TXT records of %s: %s", name, err)
+		}
+		digest := sha256.Sum256([]byte(keyAuth))
+		expected := base64.RawURLEncoding.EncodeToString(digest[:])
+		found := false
+		for _, record := range records {
+			if record == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return acmeError("incorrectResponse", http.StatusForbidden, "no TXT record of %s matches the key authorization", name)
+		}
+
+	default:
+		return errwrap.Wrapf("unable to validate challenge: {{err}}", fmt.Errorf("unsupported type %q", challenge.Type))
+	}
+
+	return nil
+}
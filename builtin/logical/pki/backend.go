@@ -2,10 +2,13 @@ package pki
 
 import (
 	"context"
+	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -23,7 +26,8 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 func Backend() *backend {
 	var b backend
 	b.Backend = &framework.Backend{
-		Help: strings.TrimSpace(backendHelp),
+		Help:         strings.TrimSpace(backendHelp),
+		PeriodicFunc: b.periodicFunc,
 
 		PathsSpecial: &logical.Paths{
 			Unauthenticated: []string{
@@ -33,12 +37,23 @@ func Backend() *backend {
 				"ca",
 				"crl/pem",
 				"crl",
+				"crl/delta",
+				"crl/delta/pem",
+				"ocsp",
+				"ocsp/*",
+				"issuer/*",
+				"acme/*",
 			},
 
 			LocalStorage: []string{
 				"revoked/",
 				"crl",
+				"crls/",
+				"delta-crls/",
+				"delta-wal/",
 				"certs/",
+				"acme/",
+				"tidy-state",
 			},
 
 			Root: []string{
@@ -48,6 +63,7 @@ func Backend() *backend {
 
 			SealWrapStorage: []string{
 				"config/ca_bundle",
+				"config/key/",
 			},
 		},
 
@@ -55,12 +71,21 @@ func Backend() *backend {
 			pathListRoles(&b),
 			pathRoles(&b),
 			pathGenerateRoot(&b),
+			pathRotateRoot(&b),
 			pathSignIntermediate(&b),
 			pathSignSelfIssued(&b),
 			pathDeleteRoot(&b),
 			pathGenerateIntermediate(&b),
 			pathSetSignedIntermediate(&b),
+			pathCrossSignIntermediate(&b),
 			pathConfigCA(&b),
+			pathConfigIssuers(&b),
+			pathListIssuers(&b),
+			pathIssuers(&b),
+			pathListKeys(&b),
+			pathKeys(&b),
+			pathFetchIssuer(&b),
+			pathFetchIssuerCRL(&b),
 			pathConfigCRL(&b),
 			pathConfigURLs(&b),
 			pathSignVerbatim(&b),
@@ -70,11 +95,28 @@ func Backend() *backend {
 			pathFetchCA(&b),
 			pathFetchCAChain(&b),
 			pathFetchCRL(&b),
+			pathFetchDeltaCRL(&b),
 			pathFetchCRLViaCertPath(&b),
 			pathFetchValid(&b),
 			pathFetchListCerts(&b),
 			pathRevoke(&b),
+			pathOCSP(&b),
+			pathOCSPViaGet(&b),
 			pathTidy(&b),
+			pathTidyStatus(&b),
+			pathConfigAutoTidy(&b),
+			pathConfigACME(&b),
+			pathACMEDirectory(&b),
+			pathACMENewNonce(&b),
+			pathACMENewAccount(&b),
+			pathACMEAccount(&b),
+			pathACMENewOrder(&b),
+			pathACMEOrder(&b),
+			pathACMEFinalize(&b),
+			pathACMEAuthorization(&b),
+			pathACMEChallenge(&b),
+			pathACMECert(&b),
+			pathACMERevokeCert(&b),
 		},
 
 		Secrets: []*framework.Secret{
@@ -84,7 +126,7 @@ func Backend() *backend {
 		BackendType: logical.TypeLogical,
 	}
 
-	b.crlLifetime = time.Hour * 72
+	b.acmeNonces = newACMENonces()
 
 	return &b
 }
@@ -92,8 +134,148 @@ func Backend() *backend {
 type backend struct {
 	*framework.Backend
 
-	crlLifetime       time.Duration
 	revokeStorageLock sync.RWMutex
+
+	// crlBuildLock serializes the builds of the CRLs, which share their
+	// numbers
+	crlBuildLock sync.Mutex
+
+	// tidyCASGuard prevents concurrent tidy operations, whose progress is
+	// held by tidyStatus
+	tidyCASGuard   uint32
+	tidyStatusLock sync.RWMutex
+	tidyStatus     *tidyStatus
+
+	// issuersLock serializes changes to the issuers and keys, while
+	// migrationLock and issuersMigrated guard the migration of the legacy
+	// CA bundle
+	issuersLock     sync.Mutex
+	migrationLock   sync.Mutex
+	issuersMigrated uint32
+
+	// acmeNonces holds the nonces of the ACME server, and acmeLock serializes
+	// changes to the state of its accounts and orders. acmeHTTPClient and
+	// acmeTXTResolver replace the clients validating challenges in tests.
+	acmeNonces      *acmeNonces
+	acmeLock        sync.Mutex
+	acmeHTTPClient  *http.Client
+	acmeTXTResolver acmeTXTResolver
+}
+
+// periodicFunc performs the tasks that the backend wishes to do periodically.
+// Currently this will be triggered once in a minute by the RollbackManager.
+//
+// With "auto_rebuild" set in config/crl, the CRLs are rebuilt once they are
+// about to expire and the delta CRLs, if enabled, when certificates were
+// revoked since their last build. The tidy operation configured with
+// config/auto-tidy is also started from here.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if err := b.periodicRebuildCRLs(ctx, req); err != nil {
+		return err
+	}
+
+	return b.periodicTidy(ctx, req, time.Now())
+}
+
+func (b *backend) periodicRebuildCRLs(ctx context.Context, req *logical.Request) error {
+	crlInfo, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	if !crlInfo.AutoRebuild {
+		return nil
+	}
+
+	expiry, gracePeriod, deltaInterval, err := crlInfo.durations()
+	if err != nil {
+		return err
+	}
+
+	state, err := getCRLState(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if state.LastFullBuild.IsZero() || !now.Before(state.LastFullBuild.Add(expiry-gracePeriod)) {
+		b.revokeStorageLock.Lock()
+		defer b.revokeStorageLock.Unlock()
+
+		switch err := buildCRL(ctx, b, req); err.(type) {
+		case nil, errutil.UserError:
+			// The mount may not hold a CA yet
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if !crlInfo.EnableDelta || now.Before(state.LastDeltaBuild.Add(deltaInterval)) {
+		return nil
+	}
+
+	revokedSerials, err := req.Storage.List(ctx, deltaWALPrefix)
+	if err != nil {
+		return err
+	}
+	if len(revokedSerials) == state.DeltaEntries {
+		return nil
+	}
+
+	b.revokeStorageLock.RLock()
+	defer b.revokeStorageLock.RUnlock()
+
+	switch err := buildDeltaCRL(ctx, b, req); err.(type) {
+	case nil, errutil.UserError:
+		return nil
+	default:
+		return err
+	}
+}
+
+// periodicTidy starts the automatic tidy operation if the configured interval
+// elapsed at the given time since the last one, whose start is kept in
+// storage so that restarts and leadership changes do not reset the interval
+func (b *backend) periodicTidy(ctx context.Context, req *logical.Request, now time.Time) error {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	if !config.Enabled {
+		return nil
+	}
+
+	state, err := getTidyState(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	if !state.LastAutoTidy.IsZero() && now.Before(state.LastAutoTidy.Add(time.Duration(config.Interval)*time.Second)) {
+		return nil
+	}
+
+	if !atomic.CompareAndSwapUint32(&b.tidyCASGuard, 0, 1) {
+		// A manual tidy is running, try again on the next call
+		return nil
+	}
+
+	state.LastAutoTidy = now
+	if err := setTidyState(ctx, req.Storage, state); err != nil {
+		atomic.StoreUint32(&b.tidyCASGuard, 0)
+		return err
+	}
+
+	b.startTidyStatus("auto", config.SafetyBuffer, config.TidyCertStore, config.TidyRevocationList)
+	go func() {
+		defer atomic.StoreUint32(&b.tidyCASGuard, 0)
+
+		_, err := b.tidy(ctx, req, now, config.SafetyBuffer, config.TidyCertStore, config.TidyRevocationList)
+		b.finishTidyStatus(err)
+		if err != nil {
+			b.Logger().Error("error running automatic tidy", "error", err)
+		}
+	}()
+
+	return nil
 }
 
 const backendHelp = `
@@ -101,4 +283,11 @@ The PKI backend dynamically generates X509 server and client certificates.
 
 After mounting this backend, configure the CA using the "pem_bundle" endpoint within
 the "config/" path.
+
+A mount can hold several CAs, called issuers, listed under "issuers/". Roles
+reference the issuer signing their certificates, and the default issuer can be
+switched with the "config/issuers" endpoint.
+
+The mount can also serve certificates to ACME clients, as described in RFC 8555,
+once enabled with the "config/acme" endpoint.
 `
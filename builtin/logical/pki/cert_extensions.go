@@ -0,0 +1,347 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+)
+
+var (
+	oidExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidPolicyQualifierCPS           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	oidPolicyQualifierUserNotice    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+
+	// Extensions under these arcs are set by the backend itself or affect
+	// the validation of the certificate path, and cannot be templated
+	reservedExtensionArcs = []asn1.ObjectIdentifier{
+		// id-ce, e.g. basic constraints, key usages, SANs, name constraints
+		// and certificate policies
+		asn1.ObjectIdentifier{2, 5, 29},
+		// Authority and subject information access
+		asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1},
+		asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 11},
+	}
+
+	extensionTemplatePlaceholderRegex = regexp.MustCompile(`{{[^}]*}}`)
+)
+
+const (
+	// RFC 5280 section 4.2.1.4 limits explicit texts to 200 characters
+	maxPolicyNoticeLength = 200
+
+	maxExtensionTemplateValueLength = 1024
+)
+
+// policyInformation is a certificate policy set by a role, with its optional
+// CPS URI and user notice qualifiers
+type policyInformation struct {
+	OID    string `json:"oid" mapstructure:"oid" structs:"oid"`
+	CPS    string `json:"cps,omitempty" mapstructure:"cps" structs:"cps"`
+	Notice string `json:"notice,omitempty" mapstructure:"notice" structs:"notice"`
+}
+
+// extensionTemplate is a non-critical extension added by a role to the
+// certificates it issues. Values of the string types can reference the
+// {{common_name}}, {{serial_number}} and {{issuer_id}} of the certificate.
+type extensionTemplate struct {
+	OID   string `json:"oid" mapstructure:"oid" structs:"oid"`
+	Type  string `json:"type" mapstructure:"type" structs:"type"`
+	Value string `json:"value" mapstructure:"value" structs:"value"`
+}
+
+type policyInformationASN1 struct {
+	PolicyIdentifier asn1.ObjectIdentifier
+	PolicyQualifiers []policyQualifierInfoASN1 `asn1:"optional,omitempty"`
+}
+
+type policyQualifierInfoASN1 struct {
+	PolicyQualifierID asn1.ObjectIdentifier
+	Qualifier         asn1.RawValue
+}
+
+type userNoticeASN1 struct {
+	ExplicitText string `asn1:"utf8"`
+}
+
+// decodeJSONList decodes the raw value of a field given as a list of
+// objects, either JSON-encoded in a string or as a list, e.g. when written
+// back from a read of the role. It returns false if the raw value is not such
+// a list.
+func decodeJSONList(raw interface{}, out interface{}) (bool, error) {
+	var listJSON []byte
+	switch raw := raw.(type) {
+	case nil:
+		return false, nil
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			return false, nil
+		}
+		listJSON = []byte(raw)
+	default:
+		var err error
+		listJSON, err = json.Marshal(raw)
+		if err != nil {
+			return false, nil
+		}
+		var items []interface{}
+		if err := json.Unmarshal(listJSON, &items); err != nil {
+			return false, nil
+		}
+		for _, item := range items {
+			if _, ok := item.(map[string]interface{}); !ok {
+				return false, nil
+			}
+		}
+	}
+
+	return true, json.Unmarshal(listJSON, out)
+}
+
+// validatePolicies checks the OIDs and qualifiers of certificate policies
+func validatePolicies(policies []policyInformation) error {
+	for _, policy := range policies {
+		if _, err := stringToOid(policy.OID); err != nil {
+			return fmt.Errorf("%q could not be parsed as a valid oid for a policy identifier", policy.OID)
+		}
+		if policy.CPS != "" {
+			cpsURL, err := url.Parse(policy.CPS)
+			if err != nil || (cpsURL.Scheme != "http" && cpsURL.Scheme != "https") || cpsURL.Host == "" {
+				return fmt.Errorf("CPS %q of policy %s is not a valid http or https URL", policy.CPS, policy.OID)
+			}
+			if !isIA5String(policy.CPS) {
+				return fmt.Errorf("CPS %q of policy %s must only contain ASCII characters", policy.CPS, policy.OID)
+			}
+		}
+		if !utf8.ValidString(policy.Notice) || utf8.RuneCountInString(policy.Notice) > maxPolicyNoticeLength {
+			return fmt.Errorf("notice of policy %s must be valid UTF-8 of at most %d characters", policy.OID, maxPolicyNoticeLength)
+		}
+	}
+	return nil
+}
+
+// certificatePoliciesExtension encodes the certificate policies extension
+// with the qualifiers of the policies, which x509.Certificate cannot express
+func certificatePoliciesExtension(policies []policyInformation) (pkix.Extension, error) {
+	var policiesASN1 []policyInformationASN1
+	for _, policy := range policies {
+		oid, err := stringToOid(policy.OID)
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+		policyASN1 := policyInformationASN1{
+			PolicyIdentifier: oid,
+		}
+
+		if policy.CPS != "" {
+			policyASN1.PolicyQualifiers = append(policyASN1.PolicyQualifiers, policyQualifierInfoASN1{
+				PolicyQualifierID: oidPolicyQualifierCPS,
+				Qualifier: asn1.RawValue{
+					Tag:   asn1.TagIA5String,
+					Bytes: []byte(policy.CPS),
+				},
+			})
+		}
+		if policy.Notice != "" {
+			notice, err := asn1.Marshal(userNoticeASN1{ExplicitText: policy.Notice})
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+			policyASN1.PolicyQualifiers = append(policyASN1.PolicyQualifiers, policyQualifierInfoASN1{
+				PolicyQualifierID: oidPolicyQualifierUserNotice,
+				Qualifier:         asn1.RawValue{FullBytes: notice},
+			})
+		}
+
+		policiesASN1 = append(policiesASN1, policyASN1)
+	}
+
+	value, err := asn1.Marshal(policiesASN1)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{
+		Id:    oidExtensionCertificatePolicies,
+		Value: value,
+	}, nil
+}
+
+// validateExtensionTemplates checks that the templates can be encoded, do
+// not overlap and only reference known values
+func validateExtensionTemplates(templates []extensionTemplate) error {
+	seen := map[string]bool{}
+	for _, template := range templates {
+		oid, err := stringToOid(template.OID)
+		if err != nil {
+			return fmt.Errorf("%q could not be parsed as a valid oid for an extension", template.OID)
+		}
+		for _, arc := range reservedExtensionArcs {
+			if len(oid) >= len(arc) && oid[:len(arc)].Equal(arc) {
+				return fmt.Errorf("extension %s is reserved and cannot be set by a template", template.OID)
+			}
+		}
+		if seen[oid.String()] {
+			return fmt.Errorf("extension %s is templated more than once", template.OID)
+		}
+		seen[oid.String()] = true
+
+		switch template.Type {
+		case "utf8", "ia5", "printable":
+			for _, placeholder := range extensionTemplatePlaceholderRegex.FindAllString(template.Value, -1) {
+				switch placeholder {
+				case "{{common_name}}", "{{serial_number}}", "{{issuer_id}}":
+				default:
+					return fmt.Errorf("unknown placeholder %s in the value of extension %s", placeholder, template.OID)
+				}
+			}
+		case "integer", "boolean", "octet", "der":
+			if strings.Contains(template.Value, "{{") {
+				return fmt.Errorf("values of extension %s of type %s cannot hold placeholders", template.OID, template.Type)
+			}
+		default:
+			return fmt.Errorf("unknown type %q of extension %s; valid types are utf8, ia5, printable, integer, boolean, octet and der", template.Type, template.OID)
+		}
+
+		// Placeholders are rendered with values of the expected character
+		// sets; values given by requests are checked again on issuance
+		if _, err := renderExtensionTemplate(template, map[string]string{
+			"{{common_name}}":   "example.com",
+			"{{serial_number}}": "01",
+			"{{issuer_id}}":     "00000000-0000-0000-0000-000000000000",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderExtensionTemplate encodes the extension of the template, replacing
+// the placeholders of its value
+func renderExtensionTemplate(template extensionTemplate, values map[string]string) (pkix.Extension, error) {
+	oid, err := stringToOid(template.OID)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	var value []byte
+	switch template.Type {
+	case "utf8", "ia5", "printable":
+		rendered := extensionTemplatePlaceholderRegex.ReplaceAllStringFunc(template.Value, func(placeholder string) string {
+			return values[placeholder]
+		})
+		if len(rendered) > maxExtensionTemplateValueLength {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s exceeds %d bytes", template.OID, maxExtensionTemplateValueLength)
+		}
+		if template.Type == "ia5" && !isIA5String(rendered) {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s must only contain ASCII characters", template.OID)
+		}
+		value, err = asn1.MarshalWithParams(rendered, template.Type)
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s cannot be encoded as a %s string: %s", template.OID, template.Type, err)
+		}
+
+	case "integer":
+		integer, ok := new(big.Int).SetString(template.Value, 10)
+		if !ok {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s is not a valid integer", template.OID)
+		}
+		value, err = asn1.Marshal(integer)
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+
+	case "boolean":
+		boolean, err := strconv.ParseBool(template.Value)
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s is not a valid boolean", template.OID)
+		}
+		value, err = asn1.Marshal(boolean)
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+
+	case "octet", "der":
+		decoded, err := base64.StdEncoding.DecodeString(template.Value)
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s is not valid base64: %s", template.OID, err)
+		}
+		if len(decoded) > maxExtensionTemplateValueLength {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s exceeds %d bytes", template.OID, maxExtensionTemplateValueLength)
+		}
+		if template.Type == "octet" {
+			value, err = asn1.Marshal(decoded)
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+			break
+		}
+
+		// The value must be a single DER element
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(decoded, &raw)
+		if err != nil || len(rest) > 0 {
+			return pkix.Extension{}, fmt.Errorf("value of extension %s is not a single DER encoded element", template.OID)
+		}
+		value = decoded
+
+	default:
+		return pkix.Extension{}, fmt.Errorf("unknown type %q of extension %s", template.Type, template.OID)
+	}
+
+	return pkix.Extension{
+		Id:    oid,
+		Value: value,
+	}, nil
+}
+
+// addExtensionTemplates adds the extensions templated by the role to the
+// certificate, replacing extensions with the same OID, e.g. copied from a CSR
+func addExtensionTemplates(data *dataBundle, certTemplate *x509.Certificate) error {
+	if len(data.params.ExtensionTemplates) == 0 {
+		return nil
+	}
+
+	values := map[string]string{
+		"{{common_name}}":   certTemplate.Subject.CommonName,
+		"{{serial_number}}": certutil.GetHexFormatted(certTemplate.SerialNumber.Bytes(), ":"),
+	}
+	if data.signingBundle != nil {
+		values["{{issuer_id}}"] = data.signingBundle.IssuerID
+	}
+
+	for _, template := range data.params.ExtensionTemplates {
+		ext, err := renderExtensionTemplate(template, values)
+		if err != nil {
+			return errutil.UserError{Err: err.Error()}
+		}
+
+		extensions := certTemplate.ExtraExtensions[:0]
+		for _, existing := range certTemplate.ExtraExtensions {
+			if !existing.Id.Equal(ext.Id) {
+				extensions = append(extensions, existing)
+			}
+		}
+		certTemplate.ExtraExtensions = append(extensions, ext)
+	}
+	return nil
+}
+
+func isIA5String(s string) bool {
+	for _, r := range s {
+		if r >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,293 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func extensionByOID(t *testing.T, cert *x509.Certificate, oid asn1.ObjectIdentifier) pkix.Extension {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return ext
+		}
+	}
+	t.Fatalf("extension %s not found", oid)
+	return pkix.Extension{}
+}
+
+func signTestCSR(t *testing.T, b *backend, storage logical.Storage, role, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "sign/"+role, map[string]interface{}{
+		"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	})
+	return parseTestCert(t, resp.Data["certificate"].(string))
+}
+
+func TestPki_RolePolicyQualifiers(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "48h",
+	})
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":    "example.com",
+		"allow_subdomains":   true,
+		"key_type":           "ec",
+		"key_bits":           256,
+		"policy_identifiers": `[{"oid": "1.3.6.1.4.1.7.8", "cps": "https://example.com/cps", "notice": "Issued under the example policy"}, {"oid": "1.3.6.1.4.1.44947.1.2.4"}]`,
+	})
+	resp := issuersTestRequest(t, b, storage, logical.ReadOperation, "roles/example", nil)
+	if !reflect.DeepEqual(resp.Data["policy_identifiers"], []string{"1.3.6.1.4.1.7.8", "1.3.6.1.4.1.44947.1.2.4"}) {
+		t.Fatalf("bad: policy_identifiers: %#v", resp.Data["policy_identifiers"])
+	}
+	policies := resp.Data["policy_information"].([]policyInformation)
+	if len(policies) != 2 || policies[0].CPS != "https://example.com/cps" || policies[1].Notice != "" {
+		t.Fatalf("bad: policy_information: %#v", policies)
+	}
+
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+		"common_name": "foo.example.com",
+	})
+	issued := parseTestCert(t, resp.Data["certificate"].(string))
+	signed := signTestCSR(t, b, storage, "example", "bar.example.com")
+
+	for _, cert := range []*x509.Certificate{issued, signed} {
+		if len(cert.PolicyIdentifiers) != 2 || cert.PolicyIdentifiers[0].String() != "1.3.6.1.4.1.7.8" {
+			t.Fatalf("bad: policy identifiers: %v", cert.PolicyIdentifiers)
+		}
+
+		var decoded []policyInformationASN1
+		if _, err := asn1.Unmarshal(extensionByOID(t, cert, oidExtensionCertificatePolicies).Value, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) != 2 || len(decoded[0].PolicyQualifiers) != 2 || len(decoded[1].PolicyQualifiers) != 0 {
+			t.Fatalf("bad: certificate policies: %#v", decoded)
+		}
+		cps := decoded[0].PolicyQualifiers[0]
+		if !cps.PolicyQualifierID.Equal(oidPolicyQualifierCPS) || cps.Qualifier.Tag != asn1.TagIA5String || string(cps.Qualifier.Bytes) != "https://example.com/cps" {
+			t.Fatalf("bad: CPS qualifier: %#v", cps)
+		}
+		notice := decoded[0].PolicyQualifiers[1]
+		var userNotice userNoticeASN1
+		if _, err := asn1.Unmarshal(notice.Qualifier.FullBytes, &userNotice); err != nil {
+			t.Fatal(err)
+		}
+		if !notice.PolicyQualifierID.Equal(oidPolicyQualifierUserNotice) || userNotice.ExplicitText != "Issued under the example policy" {
+			t.Fatalf("bad: user notice qualifier: %#v", userNotice)
+		}
+	}
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":    "example.com",
+		"allow_subdomains":   true,
+		"policy_identifiers": `[{"oid": "1.3.6.1.4.1.7.9", "notice": "Another notice"}]`,
+	})
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "roles/example", nil)
+	if !reflect.DeepEqual(resp.Data["policy_identifiers"], []string{"1.3.6.1.4.1.7.9"}) {
+		t.Fatalf("bad: policy_identifiers: %#v", resp.Data["policy_identifiers"])
+	}
+
+	// Plain OIDs keep using the certificate policies of x509.Certificate
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":    "example.com",
+		"allow_subdomains":   true,
+		"policy_identifiers": "1.2.3.4,1.2.3.5",
+	})
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+		"common_name": "foo.example.com",
+	})
+	if cert := parseTestCert(t, resp.Data["certificate"].(string)); len(cert.PolicyIdentifiers) != 2 {
+		t.Fatalf("bad: policy identifiers: %v", cert.PolicyIdentifiers)
+	}
+
+	for _, policies := range []string{
+		`[{"oid": "not-an-oid"}]`,
+		`[{"oid": "1.2.3.4", "cps": "ftp://example.com/cps"}]`,
+		`[{"oid": "1.2.3.4", "cps": "https://exämple.com/cps"}]`,
+		`[{"oid": "1.2.3.4", "notice": "` + string(make([]byte, 201)) + `"}]`,
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/invalid",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"policy_identifiers": policies,
+			},
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for policies %s: err: %v resp: %#v", policies, err, resp)
+		}
+	}
+}
+
+func TestPki_RoleExtensionTemplates(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "48h",
+	})
+	issuerID := resp.Data["issuer_id"].(string)
+
+	derValue, err := asn1.Marshal([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"extension_templates": `[
+			{"oid": "1.3.6.1.4.1.55555.1", "type": "utf8", "value": "cn={{common_name}} serial={{serial_number}} issuer={{issuer_id}}"},
+			{"oid": "1.3.6.1.4.1.55555.2", "type": "integer", "value": "42"},
+			{"oid": "1.3.6.1.4.1.55555.3", "type": "der", "value": "` + base64.StdEncoding.EncodeToString(derValue) + `"},
+			{"oid": "1.3.6.1.4.1.55555.4", "type": "printable", "value": "Static value"}
+		]`,
+	})
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "roles/example", nil)
+	if templates := resp.Data["extension_templates"].([]extensionTemplate); len(templates) != 4 || templates[1].Value != "42" {
+		t.Fatalf("bad: extension_templates: %#v", templates)
+	}
+
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+		"common_name": "foo.example.com",
+	})
+	issued := parseTestCert(t, resp.Data["certificate"].(string))
+	signed := signTestCSR(t, b, storage, "example", "bar.example.com")
+
+	for _, cert := range []*x509.Certificate{issued, signed} {
+		ext := extensionByOID(t, cert, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1})
+		var text string
+		if _, err := asn1.UnmarshalWithParams(ext.Value, &text, "utf8"); err != nil {
+			t.Fatal(err)
+		}
+		expected := "cn=" + cert.Subject.CommonName + " serial=" + certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":") + " issuer=" + issuerID
+		if ext.Critical || text != expected {
+			t.Fatalf("bad: templated extension: %q, expected %q", text, expected)
+		}
+
+		var integer int
+		if _, err := asn1.Unmarshal(extensionByOID(t, cert, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 2}).Value, &integer); err != nil || integer != 42 {
+			t.Fatalf("bad: integer extension: %d: %v", integer, err)
+		}
+		if ext := extensionByOID(t, cert, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 3}); !reflect.DeepEqual(ext.Value, derValue) {
+			t.Fatalf("bad: DER extension: %x", ext.Value)
+		}
+		extensionByOID(t, cert, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 4})
+	}
+
+	// Templates can be given as a list of objects as well
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"extension_templates": []interface{}{
+			map[string]interface{}{"oid": "1.3.6.1.4.1.55555.5", "type": "boolean", "value": "true"},
+		},
+	})
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "roles/example", nil)
+	if templates := resp.Data["extension_templates"].([]extensionTemplate); len(templates) != 1 || templates[0].Type != "boolean" {
+		t.Fatalf("bad: extension_templates: %#v", templates)
+	}
+
+	for _, templates := range []interface{}{
+		`{"oid": "1.2.3.4"}`,
+		`[{"oid": "2.5.29.19", "type": "der", "value": "MAA="}]`,
+		`[{"oid": "1.3.6.1.5.5.7.1.1", "type": "der", "value": "MAA="}]`,
+		`[{"oid": "1.2.3.4", "type": "utf8", "value": "{{unknown}}"}, {"oid": "1.2.3.5", "type": "utf8", "value": "a"}]`,
+		`[{"oid": "1.2.3.4", "type": "utf8", "value": "a"}, {"oid": "1.2.3.4", "type": "utf8", "value": "b"}]`,
+		`[{"oid": "1.2.3.4", "type": "integer", "value": "{{serial_number}}"}]`,
+		`[{"oid": "1.2.3.4", "type": "ia5", "value": "é"}]`,
+		`[{"oid": "1.2.3.4", "type": "printable", "value": "not@printable"}]`,
+		`[{"oid": "1.2.3.4", "type": "der", "value": "MAAwAA=="}]`,
+		`[{"oid": "1.2.3.4", "type": "raw", "value": "a"}]`,
+		[]interface{}{map[string]interface{}{"oid": "2.5.29.17", "type": "der", "value": "MAA="}},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/invalid",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"extension_templates": templates,
+			},
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for templates %v: err: %v resp: %#v", templates, err, resp)
+		}
+	}
+}
+
+func TestPki_ExcludedDNSDomains(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name":           "myvault.com",
+		"ttl":                   "48h",
+		"permitted_dns_domains": "example.com,.example.com",
+		"excluded_dns_domains":  "internal.example.com",
+	})
+	root := parseTestCert(t, resp.Data["certificate"].(string))
+	if !reflect.DeepEqual(root.ExcludedDNSDomains, []string{"internal.example.com"}) || !reflect.DeepEqual(root.PermittedDNSDomains, []string{"example.com", ".example.com"}) {
+		t.Fatalf("bad: name constraints: permitted %v excluded %v", root.PermittedDNSDomains, root.ExcludedDNSDomains)
+	}
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+		"common_name": "host.example.com",
+	})
+	for _, name := range []string{"internal.example.com", "host.internal.example.com", "Host.Internal.Example.com"} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/example",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"common_name": name,
+			},
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error issuing %s: err: %v resp: %#v", name, err, resp)
+		}
+	}
+}
+
+func TestPki_CheckExcludedDNSDomains(t *testing.T) {
+	ca := &x509.Certificate{
+		ExcludedDNSDomains: []string{"Internal.Example.com", ".Corp.Example.com"},
+	}
+	for name, excluded := range map[string]bool{
+		"internal.example.com":      true,
+		"HOST.INTERNAL.EXAMPLE.COM": true,
+		"host.corp.example.com":     true,
+		"Host.CORP.example.com":     true,
+		"corp.example.com":          false,
+		"Host.Example.com":          false,
+	} {
+		err := checkExcludedDNSDomains(&x509.Certificate{Subject: pkix.Name{CommonName: name}}, ca)
+		if excluded != (err != nil) {
+			t.Fatalf("%s: expected excluded %t, got error %v", name, excluded, err)
+		}
+	}
+}
@@ -63,12 +63,14 @@ type creationParameters struct {
 	KeyUsage                      x509.KeyUsage
 	ExtKeyUsage                   certExtKeyUsage
 	ExtKeyUsageOIDs               []string
-	PolicyIdentifiers             []string
+	Policies                      []policyInformation
+	ExtensionTemplates            []extensionTemplate
 	BasicConstraintsValidForNonCA bool
 
 	// Only used when signing a CA cert
 	UseCSRValues        bool
 	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
 
 	// URLs to encode into the certificate
 	URLs *urlEntries
@@ -79,7 +81,8 @@ type creationParameters struct {
 
 type caInfoBundle struct {
 	certutil.ParsedCertBundle
-	URLs *urlEntries
+	URLs     *urlEntries
+	IssuerID string
 }
 
 func (b *caInfoBundle) GetCAChain() []*certutil.CertBlock {
@@ -163,20 +166,37 @@ func validateKeyTypeLength(keyType string, keyBits int) *logical.Response {
 	return nil
 }
 
-// Fetches the CA info. Unlike other certificates, the CA info is stored
-// in the backend as a CertBundle, because we are storing its private key
-func fetchCAInfo(ctx context.Context, req *logical.Request) (*caInfoBundle, error) {
-	bundleEntry, err := req.Storage.Get(ctx, "config/ca_bundle")
+// Fetches the CA info of the referenced issuer, along with its key and the
+// issuers of the mount completing its chain
+func (b *backend) fetchCAInfo(ctx context.Context, req *logical.Request, issuerRef string) (*caInfoBundle, error) {
+	issuer, err := b.resolveIssuerRef(ctx, req.Storage, issuerRef)
+	if err != nil {
+		return nil, err
+	}
+	if issuer.KeyID == "" {
+		return nil, errutil.UserError{Err: fmt.Sprintf("issuer %s has no private key and cannot sign certificates", issuer.ID)}
+	}
+
+	key, err := b.fetchKey(ctx, req.Storage, issuer.KeyID)
 	if err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch local CA certificate/key: %v", err)}
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch key of issuer %s: %v", issuer.ID, err)}
 	}
-	if bundleEntry == nil {
-		return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+	if key == nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("key %s of issuer %s not found", issuer.KeyID, issuer.ID)}
 	}
 
-	var bundle certutil.CertBundle
-	if err := bundleEntry.DecodeJSON(&bundle); err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode local CA certificate/key: %v", err)}
+	chain, err := b.issuerChain(ctx, req.Storage, issuer)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to build chain of issuer %s: %v", issuer.ID, err)}
+	}
+
+	bundle := &certutil.CertBundle{
+		PrivateKeyType: key.PrivateKeyType,
+		PrivateKey:     key.PrivateKey,
+		Certificate:    issuer.Certificate,
+	}
+	for _, chainIssuer := range chain {
+		bundle.CAChain = append(bundle.CAChain, chainIssuer.Certificate)
 	}
 
 	parsedBundle, err := bundle.ToParsedCertBundle()
@@ -188,7 +208,10 @@ func fetchCAInfo(ctx context.Context, req *logical.Request) (*caInfoBundle, erro
 		return nil, errutil.InternalError{Err: "stored CA information not able to be parsed"}
 	}
 
-	caInfo := &caInfoBundle{*parsedBundle, nil}
+	caInfo := &caInfoBundle{
+		ParsedCertBundle: *parsedBundle,
+		IssuerID:         issuer.ID,
+	}
 
 	entries, err := getURLs(ctx, req)
 	if err != nil {
@@ -207,7 +230,7 @@ func fetchCAInfo(ctx context.Context, req *logical.Request) (*caInfoBundle, erro
 }
 
 // Allows fetching certificates from the backend; it handles the slightly
-// separate pathing for CA, CRL, and revoked certificates.
+// separate pathing for revoked certificates.
 func fetchCertBySerial(ctx context.Context, req *logical.Request, prefix, serial string) (*logical.StorageEntry, error) {
 	var path, legacyPath string
 	var err error
@@ -217,15 +240,9 @@ func fetchCertBySerial(ctx context.Context, req *logical.Request, prefix, serial
 	colonSerial := strings.Replace(strings.ToLower(serial), "-", ":", -1)
 
 	switch {
-	// Revoked goes first as otherwise ca/crl get hardcoded paths which fail if
-	// we actually want revocation info
 	case strings.HasPrefix(prefix, "revoked/"):
 		legacyPath = "revoked/" + colonSerial
 		path = "revoked/" + hyphenSerial
-	case serial == "ca":
-		path = "ca"
-	case serial == "crl":
-		path = "crl"
 	default:
 		legacyPath = "certs/" + colonSerial
 		path = "certs/" + hyphenSerial
@@ -242,11 +259,6 @@ func fetchCertBySerial(ctx context.Context, req *logical.Request, prefix, serial
 		return certEntry, nil
 	}
 
-	// If legacyPath is unset, it's going to be a CA or CRL; return immediately
-	if legacyPath == "" {
-		return nil, nil
-	}
-
 	// Retrieve the old-style path
 	certEntry, err = req.Storage.Get(ctx, legacyPath)
 	if err != nil {
@@ -546,6 +558,7 @@ func generateCert(ctx context.Context,
 		data.params.IsCA = isCA
 
 		data.params.PermittedDNSDomains = data.apiData.Get("permitted_dns_domains").([]string)
+		data.params.ExcludedDNSDomains = data.apiData.Get("excluded_dns_domains").([]string)
 
 		if data.signingBundle == nil {
 			// Generating a self-signed root certificate
@@ -700,6 +713,7 @@ func signCert(b *backend,
 
 	if isCA {
 		data.params.PermittedDNSDomains = data.apiData.Get("permitted_dns_domains").([]string)
+		data.params.ExcludedDNSDomains = data.apiData.Get("excluded_dns_domains").([]string)
 	}
 
 	parsedBundle, err := signCertificate(data)
@@ -960,7 +974,8 @@ func generateCreationBundle(b *backend, data *dataBundle) error {
 		KeyUsage:                      x509.KeyUsage(parseKeyUsages(data.role.KeyUsage)),
 		ExtKeyUsage:                   extUsage,
 		ExtKeyUsageOIDs:               data.role.ExtKeyUsageOIDs,
-		PolicyIdentifiers:             data.role.PolicyIdentifiers,
+		Policies:                      data.role.policies(),
+		ExtensionTemplates:            data.role.ExtensionTemplates,
 		BasicConstraintsValidForNonCA: data.role.BasicConstraintsValidForNonCA,
 	}
 
@@ -1022,13 +1037,27 @@ func addKeyUsages(data *dataBundle, certTemplate *x509.Certificate) {
 
 // addPolicyIdentifiers adds certificate policies extension
 //
-func addPolicyIdentifiers(data *dataBundle, certTemplate *x509.Certificate) {
-	for _, oidstr := range data.params.PolicyIdentifiers {
-		oid, err := stringToOid(oidstr)
+func addPolicyIdentifiers(data *dataBundle, certTemplate *x509.Certificate) error {
+	for _, policy := range data.params.Policies {
+		if policy.CPS != "" || policy.Notice != "" {
+			// x509.Certificate cannot hold the qualifiers, so the whole
+			// extension is encoded here
+			ext, err := certificatePoliciesExtension(data.params.Policies)
+			if err != nil {
+				return err
+			}
+			certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, ext)
+			return nil
+		}
+	}
+
+	for _, policy := range data.params.Policies {
+		oid, err := stringToOid(policy.OID)
 		if err == nil {
 			certTemplate.PolicyIdentifiers = append(certTemplate.PolicyIdentifiers, oid)
 		}
 	}
+	return nil
 }
 
 // addExtKeyUsageOids adds custom extended key usage OIDs to certificate
@@ -1088,17 +1117,24 @@ func createCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 	}
 
 	// This will only be filled in from the generation paths
-	if len(data.params.PermittedDNSDomains) > 0 {
+	if len(data.params.PermittedDNSDomains) > 0 || len(data.params.ExcludedDNSDomains) > 0 {
 		certTemplate.PermittedDNSDomains = data.params.PermittedDNSDomains
+		certTemplate.ExcludedDNSDomains = data.params.ExcludedDNSDomains
 		certTemplate.PermittedDNSDomainsCritical = true
 	}
 
-	addPolicyIdentifiers(data, certTemplate)
+	if err := addPolicyIdentifiers(data, certTemplate); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error encoding certificate policies: %s", err)}
+	}
 
 	addKeyUsages(data, certTemplate)
 
 	addExtKeyUsageOids(data, certTemplate)
 
+	if err := addExtensionTemplates(data, certTemplate); err != nil {
+		return nil, err
+	}
+
 	certTemplate.IssuingCertificateURL = data.params.URLs.IssuingCertificates
 	certTemplate.CRLDistributionPoints = data.params.URLs.CRLDistributionPoints
 	certTemplate.OCSPServer = data.params.URLs.OCSPServers
@@ -1119,6 +1155,10 @@ func createCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 		if err != nil {
 			return nil, errutil.UserError{Err: err.Error()}
 		}
+		err = checkExcludedDNSDomains(certTemplate, caCert)
+		if err != nil {
+			return nil, errutil.UserError{Err: err.Error()}
+		}
 
 		certBytes, err = x509.CreateCertificate(rand.Reader, certTemplate, caCert, result.PrivateKey.Public(), data.signingBundle.PrivateKey)
 	} else {
@@ -1304,12 +1344,18 @@ func signCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 		return nil, errutil.InternalError{Err: errwrap.Wrapf("error marshaling other SANs: {{err}}", err).Error()}
 	}
 
-	addPolicyIdentifiers(data, certTemplate)
+	if err := addPolicyIdentifiers(data, certTemplate); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error encoding certificate policies: %s", err)}
+	}
 
 	addKeyUsages(data, certTemplate)
 
 	addExtKeyUsageOids(data, certTemplate)
 
+	if err := addExtensionTemplates(data, certTemplate); err != nil {
+		return nil, err
+	}
+
 	var certBytes []byte
 
 	certTemplate.IssuingCertificateURL = data.params.URLs.IssuingCertificates
@@ -1334,14 +1380,19 @@ func signCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 		certTemplate.IsCA = false
 	}
 
-	if len(data.params.PermittedDNSDomains) > 0 {
+	if len(data.params.PermittedDNSDomains) > 0 || len(data.params.ExcludedDNSDomains) > 0 {
 		certTemplate.PermittedDNSDomains = data.params.PermittedDNSDomains
+		certTemplate.ExcludedDNSDomains = data.params.ExcludedDNSDomains
 		certTemplate.PermittedDNSDomainsCritical = true
 	}
 	err = checkPermittedDNSDomains(certTemplate, caCert)
 	if err != nil {
 		return nil, errutil.UserError{Err: err.Error()}
 	}
+	err = checkExcludedDNSDomains(certTemplate, caCert)
+	if err != nil {
+		return nil, errutil.UserError{Err: err.Error()}
+	}
 
 	certBytes, err = x509.CreateCertificate(rand.Reader, certTemplate, caCert, data.csr.PublicKey, data.signingBundle.PrivateKey)
 
@@ -1396,6 +1447,28 @@ NameCheck:
 	return fmt.Errorf("name %q disallowed by CA's permitted DNS domains", badName)
 }
 
+func checkExcludedDNSDomains(template, ca *x509.Certificate) error {
+	names := append([]string{template.Subject.CommonName}, template.DNSNames...)
+	for _, name := range names {
+		// DNS names are case-insensitive
+		lowerName := strings.ToLower(name)
+		for _, excl := range ca.ExcludedDNSDomains {
+			excl = strings.ToLower(excl)
+			switch {
+			case strings.HasPrefix(excl, ".") && strings.HasSuffix(lowerName, excl):
+				// .example.com excludes host.example.com but not
+				// example.com
+			case !strings.HasPrefix(excl, ".") && (lowerName == excl || strings.HasSuffix(lowerName, "."+excl)):
+				// example.com excludes example.com and host.example.com
+			default:
+				continue
+			}
+			return fmt.Errorf("name %q disallowed by CA's excluded DNS domains", name)
+		}
+	}
+	return nil
+}
+
 func convertRespToPKCS8(resp *logical.Response) error {
 	privRaw, ok := resp.Data["private_key"]
 	if !ok {
@@ -1,11 +1,18 @@
 package pki
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/hashicorp/errwrap"
@@ -17,10 +24,15 @@ type revocationInfo struct {
 	CertificateBytes  []byte    `json:"certificate_bytes"`
 	RevocationTime    int64     `json:"revocation_time"`
 	RevocationTimeUTC time.Time `json:"revocation_time_utc"`
+
+	// Reason is the reason code of the revocation, as defined in RFC 5280,
+	// with 0 standing for an unspecified reason
+	Reason int `json:"reason,omitempty"`
 }
 
-// Revokes a cert, and tries to be smart about error recovery
-func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial string, fromLease bool) (*logical.Response, error) {
+// Revokes a cert, and tries to be smart about error recovery. The reason is
+// recorded for certificates that were not revoked yet.
+func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial string, reason int, fromLease bool) (*logical.Response, error) {
 	// As this backend is self-contained and this function does not hook into
 	// third parties to manage users or resources, if the mount is tainted,
 	// revocation doesn't matter anyways -- the CRL that would be written will
@@ -87,6 +99,7 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		revInfo.CertificateBytes = certEntry.Value
 		revInfo.RevocationTime = currTime.Unix()
 		revInfo.RevocationTimeUTC = currTime.UTC()
+		revInfo.Reason = reason
 
 		revEntry, err = logical.StorageEntryJSON("revoked/"+normalizeSerial(serial), revInfo)
 		if err != nil {
@@ -100,12 +113,31 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 
 	}
 
-	crlErr := buildCRL(ctx, b, req)
-	switch crlErr.(type) {
-	case errutil.UserError:
-		return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
-	case errutil.InternalError:
-		return nil, errwrap.Wrapf("error encountered during CRL building: {{err}}", crlErr)
+	crlInfo, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return nil, errwrap.Wrapf("error fetching CRL config information: {{err}}", err)
+	}
+
+	if crlInfo.AutoRebuild {
+		// The CRLs are rebuilt periodically; the revocation shows on the next
+		// delta CRLs, if enabled, until then
+		if crlInfo.EnableDelta && !alreadyRevoked {
+			err = req.Storage.Put(ctx, &logical.StorageEntry{
+				Key:   deltaWALPrefix + normalizeSerial(serial),
+				Value: []byte(serial),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error saving revoked certificate to the delta WAL")
+			}
+		}
+	} else {
+		crlErr := buildCRL(ctx, b, req)
+		switch crlErr.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
+		case errutil.InternalError:
+			return nil, errwrap.Wrapf("error encountered during CRL building: {{err}}", crlErr)
+		}
 	}
 
 	resp := &logical.Response{
@@ -119,32 +151,154 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 	return resp, nil
 }
 
-// Builds a CRL by going through the list of revoked certificates and building
-// a new CRL with the stored revocation times and serial numbers.
+const (
+	deltaCRLPrefix = "delta-crls/"
+
+	// deltaWALPrefix holds the serials of the certificates revoked since the
+	// last build of the CRLs, which are listed by the delta CRLs
+	deltaWALPrefix = "delta-wal/"
+
+	crlStatePath = "crl-state"
+)
+
+var (
+	oidExtensionAuthorityKeyID    = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionCRLNumber         = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionReasonCode        = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// crlState tracks the numbers and builds of the CRLs of the mount. Full and
+// delta CRLs share the sequence of numbers, as required by RFC 5280.
+type crlState struct {
+	Number         int64     `json:"number"`
+	FullNumber     int64     `json:"full_number"`
+	LastFullBuild  time.Time `json:"last_full_build"`
+	LastDeltaBuild time.Time `json:"last_delta_build"`
+	DeltaEntries   int       `json:"delta_entries"`
+}
+
+func getCRLState(ctx context.Context, s logical.Storage) (*crlState, error) {
+	entry, err := s.Get(ctx, crlStatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var state crlState
+	if entry != nil {
+		if err := entry.DecodeJSON(&state); err != nil {
+			return nil, err
+		}
+	}
+	return &state, nil
+}
+
+// Builds the CRL of each issuer holding a key by going through the list of
+// revoked certificates and building a new CRL with the stored revocation times
+// and serial numbers of the certificates signed by the issuer. Delta CRLs are
+// reset at the same time, if enabled.
 func buildCRL(ctx context.Context, b *backend, req *logical.Request) error {
-	revokedSerials, err := req.Storage.List(ctx, "revoked/")
+	b.crlBuildLock.Lock()
+	defer b.crlBuildLock.Unlock()
+
+	config, err := b.CRL(ctx, req.Storage)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL config information: %s", err)}
 	}
 
-	revokedCerts := []pkix.RevokedCertificate{}
-	var revInfo revocationInfo
+	if err := buildCRLs(ctx, b, req.Storage, config, false); err != nil {
+		return err
+	}
+
+	if config.EnableDelta {
+		return buildCRLs(ctx, b, req.Storage, config, true)
+	}
+
+	// Delta CRLs of a previous configuration would no longer match the CRLs
+	deltaCRLs, err := req.Storage.List(ctx, deltaCRLPrefix)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error listing delta CRLs: %s", err)}
+	}
+	for _, id := range deltaCRLs {
+		if err := req.Storage.Delete(ctx, deltaCRLPrefix+id); err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error deleting delta CRL: %s", err)}
+		}
+	}
+	return nil
+}
+
+// Builds the delta CRL of each issuer holding a key, listing the certificates
+// revoked since the last build of the CRLs.
+func buildDeltaCRL(ctx context.Context, b *backend, req *logical.Request) error {
+	b.crlBuildLock.Lock()
+	defer b.crlBuildLock.Unlock()
+
+	config, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL config information: %s", err)}
+	}
+
+	return buildCRLs(ctx, b, req.Storage, config, true)
+}
+
+// buildCRLs builds either the full or the delta CRLs of the issuers. It must
+// be called with the crlBuildLock held.
+func buildCRLs(ctx context.Context, b *backend, s logical.Storage, crlInfo *crlConfig, delta bool) error {
+	crlLifetime, _, _, err := crlInfo.durations()
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error parsing CRL duration of %s", crlInfo.Expiry)}
+	}
+
+	state, err := getCRLState(ctx, s)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL state: %s", err)}
+	}
+
+	// Delta CRLs list the revocations of the delta WAL, which are also the
+	// ones cleared by the build of full CRLs
+	walSerials, err := s.List(ctx, deltaWALPrefix)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of delta WAL entries: %s", err)}
+	}
+	revokedSerials := walSerials
+	if !delta {
+		revokedSerials, err = s.List(ctx, "revoked/")
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
+		}
+	}
+
+	type revokedEntry struct {
+		cert    *x509.Certificate
+		revoked pkix.RevokedCertificate
+	}
+	var revokedEntries []revokedEntry
 	for _, serial := range revokedSerials {
-		revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
+		var revInfo revocationInfo
+		revokedStorageEntry, err := s.Get(ctx, "revoked/"+serial)
 		if err != nil {
 			return errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
 		}
-		if revokedEntry == nil {
+		if revokedStorageEntry == nil {
+			// Revocations of the delta WAL may have been tidied since
+			if delta {
+				continue
+			}
 			return errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
 		}
-		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
+		if revokedStorageEntry.Value == nil || len(revokedStorageEntry.Value) == 0 {
 			// TODO: In this case, remove it and continue? How likely is this to
 			// happen? Alternately, could skip it entirely, or could implement a
 			// delete function so that there is a way to remove these
 			return errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
 		}
 
-		err = revokedEntry.DecodeJSON(&revInfo)
+		err = revokedStorageEntry.DecodeJSON(&revInfo)
 		if err != nil {
 			return errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
 		}
@@ -164,42 +318,210 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request) error {
 		} else {
 			newRevCert.RevocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
 		}
-		revokedCerts = append(revokedCerts, newRevCert)
+
+		// RFC 5280 recommends leaving out the code of unspecified reasons
+		if revInfo.Reason != 0 {
+			value, err := asn1.Marshal(asn1.Enumerated(revInfo.Reason))
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("error encoding revocation reason of serial %s: %s", serial, err)}
+			}
+			newRevCert.Extensions = []pkix.Extension{{Id: oidExtensionReasonCode, Value: value}}
+		}
+		revokedEntries = append(revokedEntries, revokedEntry{
+			cert:    revokedCert,
+			revoked: newRevCert,
+		})
 	}
 
-	signingBundle, caErr := fetchCAInfo(ctx, req)
-	switch caErr.(type) {
-	case errutil.UserError:
-		return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
-	case errutil.InternalError:
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+	issuers, err := b.fetchAllIssuers(ctx, s)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificates: %s", err)}
 	}
 
-	crlLifetime := b.crlLifetime
-	crlInfo, err := b.CRL(ctx, req.Storage)
+	type crlIssuer struct {
+		issuer       *issuerEntry
+		cert         *x509.Certificate
+		signer       crypto.Signer
+		revokedCerts []pkix.RevokedCertificate
+	}
+	var crlIssuers []*crlIssuer
+	for _, issuer := range issuers {
+		// Issuers without a key cannot sign their CRL
+		if issuer.KeyID == "" {
+			continue
+		}
+
+		issuerCert, err := issuer.parseCertificate()
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error parsing certificate of issuer %s: %s", issuer.ID, err)}
+		}
+		key, err := b.fetchKey(ctx, s, issuer.KeyID)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching key of issuer %s: %s", issuer.ID, err)}
+		}
+		if key == nil {
+			return errutil.InternalError{Err: fmt.Sprintf("key %s of issuer %s not found", issuer.KeyID, issuer.ID)}
+		}
+		signer, err := key.parseKey()
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error parsing key of issuer %s: %s", issuer.ID, err)}
+		}
+
+		crlIssuers = append(crlIssuers, &crlIssuer{
+			issuer:       issuer,
+			cert:         issuerCert,
+			signer:       signer,
+			revokedCerts: []pkix.RevokedCertificate{},
+		})
+	}
+
+	if len(crlIssuers) == 0 {
+		return errutil.UserError{Err: "could not fetch the CA certificate: backend must be configured with a CA certificate/key"}
+	}
+
+	// Certificates are only listed on the CRLs of the issuers that signed
+	// them. Those of issuers the mount no longer holds, e.g. after the root
+	// was deleted and generated again, are left out, as no CRL of the mount
+	// can vouch for them.
+	for _, entry := range revokedEntries {
+		for _, crlIssuer := range crlIssuers {
+			if bytes.Equal(entry.cert.RawIssuer, crlIssuer.cert.RawSubject) && entry.cert.CheckSignatureFrom(crlIssuer.cert) == nil {
+				crlIssuer.revokedCerts = append(crlIssuer.revokedCerts, entry.revoked)
+			}
+		}
+	}
+
+	// Delta CRLs expire with the CRLs they complement
+	now := time.Now()
+	state.Number++
+	nextUpdate := now.Add(crlLifetime)
+	prefix := crlPrefix
+	var baseNumber int64
+	if delta {
+		if state.LastFullBuild.Add(crlLifetime).After(now) {
+			nextUpdate = state.LastFullBuild.Add(crlLifetime)
+		}
+		prefix = deltaCRLPrefix
+		baseNumber = state.FullNumber
+	}
+
+	for _, crlIssuer := range crlIssuers {
+		crlBytes, err := createCRL(crlIssuer.cert, crlIssuer.signer, crlIssuer.revokedCerts, now, nextUpdate, state.Number, baseNumber)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL for issuer %s: %s", crlIssuer.issuer.ID, err)}
+		}
+
+		err = s.Put(ctx, &logical.StorageEntry{
+			Key:   prefix + crlIssuer.issuer.ID,
+			Value: crlBytes,
+		})
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		}
+	}
+
+	if delta {
+		state.LastDeltaBuild = now
+		state.DeltaEntries = len(walSerials)
+	} else {
+		state.FullNumber = state.Number
+		state.LastFullBuild = now
+		state.DeltaEntries = 0
+		for _, serial := range walSerials {
+			if err := s.Delete(ctx, deltaWALPrefix+serial); err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("error deleting delta WAL entry: %s", err)}
+			}
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(crlStatePath, state)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL config information: %s", err)}
+		return errutil.InternalError{Err: fmt.Sprintf("error encoding CRL state: %s", err)}
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL state: %s", err)}
+	}
+
+	return nil
+}
+
+// authorityKeyID is the value of the authority key identifier extension
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// createCRL creates a CRL signed by the issuer as x509.Certificate.CreateCRL
+// does, adding its number and, for delta CRLs, the number of the CRL they
+// complement
+func createCRL(issuer *x509.Certificate, signer crypto.Signer, revokedCerts []pkix.RevokedCertificate, now, expiry time.Time, number, baseNumber int64) ([]byte, error) {
+	var sigAlg pkix.AlgorithmIdentifier
+	var hashFunc crypto.Hash
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidSignatureSHA256WithRSA, Parameters: asn1.NullRawValue}
+		hashFunc = crypto.SHA256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}
+			hashFunc = crypto.SHA384
+		case elliptic.P521():
+			sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA512}
+			hashFunc = crypto.SHA512
+		default:
+			sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}
+			hashFunc = crypto.SHA256
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
 	}
-	if crlInfo != nil {
-		crlDur, err := time.ParseDuration(crlInfo.Expiry)
+
+	var extensions []pkix.Extension
+	if len(issuer.SubjectKeyId) > 0 {
+		value, err := asn1.Marshal(authorityKeyID{ID: issuer.SubjectKeyId})
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("error parsing CRL duration of %s", crlInfo.Expiry)}
+			return nil, err
 		}
-		crlLifetime = crlDur
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionAuthorityKeyID, Value: value})
+	}
+	value, err := asn1.Marshal(big.NewInt(number))
+	if err != nil {
+		return nil, err
+	}
+	extensions = append(extensions, pkix.Extension{Id: oidExtensionCRLNumber, Value: value})
+	if baseNumber > 0 {
+		value, err := asn1.Marshal(big.NewInt(baseNumber))
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionDeltaCRLIndicator, Critical: true, Value: value})
 	}
 
-	crlBytes, err := signingBundle.Certificate.CreateCRL(rand.Reader, signingBundle.PrivateKey, revokedCerts, time.Now(), time.Now().Add(crlLifetime))
+	tbsCertList := pkix.TBSCertificateList{
+		Version:             1,
+		Signature:           sigAlg,
+		Issuer:              issuer.Subject.ToRDNSequence(),
+		ThisUpdate:          now.UTC(),
+		NextUpdate:          expiry.UTC(),
+		RevokedCertificates: revokedCerts,
+		Extensions:          extensions,
+	}
+	tbsCertListContents, err := asn1.Marshal(tbsCertList)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL: %s", err)}
+		return nil, err
 	}
+	tbsCertList.Raw = tbsCertListContents
 
-	err = req.Storage.Put(ctx, &logical.StorageEntry{
-		Key:   "crl",
-		Value: crlBytes,
-	})
+	h := hashFunc.New()
+	h.Write(tbsCertListContents)
+	signature, err := signer.Sign(rand.Reader, h.Sum(nil), hashFunc)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		return nil, err
 	}
 
-	return nil
+	return asn1.Marshal(pkix.CertificateList{
+		TBSCertList:        tbsCertList,
+		SignatureAlgorithm: sigAlg,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
 }
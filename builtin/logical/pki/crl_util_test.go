@@ -0,0 +1,251 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestPki_CRLAutoRebuildAndDelta(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"key_type":    "ec",
+		"key_bits":    384,
+		"ttl":         "48h",
+	})
+	caCert := parseTestCert(t, resp.Data["certificate"].(string))
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+	})
+	var serials []string
+	for _, cn := range []string{"a.example.com", "b.example.com"} {
+		resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+			"common_name": cn,
+			"ttl":         "1h",
+		})
+		serials = append(serials, resp.Data["serial_number"].(string))
+	}
+
+	fetchCRL := func(path string) *pkix.CertificateList {
+		t.Helper()
+		resp := issuersTestRequest(t, b, storage, logical.ReadOperation, path, nil)
+		crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if err := caCert.CheckCRLSignature(crl); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return crl
+	}
+	crlNumber := func(crl *pkix.CertificateList, oid asn1.ObjectIdentifier) int64 {
+		t.Helper()
+		for _, ext := range crl.TBSCertList.Extensions {
+			if ext.Id.Equal(oid) {
+				var number *big.Int
+				if _, err := asn1.Unmarshal(ext.Value, &number); err != nil {
+					t.Fatal(err)
+				}
+				return number.Int64()
+			}
+		}
+		return 0
+	}
+	listed := func(crl *pkix.CertificateList, serial string) bool {
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if certutil.GetHexFormatted(revoked.SerialNumber.Bytes(), ":") == serial {
+				return true
+			}
+		}
+		return false
+	}
+	periodic := func() {
+		t.Helper()
+		if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Delta CRLs require the automatic rebuild
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/crl",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"enable_delta": true,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error enabling delta CRLs: err: %v resp: %#v", err, resp)
+	}
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"auto_rebuild":           true,
+		"enable_delta":           true,
+		"delta_rebuild_interval": "1ms",
+	})
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "config/crl", nil)
+	if resp.Data["expiry"] != "72h" || resp.Data["auto_rebuild_grace_period"] != "12h" || !resp.Data["enable_delta"].(bool) {
+		t.Fatalf("bad: CRL config: %#v", resp.Data)
+	}
+
+	fullCRL := fetchCRL("crl")
+	baseNumber := crlNumber(fullCRL, oidExtensionCRLNumber)
+	if baseNumber == 0 || crlNumber(fullCRL, oidExtensionDeltaCRLIndicator) != 0 {
+		t.Fatalf("bad: CRL extensions: %#v", fullCRL.TBSCertList.Extensions)
+	}
+
+	// Revocations no longer rebuild the CRL, and show on the delta CRL once
+	// it is rebuilt
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serials[0],
+	})
+	if listed(fetchCRL("crl"), serials[0]) {
+		t.Fatal("revoked certificate listed on the CRL before its rebuild")
+	}
+	if listed(fetchCRL("crl/delta"), serials[0]) {
+		t.Fatal("revoked certificate listed on the delta CRL before its rebuild")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	periodic()
+
+	deltaCRL := fetchCRL("crl/delta")
+	if !listed(deltaCRL, serials[0]) {
+		t.Fatal("revoked certificate missing from the delta CRL")
+	}
+	if crlNumber(deltaCRL, oidExtensionDeltaCRLIndicator) != baseNumber {
+		t.Fatalf("bad: delta CRL base number: %#v", deltaCRL.TBSCertList.Extensions)
+	}
+	if crlNumber(deltaCRL, oidExtensionCRLNumber) <= baseNumber {
+		t.Fatalf("bad: delta CRL number: %#v", deltaCRL.TBSCertList.Extensions)
+	}
+	if !deltaCRL.TBSCertList.NextUpdate.Equal(fullCRL.TBSCertList.NextUpdate) {
+		t.Fatalf("delta CRL expires at %s, CRL at %s", deltaCRL.TBSCertList.NextUpdate, fullCRL.TBSCertList.NextUpdate)
+	}
+	issuerDeltaCRL := fetchCRL("issuer/default/crl/delta")
+	if !listed(issuerDeltaCRL, serials[0]) {
+		t.Fatal("revoked certificate missing from the delta CRL of the issuer")
+	}
+
+	// Rotating the CRL moves the revocation from the delta CRL to the CRL
+	issuersTestRequest(t, b, storage, logical.ReadOperation, "crl/rotate", nil)
+	fullCRL = fetchCRL("crl")
+	if !listed(fullCRL, serials[0]) {
+		t.Fatal("revoked certificate missing from the rotated CRL")
+	}
+	deltaCRL = fetchCRL("crl/delta")
+	if len(deltaCRL.TBSCertList.RevokedCertificates) != 0 {
+		t.Fatalf("bad: delta CRL entries after rotation: %#v", deltaCRL.TBSCertList.RevokedCertificates)
+	}
+	if crlNumber(deltaCRL, oidExtensionDeltaCRLIndicator) != crlNumber(fullCRL, oidExtensionCRLNumber) {
+		t.Fatal("delta CRL does not reference the rotated CRL")
+	}
+
+	// The CRL is rebuilt once it enters its grace period
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"expiry":                    "2s",
+		"auto_rebuild_grace_period": "1s",
+	})
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serials[1],
+	})
+	periodic()
+	if listed(fetchCRL("crl"), serials[1]) {
+		t.Fatal("CRL rebuilt before its grace period")
+	}
+	time.Sleep(1100 * time.Millisecond)
+	periodic()
+	if !listed(fetchCRL("crl"), serials[1]) {
+		t.Fatal("revoked certificate missing from the automatically rebuilt CRL")
+	}
+
+	// Disabling the automatic rebuild removes the delta CRLs
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"auto_rebuild": false,
+		"enable_delta": false,
+	})
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "crl/delta", nil)
+	if len(resp.Data[logical.HTTPRawBody].([]byte)) != 0 {
+		t.Fatal("delta CRL still served after disabling it")
+	}
+}
+
+func TestPki_RevocationReason(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "48h",
+	})
+	caCert := parseTestCert(t, resp.Data["certificate"].(string))
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	var certs []*x509.Certificate
+	for _, reason := range []int{ocsp.KeyCompromise, ocsp.Unspecified} {
+		resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+			"common_name": "foo.example.com",
+			"ttl":         "1h",
+		})
+		certs = append(certs, parseTestCert(t, resp.Data["certificate"].(string)))
+		resp, err := revokeCert(context.Background(), b, &logical.Request{Storage: storage}, resp.Data["serial_number"].(string), reason, false)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	}
+
+	// Only specified reasons are listed on the CRL
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "crl", nil)
+	crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]int{}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		reasons[revoked.SerialNumber.String()] = ocsp.Unspecified
+		for _, ext := range revoked.Extensions {
+			if !ext.Id.Equal(oidExtensionReasonCode) {
+				continue
+			}
+			var reason asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &reason); err != nil {
+				t.Fatal(err)
+			}
+			reasons[revoked.SerialNumber.String()] = int(reason)
+		}
+	}
+	if len(reasons) != 2 || reasons[certs[0].SerialNumber.String()] != ocsp.KeyCompromise || reasons[certs[1].SerialNumber.String()] != ocsp.Unspecified {
+		t.Fatalf("bad: CRL reasons: %#v", reasons)
+	}
+
+	der, err := ocsp.CreateRequest(certs[0], caCert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "ocsp", map[string]interface{}{
+		logical.HTTPRawBody: der,
+	})
+	ocspResp, err := ocsp.ParseResponseForCert(resp.Data[logical.HTTPRawBody].([]byte), certs[0], caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ocspResp.Status != ocsp.Revoked || ocspResp.RevocationReason != ocsp.KeyCompromise {
+		t.Fatalf("bad: OCSP status %d, reason %d", ocspResp.Status, ocspResp.RevocationReason)
+	}
+}
@@ -222,5 +222,34 @@ func addCAIssueFields(fields map[string]*framework.FieldSchema) map[string]*fram
 		Description: `Domains for which this certificate is allowed to sign or issue child certificates. If set, all DNS names (subject and alt) on child certs must be exact matches or subsets of the given domains (see https://tools.ietf.org/html/rfc5280#section-4.2.1.10).`,
 	}
 
+	fields["excluded_dns_domains"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Domains for which this certificate is not allowed to sign or issue child certificates. If set, no DNS name (subject and alt) on child certs can match or be a subdomain of the given domains (see https://tools.ietf.org/html/rfc5280#section-4.2.1.10).`,
+	}
+
+	return fields
+}
+
+// addIssuerRefField adds the field selecting the issuer signing a certificate
+func addIssuerRefField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_ref"] = &framework.FieldSchema{
+		Type:    framework.TypeString,
+		Default: defaultRef,
+		Description: `Reference, by name or ID, to the issuer signing
+the certificate. Defaults to "default", the default
+issuer of the mount.`,
+	}
+
+	return fields
+}
+
+// addIssuerNameField adds the field naming a newly created issuer
+func addIssuerNameField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Optional name of the new issuer, which can
+be used instead of its ID to reference it.`,
+	}
+
 	return fields
 }
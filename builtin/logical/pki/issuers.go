@@ -0,0 +1,809 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	issuerPrefix      = "config/issuer/"
+	keyPrefix         = "config/key/"
+	issuersConfigPath = "config/issuers"
+	crlPrefix         = "crls/"
+
+	// The single CA bundle stored before mounts could hold several issuers
+	legacyCABundlePath = "config/ca_bundle"
+
+	// Record of the migration of the legacy CA bundle
+	legacyMigrationLogPath = "config/legacy_migration"
+
+	// Reference to the default issuer or key
+	defaultRef = "default"
+)
+
+// issuerEntry is a CA certificate of the mount. Issuers sharing a key, such
+// as cross-signed certificates, refer to the same key entry.
+type issuerEntry struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	KeyID        string `json:"key_id"`
+	Certificate  string `json:"certificate"`
+	SerialNumber string `json:"serial_number"`
+}
+
+// keyEntry is a private key of the mount, which may not have an issuer yet,
+// e.g. when a signed intermediate certificate is still awaited
+type keyEntry struct {
+	ID             string                  `json:"id"`
+	Name           string                  `json:"name"`
+	PrivateKeyType certutil.PrivateKeyType `json:"private_key_type"`
+	PrivateKey     string                  `json:"private_key"`
+}
+
+type issuersConfig struct {
+	DefaultIssuerID string `json:"default"`
+}
+
+func (i *issuerEntry) parseCertificate() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(i.Certificate))
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode certificate of issuer %s", i.ID)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func (k *keyEntry) parseKey() (crypto.Signer, error) {
+	bundle := &certutil.CertBundle{
+		PrivateKeyType: k.PrivateKeyType,
+		PrivateKey:     k.PrivateKey,
+	}
+	parsedBundle, err := bundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, err
+	}
+	if parsedBundle.PrivateKey == nil {
+		return nil, fmt.Errorf("unable to parse key %s", k.ID)
+	}
+	return parsedBundle.PrivateKey, nil
+}
+
+// legacyMigrationLog records the migration of the legacy CA bundle. The
+// bundle is kept in storage so that previous versions can still use the
+// mount; it is migrated again only if it changed since.
+type legacyMigrationLog struct {
+	Hash       string    `json:"hash"`
+	IssuerID   string    `json:"issuer_id"`
+	KeyID      string    `json:"key_id"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
+// migrateLegacyCA moves the CA bundle stored by previous versions into an
+// issuer and a key, which become the defaults of the mount, along with its
+// CRL. It is run before the issuers are first accessed, and can be run again
+// after being interrupted without duplicating the issuer or key.
+func (b *backend) migrateLegacyCA(ctx context.Context, s logical.Storage) error {
+	if atomic.LoadUint32(&b.issuersMigrated) == 1 {
+		return nil
+	}
+
+	b.migrationLock.Lock()
+	defer b.migrationLock.Unlock()
+
+	if atomic.LoadUint32(&b.issuersMigrated) == 1 {
+		return nil
+	}
+
+	entry, err := s.Get(ctx, legacyCABundlePath)
+	if err != nil {
+		return errwrap.Wrapf("unable to fetch legacy CA bundle: {{err}}", err)
+	}
+	if entry != nil {
+		hash := sha256.Sum256(entry.Value)
+		log, err := fetchLegacyMigrationLog(ctx, s)
+		if err != nil {
+			return err
+		}
+		if log == nil || log.Hash != hex.EncodeToString(hash[:]) {
+			if err := migrateLegacyCABundle(ctx, s, entry, hex.EncodeToString(hash[:])); err != nil {
+				return err
+			}
+			b.Logger().Info("migrated legacy CA bundle to issuers")
+		}
+	}
+
+	atomic.StoreUint32(&b.issuersMigrated, 1)
+	return nil
+}
+
+// migrateLegacyCABundle stores the key, certificate and CRL of the legacy CA
+// bundle as the defaults of the mount, reusing the entries written by an
+// interrupted migration, and records the migration once done
+func migrateLegacyCABundle(ctx context.Context, s logical.Storage, entry *logical.StorageEntry, hash string) error {
+	var bundle certutil.CertBundle
+	if err := entry.DecodeJSON(&bundle); err != nil {
+		return errwrap.Wrapf("unable to decode legacy CA bundle: {{err}}", err)
+	}
+
+	log := &legacyMigrationLog{
+		Hash:       hash,
+		MigratedAt: time.Now(),
+	}
+
+	// Intermediate CAs awaiting their signed certificate only have a key
+	var key *keyEntry
+	if bundle.PrivateKey != "" {
+		var err error
+		key, err = newKeyEntry(bundle.PrivateKeyType, bundle.PrivateKey)
+		if err != nil {
+			return err
+		}
+		signer, err := key.parseKey()
+		if err != nil {
+			return err
+		}
+		existing, err := storedKeyForPublicKey(ctx, s, signer.Public())
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			key = existing
+		} else if err := writeKey(ctx, s, key); err != nil {
+			return err
+		}
+		log.KeyID = key.ID
+	}
+
+	if bundle.Certificate != "" {
+		issuer, err := storeLegacyIssuer(ctx, s, bundle.Certificate, key)
+		if err != nil {
+			return err
+		}
+		for _, chainCert := range bundle.CAChain {
+			if _, err := storeLegacyIssuer(ctx, s, chainCert, nil); err != nil {
+				return err
+			}
+		}
+
+		crl, err := s.Get(ctx, "crl")
+		if err != nil {
+			return errwrap.Wrapf("unable to fetch legacy CRL: {{err}}", err)
+		}
+		if crl != nil {
+			if err := s.Put(ctx, &logical.StorageEntry{Key: crlPrefix + issuer.ID, Value: crl.Value}); err != nil {
+				return errwrap.Wrapf("unable to store legacy CRL: {{err}}", err)
+			}
+		}
+
+		if err := setIssuersConfig(ctx, s, &issuersConfig{DefaultIssuerID: issuer.ID}); err != nil {
+			return err
+		}
+		log.IssuerID = issuer.ID
+	}
+
+	logEntry, err := logical.StorageEntryJSON(legacyMigrationLogPath, log)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, logEntry)
+}
+
+// storeLegacyIssuer stores the certificate as an issuer, unless the mount
+// already holds it, in which case the existing entry is returned
+func storeLegacyIssuer(ctx context.Context, s logical.Storage, certPEM string, key *keyEntry) (*issuerEntry, error) {
+	issuer, err := newIssuerEntry(certPEM, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := issuer.parseCertificate()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := storedIssuerForCert(ctx, s, cert)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+	if err := writeIssuer(ctx, s, issuer); err != nil {
+		return nil, err
+	}
+	return issuer, nil
+}
+
+func fetchLegacyMigrationLog(ctx context.Context, s logical.Storage) (*legacyMigrationLog, error) {
+	entry, err := s.Get(ctx, legacyMigrationLogPath)
+	if err != nil {
+		return nil, errwrap.Wrapf("unable to fetch legacy CA migration log: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var log legacyMigrationLog
+	if err := entry.DecodeJSON(&log); err != nil {
+		return nil, errwrap.Wrapf("unable to decode legacy CA migration log: {{err}}", err)
+	}
+	return &log, nil
+}
+
+func newKeyEntry(keyType certutil.PrivateKeyType, privateKey string) (*keyEntry, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &keyEntry{
+		ID:             id,
+		PrivateKeyType: keyType,
+		PrivateKey:     strings.TrimSpace(privateKey),
+	}, nil
+}
+
+func newIssuerEntry(certPEM string, key *keyEntry) (*issuerEntry, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	issuer := &issuerEntry{
+		ID:          id,
+		Certificate: strings.TrimSpace(certPEM),
+	}
+	cert, err := issuer.parseCertificate()
+	if err != nil {
+		return nil, err
+	}
+	issuer.SerialNumber = certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":")
+	if key != nil {
+		issuer.KeyID = key.ID
+	}
+	return issuer, nil
+}
+
+func writeIssuer(ctx context.Context, s logical.Storage, issuer *issuerEntry) error {
+	entry, err := logical.StorageEntryJSON(issuerPrefix+issuer.ID, issuer)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func writeKey(ctx context.Context, s logical.Storage, key *keyEntry) error {
+	entry, err := logical.StorageEntryJSON(keyPrefix+key.ID, key)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func setIssuersConfig(ctx context.Context, s logical.Storage, config *issuersConfig) error {
+	entry, err := logical.StorageEntryJSON(issuersConfigPath, config)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func (b *backend) getIssuersConfig(ctx context.Context, s logical.Storage) (*issuersConfig, error) {
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return nil, err
+	}
+
+	config := &issuersConfig{}
+	entry, err := s.Get(ctx, issuersConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+func (b *backend) listIssuers(ctx context.Context, s logical.Storage) ([]string, error) {
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return nil, err
+	}
+	return s.List(ctx, issuerPrefix)
+}
+
+func (b *backend) listKeys(ctx context.Context, s logical.Storage) ([]string, error) {
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return nil, err
+	}
+	return s.List(ctx, keyPrefix)
+}
+
+func (b *backend) fetchIssuer(ctx context.Context, s logical.Storage, id string) (*issuerEntry, error) {
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return nil, err
+	}
+	return readIssuer(ctx, s, id)
+}
+
+func readIssuer(ctx context.Context, s logical.Storage, id string) (*issuerEntry, error) {
+	entry, err := s.Get(ctx, issuerPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var issuer issuerEntry
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return nil, err
+	}
+	return &issuer, nil
+}
+
+func (b *backend) fetchKey(ctx context.Context, s logical.Storage, id string) (*keyEntry, error) {
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return nil, err
+	}
+	return readKey(ctx, s, id)
+}
+
+func readKey(ctx context.Context, s logical.Storage, id string) (*keyEntry, error) {
+	entry, err := s.Get(ctx, keyPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var key keyEntry
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// fetchAllIssuers returns the issuers of the mount, ordered by ID
+func (b *backend) fetchAllIssuers(ctx context.Context, s logical.Storage) ([]*issuerEntry, error) {
+	ids, err := b.listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var issuers []*issuerEntry
+	for _, id := range ids {
+		issuer, err := b.fetchIssuer(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil {
+			issuers = append(issuers, issuer)
+		}
+	}
+	return issuers, nil
+}
+
+// resolveIssuerRef returns the issuer referenced by "default", its ID or its
+// name. Errors are returned as errutil errors.
+func (b *backend) resolveIssuerRef(ctx context.Context, s logical.Storage, ref string) (*issuerEntry, error) {
+	if ref == "" || ref == defaultRef {
+		config, err := b.getIssuersConfig(ctx, s)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch issuers configuration: %v", err)}
+		}
+		if config.DefaultIssuerID == "" {
+			return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+		}
+		ref = config.DefaultIssuerID
+	}
+
+	issuer, err := b.fetchIssuer(ctx, s, ref)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch issuer %s: %v", ref, err)}
+	}
+	if issuer != nil {
+		return issuer, nil
+	}
+
+	issuers, err := b.fetchAllIssuers(ctx, s)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch issuers: %v", err)}
+	}
+	for _, issuer := range issuers {
+		if issuer.Name == ref {
+			return issuer, nil
+		}
+	}
+
+	return nil, errutil.UserError{Err: fmt.Sprintf("unknown issuer %q", ref)}
+}
+
+// resolveKeyRef returns the key referenced by its ID or its name, or the key
+// of the default issuer. Errors are returned as errutil errors.
+func (b *backend) resolveKeyRef(ctx context.Context, s logical.Storage, ref string) (*keyEntry, error) {
+	if ref == "" || ref == defaultRef {
+		issuer, err := b.resolveIssuerRef(ctx, s, defaultRef)
+		if err != nil {
+			return nil, err
+		}
+		if issuer.KeyID == "" {
+			return nil, errutil.UserError{Err: "default issuer has no key"}
+		}
+		ref = issuer.KeyID
+	}
+
+	key, err := b.fetchKey(ctx, s, ref)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch key %s: %v", ref, err)}
+	}
+	if key != nil {
+		return key, nil
+	}
+
+	ids, err := b.listKeys(ctx, s)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch keys: %v", err)}
+	}
+	for _, id := range ids {
+		key, err := b.fetchKey(ctx, s, id)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch key %s: %v", id, err)}
+		}
+		if key != nil && key.Name == ref {
+			return key, nil
+		}
+	}
+
+	return nil, errutil.UserError{Err: fmt.Sprintf("unknown key %q", ref)}
+}
+
+// validateName checks that a new issuer or key name does not collide with
+// reserved names or other references
+func validateName(name string, ids []string, names map[string]string, id string) error {
+	if name == "" {
+		return nil
+	}
+	if name == defaultRef {
+		return fmt.Errorf("%q is reserved and cannot be used as a name", defaultRef)
+	}
+	for _, other := range ids {
+		if other == name && other != id {
+			return fmt.Errorf("name %q is the ID of another entry", name)
+		}
+	}
+	if other, ok := names[name]; ok && other != id {
+		return fmt.Errorf("name %q is already in use", name)
+	}
+	return nil
+}
+
+// importKey stores the given private key, unless the mount already holds it,
+// in which case the existing entry is returned
+func (b *backend) importKey(ctx context.Context, s logical.Storage, keyType certutil.PrivateKeyType, privateKey string) (*keyEntry, bool, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	key, err := newKeyEntry(keyType, privateKey)
+	if err != nil {
+		return nil, false, err
+	}
+	signer, err := key.parseKey()
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := b.findKeyForPublicKey(ctx, s, signer.Public())
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, true, nil
+	}
+
+	if err := writeKey(ctx, s, key); err != nil {
+		return nil, false, err
+	}
+	return key, false, nil
+}
+
+// findKeyForPublicKey returns the key of the mount matching the public key,
+// if any
+func (b *backend) findKeyForPublicKey(ctx context.Context, s logical.Storage, publicKey crypto.PublicKey) (*keyEntry, error) {
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return nil, err
+	}
+	return storedKeyForPublicKey(ctx, s, publicKey)
+}
+
+// storedKeyForPublicKey is findKeyForPublicKey without migrating the legacy
+// CA bundle first
+func storedKeyForPublicKey(ctx context.Context, s logical.Storage, publicKey crypto.PublicKey) (*keyEntry, error) {
+	ids, err := s.List(ctx, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		key, err := readKey(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+		signer, err := key.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		if equal, _ := certutil.ComparePublicKeys(signer.Public(), publicKey); equal {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
+// storedIssuerForCert returns the issuer of the mount holding the given
+// certificate, if any, without migrating the legacy CA bundle first
+func storedIssuerForCert(ctx context.Context, s logical.Storage, cert *x509.Certificate) (*issuerEntry, error) {
+	ids, err := s.List(ctx, issuerPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		issuer, err := readIssuer(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			continue
+		}
+		issuerCert, err := issuer.parseCertificate()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(issuerCert.Raw, cert.Raw) {
+			return issuer, nil
+		}
+	}
+	return nil, nil
+}
+
+// importIssuer stores the given CA certificate, linked to the key of the
+// mount matching its public key if any, unless the mount already holds it,
+// in which case the existing entry is returned. The first issuer of the
+// mount becomes its default.
+func (b *backend) importIssuer(ctx context.Context, s logical.Storage, certPEM string) (*issuerEntry, bool, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := newIssuerEntry(certPEM, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	cert, err := issuer.parseCertificate()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return nil, false, err
+	}
+	existing, err := storedIssuerForCert(ctx, s, cert)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, true, nil
+	}
+
+	key, err := b.findKeyForPublicKey(ctx, s, cert.PublicKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if key != nil {
+		issuer.KeyID = key.ID
+	}
+
+	if err := writeIssuer(ctx, s, issuer); err != nil {
+		return nil, false, err
+	}
+
+	config, err := b.getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, false, err
+	}
+	if config.DefaultIssuerID == "" {
+		config.DefaultIssuerID = issuer.ID
+		if err := setIssuersConfig(ctx, s, config); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return issuer, false, nil
+}
+
+// issuerChain returns the issuers of the mount that can complete the trust
+// chain of the given issuer, closest first. As every issuer whose subject and
+// key match the issuer of a certificate is followed, cross-signed certificates
+// and their own chains are included.
+func (b *backend) issuerChain(ctx context.Context, s logical.Storage, issuer *issuerEntry) ([]*issuerEntry, error) {
+	issuers, err := b.fetchAllIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make(map[string]*x509.Certificate, len(issuers))
+	for _, candidate := range issuers {
+		cert, err := candidate.parseCertificate()
+		if err != nil {
+			return nil, err
+		}
+		certs[candidate.ID] = cert
+	}
+
+	cert, ok := certs[issuer.ID]
+	if !ok {
+		cert, err = issuer.parseCertificate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var chain []*issuerEntry
+	visited := map[string]bool{issuer.ID: true}
+	queue := []*x509.Certificate{cert}
+	for len(queue) > 0 {
+		cert, queue = queue[0], queue[1:]
+
+		// The chain of roots ends with them
+		if isSelfSigned(cert) {
+			continue
+		}
+
+		for _, candidate := range issuers {
+			if visited[candidate.ID] {
+				continue
+			}
+			parent := certs[candidate.ID]
+			if !bytes.Equal(parent.RawSubject, cert.RawIssuer) || cert.CheckSignatureFrom(parent) != nil {
+				continue
+			}
+			visited[candidate.ID] = true
+			chain = append(chain, candidate)
+			queue = append(queue, parent)
+		}
+	}
+
+	return chain, nil
+}
+
+// issuerOf returns the issuer of the mount with a key that signed the given
+// certificate, if any
+func (b *backend) issuerOf(ctx context.Context, s logical.Storage, cert *x509.Certificate) (*issuerEntry, error) {
+	issuers, err := b.fetchAllIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, issuer := range issuers {
+		if issuer.KeyID == "" {
+			continue
+		}
+		issuerCert, err := issuer.parseCertificate()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(issuerCert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(issuerCert) == nil {
+			return issuer, nil
+		}
+	}
+	return nil, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// deleteIssuers removes every issuer, key, CRL and delta CRL of the mount,
+// along with the legacy CA bundle, so that previous versions do not use it
+// either
+func (b *backend) deleteIssuers(ctx context.Context, s logical.Storage) error {
+	if err := b.migrateLegacyCA(ctx, s); err != nil {
+		return err
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	for _, prefix := range []string{issuerPrefix, keyPrefix, crlPrefix, deltaCRLPrefix} {
+		keys, err := s.List(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := s.Delete(ctx, prefix+key); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range []string{issuersConfigPath, legacyCABundlePath, "ca", "crl", legacyMigrationLogPath} {
+		if err := s.Delete(ctx, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importIssuers stores the certificate of the bundle and the certificates of
+// its chain as issuers, returning the response listing them
+func (b *backend) importIssuers(ctx context.Context, s logical.Storage, cb *certutil.CertBundle) (*logical.Response, error) {
+	issuer, existing, err := b.importIssuer(ctx, s, cb.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := []string{}
+	if !existing {
+		imported = append(imported, issuer.ID)
+	}
+	for _, chainCert := range cb.CAChain {
+		chainIssuer, existing, err := b.importIssuer(ctx, s, chainCert)
+		if err != nil {
+			return nil, err
+		}
+		if !existing {
+			imported = append(imported, chainIssuer.ID)
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id":        issuer.ID,
+			"key_id":           issuer.KeyID,
+			"imported_issuers": imported,
+		},
+	}, nil
+}
+
+// setIssuerName renames the issuer, returning an error response if the name
+// is not valid
+func (b *backend) setIssuerName(ctx context.Context, s logical.Storage, issuer *issuerEntry, name string) *logical.Response {
+	if name == issuer.Name {
+		return nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuers, err := b.fetchAllIssuers(ctx, s)
+	if err != nil {
+		return logical.ErrorResponse(err.Error())
+	}
+	var ids []string
+	names := make(map[string]string)
+	for _, other := range issuers {
+		ids = append(ids, other.ID)
+		if other.Name != "" {
+			names[other.Name] = other.ID
+		}
+	}
+	if err := validateName(name, ids, names, issuer.ID); err != nil {
+		return logical.ErrorResponse(err.Error())
+	}
+
+	issuer.Name = name
+	if err := writeIssuer(ctx, s, issuer); err != nil {
+		return logical.ErrorResponse(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,1022 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// acmeHandlerFunc serves a request of an ACME client, returning problems as
+// errors
+type acmeHandlerFunc func(context.Context, *acmeRequest, *framework.FieldData) (*acmeResult, error)
+
+// acmeJWSFields are the fields of the JWS, in the flattened JSON
+// serialization, sent by ACME clients
+func acmeJWSFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["protected"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Protected header of the JWS of the request`,
+	}
+	fields["payload"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Payload of the JWS of the request`,
+	}
+	fields["signature"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Signature of the JWS of the request`,
+	}
+	return fields
+}
+
+func pathACMEDirectory(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/(roles/" + framework.GenericNameRegex("role") + "/)?directory",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Role issuing the certificates of the orders placed through the directory`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathACMEDirectoryRead,
+		},
+
+		HelpSynopsis:    pathACMEDirectoryHelpSyn,
+		HelpDescription: pathACMEDirectoryHelpDesc,
+	}
+}
+
+func pathACMENewNonce(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/new-nonce",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathACMENewNonceRead,
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMENewAccount(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/new-account",
+		Fields:  acmeJWSFields(map[string]*framework.FieldSchema{}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(true, true, b.pathACMENewAccountWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMEAccount(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/account/" + framework.GenericNameRegex("id"),
+		Fields: acmeJWSFields(map[string]*framework.FieldSchema{
+			"id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID of the account`,
+			},
+		}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(false, false, b.pathACMEAccountWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMENewOrder(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/(roles/" + framework.GenericNameRegex("role") + "/)?new-order",
+		Fields: acmeJWSFields(map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Role issuing the certificate of the order`,
+			},
+		}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(false, false, b.pathACMENewOrderWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMEOrder(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/order/" + framework.GenericNameRegex("id"),
+		Fields: acmeJWSFields(map[string]*framework.FieldSchema{
+			"id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID of the order`,
+			},
+		}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(false, false, b.pathACMEOrderWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMEFinalize(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/order/" + framework.GenericNameRegex("id") + "/finalize",
+		Fields: acmeJWSFields(map[string]*framework.FieldSchema{
+			"id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID of the order`,
+			},
+		}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(false, false, b.pathACMEFinalizeWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMEAuthorization(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/authorization/" + framework.GenericNameRegex("id"),
+		Fields: acmeJWSFields(map[string]*framework.FieldSchema{
+			"id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID of the authorization`,
+			},
+		}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(false, false, b.pathACMEAuthorizationWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMEChallenge(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/challenge/" + framework.GenericNameRegex("id") + "/" + framework.GenericNameRegex("type"),
+		Fields: acmeJWSFields(map[string]*framework.FieldSchema{
+			"id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID of the authorization of the challenge`,
+			},
+			"type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Type of the challenge`,
+			},
+		}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(false, false, b.pathACMEChallengeWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMECert(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/cert/" + framework.GenericNameRegex("id"),
+		Fields: acmeJWSFields(map[string]*framework.FieldSchema{
+			"id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `ID of the order of the certificate`,
+			},
+		}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(false, false, b.pathACMECertWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func pathACMERevokeCert(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "acme/revoke-cert",
+		Fields:  acmeJWSFields(map[string]*framework.FieldSchema{}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.acmeHandler(true, false, b.pathACMERevokeCertWrite),
+		},
+
+		HelpSynopsis:    pathACMEHelpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+// acmeEnabledConfig returns the ACME configuration of the mount, or a problem
+// if ACME is disabled
+func (b *backend) acmeEnabledConfig(ctx context.Context, s logical.Storage) (*acmeConfig, error) {
+	config, err := getACMEConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return config, acmeError("unauthorized", http.StatusForbidden, "ACME is not enabled on this mount")
+	}
+	return config, nil
+}
+
+// acmeHandler authenticates the requests of ACME clients before passing them
+// on to the handler, and turns errors into problem documents
+func (b *backend) acmeHandler(allowJWK, requireJWK bool, handler acmeHandlerFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		config, err := b.acmeEnabledConfig(ctx, req.Storage)
+		if config == nil {
+			return nil, err
+		}
+		if err != nil {
+			return b.acmeProblemResponse(config, err)
+		}
+
+		r, err := b.acmeVerifyRequest(ctx, req, config, allowJWK, requireJWK)
+		if err != nil {
+			return b.acmeProblemResponse(config, err)
+		}
+
+		result, err := handler(ctx, r, data)
+		if err != nil {
+			return b.acmeProblemResponse(config, err)
+		}
+
+		return b.acmeResponse(config, result)
+	}
+}
+
+func (b *backend) pathACMEDirectoryRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.acmeEnabledConfig(ctx, req.Storage)
+	if config == nil {
+		return nil, err
+	}
+	if err != nil {
+		return b.acmeProblemResponse(config, err)
+	}
+
+	newOrder := acmeURL(config, "new-order")
+	if roleName := data.Get("role").(string); roleName != "" {
+		if _, err := b.acmeRole(ctx, req.Storage, config, roleName); err != nil {
+			return b.acmeProblemResponse(config, err)
+		}
+		newOrder = acmeURL(config, "roles", roleName, "new-order")
+	}
+
+	return b.acmeResponse(config, &acmeResult{
+		status: http.StatusOK,
+		body: map[string]interface{}{
+			"newNonce":   acmeURL(config, "new-nonce"),
+			"newAccount": acmeURL(config, "new-account"),
+			"newOrder":   newOrder,
+			"revokeCert": acmeURL(config, "revoke-cert"),
+			"meta": map[string]interface{}{
+				"externalAccountRequired": false,
+			},
+		},
+	})
+}
+
+func (b *backend) pathACMENewNonceRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.acmeEnabledConfig(ctx, req.Storage)
+	if config == nil {
+		return nil, err
+	}
+	if err != nil {
+		return b.acmeProblemResponse(config, err)
+	}
+
+	return b.acmeResponse(config, &acmeResult{
+		status: http.StatusNoContent,
+	})
+}
+
+// acmeRole fetches a role that can be used through ACME
+func (b *backend) acmeRole(ctx context.Context, s logical.Storage, config *acmeConfig, roleName string) (*roleEntry, error) {
+	if roleName == "" {
+		return nil, acmeError("unauthorized", http.StatusForbidden, "no default role is configured, use the directory of a role")
+	}
+	if !config.roleAllowed(roleName) {
+		return nil, acmeError("unauthorized", http.StatusForbidden, "role %s cannot be used through ACME", roleName)
+	}
+	role, err := b.getRole(ctx, s, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, acmeError("unauthorized", http.StatusForbidden, "unknown role: %s", roleName)
+	}
+	return role, nil
+}
+
+func acmeAccountBody(account *acmeAccount) map[string]interface{} {
+	contact := account.Contact
+	if contact == nil {
+		contact = []string{}
+	}
+	return map[string]interface{}{
+		"status":  account.Status,
+		"contact": contact,
+	}
+}
+
+func acmeValidateContacts(contact []string) error {
+	for _, c := range contact {
+		if !strings.HasPrefix(c, "mailto:") {
+			return acmeError("unsupportedContact", http.StatusBadRequest, "unsupported contact %q, only mailto: URLs are supported", c)
+		}
+	}
+	return nil
+}
+
+func (b *backend) pathACMENewAccountWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	var payload struct {
+		Contact              []string `json:"contact"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
+	}
+	if err := r.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+	if err := acmeValidateContacts(payload.Contact); err != nil {
+		return nil, err
+	}
+
+	thumbprintBytes, err := r.jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	thumbprint := base64.RawURLEncoding.EncodeToString(thumbprintBytes)
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	var accountID string
+	ok, err := acmeGet(ctx, r.Storage, acmeAccountKeyPrefix+thumbprint, &accountID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		account, err := b.acmeFetchAccount(ctx, r.Storage, accountID)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			return nil, fmt.Errorf("account %s of key %s not found", accountID, thumbprint)
+		}
+		if account.Status != acmeStatusValid {
+			return nil, acmeError("unauthorized", http.StatusUnauthorized, "account is %s", account.Status)
+		}
+		return &acmeResult{
+			status:   http.StatusOK,
+			body:     acmeAccountBody(account),
+			location: acmeURL(r.config, "account", account.ID),
+		}, nil
+	}
+
+	if payload.OnlyReturnExisting {
+		return nil, acmeError("accountDoesNotExist", http.StatusBadRequest, "no account exists with the given key")
+	}
+
+	accountID, err = uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	account := &acmeAccount{
+		ID:         accountID,
+		Status:     acmeStatusValid,
+		Contact:    payload.Contact,
+		Key:        r.jwk,
+		Thumbprint: thumbprint,
+		CreatedAt:  time.Now(),
+	}
+	if err := acmePut(ctx, r.Storage, acmeAccountPrefix+accountID, account); err != nil {
+		return nil, err
+	}
+	if err := acmePut(ctx, r.Storage, acmeAccountKeyPrefix+thumbprint, accountID); err != nil {
+		return nil, err
+	}
+
+	return &acmeResult{
+		status:   http.StatusCreated,
+		body:     acmeAccountBody(account),
+		location: acmeURL(r.config, "account", accountID),
+	}, nil
+}
+
+func (b *backend) pathACMEAccountWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	if data.Get("id").(string) != r.account.ID {
+		return nil, acmeError("unauthorized", http.StatusForbidden, "account does not belong to the key of the request")
+	}
+
+	var payload struct {
+		Contact []string `json:"contact"`
+		Status  string   `json:"status"`
+	}
+	if err := r.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	account := r.account
+	switch payload.Status {
+	case "":
+	case acmeStatusDeactivated:
+		account.Status = acmeStatusDeactivated
+	default:
+		return nil, acmeError("malformed", http.StatusBadRequest, "invalid account status %q", payload.Status)
+	}
+	if payload.Contact != nil {
+		if err := acmeValidateContacts(payload.Contact); err != nil {
+			return nil, err
+		}
+		account.Contact = payload.Contact
+	}
+
+	if !r.postAsGet() {
+		if err := acmePut(ctx, r.Storage, acmeAccountPrefix+account.ID, account); err != nil {
+			return nil, err
+		}
+	}
+
+	return &acmeResult{
+		status:   http.StatusOK,
+		body:     acmeAccountBody(account),
+		location: acmeURL(r.config, "account", account.ID),
+	}, nil
+}
+
+func acmeOrderBody(config *acmeConfig, order *acmeOrder) map[string]interface{} {
+	authorizations := make([]string, 0, len(order.AuthorizationIDs))
+	for _, id := range order.AuthorizationIDs {
+		authorizations = append(authorizations, acmeURL(config, "authorization", id))
+	}
+
+	body := map[string]interface{}{
+		"status":         order.Status,
+		"expires":        order.Expires.Format(time.RFC3339),
+		"identifiers":    order.Identifiers,
+		"authorizations": authorizations,
+		"finalize":       acmeURL(config, "order", order.ID, "finalize"),
+	}
+	if order.Status == acmeStatusValid {
+		body["certificate"] = acmeURL(config, "cert", order.ID)
+	}
+	if order.Error != nil {
+		body["error"] = order.Error
+	}
+	return body
+}
+
+func (b *backend) pathACMENewOrderWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		roleName = r.config.DefaultRole
+	}
+	role, err := b.acmeRole(ctx, r.Storage, r.config, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Identifiers []acmeIdentifier `json:"identifiers"`
+		NotBefore   string           `json:"notBefore"`
+		NotAfter    string           `json:"notAfter"`
+	}
+	if err := r.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+	if len(payload.Identifiers) == 0 {
+		return nil, acmeError("malformed", http.StatusBadRequest, "order has no identifiers")
+	}
+	if payload.NotBefore != "" || payload.NotAfter != "" {
+		return nil, acmeError("malformed", http.StatusBadRequest, "notBefore and notAfter are not supported, the validity of certificates is set by the role")
+	}
+
+	var names []string
+	for _, identifier := range payload.Identifiers {
+		if identifier.Type != "dns" {
+			return nil, acmeError("unsupportedIdentifier", http.StatusBadRequest, "unsupported identifier type %q", identifier.Type)
+		}
+		names = append(names, identifier.Value)
+	}
+	names = strutil.RemoveDuplicates(names, true)
+
+	if badName := validateNames(&dataBundle{role: role, req: r.Request}, names); badName != "" {
+		return nil, acmeError("rejectedIdentifier", http.StatusBadRequest, "name %s not allowed by role %s", badName, roleName)
+	}
+
+	orderID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	order := &acmeOrder{
+		ID:        orderID,
+		AccountID: r.account.ID,
+		Role:      roleName,
+		Status:    acmeStatusPending,
+		Expires:   time.Now().Add(acmeOrderLifetime),
+	}
+
+	for _, name := range names {
+		order.Identifiers = append(order.Identifiers, acmeIdentifier{Type: "dns", Value: name})
+
+		authzID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		authz := &acmeAuthorization{
+			ID:         authzID,
+			AccountID:  r.account.ID,
+			OrderID:    orderID,
+			Identifier: acmeIdentifier{Type: "dns", Value: strings.TrimPrefix(name, "*.")},
+			Wildcard:   strings.HasPrefix(name, "*."),
+			Status:     acmeStatusPending,
+			Expires:    order.Expires,
+		}
+
+		// Wildcard names can only be validated through DNS
+		types := []string{acmeChallengeHTTP01, acmeChallengeDNS01}
+		if authz.Wildcard {
+			types = []string{acmeChallengeDNS01}
+		}
+		for _, typ := range types {
+			token, err := acmeRandomToken()
+			if err != nil {
+				return nil, err
+			}
+			authz.Challenges = append(authz.Challenges, &acmeChallenge{
+				Type:   typ,
+				Token:  token,
+				Status: acmeStatusPending,
+			})
+		}
+
+		if err := acmePut(ctx, r.Storage, acmeAuthorizationPrefix+authzID, authz); err != nil {
+			return nil, err
+		}
+		order.AuthorizationIDs = append(order.AuthorizationIDs, authzID)
+	}
+
+	if err := acmePut(ctx, r.Storage, acmeOrderPrefix+orderID, order); err != nil {
+		return nil, err
+	}
+
+	return &acmeResult{
+		status:   http.StatusCreated,
+		body:     acmeOrderBody(r.config, order),
+		location: acmeURL(r.config, "order", orderID),
+	}, nil
+}
+
+// acmeAccountOrder fetches an order of the account of the request
+func (b *backend) acmeAccountOrder(ctx context.Context, r *acmeRequest, id string) (*acmeOrder, error) {
+	order, err := b.acmeFetchOrder(ctx, r.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.AccountID != r.account.ID {
+		return nil, acmeError("malformed", http.StatusNotFound, "order not found")
+	}
+	if err := b.acmeUpdateOrderStatus(ctx, r.Storage, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (b *backend) pathACMEOrderWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	order, err := b.acmeAccountOrder(ctx, r, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return &acmeResult{
+		status: http.StatusOK,
+		body:   acmeOrderBody(r.config, order),
+	}, nil
+}
+
+func (b *backend) pathACMEFinalizeWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := r.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	order, err := b.acmeAccountOrder(ctx, r, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != acmeStatusReady {
+		return nil, acmeError("orderNotReady", http.StatusForbidden, "order is %s", order.Status)
+	}
+
+	csrBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(payload.CSR, "="))
+	if err != nil {
+		return nil, acmeError("badCSR", http.StatusBadRequest, "unable to decode CSR: %s", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, acmeError("badCSR", http.StatusBadRequest, "unable to parse CSR: %s", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, acmeError("badCSR", http.StatusBadRequest, "invalid CSR signature: %s", err)
+	}
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return nil, acmeError("badCSR", http.StatusBadRequest, "CSR must only request DNS names")
+	}
+
+	// The names of the CSR must be the identifiers of the order
+	csrNames := strutil.RemoveDuplicates(append([]string{csr.Subject.CommonName}, csr.DNSNames...), true)
+	var orderNames []string
+	for _, identifier := range order.Identifiers {
+		orderNames = append(orderNames, identifier.Value)
+	}
+	if !strutil.EquivalentSlices(csrNames, orderNames) {
+		return nil, acmeError("badCSR", http.StatusBadRequest, "names of the CSR %v do not match the identifiers of the order %v", csrNames, orderNames)
+	}
+
+	role, err := b.acmeRole(ctx, r.Storage, r.config, order.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	// The names were checked against the CSR, and certificates issued
+	// through ACME are not tied to leases
+	signRole := *role
+	signRole.UseCSRCommonName = false
+	signRole.UseCSRSANs = false
+	signRole.GenerateLease = new(bool)
+
+	// The common name is added to the SANs of the certificate
+	commonName := strings.ToLower(csr.Subject.CommonName)
+	if commonName == "" {
+		commonName = orderNames[0]
+	}
+	altNames := strutil.StrListDelete(orderNames, commonName)
+	signData := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"csr":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})),
+			"common_name": commonName,
+			"alt_names":   strings.Join(altNames, ","),
+			"format":      "pem",
+		},
+		Schema: pathSign(b).Fields,
+	}
+	resp, err := b.pathIssueSignCert(ctx, r.Request, signData, &signRole, true, false)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, acmeError("badCSR", http.StatusBadRequest, "%s", err)
+		}
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, acmeError("badCSR", http.StatusBadRequest, "%s", resp.Data["error"])
+	}
+
+	// The chain holds the issuing CA, and the rest of its chain if any
+	chain := []string{resp.Data["certificate"].(string)}
+	if caChain, ok := resp.Data["ca_chain"].([]string); ok && len(caChain) > 0 {
+		chain = append(chain, caChain...)
+	} else {
+		chain = append(chain, resp.Data["issuing_ca"].(string))
+	}
+
+	serial := resp.Data["serial_number"].(string)
+	if err := acmePut(ctx, r.Storage, acmeCertPrefix+normalizeSerial(serial), &acmeCertEntry{
+		AccountID: r.account.ID,
+		OrderID:   order.ID,
+	}); err != nil {
+		return nil, err
+	}
+
+	order.Status = acmeStatusValid
+	order.CertificateSerial = serial
+	order.Certificate = strings.Join(chain, "\n") + "\n"
+	if err := acmePut(ctx, r.Storage, acmeOrderPrefix+order.ID, order); err != nil {
+		return nil, err
+	}
+
+	return &acmeResult{
+		status:   http.StatusOK,
+		body:     acmeOrderBody(r.config, order),
+		location: acmeURL(r.config, "order", order.ID),
+	}, nil
+}
+
+func acmeChallengeBody(config *acmeConfig, authz *acmeAuthorization, challenge *acmeChallenge) map[string]interface{} {
+	body := map[string]interface{}{
+		"type":   challenge.Type,
+		"url":    acmeURL(config, "challenge", authz.ID, challenge.Type),
+		"token":  challenge.Token,
+		"status": challenge.Status,
+	}
+	if !challenge.Validated.IsZero() {
+		body["validated"] = challenge.Validated.Format(time.RFC3339)
+	}
+	if challenge.Error != nil {
+		body["error"] = challenge.Error
+	}
+	return body
+}
+
+func acmeAuthorizationBody(config *acmeConfig, authz *acmeAuthorization) map[string]interface{} {
+	var challenges []map[string]interface{}
+	for _, challenge := range authz.Challenges {
+		challenges = append(challenges, acmeChallengeBody(config, authz, challenge))
+	}
+
+	return map[string]interface{}{
+		"identifier": authz.Identifier,
+		"status":     authz.Status,
+		"expires":    authz.Expires.Format(time.RFC3339),
+		"wildcard":   authz.Wildcard,
+		"challenges": challenges,
+	}
+}
+
+// acmeAccountAuthorization fetches an authorization of the account of the
+// request
+func (b *backend) acmeAccountAuthorization(ctx context.Context, r *acmeRequest, id string) (*acmeAuthorization, error) {
+	authz, err := b.acmeFetchAuthorization(ctx, r.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+	if authz == nil || authz.AccountID != r.account.ID {
+		return nil, acmeError("malformed", http.StatusNotFound, "authorization not found")
+	}
+	return authz, nil
+}
+
+func (b *backend) pathACMEAuthorizationWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if err := r.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	authz, err := b.acmeAccountAuthorization(ctx, r, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	switch payload.Status {
+	case "":
+	case acmeStatusDeactivated:
+		if authz.Status != acmeStatusPending && authz.Status != acmeStatusValid {
+			return nil, acmeError("malformed", http.StatusBadRequest, "authorization is %s", authz.Status)
+		}
+		authz.Status = acmeStatusDeactivated
+		if err := acmePut(ctx, r.Storage, acmeAuthorizationPrefix+authz.ID, authz); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, acmeError("malformed", http.StatusBadRequest, "invalid authorization status %q", payload.Status)
+	}
+
+	return &acmeResult{
+		status: http.StatusOK,
+		body:   acmeAuthorizationBody(r.config, authz),
+	}, nil
+}
+
+func (b *backend) pathACMEChallengeWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	authzID := data.Get("id").(string)
+	challengeType := data.Get("type").(string)
+
+	authz, err := b.acmeAccountAuthorization(ctx, r, authzID)
+	if err != nil {
+		return nil, err
+	}
+	var challenge *acmeChallenge
+	for _, c := range authz.Challenges {
+		if c.Type == challengeType {
+			challenge = c
+		}
+	}
+	if challenge == nil {
+		return nil, acmeError("malformed", http.StatusNotFound, "challenge not found")
+	}
+
+	// Challenges are validated once the client asks for it, with an empty
+	// JSON object as payload
+	if !r.postAsGet() && authz.Status == acmeStatusPending && challenge.Status == acmeStatusPending {
+		validationErr := b.acmeValidateChallenge(ctx, r.config, authz, challenge, r.account.Key)
+
+		b.acmeLock.Lock()
+		defer b.acmeLock.Unlock()
+
+		// The authorization may have been validated meanwhile
+		authz, err = b.acmeAccountAuthorization(ctx, r, authzID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range authz.Challenges {
+			if c.Type == challengeType {
+				challenge = c
+			}
+		}
+
+		if authz.Status == acmeStatusPending && challenge.Status == acmeStatusPending {
+			switch validationErr.(type) {
+			case nil:
+				challenge.Status = acmeStatusValid
+				challenge.Validated = time.Now()
+				authz.Status = acmeStatusValid
+			case *acmeProblem:
+				challenge.Status = acmeStatusInvalid
+				challenge.Error = validationErr.(*acmeProblem)
+				authz.Status = acmeStatusInvalid
+			default:
+				return nil, errwrap.Wrapf("error validating challenge: {{err}}", validationErr)
+			}
+			if err := acmePut(ctx, r.Storage, acmeAuthorizationPrefix+authz.ID, authz); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &acmeResult{
+		status: http.StatusOK,
+		body:   acmeChallengeBody(r.config, authz, challenge),
+		links:  []string{fmt.Sprintf("<%s>;rel=\"up\"", acmeURL(r.config, "authorization", authz.ID))},
+	}, nil
+}
+
+func (b *backend) pathACMECertWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	order, err := b.acmeAccountOrder(ctx, r, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != acmeStatusValid {
+		return nil, acmeError("malformed", http.StatusNotFound, "certificate not found")
+	}
+
+	return &acmeResult{
+		status:      http.StatusOK,
+		contentType: "application/pem-certificate-chain",
+		rawBody:     []byte(order.Certificate),
+	}, nil
+}
+
+func (b *backend) pathACMERevokeCertWrite(ctx context.Context, r *acmeRequest, data *framework.FieldData) (*acmeResult, error) {
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}
+	if err := r.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	certBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(payload.Certificate, "="))
+	if err != nil {
+		return nil, acmeError("malformed", http.StatusBadRequest, "unable to decode certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, acmeError("malformed", http.StatusBadRequest, "unable to parse certificate: %s", err)
+	}
+	// Reason 7 is unused, as described in RFC 5280
+	if payload.Reason < 0 || payload.Reason == 7 || payload.Reason > 10 {
+		return nil, acmeError("badRevocationReason", http.StatusBadRequest, "invalid revocation reason %d", payload.Reason)
+	}
+	serial := certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":")
+
+	// Expired certificates are not revoked, as they no longer appear on the
+	// CRLs
+	if cert.NotAfter.Before(time.Now()) {
+		return nil, acmeError("malformed", http.StatusBadRequest, "certificate has expired")
+	}
+
+	certEntry, err := fetchCertBySerial(ctx, r.Request, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry == nil || string(certEntry.Value) != string(cert.Raw) {
+		return nil, acmeError("unauthorized", http.StatusForbidden, "certificate was not issued by this mount")
+	}
+
+	// Certificates can be revoked by the account that ordered them, or with
+	// their own key
+	if r.account != nil {
+		var entry acmeCertEntry
+		ok, err := acmeGet(ctx, r.Storage, acmeCertPrefix+normalizeSerial(serial), &entry)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || entry.AccountID != r.account.ID {
+			return nil, acmeError("unauthorized", http.StatusForbidden, "certificate was not ordered by the account")
+		}
+	} else {
+		certKey := &jose.JSONWebKey{Key: cert.PublicKey}
+		certThumbprint, err := certKey.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, acmeError("unauthorized", http.StatusForbidden, "unsupported certificate key: %s", err)
+		}
+		thumbprint, err := r.jwk.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		if string(certThumbprint) != string(thumbprint) {
+			return nil, acmeError("unauthorized", http.StatusForbidden, "request is not signed by the key of the certificate")
+		}
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	revEntry, err := fetchCertBySerial(ctx, r.Request, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if revEntry != nil {
+		return nil, acmeError("alreadyRevoked", http.StatusBadRequest, "certificate is already revoked")
+	}
+
+	resp, err := revokeCert(ctx, b, r.Request, serial, payload.Reason, false)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		// The certificate expired meanwhile
+		return nil, acmeError("malformed", http.StatusBadRequest, "certificate was not revoked")
+	}
+	if resp.IsError() {
+		return nil, acmeError("malformed", http.StatusBadRequest, "%s", resp.Data["error"])
+	}
+
+	return &acmeResult{
+		status: http.StatusOK,
+	}, nil
+}
+
+const pathACMEDirectoryHelpSyn = `
+Fetch the directory of the ACME server.
+`
+
+const pathACMEDirectoryHelpDesc = `
+This endpoint returns the directory of the ACME server of the mount, described
+in RFC 8555, listing the URLs of its endpoints. Orders placed through the
+directory are issued by the default role of the ACME configuration, while
+orders placed through the directory of a role under "acme/roles/<role>/" are
+issued by that role.
+`
+
+const pathACMEHelpSyn = `
+Endpoint of the ACME server.
+`
+
+const pathACMEHelpDesc = `
+This endpoint is part of the ACME server of the mount, described in RFC 8555.
+Requests are sent by ACME clients as JWS signed by the key of their account,
+and responses are served in the format described by the RFC.
+`
@@ -0,0 +1,438 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+	"golang.org/x/crypto/acme"
+)
+
+// acmeTestResponder serves the responses of http-01 challenges, and the TXT
+// records of dns-01 challenges
+type acmeTestResponder struct {
+	sync.Mutex
+	tokens  map[string]string
+	records map[string][]string
+}
+
+func (r *acmeTestResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	keyAuth, ok := r.tokens[strings.TrimPrefix(req.URL.Path, "/.well-known/acme-challenge/")]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Write([]byte(keyAuth))
+}
+
+func (r *acmeTestResponder) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.records[name], nil
+}
+
+func acmeTestCSR(t *testing.T, commonName string, dnsNames ...string) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, csr
+}
+
+func acmeTestProblem(t *testing.T, err error, problemType string) {
+	acmeErr, ok := err.(*acme.Error)
+	if !ok || acmeErr.ProblemType != "urn:ietf:params:acme:error:"+problemType {
+		t.Fatalf("expected %s problem, got: %v", problemType, err)
+	}
+}
+
+func TestPki_ACME(t *testing.T) {
+	responder := &acmeTestResponder{
+		tokens:  make(map[string]string),
+		records: make(map[string][]string),
+	}
+	challengeServer := httptest.NewServer(responder)
+	defer challengeServer.Close()
+
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": func(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
+				b := Backend()
+				// Challenges of every domain are served by the local server
+				b.acmeHTTPClient = &http.Client{
+					Transport: &http.Transport{
+						DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+							var d net.Dialer
+							return d.DialContext(ctx, network, challengeServer.Listener.Addr().String())
+						},
+					},
+				}
+				b.acmeTXTResolver = responder
+				if err := b.Setup(ctx, conf); err != nil {
+					return nil, err
+				}
+				return b, nil
+			},
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	if err := client.Sys().Mount("pki", &api.MountInput{
+		Type: "pki",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "48h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := parseTestCert(t, resp.Data["certificate"].(string))
+	for _, role := range []string{"example", "other"} {
+		if _, err := client.Logical().Write("pki/roles/"+role, map[string]interface{}{
+			"allowed_domains":  "example.com",
+			"allow_subdomains": true,
+			"max_ttl":          "1h",
+			"key_type":         "ec",
+			"key_bits":         256,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	baseURL := client.Address() + "/v1/pki"
+	if _, err := client.Logical().Write("pki/config/acme", map[string]interface{}{
+		"enabled":       true,
+		"base_url":      baseURL,
+		"default_role":  "example",
+		"allowed_roles": "example",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cluster.CACert)
+	newClient := func(directory string) *acme.Client {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &acme.Client{
+			Key:          key,
+			DirectoryURL: baseURL + "/acme/" + directory,
+			HTTPClient: &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{RootCAs: pool},
+				},
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	acmeClient := newClient("directory")
+	account, err := acmeClient.Register(ctx, &acme.Account{
+		Contact: []string{"mailto:admin@example.com"},
+	}, acme.AcceptTOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Status != acme.StatusValid || !strings.HasPrefix(account.URI, baseURL+"/acme/account/") {
+		t.Fatalf("bad: account: %#v", account)
+	}
+	if _, err := acmeClient.Register(ctx, &acme.Account{}, acme.AcceptTOS); err != acme.ErrAccountAlreadyExists {
+		t.Fatalf("expected existing account, got: %v", err)
+	}
+
+	// issue issues a certificate for the names, fulfilling the challenges
+	// of the given type
+	issue := func(challengeType string, names ...string) [][]byte {
+		order, err := acmeClient.AuthorizeOrder(ctx, acme.DomainIDs(names...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, authzURL := range order.AuthzURLs {
+			authz, err := acmeClient.GetAuthorization(ctx, authzURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var challenge *acme.Challenge
+			for _, c := range authz.Challenges {
+				if c.Type == challengeType {
+					challenge = c
+				}
+			}
+			if challenge == nil {
+				t.Fatalf("no %s challenge for %s", challengeType, authz.Identifier.Value)
+			}
+
+			responder.Lock()
+			switch challengeType {
+			case "http-01":
+				responder.tokens[challenge.Token], err = acmeClient.HTTP01ChallengeResponse(challenge.Token)
+			case "dns-01":
+				var record string
+				record, err = acmeClient.DNS01ChallengeRecord(challenge.Token)
+				responder.records["_acme-challenge."+authz.Identifier.Value] = []string{record}
+			}
+			responder.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := acmeClient.Accept(ctx, challenge); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := acmeClient.WaitAuthorization(ctx, authzURL); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := acmeClient.WaitOrder(ctx, order.URI); err != nil {
+			t.Fatal(err)
+		}
+
+		_, csr := acmeTestCSR(t, names[0], names...)
+		chain, _, err := acmeClient.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chain) != 2 {
+			t.Fatalf("bad: chain length: %d", len(chain))
+		}
+		leaf, err := x509.ParseCertificate(chain[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := leaf.CheckSignatureFrom(root); err != nil {
+			t.Fatal(err)
+		}
+		if leaf.Subject.CommonName != names[0] || len(leaf.DNSNames) != len(names) {
+			t.Fatalf("bad: names: %s %v", leaf.Subject.CommonName, leaf.DNSNames)
+		}
+		return chain
+	}
+
+	httpChain := issue("http-01", "www.example.com", "api.example.com")
+	issue("dns-01", "*.foo.example.com")
+
+	// Wildcard names are only offered dns-01 challenges
+	wildcardOrder, err := acmeClient.AuthorizeOrder(ctx, acme.DomainIDs("*.bar.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz, err := acmeClient.GetAuthorization(ctx, wildcardOrder.AuthzURLs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authz.Wildcard || authz.Identifier.Value != "bar.example.com" || len(authz.Challenges) != 1 || authz.Challenges[0].Type != "dns-01" {
+		t.Fatalf("bad: wildcard authorization: %#v", authz)
+	}
+
+	// Failed challenges invalidate their order
+	failedOrder, err := acmeClient.AuthorizeOrder(ctx, acme.DomainIDs("bad.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz, err = acmeClient.GetAuthorization(ctx, failedOrder.AuthzURLs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			if _, err := acmeClient.Accept(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := acmeClient.WaitAuthorization(ctx, failedOrder.AuthzURLs[0]); err == nil {
+		t.Fatal("expected failed authorization")
+	}
+	failedOrder, err = acmeClient.GetOrder(ctx, failedOrder.URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failedOrder.Status != acme.StatusInvalid {
+		t.Fatalf("bad: order status: %s", failedOrder.Status)
+	}
+
+	// Names must be allowed by the role, and roles allowed through ACME
+	_, err = acmeClient.AuthorizeOrder(ctx, acme.DomainIDs("www.example.org"))
+	acmeTestProblem(t, err, "rejectedIdentifier")
+	_, err = newClient("roles/other/directory").Discover(ctx)
+	acmeTestProblem(t, err, "unauthorized")
+
+	// The CSR must request the names of the order
+	pendingOrder, err := acmeClient.AuthorizeOrder(ctx, acme.DomainIDs("csr.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, csr := acmeTestCSR(t, "csr.example.com")
+	_, _, err = acmeClient.CreateOrderCert(ctx, pendingOrder.FinalizeURL, csr, true)
+	acmeTestProblem(t, err, "orderNotReady")
+
+	// Certificates can be revoked by their account, or with their key
+	if err := acmeClient.RevokeCert(ctx, nil, httpChain[0], acme.CRLReasonUnspecified); err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(httpChain[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := client.Logical().Read("pki/cert/crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedCRL, err := x509.ParseCRL([]byte(crl.Data["certificate"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := parsedCRL.TBSCertList.RevokedCertificates
+	if len(revoked) != 1 || revoked[0].SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Fatalf("bad: CRL entries: %#v", revoked)
+	}
+
+	otherClient := newClient("directory")
+	if _, err := otherClient.Register(ctx, &acme.Account{}, acme.AcceptTOS); err != nil {
+		t.Fatal(err)
+	}
+	err = otherClient.RevokeCert(ctx, nil, issue("http-01", "www.example.com")[0], acme.CRLReasonUnspecified)
+	acmeTestProblem(t, err, "unauthorized")
+
+	key, csr := acmeTestCSR(t, "key.example.com")
+	keyOrder, err := acmeClient.AuthorizeOrder(ctx, acme.DomainIDs("key.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authz, err = acmeClient.GetAuthorization(ctx, keyOrder.AuthzURLs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			record, err := acmeClient.DNS01ChallengeRecord(c.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			responder.Lock()
+			responder.records["_acme-challenge.key.example.com"] = []string{record}
+			responder.Unlock()
+			if _, err := acmeClient.Accept(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	keyChain, _, err := acmeClient.CreateOrderCert(ctx, keyOrder.FinalizeURL, csr, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := otherClient.RevokeCert(ctx, key, keyChain[0], acme.CRLReasonKeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+	keyLeaf, err := x509.ParseCertificate(keyChain[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err = client.Logical().Read("pki/cert/crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedCRL, err = x509.ParseCRL([]byte(crl.Data["certificate"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reason asn1.Enumerated
+	for _, revoked := range parsedCRL.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(keyLeaf.SerialNumber) != 0 {
+			continue
+		}
+		for _, ext := range revoked.Extensions {
+			if ext.Id.Equal(oidExtensionReasonCode) {
+				if _, err := asn1.Unmarshal(ext.Value, &reason); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	if reason != asn1.Enumerated(acme.CRLReasonKeyCompromise) {
+		t.Fatalf("bad: CRL reason: %d", reason)
+	}
+
+	// Expired certificates cannot be revoked
+	if _, err := client.Logical().Write("pki/roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"max_ttl":          "1s",
+		"key_type":         "ec",
+		"key_bits":         256,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expiredChain := issue("http-01", "expired.example.com")
+	time.Sleep(2 * time.Second)
+	err = acmeClient.RevokeCert(ctx, nil, expiredChain[0], acme.CRLReasonUnspecified)
+	acmeTestProblem(t, err, "malformed")
+}
+
+func TestPki_ACMENonces(t *testing.T) {
+	nonces := newACMENonces()
+
+	first, err := nonces.issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last string
+	for i := 0; i < acmeMaxNonces; i++ {
+		if last, err = nonces.issue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the latest nonces are held, each of which can be used once
+	if nonces.nonces.Len() != acmeMaxNonces {
+		t.Fatalf("expected %d nonces held, got %d", acmeMaxNonces, nonces.nonces.Len())
+	}
+	if nonces.redeem(first) {
+		t.Fatal("oldest nonce was not dropped")
+	}
+	if !nonces.redeem(last) {
+		t.Fatal("latest nonce was not accepted")
+	}
+	if nonces.redeem(last) {
+		t.Fatal("nonce was accepted twice")
+	}
+}
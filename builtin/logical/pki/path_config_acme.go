@@ -0,0 +1,179 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const acmeConfigPath = "config/acme"
+
+func pathConfigACME(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/acme",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Whether the ACME server of the mount is enabled`,
+			},
+
+			"base_url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `URL of the mount as reached by ACME clients, e.g.
+https://vault.example.com:8200/v1/pki. It prefixes the URLs of the
+ACME server, which must match the URLs signed by clients.`,
+			},
+
+			"default_role": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Role issuing the certificates of orders placed
+through the acme/directory endpoint. If empty, only the role
+directories under acme/roles/<role>/directory can be used.`,
+			},
+
+			"allowed_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the roles that can be
+used through ACME. "*" allows every role. Defaults to "*".`,
+			},
+
+			"dns_resolver": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Address, as host:port, of the DNS server queried
+to validate dns-01 challenges. Defaults to the resolver of the
+system.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathWriteACMEConfig,
+			logical.ReadOperation:   b.pathReadACMEConfig,
+		},
+
+		HelpSynopsis:    pathConfigACMEHelpSyn,
+		HelpDescription: pathConfigACMEHelpDesc,
+	}
+}
+
+type acmeConfig struct {
+	Enabled      bool     `json:"enabled" structs:"enabled" mapstructure:"enabled"`
+	BaseURL      string   `json:"base_url" structs:"base_url" mapstructure:"base_url"`
+	DefaultRole  string   `json:"default_role" structs:"default_role" mapstructure:"default_role"`
+	AllowedRoles []string `json:"allowed_roles" structs:"allowed_roles" mapstructure:"allowed_roles"`
+	DNSResolver  string   `json:"dns_resolver" structs:"dns_resolver" mapstructure:"dns_resolver"`
+}
+
+// roleAllowed returns whether the role can be used through ACME
+func (c *acmeConfig) roleAllowed(name string) bool {
+	for _, allowed := range c.AllowedRoles {
+		if allowed == "*" || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+func getACMEConfig(ctx context.Context, s logical.Storage) (*acmeConfig, error) {
+	config := &acmeConfig{
+		AllowedRoles: []string{"*"},
+	}
+
+	entry, err := s.Get(ctx, acmeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func (b *backend) pathReadACMEConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getACMEConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: structs.New(config).Map(),
+	}, nil
+}
+
+func (b *backend) pathWriteACMEConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getACMEConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if baseURLRaw, ok := data.GetOk("base_url"); ok {
+		config.BaseURL = strings.TrimSuffix(baseURLRaw.(string), "/")
+	}
+	if defaultRoleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = defaultRoleRaw.(string)
+	}
+	if allowedRolesRaw, ok := data.GetOk("allowed_roles"); ok {
+		config.AllowedRoles = allowedRolesRaw.([]string)
+	}
+	if dnsResolverRaw, ok := data.GetOk("dns_resolver"); ok {
+		config.DNSResolver = dnsResolverRaw.(string)
+	}
+
+	if config.BaseURL != "" && !govalidator.IsURL(config.BaseURL) {
+		return logical.ErrorResponse(fmt.Sprintf("invalid base URL: %s", config.BaseURL)), nil
+	}
+	if config.Enabled && config.BaseURL == "" {
+		return logical.ErrorResponse("a base URL is required to enable ACME"), nil
+	}
+	if config.DNSResolver != "" {
+		if _, _, err := net.SplitHostPort(config.DNSResolver); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid DNS resolver address %q: %s", config.DNSResolver, err)), nil
+		}
+	}
+	if config.DefaultRole != "" {
+		role, err := b.getRole(ctx, req.Storage, config.DefaultRole)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", config.DefaultRole)), nil
+		}
+		if !config.roleAllowed(config.DefaultRole) {
+			return logical.ErrorResponse(fmt.Sprintf("default role %s is not part of the allowed roles", config.DefaultRole)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(acmeConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigACMEHelpSyn = `
+Configure the ACME server of the mount.
+`
+
+const pathConfigACMEHelpDesc = `
+This endpoint enables the ACME server of the mount, described in RFC 8555,
+which issues certificates through the roles of the mount to clients proving
+control of the requested domains with http-01 or dns-01 challenges.
+
+As ACME clients sign the URLs they request, the server must know its URL as
+reached by clients, given by "base_url".
+`
@@ -0,0 +1,152 @@
+package pki
+
+import (
+	"context"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const autoTidyConfigPath = "config/auto-tidy"
+
+func pathConfigAutoTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/auto-tidy",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Set to true to enable the automatic tidy operation`,
+			},
+
+			"interval_duration": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The interval between the automatic tidy
+operations. Defaults to 12 hours.`,
+				Default: 43200, // 12h
+			},
+
+			"tidy_cert_store": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Set to true to enable tidying up
+the certificate store`,
+			},
+
+			"tidy_revocation_list": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Set to true to enable tidying up
+the revocation list`,
+			},
+
+			"safety_buffer": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The amount of extra time that must have passed
+beyond certificate expiration before it is removed
+from the backend storage and/or revocation list.
+Defaults to 72 hours.`,
+				Default: 259200, // 72h
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigAutoTidyRead,
+			logical.UpdateOperation: b.pathConfigAutoTidyWrite,
+		},
+
+		HelpSynopsis:    pathConfigAutoTidySyn,
+		HelpDescription: pathConfigAutoTidyDesc,
+	}
+}
+
+type autoTidyConfig struct {
+	Enabled            bool `json:"enabled" structs:"enabled" mapstructure:"enabled"`
+	Interval           int  `json:"interval_duration" structs:"interval_duration" mapstructure:"interval_duration"`
+	TidyCertStore      bool `json:"tidy_cert_store" structs:"tidy_cert_store" mapstructure:"tidy_cert_store"`
+	TidyRevocationList bool `json:"tidy_revocation_list" structs:"tidy_revocation_list" mapstructure:"tidy_revocation_list"`
+	SafetyBuffer       int  `json:"safety_buffer" structs:"safety_buffer" mapstructure:"safety_buffer"`
+}
+
+func getAutoTidyConfig(ctx context.Context, s logical.Storage) (*autoTidyConfig, error) {
+	config := &autoTidyConfig{
+		Interval:     43200,
+		SafetyBuffer: 259200,
+	}
+
+	entry, err := s.Get(ctx, autoTidyConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func (b *backend) pathConfigAutoTidyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: structs.New(config).Map(),
+	}, nil
+}
+
+func (b *backend) pathConfigAutoTidyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if intervalRaw, ok := data.GetOk("interval_duration"); ok {
+		config.Interval = intervalRaw.(int)
+	}
+	if tidyCertStoreRaw, ok := data.GetOk("tidy_cert_store"); ok {
+		config.TidyCertStore = tidyCertStoreRaw.(bool)
+	}
+	if tidyRevocationListRaw, ok := data.GetOk("tidy_revocation_list"); ok {
+		config.TidyRevocationList = tidyRevocationListRaw.(bool)
+	}
+	if safetyBufferRaw, ok := data.GetOk("safety_buffer"); ok {
+		config.SafetyBuffer = safetyBufferRaw.(int)
+	}
+
+	if config.Interval < 1 {
+		return logical.ErrorResponse("interval_duration must be greater than zero"), nil
+	}
+	if config.SafetyBuffer < 1 {
+		return logical.ErrorResponse("safety_buffer must be greater than zero"), nil
+	}
+	if config.Enabled && !config.TidyCertStore && !config.TidyRevocationList {
+		return logical.ErrorResponse("auto-tidy requires tidy_cert_store or tidy_revocation_list to be set"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(autoTidyConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigAutoTidySyn = `
+Configure the automatic tidy operation of the mount.
+`
+
+const pathConfigAutoTidyDesc = `
+This endpoint enables the automatic tidy operation, which runs the operation of
+the "tidy" endpoint in the background every "interval_duration", with the
+given "tidy_cert_store", "tidy_revocation_list" and "safety_buffer" parameters.
+
+The progress of the operation is reported by the "tidy-status" endpoint.
+`
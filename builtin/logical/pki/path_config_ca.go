@@ -65,27 +65,21 @@ func (b *backend) pathCAWrite(ctx context.Context, req *logical.Request, data *f
 		return nil, errwrap.Wrapf("error converting raw values into cert bundle: {{err}}", err)
 	}
 
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
+	if _, _, err := b.importKey(ctx, req.Storage, cb.PrivateKeyType, cb.PrivateKey); err != nil {
 		return nil, err
 	}
-	err = req.Storage.Put(ctx, entry)
+	resp, err := b.importIssuers(ctx, req.Storage, cb)
 	if err != nil {
 		return nil, err
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location, plus a fresh CRL
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
+	// Build a fresh CRL
+	err = buildCRL(ctx, b, req)
 	if err != nil {
 		return nil, err
 	}
 
-	err = buildCRL(ctx, b, req)
-
-	return nil, err
+	return resp, nil
 }
 
 const pathConfigCAHelpSyn = `
@@ -97,6 +91,10 @@ This sets the CA information used for credentials generated by this
 by this mount. This must be a PEM-format, concatenated unencrypted
 secret key and certificate.
 
+The certificate and any other certificate of its chain found in the bundle are
+stored as issuers of the mount. If the mount has no default issuer yet, the
+certificate becomes the default one.
+
 For security reasons, the secret key cannot be retrieved later.
 `
 
@@ -5,13 +5,30 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
 
 // CRLConfig holds basic CRL configuration information
 type crlConfig struct {
-	Expiry string `json:"expiry" mapstructure:"expiry" structs:"expiry"`
+	Expiry                 string `json:"expiry" mapstructure:"expiry" structs:"expiry"`
+	AutoRebuild            bool   `json:"auto_rebuild" mapstructure:"auto_rebuild" structs:"auto_rebuild"`
+	AutoRebuildGracePeriod string `json:"auto_rebuild_grace_period" mapstructure:"auto_rebuild_grace_period" structs:"auto_rebuild_grace_period"`
+	EnableDelta            bool   `json:"enable_delta" mapstructure:"enable_delta" structs:"enable_delta"`
+	DeltaRebuildInterval   string `json:"delta_rebuild_interval" mapstructure:"delta_rebuild_interval" structs:"delta_rebuild_interval"`
+	OcspExpiry             string `json:"ocsp_expiry" mapstructure:"ocsp_expiry" structs:"ocsp_expiry"`
+}
+
+// defaultCRLConfig returns the CRL configuration of mounts which did not
+// configure it
+func defaultCRLConfig() *crlConfig {
+	return &crlConfig{
+		Expiry:                 "72h",
+		AutoRebuildGracePeriod: "12h",
+		DeltaRebuildInterval:   "15m",
+		OcspExpiry:             "12h",
+	}
 }
 
 func pathConfigCRL(b *backend) *framework.Path {
@@ -24,6 +41,46 @@ func pathConfigCRL(b *backend) *framework.Path {
 valid; defaults to 72 hours`,
 				Default: "72h",
 			},
+
+			"auto_rebuild": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, CRLs are rebuilt periodically before they
+expire instead of on every revocation, so that
+revocations only show on the CRLs once they are
+rebuilt; defaults to false`,
+			},
+
+			"auto_rebuild_grace_period": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The amount of time before the expiry of the CRLs
+at which they are rebuilt when auto_rebuild is
+set; defaults to 12 hours`,
+				Default: "12h",
+			},
+
+			"enable_delta": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, delta CRLs listing the revocations since
+the last build of the CRLs are built between the
+automatic rebuilds; requires auto_rebuild and
+defaults to false`,
+			},
+
+			"delta_rebuild_interval": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The interval at which delta CRLs are rebuilt when
+new certificates were revoked; defaults to 15
+minutes`,
+				Default: "15m",
+			},
+
+			"ocsp_expiry": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The amount of time OCSP responses are valid, after
+which clients should query the status of
+certificates again; defaults to 12 hours`,
+				Default: "12h",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -36,21 +93,63 @@ valid; defaults to 72 hours`,
 	}
 }
 
+// CRL returns the CRL configuration of the mount, with the defaults of the
+// settings it does not hold
 func (b *backend) CRL(ctx context.Context, s logical.Storage) (*crlConfig, error) {
+	result := defaultCRLConfig()
+
 	entry, err := s.Get(ctx, "config/crl")
 	if err != nil {
 		return nil, err
 	}
 	if entry == nil {
-		return nil, nil
+		return result, nil
 	}
 
-	var result crlConfig
-	if err := entry.DecodeJSON(&result); err != nil {
+	if err := entry.DecodeJSON(result); err != nil {
 		return nil, err
 	}
 
-	return &result, nil
+	// Entries stored by previous versions only hold the expiry
+	defaults := defaultCRLConfig()
+	if result.AutoRebuildGracePeriod == "" {
+		result.AutoRebuildGracePeriod = defaults.AutoRebuildGracePeriod
+	}
+	if result.DeltaRebuildInterval == "" {
+		result.DeltaRebuildInterval = defaults.DeltaRebuildInterval
+	}
+	if result.OcspExpiry == "" {
+		result.OcspExpiry = defaults.OcspExpiry
+	}
+
+	return result, nil
+}
+
+// durations parses the expiry, grace period and delta rebuild interval of
+// the configuration
+func (c *crlConfig) durations() (expiry, gracePeriod, deltaInterval time.Duration, err error) {
+	expiry, err = time.ParseDuration(c.Expiry)
+	if err != nil {
+		return 0, 0, 0, errutil.UserError{Err: fmt.Sprintf("Given expiry could not be decoded: %s", err)}
+	}
+	gracePeriod, err = time.ParseDuration(c.AutoRebuildGracePeriod)
+	if err != nil {
+		return 0, 0, 0, errutil.UserError{Err: fmt.Sprintf("Given auto rebuild grace period could not be decoded: %s", err)}
+	}
+	deltaInterval, err = time.ParseDuration(c.DeltaRebuildInterval)
+	if err != nil {
+		return 0, 0, 0, errutil.UserError{Err: fmt.Sprintf("Given delta rebuild interval could not be decoded: %s", err)}
+	}
+	return expiry, gracePeriod, deltaInterval, nil
+}
+
+// ocspExpiryDuration parses the lifetime of OCSP responses
+func (c *crlConfig) ocspExpiryDuration() (time.Duration, error) {
+	expiry, err := time.ParseDuration(c.OcspExpiry)
+	if err != nil {
+		return 0, errutil.UserError{Err: fmt.Sprintf("Given OCSP expiry could not be decoded: %s", err)}
+	}
+	return expiry, nil
 }
 
 func (b *backend) pathCRLRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -58,27 +157,64 @@ func (b *backend) pathCRLRead(ctx context.Context, req *logical.Request, data *f
 	if err != nil {
 		return nil, err
 	}
-	if config == nil {
-		return nil, nil
-	}
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"expiry": config.Expiry,
+			"expiry":                    config.Expiry,
+			"auto_rebuild":              config.AutoRebuild,
+			"auto_rebuild_grace_period": config.AutoRebuildGracePeriod,
+			"enable_delta":              config.EnableDelta,
+			"delta_rebuild_interval":    config.DeltaRebuildInterval,
+			"ocsp_expiry":               config.OcspExpiry,
 		},
 	}, nil
 }
 
 func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	expiry := d.Get("expiry").(string)
-
-	_, err := time.ParseDuration(expiry)
+	config, err := b.CRL(ctx, req.Storage)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("Given expiry could not be decoded: %s", err)), nil
+		return nil, err
+	}
+	previous := *config
+
+	if expiryRaw, ok := d.GetOk("expiry"); ok {
+		config.Expiry = expiryRaw.(string)
+	}
+	if autoRebuildRaw, ok := d.GetOk("auto_rebuild"); ok {
+		config.AutoRebuild = autoRebuildRaw.(bool)
+	}
+	if gracePeriodRaw, ok := d.GetOk("auto_rebuild_grace_period"); ok {
+		config.AutoRebuildGracePeriod = gracePeriodRaw.(string)
+	}
+	if enableDeltaRaw, ok := d.GetOk("enable_delta"); ok {
+		config.EnableDelta = enableDeltaRaw.(bool)
+	}
+	if deltaIntervalRaw, ok := d.GetOk("delta_rebuild_interval"); ok {
+		config.DeltaRebuildInterval = deltaIntervalRaw.(string)
+	}
+	if ocspExpiryRaw, ok := d.GetOk("ocsp_expiry"); ok {
+		config.OcspExpiry = ocspExpiryRaw.(string)
 	}
 
-	config := &crlConfig{
-		Expiry: expiry,
+	expiry, gracePeriod, deltaInterval, err := config.durations()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if config.AutoRebuild && gracePeriod >= expiry {
+		return logical.ErrorResponse("auto_rebuild_grace_period must be shorter than the expiry"), nil
+	}
+	if config.EnableDelta && !config.AutoRebuild {
+		return logical.ErrorResponse("enable_delta requires auto_rebuild, as CRLs are otherwise rebuilt on every revocation"), nil
+	}
+	if config.EnableDelta && deltaInterval <= 0 {
+		return logical.ErrorResponse("delta_rebuild_interval must be positive"), nil
+	}
+	ocspExpiry, err := config.ocspExpiryDuration()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if ocspExpiry <= 0 {
+		return logical.ErrorResponse("ocsp_expiry must be positive"), nil
 	}
 
 	entry, err := logical.StorageEntryJSON("config/crl", config)
@@ -90,13 +226,39 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		return nil, err
 	}
 
+	// Revocations held back by the automatic rebuild are published right
+	// away once it is disabled, and delta CRLs are built or removed
+	if previous.AutoRebuild != config.AutoRebuild || previous.EnableDelta != config.EnableDelta {
+		b.revokeStorageLock.Lock()
+		defer b.revokeStorageLock.Unlock()
+
+		switch crlErr := buildCRL(ctx, b, req); crlErr.(type) {
+		case nil:
+		case errutil.UserError:
+			// There is no CA to build CRLs for yet
+		default:
+			return nil, crlErr
+		}
+	}
+
 	return nil, nil
 }
 
 const pathConfigCRLHelpSyn = `
-Configure the CRL expiration.
+Configure the CRL expiration and rebuilds.
 `
 
 const pathConfigCRLHelpDesc = `
 This endpoint allows configuration of the CRL lifetime.
+
+By default CRLs are rebuilt on every revocation. With "auto_rebuild" set, they
+are instead rebuilt periodically, "auto_rebuild_grace_period" before they
+expire, which spares rebuilding large CRLs on every revocation. Revocations
+then only show on the CRLs once they are rebuilt, unless "enable_delta" is set:
+delta CRLs, listing the certificates revoked since the last build of the CRLs,
+are then rebuilt every "delta_rebuild_interval" when certificates were revoked.
+Delta CRLs are served by the "crl/delta" and "issuer/:issuer_ref/crl/delta"
+endpoints.
+
+OCSP responses are valid for "ocsp_expiry".
 `
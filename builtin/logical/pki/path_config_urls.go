@@ -159,4 +159,7 @@ certificates. To delete URLs, simply re-set the appropriate value with an
 empty string.
 
 Multiple URLs can be specified for each type; use commas to separate them.
+
+This backend answers OCSP requests on its "ocsp" endpoint, whose URL can be
+used as an OCSP server, e.g. "https://vault.example.com:8200/v1/pki/ocsp".
 `
@@ -53,6 +53,20 @@ func pathFetchCRL(b *backend) *framework.Path {
 	}
 }
 
+// Returns the delta CRL in raw format
+func pathFetchDeltaCRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `crl/delta(/pem)?`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchRead,
+		},
+
+		HelpSynopsis:    pathFetchHelpSyn,
+		HelpDescription: pathFetchHelpDesc,
+	}
+}
+
 // Returns any valid (non-revoked) cert. Since "ca" fits the pattern, this path
 // also handles returning the CA cert in a non-raw format.
 func pathFetchValid(b *backend) *framework.Path {
@@ -145,6 +159,12 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 		if req.Path == "crl/pem" {
 			pemType = "X509 CRL"
 		}
+	case req.Path == "crl/delta" || req.Path == "crl/delta/pem":
+		serial = "delta_crl"
+		contentType = "application/pkix-crl"
+		if req.Path == "crl/delta/pem" {
+			pemType = "X509 CRL"
+		}
 	case req.Path == "cert/crl":
 		serial = "crl"
 		pemType = "X509 CRL"
@@ -158,7 +178,7 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 	}
 
 	if serial == "ca_chain" {
-		caInfo, err := fetchCAInfo(ctx, req)
+		caInfo, err := b.fetchCAInfo(ctx, req, defaultRef)
 		switch err.(type) {
 		case errutil.UserError:
 			response = logical.ErrorResponse(err.Error())
@@ -181,7 +201,17 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 		goto reply
 	}
 
-	certEntry, funcErr = fetchCertBySerial(ctx, req, req.Path, serial)
+	switch serial {
+	case "ca":
+		// These belong to the default issuer
+		certEntry, funcErr = b.fetchIssuerCertOrCRL(ctx, req.Storage, defaultRef, "")
+	case "crl":
+		certEntry, funcErr = b.fetchIssuerCertOrCRL(ctx, req.Storage, defaultRef, crlPrefix)
+	case "delta_crl":
+		certEntry, funcErr = b.fetchIssuerCertOrCRL(ctx, req.Storage, defaultRef, deltaCRLPrefix)
+	default:
+		certEntry, funcErr = fetchCertBySerial(ctx, req, req.Path, serial)
+	}
 	if funcErr != nil {
 		switch funcErr.(type) {
 		case errutil.UserError:
@@ -272,5 +302,10 @@ This allows certificates to be fetched. If using the fetch/ prefix any non-revok
 
 Using "ca" or "crl" as the value fetches the appropriate information in DER encoding. Add "/pem" to either to get PEM encoding.
 
+Using "crl/delta" fetches the delta CRL, when enabled in config/crl, in DER encoding. Add "/pem" to get PEM encoding.
+
 Using "ca_chain" as the value fetches the certificate authority trust chain in PEM encoding.
+
+The CA, CRL and CA chain are those of the default issuer of the mount; use the
+"issuer/<ref>" endpoints to fetch those of other issuers.
 `
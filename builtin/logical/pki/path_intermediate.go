@@ -2,8 +2,12 @@ package pki
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/certutil"
@@ -62,6 +66,34 @@ endpoint.`,
 	return ret
 }
 
+func pathCrossSignIntermediate(b *backend) *framework.Path {
+	ret := &framework.Path{
+		Pattern: "intermediate/cross-sign",
+
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     defaultRef,
+				Description: `Reference, by name or ID, to the issuer to be cross-signed.`,
+			},
+			"format": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "pem",
+				Description: `Format for the returned CSR. Can be "pem" or "der". Defaults to "pem".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCrossSignIntermediate,
+		},
+
+		HelpSynopsis:    pathCrossSignIntermediateHelpSyn,
+		HelpDescription: pathCrossSignIntermediateHelpDesc,
+	}
+
+	return ret
+}
+
 func (b *backend) pathGenerateIntermediate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var err error
 
@@ -126,18 +158,13 @@ func (b *backend) pathGenerateIntermediate(ctx context.Context, req *logical.Req
 		}
 	}
 
-	cb := &certutil.CertBundle{}
-	cb.PrivateKey = csrb.PrivateKey
-	cb.PrivateKeyType = csrb.PrivateKeyType
-
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(ctx, entry)
+	// Store the key, to be used by the issuer created once the signed
+	// certificate is set
+	key, _, err := b.importKey(ctx, req.Storage, csrb.PrivateKeyType, csrb.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
+	resp.Data["key_id"] = key.ID
 
 	return resp, nil
 }
@@ -163,78 +190,119 @@ func (b *backend) pathSetSignedIntermediate(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("supplied certificate could not be successfully parsed"), nil
 	}
 
-	cb := &certutil.CertBundle{}
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
-	if err != nil {
-		return nil, err
-	}
-	if entry == nil {
-		return logical.ErrorResponse("could not find any existing entry with a private key"), nil
+	if !inputBundle.Certificate.IsCA {
+		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
 	}
 
-	err = entry.DecodeJSON(cb)
+	key, err := b.findKeyForPublicKey(ctx, req.Storage, inputBundle.Certificate.PublicKey)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
-		return logical.ErrorResponse("could not find an existing private key"), nil
+	if key == nil {
+		return logical.ErrorResponse("could not find an existing private key matching the certificate"), nil
 	}
 
-	parsedCB, err := cb.ToParsedCertBundle()
+	signer, err := key.parseKey()
 	if err != nil {
-		return nil, err
-	}
-	if parsedCB.PrivateKey == nil {
-		return nil, fmt.Errorf("saved key could not be parsed successfully")
-	}
-
-	inputBundle.PrivateKey = parsedCB.PrivateKey
-	inputBundle.PrivateKeyType = parsedCB.PrivateKeyType
-	inputBundle.PrivateKeyBytes = parsedCB.PrivateKeyBytes
-
-	if !inputBundle.Certificate.IsCA {
-		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
+		return nil, errwrap.Wrapf("saved key could not be parsed successfully: {{err}}", err)
 	}
+	inputBundle.PrivateKey = signer
+	inputBundle.PrivateKeyType = key.PrivateKeyType
 
 	if err := inputBundle.Verify(); err != nil {
 		return nil, errwrap.Wrapf("verification of parsed bundle failed: {{err}}", err)
 	}
 
-	cb, err = inputBundle.ToCertBundle()
+	cb, err := inputBundle.ToCertBundle()
 	if err != nil {
 		return nil, errwrap.Wrapf("error converting raw values into cert bundle: {{err}}", err)
 	}
 
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
+	resp, err := b.importIssuers(ctx, req.Storage, cb)
 	if err != nil {
 		return nil, err
 	}
-	err = req.Storage.Put(ctx, entry)
+
+	err = req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:   "certs/" + normalizeSerial(cb.SerialNumber),
+		Value: inputBundle.CertificateBytes,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	entry.Key = "certs/" + normalizeSerial(cb.SerialNumber)
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
+	// Build a fresh CRL
+	err = buildCRL(ctx, b, req)
 	if err != nil {
 		return nil, err
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
+	return resp, nil
+}
+
+// pathCrossSignIntermediate returns a CSR with the subject and key of an
+// issuer, to be signed by another CA. Setting the signed certificate with
+// the set-signed endpoint adds it as a new issuer sharing the key.
+func (b *backend) pathCrossSignIntermediate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	format := data.Get("format").(string)
+	if format != "pem" && format != "der" {
+		return logical.ErrorResponse(`the "format" parameter must be "pem" or "der"`), nil
+	}
+
+	issuer, err := b.resolveIssuerRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, err
+	}
+	if issuer.KeyID == "" {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %s has no private key and cannot be cross-signed", issuer.ID)), nil
+	}
+
+	key, err := b.fetchKey(ctx, req.Storage, issuer.KeyID)
 	if err != nil {
 		return nil, err
 	}
+	if key == nil {
+		return nil, fmt.Errorf("key %s of issuer %s not found", issuer.KeyID, issuer.ID)
+	}
+	signer, err := key.parseKey()
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing key of issuer: {{err}}", err)
+	}
+	cert, err := issuer.parseCertificate()
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing certificate of issuer: {{err}}", err)
+	}
 
-	// Build a fresh CRL
-	err = buildCRL(ctx, b, req)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		RawSubject:     cert.RawSubject,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+	}, signer)
+	if err != nil {
+		return nil, errwrap.Wrapf("error creating CSR: {{err}}", err)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"key_id": key.ID,
+		},
+	}
+	switch format {
+	case "pem":
+		resp.Data["csr"] = strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: csr,
+		})))
+	case "der":
+		resp.Data["csr"] = base64.StdEncoding.EncodeToString(csr)
+	}
 
-	return nil, err
+	return resp, nil
 }
 
 const pathGenerateIntermediateHelpSyn = `
@@ -250,5 +318,23 @@ Provide the signed intermediate CA cert.
 `
 
 const pathSetSignedIntermediateHelpDesc = `
+The certificate must match a key of the mount, generated with the
+"intermediate/generate" endpoint or belonging to an existing issuer. It is
+stored as a new issuer, along with any other certificate of its chain found in
+the bundle. If the mount has no default issuer yet, it becomes the default one.
+
 See the API documentation for more information.
 `
+
+const pathCrossSignIntermediateHelpSyn = `
+Generate a CSR with the subject and key of an issuer, to be cross-signed.
+`
+
+const pathCrossSignIntermediateHelpDesc = `
+This returns a CSR holding the subject and public key of the referenced
+issuer, to be signed by another CA, e.g. with the "root/sign-intermediate"
+endpoint and "use_csr_values" set to true. Setting the signed certificate with
+the "intermediate/set-signed" endpoint adds it as a new issuer sharing the key
+of the original one, so that certificates issued by either are trusted through
+both chains.
+`
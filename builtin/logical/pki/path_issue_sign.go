@@ -74,6 +74,13 @@ taken verbatim from the CSR, except for
 basic constraints.`,
 	}
 
+	ret.Fields["issuer_ref"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Reference, by name or ID, to the issuer signing
+the certificate. Defaults to the issuer of the role
+if one was specified, or to "default".`,
+	}
+
 	return ret
 }
 
@@ -139,6 +146,7 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 		UseCSRSANs:           true,
 		AllowedSerialNumbers: []string{"*"},
 		GenerateLease:        new(bool),
+		IssuerRef:            defaultRef,
 	}
 
 	*entry.GenerateLease = false
@@ -154,6 +162,11 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 			*entry.GenerateLease = *role.GenerateLease
 		}
 		entry.NoStore = role.NoStore
+		entry.IssuerRef = role.IssuerRef
+	}
+
+	if issuerRef, ok := data.GetOk("issuer_ref"); ok {
+		entry.IssuerRef = issuerRef.(string)
 	}
 
 	if entry.MaxTTL > 0 && entry.TTL > entry.MaxTTL {
@@ -171,7 +184,7 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := b.fetchCAInfo(ctx, req, role.IssuerRef)
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -0,0 +1,621 @@
+package pki
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathIssuersList,
+		},
+
+		HelpSynopsis:    pathListIssuersHelpSyn,
+		HelpDescription: pathListIssuersHelpDesc,
+	}
+}
+
+func pathIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/" + framework.GenericNameRegex("issuer_ref"),
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Reference to the issuer: "default", its name or its ID.`,
+			},
+			"issuer_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Name of the issuer, which can be used instead
+of its ID to reference it. Set to an empty string to
+remove the name.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathIssuerRead,
+			logical.UpdateOperation: b.pathIssuerWrite,
+			logical.DeleteOperation: b.pathIssuerDelete,
+		},
+
+		HelpSynopsis:    pathIssuersHelpSyn,
+		HelpDescription: pathIssuersHelpDesc,
+	}
+}
+
+func pathListKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathKeysList,
+		},
+
+		HelpSynopsis:    pathListKeysHelpSyn,
+		HelpDescription: pathListKeysHelpDesc,
+	}
+}
+
+func pathKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("key_ref"),
+		Fields: map[string]*framework.FieldSchema{
+			"key_ref": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Reference to the key: "default" for the key of
+the default issuer, its name or its ID.`,
+			},
+			"key_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Name of the key, which can be used instead
+of its ID to reference it. Set to an empty string to
+remove the name.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathKeyRead,
+			logical.UpdateOperation: b.pathKeyWrite,
+			logical.DeleteOperation: b.pathKeyDelete,
+		},
+
+		HelpSynopsis:    pathKeysHelpSyn,
+		HelpDescription: pathKeysHelpDesc,
+	}
+}
+
+func pathConfigIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/issuers",
+		Fields: map[string]*framework.FieldSchema{
+			"default": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Reference, by name or ID, to the issuer
+becoming the default issuer of the mount.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigIssuersRead,
+			logical.UpdateOperation: b.pathConfigIssuersWrite,
+		},
+
+		HelpSynopsis:    pathConfigIssuersHelpSyn,
+		HelpDescription: pathConfigIssuersHelpDesc,
+	}
+}
+
+// Returns the certificate and chain of an issuer, without authentication
+func pathFetchIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref") + "(/pem|/der)?",
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Reference to the issuer: "default", its name or its ID.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchIssuerRead,
+		},
+
+		HelpSynopsis:    pathFetchIssuerHelpSyn,
+		HelpDescription: pathFetchIssuerHelpDesc,
+	}
+}
+
+// Returns the CRL of an issuer, without authentication
+func pathFetchIssuerCRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref") + "/crl(/delta)?(/pem)?",
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Reference to the issuer: "default", its name or its ID.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchIssuerCRLRead,
+		},
+
+		HelpSynopsis:    pathFetchIssuerHelpSyn,
+		HelpDescription: pathFetchIssuerHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuersList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuers, err := b.fetchAllIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	config, err := b.getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	keyInfo := make(map[string]interface{})
+	for _, issuer := range issuers {
+		ids = append(ids, issuer.ID)
+		keyInfo[issuer.ID] = map[string]interface{}{
+			"issuer_name": issuer.Name,
+			"key_id":      issuer.KeyID,
+			"is_default":  issuer.ID == config.DefaultIssuerID,
+		}
+	}
+
+	return logical.ListResponseWithInfo(ids, keyInfo), nil
+}
+
+func (b *backend) pathIssuerRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, resp, err := b.issuerFromRef(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	chain, err := b.issuerChainPEM(ctx, req.Storage, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id":     issuer.ID,
+			"issuer_name":   issuer.Name,
+			"key_id":        issuer.KeyID,
+			"certificate":   issuer.Certificate,
+			"ca_chain":      chain,
+			"serial_number": issuer.SerialNumber,
+		},
+	}, nil
+}
+
+func (b *backend) pathIssuerWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, resp, err := b.issuerFromRef(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if name, ok := data.GetOk("issuer_name"); ok {
+		if resp := b.setIssuerName(ctx, req.Storage, issuer, name.(string)); resp != nil {
+			return resp, nil
+		}
+	}
+
+	return b.pathIssuerRead(ctx, req, data)
+}
+
+func (b *backend) pathIssuerDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := b.resolveIssuerRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		// Deleting a missing issuer is not an error
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	var resp *logical.Response
+	config, err := b.getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultIssuerID == issuer.ID {
+		config.DefaultIssuerID = ""
+		if err := setIssuersConfig(ctx, req.Storage, config); err != nil {
+			return nil, err
+		}
+		resp = &logical.Response{}
+		resp.AddWarning("The deleted issuer was the default issuer of the mount; set a new one with the config/issuers endpoint.")
+	}
+
+	if err := req.Storage.Delete(ctx, issuerPrefix+issuer.ID); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, crlPrefix+issuer.ID); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, deltaCRLPrefix+issuer.ID); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathKeysList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ids, err := b.listKeys(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := make(map[string]interface{})
+	for _, id := range ids {
+		key, err := b.fetchKey(ctx, req.Storage, id)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+		keyInfo[id] = map[string]interface{}{
+			"key_name": key.Name,
+		}
+	}
+
+	return logical.ListResponseWithInfo(ids, keyInfo), nil
+}
+
+func (b *backend) pathKeyRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.resolveKeyRef(ctx, req.Storage, data.Get("key_ref").(string))
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"key_id":   key.ID,
+			"key_name": key.Name,
+			"key_type": string(key.PrivateKeyType),
+		},
+	}, nil
+}
+
+func (b *backend) pathKeyWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.resolveKeyRef(ctx, req.Storage, data.Get("key_ref").(string))
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, err
+	}
+
+	if name, ok := data.GetOk("key_name"); ok && name.(string) != key.Name {
+		b.issuersLock.Lock()
+		defer b.issuersLock.Unlock()
+
+		ids, err := b.listKeys(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		names := make(map[string]string)
+		for _, id := range ids {
+			other, err := b.fetchKey(ctx, req.Storage, id)
+			if err != nil {
+				return nil, err
+			}
+			if other != nil && other.Name != "" {
+				names[other.Name] = other.ID
+			}
+		}
+		if err := validateName(name.(string), ids, names, key.ID); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		key.Name = name.(string)
+		if err := writeKey(ctx, req.Storage, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"key_id":   key.ID,
+			"key_name": key.Name,
+			"key_type": string(key.PrivateKeyType),
+		},
+	}, nil
+}
+
+func (b *backend) pathKeyDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.resolveKeyRef(ctx, req.Storage, data.Get("key_ref").(string))
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		// Deleting a missing key is not an error
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuers, err := b.fetchAllIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	for _, issuer := range issuers {
+		if issuer.KeyID == key.ID {
+			return logical.ErrorResponse(fmt.Sprintf("key is used by issuer %s; delete the issuer first", issuer.ID)), nil
+		}
+	}
+
+	return nil, req.Storage.Delete(ctx, keyPrefix+key.ID)
+}
+
+func (b *backend) pathConfigIssuersRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": config.DefaultIssuerID,
+		},
+	}, nil
+}
+
+// pathConfigIssuersWrite switches the default issuer of the mount, which is
+// used by the legacy endpoints and by roles not referencing another issuer.
+// As the default is a single storage entry, the switch is atomic.
+func (b *backend) pathConfigIssuersWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ref := data.Get("default").(string)
+	if ref == "" || ref == defaultRef {
+		return logical.ErrorResponse(`the "default" parameter must reference an issuer by name or ID`), nil
+	}
+
+	issuer, err := b.resolveIssuerRef(ctx, req.Storage, ref)
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, err
+	}
+	if issuer.KeyID == "" {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %s has no private key and cannot be the default issuer", issuer.ID)), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if err := setIssuersConfig(ctx, req.Storage, &issuersConfig{DefaultIssuerID: issuer.ID}); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": issuer.ID,
+		},
+	}, nil
+}
+
+func (b *backend) pathFetchIssuerRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, resp, err := b.issuerFromRef(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	cert, err := issuer.parseCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(req.Path, "/pem"):
+		return rawResponse("application/pkix-cert", []byte(issuer.Certificate)), nil
+	case strings.HasSuffix(req.Path, "/der"):
+		return rawResponse("application/pkix-cert", cert.Raw), nil
+	}
+
+	chain, err := b.issuerChainPEM(ctx, req.Storage, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id":   issuer.ID,
+			"issuer_name": issuer.Name,
+			"certificate": issuer.Certificate,
+			"ca_chain":    chain,
+		},
+	}, nil
+}
+
+func (b *backend) pathFetchIssuerCRLRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, resp, err := b.issuerFromRef(ctx, req, data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	prefix := crlPrefix
+	if strings.Contains(req.Path, "/crl/delta") {
+		prefix = deltaCRLPrefix
+	}
+
+	entry, err := req.Storage.Get(ctx, prefix+issuer.ID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		// Issuers without a key have no CRL, nor delta CRL unless enabled
+		return nil, nil
+	}
+
+	if strings.HasSuffix(req.Path, "/pem") {
+		crl := pem.EncodeToMemory(&pem.Block{
+			Type:  "X509 CRL",
+			Bytes: entry.Value,
+		})
+		return rawResponse("application/pkix-crl", []byte(strings.TrimSpace(string(crl)))), nil
+	}
+	return rawResponse("application/pkix-crl", entry.Value), nil
+}
+
+// issuerFromRef resolves the issuer_ref field, returning an error response
+// for unknown issuers
+func (b *backend) issuerFromRef(ctx context.Context, req *logical.Request, data *framework.FieldData) (*issuerEntry, *logical.Response, error) {
+	issuer, err := b.resolveIssuerRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	switch err.(type) {
+	case nil:
+		return issuer, nil, nil
+	case errutil.UserError:
+		return nil, logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, nil, err
+	}
+}
+
+// issuerChainPEM returns the PEM certificates of the issuer and of the
+// issuers completing its chain
+func (b *backend) issuerChainPEM(ctx context.Context, s logical.Storage, issuer *issuerEntry) ([]string, error) {
+	chain, err := b.issuerChain(ctx, s, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := []string{issuer.Certificate}
+	for _, chainIssuer := range chain {
+		certs = append(certs, chainIssuer.Certificate)
+	}
+	return certs, nil
+}
+
+// fetchIssuerCertOrCRL returns the DER certificate of the referenced issuer as
+// a storage entry, or its CRL stored under the given prefix, either crlPrefix
+// or deltaCRLPrefix. It returns nil if there is no such issuer.
+func (b *backend) fetchIssuerCertOrCRL(ctx context.Context, s logical.Storage, ref string, prefix string) (*logical.StorageEntry, error) {
+	issuer, err := b.resolveIssuerRef(ctx, s, ref)
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	if prefix != "" {
+		entry, err := s.Get(ctx, prefix+issuer.ID)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching CRL of issuer %s: %s", issuer.ID, err)}
+		}
+		return entry, nil
+	}
+
+	cert, err := issuer.parseCertificate()
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error parsing certificate of issuer %s: %s", issuer.ID, err)}
+	}
+	return &logical.StorageEntry{
+		Key:   issuerPrefix + issuer.ID,
+		Value: cert.Raw,
+	}, nil
+}
+
+func rawResponse(contentType string, body []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  200,
+		},
+	}
+}
+
+const pathListIssuersHelpSyn = `
+List the issuers of the mount.
+`
+
+const pathListIssuersHelpDesc = `
+This lists the IDs of the issuers of the mount, along with their names, the
+IDs of their keys and which one is the default issuer.
+`
+
+const pathIssuersHelpSyn = `
+Read, rename or delete an issuer of the mount.
+`
+
+const pathIssuersHelpDesc = `
+Issuers are the CA certificates held by the mount. They are referenced by
+"default", by their ID or by their name, which can be set with this endpoint.
+Issuers sharing a key, such as cross-signed certificates, refer to the same
+key. Issuers without a key only complete the chains of other issuers.
+
+Deleting the default issuer leaves the mount without a default issuer until a
+new one is set with the "config/issuers" endpoint.
+`
+
+const pathListKeysHelpSyn = `
+List the keys of the mount.
+`
+
+const pathListKeysHelpDesc = `
+This lists the IDs of the keys of the mount, along with their names.
+`
+
+const pathKeysHelpSyn = `
+Read, rename or delete a key of the mount.
+`
+
+const pathKeysHelpDesc = `
+Keys are the private keys of the issuers of the mount, or keys generated for
+intermediate CAs awaiting their signed certificate. They are referenced by
+"default", for the key of the default issuer, by their ID or by their name,
+which can be set with this endpoint. Private keys are never returned.
+
+Keys used by issuers cannot be deleted.
+`
+
+const pathConfigIssuersHelpSyn = `
+Read or set the default issuer of the mount.
+`
+
+const pathConfigIssuersHelpDesc = `
+The default issuer signs certificates of roles not referencing another
+issuer, and is returned by the "ca", "ca_chain" and "crl" endpoints. Setting
+it is atomic, so that a new issuer, e.g. one generated with "root/rotate",
+can be switched to once distributed.
+`
+
+const pathFetchIssuerHelpSyn = `
+Fetch the certificate, chain or CRL of an issuer.
+`
+
+const pathFetchIssuerHelpDesc = `
+This returns, without authentication, the certificate and chain of the
+issuer. Add "/pem" or "/der" to get the raw certificate, and "/crl" to get the
+DER encoded CRL of the issuer, or "/crl/pem" for its PEM encoding. The delta
+CRL of the issuer, when enabled in config/crl, is returned by "/crl/delta" and
+"/crl/delta/pem".
+`
@@ -0,0 +1,284 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func issuersTestRequest(t *testing.T, b *backend, storage logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   storage,
+		Data:      data,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("%s %s: bad: err: %v resp: %#v", op, path, err, resp)
+	}
+	return resp
+}
+
+// createBackendWithStorageOf sets up a new backend using the given storage,
+// as when the mount is loaded again
+func createBackendWithStorageOf(t *testing.T, storage logical.Storage) *backend {
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPki_IssuersLegacyMigration(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/exported", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "48h",
+	})
+	caCert := resp.Data["certificate"].(string)
+	crl, err := storage.Get(context.Background(), crlPrefix+resp.Data["issuer_id"].(string))
+	if err != nil || crl == nil {
+		t.Fatalf("bad: CRL of the CA: err: %v entry: %#v", err, crl)
+	}
+
+	// Store the CA and its CRL the way previous versions did, in a new mount
+	b, storage = createBackendWithStorage(t)
+	entry, err := logical.StorageEntryJSON(legacyCABundlePath, &certutil.CertBundle{
+		Certificate:    caCert,
+		PrivateKeyType: resp.Data["private_key_type"].(certutil.PrivateKeyType),
+		PrivateKey:     resp.Data["private_key"].(string),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(context.Background(), &logical.StorageEntry{Key: "crl", Value: crl.Value}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = issuersTestRequest(t, b, storage, logical.ListOperation, "issuers", nil)
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != 1 {
+		t.Fatalf("expected one issuer, got %v", keys)
+	}
+	info := resp.Data["key_info"].(map[string]interface{})[keys[0]].(map[string]interface{})
+	if !info["is_default"].(bool) || info["key_id"].(string) == "" {
+		t.Fatalf("bad: migrated issuer info: %#v", info)
+	}
+
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "cert/ca", nil)
+	if resp.Data["certificate"].(string) != caCert {
+		t.Fatalf("bad: CA certificate changed by the migration")
+	}
+
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "crl", nil)
+	if !bytes.Equal(resp.Data["http_raw_body"].([]byte), crl.Value) {
+		t.Fatalf("bad: CRL changed by the migration")
+	}
+
+	// The legacy CA bundle is kept for previous versions, and is not
+	// migrated again by a new instance of the backend
+	entry, err = storage.Get(context.Background(), legacyCABundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		t.Fatal("legacy CA bundle was removed")
+	}
+	b = createBackendWithStorageOf(t, storage)
+	resp = issuersTestRequest(t, b, storage, logical.ListOperation, "issuers", nil)
+	if migrated := resp.Data["keys"].([]string); len(migrated) != 1 || migrated[0] != keys[0] {
+		t.Fatalf("expected the migrated issuer only, got %v", migrated)
+	}
+
+	// A migration interrupted before being recorded is resumed without
+	// duplicating the issuer or key
+	if err := storage.Delete(context.Background(), legacyMigrationLogPath); err != nil {
+		t.Fatal(err)
+	}
+	b = createBackendWithStorageOf(t, storage)
+	resp = issuersTestRequest(t, b, storage, logical.ListOperation, "issuers", nil)
+	if migrated := resp.Data["keys"].([]string); len(migrated) != 1 || migrated[0] != keys[0] {
+		t.Fatalf("expected the migrated issuer only, got %v", migrated)
+	}
+	resp = issuersTestRequest(t, b, storage, logical.ListOperation, "keys", nil)
+	if migrated := resp.Data["keys"].([]string); len(migrated) != 1 || migrated[0] != info["key_id"].(string) {
+		t.Fatalf("expected the migrated key only, got %v", migrated)
+	}
+
+	// Issuing still works with the migrated CA
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+		"common_name": "foo.example.com",
+		"ttl":         "1h",
+	})
+	if err := parseTestCert(t, resp.Data["certificate"].(string)).CheckSignatureFrom(parseTestCert(t, caCert)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPki_MultipleIssuers(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "root-a.myvault.com",
+		"issuer_name": "root-a",
+		"ttl":         "48h",
+	})
+	rootA := parseTestCert(t, resp.Data["certificate"].(string))
+	rootAID := resp.Data["issuer_id"].(string)
+
+	// Generating another root is refused, rotating adds one
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "root-b.myvault.com",
+		},
+	})
+	if err != nil || resp == nil || len(resp.Warnings) == 0 {
+		t.Fatalf("expected warning generating a second root: err: %v resp: %#v", err, resp)
+	}
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/rotate/internal", map[string]interface{}{
+		"common_name": "root-b.myvault.com",
+		"issuer_name": "root-b",
+		"ttl":         "48h",
+	})
+	rootB := parseTestCert(t, resp.Data["certificate"].(string))
+	rootBKeyID := resp.Data["key_id"].(string)
+
+	// The first root stays the default
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "config/issuers", nil)
+	if resp.Data["default"].(string) != rootAID {
+		t.Fatalf("bad: default issuer: %v", resp.Data["default"])
+	}
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/default", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/root-b", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"issuer_ref":       "root-b",
+	})
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/unknown",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"issuer_ref": "unknown",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for unknown issuer: err: %v resp: %#v", err, resp)
+	}
+
+	issue := func(role string, signer *x509.Certificate) string {
+		resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/"+role, map[string]interface{}{
+			"common_name": "foo.example.com",
+			"ttl":         "1h",
+		})
+		if err := parseTestCert(t, resp.Data["certificate"].(string)).CheckSignatureFrom(signer); err != nil {
+			t.Fatalf("%s: %v", role, err)
+		}
+		return resp.Data["serial_number"].(string)
+	}
+	serialA := issue("default", rootA)
+	issue("root-b", rootB)
+
+	// Switching the default issuer changes the issuer of roles using it
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "config/issuers", map[string]interface{}{
+		"default": "root-b",
+	})
+	issue("default", rootB)
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "cert/ca", nil)
+	if parseTestCert(t, resp.Data["certificate"].(string)).Subject.CommonName != "root-b.myvault.com" {
+		t.Fatal("bad: legacy CA endpoint does not return the default issuer")
+	}
+
+	// Each issuer has its own CRL
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serialA,
+	})
+	for issuer, expected := range map[string]string{"root-a": serialA, "root-b": ""} {
+		resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "issuer/"+issuer+"/crl", nil)
+		crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+		if err != nil {
+			t.Fatal(err)
+		}
+		revoked := crl.TBSCertList.RevokedCertificates
+		switch {
+		case expected == "" && len(revoked) != 0:
+			t.Fatalf("%s: expected empty CRL, got %d entries", issuer, len(revoked))
+		case expected != "" && (len(revoked) != 1 || certutil.GetHexFormatted(revoked[0].SerialNumber.Bytes(), ":") != expected):
+			t.Fatalf("%s: bad CRL entries: %#v", issuer, revoked)
+		}
+	}
+
+	// Cross-sign the second root with the first one
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "intermediate/cross-sign", map[string]interface{}{
+		"issuer_ref": "root-b",
+	})
+	if resp.Data["key_id"].(string) != rootBKeyID {
+		t.Fatalf("bad: cross-sign key: %v", resp.Data["key_id"])
+	}
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/sign-intermediate", map[string]interface{}{
+		"csr":            resp.Data["csr"],
+		"issuer_ref":     "root-a",
+		"use_csr_values": true,
+		"common_name":    "root-b.myvault.com",
+		"ttl":            "24h",
+	})
+	crossSigned := parseTestCert(t, resp.Data["certificate"].(string))
+	if err := crossSigned.CheckSignatureFrom(rootA); err != nil {
+		t.Fatal(err)
+	}
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "intermediate/set-signed", map[string]interface{}{
+		"certificate": resp.Data["certificate"],
+	})
+	crossSignedID := resp.Data["issuer_id"].(string)
+	if resp.Data["key_id"].(string) != rootBKeyID {
+		t.Fatalf("bad: cross-signed issuer key: %v", resp.Data["key_id"])
+	}
+
+	// The chain of the cross-signed issuer leads to the first root
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "issuers/"+crossSignedID, nil)
+	chain := resp.Data["ca_chain"].([]string)
+	if len(chain) != 2 || !parseTestCert(t, chain[1]).Equal(rootA) {
+		t.Fatalf("bad: cross-signed chain: %v", chain)
+	}
+
+	// Keys in use cannot be deleted
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "keys/" + rootBKeyID,
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error deleting key in use: err: %v resp: %#v", err, resp)
+	}
+
+	// Deleting the default issuer leaves the mount without one
+	resp = issuersTestRequest(t, b, storage, logical.DeleteOperation, "issuers/root-b", nil)
+	if resp == nil || len(resp.Warnings) == 0 {
+		t.Fatal("expected warning deleting the default issuer")
+	}
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "config/issuers", nil)
+	if resp.Data["default"].(string) != "" {
+		t.Fatalf("bad: default issuer: %v", resp.Data["default"])
+	}
+}
@@ -0,0 +1,257 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Answers OCSP requests sent in the body of POST requests
+func pathOCSP(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `ocsp/?$`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOCSPWrite,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+// Answers OCSP requests sent base64 encoded in the path of GET requests
+func pathOCSPViaGet(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `ocsp/(?P<request>.+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"request": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Base64 encoded DER OCSP request`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathOCSPRead,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+func (b *backend) pathOCSPRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	der, err := base64.StdEncoding.DecodeString(data.Get("request").(string))
+	if err != nil {
+		return ocspResponse(ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	return b.ocspRespond(ctx, req, der), nil
+}
+
+func (b *backend) pathOCSPWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	der, ok := req.Data[logical.HTTPRawBody].([]byte)
+	if !ok {
+		return ocspResponse(ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	return b.ocspRespond(ctx, req, der), nil
+}
+
+// ocspRespond returns the response to the DER encoded OCSP request, signed by
+// the issuer of the certificate. As required by RFC 6960, errors are returned
+// as unsuccessful OCSP responses rather than HTTP errors.
+func (b *backend) ocspRespond(ctx context.Context, req *logical.Request, der []byte) *logical.Response {
+	ocspReq, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return ocspResponse(ocsp.MalformedRequestErrorResponse)
+	}
+
+	config, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		b.Logger().Error("failed to fetch the CRL configuration for OCSP response", "error", err)
+		return ocspResponse(ocsp.InternalErrorErrorResponse)
+	}
+	expiry, err := config.ocspExpiryDuration()
+	if err != nil {
+		b.Logger().Error("invalid OCSP expiry", "error", err)
+		return ocspResponse(ocsp.InternalErrorErrorResponse)
+	}
+
+	caInfo, err := b.ocspIssuer(ctx, req, ocspReq)
+	if err != nil {
+		b.Logger().Error("failed to fetch the CA for OCSP response", "error", err)
+		return ocspResponse(ocsp.InternalErrorErrorResponse)
+	}
+	if caInfo == nil {
+		// This backend is not authoritative for certificates of other issuers
+		return ocspResponse(ocsp.UnauthorizedErrorResponse)
+	}
+
+	now := time.Now()
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(expiry),
+		IssuerHash:   ocspReq.HashAlgorithm,
+	}
+
+	serial := certutil.GetHexFormatted(ocspReq.SerialNumber.Bytes(), ":")
+	revokedEntry, err := fetchCertBySerial(ctx, req, "revoked/", serial)
+	if err != nil {
+		b.Logger().Error("failed to fetch revocation entry for OCSP response", "serial", serial, "error", err)
+		return ocspResponse(ocsp.InternalErrorErrorResponse)
+	}
+	if revokedEntry != nil {
+		var revInfo revocationInfo
+		if err := revokedEntry.DecodeJSON(&revInfo); err != nil {
+			b.Logger().Error("failed to decode revocation entry for OCSP response", "serial", serial, "error", err)
+			return ocspResponse(ocsp.InternalErrorErrorResponse)
+		}
+
+		cert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+		if err != nil {
+			b.Logger().Error("failed to parse revoked certificate for OCSP response", "serial", serial, "error", err)
+			return ocspResponse(ocsp.InternalErrorErrorResponse)
+		}
+
+		template.Status = ocsp.Revoked
+		template.RevocationReason = revInfo.Reason
+		template.RevokedAt = revInfo.RevocationTimeUTC
+		if template.RevokedAt.IsZero() {
+			template.RevokedAt = time.Unix(revInfo.RevocationTime, 0)
+		}
+
+		// The serial may belong to a certificate of another issuer of the
+		// mount
+		if !ocspCertIssuedBy(cert, caInfo.Certificate) {
+			template.Status = ocsp.Unknown
+		}
+	} else {
+		certEntry, err := fetchCertBySerial(ctx, req, "certs/", serial)
+		if err != nil {
+			b.Logger().Error("failed to fetch certificate for OCSP response", "serial", serial, "error", err)
+			return ocspResponse(ocsp.InternalErrorErrorResponse)
+		}
+		if certEntry == nil {
+			template.Status = ocsp.Unknown
+		} else {
+			cert, err := x509.ParseCertificate(certEntry.Value)
+			if err != nil {
+				b.Logger().Error("failed to parse certificate for OCSP response", "serial", serial, "error", err)
+				return ocspResponse(ocsp.InternalErrorErrorResponse)
+			}
+			if !ocspCertIssuedBy(cert, caInfo.Certificate) {
+				template.Status = ocsp.Unknown
+			}
+		}
+	}
+
+	resp, err := ocsp.CreateResponse(caInfo.Certificate, caInfo.Certificate, template, caInfo.PrivateKey)
+	if err != nil {
+		b.Logger().Error("failed to sign OCSP response", "serial", serial, "error", err)
+		return ocspResponse(ocsp.InternalErrorErrorResponse)
+	}
+
+	return ocspResponse(resp)
+}
+
+// ocspIssuer returns the issuer of the mount, holding a key, that issued the
+// certificate of the OCSP request, or nil if there is none
+func (b *backend) ocspIssuer(ctx context.Context, req *logical.Request, ocspReq *ocsp.Request) (*caInfoBundle, error) {
+	issuers, err := b.fetchAllIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, issuer := range issuers {
+		if issuer.KeyID == "" {
+			continue
+		}
+		cert, err := issuer.parseCertificate()
+		if err != nil {
+			return nil, err
+		}
+		issued, err := ocspRequestIssuedBy(ocspReq, cert)
+		if err != nil {
+			return nil, err
+		}
+		if issued {
+			return b.fetchCAInfo(ctx, req, issuer.ID)
+		}
+	}
+
+	return nil, nil
+}
+
+// ocspRequestIssuedBy returns whether the certificate of the OCSP request was
+// issued by the given CA, by comparing the hashes of its name and public key
+func ocspRequestIssuedBy(ocspReq *ocsp.Request, issuer *x509.Certificate) (bool, error) {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return false, errwrap.Wrapf("failed to parse issuer public key: {{err}}", err)
+	}
+
+	h := ocspReq.HashAlgorithm.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(nameHash, ocspReq.IssuerNameHash) && bytes.Equal(keyHash, ocspReq.IssuerKeyHash), nil
+}
+
+// ocspCertIssuedBy returns whether the stored certificate was signed by the
+// issuer answering the OCSP request
+func ocspCertIssuedBy(cert, issuer *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) && cert.CheckSignatureFrom(issuer) == nil
+}
+
+func ocspResponse(der []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/ocsp-response",
+			logical.HTTPRawBody:     der,
+			logical.HTTPStatusCode:  200,
+		},
+	}
+}
+
+const pathOCSPHelpSyn = `
+Query the revocation status of certificates issued by the mount using OCSP.
+`
+
+const pathOCSPHelpDesc = `
+This endpoint is an OCSP responder, as described in RFC 6960. OCSP requests
+are either sent DER encoded in the body of POST requests, with the
+"application/ocsp-request" content type, or base64 encoded in the path of GET
+requests. Responses are signed by the issuer of the certificate. As the HTTP
+server redirects paths holding double slashes, POST should be preferred.
+
+Certificates are reported as revoked if they were revoked through this backend,
+as good if they were issued by it and not revoked, and as unknown otherwise,
+including when they were issued by another issuer than the one named in the
+request.
+Responses are valid for the "ocsp_expiry" of the "config/crl" endpoint.
+Requests about certificates of issuers the mount does not hold the key of get
+"unauthorized" responses.
+
+To advertise this responder in issued certificates, add its URL to the
+"ocsp_servers" of the "config/urls" endpoint.
+`
@@ -0,0 +1,288 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestBackend_OCSP(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	err := client.Sys().Mount("pki", &api.MountInput{
+		Type: "pki",
+		Config: api.MountConfigInput{
+			DefaultLeaseTTL: "16h",
+			MaxLeaseTTL:     "32h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := parseTestCert(t, resp.Data["certificate"].(string))
+
+	_, err = client.Logical().Write("pki/roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certs []*x509.Certificate
+	for i := 0; i < 2; i++ {
+		resp, err = client.Logical().Write("pki/issue/example", map[string]interface{}{
+			"common_name": "foo.example.com",
+			"ttl":         "1h",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, parseTestCert(t, resp.Data["certificate"].(string)))
+	}
+	good, revoked := certs[0], certs[1]
+
+	resp, err = client.Logical().Write("pki/revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests are not authenticated
+	client.ClearToken()
+
+	ocspRequest := func(method string, der []byte) []byte {
+		// Paths holding double slashes are redirected by the HTTP server, so
+		// those requests can only be sent with POST
+		encoded := base64.StdEncoding.EncodeToString(der)
+		if strings.Contains(encoded, "//") {
+			method = "POST"
+		}
+
+		var req *api.Request
+		switch method {
+		case "GET":
+			// Set the path directly, as joining paths would drop the slashes
+			// of the encoded request, which are URL encoded as in RFC 6960
+			req = client.NewRequest("GET", "/v1/pki/ocsp")
+			req.URL.RawPath = req.URL.Path + "/" + url.PathEscape(encoded)
+			req.URL.Path += "/" + encoded
+		default:
+			req = client.NewRequest("POST", "/v1/pki/ocsp")
+			req.Headers = http.Header{"Content-Type": []string{"application/ocsp-request"}}
+			req.BodyBytes = der
+		}
+		httpResp, err := client.RawRequest(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+
+		if httpResp.StatusCode != 200 || httpResp.Header.Get("Content-Type") != "application/ocsp-response" {
+			t.Fatalf("bad: status %d, content type %q", httpResp.StatusCode, httpResp.Header.Get("Content-Type"))
+		}
+		body, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256} {
+			for cert, expected := range map[*x509.Certificate]int{
+				good:    ocsp.Good,
+				revoked: ocsp.Revoked,
+				ca:      ocsp.Good,
+			} {
+				der, err := ocsp.CreateRequest(cert, ca, &ocsp.RequestOptions{Hash: hash})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ocspResp, err := ocsp.ParseResponseForCert(ocspRequest(method, der), cert, ca)
+				if err != nil {
+					t.Fatalf("%s: failed to verify response: %v", method, err)
+				}
+				if ocspResp.Status != expected {
+					t.Fatalf("%s: bad status for %s: expected %d, got %d", method, cert.Subject.CommonName, expected, ocspResp.Status)
+				}
+				if expected == ocsp.Revoked && ocspResp.RevokedAt.IsZero() {
+					t.Fatalf("%s: missing revocation time", method)
+				}
+				if lifetime := ocspResp.NextUpdate.Sub(ocspResp.ThisUpdate); lifetime != 12*time.Hour {
+					t.Fatalf("%s: expected responses valid for the default OCSP expiry, got %s", method, lifetime)
+				}
+			}
+		}
+
+		// Certificates of other issuers get unauthorized responses
+		der, err := ocsp.CreateRequest(good, good, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ocsp.ParseResponse(ocspRequest(method, der), nil)
+		if respErr, ok := err.(ocsp.ResponseError); !ok || respErr.Status != ocsp.Unauthorized {
+			t.Fatalf("%s: expected unauthorized response, got %v", method, err)
+		}
+
+		// Unknown serial numbers of the CA are reported as unknown
+		unknown := *good
+		unknown.SerialNumber = new(big.Int).Add(ca.SerialNumber, big.NewInt(1))
+		der, err = ocsp.CreateRequest(&unknown, ca, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ocspResp, err := ocsp.ParseResponse(ocspRequest(method, der), ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ocspResp.Status != ocsp.Unknown {
+			t.Fatalf("%s: bad status: expected unknown, got %d", method, ocspResp.Status)
+		}
+
+		// The lifetime of responses is configurable
+		client.SetToken(cluster.RootToken)
+		_, err = client.Logical().Write("pki/config/crl", map[string]interface{}{
+			"ocsp_expiry": "1h",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.ClearToken()
+		der, err = ocsp.CreateRequest(good, ca, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ocspResp, err = ocsp.ParseResponseForCert(ocspRequest(method, der), good, ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lifetime := ocspResp.NextUpdate.Sub(ocspResp.ThisUpdate); lifetime != time.Hour {
+			t.Fatalf("%s: expected responses valid for 1h, got %s", method, lifetime)
+		}
+		client.SetToken(cluster.RootToken)
+		_, err = client.Logical().Write("pki/config/crl", map[string]interface{}{
+			"ocsp_expiry": "12h",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.ClearToken()
+
+		// Malformed requests get malformed responses
+		_, err = ocsp.ParseResponse(ocspRequest(method, []byte("garbage")), nil)
+		if respErr, ok := err.(ocsp.ResponseError); !ok || respErr.Status != ocsp.Malformed {
+			t.Fatalf("%s: expected malformed response, got %v", method, err)
+		}
+	}
+}
+
+func TestBackend_OCSPMultipleIssuers(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "root-a.myvault.com",
+		"issuer_name": "root-a",
+		"ttl":         "48h",
+	})
+	rootA := parseTestCert(t, resp.Data["certificate"].(string))
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/rotate/internal", map[string]interface{}{
+		"common_name": "root-b.myvault.com",
+		"issuer_name": "root-b",
+		"ttl":         "48h",
+	})
+	rootB := parseTestCert(t, resp.Data["certificate"].(string))
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/root-b", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"issuer_ref":       "root-b",
+	})
+	var certs []*x509.Certificate
+	for i := 0; i < 2; i++ {
+		resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/root-b", map[string]interface{}{
+			"common_name": "foo.example.com",
+			"ttl":         "1h",
+		})
+		certs = append(certs, parseTestCert(t, resp.Data["certificate"].(string)))
+	}
+	good, revoked := certs[0], certs[1]
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"].(string),
+	})
+
+	ocspStatus := func(cert, issuer, signer *x509.Certificate) int {
+		der, err := ocsp.CreateRequest(cert, issuer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := issuersTestRequest(t, b, storage, logical.UpdateOperation, "ocsp", map[string]interface{}{
+			logical.HTTPRawBody: der,
+		})
+		ocspResp, err := ocsp.ParseResponse(resp.Data[logical.HTTPRawBody].([]byte), signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ocspResp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			t.Fatalf("bad: serial number of response: %s", ocspResp.SerialNumber)
+		}
+		return ocspResp.Status
+	}
+
+	for cert, expected := range map[*x509.Certificate]int{good: ocsp.Good, revoked: ocsp.Revoked} {
+		if status := ocspStatus(cert, rootB, rootB); status != expected {
+			t.Fatalf("bad: status from the issuer of the certificate: expected %d, got %d", expected, status)
+		}
+
+		// Requests naming another issuer of the mount are answered by it,
+		// which does not know the certificate
+		if status := ocspStatus(cert, rootA, rootA); status != ocsp.Unknown {
+			t.Fatalf("bad: status from another issuer: expected unknown, got %d", status)
+		}
+	}
+}
+
+func parseTestCert(t *testing.T, certPEM string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		t.Fatal("failed to decode certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
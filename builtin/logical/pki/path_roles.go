@@ -9,6 +9,7 @@ import (
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -263,13 +264,37 @@ for "generate_lease".`,
 				Description: `If set to false, makes the 'common_name' field optional while generating a certificate.`,
 			},
 			"policy_identifiers": &framework.FieldSchema{
-				Type:        framework.TypeCommaStringSlice,
-				Description: `A comma-separated string or list of policy oids.`,
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated string or list of policy oids,
+or a JSON-encoded list of policies with their qualifiers, of
+the form [{"oid": "1.3.6.1.4.1.7.8", "cps":
+"https://example.com/cps", "notice": "Some notice"}].
+The "cps" and "notice" qualifiers are optional.`,
+			},
+			"extension_templates": &framework.FieldSchema{
+				Type: framework.TypeSlice,
+				Description: `A JSON list of non-critical extensions added to
+the certificates, of the form [{"oid": "1.2.3.4",
+"type": "utf8", "value": "cn={{common_name}}"}].
+Valid types are "utf8", "ia5" and "printable"
+strings, whose values can reference the
+{{common_name}}, {{serial_number}} and
+{{issuer_id}} of the certificate, "integer",
+"boolean", and "octet" or "der" whose values are
+base64 encoded. Extensions managed by the
+backend, e.g. under 2.5.29, cannot be set.`,
 			},
 			"basic_constraints_valid_for_non_ca": &framework.FieldSchema{
 				Type:        framework.TypeBool,
 				Description: `Mark Basic Constraints valid when issuing non-CA certificates.`,
 			},
+			"issuer_ref": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: defaultRef,
+				Description: `Reference, by name or ID, to the issuer signing
+certificates issued by this role. Defaults to "default", the
+default issuer of the mount.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -383,6 +408,12 @@ func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*ro
 		modified = true
 	}
 
+	// Upgrade roles created before mounts could hold several issuers
+	if result.IssuerRef == "" {
+		result.IssuerRef = defaultRef
+		modified = true
+	}
+
 	if modified && (b.System().LocalMount() || !b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary)) {
 		jsonEntry, err := logical.StorageEntryJSON("role/"+n, &result)
 		if err != nil {
@@ -473,8 +504,35 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		NoStore:                       data.Get("no_store").(bool),
 		RequireCN:                     data.Get("require_cn").(bool),
 		AllowedSerialNumbers:          data.Get("allowed_serial_numbers").([]string),
-		PolicyIdentifiers:             data.Get("policy_identifiers").([]string),
 		BasicConstraintsValidForNonCA: data.Get("basic_constraints_valid_for_non_ca").(bool),
+		IssuerRef:                     data.Get("issuer_ref").(string),
+	}
+
+	policies, err := parsePolicyIdentifiers(data)
+	if err != nil {
+		return logical.ErrorResponse(errwrap.Wrapf("error parsing policy_identifiers: {{err}}", err).Error()), nil
+	}
+	if err := validatePolicies(policies); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	for _, policy := range policies {
+		entry.PolicyIdentifiers = append(entry.PolicyIdentifiers, policy.OID)
+		if policy.CPS != "" || policy.Notice != "" {
+			entry.PolicyInformation = policies
+		}
+	}
+
+	if extensionTemplatesRaw, ok := data.Raw["extension_templates"]; ok && extensionTemplatesRaw != "" {
+		isJSON, err := decodeJSONList(extensionTemplatesRaw, &entry.ExtensionTemplates)
+		if err != nil {
+			return logical.ErrorResponse(errwrap.Wrapf("error parsing extension_templates: {{err}}", err).Error()), nil
+		}
+		if !isJSON {
+			return logical.ErrorResponse("extension_templates must be a JSON list"), nil
+		}
+	}
+	if err := validateExtensionTemplates(entry.ExtensionTemplates); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
 	otherSANs := data.Get("allowed_other_sans").([]string)
@@ -516,12 +574,15 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		}
 	}
 
-	if len(entry.PolicyIdentifiers) > 0 {
-		for _, oidstr := range entry.PolicyIdentifiers {
-			_, err := stringToOid(oidstr)
-			if err != nil {
-				return logical.ErrorResponse(fmt.Sprintf("%q could not be parsed as a valid oid for a policy identifier", oidstr)), nil
-			}
+	// The default issuer may not be configured yet, but other references
+	// must exist
+	if entry.IssuerRef != defaultRef {
+		_, err := b.resolveIssuerRef(ctx, req.Storage, entry.IssuerRef)
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		case errutil.InternalError:
+			return nil, err
 		}
 	}
 
@@ -537,6 +598,24 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 	return nil, nil
 }
 
+// parsePolicyIdentifiers returns the policies given either as a list of OIDs
+// or as a JSON list of policies with their qualifiers
+func parsePolicyIdentifiers(data *framework.FieldData) ([]policyInformation, error) {
+	var policies []policyInformation
+	isJSON, err := decodeJSONList(data.Raw["policy_identifiers"], &policies)
+	if err != nil {
+		return nil, err
+	}
+	if isJSON {
+		return policies, nil
+	}
+
+	for _, oid := range data.Get("policy_identifiers").([]string) {
+		policies = append(policies, policyInformation{OID: oid})
+	}
+	return policies, nil
+}
+
 func parseKeyUsages(input []string) int {
 	var parsedKeyUsages x509.KeyUsage
 	for _, k := range input {
@@ -566,57 +645,74 @@ func parseKeyUsages(input []string) int {
 }
 
 type roleEntry struct {
-	LeaseMax                      string        `json:"lease_max"`
-	Lease                         string        `json:"lease"`
-	DeprecatedMaxTTL              string        `json:"max_ttl" mapstructure:"max_ttl"`
-	DeprecatedTTL                 string        `json:"ttl" mapstructure:"ttl"`
-	TTL                           time.Duration `json:"ttl_duration" mapstructure:"ttl_duration"`
-	MaxTTL                        time.Duration `json:"max_ttl_duration" mapstructure:"max_ttl_duration"`
-	AllowLocalhost                bool          `json:"allow_localhost" mapstructure:"allow_localhost"`
-	AllowedBaseDomain             string        `json:"allowed_base_domain" mapstructure:"allowed_base_domain"`
-	AllowedDomainsOld             string        `json:"allowed_domains,omit_empty"`
-	AllowedDomains                []string      `json:"allowed_domains_list" mapstructure:"allowed_domains"`
-	AllowBaseDomain               bool          `json:"allow_base_domain"`
-	AllowBareDomains              bool          `json:"allow_bare_domains" mapstructure:"allow_bare_domains"`
-	AllowTokenDisplayName         bool          `json:"allow_token_displayname" mapstructure:"allow_token_displayname"`
-	AllowSubdomains               bool          `json:"allow_subdomains" mapstructure:"allow_subdomains"`
-	AllowGlobDomains              bool          `json:"allow_glob_domains" mapstructure:"allow_glob_domains"`
-	AllowAnyName                  bool          `json:"allow_any_name" mapstructure:"allow_any_name"`
-	EnforceHostnames              bool          `json:"enforce_hostnames" mapstructure:"enforce_hostnames"`
-	AllowIPSANs                   bool          `json:"allow_ip_sans" mapstructure:"allow_ip_sans"`
-	ServerFlag                    bool          `json:"server_flag" mapstructure:"server_flag"`
-	ClientFlag                    bool          `json:"client_flag" mapstructure:"client_flag"`
-	CodeSigningFlag               bool          `json:"code_signing_flag" mapstructure:"code_signing_flag"`
-	EmailProtectionFlag           bool          `json:"email_protection_flag" mapstructure:"email_protection_flag"`
-	UseCSRCommonName              bool          `json:"use_csr_common_name" mapstructure:"use_csr_common_name"`
-	UseCSRSANs                    bool          `json:"use_csr_sans" mapstructure:"use_csr_sans"`
-	KeyType                       string        `json:"key_type" mapstructure:"key_type"`
-	KeyBits                       int           `json:"key_bits" mapstructure:"key_bits"`
-	MaxPathLength                 *int          `json:",omitempty" mapstructure:"max_path_length"`
-	KeyUsageOld                   string        `json:"key_usage,omitempty"`
-	KeyUsage                      []string      `json:"key_usage_list" mapstructure:"key_usage"`
-	OUOld                         string        `json:"ou,omitempty"`
-	OU                            []string      `json:"ou_list" mapstructure:"ou"`
-	OrganizationOld               string        `json:"organization,omitempty"`
-	Organization                  []string      `json:"organization_list" mapstructure:"organization"`
-	Country                       []string      `json:"country" mapstructure:"country"`
-	Locality                      []string      `json:"locality" mapstructure:"locality"`
-	Province                      []string      `json:"province" mapstructure:"province"`
-	StreetAddress                 []string      `json:"street_address" mapstructure:"street_address"`
-	PostalCode                    []string      `json:"postal_code" mapstructure:"postal_code"`
-	GenerateLease                 *bool         `json:"generate_lease,omitempty"`
-	NoStore                       bool          `json:"no_store" mapstructure:"no_store"`
-	RequireCN                     bool          `json:"require_cn" mapstructure:"require_cn"`
-	AllowedOtherSANs              []string      `json:"allowed_other_sans" mapstructure:"allowed_other_sans"`
-	AllowedSerialNumbers          []string      `json:"allowed_serial_numbers" mapstructure:"allowed_serial_numbers"`
-	PolicyIdentifiers             []string      `json:"policy_identifiers" mapstructure:"policy_identifiers"`
-	ExtKeyUsageOIDs               []string      `json:"ext_key_usage_oids" mapstructure:"ext_key_usage_oids"`
-	BasicConstraintsValidForNonCA bool          `json:"basic_constraints_valid_for_non_ca" mapstructure:"basic_constraints_valid_for_non_ca"`
+	LeaseMax                      string              `json:"lease_max"`
+	Lease                         string              `json:"lease"`
+	DeprecatedMaxTTL              string              `json:"max_ttl" mapstructure:"max_ttl"`
+	DeprecatedTTL                 string              `json:"ttl" mapstructure:"ttl"`
+	TTL                           time.Duration       `json:"ttl_duration" mapstructure:"ttl_duration"`
+	MaxTTL                        time.Duration       `json:"max_ttl_duration" mapstructure:"max_ttl_duration"`
+	AllowLocalhost                bool                `json:"allow_localhost" mapstructure:"allow_localhost"`
+	AllowedBaseDomain             string              `json:"allowed_base_domain" mapstructure:"allowed_base_domain"`
+	AllowedDomainsOld             string              `json:"allowed_domains,omit_empty"`
+	AllowedDomains                []string            `json:"allowed_domains_list" mapstructure:"allowed_domains"`
+	AllowBaseDomain               bool                `json:"allow_base_domain"`
+	AllowBareDomains              bool                `json:"allow_bare_domains" mapstructure:"allow_bare_domains"`
+	AllowTokenDisplayName         bool                `json:"allow_token_displayname" mapstructure:"allow_token_displayname"`
+	AllowSubdomains               bool                `json:"allow_subdomains" mapstructure:"allow_subdomains"`
+	AllowGlobDomains              bool                `json:"allow_glob_domains" mapstructure:"allow_glob_domains"`
+	AllowAnyName                  bool                `json:"allow_any_name" mapstructure:"allow_any_name"`
+	EnforceHostnames              bool                `json:"enforce_hostnames" mapstructure:"enforce_hostnames"`
+	AllowIPSANs                   bool                `json:"allow_ip_sans" mapstructure:"allow_ip_sans"`
+	ServerFlag                    bool                `json:"server_flag" mapstructure:"server_flag"`
+	ClientFlag                    bool                `json:"client_flag" mapstructure:"client_flag"`
+	CodeSigningFlag               bool                `json:"code_signing_flag" mapstructure:"code_signing_flag"`
+	EmailProtectionFlag           bool                `json:"email_protection_flag" mapstructure:"email_protection_flag"`
+	UseCSRCommonName              bool                `json:"use_csr_common_name" mapstructure:"use_csr_common_name"`
+	UseCSRSANs                    bool                `json:"use_csr_sans" mapstructure:"use_csr_sans"`
+	KeyType                       string              `json:"key_type" mapstructure:"key_type"`
+	KeyBits                       int                 `json:"key_bits" mapstructure:"key_bits"`
+	MaxPathLength                 *int                `json:",omitempty" mapstructure:"max_path_length"`
+	KeyUsageOld                   string              `json:"key_usage,omitempty"`
+	KeyUsage                      []string            `json:"key_usage_list" mapstructure:"key_usage"`
+	OUOld                         string              `json:"ou,omitempty"`
+	OU                            []string            `json:"ou_list" mapstructure:"ou"`
+	OrganizationOld               string              `json:"organization,omitempty"`
+	Organization                  []string            `json:"organization_list" mapstructure:"organization"`
+	Country                       []string            `json:"country" mapstructure:"country"`
+	Locality                      []string            `json:"locality" mapstructure:"locality"`
+	Province                      []string            `json:"province" mapstructure:"province"`
+	StreetAddress                 []string            `json:"street_address" mapstructure:"street_address"`
+	PostalCode                    []string            `json:"postal_code" mapstructure:"postal_code"`
+	GenerateLease                 *bool               `json:"generate_lease,omitempty"`
+	NoStore                       bool                `json:"no_store" mapstructure:"no_store"`
+	RequireCN                     bool                `json:"require_cn" mapstructure:"require_cn"`
+	AllowedOtherSANs              []string            `json:"allowed_other_sans" mapstructure:"allowed_other_sans"`
+	AllowedSerialNumbers          []string            `json:"allowed_serial_numbers" mapstructure:"allowed_serial_numbers"`
+	PolicyIdentifiers             []string            `json:"policy_identifiers" mapstructure:"policy_identifiers"`
+	PolicyInformation             []policyInformation `json:"policy_information" mapstructure:"policy_information"`
+	ExtensionTemplates            []extensionTemplate `json:"extension_templates" mapstructure:"extension_templates"`
+	ExtKeyUsageOIDs               []string            `json:"ext_key_usage_oids" mapstructure:"ext_key_usage_oids"`
+	BasicConstraintsValidForNonCA bool                `json:"basic_constraints_valid_for_non_ca" mapstructure:"basic_constraints_valid_for_non_ca"`
+	IssuerRef                     string              `json:"issuer_ref" mapstructure:"issuer_ref"`
 
 	// Used internally for signing intermediates
 	AllowExpirationPastCA bool
 }
 
+// policies returns the certificate policies of the role, with their
+// qualifiers if any were set
+func (r *roleEntry) policies() []policyInformation {
+	if len(r.PolicyInformation) > 0 {
+		return r.PolicyInformation
+	}
+
+	var policies []policyInformation
+	for _, oid := range r.PolicyIdentifiers {
+		policies = append(policies, policyInformation{OID: oid})
+	}
+	return policies
+}
+
 func (r *roleEntry) ToResponseData() map[string]interface{} {
 	responseData := map[string]interface{}{
 		"ttl":                                int64(r.TTL.Seconds()),
@@ -652,7 +748,10 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 		"allowed_serial_numbers":             r.AllowedSerialNumbers,
 		"require_cn":                         r.RequireCN,
 		"policy_identifiers":                 r.PolicyIdentifiers,
+		"policy_information":                 r.policies(),
+		"extension_templates":                r.ExtensionTemplates,
 		"basic_constraints_valid_for_non_ca": r.BasicConstraintsValidForNonCA,
+		"issuer_ref":                         r.IssuerRef,
 	}
 	if r.MaxPathLength != nil {
 		responseData["max_path_length"] = r.MaxPathLength
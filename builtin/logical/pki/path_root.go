@@ -32,6 +32,27 @@ func pathGenerateRoot(b *backend) *framework.Path {
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAKeyGenerationFields(ret.Fields)
 	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerNameField(ret.Fields)
+
+	return ret
+}
+
+func pathRotateRoot(b *backend) *framework.Path {
+	ret := &framework.Path{
+		Pattern: "root/rotate/" + framework.GenericNameRegex("exported"),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCARotateRoot,
+		},
+
+		HelpSynopsis:    pathRotateRootHelpSyn,
+		HelpDescription: pathRotateRootHelpDesc,
+	}
+
+	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
+	ret.Fields = addCAKeyGenerationFields(ret.Fields)
+	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerNameField(ret.Fields)
 
 	return ret
 }
@@ -72,6 +93,8 @@ func pathSignIntermediate(b *backend) *framework.Path {
 		Description: `PEM-format CSR to be signed.`,
 	}
 
+	ret.Fields = addIssuerRefField(ret.Fields)
+
 	ret.Fields["use_csr_values"] = &framework.FieldSchema{
 		Type:    framework.TypeBool,
 		Default: false,
@@ -108,26 +131,38 @@ func pathSignSelfIssued(b *backend) *framework.Path {
 		HelpDescription: pathSignSelfIssuedHelpDesc,
 	}
 
+	ret.Fields = addIssuerRefField(ret.Fields)
+
 	return ret
 }
 
 func (b *backend) pathCADeleteRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return nil, req.Storage.Delete(ctx, "config/ca_bundle")
+	return nil, b.deleteIssuers(ctx, req.Storage)
 }
 
 func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	var err error
-
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
+	issuers, err := b.listIssuers(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
-	if entry != nil {
+	if len(issuers) > 0 {
 		resp := &logical.Response{}
-		resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot.", req.MountPoint))
+		resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot. To add another root, use %sroot/rotate.", req.MountPoint, req.MountPoint))
 		return resp, nil
 	}
 
+	return b.generateRoot(ctx, req, data)
+}
+
+// pathCARotateRoot generates a new root alongside the existing issuers, so
+// that it can be distributed before becoming the default issuer
+func (b *backend) pathCARotateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.generateRoot(ctx, req, data)
+}
+
+func (b *backend) generateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var err error
+
 	exported, format, role, errorResp := b.getGenerationParams(data)
 	if errorResp != nil {
 		return errorResp, nil
@@ -202,15 +237,21 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 		}
 	}
 
-	// Store it as the CA bundle
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
+	// Store it as a key and an issuer, which becomes the default one if
+	// there is none yet
+	key, _, err := b.importKey(ctx, req.Storage, cb.PrivateKeyType, cb.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
-	err = req.Storage.Put(ctx, entry)
+	issuer, _, err := b.importIssuer(ctx, req.Storage, cb.Certificate)
 	if err != nil {
 		return nil, err
 	}
+	if errResp := b.setIssuerName(ctx, req.Storage, issuer, data.Get("issuer_name").(string)); errResp != nil {
+		return errResp, nil
+	}
+	resp.Data["issuer_id"] = issuer.ID
+	resp.Data["key_id"] = key.ID
 
 	// Also store it as just the certificate identified by serial number, so it
 	// can be revoked
@@ -222,15 +263,6 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 		return nil, errwrap.Wrapf("unable to store certificate locally: {{err}}", err)
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
-	}
-
 	// Build a fresh CRL
 	err = buildCRL(ctx, b, req)
 	if err != nil {
@@ -277,7 +309,7 @@ func (b *backend) pathCASignIntermediate(ctx context.Context, req *logical.Reque
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := b.fetchCAInfo(ctx, req, data.Get("issuer_ref").(string))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -404,7 +436,7 @@ func (b *backend) pathCASignSelfIssued(ctx context.Context, req *logical.Request
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := b.fetchCAInfo(ctx, req, data.Get("issuer_ref").(string))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -455,8 +487,22 @@ const pathGenerateRootHelpDesc = `
 See the API documentation for more information.
 `
 
+const pathRotateRootHelpSyn = `
+Generate a new root CA certificate and private key alongside the existing ones.
+`
+
+const pathRotateRootHelpDesc = `
+This generates a new root CA certificate and private key, stored as a new
+issuer of the mount. Unlike "root/generate", it does not refuse to run when
+the mount already holds issuers, and the new issuer only becomes the default
+one if there was none. Once the new root has been distributed, switch the
+default issuer with the "config/issuers" endpoint.
+
+See the API documentation for more information.
+`
+
 const pathDeleteRootHelpSyn = `
-Deletes the root CA key to allow a new one to be generated.
+Deletes the issuers and keys of the mount to allow a new root to be generated.
 `
 
 const pathDeleteRootHelpDesc = `
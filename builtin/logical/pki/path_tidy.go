@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/errwrap"
@@ -48,6 +49,77 @@ Defaults to 72 hours.`,
 	}
 }
 
+func pathTidyStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-status$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTidyStatusRead,
+		},
+
+		HelpSynopsis:    pathTidyStatusHelpSyn,
+		HelpDescription: pathTidyStatusHelpDesc,
+	}
+}
+
+const tidyStatePath = "tidy-state"
+
+// tidyState tracks the automatic tidy operations of the mount
+type tidyState struct {
+	LastAutoTidy time.Time `json:"last_auto_tidy"`
+}
+
+func getTidyState(ctx context.Context, s logical.Storage) (*tidyState, error) {
+	entry, err := s.Get(ctx, tidyStatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var state tidyState
+	if entry != nil {
+		if err := entry.DecodeJSON(&state); err != nil {
+			return nil, err
+		}
+	}
+	return &state, nil
+}
+
+func setTidyState(ctx context.Context, s logical.Storage, state *tidyState) error {
+	entry, err := logical.StorageEntryJSON(tidyStatePath, state)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+const (
+	tidyStatusInactive = "inactive"
+	tidyStatusRunning  = "running"
+	tidyStatusFinished = "finished"
+	tidyStatusError    = "error"
+)
+
+// tidyStatus holds the progress of the last tidy operation of the mount, run
+// either through the tidy endpoint or by the auto-tidy
+type tidyStatus struct {
+	state        string
+	source       string
+	err          error
+	timeStarted  time.Time
+	timeFinished time.Time
+
+	safetyBuffer       int
+	tidyCertStore      bool
+	tidyRevocationList bool
+
+	certStoreTotalCount       int
+	certStoreProcessedCount   int
+	certStoreDeletedCount     int
+	revokedCertTotalCount     int
+	revokedCertProcessedCount int
+	revokedCertDeletedCount   int
+}
+
 func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	safetyBuffer := d.Get("safety_buffer").(int)
 	tidyCertStore := d.Get("tidy_cert_store").(bool)
@@ -57,9 +129,72 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 		return logical.ErrorResponse("safety_buffer must be greater than zero"), nil
 	}
 
-	bufferDuration := time.Duration(safetyBuffer) * time.Second
+	if !atomic.CompareAndSwapUint32(&b.tidyCASGuard, 0, 1) {
+		return logical.ErrorResponse("tidy operation already in progress"), nil
+	}
+	defer atomic.StoreUint32(&b.tidyCASGuard, 0)
+
+	b.startTidyStatus("manual", safetyBuffer, tidyCertStore, tidyRevocationList)
+	warnings, err := b.tidy(ctx, req, time.Now(), safetyBuffer, tidyCertStore, tidyRevocationList)
+	b.finishTidyStatus(err)
+	if err != nil {
+		return nil, err
+	}
 
 	var resp *logical.Response
+	for _, warning := range warnings {
+		if resp == nil {
+			resp = &logical.Response{}
+		}
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+// startTidyStatus records the start of a tidy operation in the tidy status
+func (b *backend) startTidyStatus(source string, safetyBuffer int, tidyCertStore, tidyRevocationList bool) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus = &tidyStatus{
+		state:              tidyStatusRunning,
+		source:             source,
+		timeStarted:        time.Now(),
+		safetyBuffer:       safetyBuffer,
+		tidyCertStore:      tidyCertStore,
+		tidyRevocationList: tidyRevocationList,
+	}
+}
+
+// finishTidyStatus records the outcome of the running tidy operation
+func (b *backend) finishTidyStatus(err error) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.timeFinished = time.Now()
+	if err != nil {
+		b.tidyStatus.state = tidyStatusError
+		b.tidyStatus.err = err
+	} else {
+		b.tidyStatus.state = tidyStatusFinished
+	}
+}
+
+// updateTidyStatus applies the given change to the status of the running tidy
+func (b *backend) updateTidyStatus(update func(status *tidyStatus)) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	update(b.tidyStatus)
+}
+
+// tidy removes the certificates and revocation entries expired at the given
+// time, recording its progress in the tidy status. It must be called with the
+// tidyCASGuard held, once the tidy status is started.
+func (b *backend) tidy(ctx context.Context, req *logical.Request, now time.Time, safetyBuffer int, tidyCertStore, tidyRevocationList bool) ([]string, error) {
+	bufferDuration := time.Duration(safetyBuffer) * time.Second
+
+	var warnings []string
 
 	if tidyCertStore {
 		serials, err := req.Storage.List(ctx, "certs/")
@@ -67,30 +202,40 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 			return nil, errwrap.Wrapf("error fetching list of certs: {{err}}", err)
 		}
 
+		b.updateTidyStatus(func(status *tidyStatus) {
+			status.certStoreTotalCount = len(serials)
+		})
+
 		for _, serial := range serials {
+			b.updateTidyStatus(func(status *tidyStatus) {
+				status.certStoreProcessedCount++
+			})
+
 			certEntry, err := req.Storage.Get(ctx, "certs/"+serial)
 			if err != nil {
 				return nil, errwrap.Wrapf(fmt.Sprintf("error fetching certificate %q: {{err}}", serial), err)
 			}
 
 			if certEntry == nil {
-				if resp == nil {
-					resp = &logical.Response{}
-				}
-				resp.AddWarning(fmt.Sprintf("Certificate entry for serial %s is nil; tidying up since it is no longer useful for any server operations", serial))
+				warnings = append(warnings, fmt.Sprintf("Certificate entry for serial %s is nil; tidying up since it is no longer useful for any server operations", serial))
 				if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 					return nil, errwrap.Wrapf(fmt.Sprintf("error deleting nil entry with serial %s: {{err}}", serial), err)
 				}
+				b.updateTidyStatus(func(status *tidyStatus) {
+					status.certStoreDeletedCount++
+				})
+				continue
 			}
 
 			if certEntry.Value == nil || len(certEntry.Value) == 0 {
-				if resp == nil {
-					resp = &logical.Response{}
-				}
-				resp.AddWarning(fmt.Sprintf("Certificate entry for serial %s is nil; tidying up since it is no longer useful for any server operations", serial))
+				warnings = append(warnings, fmt.Sprintf("Certificate entry for serial %s is nil; tidying up since it is no longer useful for any server operations", serial))
 				if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 					return nil, errwrap.Wrapf(fmt.Sprintf("error deleting entry with nil value with serial %s: {{err}}", serial), err)
 				}
+				b.updateTidyStatus(func(status *tidyStatus) {
+					status.certStoreDeletedCount++
+				})
+				continue
 			}
 
 			cert, err := x509.ParseCertificate(certEntry.Value)
@@ -98,10 +243,13 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 				return nil, errwrap.Wrapf(fmt.Sprintf("unable to parse stored certificate with serial %q: {{err}}", serial), err)
 			}
 
-			if time.Now().After(cert.NotAfter.Add(bufferDuration)) {
+			if now.After(cert.NotAfter.Add(bufferDuration)) {
 				if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 					return nil, errwrap.Wrapf(fmt.Sprintf("error deleting serial %q from storage: {{err}}", serial), err)
 				}
+				b.updateTidyStatus(func(status *tidyStatus) {
+					status.certStoreDeletedCount++
+				})
 			}
 		}
 	}
@@ -117,31 +265,43 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 			return nil, errwrap.Wrapf("error fetching list of revoked certs: {{err}}", err)
 		}
 
+		b.updateTidyStatus(func(status *tidyStatus) {
+			status.revokedCertTotalCount = len(revokedSerials)
+		})
+
 		var revInfo revocationInfo
 		for _, serial := range revokedSerials {
+			b.updateTidyStatus(func(status *tidyStatus) {
+				status.revokedCertProcessedCount++
+			})
+
 			revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
 			if err != nil {
 				return nil, errwrap.Wrapf(fmt.Sprintf("unable to fetch revoked cert with serial %q: {{err}}", serial), err)
 			}
 
 			if revokedEntry == nil {
-				if resp == nil {
-					resp = &logical.Response{}
-				}
-				resp.AddWarning(fmt.Sprintf("Revoked entry for serial %s is nil; tidying up since it is no longer useful for any server operations", serial))
+				warnings = append(warnings, fmt.Sprintf("Revoked entry for serial %s is nil; tidying up since it is no longer useful for any server operations", serial))
 				if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
 					return nil, errwrap.Wrapf(fmt.Sprintf("error deleting nil revoked entry with serial %s: {{err}}", serial), err)
 				}
+				b.updateTidyStatus(func(status *tidyStatus) {
+					status.revokedCertDeletedCount++
+				})
+				tidiedRevoked = true
+				continue
 			}
 
 			if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
-				if resp == nil {
-					resp = &logical.Response{}
-				}
-				resp.AddWarning(fmt.Sprintf("Revoked entry for serial %s has nil value; tidying up since it is no longer useful for any server operations", serial))
+				warnings = append(warnings, fmt.Sprintf("Revoked entry for serial %s has nil value; tidying up since it is no longer useful for any server operations", serial))
 				if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
 					return nil, errwrap.Wrapf(fmt.Sprintf("error deleting revoked entry with nil value with serial %s: {{err}}", serial), err)
 				}
+				b.updateTidyStatus(func(status *tidyStatus) {
+					status.revokedCertDeletedCount++
+				})
+				tidiedRevoked = true
+				continue
 			}
 
 			err = revokedEntry.DecodeJSON(&revInfo)
@@ -154,21 +314,82 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 				return nil, errwrap.Wrapf(fmt.Sprintf("unable to parse stored revoked certificate with serial %q: {{err}}", serial), err)
 			}
 
-			if time.Now().After(revokedCert.NotAfter.Add(bufferDuration)) {
+			if now.After(revokedCert.NotAfter.Add(bufferDuration)) {
 				if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
 					return nil, errwrap.Wrapf(fmt.Sprintf("error deleting serial %q from revoked list: {{err}}", serial), err)
 				}
+				b.updateTidyStatus(func(status *tidyStatus) {
+					status.revokedCertDeletedCount++
+				})
 				tidiedRevoked = true
 			}
 		}
 
 		if tidiedRevoked {
-			if err := buildCRL(ctx, b, req); err != nil {
-				return nil, err
+			crlInfo, err := b.CRL(ctx, req.Storage)
+			if err != nil {
+				return nil, errwrap.Wrapf("error fetching CRL config information: {{err}}", err)
+			}
+
+			// Automatically rebuilt CRLs drop the entries on their next build
+			if !crlInfo.AutoRebuild {
+				if err := buildCRL(ctx, b, req); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
 
+	return warnings, nil
+}
+
+func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.tidyStatusLock.RLock()
+	defer b.tidyStatusLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"state":                        tidyStatusInactive,
+			"source":                       nil,
+			"error":                        nil,
+			"time_started":                 nil,
+			"time_finished":                nil,
+			"safety_buffer":                nil,
+			"tidy_cert_store":              nil,
+			"tidy_revocation_list":         nil,
+			"cert_store_total_count":       nil,
+			"cert_store_processed_count":   nil,
+			"cert_store_deleted_count":     nil,
+			"revoked_cert_total_count":     nil,
+			"revoked_cert_processed_count": nil,
+			"revoked_cert_deleted_count":   nil,
+		},
+	}
+
+	status := b.tidyStatus
+	if status == nil {
+		return resp, nil
+	}
+
+	resp.Data["state"] = status.state
+	resp.Data["source"] = status.source
+	resp.Data["time_started"] = status.timeStarted.Format(time.RFC3339Nano)
+	resp.Data["safety_buffer"] = status.safetyBuffer
+	resp.Data["tidy_cert_store"] = status.tidyCertStore
+	resp.Data["tidy_revocation_list"] = status.tidyRevocationList
+	resp.Data["cert_store_total_count"] = status.certStoreTotalCount
+	resp.Data["cert_store_processed_count"] = status.certStoreProcessedCount
+	resp.Data["cert_store_deleted_count"] = status.certStoreDeletedCount
+	resp.Data["revoked_cert_total_count"] = status.revokedCertTotalCount
+	resp.Data["revoked_cert_processed_count"] = status.revokedCertProcessedCount
+	resp.Data["revoked_cert_deleted_count"] = status.revokedCertDeletedCount
+	if !status.timeFinished.IsZero() {
+		resp.Data["time_finished"] = status.timeFinished.Format(time.RFC3339Nano)
+	}
+	if status.err != nil {
+		resp.Data["error"] = status.err.Error()
+	}
+
 	return resp, nil
 }
 
@@ -197,4 +418,20 @@ certificate/revocation information of each certificate being held in
 certificate storage or in revocation information will then be checked. If the
 current time, minus the value of 'safety_buffer', is greater than the
 expiration, it will be removed.
+
+Only one tidy operation runs at a time. Its progress is reported by the
+'tidy-status' endpoint, and it can also be run periodically in the background
+by configuring the 'config/auto-tidy' endpoint.
+`
+
+const pathTidyStatusHelpSyn = `
+Returns the status of the tidy operation.
+`
+
+const pathTidyStatusHelpDesc = `
+This is a read only endpoint that returns information about the current tidy
+operation, or the most recent one if none is running, whether it was started
+through the "tidy" endpoint or by the automatic tidy configured with
+"config/auto-tidy". The response holds the number of certificates and
+revocation entries checked and deleted so far.
 `
@@ -0,0 +1,129 @@
+package pki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPki_AutoTidy(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := issuersTestRequest(t, b, storage, logical.ReadOperation, "tidy-status", nil)
+	if resp.Data["state"] != tidyStatusInactive {
+		t.Fatalf("bad: tidy status before any tidy: %#v", resp.Data)
+	}
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "48h",
+	})
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	resp = issuersTestRequest(t, b, storage, logical.UpdateOperation, "issue/example", map[string]interface{}{
+		"common_name": "foo.example.com",
+		"ttl":         "1h",
+	})
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"].(string),
+	})
+
+	// Enabling the auto-tidy requires something to tidy
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/auto-tidy",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"enabled": true,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error enabling auto-tidy: err: %v resp: %#v", err, resp)
+	}
+
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "config/auto-tidy", map[string]interface{}{
+		"enabled":              true,
+		"tidy_cert_store":      true,
+		"tidy_revocation_list": true,
+		"safety_buffer":        "1s",
+	})
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "config/auto-tidy", nil)
+	if resp.Data["interval_duration"].(int) != 43200 || resp.Data["safety_buffer"].(int) != 1 {
+		t.Fatalf("bad: auto-tidy config: %#v", resp.Data)
+	}
+
+	// Run the automatic tidy once the certificate expired beyond the safety
+	// buffer
+	now := time.Now().Add(2 * time.Hour)
+	if err := b.periodicTidy(context.Background(), &logical.Request{Storage: storage}, now); err != nil {
+		t.Fatal(err)
+	}
+	status := waitForTidy(t, b, storage)
+	if status["state"] != tidyStatusFinished || status["source"] != "auto" || status["error"] != nil {
+		t.Fatalf("bad: tidy status: %#v", status)
+	}
+	// The certificate store also holds the CA certificate, which is kept
+	if status["cert_store_total_count"].(int) != 2 || status["cert_store_processed_count"].(int) != 2 || status["cert_store_deleted_count"].(int) != 1 {
+		t.Fatalf("bad: cert store counts: %#v", status)
+	}
+	if status["revoked_cert_total_count"].(int) != 1 || status["revoked_cert_deleted_count"].(int) != 1 {
+		t.Fatalf("bad: revoked cert counts: %#v", status)
+	}
+
+	resp = issuersTestRequest(t, b, storage, logical.ListOperation, "certs", nil)
+	if len(resp.Data["keys"].([]string)) != 1 {
+		t.Fatalf("bad: certificates left after tidy: %#v", resp.Data["keys"])
+	}
+
+	// The next automatic tidy waits for the interval, which is tracked in
+	// storage and so survives reloading the mount
+	if err := b.periodicTidy(context.Background(), &logical.Request{Storage: storage}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "tidy-status", nil)
+	if resp.Data["time_started"] != status["time_started"] {
+		t.Fatal("automatic tidy ran again before its interval")
+	}
+
+	reloaded := createBackendWithStorageOf(t, storage)
+	if err := reloaded.periodicTidy(context.Background(), &logical.Request{Storage: storage}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	resp = issuersTestRequest(t, reloaded, storage, logical.ReadOperation, "tidy-status", nil)
+	if resp.Data["state"] != tidyStatusInactive {
+		t.Fatalf("automatic tidy ran again before its interval after reloading: %#v", resp.Data)
+	}
+
+	if err := reloaded.periodicTidy(context.Background(), &logical.Request{Storage: storage}, now.Add(12*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if status := waitForTidy(t, reloaded, storage); status["state"] != tidyStatusFinished || status["source"] != "auto" {
+		t.Fatalf("bad: tidy status after the interval: %#v", status)
+	}
+
+	// Manual tidies are reported as well
+	issuersTestRequest(t, b, storage, logical.UpdateOperation, "tidy", map[string]interface{}{
+		"tidy_cert_store": true,
+	})
+	resp = issuersTestRequest(t, b, storage, logical.ReadOperation, "tidy-status", nil)
+	if resp.Data["state"] != tidyStatusFinished || resp.Data["source"] != "manual" || resp.Data["tidy_revocation_list"].(bool) {
+		t.Fatalf("bad: tidy status: %#v", resp.Data)
+	}
+}
+
+// waitForTidy returns the tidy status once the running tidy, if any, is done
+func waitForTidy(t *testing.T, b *backend, storage logical.Storage) map[string]interface{} {
+	for i := 0; i < 100; i++ {
+		resp := issuersTestRequest(t, b, storage, logical.ReadOperation, "tidy-status", nil)
+		if resp.Data["state"] != tidyStatusRunning {
+			return resp.Data
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("tidy did not finish")
+	return nil
+}
@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	credAppRole "github.com/hashicorp/vault/builtin/credential/approle"
+	"github.com/hashicorp/vault/command/agent/auth"
+	agentapprole "github.com/hashicorp/vault/command/agent/auth/approle"
+	"github.com/hashicorp/vault/command/agent/sink"
+	"github.com/hashicorp/vault/command/agent/sink/file"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/logging"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestAppRoleEndToEnd(t *testing.T) {
+	testAppRoleEndToEnd(t, false, false)
+}
+
+func TestAppRoleEndToEnd_WrappedSink(t *testing.T) {
+	testAppRoleEndToEnd(t, true, false)
+}
+
+func TestAppRoleEndToEnd_WrappedSecretID(t *testing.T) {
+	testAppRoleEndToEnd(t, false, true)
+}
+
+func testAppRoleEndToEnd(t *testing.T, wrapSink, wrapSecretID bool) {
+	logger := logging.NewVaultLogger(hclog.Trace)
+	coreConfig := &vault.CoreConfig{
+		DisableMlock: true,
+		DisableCache: true,
+		Logger:       logger,
+		CredentialBackends: map[string]logical.Factory{
+			"approle": credAppRole.Factory,
+		},
+	}
+
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+	client := cluster.Cores[0].Client
+
+	if err := client.Sys().EnableAuthWithOptions("approle", &api.EnableAuthOptions{
+		Type: "approle",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Logical().Write("auth/approle/role/test1", map[string]interface{}{
+		"bind_secret_id": "true",
+		"token_ttl":      "3s",
+		"token_max_ttl":  "10s",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	secretIDClient := client
+	if wrapSecretID {
+		var err error
+		secretIDClient, err = client.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		secretIDClient.SetToken(client.Token())
+		secretIDClient.SetWrappingLookupFunc(func(string, string) string {
+			return "5m"
+		})
+	}
+	resp, err := secretIDClient.Logical().Write("auth/approle/role/test1/secret-id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secretID string
+	if wrapSecretID {
+		secretID = resp.WrapInfo.Token
+	} else {
+		secretID = resp.Data["secret_id"].(string)
+	}
+
+	resp, err = client.Logical().Read("auth/approle/role/test1/role-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleID := resp.Data["role_id"].(string)
+
+	tmpDir, err := ioutil.TempDir("", "approle-e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	roleIDPath := filepath.Join(tmpDir, "role-id")
+	secretIDPath := filepath.Join(tmpDir, "secret-id")
+	tokenPath := filepath.Join(tmpDir, "token")
+	if err := ioutil.WriteFile(roleIDPath, []byte(roleID+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(secretIDPath, []byte(secretID+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	methodConfig := map[string]interface{}{
+		"role_id_file_path":   roleIDPath,
+		"secret_id_file_path": secretIDPath,
+	}
+	if wrapSecretID {
+		methodConfig["secret_id_response_wrapping_path"] = "auth/approle/role/test1/secret-id"
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	am, err := agentapprole.NewApproleAuthMethod(&auth.AuthConfig{
+		Logger:    logger.Named("auth.approle"),
+		MountPath: "auth/approle",
+		Config:    methodConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agentClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentClient.ClearToken()
+
+	ah := auth.NewAuthHandler(&auth.AuthHandlerConfig{
+		Logger: logger.Named("auth.handler"),
+		Client: agentClient,
+	})
+
+	sinkConfig := &sink.SinkConfig{
+		Logger: logger.Named("sink.file"),
+		Config: map[string]interface{}{
+			"path": tokenPath,
+		},
+	}
+	if wrapSink {
+		sinkConfig.WrapTTL = 5 * time.Minute
+	}
+	fs, err := file.NewFileSink(sinkConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinkConfig.Sink = fs
+
+	ss := sink.NewSinkServer(&sink.SinkServerConfig{
+		Logger: logger.Named("sink.server"),
+		Client: agentClient,
+	})
+
+	go ah.Run(ctx, am)
+	go ss.Run(ctx, ah.OutputCh, []*sink.SinkConfig{sinkConfig})
+	defer func() {
+		cancelFunc()
+		<-ah.DoneCh
+		<-ss.DoneCh
+	}()
+
+	// readToken waits for a token other than the given one to be written
+	readToken := func(previous string) string {
+		timeout := time.Now().Add(20 * time.Second)
+		for time.Now().Before(timeout) {
+			val, err := ioutil.ReadFile(tokenPath)
+			if err == nil && len(val) > 0 && string(val) != previous {
+				return string(val)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatal("did not find a new token in the sink")
+		return ""
+	}
+
+	// lookupToken returns the token written to the sink, unwrapping it if
+	// necessary, after checking that it's valid
+	lookupToken := func(written string) string {
+		token := written
+		if wrapSink {
+			wrapInfo := new(api.SecretWrapInfo)
+			if err := jsonutil.DecodeJSON([]byte(written), wrapInfo); err != nil {
+				t.Fatal(err)
+			}
+			unwrapClient, err := client.Clone()
+			if err != nil {
+				t.Fatal(err)
+			}
+			unwrapClient.SetToken(wrapInfo.Token)
+			secret, err := unwrapClient.Logical().Unwrap("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token = secret.Data["token"].(string)
+		}
+
+		lookupClient, err := client.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lookupClient.SetToken(token)
+		secret, err := lookupClient.Auth().Token().LookupSelf()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret.Data["meta"].(map[string]interface{})["role_name"] != "test1" {
+			t.Fatalf("bad: %#v", secret.Data)
+		}
+		return token
+	}
+
+	written := readToken("")
+	lookupToken(written)
+
+	// The secret ID file is removed once the secret ID has been used
+	if _, err := os.Stat(secretIDPath); !os.IsNotExist(err) {
+		t.Fatalf("expected secret ID file to be removed, got: %v", err)
+	}
+
+	// Once the token reaches its max TTL the agent logs in again using the
+	// cached secret ID
+	newWritten := readToken(written)
+	lookupToken(newWritten)
+}
@@ -0,0 +1,217 @@
+package approle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/auth"
+	"github.com/hashicorp/vault/helper/parseutil"
+)
+
+type approleMethod struct {
+	logger    hclog.Logger
+	mountPath string
+
+	roleIDFilePath                 string
+	secretIDFilePath               string
+	removeSecretIDFileAfterReading bool
+	secretIDResponseWrappingPath   string
+
+	l                  sync.Mutex
+	cachedRoleID       string
+	cachedSecretID     string
+	secretIDWasCleared bool
+}
+
+// NewApproleAuthMethod returns an auth method that logs in to the AppRole
+// backend using a role ID and secret ID read from files
+func NewApproleAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, errors.New("empty config")
+	}
+	if conf.Config == nil {
+		return nil, errors.New("empty config data")
+	}
+
+	a := &approleMethod{
+		logger:                         conf.Logger,
+		mountPath:                      conf.MountPath,
+		removeSecretIDFileAfterReading: true,
+	}
+
+	roleIDFilePathRaw, ok := conf.Config["role_id_file_path"]
+	if !ok {
+		return nil, errors.New("missing 'role_id_file_path' value")
+	}
+	a.roleIDFilePath, ok = roleIDFilePathRaw.(string)
+	if !ok {
+		return nil, errors.New("could not convert 'role_id_file_path' config value to string")
+	}
+	if a.roleIDFilePath == "" {
+		return nil, errors.New("'role_id_file_path' value is empty")
+	}
+
+	if secretIDFilePathRaw, ok := conf.Config["secret_id_file_path"]; ok {
+		a.secretIDFilePath, ok = secretIDFilePathRaw.(string)
+		if !ok {
+			return nil, errors.New("could not convert 'secret_id_file_path' config value to string")
+		}
+	}
+
+	if removeRaw, ok := conf.Config["remove_secret_id_file_after_reading"]; ok {
+		remove, err := parseutil.ParseBool(removeRaw)
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing 'remove_secret_id_file_after_reading' value: {{err}}", err)
+		}
+		a.removeSecretIDFileAfterReading = remove
+	}
+
+	if wrappingPathRaw, ok := conf.Config["secret_id_response_wrapping_path"]; ok {
+		a.secretIDResponseWrappingPath, ok = wrappingPathRaw.(string)
+		if !ok {
+			return nil, errors.New("could not convert 'secret_id_response_wrapping_path' config value to string")
+		}
+		if a.secretIDResponseWrappingPath == "" {
+			return nil, errors.New("'secret_id_response_wrapping_path' value is empty")
+		}
+		if a.secretIDFilePath == "" {
+			return nil, errors.New("'secret_id_response_wrapping_path' is set but 'secret_id_file_path' is not")
+		}
+	}
+
+	return a, nil
+}
+
+func (a *approleMethod) Authenticate(ctx context.Context, client *api.Client) (string, map[string]interface{}, error) {
+	a.logger.Trace("beginning authentication")
+
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	roleID, err := readFile(a.roleIDFilePath)
+	if err != nil {
+		if a.cachedRoleID == "" {
+			return "", nil, errwrap.Wrapf("error reading role ID file and no cached role ID known: {{err}}", err)
+		}
+		a.logger.Warn("error reading role ID file, using cached value", "error", err)
+	} else if roleID == "" {
+		if a.cachedRoleID == "" {
+			return "", nil, errors.New("role ID file empty and no cached role ID known")
+		}
+		a.logger.Warn("role ID file is empty, using cached value")
+	} else {
+		a.cachedRoleID = roleID
+	}
+
+	data := map[string]interface{}{
+		"role_id": a.cachedRoleID,
+	}
+
+	if a.secretIDFilePath != "" {
+		secretID, err := readFile(a.secretIDFilePath)
+		switch {
+		case err != nil || secretID == "":
+			if a.cachedSecretID == "" {
+				if err == nil {
+					err = errors.New("secret ID file empty")
+				}
+				return "", nil, errwrap.Wrapf("error reading secret ID file and no cached secret ID known: {{err}}", err)
+			}
+			a.logger.Debug("secret ID file not readable or empty, using cached value")
+
+		default:
+			if a.secretIDResponseWrappingPath != "" {
+				secretID, err = a.unwrapSecretID(client, secretID)
+				if err != nil {
+					return "", nil, err
+				}
+			}
+			a.cachedSecretID = secretID
+			a.secretIDWasCleared = false
+		}
+
+		data["secret_id"] = a.cachedSecretID
+	}
+
+	return fmt.Sprintf("%s/login", a.mountPath), data, nil
+}
+
+// unwrapSecretID unwraps the given response-wrapping token after verifying
+// that it was created at the expected path, guarding against a token that
+// was intercepted and replaced
+func (a *approleMethod) unwrapSecretID(client *api.Client, wrappingToken string) (string, error) {
+	unwrapClient, err := client.Clone()
+	if err != nil {
+		return "", errwrap.Wrapf("error cloning client to unwrap secret ID: {{err}}", err)
+	}
+	unwrapClient.SetToken(wrappingToken)
+
+	lookup, err := unwrapClient.Logical().Write("sys/wrapping/lookup", map[string]interface{}{
+		"token": wrappingToken,
+	})
+	if err != nil {
+		return "", errwrap.Wrapf("error looking up response-wrapped secret ID: {{err}}", err)
+	}
+	if lookup == nil || lookup.Data == nil {
+		return "", errors.New("empty response from response-wrapped secret ID lookup")
+	}
+	creationPath, _ := lookup.Data["creation_path"].(string)
+	if strings.Trim(creationPath, "/") != strings.Trim(a.secretIDResponseWrappingPath, "/") {
+		return "", fmt.Errorf("response-wrapped secret ID was created at unexpected path %q", creationPath)
+	}
+
+	secret, err := unwrapClient.Logical().Unwrap("")
+	if err != nil {
+		return "", errwrap.Wrapf("error unwrapping secret ID: {{err}}", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("empty response from unwrapping secret ID")
+	}
+	secretID, _ := secret.Data["secret_id"].(string)
+	if secretID == "" {
+		return "", errors.New("unwrapped response does not contain a secret ID")
+	}
+
+	return secretID, nil
+}
+
+func (a *approleMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+// CredSuccess removes the secret ID file once its secret ID has been used,
+// if so configured
+func (a *approleMethod) CredSuccess() {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	if a.secretIDFilePath == "" || !a.removeSecretIDFileAfterReading || a.secretIDWasCleared {
+		return
+	}
+
+	if err := os.Remove(a.secretIDFilePath); err != nil && !os.IsNotExist(err) {
+		a.logger.Error("error removing secret ID file after successful authentication", "error", err)
+		return
+	}
+	a.secretIDWasCleared = true
+}
+
+func (a *approleMethod) Shutdown() {
+}
+
+// readFile returns the whitespace-trimmed contents of the file at path
+func readFile(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
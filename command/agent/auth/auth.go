@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+var (
+	errNoSecret   = errors.New("no secret returned from login")
+	errNoWrapInfo = errors.New("no wrap info returned from login")
+	errNoAuth     = errors.New("no client token returned from login")
+)
+
+const (
+	// initialBackoff is how long the handler waits before retrying after a
+	// failed authentication; the wait doubles on each consecutive failure
+	// up to maxBackoff
+	initialBackoff = 2 * time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// AuthMethod is the interface implemented by the auto-auth methods. The
+// method returns the login path and data; the handler performs the login
+// itself so that methods do not need to know about wrapping or renewal.
+type AuthMethod interface {
+	// Authenticate returns the path to write to, relative to the API root,
+	// and the data to write in order to log in
+	Authenticate(context.Context, *api.Client) (string, map[string]interface{}, error)
+
+	// NewCreds returns a channel the method signals when its credentials
+	// have changed and a new login should be performed. It may be nil.
+	NewCreds() chan struct{}
+
+	// CredSuccess is called after the credentials returned by Authenticate
+	// have successfully been used to log in
+	CredSuccess()
+
+	// Shutdown releases any resources held by the method
+	Shutdown()
+}
+
+// AuthMethodWithClient is implemented by auth methods that must log in using
+// a client other than the agent's, such as one presenting a particular TLS
+// client certificate
+type AuthMethodWithClient interface {
+	AuthMethod
+
+	// AuthClient returns the client to log in with, derived from the given
+	// client
+	AuthClient(*api.Client) (*api.Client, error)
+}
+
+// AuthConfig is the configuration passed to an auth method's constructor
+type AuthConfig struct {
+	Logger    hclog.Logger
+	MountPath string
+	Config    map[string]interface{}
+}
+
+// AuthHandler performs logins using an AuthMethod and keeps the resulting
+// token alive, sending each new token to OutputCh
+type AuthHandler struct {
+	DoneCh   chan struct{}
+	OutputCh chan string
+
+	logger  hclog.Logger
+	client  *api.Client
+	random  *rand.Rand
+	wrapTTL time.Duration
+}
+
+// AuthHandlerConfig is the configuration for an AuthHandler
+type AuthHandlerConfig struct {
+	Logger  hclog.Logger
+	Client  *api.Client
+	WrapTTL time.Duration
+}
+
+// NewAuthHandler returns a new AuthHandler. The given client must not have a
+// token set, as one would be sent along with the login requests.
+func NewAuthHandler(conf *AuthHandlerConfig) *AuthHandler {
+	ah := &AuthHandler{
+		DoneCh: make(chan struct{}),
+		// This is buffered so that if we try to output after the sink server
+		// has been shut down, during agent shutdown, we won't block
+		OutputCh: make(chan string, 1),
+		logger:   conf.Logger,
+		client:   conf.Client,
+		random:   rand.New(rand.NewSource(int64(time.Now().Nanosecond()))),
+		wrapTTL:  conf.WrapTTL,
+	}
+
+	return ah
+}
+
+// backoff waits for the given duration, returning false if the context was
+// canceled first
+func backoff(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nextBackoff returns the wait following one of the given duration
+func nextBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// Run logs in using the given method until the context is canceled. After
+// each successful login the token is renewed for as long as possible, after
+// which the handler logs in again.
+func (ah *AuthHandler) Run(ctx context.Context, am AuthMethod) {
+	if am == nil {
+		panic("nil auth method")
+	}
+
+	ah.logger.Info("starting auth handler")
+	defer func() {
+		am.Shutdown()
+		close(ah.OutputCh)
+		close(ah.DoneCh)
+		ah.logger.Info("auth handler stopped")
+	}()
+
+	credCh := am.NewCreds()
+	if credCh == nil {
+		credCh = make(chan struct{})
+	}
+
+	wait := initialBackoff
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		secret, err := ah.login(ctx, am)
+		if err != nil {
+			ah.logger.Error("error authenticating", "error", err, "backoff", wait.Seconds())
+			if !backoff(ctx, wait) {
+				return
+			}
+			wait = nextBackoff(wait)
+			continue
+		}
+		wait = initialBackoff
+
+		if ah.wrapTTL > 0 {
+			wrappedResp, err := jsonutil.EncodeJSON(secret.WrapInfo)
+			if err != nil {
+				ah.logger.Error("failed to encode wrapinfo", "error", err)
+				if !backoff(ctx, initialBackoff) {
+					return
+				}
+				continue
+			}
+			ah.logger.Info("authentication successful, sending wrapped token to sinks and pausing")
+			if !ah.output(ctx, string(wrappedResp)) {
+				return
+			}
+			am.CredSuccess()
+
+			// A wrapped token cannot be renewed by the agent, so wait for
+			// new credentials before logging in again
+			select {
+			case <-ctx.Done():
+				return
+			case <-credCh:
+				ah.logger.Info("auth method found new credentials, re-authenticating")
+			}
+			continue
+		}
+
+		ah.logger.Info("authentication successful, sending token to sinks")
+		if !ah.output(ctx, secret.Auth.ClientToken) {
+			return
+		}
+		am.CredSuccess()
+
+		if !ah.watch(ctx, secret, credCh) {
+			return
+		}
+	}
+}
+
+// login performs a single login using the auth method
+func (ah *AuthHandler) login(ctx context.Context, am AuthMethod) (*api.Secret, error) {
+	path, data, err := am.Authenticate(ctx, ah.client)
+	if err != nil {
+		return nil, errwrap.Wrapf("error getting path or data from method: {{err}}", err)
+	}
+
+	clientToUse := ah.client
+	if amc, ok := am.(AuthMethodWithClient); ok {
+		clientToUse, err = amc.AuthClient(ah.client)
+		if err != nil {
+			return nil, errwrap.Wrapf("error creating client for authentication: {{err}}", err)
+		}
+	}
+	if ah.wrapTTL > 0 {
+		wrapClient, err := clientToUse.Clone()
+		if err != nil {
+			return nil, errwrap.Wrapf("error creating client for wrapped call: {{err}}", err)
+		}
+		wrapTTL := ah.wrapTTL
+		wrapClient.SetWrappingLookupFunc(func(string, string) string {
+			return wrapTTL.String()
+		})
+		clientToUse = wrapClient
+	}
+
+	secret, err := clientToUse.Logical().Write(path, data)
+	switch {
+	case err != nil:
+		return nil, errwrap.Wrapf("error authenticating: {{err}}", err)
+	case secret == nil:
+		return nil, errwrap.Wrapf("error authenticating: {{err}}", errNoSecret)
+	case ah.wrapTTL > 0 && secret.WrapInfo == nil:
+		return nil, errwrap.Wrapf("error authenticating: {{err}}", errNoWrapInfo)
+	case ah.wrapTTL == 0 && (secret.Auth == nil || secret.Auth.ClientToken == ""):
+		return nil, errwrap.Wrapf("error authenticating: {{err}}", errNoAuth)
+	}
+
+	return secret, nil
+}
+
+// watch keeps the token in the given secret alive. It returns once a new
+// login is required, or false if the context was canceled.
+func (ah *AuthHandler) watch(ctx context.Context, secret *api.Secret, credCh chan struct{}) bool {
+	// Tokens that cannot be renewed are used for most of their lifetime
+	// and then replaced
+	if !secret.Auth.Renewable {
+		ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+		if ttl <= 0 {
+			// A token without a TTL, such as a root token, never expires
+			select {
+			case <-ctx.Done():
+				return false
+			case <-credCh:
+				ah.logger.Info("auth method found new credentials, re-authenticating")
+				return true
+			}
+		}
+
+		// Wait between two thirds and nine tenths of the TTL
+		fraction := 0.66 + ah.random.Float64()*0.24
+		select {
+		case <-ctx.Done():
+			return false
+		case <-credCh:
+			ah.logger.Info("auth method found new credentials, re-authenticating")
+		case <-time.After(time.Duration(float64(ttl) * fraction)):
+			ah.logger.Info("token is not renewable and is nearing expiry, re-authenticating")
+		}
+		return true
+	}
+
+	renewer, err := ah.client.NewRenewer(&api.RenewerInput{
+		Secret: secret,
+		Rand:   ah.random,
+	})
+	if err != nil {
+		ah.logger.Error("error creating renewer, backing off and retrying", "error", err)
+		return backoff(ctx, initialBackoff)
+	}
+
+	ah.logger.Info("starting renewal process")
+	go renewer.Renew()
+	defer renewer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ah.logger.Info("shutdown triggered, stopping renewer")
+			return false
+
+		case err := <-renewer.DoneCh():
+			ah.logger.Info("renewer done channel triggered")
+			if err != nil {
+				ah.logger.Error("error renewing token", "error", err)
+			}
+			return true
+
+		case <-renewer.RenewCh():
+			ah.logger.Info("renewed auth token")
+
+		case <-credCh:
+			ah.logger.Info("auth method found new credentials, re-authenticating")
+			return true
+		}
+	}
+}
+
+// output sends the token to the output channel, returning false if the
+// context was canceled first
+func (ah *AuthHandler) output(ctx context.Context, token string) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ah.OutputCh <- token:
+		return true
+	}
+}
@@ -0,0 +1,169 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+	awsauth "github.com/hashicorp/vault/builtin/credential/aws"
+	"github.com/hashicorp/vault/command/agent/auth"
+)
+
+const (
+	typeEC2 = "ec2"
+	typeIAM = "iam"
+)
+
+type awsMethod struct {
+	logger    hclog.Logger
+	authType  string
+	mountPath string
+	role      string
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	headerValue  string
+
+	// nonce is sent with every ec2 login so that the instance can log in
+	// again after the first login has been recorded by the backend
+	l     sync.Mutex
+	nonce string
+}
+
+// NewAWSAuthMethod returns an auth method that logs in to the AWS backend
+// using either the instance's signed identity document (ec2) or a signed
+// sts:GetCallerIdentity request (iam)
+func NewAWSAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, errors.New("empty config")
+	}
+	if conf.Config == nil {
+		return nil, errors.New("empty config data")
+	}
+
+	a := &awsMethod{
+		logger:    conf.Logger,
+		mountPath: conf.MountPath,
+	}
+
+	for k, target := range map[string]*string{
+		"type":          &a.authType,
+		"role":          &a.role,
+		"access_key":    &a.accessKey,
+		"secret_key":    &a.secretKey,
+		"session_token": &a.sessionToken,
+		"header_value":  &a.headerValue,
+		"nonce":         &a.nonce,
+	} {
+		raw, ok := conf.Config[k]
+		if !ok {
+			continue
+		}
+		v, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("could not convert '%s' config value to string", k)
+		}
+		*target = v
+	}
+
+	switch a.authType {
+	case "":
+		return nil, errors.New("'type' value is empty")
+	case typeEC2:
+		if a.accessKey != "" || a.secretKey != "" || a.sessionToken != "" || a.headerValue != "" {
+			return nil, errors.New("credentials and 'header_value' are only valid with the iam type")
+		}
+	case typeIAM:
+		if a.nonce != "" {
+			return nil, errors.New("'nonce' is only valid with the ec2 type")
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", a.authType)
+	}
+
+	if a.role == "" {
+		return nil, errors.New("'role' value is empty")
+	}
+
+	return a, nil
+}
+
+func (a *awsMethod) Authenticate(ctx context.Context, client *api.Client) (string, map[string]interface{}, error) {
+	a.logger.Trace("beginning authentication")
+
+	var data map[string]interface{}
+
+	switch a.authType {
+	case typeEC2:
+		sess, err := session.NewSession()
+		if err != nil {
+			return "", nil, errwrap.Wrapf("error creating session to probe EC2 metadata: {{err}}", err)
+		}
+		metadataSvc := ec2metadata.New(sess)
+		if !metadataSvc.Available() {
+			return "", nil, errors.New("session available, but EC2 metadata service unavailable")
+		}
+
+		pkcs7, err := metadataSvc.GetDynamicData("/instance-identity/pkcs7")
+		if err != nil {
+			return "", nil, errwrap.Wrapf("error fetching PKCS #7 signature from EC2 metadata service: {{err}}", err)
+		}
+
+		nonce, err := a.getNonce()
+		if err != nil {
+			return "", nil, err
+		}
+
+		data = map[string]interface{}{
+			"pkcs7": strings.Replace(strings.TrimSpace(pkcs7), "\n", "", -1),
+			"nonce": nonce,
+		}
+
+	case typeIAM:
+		var err error
+		data, err = awsauth.GenerateLoginData(a.accessKey, a.secretKey, a.sessionToken, a.headerValue)
+		if err != nil {
+			return "", nil, errwrap.Wrapf("error creating login data: {{err}}", err)
+		}
+	}
+
+	data["role"] = a.role
+
+	return fmt.Sprintf("%s/login", a.mountPath), data, nil
+}
+
+// getNonce returns the configured nonce, generating one the first time if
+// none was configured
+func (a *awsMethod) getNonce() (string, error) {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	if a.nonce == "" {
+		nonce, err := uuid.GenerateUUID()
+		if err != nil {
+			return "", errwrap.Wrapf("error generating nonce: {{err}}", err)
+		}
+		a.nonce = nonce
+	}
+
+	return a.nonce, nil
+}
+
+func (a *awsMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (a *awsMethod) CredSuccess() {
+}
+
+func (a *awsMethod) Shutdown() {
+}
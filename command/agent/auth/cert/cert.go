@@ -0,0 +1,124 @@
+package cert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/auth"
+)
+
+type certMethod struct {
+	logger    hclog.Logger
+	mountPath string
+	name      string
+
+	caCert     string
+	clientCert string
+	clientKey  string
+
+	// client is the client built from the TLS configuration above, if any
+	l      sync.Mutex
+	client *api.Client
+}
+
+// NewCertAuthMethod returns an auth method that logs in to the cert backend.
+// Unless a client certificate and key are configured for the method, the
+// certificate configured for the agent's connection to Vault is used.
+func NewCertAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
+	if conf == nil {
+		return nil, errors.New("empty config")
+	}
+
+	c := &certMethod{
+		logger:    conf.Logger,
+		mountPath: conf.MountPath,
+	}
+
+	for k, target := range map[string]*string{
+		"name":        &c.name,
+		"ca_cert":     &c.caCert,
+		"client_cert": &c.clientCert,
+		"client_key":  &c.clientKey,
+	} {
+		raw, ok := conf.Config[k]
+		if !ok {
+			continue
+		}
+		v, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("could not convert '%s' config value to string", k)
+		}
+		*target = v
+	}
+
+	if (c.clientCert == "") != (c.clientKey == "") {
+		return nil, errors.New("'client_cert' and 'client_key' must be specified together")
+	}
+
+	return c, nil
+}
+
+func (c *certMethod) Authenticate(ctx context.Context, client *api.Client) (string, map[string]interface{}, error) {
+	c.logger.Trace("beginning authentication")
+
+	data := map[string]interface{}{}
+	if c.name != "" {
+		data["name"] = c.name
+	}
+
+	return fmt.Sprintf("%s/login", c.mountPath), data, nil
+}
+
+// AuthClient returns a client presenting the configured certificate, or the
+// given client if no certificate is configured for the method
+func (c *certMethod) AuthClient(client *api.Client) (*api.Client, error) {
+	if c.clientCert == "" && c.caCert == "" {
+		return client, nil
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+	config.Address = client.Address()
+
+	if err := config.ConfigureTLS(&api.TLSConfig{
+		CACert:     c.caCert,
+		ClientCert: c.clientCert,
+		ClientKey:  c.clientKey,
+	}); err != nil {
+		return nil, errwrap.Wrapf("error configuring TLS for cert authentication: {{err}}", err)
+	}
+
+	newClient, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	// Never send along a token with the login request
+	newClient.ClearToken()
+
+	c.client = newClient
+	return c.client, nil
+}
+
+func (c *certMethod) NewCreds() chan struct{} {
+	return nil
+}
+
+func (c *certMethod) CredSuccess() {
+}
+
+func (c *certMethod) Shutdown() {
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+)
+
+// proxiedHeaders are the request headers that are passed along to Vault.
+// Tokens and wrapping TTLs are handled separately by the api package.
+var proxiedHeaders = []string{
+	"X-Vault-MFA",
+	"X-Vault-Policy-Override",
+	"X-Vault-Wrap-Format",
+	"X-Vault-No-Request-Forwarding",
+	"X-Vault-Namespace",
+}
+
+// APIProxy is an implementation of the proxier interface that is used to
+// forward the request to Vault and get the response.
+type APIProxy struct {
+	client *api.Client
+	logger hclog.Logger
+}
+
+// APIProxyConfig is the configuration for an APIProxy
+type APIProxyConfig struct {
+	Client *api.Client
+	Logger hclog.Logger
+}
+
+// NewAPIProxy returns a proxier that sends requests to Vault using the given
+// client
+func NewAPIProxy(config *APIProxyConfig) (Proxier, error) {
+	if config.Client == nil {
+		return nil, errors.New("nil API client")
+	}
+	return &APIProxy{
+		client: config.Client,
+		logger: config.Logger,
+	}, nil
+}
+
+// Send forwards the request to Vault. Error responses from Vault are
+// returned as responses rather than errors so that they reach the caller
+// unmodified.
+func (ap *APIProxy) Send(ctx context.Context, req *SendRequest) (*SendResponse, error) {
+	client, err := ap.client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(req.Token)
+	client.SetWrappingLookupFunc(func(string, string) string {
+		return req.Request.Header.Get("X-Vault-Wrap-TTL")
+	})
+
+	fwReq := client.NewRequest(req.Request.Method, req.Request.URL.Path)
+	fwReq.Params = req.Request.URL.Query()
+
+	// Copy the client's headers rather than modifying them in place
+	headers := make(http.Header, len(fwReq.Headers))
+	for k, v := range fwReq.Headers {
+		headers[k] = v
+	}
+	for _, header := range proxiedHeaders {
+		if v, ok := req.Request.Header[http.CanonicalHeaderKey(header)]; ok {
+			headers[header] = v
+		}
+	}
+	fwReq.Headers = headers
+
+	if len(req.RequestBody) > 0 {
+		// Keep the body as the request object as well so that it survives
+		// being reset when a standby redirects the request
+		fwReq.Obj = json.RawMessage(req.RequestBody)
+		fwReq.BodyBytes = req.RequestBody
+	}
+
+	// Make the request to Vault and get the response
+	ap.logger.Debug("forwarding request", "path", req.Request.URL.Path, "method", req.Request.Method)
+	resp, err := client.RawRequest(fwReq)
+	if resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SendResponse{
+		Response:     resp,
+		ResponseBody: body,
+	}, nil
+}
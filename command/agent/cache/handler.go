@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/sink/inmem"
+)
+
+const (
+	// authHeaderName is the name of the header containing the token
+	authHeaderName = "X-Vault-Token"
+)
+
+// Handler returns an http.Handler that sends every request through the
+// proxier. If an in-memory sink is given, requests that carry no token are
+// sent with the latest auto-auth token.
+func Handler(ctx context.Context, logger hclog.Logger, proxier Proxier, inmemSink *inmem.InmemSink) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Info("received request", "path", r.URL.Path, "method", r.Method)
+
+		token := r.Header.Get(authHeaderName)
+		if token == "" && inmemSink != nil {
+			logger.Debug("using auto auth token", "path", r.URL.Path, "method", r.Method)
+			token = inmemSink.Token()
+		}
+
+		// Parse and reset body.
+		reqBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("failed to read request body")
+			respondError(w, http.StatusInternalServerError, errwrap.Wrapf("failed to read request body: {{err}}", err))
+			return
+		}
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+
+		req := &SendRequest{
+			Token:       token,
+			Request:     r,
+			RequestBody: reqBody,
+		}
+
+		resp, err := proxier.Send(ctx, req)
+		if err != nil {
+			respondError(w, http.StatusBadGateway, errwrap.Wrapf("failed to get the response: {{err}}", err))
+			return
+		}
+
+		copyHeader(w.Header(), resp.Response.Header)
+		w.WriteHeader(resp.Response.StatusCode)
+		w.Write(resp.ResponseBody)
+	})
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// errorResponse matches the format of the errors returned by Vault
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	resp := &errorResponse{Errors: make([]string, 0, 1)}
+	if err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+
+	enc := json.NewEncoder(w)
+	enc.Encode(resp)
+}
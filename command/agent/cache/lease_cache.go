@@ -0,0 +1,445 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
+)
+
+// cachedResponse is a response served from the cache in place of Vault's
+type cachedResponse struct {
+	// key identifies the request the response was returned for
+	key string
+
+	// token is the token the request was made with
+	token string
+
+	// leaseID is the lease of the returned secret, if any
+	leaseID string
+
+	// path is the request path, which prefixes the leases of tokens
+	// returned by logins
+	path string
+
+	// createdToken and createdAccessor identify the token returned in the
+	// response's auth block, if any
+	createdToken    string
+	createdAccessor string
+
+	statusCode int
+	header     http.Header
+	body       []byte
+
+	// cancel stops the renewal of the lease or token
+	cancel context.CancelFunc
+}
+
+// LeaseCache is an implementation of Proxier that caches responses which
+// contain a lease or a newly created token, keeping them renewed for as long
+// as possible. Cached responses are evicted when renewal stops or when the
+// lease or token is revoked through the cache.
+type LeaseCache struct {
+	proxier Proxier
+	client  *api.Client
+	logger  hclog.Logger
+	baseCtx context.Context
+
+	l       sync.RWMutex
+	entries map[string]*cachedResponse
+}
+
+// LeaseCacheConfig is the configuration for a LeaseCache
+type LeaseCacheConfig struct {
+	// BaseContext bounds the lifetime of the renewals started by the cache
+	BaseContext context.Context
+
+	// Client is used to renew cached leases and tokens
+	Client *api.Client
+
+	// Proxier is where requests that cannot be served from the cache are
+	// sent
+	Proxier Proxier
+
+	Logger hclog.Logger
+}
+
+// NewLeaseCache returns a new LeaseCache
+func NewLeaseCache(conf *LeaseCacheConfig) (*LeaseCache, error) {
+	if conf == nil {
+		return nil, errors.New("nil configuration provided")
+	}
+	if conf.Proxier == nil || conf.Logger == nil {
+		return nil, errors.New("missing configuration required params")
+	}
+	if conf.Client == nil {
+		return nil, errors.New("nil API client")
+	}
+
+	baseCtx := conf.BaseContext
+	if baseCtx == nil {
+		baseCtx = context.Background()
+	}
+
+	return &LeaseCache{
+		proxier: conf.Proxier,
+		client:  conf.Client,
+		logger:  conf.Logger,
+		baseCtx: baseCtx,
+		entries: make(map[string]*cachedResponse),
+	}, nil
+}
+
+// Send serves the request from the cache if an identical request made with
+// the same token is cached. Otherwise the request is forwarded and, if the
+// response contains a lease or a new token, cached.
+func (c *LeaseCache) Send(ctx context.Context, req *SendRequest) (*SendResponse, error) {
+	key := computeCacheKey(req)
+
+	c.l.RLock()
+	entry, ok := c.entries[key]
+	c.l.RUnlock()
+	if ok {
+		c.logger.Debug("returning cached response", "path", req.Request.URL.Path)
+		return entry.sendResponse(), nil
+	}
+
+	resp, err := c.proxier.Send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only successful responses are of interest
+	if resp.Response.StatusCode < 200 || resp.Response.StatusCode >= 300 {
+		return resp, nil
+	}
+
+	if err := c.handleRevocationRequest(req); err != nil {
+		c.logger.Error("failed to evict revoked entries from the cache", "error", err)
+	}
+
+	secret, err := api.ParseSecret(bytes.NewReader(resp.ResponseBody))
+	if err != nil || secret == nil {
+		// Not a secret, so nothing to cache
+		return resp, nil
+	}
+
+	entry = &cachedResponse{
+		key:        key,
+		token:      req.Token,
+		path:       strings.TrimPrefix(req.Request.URL.Path, "/v1/"),
+		statusCode: resp.Response.StatusCode,
+		header:     resp.Response.Header,
+		body:       resp.ResponseBody,
+	}
+
+	switch {
+	case secret.WrapInfo != nil:
+		// Wrapping tokens can only be used once, so caching them would break
+		// every caller after the first
+		return resp, nil
+
+	case secret.LeaseID != "":
+		entry.leaseID = secret.LeaseID
+
+	case secret.Auth != nil && secret.Auth.ClientToken != "":
+		entry.createdToken = secret.Auth.ClientToken
+		entry.createdAccessor = secret.Auth.Accessor
+
+	default:
+		return resp, nil
+	}
+
+	renewCtx, cancel := context.WithCancel(c.baseCtx)
+	entry.cancel = cancel
+
+	c.l.Lock()
+	if existing, ok := c.entries[key]; ok {
+		// A concurrent request beat us to it
+		existing.cancel()
+	}
+	c.entries[key] = entry
+	c.l.Unlock()
+
+	c.logger.Debug("cached response", "path", req.Request.URL.Path, "lease_id", entry.leaseID)
+
+	go c.startRenewing(renewCtx, entry, secret)
+
+	return resp, nil
+}
+
+// startRenewing renews the entry's lease or token until it can no longer be
+// renewed or the entry is evicted, at which point the entry is evicted
+func (c *LeaseCache) startRenewing(ctx context.Context, entry *cachedResponse, secret *api.Secret) {
+	defer c.evict(entry)
+
+	renewable, ttl := secret.Renewable, secret.LeaseDuration
+	if secret.Auth != nil {
+		renewable, ttl = secret.Auth.Renewable, secret.Auth.LeaseDuration
+	}
+
+	// Secrets that cannot be renewed stay cached until they expire
+	if !renewable {
+		var expiry <-chan time.Time
+		if ttl > 0 {
+			expiry = time.After(time.Duration(ttl) * time.Second)
+		}
+		select {
+		case <-ctx.Done():
+		case <-expiry:
+		}
+		return
+	}
+
+	client, err := c.client.Clone()
+	if err != nil {
+		c.logger.Error("failed to create API client in the renewer", "error", err)
+		return
+	}
+	if entry.createdToken != "" {
+		client.SetToken(entry.createdToken)
+	} else {
+		client.SetToken(entry.token)
+	}
+
+	renewer, err := client.NewRenewer(&api.RenewerInput{
+		Secret: secret,
+	})
+	if err != nil {
+		c.logger.Error("failed to create renewer", "error", err)
+		return
+	}
+	go renewer.Renew()
+	defer renewer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-renewer.DoneCh():
+			if err != nil {
+				c.logger.Debug("renewal halted, evicting from cache", "path", entry.path, "error", err)
+			}
+			return
+		case <-renewer.RenewCh():
+			c.logger.Trace("renewed cached secret", "path", entry.path)
+		}
+	}
+}
+
+// evict removes the entry from the cache and stops its renewal
+func (c *LeaseCache) evict(entry *cachedResponse) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.evictLocked(entry)
+}
+
+func (c *LeaseCache) evictLocked(entry *cachedResponse) {
+	if c.entries[entry.key] == entry {
+		delete(c.entries, entry.key)
+	}
+	entry.cancel()
+}
+
+// evictMatching evicts all entries for which match returns true
+func (c *LeaseCache) evictMatching(match func(*cachedResponse) bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	for _, entry := range c.entries {
+		if match(entry) {
+			c.evictLocked(entry)
+		}
+	}
+}
+
+// evictToken evicts the cached responses that created the token, along with
+// everything obtained using it. If orphan is false, the same is done for the
+// tokens it created, as Vault revokes them along with it.
+func (c *LeaseCache) evictToken(token string, orphan bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	revoked := map[string]bool{token: true}
+	for pending := []string{token}; len(pending) > 0; pending = pending[1:] {
+		for _, entry := range c.entries {
+			if entry.token != pending[0] {
+				continue
+			}
+			if entry.createdToken != "" && !orphan && !revoked[entry.createdToken] {
+				revoked[entry.createdToken] = true
+				pending = append(pending, entry.createdToken)
+			}
+			c.evictLocked(entry)
+		}
+	}
+
+	for _, entry := range c.entries {
+		if entry.createdToken != "" && revoked[entry.createdToken] {
+			c.evictLocked(entry)
+		}
+	}
+}
+
+// handleRevocationRequest evicts the entries revoked by the given request,
+// which has already been successfully processed by Vault
+func (c *LeaseCache) handleRevocationRequest(req *SendRequest) error {
+	if req.Request.Method != "PUT" && req.Request.Method != "POST" {
+		return nil
+	}
+
+	path := strings.TrimPrefix(req.Request.URL.Path, "/v1/")
+
+	// getBodyField returns the named string field of the request body
+	getBodyField := func(name string) (string, error) {
+		var body map[string]interface{}
+		if err := jsonutil.DecodeJSON(req.RequestBody, &body); err != nil {
+			return "", err
+		}
+		v, _ := body[name].(string)
+		return v, nil
+	}
+
+	switch {
+	case path == "auth/token/revoke" || path == "auth/token/revoke-orphan":
+		token, err := getBodyField("token")
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			c.evictToken(token, path == "auth/token/revoke-orphan")
+		}
+
+	case path == "auth/token/revoke-self":
+		c.evictToken(req.Token, false)
+
+	case path == "auth/token/revoke-accessor":
+		accessor, err := getBodyField("accessor")
+		if err != nil {
+			return err
+		}
+		if accessor == "" {
+			return nil
+		}
+		var token string
+		c.l.RLock()
+		for _, entry := range c.entries {
+			if entry.createdAccessor == accessor {
+				token = entry.createdToken
+				break
+			}
+		}
+		c.l.RUnlock()
+		if token != "" {
+			c.evictToken(token, false)
+		}
+
+	case path == "sys/leases/revoke" || path == "sys/revoke":
+		leaseID, err := getBodyField("lease_id")
+		if err != nil {
+			return err
+		}
+		if leaseID != "" {
+			c.evictLease(leaseID)
+		}
+
+	case strings.HasPrefix(path, "sys/leases/revoke/"):
+		c.evictLease(strings.TrimPrefix(path, "sys/leases/revoke/"))
+
+	case strings.HasPrefix(path, "sys/revoke/"):
+		c.evictLease(strings.TrimPrefix(path, "sys/revoke/"))
+
+	case strings.HasPrefix(path, "sys/leases/revoke-prefix/"):
+		c.evictPrefix(strings.TrimPrefix(path, "sys/leases/revoke-prefix/"))
+
+	case strings.HasPrefix(path, "sys/revoke-prefix/"):
+		c.evictPrefix(strings.TrimPrefix(path, "sys/revoke-prefix/"))
+
+	case strings.HasPrefix(path, "sys/leases/revoke-force/"):
+		c.evictPrefix(strings.TrimPrefix(path, "sys/leases/revoke-force/"))
+
+	case strings.HasPrefix(path, "sys/revoke-force/"):
+		c.evictPrefix(strings.TrimPrefix(path, "sys/revoke-force/"))
+	}
+
+	return nil
+}
+
+// evictLease evicts the entry holding the given lease
+func (c *LeaseCache) evictLease(leaseID string) {
+	c.evictMatching(func(entry *cachedResponse) bool {
+		return entry.leaseID == leaseID
+	})
+}
+
+// evictPrefix evicts the entries whose leases fall under the given prefix.
+// The leases of tokens returned by logins are prefixed by the login path.
+func (c *LeaseCache) evictPrefix(prefix string) {
+	var tokens []string
+
+	c.evictMatching(func(entry *cachedResponse) bool {
+		if entry.leaseID != "" {
+			return strings.HasPrefix(entry.leaseID, prefix)
+		}
+		if entry.createdToken != "" && strings.HasPrefix(entry.path, prefix) {
+			tokens = append(tokens, entry.createdToken)
+			return true
+		}
+		return false
+	})
+
+	for _, token := range tokens {
+		c.evictToken(token, false)
+	}
+}
+
+// sendResponse returns a copy of the cached response
+func (e *cachedResponse) sendResponse() *SendResponse {
+	header := make(http.Header, len(e.header))
+	for k, v := range e.header {
+		header[k] = v
+	}
+
+	return &SendResponse{
+		Response: &api.Response{
+			Response: &http.Response{
+				StatusCode: e.statusCode,
+				Header:     header,
+				Body:       ioutil.NopCloser(bytes.NewReader(e.body)),
+			},
+		},
+		ResponseBody: e.body,
+	}
+}
+
+// computeCacheKey returns a key identifying the request. Requests are only
+// served from the cache when made with the same token, so the token is part
+// of the key. So is the namespace, since the same path in two namespaces is
+// two different requests.
+func computeCacheKey(req *SendRequest) string {
+	h := sha256.New()
+	h.Write([]byte(req.Request.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(namespace.Canonicalize(req.Request.Header.Get("X-Vault-Namespace"))))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Request.URL.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Request.URL.RawQuery))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Token))
+	h.Write([]byte{0})
+	h.Write(req.RequestBody)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/logging"
+)
+
+// mockProxier returns a new lease or token for every request it receives
+type mockProxier struct {
+	l     sync.Mutex
+	count int
+}
+
+func (p *mockProxier) Send(ctx context.Context, req *SendRequest) (*SendResponse, error) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	p.count++
+
+	path := strings.TrimPrefix(req.Request.URL.Path, "/v1/")
+	var body string
+	switch {
+	case strings.HasPrefix(path, "auth/token/create"):
+		body = fmt.Sprintf(`{"auth": {"client_token": "token%d", "accessor": "accessor%d", "lease_duration": 600, "renewable": false}}`, p.count, p.count)
+	case strings.HasPrefix(path, "secret/"):
+		body = fmt.Sprintf(`{"lease_id": "%s/lease%d", "lease_duration": 600, "renewable": false, "data": {"count": %d}}`, path, p.count, p.count)
+	case strings.HasPrefix(path, "plain/"):
+		body = fmt.Sprintf(`{"data": {"count": %d}}`, p.count)
+	default:
+		return &SendResponse{
+			Response: &api.Response{Response: &http.Response{StatusCode: http.StatusNoContent}},
+		}, nil
+	}
+
+	return &SendResponse{
+		Response:     &api.Response{Response: &http.Response{StatusCode: http.StatusOK}},
+		ResponseBody: []byte(body),
+	}, nil
+}
+
+func testLeaseCache(t *testing.T) *LeaseCache {
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lc, err := NewLeaseCache(&LeaseCacheConfig{
+		Client:  client,
+		Proxier: &mockProxier{},
+		Logger:  logging.NewVaultLogger(hclog.Trace),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lc
+}
+
+// resetLeaseCache empties the cache and restarts the proxier's count
+func resetLeaseCache(lc *LeaseCache) {
+	lc.l.Lock()
+	defer lc.l.Unlock()
+
+	for _, entry := range lc.entries {
+		entry.cancel()
+	}
+	lc.entries = make(map[string]*cachedResponse)
+	lc.proxier = &mockProxier{}
+}
+
+func entryCount(lc *LeaseCache) int {
+	lc.l.RLock()
+	defer lc.l.RUnlock()
+
+	return len(lc.entries)
+}
+
+func testSend(t *testing.T, lc *LeaseCache, token, method, path, body string) string {
+	return testSendNamespace(t, lc, token, "", method, path, body)
+}
+
+func testSendNamespace(t *testing.T, lc *LeaseCache, token, ns, method, path, body string) string {
+	req := &SendRequest{
+		Token:       token,
+		Request:     httptest.NewRequest(method, "/v1/"+path, strings.NewReader(body)),
+		RequestBody: []byte(body),
+	}
+	if ns != "" {
+		req.Request.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := lc.Send(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(resp.ResponseBody)
+}
+
+func TestLeaseCache_Caching(t *testing.T) {
+	lc := testLeaseCache(t)
+
+	// Leased responses are cached per token
+	first := testSend(t, lc, "root", "GET", "secret/foo", "")
+	if second := testSend(t, lc, "root", "GET", "secret/foo", ""); first != second {
+		t.Fatalf("expected cached response, got %q and %q", first, second)
+	}
+	if other := testSend(t, lc, "other", "GET", "secret/foo", ""); first == other {
+		t.Fatal("expected response for a different token not to be cached")
+	}
+
+	// ...and per namespace
+	nsFirst := testSendNamespace(t, lc, "root", "ns1", "GET", "secret/foo", "")
+	if nsFirst == first {
+		t.Fatal("expected response for a different namespace not to be cached")
+	}
+	if second := testSendNamespace(t, lc, "root", "/ns1/", "GET", "secret/foo", ""); nsFirst != second {
+		t.Fatalf("expected cached response, got %q and %q", nsFirst, second)
+	}
+
+	// Responses without a lease are never cached
+	first = testSend(t, lc, "root", "GET", "plain/foo", "")
+	if second := testSend(t, lc, "root", "GET", "plain/foo", ""); first == second {
+		t.Fatal("expected response without a lease not to be cached")
+	}
+
+	// Tokens are cached per request body
+	first = testSend(t, lc, "root", "PUT", "auth/token/create", `{"policies": ["a"]}`)
+	if second := testSend(t, lc, "root", "PUT", "auth/token/create", `{"policies": ["a"]}`); first != second {
+		t.Fatalf("expected cached response, got %q and %q", first, second)
+	}
+	if other := testSend(t, lc, "root", "PUT", "auth/token/create", `{"policies": ["b"]}`); first == other {
+		t.Fatal("expected response for a different body not to be cached")
+	}
+}
+
+func TestLeaseCache_EvictLease(t *testing.T) {
+	lc := testLeaseCache(t)
+
+	cases := []struct {
+		path string
+		body string
+	}{
+		{"sys/leases/revoke", `{"lease_id": "secret/foo/lease1"}`},
+		{"sys/leases/revoke/secret/foo/lease1", ""},
+		{"sys/revoke/secret/foo/lease1", ""},
+		{"sys/leases/revoke-prefix/secret/", ""},
+		{"sys/leases/revoke-force/secret/foo", ""},
+	}
+
+	for _, tc := range cases {
+		resetLeaseCache(lc)
+
+		first := testSend(t, lc, "root", "GET", "secret/foo", "")
+		if !strings.Contains(first, "secret/foo/lease1") {
+			t.Fatalf("bad: %s", first)
+		}
+		testSend(t, lc, "root", "PUT", tc.path, tc.body)
+		if second := testSend(t, lc, "root", "GET", "secret/foo", ""); first == second {
+			t.Fatalf("%s: expected lease to be evicted", tc.path)
+		}
+	}
+}
+
+func TestLeaseCache_EvictToken(t *testing.T) {
+	lc := testLeaseCache(t)
+
+	// token1 is created by root, token2 by token1 and the secret is read
+	// using token2
+	parent := testSend(t, lc, "root", "PUT", "auth/token/create", "")
+	if !strings.Contains(parent, "token1") {
+		t.Fatalf("bad: %s", parent)
+	}
+	child := testSend(t, lc, "token1", "PUT", "auth/token/create", "")
+	if !strings.Contains(child, "token2") {
+		t.Fatalf("bad: %s", child)
+	}
+	secret := testSend(t, lc, "token2", "GET", "secret/foo", "")
+
+	// Revoking the parent evicts the parent, the child and the secret
+	testSend(t, lc, "root", "PUT", "auth/token/revoke-accessor", `{"accessor": "accessor1"}`)
+
+	if entryCount(lc) != 0 {
+		t.Fatalf("expected all entries to be evicted, %d remain", entryCount(lc))
+	}
+	if resp := testSend(t, lc, "token2", "GET", "secret/foo", ""); resp == secret {
+		t.Fatal("expected secret to be evicted")
+	}
+
+	// Revoking an orphan only evicts what was obtained directly with it
+	resetLeaseCache(lc)
+	testSend(t, lc, "root", "PUT", "auth/token/create", "")
+	testSend(t, lc, "token1", "PUT", "auth/token/create", "")
+	testSend(t, lc, "token2", "GET", "secret/foo", "")
+	testSend(t, lc, "root", "PUT", "auth/token/revoke-orphan", `{"token": "token1"}`)
+	if entryCount(lc) != 1 {
+		t.Fatalf("expected only the secret read with the child token to remain, %d remain", entryCount(lc))
+	}
+
+	// revoke-self revokes the request token
+	testSend(t, lc, "token2", "PUT", "auth/token/revoke-self", "")
+	if entryCount(lc) != 0 {
+		t.Fatalf("expected all entries to be evicted, %d remain", entryCount(lc))
+	}
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/cache"
+	"github.com/hashicorp/vault/command/agent/sink/inmem"
+	"github.com/hashicorp/vault/helper/logging"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestCache_EndToEnd(t *testing.T) {
+	logger := logging.NewVaultLogger(hclog.Trace)
+	coreConfig := &vault.CoreConfig{
+		DisableMlock: true,
+		DisableCache: true,
+		Logger:       logger,
+	}
+
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+	client := cluster.Cores[0].Client
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	agentClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentClient.ClearToken()
+
+	apiProxy, err := cache.NewAPIProxy(&cache.APIProxyConfig{
+		Client: agentClient,
+		Logger: logger.Named("cache.apiproxy"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaseCache, err := cache.NewLeaseCache(&cache.LeaseCacheConfig{
+		BaseContext: ctx,
+		Client:      agentClient,
+		Proxier:     apiProxy,
+		Logger:      logger.Named("cache.leasecache"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stand in for the auto-auth token with the root token
+	inmemSink := inmem.New()
+	if err := inmemSink.WriteToken(client.Token()); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	server := &http.Server{
+		Handler: cache.Handler(ctx, logger.Named("cache.handler"), leaseCache, inmemSink),
+	}
+	go server.Serve(ln)
+
+	config := api.DefaultConfig()
+	config.Address = "http://" + ln.Addr().String()
+	proxyClient, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyClient.ClearToken()
+
+	// Requests without a token use the auto-auth token
+	secret, err := proxyClient.Auth().Token().LookupSelf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Data["id"] != client.Token() {
+		t.Fatalf("expected the auto-auth token to be used, got %#v", secret.Data)
+	}
+
+	createToken := func() *api.Secret {
+		secret, err := proxyClient.Auth().Token().Create(&api.TokenCreateRequest{
+			Policies: []string{"default"},
+			TTL:      "10m",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+
+	first := createToken()
+	second := createToken()
+	if first.Auth.ClientToken != second.Auth.ClientToken {
+		t.Fatal("expected the token creation to be served from the cache")
+	}
+
+	// Errors are passed through untouched
+	_, err = proxyClient.Logical().Write("auth/token/lookup", map[string]interface{}{
+		"token": "nonexistent",
+	})
+	if err == nil {
+		t.Fatal("expected error looking up nonexistent token")
+	}
+
+	// Revoking the token through the proxy evicts it
+	if err := proxyClient.Auth().Token().RevokeTree(first.Auth.ClientToken); err != nil {
+		t.Fatal(err)
+	}
+	third := createToken()
+	if third.Auth.ClientToken == first.Auth.ClientToken {
+		t.Fatal("expected the revoked token to be evicted from the cache")
+	}
+
+	// The new token is usable
+	tokenClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenClient.SetToken(third.Auth.ClientToken)
+	if _, err := tokenClient.Auth().Token().LookupSelf(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/logging"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Trace)
+
+	os.Setenv("TEST_AAD_ENV", "aad")
+	defer os.Unsetenv("TEST_AAD_ENV")
+
+	config, err := LoadConfig("./test-fixtures/config.hcl", logger)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Config{
+		AutoAuth: &AutoAuth{
+			Method: &Method{
+				Type:      "aws",
+				MountPath: "auth/aws",
+				Config: map[string]interface{}{
+					"type": "iam",
+					"role": "foobar",
+				},
+			},
+			Sinks: []*Sink{
+				&Sink{
+					Type:    "file",
+					WrapTTL: 300 * time.Second,
+					DHType:  "curve25519",
+					DHPath:  "/tmp/file-foo-dhpath",
+					AAD:     "foobar",
+					Config: map[string]interface{}{
+						"path": "/tmp/file-foo",
+					},
+				},
+				&Sink{
+					Type:    "file",
+					WrapTTL: 5 * time.Minute,
+					DHType:  "curve25519",
+					DHPath:  "/tmp/file-foo-dhpath2",
+					AAD:     "aad",
+					Config: map[string]interface{}{
+						"path": "/tmp/file-bar",
+					},
+				},
+			},
+		},
+		PidFile:   "./pidfile",
+		Listeners: []*Listener{},
+	}
+
+	if diff := deep.Equal(config, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestLoadConfigFile_Cache(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Trace)
+
+	config, err := LoadConfig("./test-fixtures/config-cache.hcl", logger)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Config{
+		AutoAuth: &AutoAuth{
+			Method: &Method{
+				Type:      "approle",
+				MountPath: "auth/approle-custom",
+				Config: map[string]interface{}{
+					"role_id_file_path":   "/tmp/role-id",
+					"secret_id_file_path": "/tmp/secret-id",
+				},
+			},
+		},
+		Cache: &Cache{
+			UseAutoAuthToken:    true,
+			UseAutoAuthTokenRaw: true,
+		},
+		Listeners: []*Listener{
+			&Listener{
+				Type: "tcp",
+				Config: map[string]interface{}{
+					"address":     "127.0.0.1:8300",
+					"tls_disable": true,
+				},
+			},
+		},
+		Vault: &Vault{
+			Address:          "http://127.0.0.1:8200",
+			TLSSkipVerify:    true,
+			TLSSkipVerifyRaw: "true",
+		},
+		PidFile: "./pidfile",
+	}
+
+	if diff := deep.Equal(config, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	cases := map[string]struct {
+		config string
+		err    string
+	}{
+		"no auto_auth or cache": {
+			`pid_file = "foo"`,
+			"no auto_auth or cache block found",
+		},
+		"no sinks": {
+			`auto_auth { method "approle" {} }`,
+			"at least one 'sink' block must be provided",
+		},
+		"no method": {
+			`auto_auth { sink "file" {} }`,
+			"one and only one \"method\" block is required",
+		},
+		"cache without listener": {
+			`cache {}`,
+			"at least one listener must be defined",
+		},
+		"auto auth token without auto_auth": {
+			`
+cache { use_auto_auth_token = true }
+listener "tcp" { address = "127.0.0.1:8300" }`,
+			"auto_auth is not configured",
+		},
+		"aad without dh": {
+			`auto_auth {
+	method "approle" {}
+	sink "file" { aad = "foo" }
+}`,
+			"specifying AAD data without 'dh_type' does not make sense",
+		},
+		"dh type without path": {
+			`auto_auth {
+	method "approle" {}
+	sink "file" { dh_type = "curve25519" }
+}`,
+			"'dh_type' and 'dh_path' must be specified together",
+		},
+		"wrap ttl on method and sink": {
+			`auto_auth {
+	method "approle" { wrap_ttl = "5m" }
+	sink "file" { wrap_ttl = "5m" }
+}`,
+			"'wrap_ttl' cannot be set on both the method and a sink",
+		},
+		"bad listener type": {
+			`
+cache {}
+listener "unix" { address = "/tmp/agent.sock" }`,
+			"invalid listener type",
+		},
+		"unknown key": {
+			`
+foo = "bar"
+cache {}`,
+			"invalid key \"foo\"",
+		},
+	}
+
+	for name, tc := range cases {
+		_, err := ParseConfig(tc.config, logging.NewVaultLogger(log.Trace))
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+		if !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: expected error containing %q, got %q", name, tc.err, err)
+		}
+	}
+}
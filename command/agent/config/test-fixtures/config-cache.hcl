@@ -0,0 +1,25 @@
+pid_file = "./pidfile"
+
+vault {
+	address = "http://127.0.0.1:8200"
+	tls_skip_verify = "true"
+}
+
+auto_auth {
+	method "approle" {
+		mount_path = "auth/approle-custom/"
+		config = {
+			role_id_file_path = "/tmp/role-id"
+			secret_id_file_path = "/tmp/secret-id"
+		}
+	}
+}
+
+cache {
+	use_auto_auth_token = true
+}
+
+listener "tcp" {
+	address = "127.0.0.1:8300"
+	tls_disable = true
+}
@@ -0,0 +1,32 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			type = "iam"
+			role = "foobar"
+		}
+	}
+
+	sink {
+		type = "file"
+		wrap_ttl = 300
+		config = {
+			path = "/tmp/file-foo"
+		}
+		aad = "foobar"
+		dh_type = "curve25519"
+		dh_path = "/tmp/file-foo-dhpath"
+	}
+
+	sink "file" {
+		wrap_ttl = "5m"
+		aad_env_var = "TEST_AAD_ENV"
+		dh_type = "curve25519"
+		dh_path = "/tmp/file-foo-dhpath2"
+		config = {
+			path = "/tmp/file-bar"
+		}
+	}
+}
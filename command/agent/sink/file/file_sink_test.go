@@ -0,0 +1,99 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/agent/sink"
+	"github.com/hashicorp/vault/helper/logging"
+)
+
+func testFileSink(t *testing.T, config map[string]interface{}) (sink.Sink, string) {
+	tmpDir, err := ioutil.TempDir("", "vault-sink-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tmpDir, "token")
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	config["path"] = path
+
+	// Leave a stale token behind to ensure it's removed
+	if err := ioutil.WriteFile(path, []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewFileSink(&sink.SinkConfig{
+		Logger: logging.NewVaultLogger(hclog.Trace),
+		Config: config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected stale token file to be removed, got: %v", err)
+	}
+
+	return fs, tmpDir
+}
+
+func TestFileSink(t *testing.T) {
+	fs, tmpDir := testFileSink(t, nil)
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "token")
+
+	for _, token := range []string{"token1", "token2"} {
+		if err := fs.WriteToken(token); err != nil {
+			t.Fatal(err)
+		}
+
+		fileBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(fileBytes) != token {
+			t.Fatalf("expected %q, got %q", token, fileBytes)
+		}
+	}
+
+	// Only the token file should remain; temp files are renamed over it
+	infos, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected a single file, got %d", len(infos))
+	}
+	if mode := infos[0].Mode(); mode != 0640 {
+		t.Fatalf("expected mode 0640, got %o", mode)
+	}
+}
+
+func TestFileSink_Mode(t *testing.T) {
+	for _, mode := range []interface{}{0600, "0600"} {
+		fs, tmpDir := testFileSink(t, map[string]interface{}{
+			"mode": mode,
+		})
+
+		if err := fs.WriteToken("token"); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(filepath.Join(tmpDir, "token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != 0600 {
+			t.Fatalf("expected mode 0600 for %#v, got %o", mode, info.Mode())
+		}
+
+		os.RemoveAll(tmpDir)
+	}
+}
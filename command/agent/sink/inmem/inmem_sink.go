@@ -0,0 +1,36 @@
+package inmem
+
+import (
+	"sync/atomic"
+
+	"github.com/hashicorp/vault/command/agent/sink"
+)
+
+// InmemSink is a Sink that keeps the latest token in memory so that other
+// parts of the agent, such as the caching proxy, can use it
+type InmemSink struct {
+	token *atomic.Value
+}
+
+// New returns a new in-memory sink
+func New() *InmemSink {
+	v := new(atomic.Value)
+	v.Store("")
+	return &InmemSink{
+		token: v,
+	}
+}
+
+var _ sink.Sink = (*InmemSink)(nil)
+
+// WriteToken stores the token
+func (s *InmemSink) WriteToken(token string) error {
+	s.token.Store(token)
+	return nil
+}
+
+// Token returns the latest token written to the sink, or an empty string if
+// none has been written yet
+func (s *InmemSink) Token() string {
+	return s.token.Load().(string)
+}
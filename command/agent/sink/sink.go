@@ -0,0 +1,249 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/dhutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+const (
+	// retryBackoff is how long the server waits before retrying sinks that
+	// failed to write the latest token
+	retryBackoff = 2 * time.Second
+)
+
+// Sink is the interface implemented by the destinations tokens are written
+// to
+type Sink interface {
+	WriteToken(string) error
+}
+
+// SinkConfig is the configuration of a sink, along with the processing
+// applied to tokens before they are written to it
+type SinkConfig struct {
+	Sink
+	Logger  hclog.Logger
+	Config  map[string]interface{}
+	Client  *api.Client
+	WrapTTL time.Duration
+	DHType  string
+	DHPath  string
+	AAD     string
+
+	cachedRemotePubKey []byte
+	cachedPubKey       []byte
+	cachedPriKey       []byte
+}
+
+// SinkServer writes each token it receives to all of its sinks
+type SinkServer struct {
+	DoneCh chan struct{}
+
+	logger        hclog.Logger
+	client        *api.Client
+	exitAfterAuth bool
+}
+
+// SinkServerConfig is the configuration for a SinkServer
+type SinkServerConfig struct {
+	Logger        hclog.Logger
+	Client        *api.Client
+	ExitAfterAuth bool
+}
+
+// NewSinkServer returns a new SinkServer
+func NewSinkServer(conf *SinkServerConfig) *SinkServer {
+	ss := &SinkServer{
+		DoneCh:        make(chan struct{}),
+		logger:        conf.Logger,
+		client:        conf.Client,
+		exitAfterAuth: conf.ExitAfterAuth,
+	}
+
+	return ss
+}
+
+// Run writes every token received on incoming to the given sinks until the
+// context is canceled or incoming is closed. Sinks that fail to write a
+// token are retried until they succeed or a newer token arrives. If the
+// server was configured to exit after auth, it returns once the first token
+// has been written to every sink.
+func (ss *SinkServer) Run(ctx context.Context, incoming chan string, sinks []*SinkConfig) {
+	if incoming == nil {
+		panic("incoming channel is nil")
+	}
+
+	ss.logger.Info("starting sink server")
+	defer func() {
+		ss.logger.Info("sink server stopped")
+		close(ss.DoneCh)
+	}()
+
+	var token string
+	pending := make(map[*SinkConfig]struct{}, len(sinks))
+
+	for {
+		var retryCh <-chan time.Time
+		if len(pending) > 0 {
+			retryCh = time.After(retryBackoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case newToken, ok := <-incoming:
+			if !ok {
+				return
+			}
+			if newToken == "" {
+				ss.logger.Error("received empty token")
+				continue
+			}
+			token = newToken
+			for _, sc := range sinks {
+				pending[sc] = struct{}{}
+			}
+
+		case <-retryCh:
+		}
+
+		for sc := range pending {
+			if err := ss.writeSink(sc, token); err != nil {
+				sc.Logger.Error("error writing token to sink, retrying", "error", err)
+				continue
+			}
+			delete(pending, sc)
+		}
+
+		if ss.exitAfterAuth && len(pending) == 0 {
+			ss.logger.Info("tokens written to all sinks, exiting after auth")
+			return
+		}
+	}
+}
+
+// writeSink applies the sink's configured wrapping and encryption to the
+// token and writes the result
+func (ss *SinkServer) writeSink(sc *SinkConfig, token string) error {
+	var err error
+
+	if sc.WrapTTL > 0 {
+		if token, err = sc.wrapToken(ss.client, token); err != nil {
+			return err
+		}
+	}
+
+	if sc.DHType != "" {
+		if token, err = sc.encryptToken(token); err != nil {
+			return err
+		}
+	}
+
+	return sc.WriteToken(token)
+}
+
+// wrapToken response-wraps the token, returning the JSON-encoded wrap info
+func (s *SinkConfig) wrapToken(client *api.Client, token string) (string, error) {
+	wrapClient, err := client.Clone()
+	if err != nil {
+		return "", errwrap.Wrapf("error deriving client for wrapping, not writing out to sink: {{err}}", err)
+	}
+	wrapClient.SetToken(token)
+
+	wrapTTL := s.WrapTTL
+	wrapClient.SetWrappingLookupFunc(func(string, string) string {
+		return wrapTTL.String()
+	})
+
+	secret, err := wrapClient.Logical().Write("sys/wrapping/wrap", map[string]interface{}{
+		"token": token,
+	})
+	if err != nil {
+		return "", errwrap.Wrapf("error wrapping token, not writing out to sink: {{err}}", err)
+	}
+	if secret == nil {
+		return "", errors.New("nil secret returned, not writing out to sink")
+	}
+	if secret.WrapInfo == nil {
+		return "", errors.New("nil wrap info returned, not writing out to sink")
+	}
+
+	m, err := jsonutil.EncodeJSON(secret.WrapInfo)
+	if err != nil {
+		return "", errwrap.Wrapf("error marshaling token, not writing out to sink: {{err}}", err)
+	}
+
+	return string(m), nil
+}
+
+// encryptToken encrypts the token for the holder of the public key found at
+// the sink's DH path, returning the JSON-encoded envelope
+func (s *SinkConfig) encryptToken(token string) (string, error) {
+	fi, err := os.Lstat(s.DHPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", errwrap.Wrapf("error stat-ing dh parameters file: {{err}}", err)
+		}
+		return "", errors.New("no dh parameters file found, and no cached pub key")
+	}
+	if fi.Size() == 0 {
+		return "", errors.New("dh parameters file is empty")
+	}
+
+	fileBytes, err := ioutil.ReadFile(s.DHPath)
+	if err != nil {
+		return "", errwrap.Wrapf("error reading file for dh parameters: {{err}}", err)
+	}
+
+	theirPubKey := new(dhutil.PublicKeyInfo)
+	if err := jsonutil.DecodeJSON(fileBytes, theirPubKey); err != nil {
+		return "", errwrap.Wrapf("error decoding public key: {{err}}", err)
+	}
+	if len(theirPubKey.Curve25519PublicKey) == 0 {
+		return "", errors.New("public key is nil")
+	}
+
+	// Use a new key pair whenever the consumer's public key changes
+	if string(theirPubKey.Curve25519PublicKey) != string(s.cachedRemotePubKey) || s.cachedPubKey == nil {
+		pub, pri, err := dhutil.GeneratePublicPrivateKey()
+		if err != nil {
+			return "", errwrap.Wrapf("error generating pub/pri curve25519 keys: {{err}}", err)
+		}
+		s.cachedRemotePubKey = theirPubKey.Curve25519PublicKey
+		s.cachedPubKey = pub
+		s.cachedPriKey = pri
+	}
+
+	aesKey, err := dhutil.GenerateSharedKey(s.cachedPriKey, s.cachedRemotePubKey)
+	if err != nil {
+		return "", errwrap.Wrapf("error deriving shared key: {{err}}", err)
+	}
+	if len(aesKey) == 0 {
+		return "", errors.New("derived AES key is empty")
+	}
+
+	ciphertext, nonce, err := dhutil.EncryptAES(aesKey, []byte(token), []byte(s.AAD))
+	if err != nil {
+		return "", errwrap.Wrapf("error encrypting with shared key: {{err}}", err)
+	}
+
+	m, err := jsonutil.EncodeJSON(&dhutil.Envelope{
+		Curve25519PublicKey: s.cachedPubKey,
+		Nonce:               nonce,
+		EncryptedPayload:    ciphertext,
+	})
+	if err != nil {
+		return "", errwrap.Wrapf("error encoding envelope: {{err}}", err)
+	}
+
+	return string(m), nil
+}
@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/dhutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/logging"
+)
+
+type testSink struct {
+	l      sync.Mutex
+	tokens []string
+	fail   int
+}
+
+func (s *testSink) WriteToken(token string) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.fail > 0 {
+		s.fail--
+		return os.ErrPermission
+	}
+	s.tokens = append(s.tokens, token)
+	return nil
+}
+
+func (s *testSink) written() []string {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return append([]string(nil), s.tokens...)
+}
+
+func TestSinkServer_ExitAfterAuth(t *testing.T) {
+	logger := logging.NewVaultLogger(hclog.Trace)
+
+	good := &testSink{}
+	// Fails the first write, so it has to be retried
+	flaky := &testSink{fail: 1}
+
+	ss := NewSinkServer(&SinkServerConfig{
+		Logger:        logger,
+		ExitAfterAuth: true,
+	})
+
+	incoming := make(chan string, 1)
+	incoming <- "token"
+
+	go ss.Run(context.Background(), incoming, []*SinkConfig{
+		&SinkConfig{Sink: good, Logger: logger},
+		&SinkConfig{Sink: flaky, Logger: logger},
+	})
+
+	select {
+	case <-ss.DoneCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("sink server did not exit after auth")
+	}
+
+	for _, s := range []*testSink{good, flaky} {
+		tokens := s.written()
+		if len(tokens) != 1 || tokens[0] != "token" {
+			t.Fatalf("bad: %#v", tokens)
+		}
+	}
+}
+
+func TestSinkServer_DHEncryption(t *testing.T) {
+	logger := logging.NewVaultLogger(hclog.Trace)
+
+	tmpDir, err := ioutil.TempDir("", "vault-sink-dh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pub, pri, err := dhutil.GeneratePublicPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubBytes, err := jsonutil.EncodeJSON(&dhutil.PublicKeyInfo{
+		Curve25519PublicKey: pub,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dhPath := filepath.Join(tmpDir, "dh")
+	if err := ioutil.WriteFile(dhPath, pubBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testSink{}
+	ss := NewSinkServer(&SinkServerConfig{
+		Logger:        logger,
+		ExitAfterAuth: true,
+	})
+
+	incoming := make(chan string, 1)
+	incoming <- "token"
+	go ss.Run(context.Background(), incoming, []*SinkConfig{
+		&SinkConfig{
+			Sink:   s,
+			Logger: logger,
+			DHType: "curve25519",
+			DHPath: dhPath,
+			AAD:    "foobar",
+		},
+	})
+	<-ss.DoneCh
+
+	tokens := s.written()
+	if len(tokens) != 1 {
+		t.Fatalf("bad: %#v", tokens)
+	}
+
+	resp := new(dhutil.Envelope)
+	if err := jsonutil.DecodeJSON([]byte(tokens[0]), resp); err != nil {
+		t.Fatal(err)
+	}
+
+	aesKey, err := dhutil.GenerateSharedKey(pri, resp.Curve25519PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := dhutil.DecryptAES(aesKey, resp.EncryptedPayload, resp.Nonce, []byte("foobar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(token) != "token" {
+		t.Fatalf("bad: %q", token)
+	}
+}
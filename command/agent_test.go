@@ -0,0 +1,158 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	credAppRole "github.com/hashicorp/vault/builtin/credential/approle"
+	"github.com/hashicorp/vault/helper/logging"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+	"github.com/mitchellh/cli"
+)
+
+func testAgentCommand(tb testing.TB, logger hclog.Logger) (*cli.MockUi, *AgentCommand) {
+	tb.Helper()
+
+	ui := cli.NewMockUi()
+	return ui, &AgentCommand{
+		BaseCommand: &BaseCommand{
+			UI: ui,
+		},
+		ShutdownCh: MakeShutdownCh(),
+		logger:     logger,
+	}
+}
+
+func TestAgent_ExitAfterAuth(t *testing.T) {
+	logger := logging.NewVaultLogger(hclog.Trace)
+	coreConfig := &vault.CoreConfig{
+		DisableMlock: true,
+		DisableCache: true,
+		Logger:       logger,
+		CredentialBackends: map[string]logical.Factory{
+			"approle": credAppRole.Factory,
+		},
+	}
+
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+	client := cluster.Cores[0].Client
+
+	if err := client.Sys().EnableAuthWithOptions("approle", &api.EnableAuthOptions{
+		Type: "approle",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("auth/approle/role/test1", map[string]interface{}{
+		"bind_secret_id": "true",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Logical().Write("auth/approle/role/test1/secret-id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretID := resp.Data["secret_id"].(string)
+	resp, err = client.Logical().Read("auth/approle/role/test1/role-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleID := resp.Data["role_id"].(string)
+
+	tmpDir, err := ioutil.TempDir("", "agent-exit-after-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	roleIDPath := filepath.Join(tmpDir, "role-id")
+	secretIDPath := filepath.Join(tmpDir, "secret-id")
+	tokenPath := filepath.Join(tmpDir, "token")
+	if err := ioutil.WriteFile(roleIDPath, []byte(roleID), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(secretIDPath, []byte(secretID), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := fmt.Sprintf(`
+exit_after_auth = true
+
+vault {
+	address = "%s"
+	ca_cert = "%s"
+}
+
+auto_auth {
+	method "approle" {
+		config = {
+			role_id_file_path = "%s"
+			secret_id_file_path = "%s"
+		}
+	}
+
+	sink "file" {
+		config = {
+			path = "%s"
+		}
+	}
+}
+`, client.Address(), cluster.CACertPEMFile, roleIDPath, secretIDPath, tokenPath)
+
+	configPath := filepath.Join(tmpDir, "config.hcl")
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure the environment doesn't override the configuration
+	for _, env := range []string{api.EnvVaultAddress, api.EnvVaultCACert} {
+		if v, ok := os.LookupEnv(env); ok {
+			os.Unsetenv(env)
+			defer os.Setenv(env, v)
+		}
+	}
+
+	ui, cmd := testAgentCommand(t, logger)
+	code := cmd.Run([]string{"-config", configPath})
+	if code != 0 {
+		t.Fatalf("expected %d to be %d: %s", code, 0, ui.ErrorWriter.String())
+	}
+
+	token, err := ioutil.ReadFile(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetToken(strings.TrimSpace(string(token)))
+	secret, err := client.Auth().Token().LookupSelf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Data["meta"].(map[string]interface{})["role_name"] != "test1" {
+		t.Fatalf("bad: %#v", secret.Data)
+	}
+}
+
+func TestAgent_ConfigErrors(t *testing.T) {
+	ui, cmd := testAgentCommand(t, logging.NewVaultLogger(hclog.Trace))
+	code := cmd.Run([]string{})
+	if code != 1 {
+		t.Fatalf("expected %d to be %d", code, 1)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "Must specify exactly one config path") {
+		t.Fatalf("bad: %s", ui.ErrorWriter.String())
+	}
+}
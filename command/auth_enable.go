@@ -26,6 +26,7 @@ type AuthEnableCommand struct {
 	flagAuditNonHMACResponseKeys  []string
 	flagListingVisibility         string
 	flagPassthroughRequestHeaders []string
+	flagTokenType                 string
 	flagPluginName                string
 	flagOptions                   map[string]string
 	flagLocal                     bool
@@ -131,6 +132,14 @@ func (c *AuthEnableCommand) Flags() *FlagSets {
 			"will be sent to the backend",
 	})
 
+	f.StringVar(&StringVar{
+		Name:   flagNameTokenType,
+		Target: &c.flagTokenType,
+		Usage: "Sets the type of tokens issued by the auth method. Valid " +
+			"values are \"service\", \"batch\", \"default-service\" and " +
+			"\"default-batch\".",
+	})
+
 	f.StringVar(&StringVar{
 		Name:       "plugin-name",
 		Target:     &c.flagPluginName,
@@ -257,6 +266,10 @@ func (c *AuthEnableCommand) Run(args []string) int {
 		if fl.Name == flagNamePassthroughRequestHeaders {
 			authOpts.Config.PassthroughRequestHeaders = c.flagPassthroughRequestHeaders
 		}
+
+		if fl.Name == flagNameTokenType {
+			authOpts.Config.TokenType = c.flagTokenType
+		}
 	})
 
 	if err := client.Sys().EnableAuthWithOptions(authPath, authOpts); err != nil {
@@ -171,6 +171,9 @@ func TestAuthEnableCommand_Run(t *testing.T) {
 			}
 		}
 
+		// The JWT method is also registered under the name of its OIDC flow
+		backends = append(backends, "oidc")
+
 		if len(backends) != len(credentialBackends) {
 			t.Fatalf("expected %d credential backends, got %d", len(credentialBackends), len(backends))
 		}
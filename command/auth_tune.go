@@ -24,6 +24,7 @@ type AuthTuneCommand struct {
 	flagAuditNonHMACRequestKeys  []string
 	flagAuditNonHMACResponseKeys []string
 	flagListingVisibility        string
+	flagTokenType                string
 	flagVersion                  int
 }
 
@@ -103,6 +104,14 @@ func (c *AuthTuneCommand) Flags() *FlagSets {
 		Usage:  "Determines the visibility of the mount in the UI-specific listing endpoint.",
 	})
 
+	f.StringVar(&StringVar{
+		Name:   flagNameTokenType,
+		Target: &c.flagTokenType,
+		Usage: "Sets the type of tokens issued by the auth method. Valid " +
+			"values are \"service\", \"batch\", \"default-service\" and " +
+			"\"default-batch\".",
+	})
+
 	f.IntVar(&IntVar{
 		Name:    "version",
 		Target:  &c.flagVersion,
@@ -171,6 +180,10 @@ func (c *AuthTuneCommand) Run(args []string) int {
 		if fl.Name == flagNameListingVisibility {
 			mountConfigInput.ListingVisibility = c.flagListingVisibility
 		}
+
+		if fl.Name == flagNameTokenType {
+			mountConfigInput.TokenType = c.flagTokenType
+		}
 	})
 
 	// Append /auth (since that's where auths live) and a trailing slash to
@@ -39,6 +39,7 @@ type BaseCommand struct {
 	flagTLSServerName string
 	flagTLSSkipVerify bool
 	flagWrapTTL       time.Duration
+	flagNamespace     string
 
 	flagFormat string
 	flagField  string
@@ -113,6 +114,10 @@ func (c *BaseCommand) Client() (*api.Client, error) {
 
 	client.SetMFACreds(c.flagMFA)
 
+	if c.flagNamespace != "" {
+		client.SetNamespace(c.flagNamespace)
+	}
+
 	c.client = client
 
 	return client, nil
@@ -262,6 +267,17 @@ func (c *BaseCommand) flagSet(bit FlagSetBit) *FlagSets {
 					"or \"5m\".",
 			})
 
+			f.StringVar(&StringVar{
+				Name:       "namespace",
+				Target:     &c.flagNamespace,
+				Default:    "",
+				EnvVar:     api.EnvVaultNamespace,
+				Completion: complete.PredictAnything,
+				Usage: "The namespace to use for the command. Paths are relative " +
+					"to the namespace, which is sent as part of the " +
+					"X-Vault-Namespace header.",
+			})
+
 			f.StringSliceVar(&StringSliceVar{
 				Name:       "mfa",
 				Target:     &c.flagMFA,
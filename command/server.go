@@ -35,8 +35,10 @@ import (
 	sockaddr "github.com/hashicorp/go-sockaddr"
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/command/server"
+	serverseal "github.com/hashicorp/vault/command/server/seal"
 	"github.com/hashicorp/vault/helper/gated-writer"
 	"github.com/hashicorp/vault/helper/logging"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/reload"
@@ -402,7 +404,8 @@ func (c *ServerCommand) Run(args []string) int {
 				"in a Docker container, provide the IPC_LOCK cap to the container."))
 	}
 
-	if err := c.setupTelemetry(config); err != nil {
+	metricsHelper, err := c.setupTelemetry(config)
+	if err != nil {
 		c.UI.Error(fmt.Sprintf("Error initializing telemetry: %s", err))
 		return 1
 	}
@@ -426,21 +429,46 @@ func (c *ServerCommand) Run(args []string) int {
 
 	var seal vault.Seal = vault.NewDefaultSeal()
 
+	// Handle the case where seal stanzas were given. A disabled seal is the
+	// one being migrated away from, and is only used to unwrap the existing
+	// master key.
+	var unwrapSeal vault.Seal
+	for _, configSeal := range config.Seals {
+		var sealInfoKeys *[]string
+		var sealInfo *map[string]string
+		if !configSeal.Disabled {
+			sealInfoKeys, sealInfo = &infoKeys, &info
+		}
+
+		configuredSeal, sealConfigError := serverseal.ConfigureSeal(configSeal, sealInfoKeys, sealInfo, c.logger, vault.NewDefaultSeal())
+		if sealConfigError != nil {
+			c.UI.Error(fmt.Sprintf("Error configuring seal %q: %v", configSeal.Type, sealConfigError))
+			return 1
+		}
+		if configuredSeal == nil {
+			c.UI.Error(fmt.Sprintf("Could not create seal! Most likely proper Seal configuration information was not set, but no error was generated."))
+			return 1
+		}
+
+		if configSeal.Disabled {
+			unwrapSeal = configuredSeal
+		} else {
+			seal = configuredSeal
+		}
+	}
+
 	// Ensure that the seal finalizer is called, even if using verify-only
 	defer func() {
-		if seal != nil {
-			err = seal.Finalize(context.Background())
-			if err != nil {
+		for _, s := range []vault.Seal{seal, unwrapSeal} {
+			if s == nil {
+				continue
+			}
+			if err := s.Finalize(context.Background()); err != nil {
 				c.UI.Error(fmt.Sprintf("Error finalizing seals: %v", err))
 			}
 		}
 	}()
 
-	if seal == nil {
-		c.UI.Error(fmt.Sprintf("Could not create seal! Most likely proper Seal configuration information was not set, but no error was generated."))
-		return 1
-	}
-
 	coreConfig := &vault.CoreConfig{
 		Physical:           backend,
 		RedirectAddr:       config.Storage.RedirectAddr,
@@ -459,6 +487,7 @@ func (c *ServerCommand) Run(args []string) int {
 		PluginDirectory:    config.PluginDirectory,
 		EnableUI:           config.EnableUI,
 		EnableRaw:          config.EnableRawEndpoint,
+		MetricsHelper:      metricsHelper,
 	}
 	if c.flagDev {
 		coreConfig.DevToken = c.flagDevRootTokenID
@@ -790,6 +819,16 @@ CLUSTER_SYNTHESIS_COMPLETE:
 	core.SetClusterListenerAddrs(clusterAddrs)
 	core.SetClusterHandler(vaulthttp.Handler(core))
 
+	// If the persisted seal configuration doesn't match the configured seal,
+	// prepare to migrate the master key once the server is unsealed with the
+	// keys of the previous seal
+	if !c.flagDev && len(config.Seals) > 0 {
+		if err := core.AdjustForSealMigration(context.Background(), unwrapSeal); err != nil {
+			c.UI.Error(fmt.Sprintf("Error checking for seal migration: %s", err))
+			return 1
+		}
+	}
+
 	err = core.UnsealWithStoredKeys(context.Background())
 	if err != nil {
 		if !errwrap.ContainsType(err, new(vault.NonFatalError)) {
@@ -921,7 +960,13 @@ CLUSTER_SYNTHESIS_COMPLETE:
 
 	// Initialize the HTTP servers
 	for _, ln := range lns {
-		handler := vaulthttp.Handler(core)
+		var unauthMetrics bool
+		if v, ok := ln.config["unauthenticated_metrics_access"]; ok {
+			unauthMetrics = v.(bool)
+		}
+		handler := vaulthttp.HandlerWithOptions(core, &vaulthttp.HandlerOptions{
+			UnauthenticatedMetricsAccess: unauthMetrics,
+		})
 
 		// We perform validation on the config earlier, we can just cast here
 		if _, ok := ln.config["x_forwarded_for_authorized_addrs"]; ok {
@@ -1437,8 +1482,9 @@ func (c *ServerCommand) detectRedirect(detect physical.RedirectDetect,
 	return url.String(), nil
 }
 
-// setupTelemetry is used to setup the telemetry sub-systems
-func (c *ServerCommand) setupTelemetry(config *server.Config) error {
+// setupTelemetry is used to setup the telemetry sub-systems and returns the
+// helper used to serve the collected metrics from sys/metrics
+func (c *ServerCommand) setupTelemetry(config *server.Config) (*metricsutil.MetricsHelper, error) {
 	/* Setup telemetry
 	Aggregate on 10 second intervals for 1 minute. Expose the
 	metrics over stderr when there is a SIGUSR1 received.
@@ -1461,7 +1507,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsiteAddr != "" {
 		sink, err := metrics.NewStatsiteSink(telConfig.StatsiteAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -1470,7 +1516,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsdAddr != "" {
 		sink, err := metrics.NewStatsdSink(telConfig.StatsdAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -1506,7 +1552,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 
 		sink, err := circonus.NewCirconusSink(cfg)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		sink.Start()
 		fanout = append(fanout, sink)
@@ -1521,12 +1567,23 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 
 		sink, err := datadog.NewDogStatsdSink(telConfig.DogStatsDAddr, metricsConf.HostName)
 		if err != nil {
-			return errwrap.Wrapf("failed to start DogStatsD sink: {{err}}", err)
+			return nil, errwrap.Wrapf("failed to start DogStatsD sink: {{err}}", err)
 		}
 		sink.SetTags(tags)
 		fanout = append(fanout, sink)
 	}
 
+	// Configure the prometheus sink
+	var prometheusSink *metricsutil.PrometheusSink
+	if telConfig.PrometheusRetentionTime != 0 {
+		prometheusSink = metricsutil.NewPrometheusSink(telConfig.PrometheusRetentionTime)
+		fanout = append(fanout, prometheusSink)
+
+		// Hostname prefixes would make the metric names differ between
+		// nodes, which Prometheus already tells apart by instance
+		metricsConf.EnableHostname = false
+	}
+
 	// Initialize the global sink
 	if len(fanout) > 0 {
 		fanout = append(fanout, inm)
@@ -1535,7 +1592,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 		metricsConf.EnableHostname = false
 		metrics.NewGlobal(metricsConf, inm)
 	}
-	return nil
+	return metricsutil.NewMetricsHelper(inm, prometheusSink), nil
 }
 
 func (c *ServerCommand) Reload(lock *sync.RWMutex, reloadFuncs *map[string][]reload.ReloadFunc, configPath []string) error {
@@ -25,7 +25,7 @@ type Config struct {
 	Storage   *Storage    `hcl:"-"`
 	HAStorage *Storage    `hcl:"-"`
 
-	Seal *Seal `hcl:"-"`
+	Seals []*Seal `hcl:"-"`
 
 	CacheSize       int         `hcl:"cache_size"`
 	DisableCache    bool        `hcl:"-"`
@@ -125,7 +125,11 @@ func (b *Storage) GoString() string {
 
 // Seal contains Seal configuration for the server
 type Seal struct {
-	Type   string
+	Type string
+
+	// Disabled marks the seal that is being migrated away from
+	Disabled bool
+
 	Config map[string]string
 }
 
@@ -219,6 +223,12 @@ type Telemetry struct {
 	// DogStatsdTags are the global tags that should be sent with each packet to dogstatsd
 	// It is a list of strings, where each string looks like "my_tag_name:my_tag_value"
 	DogStatsDTags []string `hcl:"dogstatsd_tags"`
+
+	// Prometheus:
+	// PrometheusRetentionTime is the retention time for prometheus metrics if greater than 0.
+	// Default: 0, which disables the prometheus format of sys/metrics
+	PrometheusRetentionTime    time.Duration `hcl:"-"`
+	PrometheusRetentionTimeRaw interface{}   `hcl:"prometheus_retention_time"`
 }
 
 func (s *Telemetry) GoString() string {
@@ -249,9 +259,9 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.HAStorage = c2.HAStorage
 	}
 
-	result.Seal = c.Seal
-	if c2.Seal != nil {
-		result.Seal = c2.Seal
+	result.Seals = c.Seals
+	if len(c2.Seals) > 0 {
+		result.Seals = c2.Seals
 	}
 
 	result.Telemetry = c.Telemetry
@@ -706,83 +716,114 @@ func parseHAStorage(result *Config, list *ast.ObjectList, name string) error {
 }
 
 func parseSeal(result *Config, list *ast.ObjectList, blockName string) error {
-	if len(list.Items) > 1 {
-		return fmt.Errorf("only one %q block is permitted", blockName)
+	if len(list.Items) > 2 {
+		return fmt.Errorf("only two or less %q blocks are permitted", blockName)
 	}
 
-	// Get our item
-	item := list.Items[0]
+	seals := make([]*Seal, 0, len(list.Items))
+	for _, item := range list.Items {
+		key := blockName
+		if len(item.Keys) > 0 {
+			key = item.Keys[0].Token.Value().(string)
+		}
 
-	key := blockName
-	if len(item.Keys) > 0 {
-		key = item.Keys[0].Token.Value().(string)
-	}
+		var valid []string
+		// Valid parameter for the Seal types
+		switch key {
+		case "pkcs11":
+			valid = []string{
+				"lib",
+				"slot",
+				"token_label",
+				"pin",
+				"mechanism",
+				"hmac_mechanism",
+				"key_label",
+				"default_key_label",
+				"hmac_key_label",
+				"hmac_default_key_label",
+				"generate_key",
+				"regenerate_key",
+				"max_parallel",
+				"disable_auto_reinit_on_error",
+				"rsa_encrypt_local",
+				"rsa_oaep_hash",
+			}
+		case "awskms":
+			valid = []string{
+				"region",
+				"access_key",
+				"secret_key",
+				"kms_key_id",
+				"max_parallel",
+			}
+		case "gcpckms":
+			valid = []string{
+				"credentials",
+				"project",
+				"region",
+				"key_ring",
+				"crypto_key",
+			}
+		case "azurekeyvault":
+			valid = []string{
+				"tenant_id",
+				"client_id",
+				"client_secret",
+				"environment",
+				"vault_name",
+				"key_name",
+			}
+		case "transit":
+			valid = []string{
+				"address",
+				"token",
+				"mount_path",
+				"key_name",
+				"disable_renewal",
+				"tls_ca_cert",
+				"tls_client_cert",
+				"tls_client_key",
+				"tls_server_name",
+				"tls_skip_verify",
+			}
+		default:
+			return fmt.Errorf("invalid seal type %q", key)
+		}
+		valid = append(valid, "disabled")
 
-	var valid []string
-	// Valid parameter for the Seal types
-	switch key {
-	case "pkcs11":
-		valid = []string{
-			"lib",
-			"slot",
-			"token_label",
-			"pin",
-			"mechanism",
-			"hmac_mechanism",
-			"key_label",
-			"default_key_label",
-			"hmac_key_label",
-			"hmac_default_key_label",
-			"generate_key",
-			"regenerate_key",
-			"max_parallel",
-			"disable_auto_reinit_on_error",
-			"rsa_encrypt_local",
-			"rsa_oaep_hash",
-		}
-	case "awskms":
-		valid = []string{
-			"region",
-			"access_key",
-			"secret_key",
-			"kms_key_id",
-			"max_parallel",
-		}
-	case "gcpckms":
-		valid = []string{
-			"credentials",
-			"project",
-			"region",
-			"key_ring",
-			"crypto_key",
-		}
-	case "azurekeyvault":
-		valid = []string{
-			"tenant_id",
-			"client_id",
-			"client_secret",
-			"environment",
-			"vault_name",
-			"key_name",
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s.%s:", blockName, key))
 		}
-	default:
-		return fmt.Errorf("invalid seal type %q", key)
-	}
 
-	if err := checkHCLKeys(item.Val, valid); err != nil {
-		return multierror.Prefix(err, fmt.Sprintf("%s.%s:", blockName, key))
-	}
+		var m map[string]string
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s.%s:", blockName, key))
+		}
 
-	var m map[string]string
-	if err := hcl.DecodeObject(&m, item.Val); err != nil {
-		return multierror.Prefix(err, fmt.Sprintf("%s.%s:", blockName, key))
+		var disabled bool
+		if v, ok := m["disabled"]; ok {
+			var err error
+			disabled, err = parseutil.ParseBool(v)
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("%s.%s:", blockName, key))
+			}
+			delete(m, "disabled")
+		}
+
+		seals = append(seals, &Seal{
+			Type:     strings.ToLower(key),
+			Disabled: disabled,
+			Config:   m,
+		})
 	}
 
-	result.Seal = &Seal{
-		Type:   strings.ToLower(key),
-		Config: m,
+	if len(seals) == 2 && seals[0].Disabled == seals[1].Disabled {
+		return fmt.Errorf("when providing two %q blocks, exactly one must be disabled", blockName)
 	}
 
+	result.Seals = seals
+
 	return nil
 }
 
@@ -816,6 +857,7 @@ func parseListeners(result *Config, list *ast.ObjectList) error {
 			"tls_disable_client_certs",
 			"tls_client_ca_file",
 			"token",
+			"unauthenticated_metrics_access",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("listeners.%s:", key))
@@ -864,6 +906,7 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 		"disable_hostname",
 		"dogstatsd_addr",
 		"dogstatsd_tags",
+		"prometheus_retention_time",
 		"statsd_address",
 		"statsite_address",
 	}
@@ -883,6 +926,16 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 	if err := hcl.DecodeObject(&result.Telemetry, item.Val); err != nil {
 		return multierror.Prefix(err, "telemetry:")
 	}
+
+	if result.Telemetry.PrometheusRetentionTimeRaw != nil {
+		var err error
+		if result.Telemetry.PrometheusRetentionTime, err = parseutil.ParseDurationSecond(result.Telemetry.PrometheusRetentionTimeRaw); err != nil {
+			return multierror.Prefix(err, "telemetry:")
+		}
+		if result.Telemetry.PrometheusRetentionTime < 0 {
+			return fmt.Errorf("telemetry: prometheus_retention_time cannot be negative")
+		}
+	}
 	return nil
 }
 
@@ -451,3 +451,133 @@ telemetry {
 		t.Errorf("bad error: %q", err)
 	}
 }
+
+func TestParseTelemetry_prometheus(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Debug)
+
+	config, err := ParseConfig(strings.TrimSpace(`
+telemetry {
+	prometheus_retention_time = "30s"
+	disable_hostname = true
+}
+`), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Telemetry.PrometheusRetentionTime != 30*time.Second {
+		t.Fatalf("bad prometheus retention time: %v", config.Telemetry.PrometheusRetentionTime)
+	}
+
+	config, err = ParseConfig(strings.TrimSpace(`
+telemetry {
+	prometheus_retention_time = 3600
+}
+`), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Telemetry.PrometheusRetentionTime != time.Hour {
+		t.Fatalf("bad prometheus retention time: %v", config.Telemetry.PrometheusRetentionTime)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+telemetry {
+	prometheus_retention_time = "forever"
+}
+`), logger)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseSeal_transit(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Debug)
+
+	config, err := ParseConfig(strings.TrimSpace(`
+seal "transit" {
+	address = "https://vault:8200"
+	token = "s.Qf1s5zigZ4OX6akYjQXJC1jY"
+	mount_path = "transit/"
+	key_name = "unseal"
+	tls_skip_verify = "true"
+}
+`), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Seal{
+		Type: "transit",
+		Config: map[string]string{
+			"address":         "https://vault:8200",
+			"token":           "s.Qf1s5zigZ4OX6akYjQXJC1jY",
+			"mount_path":      "transit/",
+			"key_name":        "unseal",
+			"tls_skip_verify": "true",
+		},
+	}
+	if len(config.Seals) != 1 || !reflect.DeepEqual(config.Seals[0], expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.Seals, expected)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+seal "transit" {
+	key_name = "unseal"
+	bad = "one"
+}
+`), logger)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `seal.transit: invalid key "bad" on line 3`) {
+		t.Errorf("bad error: %q", err)
+	}
+}
+
+func TestParseSeal_migration(t *testing.T) {
+	logger := logging.NewVaultLogger(log.Debug)
+
+	config, err := ParseConfig(strings.TrimSpace(`
+seal "transit" {
+	key_name = "old"
+	disabled = "true"
+}
+seal "transit" {
+	key_name = "new"
+}
+`), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Seal{
+		&Seal{
+			Type:     "transit",
+			Disabled: true,
+			Config: map[string]string{
+				"key_name": "old",
+			},
+		},
+		&Seal{
+			Type: "transit",
+			Config: map[string]string{
+				"key_name": "new",
+			},
+		},
+	}
+	if !reflect.DeepEqual(config.Seals, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.Seals, expected)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+seal "transit" {
+	key_name = "old"
+}
+seal "transit" {
+	key_name = "new"
+}
+`), logger)
+	if err == nil || !strings.Contains(err.Error(), "exactly one must be disabled") {
+		t.Fatalf("expected error about disabled seals, got %v", err)
+	}
+}
@@ -94,6 +94,15 @@ func tcpListenerFactory(config map[string]interface{}, _ io.Writer, ui cli.Ui) (
 		config["x_forwarded_for_reject_not_authorized"] = true
 	}
 
+	if unauthMetricsRaw, ok := config["unauthenticated_metrics_access"]; ok {
+		unauthMetrics, err := parseutil.ParseBool(unauthMetricsRaw)
+		if err != nil {
+			return nil, nil, nil, errwrap.Wrapf("error parsing \"unauthenticated_metrics_access\": {{err}}", err)
+		}
+		props["unauthenticated_metrics_access"] = strconv.FormatBool(unauthMetrics)
+		config["unauthenticated_metrics_access"] = unauthMetrics
+	}
+
 	return listenerWrapTLS(ln, props, config, ui)
 }
 
@@ -0,0 +1,34 @@
+package seal
+
+import (
+	"fmt"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+var (
+	ConfigureSeal = configureSeal
+)
+
+// configureSeal returns the seal described by the given seal stanza, falling
+// back to the given seal when no stanza is present. Values that should be
+// shown to the operator on startup are added to info when it is non-nil.
+func configureSeal(configSeal *server.Seal, infoKeys *[]string, info *map[string]string, logger log.Logger, inseal vault.Seal) (vault.Seal, error) {
+	if configSeal == nil {
+		return inseal, nil
+	}
+
+	switch configSeal.Type {
+	case seal.Transit:
+		return configureTransitSeal(configSeal, infoKeys, info, logger, inseal)
+
+	case vault.SealTypeShamir:
+		return inseal, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported seal type %q", configSeal.Type)
+	}
+}
@@ -0,0 +1,28 @@
+package seal
+
+import (
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/seal"
+	"github.com/hashicorp/vault/vault/seal/transit"
+)
+
+func configureTransitSeal(configSeal *server.Seal, infoKeys *[]string, info *map[string]string, logger log.Logger, inseal vault.Seal) (vault.Seal, error) {
+	transitSeal := transit.NewSeal(logger.ResetNamed("seal-transit"))
+	sealInfo, err := transitSeal.SetConfig(configSeal.Config)
+	if err != nil {
+		return nil, errwrap.Wrapf("error configuring transit seal: {{err}}", err)
+	}
+
+	if infoKeys != nil && info != nil {
+		*infoKeys = append(*infoKeys, "seal type", "transit address", "transit mount path", "transit key name")
+		(*info)["seal type"] = seal.Transit
+		(*info)["transit address"] = sealInfo["address"]
+		(*info)["transit mount path"] = sealInfo["mount_path"]
+		(*info)["transit key name"] = sealInfo["key_name"]
+	}
+
+	return vault.NewAutoSeal(transitSeal), nil
+}
@@ -0,0 +1,46 @@
+package dhutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDHUtil_RoundTrip(t *testing.T) {
+	pub1, pri1, err := GeneratePublicPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub2, pri2, err := GeneratePublicPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key1, err := GenerateSharedKey(pri1, pub2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := GenerateSharedKey(pri2, pub1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key1, key2) {
+		t.Fatal("shared keys do not match")
+	}
+
+	ciphertext, nonce, err := EncryptAES(key1, []byte("foobar"), []byte("aad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := DecryptAES(key2, ciphertext, nonce, []byte("aad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "foobar" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	if _, err := DecryptAES(key2, ciphertext, nonce, []byte("bad")); err == nil {
+		t.Fatal("expected error with mismatched aad")
+	}
+}
@@ -56,7 +56,11 @@ type Group struct {
 	// Memberships of the internal groups can be managed over the API whereas
 	// the memberships on the external group --for which a corresponding alias
 	// will be set-- will be managed automatically.
-	Type                 string   `sentinel:"" protobuf:"bytes,12,opt,name=type" json:"type,omitempty"`
+	Type string `sentinel:"" protobuf:"bytes,12,opt,name=type" json:"type,omitempty"`
+	// NamespaceID is the identifier of the namespace to which this group
+	// belongs to. Do not return this value over the API when reading the
+	// group.
+	NamespaceID          string   `sentinel:"" protobuf:"bytes,13,opt,name=namespace_id,json=namespaceId" json:"namespace_id,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -170,6 +174,13 @@ func (m *Group) GetType() string {
 	return ""
 }
 
+func (m *Group) GetNamespaceID() string {
+	if m != nil {
+		return m.NamespaceID
+	}
+	return ""
+}
+
 // Entity represents an entity that gets persisted and indexed.
 // Entity is fundamentally composed of zero or many aliases.
 type Entity struct {
@@ -213,7 +224,11 @@ type Entity struct {
 	BucketKeyHash string `sentinel:"" protobuf:"bytes,9,opt,name=bucket_key_hash,json=bucketKeyHash" json:"bucket_key_hash,omitempty"`
 	// Disabled indicates whether tokens associated with the account should not
 	// be able to be used
-	Disabled             bool     `sentinel:"" protobuf:"varint,11,opt,name=disabled" json:"disabled,omitempty"`
+	Disabled bool `sentinel:"" protobuf:"varint,11,opt,name=disabled" json:"disabled,omitempty"`
+	// NamespaceID is the identifier of the namespace to which this entity
+	// belongs to. Do not return this value over the API when reading the
+	// entity.
+	NamespaceID          string   `sentinel:"" protobuf:"bytes,12,opt,name=namespace_id,json=namespaceId" json:"namespace_id,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -313,6 +328,13 @@ func (m *Entity) GetDisabled() bool {
 	return false
 }
 
+func (m *Entity) GetNamespaceID() string {
+	if m != nil {
+		return m.NamespaceID
+	}
+	return ""
+}
+
 // Alias represents the alias that gets stored inside of the
 // entity object in storage and also represents in an in-memory index of an
 // alias object.
@@ -460,46 +482,47 @@ func init() {
 func init() { proto.RegisterFile("helper/identity/types.proto", fileDescriptor_types_d1c3c8d60c8e2caa) }
 
 var fileDescriptor_types_d1c3c8d60c8e2caa = []byte{
-	// 656 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x95, 0x5d, 0x6f, 0xd3, 0x3c,
-	0x14, 0xc7, 0xd5, 0xa6, 0x2f, 0xe9, 0x69, 0xd7, 0xed, 0xb1, 0x1e, 0xa1, 0x50, 0x34, 0xe8, 0x26,
-	0x0d, 0x95, 0x09, 0x25, 0xd2, 0xb8, 0x61, 0xe3, 0x02, 0x0d, 0x18, 0x30, 0x21, 0x24, 0x14, 0x8d,
-	0x1b, 0x6e, 0x22, 0x37, 0xf1, 0x1a, 0x6b, 0x49, 0x1c, 0xc5, 0xce, 0x44, 0xbe, 0x0e, 0x5f, 0x8d,
-	0x6b, 0xbe, 0x03, 0xf2, 0x71, 0xd3, 0x96, 0x75, 0xbc, 0x4c, 0xdb, 0x9d, 0xfd, 0x3f, 0xc7, 0xc7,
-	0xf6, 0xf9, 0xff, 0xe2, 0xc0, 0x83, 0x98, 0x25, 0x39, 0x2b, 0x3c, 0x1e, 0xb1, 0x4c, 0x71, 0x55,
-	0x79, 0xaa, 0xca, 0x99, 0x74, 0xf3, 0x42, 0x28, 0x41, 0xec, 0x5a, 0x1d, 0x3d, 0x9a, 0x09, 0x31,
-	0x4b, 0x98, 0x87, 0xfa, 0xb4, 0x3c, 0xf7, 0x14, 0x4f, 0x99, 0x54, 0x34, 0xcd, 0x4d, 0xea, 0xee,
-	0xb7, 0x16, 0xb4, 0xdf, 0x15, 0xa2, 0xcc, 0xc9, 0x10, 0x9a, 0x3c, 0x72, 0x1a, 0xe3, 0xc6, 0xa4,
-	0xe7, 0x37, 0x79, 0x44, 0x08, 0xb4, 0x32, 0x9a, 0x32, 0xa7, 0x89, 0x0a, 0x8e, 0xc9, 0x08, 0xec,
-	0x5c, 0x24, 0x3c, 0xe4, 0x4c, 0x3a, 0xd6, 0xd8, 0x9a, 0xf4, 0xfc, 0xc5, 0x9c, 0x4c, 0x60, 0x2b,
-	0xa7, 0x05, 0xcb, 0x54, 0x30, 0xd3, 0xf5, 0x02, 0x1e, 0x49, 0xa7, 0x85, 0x39, 0x43, 0xa3, 0xe3,
-	0x36, 0xa7, 0x91, 0x24, 0xfb, 0xf0, 0x5f, 0xca, 0xd2, 0x29, 0x2b, 0x02, 0x73, 0x4a, 0x4c, 0x6d,
-	0x63, 0xea, 0xa6, 0x09, 0x9c, 0xa0, 0xae, 0x73, 0x0f, 0xc1, 0x4e, 0x99, 0xa2, 0x11, 0x55, 0xd4,
-	0xe9, 0x8c, 0xad, 0x49, 0xff, 0x60, 0xdb, 0xad, 0x6f, 0xe7, 0x62, 0x45, 0xf7, 0xe3, 0x3c, 0x7e,
-	0x92, 0xa9, 0xa2, 0xf2, 0x17, 0xe9, 0xe4, 0x25, 0x6c, 0x84, 0x05, 0xa3, 0x8a, 0x8b, 0x2c, 0xd0,
-	0xd7, 0x76, 0xba, 0xe3, 0xc6, 0xa4, 0x7f, 0x30, 0x72, 0x4d, 0x4f, 0xdc, 0xba, 0x27, 0xee, 0x59,
-	0xdd, 0x13, 0x7f, 0x50, 0x2f, 0xd0, 0x12, 0x79, 0x03, 0x5b, 0x09, 0x95, 0x2a, 0x28, 0xf3, 0x88,
-	0x2a, 0x66, 0x6a, 0xd8, 0x7f, 0xad, 0x31, 0xd4, 0x6b, 0x3e, 0xe3, 0x12, 0xac, 0xb2, 0x03, 0x83,
-	0x54, 0x44, 0xfc, 0xbc, 0x0a, 0x78, 0x16, 0xb1, 0xaf, 0x4e, 0x6f, 0xdc, 0x98, 0xb4, 0xfc, 0xbe,
-	0xd1, 0x4e, 0xb5, 0x44, 0x1e, 0xc3, 0xe6, 0xb4, 0x0c, 0x2f, 0x98, 0x0a, 0x2e, 0x58, 0x15, 0xc4,
-	0x54, 0xc6, 0x0e, 0x60, 0xd7, 0x37, 0x8c, 0xfc, 0x81, 0x55, 0xef, 0xa9, 0x8c, 0xc9, 0x1e, 0xb4,
-	0x69, 0xc2, 0xa9, 0x74, 0xfa, 0x78, 0x8a, 0xcd, 0x65, 0x27, 0x8e, 0xb5, 0xec, 0x9b, 0xa8, 0x76,
-	0x4e, 0xd3, 0xe0, 0x0c, 0x8c, 0x73, 0x7a, 0x3c, 0x7a, 0x01, 0x1b, 0xbf, 0xf4, 0x89, 0x6c, 0x81,
-	0x75, 0xc1, 0xaa, 0xb9, 0xdf, 0x7a, 0x48, 0xfe, 0x87, 0xf6, 0x25, 0x4d, 0xca, 0xda, 0x71, 0x33,
-	0x39, 0x6a, 0x3e, 0x6f, 0xec, 0x7e, 0xb7, 0xa0, 0x63, 0x2c, 0x21, 0x4f, 0xa0, 0x8b, 0x9b, 0x30,
-	0xe9, 0x34, 0xd0, 0x8e, 0xb5, 0x43, 0xd4, 0xf1, 0x39, 0x50, 0xcd, 0x35, 0xa0, 0xac, 0x15, 0xa0,
-	0x8e, 0x56, 0xec, 0x6d, 0x61, 0xbd, 0x87, 0xcb, 0x7a, 0x66, 0xcb, 0x7f, 0xf7, 0xb7, 0x7d, 0x07,
-	0xfe, 0x76, 0x6e, 0xec, 0x2f, 0xd2, 0x5c, 0xcc, 0x58, 0xb4, 0x4a, 0x73, 0xb7, 0xa6, 0x59, 0x07,
-	0x96, 0x34, 0xaf, 0x7e, 0x3f, 0xf6, 0x95, 0xef, 0xe7, 0x1a, 0x08, 0x7a, 0xd7, 0x41, 0x30, 0x02,
-	0x3b, 0xe2, 0x92, 0x4e, 0x13, 0x16, 0x21, 0x07, 0xb6, 0xbf, 0x98, 0xdf, 0xce, 0xe5, 0x1f, 0x16,
-	0xb4, 0xd1, 0xc2, 0xb5, 0xa7, 0x60, 0x07, 0x06, 0x21, 0xcd, 0x44, 0xc6, 0x43, 0x9a, 0x04, 0x0b,
-	0x4f, 0xfb, 0x0b, 0xed, 0x34, 0x22, 0xdb, 0x00, 0xa9, 0x28, 0x33, 0x15, 0x20, 0x79, 0xc6, 0xe2,
-	0x1e, 0x2a, 0x67, 0x55, 0xce, 0xc8, 0x1e, 0x0c, 0x4d, 0x98, 0x86, 0x21, 0x93, 0x52, 0x14, 0x4e,
-	0xcb, 0xdc, 0x0d, 0xd5, 0xe3, 0xb9, 0xb8, 0xac, 0x92, 0x53, 0x15, 0xa3, 0x9f, 0x75, 0x95, 0x4f,
-	0x54, 0xc5, 0x7f, 0x7e, 0x0c, 0xf0, 0xe8, 0xbf, 0x85, 0xa5, 0x86, 0xaf, 0xbb, 0x02, 0xdf, 0x1a,
-	0x40, 0xf6, 0x1d, 0x00, 0xd4, 0xbb, 0x31, 0x40, 0x87, 0x70, 0x7f, 0x0e, 0xd0, 0x79, 0x21, 0xd2,
-	0x60, 0xb5, 0xd3, 0xd2, 0x01, 0xa4, 0xe4, 0x9e, 0x49, 0x78, 0x5b, 0x88, 0xf4, 0xf5, 0xb2, 0xe9,
-	0xf2, 0x56, 0x7e, 0xbf, 0x7a, 0xfa, 0x65, 0x7f, 0xc6, 0x55, 0x5c, 0x4e, 0xdd, 0x50, 0xa4, 0x9e,
-	0x06, 0x8e, 0x87, 0xa2, 0xc8, 0xbd, 0x4b, 0x5a, 0x26, 0xca, 0xbb, 0xf2, 0x7f, 0x99, 0x76, 0xf0,
-	0x26, 0xcf, 0x7e, 0x06, 0x00, 0x00, 0xff, 0xff, 0xf6, 0x89, 0x41, 0x55, 0x79, 0x06, 0x00, 0x00,
+	// 670 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x95, 0xdd, 0x6e, 0xd3, 0x30,
+	0x14, 0xc7, 0xd5, 0x26, 0x69, 0x53, 0xf7, 0x63, 0xc3, 0x42, 0xc8, 0x14, 0x0d, 0xba, 0x49, 0x43,
+	0x65, 0x42, 0x89, 0x34, 0x6e, 0xd8, 0xb8, 0x40, 0x03, 0x06, 0x54, 0x08, 0x09, 0x45, 0xe3, 0x86,
+	0x9b, 0xc8, 0x8d, 0xbd, 0xc6, 0x5a, 0x12, 0x47, 0xb1, 0x33, 0x91, 0x17, 0xe0, 0xcd, 0x78, 0x1c,
+	0xde, 0x01, 0xd9, 0x6e, 0xda, 0xb0, 0x8e, 0x8f, 0x89, 0xdd, 0xd9, 0xff, 0x73, 0xfc, 0xcf, 0xf1,
+	0x39, 0xbf, 0x24, 0xe0, 0x41, 0x4c, 0x93, 0x9c, 0x16, 0x3e, 0x23, 0x34, 0x93, 0x4c, 0x56, 0xbe,
+	0xac, 0x72, 0x2a, 0xbc, 0xbc, 0xe0, 0x92, 0x43, 0xb7, 0x56, 0xc7, 0x8f, 0x16, 0x9c, 0x2f, 0x12,
+	0xea, 0x6b, 0x7d, 0x5e, 0x9e, 0xfb, 0x92, 0xa5, 0x54, 0x48, 0x9c, 0xe6, 0x26, 0x75, 0xef, 0xbb,
+	0x0d, 0x9c, 0x77, 0x05, 0x2f, 0x73, 0x38, 0x02, 0x6d, 0x46, 0x50, 0x6b, 0xd2, 0x9a, 0xf6, 0x82,
+	0x36, 0x23, 0x10, 0x02, 0x3b, 0xc3, 0x29, 0x45, 0x6d, 0xad, 0xe8, 0x35, 0x1c, 0x03, 0x37, 0xe7,
+	0x09, 0x8b, 0x18, 0x15, 0xc8, 0x9a, 0x58, 0xd3, 0x5e, 0xb0, 0xda, 0xc3, 0x29, 0xd8, 0xce, 0x71,
+	0x41, 0x33, 0x19, 0x2e, 0x94, 0x5f, 0xc8, 0x88, 0x40, 0xb6, 0xce, 0x19, 0x19, 0x5d, 0x3f, 0x66,
+	0x46, 0x04, 0x3c, 0x00, 0x77, 0x52, 0x9a, 0xce, 0x69, 0x11, 0x9a, 0x2a, 0x75, 0xaa, 0xa3, 0x53,
+	0xb7, 0x4c, 0xe0, 0x54, 0xeb, 0x2a, 0xf7, 0x08, 0xb8, 0x29, 0x95, 0x98, 0x60, 0x89, 0x51, 0x67,
+	0x62, 0x4d, 0xfb, 0x87, 0x3b, 0x5e, 0x7d, 0x3b, 0x4f, 0x3b, 0x7a, 0x1f, 0x97, 0xf1, 0xd3, 0x4c,
+	0x16, 0x55, 0xb0, 0x4a, 0x87, 0x2f, 0xc1, 0x30, 0x2a, 0x28, 0x96, 0x8c, 0x67, 0xa1, 0xba, 0x36,
+	0xea, 0x4e, 0x5a, 0xd3, 0xfe, 0xe1, 0xd8, 0x33, 0x3d, 0xf1, 0xea, 0x9e, 0x78, 0x67, 0x75, 0x4f,
+	0x82, 0x41, 0x7d, 0x40, 0x49, 0xf0, 0x0d, 0xd8, 0x4e, 0xb0, 0x90, 0x61, 0x99, 0x13, 0x2c, 0xa9,
+	0xf1, 0x70, 0xff, 0xea, 0x31, 0x52, 0x67, 0x3e, 0xeb, 0x23, 0xda, 0x65, 0x17, 0x0c, 0x52, 0x4e,
+	0xd8, 0x79, 0x15, 0xb2, 0x8c, 0xd0, 0xaf, 0xa8, 0x37, 0x69, 0x4d, 0xed, 0xa0, 0x6f, 0xb4, 0x99,
+	0x92, 0xe0, 0x63, 0xb0, 0x35, 0x2f, 0xa3, 0x0b, 0x2a, 0xc3, 0x0b, 0x5a, 0x85, 0x31, 0x16, 0x31,
+	0x02, 0xba, 0xeb, 0x43, 0x23, 0x7f, 0xa0, 0xd5, 0x7b, 0x2c, 0x62, 0xb8, 0x0f, 0x1c, 0x9c, 0x30,
+	0x2c, 0x50, 0x5f, 0x57, 0xb1, 0xb5, 0xee, 0xc4, 0x89, 0x92, 0x03, 0x13, 0x55, 0x93, 0x53, 0x34,
+	0xa0, 0x81, 0x99, 0x9c, 0x5a, 0xab, 0x2a, 0xd4, 0x04, 0x45, 0x8e, 0x23, 0x1a, 0x32, 0x82, 0x86,
+	0x3a, 0xd6, 0x5f, 0x69, 0x33, 0x32, 0x7e, 0x01, 0x86, 0xbf, 0xb4, 0x12, 0x6e, 0x03, 0xeb, 0x82,
+	0x56, 0x4b, 0x24, 0xd4, 0x12, 0xde, 0x05, 0xce, 0x25, 0x4e, 0xca, 0x1a, 0x0a, 0xb3, 0x39, 0x6e,
+	0x3f, 0x6f, 0xed, 0x7d, 0xb3, 0x41, 0xc7, 0x4c, 0x0d, 0x3e, 0x01, 0x5d, 0x5d, 0x07, 0x15, 0xa8,
+	0x35, 0xb1, 0xae, 0xab, 0xb3, 0x8e, 0x2f, 0x99, 0x6b, 0x6f, 0x30, 0x67, 0x35, 0x98, 0x3b, 0x6e,
+	0x10, 0x60, 0x6b, 0xbf, 0x87, 0x6b, 0x3f, 0xf3, 0xc8, 0x7f, 0x47, 0xc0, 0xb9, 0x05, 0x04, 0x3a,
+	0x37, 0x46, 0x40, 0x03, 0x5f, 0x2c, 0x28, 0x69, 0x02, 0xdf, 0xad, 0x81, 0x57, 0x81, 0x35, 0xf0,
+	0xcd, 0x57, 0xcc, 0xbd, 0xf2, 0x8a, 0x5d, 0xc3, 0x49, 0xef, 0x3a, 0x4e, 0xc6, 0xc0, 0x25, 0x4c,
+	0xe0, 0x79, 0x42, 0x89, 0x46, 0xc5, 0x0d, 0x56, 0xfb, 0x0d, 0x10, 0x06, 0xb7, 0x0c, 0xc2, 0x0f,
+	0x0b, 0x38, 0x7a, 0xca, 0x1b, 0x1f, 0x94, 0x5d, 0x30, 0x88, 0x70, 0xc6, 0x33, 0x16, 0xe1, 0x24,
+	0x5c, 0x8d, 0xbd, 0xbf, 0xd2, 0x66, 0x04, 0xee, 0x00, 0x90, 0xf2, 0x32, 0x93, 0xa1, 0xe6, 0xd7,
+	0x50, 0xd0, 0xd3, 0xca, 0x99, 0x82, 0x78, 0x1f, 0x8c, 0x4c, 0x18, 0x47, 0x11, 0x15, 0x82, 0x17,
+	0xc8, 0x36, 0xd7, 0xd7, 0xea, 0xc9, 0x52, 0x5c, 0xbb, 0xe4, 0x58, 0xc6, 0xc8, 0x69, 0xb8, 0x7c,
+	0xc2, 0x32, 0xfe, 0xf3, 0x27, 0x45, 0x97, 0xfe, 0x5b, 0x9e, 0x6a, 0x3e, 0xbb, 0x0d, 0x3e, 0x37,
+	0x18, 0x73, 0x6f, 0x81, 0xb1, 0xde, 0x8d, 0x19, 0x3b, 0x02, 0xf7, 0x97, 0x8c, 0x9d, 0x17, 0x3c,
+	0x0d, 0x9b, 0x9d, 0x16, 0x08, 0x68, 0x90, 0xee, 0x99, 0x84, 0xb7, 0x05, 0x4f, 0x5f, 0xaf, 0x9b,
+	0x2e, 0xfe, 0x6b, 0xde, 0xaf, 0x9e, 0x7e, 0x39, 0x58, 0x30, 0x19, 0x97, 0x73, 0x2f, 0xe2, 0xa9,
+	0xaf, 0x98, 0x64, 0x11, 0x2f, 0x72, 0xff, 0x12, 0x97, 0x89, 0xf4, 0xaf, 0xfc, 0xa5, 0xe6, 0x1d,
+	0x7d, 0x93, 0x67, 0x3f, 0x07, 0x00, 0xa3, 0xfd, 0x42, 0xe6, 0xbf, 0x06, 0x00, 0x00,
 }
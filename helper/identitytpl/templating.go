@@ -0,0 +1,336 @@
+package identitytpl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/identity"
+)
+
+var (
+	ErrUnbalancedTemplatingCharacter = errors.New("unbalanced templating characters")
+	ErrNoEntityAttachedToToken       = errors.New("string contains entity template directives but no entity was provided")
+	ErrNoGroupsAttachedToToken       = errors.New("string contains groups template directives but no groups were provided")
+	ErrTemplateValueNotFound         = errors.New("no value could be found for one of the template directives")
+)
+
+const (
+	// ACLTemplating substitutes the raw values of the directives, as used in
+	// policy paths. Directives without a value are an error.
+	ACLTemplating = iota
+
+	// JSONTemplating substitutes the JSON encoding of the values of the
+	// directives, so that the result of templating a JSON document is still
+	// valid JSON. Directives without a value resolve to an empty string. The
+	// entity's whole metadata map, its alias metadata maps and the lists of
+	// its group IDs and names can be used in this mode as well.
+	JSONTemplating
+)
+
+// PopulateStringInput is used to populate the templates within a string
+type PopulateStringInput struct {
+	// ValidityCheckOnly only checks that the templates in the string are
+	// well-formed, without requiring an entity or groups to resolve them
+	ValidityCheckOnly bool
+
+	// Mode is either ACLTemplating, the default, or JSONTemplating
+	Mode int
+
+	String string
+	Entity *identity.Entity
+	Groups []*identity.Group
+}
+
+// PopulateString replaces every {{identity.…}} directive in the input string
+// with the matching value of the given entity or groups. It returns whether
+// the string contained any directives along with the populated string.
+func PopulateString(p *PopulateStringInput) (bool, string, error) {
+	if p == nil {
+		return false, "", errors.New("nil input")
+	}
+
+	if p.String == "" {
+		return false, "", nil
+	}
+
+	var subtemplates []string
+
+	splitStr := strings.Split(p.String, "{{")
+
+	if len(splitStr) >= 1 {
+		if strings.Contains(splitStr[0], "}}") {
+			return false, "", ErrUnbalancedTemplatingCharacter
+		}
+		if len(splitStr) == 1 {
+			return false, p.String, nil
+		}
+		subtemplates = splitStr[1:]
+	}
+
+	var b strings.Builder
+	b.WriteString(splitStr[0])
+
+	for _, str := range subtemplates {
+		splitPiece := strings.Split(str, "}}")
+		switch len(splitPiece) {
+		case 2:
+			result, err := populateTemplate(p, strings.TrimSpace(splitPiece[0]))
+			if err != nil {
+				return true, "", err
+			}
+			b.WriteString(result)
+			b.WriteString(splitPiece[1])
+		default:
+			return true, "", ErrUnbalancedTemplatingCharacter
+		}
+	}
+
+	return true, b.String(), nil
+}
+
+func populateTemplate(p *PopulateStringInput, tpl string) (string, error) {
+	if p.Mode == JSONTemplating {
+		return populateJSONTemplate(p, tpl)
+	}
+	return populateRawTemplate(p, tpl)
+}
+
+// populateJSONTemplate resolves a directive to its JSON encoded value
+func populateJSONTemplate(p *PopulateStringInput, tpl string) (string, error) {
+	if p.Entity == nil && !p.ValidityCheckOnly {
+		return "", ErrNoEntityAttachedToToken
+	}
+
+	var value interface{}
+	switch {
+	case tpl == "identity.entity.metadata":
+		if !p.ValidityCheckOnly {
+			value = nonNilMap(p.Entity.Metadata)
+		}
+
+	case tpl == "identity.entity.groups.ids", tpl == "identity.entity.groups.names":
+		if !p.ValidityCheckOnly {
+			list := make([]string, 0, len(p.Groups))
+			for _, group := range p.Groups {
+				if tpl == "identity.entity.groups.ids" {
+					list = append(list, group.ID)
+				} else {
+					list = append(list, group.Name)
+				}
+			}
+			value = list
+		}
+
+	case strings.HasPrefix(tpl, "identity.entity.aliases.") && strings.HasSuffix(tpl, ".metadata"):
+		accessor := strings.TrimSuffix(strings.TrimPrefix(tpl, "identity.entity.aliases."), ".metadata")
+		if accessor == "" || strings.Contains(accessor, ".") {
+			return "", errors.New("invalid alias selector in entity template")
+		}
+		if !p.ValidityCheckOnly {
+			metadata := map[string]string{}
+			for _, a := range p.Entity.Aliases {
+				if a.MountAccessor == accessor {
+					metadata = nonNilMap(a.Metadata)
+					break
+				}
+			}
+			value = metadata
+		}
+
+	default:
+		// Groups are optional in JSON templates, so only the validity of
+		// the directive matters when there are none
+		input := *p
+		if len(p.Groups) == 0 && strings.HasPrefix(tpl, "identity.groups.") {
+			input.ValidityCheckOnly = true
+		}
+		result, err := populateRawTemplate(&input, tpl)
+		switch {
+		case err == ErrTemplateValueNotFound:
+		case err != nil:
+			return "", err
+		}
+		value = result
+	}
+
+	if p.ValidityCheckOnly {
+		// Any valid JSON value will do to check the resulting document
+		value = ""
+	}
+
+	ret, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func populateRawTemplate(p *PopulateStringInput, tpl string) (string, error) {
+	switch {
+	case strings.HasPrefix(tpl, "identity.entity."):
+		if !p.ValidityCheckOnly && p.Entity == nil {
+			return "", ErrNoEntityAttachedToToken
+		}
+		return performEntityTemplating(p, strings.TrimPrefix(tpl, "identity.entity."))
+
+	case strings.HasPrefix(tpl, "identity.groups."):
+		if !p.ValidityCheckOnly && len(p.Groups) == 0 {
+			return "", ErrNoGroupsAttachedToToken
+		}
+		return performGroupsTemplating(p, strings.TrimPrefix(tpl, "identity.groups."))
+
+	default:
+		return "", fmt.Errorf("invalid template directive %q", tpl)
+	}
+}
+
+func performEntityTemplating(p *PopulateStringInput, trimmed string) (string, error) {
+	switch {
+	case trimmed == "id":
+		if p.ValidityCheckOnly {
+			return "", nil
+		}
+		return p.Entity.ID, nil
+
+	case trimmed == "name":
+		if p.ValidityCheckOnly {
+			return "", nil
+		}
+		if p.Entity.Name == "" {
+			return "", ErrTemplateValueNotFound
+		}
+		return p.Entity.Name, nil
+
+	case strings.HasPrefix(trimmed, "metadata."):
+		key := strings.TrimPrefix(trimmed, "metadata.")
+		if key == "" {
+			return "", errors.New("missing metadata key in entity template")
+		}
+		if p.ValidityCheckOnly {
+			return "", nil
+		}
+		return found(p.Entity.Metadata[key])
+
+	case strings.HasPrefix(trimmed, "aliases."):
+		split := strings.SplitN(strings.TrimPrefix(trimmed, "aliases."), ".", 2)
+		if len(split) != 2 || split[0] == "" {
+			return "", errors.New("invalid alias selector in entity template")
+		}
+		accessor, selector := split[0], split[1]
+
+		var alias *identity.Alias
+		if !p.ValidityCheckOnly {
+			for _, a := range p.Entity.Aliases {
+				if a.MountAccessor == accessor {
+					alias = a
+					break
+				}
+			}
+		}
+
+		switch {
+		case selector == "id":
+			if p.ValidityCheckOnly {
+				return "", nil
+			}
+			if alias == nil {
+				return "", ErrTemplateValueNotFound
+			}
+			return alias.ID, nil
+
+		case selector == "name":
+			if p.ValidityCheckOnly {
+				return "", nil
+			}
+			if alias == nil {
+				return "", ErrTemplateValueNotFound
+			}
+			return found(alias.Name)
+
+		case strings.HasPrefix(selector, "metadata."):
+			key := strings.TrimPrefix(selector, "metadata.")
+			if key == "" {
+				return "", errors.New("missing metadata key in alias template")
+			}
+			if p.ValidityCheckOnly {
+				return "", nil
+			}
+			if alias == nil {
+				return "", ErrTemplateValueNotFound
+			}
+			return found(alias.Metadata[key])
+		}
+	}
+
+	return "", fmt.Errorf("invalid entity template directive %q", trimmed)
+}
+
+func performGroupsTemplating(p *PopulateStringInput, trimmed string) (string, error) {
+	var ids bool
+
+	switch {
+	case strings.HasPrefix(trimmed, "ids."):
+		ids = true
+		trimmed = strings.TrimPrefix(trimmed, "ids.")
+	case strings.HasPrefix(trimmed, "names."):
+		trimmed = strings.TrimPrefix(trimmed, "names.")
+	default:
+		return "", fmt.Errorf("invalid groups template directive %q", trimmed)
+	}
+
+	split := strings.SplitN(trimmed, ".", 2)
+	if len(split) != 2 || split[0] == "" {
+		return "", errors.New("invalid group selector in groups template")
+	}
+	groupKey, selector := split[0], split[1]
+
+	switch {
+	case ids && selector == "name":
+	case !ids && selector == "id":
+	case strings.HasPrefix(selector, "metadata.") && selector != "metadata.":
+	default:
+		return "", fmt.Errorf("invalid groups template selector %q", selector)
+	}
+
+	if p.ValidityCheckOnly {
+		return "", nil
+	}
+
+	var group *identity.Group
+	for _, g := range p.Groups {
+		if (ids && g.ID == groupKey) || (!ids && g.Name == groupKey) {
+			group = g
+			break
+		}
+	}
+	if group == nil {
+		return "", ErrTemplateValueNotFound
+	}
+
+	switch selector {
+	case "name":
+		return found(group.Name)
+	case "id":
+		return group.ID, nil
+	default:
+		return found(group.Metadata[strings.TrimPrefix(selector, "metadata.")])
+	}
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// found returns an error for empty values, so that a directive never
+// silently resolves to an empty path segment
+func found(value string) (string, error) {
+	if value == "" {
+		return "", ErrTemplateValueNotFound
+	}
+	return value, nil
+}
@@ -0,0 +1,269 @@
+package identitytpl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/identity"
+)
+
+func TestPopulate_Basic(t *testing.T) {
+	var tests = []struct {
+		name              string
+		input             string
+		output            string
+		err               error
+		validityCheckOnly bool
+		entityName        string
+		metadata          map[string]string
+		aliasAccessor     string
+		aliasName         string
+		aliasMetadata     map[string]string
+		groupName         string
+		groupMetadata     map[string]string
+	}{
+		{
+			name:   "no_templating",
+			input:  "path foobar {",
+			output: "path foobar {",
+		},
+		{
+			name:  "only_closing",
+			input: "path foobar}} {",
+			err:   ErrUnbalancedTemplatingCharacter,
+		},
+		{
+			name:  "closing_in_front",
+			input: "path }} {{foobar}} {",
+			err:   ErrUnbalancedTemplatingCharacter,
+		},
+		{
+			name:  "closing_in_back",
+			input: "path {{foobar}} }}",
+			err:   ErrUnbalancedTemplatingCharacter,
+		},
+		{
+			name:   "basic",
+			input:  "path /{{identity.entity.id}}/ {",
+			output: "path /entityID/ {",
+		},
+		{
+			name:       "multiple",
+			input:      "path {{identity.entity.name}} {\n\tval = {{identity.entity.metadata.foo}}\n}",
+			entityName: "entityName",
+			metadata:   map[string]string{"foo": "bar"},
+			output:     "path entityName {\n\tval = bar\n}",
+		},
+		{
+			name:     "multiple_bad_name",
+			input:    "path {{identity.entity.name}} {\n\tval = {{identity.entity.metadata.foo}}\n}",
+			metadata: map[string]string{"foo": "bar"},
+			err:      ErrTemplateValueNotFound,
+		},
+		{
+			name:  "unbalanced_close",
+			input: "path {{identity.entity.id}} {\n\tval = {{ent}}ity.metadata.foo}}\n}",
+			err:   ErrUnbalancedTemplatingCharacter,
+		},
+		{
+			name:  "unbalanced_open",
+			input: "path {{identity.entity.id}} {\n\tval = {{ent{{ity.metadata.foo}}\n}",
+			err:   ErrUnbalancedTemplatingCharacter,
+		},
+		{
+			name:     "metadata_not_found",
+			input:    "path {{identity.entity.metadata.team}} {",
+			metadata: map[string]string{"foo": "bar"},
+			err:      ErrTemplateValueNotFound,
+		},
+		{
+			name:          "alias_name",
+			input:         "path {{identity.entity.aliases.auth_userpass_1234.name}} {",
+			aliasAccessor: "auth_userpass_1234",
+			aliasName:     "aliasName",
+			output:        "path aliasName {",
+		},
+		{
+			name:          "alias_metadata",
+			input:         "path {{identity.entity.aliases.auth_userpass_1234.metadata.zip}} {",
+			aliasAccessor: "auth_userpass_1234",
+			aliasMetadata: map[string]string{"zip": "zap"},
+			output:        "path zap {",
+		},
+		{
+			name:          "alias_wrong_accessor",
+			input:         "path {{identity.entity.aliases.auth_github_5678.name}} {",
+			aliasAccessor: "auth_userpass_1234",
+			aliasName:     "aliasName",
+			err:           ErrTemplateValueNotFound,
+		},
+		{
+			name:      "group_name_to_id",
+			input:     "path {{identity.groups.names.groupName.id}} {",
+			groupName: "groupName",
+			output:    "path groupID {",
+		},
+		{
+			name:      "group_id_to_name",
+			input:     "path {{identity.groups.ids.groupID.name}} {",
+			groupName: "groupName",
+			output:    "path groupName {",
+		},
+		{
+			name:          "group_metadata",
+			input:         "path {{identity.groups.names.groupName.metadata.region}} {",
+			groupName:     "groupName",
+			groupMetadata: map[string]string{"region": "eu"},
+			output:        "path eu {",
+		},
+		{
+			name:      "group_not_member",
+			input:     "path {{identity.groups.names.other.id}} {",
+			groupName: "groupName",
+			err:       ErrTemplateValueNotFound,
+		},
+		{
+			name:  "no_groups",
+			input: "path {{identity.groups.names.groupName.id}} {",
+			err:   ErrNoGroupsAttachedToToken,
+		},
+		{
+			name:              "validity_only",
+			input:             "path {{identity.entity.metadata.team}}/{{identity.groups.ids.foo.name}} {",
+			validityCheckOnly: true,
+		},
+		{
+			name:              "validity_bad_selector",
+			input:             "path {{identity.entity.team}} {",
+			validityCheckOnly: true,
+			err:               errInvalid,
+		},
+		{
+			name:              "validity_unknown_prefix",
+			input:             "path {{identity.token.id}} {",
+			validityCheckOnly: true,
+			err:               errInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		var entity *identity.Entity
+		if test.validityCheckOnly == false {
+			entity = &identity.Entity{
+				ID:       "entityID",
+				Name:     test.entityName,
+				Metadata: test.metadata,
+			}
+			if test.aliasAccessor != "" {
+				entity.Aliases = []*identity.Alias{
+					&identity.Alias{
+						MountAccessor: test.aliasAccessor,
+						Name:          test.aliasName,
+						Metadata:      test.aliasMetadata,
+					},
+				}
+			}
+		}
+		var groups []*identity.Group
+		if test.groupName != "" {
+			groups = append(groups, &identity.Group{
+				ID:       "groupID",
+				Name:     test.groupName,
+				Metadata: test.groupMetadata,
+			})
+		}
+
+		_, out, err := PopulateString(&PopulateStringInput{
+			ValidityCheckOnly: test.validityCheckOnly,
+			String:            test.input,
+			Entity:            entity,
+			Groups:            groups,
+		})
+		switch {
+		case test.err == errInvalid:
+			if err == nil {
+				t.Fatalf("%s: expected an error", test.name)
+			}
+			continue
+		case test.err != nil:
+			if err != test.err {
+				t.Fatalf("%s: expected error %v, got %v", test.name, test.err, err)
+			}
+			continue
+		case err != nil:
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.validityCheckOnly && out != test.output {
+			t.Fatalf("%s: bad output: %q", test.name, out)
+		}
+	}
+}
+
+// errInvalid marks test cases that should fail with any error
+var errInvalid = errors.New("any error")
+
+func TestPopulate_JSON(t *testing.T) {
+	entity := &identity.Entity{
+		ID:       "entityID",
+		Name:     "entityName",
+		Metadata: map[string]string{"color": "green"},
+		Aliases: []*identity.Alias{
+			&identity.Alias{
+				MountAccessor: "auth_userpass_1234",
+				Name:          "aliasName",
+				Metadata:      map[string]string{"zip": "zap"},
+			},
+		},
+	}
+	groups := []*identity.Group{
+		&identity.Group{
+			ID:   "groupID",
+			Name: "groupName",
+		},
+	}
+
+	input := `{"name": {{identity.entity.name}}, "meta": {{identity.entity.metadata}}, ` +
+		`"alias": {{identity.entity.aliases.auth_userpass_1234.metadata}}, "groups": {{identity.entity.groups.names}}, ` +
+		`"team": {{identity.entity.metadata.team}}, "group_id": {{identity.groups.names.groupName.id}}}`
+	expected := `{"name": "entityName", "meta": {"color":"green"}, ` +
+		`"alias": {"zip":"zap"}, "groups": ["groupName"], ` +
+		`"team": "", "group_id": "groupID"}`
+
+	_, out, err := PopulateString(&PopulateStringInput{
+		Mode:   JSONTemplating,
+		String: input,
+		Entity: entity,
+		Groups: groups,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != expected {
+		t.Fatalf("bad output: %s", out)
+	}
+
+	// Without groups the group directives resolve to empty values
+	_, out, err = PopulateString(&PopulateStringInput{
+		Mode:   JSONTemplating,
+		String: `{"ids": {{identity.entity.groups.ids}}, "group_id": {{identity.groups.names.groupName.id}}}`,
+		Entity: entity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `{"ids": [], "group_id": ""}` {
+		t.Fatalf("bad output: %s", out)
+	}
+
+	_, out, err = PopulateString(&PopulateStringInput{
+		Mode:              JSONTemplating,
+		ValidityCheckOnly: true,
+		String:            `{"meta": {{identity.entity.metadata}}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `{"meta": ""}` {
+		t.Fatalf("bad output: %s", out)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"math"
 	"net"
 	"net/url"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -170,6 +171,14 @@ func (c *Client) GetUserDN(cfg *ConfigEntry, conn Connection, bindDN string) (st
 	return userDN, nil
 }
 
+// inChainGroupFilter matches all the groups the user is a member of, directly
+// or through nested groups, using the LDAP_MATCHING_RULE_IN_CHAIN rule of
+// Active Directory
+const inChainGroupFilter = "(member:1.2.840.113556.1.4.1941:={{.UserDN}})"
+
+// maxGroupNestingDepth bounds the number of levels of nested groups walked
+const maxGroupNestingDepth = 32
+
 /*
  * getLdapGroups queries LDAP and returns a slice describing the set of groups the authenticated user is a member of.
  *
@@ -185,6 +194,11 @@ func (c *Client) GetUserDN(cfg *ConfigEntry, conn Connection, bindDN string) (st
  *   cfg.GroupDN     = "OU=Groups,DC=myorg,DC=com"
  *   cfg.GroupAttr   = "cn"
  *
+ * Nested groups are resolved according to cfg.NestedGroupResolution:
+ *    in_chain - cfg.GroupFilter is replaced by a LDAP_MATCHING_RULE_IN_CHAIN filter
+ *    walk     - the query is repeated for each group found, with the group DN as UserDN
+ *               and the group CN as Username, until no new group is found
+ *
  * NOTE - If cfg.GroupFilter is empty, no query is performed and an empty result slice is returned.
  *
  */
@@ -202,26 +216,79 @@ func (c *Client) GetLdapGroups(cfg *ConfigEntry, conn Connection, userDN string,
 		return make([]string, 0), nil
 	}
 
+	groupFilter := cfg.GroupFilter
+	if cfg.NestedGroupResolution == NestedGroupResolutionInChain {
+		groupFilter = inChainGroupFilter
+	}
+
 	// If groupfilter was defined, resolve it as a Go template and use the query for
 	// returning the user's groups
 	if c.Logger.IsDebug() {
-		c.Logger.Debug("compiling group filter", "group_filter", cfg.GroupFilter)
+		c.Logger.Debug("compiling group filter", "group_filter", groupFilter)
 	}
 
 	// Parse the configuration as a template.
 	// Example template "(&(objectClass=group)(member:1.2.840.113556.1.4.1941:={{.UserDN}}))"
-	t, err := template.New("queryTemplate").Parse(cfg.GroupFilter)
+	t, err := template.New("queryTemplate").Parse(groupFilter)
 	if err != nil {
 		return nil, errwrap.Wrapf("LDAP search failed due to template compilation error: {{err}}", err)
 	}
 
+	entries, err := c.searchGroups(cfg, conn, t, userDN, username)
+	if err != nil {
+		return nil, err
+	}
+	c.addGroupCNs(cfg, entries, ldapMap)
+
+	if cfg.NestedGroupResolution == NestedGroupResolutionWalk {
+		// Walk up the groups breadth first, searching each group only once so
+		// that cycles terminate
+		seen := map[string]bool{
+			strings.ToLower(userDN): true,
+		}
+		pending := groupDNs(cfg, entries)
+		for depth := 0; len(pending) > 0; depth++ {
+			if depth == maxGroupNestingDepth {
+				c.Logger.Warn("maximum group nesting depth reached, ignoring deeper groups", "max_depth", maxGroupNestingDepth)
+				break
+			}
+
+			var next []string
+			for _, groupDN := range pending {
+				if seen[strings.ToLower(groupDN)] {
+					continue
+				}
+				seen[strings.ToLower(groupDN)] = true
+
+				entries, err := c.searchGroups(cfg, conn, t, groupDN, getCN(groupDN))
+				if err != nil {
+					return nil, err
+				}
+				c.addGroupCNs(cfg, entries, ldapMap)
+				next = append(next, groupDNs(cfg, entries)...)
+			}
+			pending = next
+		}
+	}
+
+	ldapGroups := make([]string, 0, len(ldapMap))
+	for key, _ := range ldapMap {
+		ldapGroups = append(ldapGroups, key)
+	}
+
+	return ldapGroups, nil
+}
+
+// searchGroups renders the group filter for the given member and returns the
+// matching entries under cfg.GroupDN
+func (c *Client) searchGroups(cfg *ConfigEntry, conn Connection, t *template.Template, memberDN string, memberName string) ([]*ldap.Entry, error) {
 	// Build context to pass to template - we will be exposing UserDn and Username.
 	context := struct {
 		UserDN   string
 		Username string
 	}{
-		ldap.EscapeFilter(userDN),
-		ldap.EscapeFilter(username),
+		ldap.EscapeFilter(memberDN),
+		ldap.EscapeFilter(memberName),
 	}
 
 	var renderedQuery bytes.Buffer
@@ -231,7 +298,7 @@ func (c *Client) GetLdapGroups(cfg *ConfigEntry, conn Connection, userDN string,
 		c.Logger.Debug("searching", "groupdn", cfg.GroupDN, "rendered_query", renderedQuery.String())
 	}
 
-	result, err := conn.Search(&ldap.SearchRequest{
+	result, err := c.search(cfg, conn, &ldap.SearchRequest{
 		BaseDN: cfg.GroupDN,
 		Scope:  2, // subtree
 		Filter: renderedQuery.String(),
@@ -244,7 +311,12 @@ func (c *Client) GetLdapGroups(cfg *ConfigEntry, conn Connection, userDN string,
 		return nil, errwrap.Wrapf("LDAP search failed: {{err}}", err)
 	}
 
-	for _, e := range result.Entries {
+	return result.Entries, nil
+}
+
+// addGroupCNs adds the CNs of the groups described by the entries to ldapMap
+func (c *Client) addGroupCNs(cfg *ConfigEntry, entries []*ldap.Entry, ldapMap map[string]bool) {
+	for _, e := range entries {
 		dn, err := ldap.ParseDN(e.DN)
 		if err != nil || len(dn.RDNs) == 0 {
 			continue
@@ -263,13 +335,77 @@ func (c *Client) GetLdapGroups(cfg *ConfigEntry, conn Connection, userDN string,
 			ldapMap[groupCN] = true
 		}
 	}
+}
 
-	ldapGroups := make([]string, 0, len(ldapMap))
-	for key, _ := range ldapMap {
-		ldapGroups = append(ldapGroups, key)
+// search runs the search request, using the paged search control if a page
+// size is configured
+func (c *Client) search(cfg *ConfigEntry, conn Connection, searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if cfg.MaxPageSize > 0 {
+		return conn.SearchWithPaging(searchRequest, uint32(cfg.MaxPageSize))
+	}
+	return conn.Search(searchRequest)
+}
+
+// GetUserAttributes returns the alias metadata configured in
+// cfg.UserMetadataAttributes, read from the entry of the user. Attributes
+// missing from the entry are skipped, and multiple values are joined with
+// commas.
+func (c *Client) GetUserAttributes(cfg *ConfigEntry, conn Connection, userDN string) (map[string]string, error) {
+	if len(cfg.UserMetadataAttributes) == 0 {
+		return nil, nil
 	}
 
-	return ldapGroups, nil
+	attributes := make([]string, 0, len(cfg.UserMetadataAttributes))
+	for attribute := range cfg.UserMetadataAttributes {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     userDN,
+		Scope:      0, // base
+		Filter:     "(objectClass=*)",
+		Attributes: attributes,
+		SizeLimit:  1,
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("LDAP search for user attributes failed: {{err}}", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("LDAP search for user attributes 0 or not unique")
+	}
+
+	metadata := make(map[string]string)
+	for _, attr := range result.Entries[0].Attributes {
+		for attribute, key := range cfg.UserMetadataAttributes {
+			// Attribute descriptions are case insensitive
+			if strings.EqualFold(attr.Name, attribute) && len(attr.Values) > 0 {
+				metadata[key] = strings.Join(attr.Values, ",")
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+// groupDNs returns the DNs of the groups described by the entries: the DN
+// values of cfg.GroupAttr when it holds DNs (such as memberOf), or else the
+// DNs of the entries themselves
+func groupDNs(cfg *ConfigEntry, entries []*ldap.Entry) []string {
+	var dns []string
+	for _, e := range entries {
+		var found bool
+		for _, val := range e.GetAttributeValues(cfg.GroupAttr) {
+			if dn, err := ldap.ParseDN(val); err == nil && len(dn.RDNs) > 0 {
+				dns = append(dns, val)
+				found = true
+			}
+		}
+		if !found {
+			dns = append(dns, e.DN)
+		}
+	}
+	return dns
 }
 
 // EscapeLDAPValue is exported because a plugin uses it outside this package.
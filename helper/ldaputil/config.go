@@ -14,6 +14,19 @@ import (
 	"github.com/hashicorp/errwrap"
 )
 
+const (
+	// NestedGroupResolutionNone only returns the groups matched by the group
+	// filter
+	NestedGroupResolutionNone = "none"
+
+	// NestedGroupResolutionInChain finds all the groups of the user with the
+	// LDAP_MATCHING_RULE_IN_CHAIN rule of Active Directory
+	NestedGroupResolutionInChain = "in_chain"
+
+	// NestedGroupResolutionWalk repeats the group search for each group found
+	NestedGroupResolutionWalk = "walk"
+)
+
 // ConfigFields returns all the config fields that can potentially be used by the LDAP client.
 // Not all fields will be used by every integration.
 func ConfigFields() map[string]*framework.FieldSchema {
@@ -115,6 +128,29 @@ Default: cn`,
 			Type:        framework.TypeBool,
 			Description: "If true, case sensitivity will be used when comparing usernames and groups for matching policies.",
 		},
+
+		"max_page_size": {
+			Type:        framework.TypeInt,
+			Default:     0,
+			Description: "If set to a value greater than 0, group searches use the paged search control of the LDAP server to request pages of up to this size. Defaults to 0, meaning no paging.",
+		},
+
+		"nested_group_resolution": {
+			Type:    framework.TypeString,
+			Default: NestedGroupResolutionNone,
+			Description: `How to resolve the groups that the groups of the user are nested in (optional)
+"none" only returns the groups matched by <groupfilter>.
+"in_chain" uses the Active Directory LDAP_MATCHING_RULE_IN_CHAIN rule in place of <groupfilter>.
+"walk" repeats the <groupfilter> search for each group found, with the DN of the group as UserDN.
+Default: none`,
+		},
+
+		"user_metadata_attributes": {
+			Type: framework.TypeKVPairs,
+			Description: `Mapping of attributes of the LDAP user entry to the keys of the alias
+metadata they are stored under (optional)
+Example: mail=email,department=department`,
+		},
 	}
 }
 
@@ -231,6 +267,21 @@ func NewConfigEntry(d *framework.FieldData) (*ConfigEntry, error) {
 		*cfg.CaseSensitiveNames = caseSensitiveNames.(bool)
 	}
 
+	cfg.MaxPageSize = d.Get("max_page_size").(int)
+	if cfg.MaxPageSize < 0 {
+		return nil, fmt.Errorf("'max_page_size' must not be negative")
+	}
+
+	cfg.NestedGroupResolution = d.Get("nested_group_resolution").(string)
+	if !validNestedGroupResolution(cfg.NestedGroupResolution) {
+		return nil, fmt.Errorf("invalid 'nested_group_resolution' %q", cfg.NestedGroupResolution)
+	}
+
+	userMetadataAttributes := d.Get("user_metadata_attributes").(map[string]string)
+	if len(userMetadataAttributes) > 0 {
+		cfg.UserMetadataAttributes = userMetadataAttributes
+	}
+
 	return cfg, nil
 }
 
@@ -257,6 +308,10 @@ type ConfigEntry struct {
 	// To continue reading in users' previously stored values,
 	// we chose to carry that forward.
 	CaseSensitiveNames *bool `json:"CaseSensitiveNames,omitempty"`
+
+	MaxPageSize            int               `json:"max_page_size"`
+	NestedGroupResolution  string            `json:"nested_group_resolution"`
+	UserMetadataAttributes map[string]string `json:"user_metadata_attributes"`
 }
 
 func (c *ConfigEntry) Map() map[string]interface{} {
@@ -282,6 +337,10 @@ func (c *ConfigEntry) PasswordlessMap() map[string]interface{} {
 		"discoverdn":      c.DiscoverDN,
 		"tls_min_version": c.TLSMinVersion,
 		"tls_max_version": c.TLSMaxVersion,
+
+		"max_page_size":            c.MaxPageSize,
+		"nested_group_resolution":  c.NestedGroupResolution,
+		"user_metadata_attributes": c.UserMetadataAttributes,
 	}
 	if c.CaseSensitiveNames != nil {
 		m["case_sensitive_names"] = *c.CaseSensitiveNames
@@ -309,6 +368,12 @@ func (c *ConfigEntry) Validate() error {
 	if tlsMaxVersion < tlsMinVersion {
 		return errors.New("'tls_max_version' must be greater than or equal to 'tls_min_version'")
 	}
+	if c.MaxPageSize < 0 {
+		return errors.New("'max_page_size' must not be negative")
+	}
+	if !validNestedGroupResolution(c.NestedGroupResolution) {
+		return fmt.Errorf("invalid 'nested_group_resolution' %q", c.NestedGroupResolution)
+	}
 	if c.Certificate != "" {
 		block, _ := pem.Decode([]byte(c.Certificate))
 		if block == nil || block.Type != "CERTIFICATE" {
@@ -321,3 +386,11 @@ func (c *ConfigEntry) Validate() error {
 	}
 	return nil
 }
+
+func validNestedGroupResolution(resolution string) bool {
+	switch resolution {
+	case "", NestedGroupResolutionNone, NestedGroupResolutionInChain, NestedGroupResolutionWalk:
+		return true
+	}
+	return false
+}
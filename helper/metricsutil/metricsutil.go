@@ -0,0 +1,114 @@
+package metricsutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// PrometheusMetricFormat is the value of the format parameter used to
+	// request metrics in the Prometheus text exposition format
+	PrometheusMetricFormat = "prometheus"
+
+	// PrometheusContentType is the content type of the Prometheus text
+	// exposition format
+	PrometheusContentType = "text/plain; version=0.0.4"
+
+	// ErrorContentType is the content type used when metrics cannot be
+	// rendered
+	ErrorContentType = "text/plain"
+)
+
+// MetricsHelper gives access to the in-memory sinks that are fed by the
+// global metrics instance so that they can be exposed over the API.
+type MetricsHelper struct {
+	inMemSink      *metrics.InmemSink
+	prometheusSink *PrometheusSink
+}
+
+// NewMetricsHelper returns a MetricsHelper reading from the given sinks. The
+// Prometheus sink may be nil, in which case Prometheus output is disabled.
+func NewMetricsHelper(inMem *metrics.InmemSink, prometheusSink *PrometheusSink) *MetricsHelper {
+	return &MetricsHelper{
+		inMemSink:      inMem,
+		prometheusSink: prometheusSink,
+	}
+}
+
+// PrometheusEnabled returns whether metrics can be rendered in the
+// Prometheus format
+func (m *MetricsHelper) PrometheusEnabled() bool {
+	return m.prometheusSink != nil
+}
+
+// ResponseForFormat returns a raw response containing the metrics rendered
+// in the requested format. An empty format results in JSON output.
+func (m *MetricsHelper) ResponseForFormat(format string) *logical.Response {
+	switch strings.ToLower(format) {
+	case PrometheusMetricFormat:
+		return m.PrometheusResponse()
+	case "":
+		return m.GenericResponse()
+	default:
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("metric response format %q unknown", format))
+	}
+}
+
+// PrometheusResponse renders the metrics in the Prometheus text exposition
+// format
+func (m *MetricsHelper) PrometheusResponse() *logical.Response {
+	if !m.PrometheusEnabled() {
+		return errorResponse(http.StatusBadRequest, "prometheus is not enabled")
+	}
+
+	var buf bytes.Buffer
+	if err := m.prometheusSink.WritePrometheus(&buf); err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("error rendering prometheus metrics: %s", err))
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: PrometheusContentType,
+			logical.HTTPRawBody:     buf.Bytes(),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}
+}
+
+// GenericResponse renders a JSON summary of the most recent finished
+// interval of the in-memory sink
+func (m *MetricsHelper) GenericResponse() *logical.Response {
+	summary, err := m.inMemSink.DisplayMetrics(nil, nil)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("error while fetching the in-memory metrics: %s", err))
+	}
+
+	content, err := json.Marshal(summary)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("error while marshaling the in-memory metrics: %s", err))
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     content,
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}
+}
+
+func errorResponse(code int, message string) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: ErrorContentType,
+			logical.HTTPRawBody:     []byte(message),
+			logical.HTTPStatusCode:  code,
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package metricsutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPrometheusSink_WritePrometheus(t *testing.T) {
+	sink := NewPrometheusSink(time.Hour)
+
+	sink.SetGauge([]string{"vault", "expire", "num_leases"}, 5)
+	sink.IncrCounter([]string{"vault", "audit", "log_request_failure"}, 1)
+	sink.IncrCounter([]string{"vault", "audit", "log_request_failure"}, 2)
+	sink.AddSample([]string{"vault", "core", "handle_request"}, 1.5)
+	sink.AddSample([]string{"vault", "core", "handle_request"}, 2.5)
+	sink.AddSampleWithLabels([]string{"vault", "route", "read", "secret-"}, 1, []metrics.Label{
+		{Name: "mount", Value: `a"b`},
+	})
+
+	var buf bytes.Buffer
+	if err := sink.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"# TYPE vault_audit_log_request_failure counter",
+		"vault_audit_log_request_failure 3",
+		"# TYPE vault_core_handle_request summary",
+		"vault_core_handle_request_sum 4",
+		"vault_core_handle_request_count 2",
+		"# TYPE vault_expire_num_leases gauge",
+		"vault_expire_num_leases 5",
+		"# TYPE vault_route_read_secret_ summary",
+		`vault_route_read_secret__sum{mount="a\"b"} 1`,
+		`vault_route_read_secret__count{mount="a\"b"} 1`,
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Fatalf("bad output:\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPrometheusSink_Retention(t *testing.T) {
+	sink := NewPrometheusSink(50 * time.Millisecond)
+	sink.SetGauge([]string{"vault", "stale"}, 1)
+
+	time.Sleep(100 * time.Millisecond)
+	sink.SetGauge([]string{"vault", "fresh"}, 1)
+
+	var buf bytes.Buffer
+	if err := sink.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "vault_stale") {
+		t.Fatalf("expected expired series to be dropped:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "vault_fresh 1") {
+		t.Fatalf("expected fresh series to be retained:\n%s", buf.String())
+	}
+}
+
+func TestMetricsHelper_ResponseForFormat(t *testing.T) {
+	inm := metrics.NewInmemSink(10*time.Second, time.Minute)
+	inm.SetGauge([]string{"vault", "test"}, 1)
+
+	helper := NewMetricsHelper(inm, nil)
+
+	resp := helper.ResponseForFormat("")
+	if resp.Data[logical.HTTPStatusCode] != http.StatusOK {
+		t.Fatalf("bad response: %#v", resp)
+	}
+	var summary metrics.MetricsSummary
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Gauges) != 1 || summary.Gauges[0].Name != "vault.test" {
+		t.Fatalf("bad summary: %#v", summary)
+	}
+
+	resp = helper.ResponseForFormat(PrometheusMetricFormat)
+	if resp.Data[logical.HTTPStatusCode] != http.StatusBadRequest {
+		t.Fatalf("expected prometheus to be disabled, got %#v", resp)
+	}
+
+	resp = helper.ResponseForFormat("xml")
+	if resp.Data[logical.HTTPStatusCode] != http.StatusBadRequest {
+		t.Fatalf("expected unknown format to be rejected, got %#v", resp)
+	}
+
+	prom := NewPrometheusSink(time.Hour)
+	prom.SetGauge([]string{"vault", "test"}, 1)
+	helper = NewMetricsHelper(inm, prom)
+
+	resp = helper.ResponseForFormat(PrometheusMetricFormat)
+	if resp.Data[logical.HTTPStatusCode] != http.StatusOK || resp.Data[logical.HTTPContentType] != PrometheusContentType {
+		t.Fatalf("bad response: %#v", resp)
+	}
+	if !strings.Contains(string(resp.Data[logical.HTTPRawBody].([]byte)), "vault_test 1") {
+		t.Fatalf("bad body: %s", resp.Data[logical.HTTPRawBody])
+	}
+}
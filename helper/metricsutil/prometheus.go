@@ -0,0 +1,211 @@
+package metricsutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+var (
+	_ metrics.MetricSink = (*PrometheusSink)(nil)
+
+	invalidNameCharRe = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+const (
+	prometheusGauge   = "gauge"
+	prometheusCounter = "counter"
+	prometheusSummary = "summary"
+)
+
+// prometheusMetric is a single series tracked by the PrometheusSink
+type prometheusMetric struct {
+	name      string
+	labels    []metrics.Label
+	kind      string
+	value     float64
+	count     uint64
+	updatedAt time.Time
+}
+
+// PrometheusSink is a metrics.MetricSink that keeps the values needed to
+// render the Prometheus text exposition format. Series that haven't been
+// updated within the retention time are dropped.
+type PrometheusSink struct {
+	l         sync.Mutex
+	retention time.Duration
+	series    map[string]*prometheusMetric
+}
+
+// NewPrometheusSink returns a sink retaining each series for the given
+// duration after its last update.
+func NewPrometheusSink(retention time.Duration) *PrometheusSink {
+	return &PrometheusSink{
+		retention: retention,
+		series:    make(map[string]*prometheusMetric),
+	}
+}
+
+func (p *PrometheusSink) SetGauge(key []string, val float32) {
+	p.SetGaugeWithLabels(key, val, nil)
+}
+
+func (p *PrometheusSink) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
+	p.update(prometheusGauge, key, labels, func(m *prometheusMetric) {
+		m.value = float64(val)
+	})
+}
+
+// EmitKey is rendered as a gauge, since only the last value is meaningful
+// to a scraper
+func (p *PrometheusSink) EmitKey(key []string, val float32) {
+	p.SetGaugeWithLabels(key, val, nil)
+}
+
+func (p *PrometheusSink) IncrCounter(key []string, val float32) {
+	p.IncrCounterWithLabels(key, val, nil)
+}
+
+func (p *PrometheusSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	p.update(prometheusCounter, key, labels, func(m *prometheusMetric) {
+		m.value += float64(val)
+	})
+}
+
+func (p *PrometheusSink) AddSample(key []string, val float32) {
+	p.AddSampleWithLabels(key, val, nil)
+}
+
+func (p *PrometheusSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	p.update(prometheusSummary, key, labels, func(m *prometheusMetric) {
+		m.value += float64(val)
+		m.count++
+	})
+}
+
+func (p *PrometheusSink) update(kind string, key []string, labels []metrics.Label, fn func(*prometheusMetric)) {
+	name := prometheusName(strings.Join(key, "_"))
+	id := seriesID(kind, name, labels)
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	m, ok := p.series[id]
+	if !ok {
+		m = &prometheusMetric{
+			name:   name,
+			labels: sanitizeLabels(labels),
+			kind:   kind,
+		}
+		p.series[id] = m
+	}
+	fn(m)
+	m.updatedAt = time.Now()
+}
+
+// WritePrometheus renders all retained series in the Prometheus text
+// exposition format, dropping any that have expired.
+func (p *PrometheusSink) WritePrometheus(w io.Writer) error {
+	p.l.Lock()
+	cutoff := time.Now().Add(-p.retention)
+	series := make([]prometheusMetric, 0, len(p.series))
+	for id, m := range p.series {
+		if p.retention > 0 && m.updatedAt.Before(cutoff) {
+			delete(p.series, id)
+			continue
+		}
+		series = append(series, *m)
+	}
+	p.l.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		return labelString(series[i].labels) < labelString(series[j].labels)
+	})
+
+	bw := bufio.NewWriter(w)
+	var lastName string
+	for _, m := range series {
+		if m.name != lastName {
+			fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+			lastName = m.name
+		}
+
+		labels := labelString(m.labels)
+		switch m.kind {
+		case prometheusSummary:
+			fmt.Fprintf(bw, "%s_sum%s %s\n", m.name, labels, formatFloat(m.value))
+			fmt.Fprintf(bw, "%s_count%s %d\n", m.name, labels, m.count)
+		default:
+			fmt.Fprintf(bw, "%s%s %s\n", m.name, labels, formatFloat(m.value))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// prometheusName replaces any characters that aren't valid in a Prometheus
+// metric or label name
+func prometheusName(name string) string {
+	return invalidNameCharRe.ReplaceAllString(name, "_")
+}
+
+func sanitizeLabels(labels []metrics.Label) []metrics.Label {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	sanitized := make([]metrics.Label, 0, len(labels))
+	for _, label := range labels {
+		sanitized = append(sanitized, metrics.Label{
+			Name:  prometheusName(label.Name),
+			Value: label.Value,
+		})
+	}
+	sort.Slice(sanitized, func(i, j int) bool {
+		return sanitized[i].Name < sanitized[j].Name
+	})
+	return sanitized
+}
+
+func seriesID(kind, name string, labels []metrics.Label) string {
+	return kind + ":" + name + labelString(sanitizeLabels(labels))
+}
+
+func labelString(labels []metrics.Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label.Name, labelValueReplacer.Replace(label.Value)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
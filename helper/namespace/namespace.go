@@ -0,0 +1,110 @@
+package namespace
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+type contextValues struct{}
+
+// Namespace is an isolated hierarchy of mounts, policies and tokens. Its
+// path is the prefix under which everything in the namespace is routed.
+type Namespace struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+const (
+	// RootNamespaceID is the ID of the namespace every other namespace is
+	// nested under
+	RootNamespaceID = "root"
+)
+
+var (
+	contextNamespace contextValues = struct{}{}
+
+	// ErrNoNamespace is returned when no namespace can be found for a request
+	ErrNoNamespace error = errors.New("no namespace")
+
+	// RootNamespace is the top-level namespace, which has an empty path
+	RootNamespace = &Namespace{
+		ID:   RootNamespaceID,
+		Path: "",
+	}
+)
+
+// HasParent returns whether possibleParent is an ancestor of the namespace.
+// A namespace is not considered its own parent.
+func (n *Namespace) HasParent(possibleParent *Namespace) bool {
+	switch {
+	case n.Path == "":
+		return false
+	case possibleParent.Path == "":
+		return true
+	default:
+		return n.Path != possibleParent.Path && strings.HasPrefix(n.Path, possibleParent.Path)
+	}
+}
+
+// Contains returns whether other is the namespace itself or one of its
+// descendants
+func (n *Namespace) Contains(other *Namespace) bool {
+	return n.ID == other.ID || other.HasParent(n)
+}
+
+// TrimmedPath returns the given path relative to the namespace
+func (n *Namespace) TrimmedPath(path string) string {
+	return strings.TrimPrefix(path, n.Path)
+}
+
+// ContextWithNamespace returns a copy of the context carrying the given
+// namespace
+func ContextWithNamespace(ctx context.Context, ns *Namespace) context.Context {
+	return context.WithValue(ctx, contextNamespace, ns)
+}
+
+// RootContext returns a copy of the context carrying the root namespace. A
+// background context is used if ctx is nil.
+func RootContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return ContextWithNamespace(context.Background(), RootNamespace)
+	}
+	return ContextWithNamespace(ctx, RootNamespace)
+}
+
+// FromContext retrieves the namespace from a context. Contexts that never had
+// a namespace attached belong to the root namespace, which is the case for
+// requests generated internally by Vault.
+func FromContext(ctx context.Context) (*Namespace, error) {
+	if ctx == nil {
+		return nil, errors.New("context was nil")
+	}
+
+	nsRaw := ctx.Value(contextNamespace)
+	if nsRaw == nil {
+		return RootNamespace, nil
+	}
+
+	ns := nsRaw.(*Namespace)
+	if ns == nil {
+		return nil, ErrNoNamespace
+	}
+
+	return ns, nil
+}
+
+// Canonicalize trims any leading slash from the namespace path and ensures
+// that it ends with a slash, unless it is the root namespace's empty path
+func Canonicalize(nsPath string) string {
+	if nsPath == "" || nsPath == "/" {
+		return ""
+	}
+
+	nsPath = strings.TrimPrefix(nsPath, "/")
+	if !strings.HasSuffix(nsPath, "/") {
+		nsPath += "/"
+	}
+
+	return nsPath
+}
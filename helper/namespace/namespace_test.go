@@ -0,0 +1,82 @@
+package namespace
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNamespace_HasParent(t *testing.T) {
+	foo := &Namespace{ID: "foo", Path: "foo/"}
+	fooBar := &Namespace{ID: "foobar", Path: "foo/bar/"}
+	fooBaz := &Namespace{ID: "foobaz", Path: "foobaz/"}
+
+	tcases := []struct {
+		ns       *Namespace
+		parent   *Namespace
+		expected bool
+	}{
+		{foo, RootNamespace, true},
+		{fooBar, RootNamespace, true},
+		{fooBar, foo, true},
+		{foo, fooBar, false},
+		{foo, foo, false},
+		{fooBaz, foo, false},
+		{RootNamespace, RootNamespace, false},
+		{RootNamespace, foo, false},
+	}
+
+	for _, tc := range tcases {
+		if actual := tc.ns.HasParent(tc.parent); actual != tc.expected {
+			t.Fatalf("%q has parent %q: expected %t, got %t", tc.ns.Path, tc.parent.Path, tc.expected, actual)
+		}
+	}
+
+	if !foo.Contains(foo) || !foo.Contains(fooBar) || foo.Contains(fooBaz) || !RootNamespace.Contains(fooBaz) {
+		t.Fatal("unexpected result from Contains")
+	}
+}
+
+func TestNamespace_Canonicalize(t *testing.T) {
+	tcases := map[string]string{
+		"":         "",
+		"/":        "",
+		"foo":      "foo/",
+		"/foo":     "foo/",
+		"foo/":     "foo/",
+		"foo/bar":  "foo/bar/",
+		"/foo/bar": "foo/bar/",
+	}
+
+	for input, expected := range tcases {
+		if actual := Canonicalize(input); actual != expected {
+			t.Fatalf("%q: expected %q, got %q", input, expected, actual)
+		}
+	}
+}
+
+func TestNamespace_FromContext(t *testing.T) {
+	if _, err := FromContext(nil); err == nil {
+		t.Fatal("expected error for nil context")
+	}
+
+	ns, err := FromContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns != RootNamespace {
+		t.Fatalf("expected root namespace, got %#v", ns)
+	}
+
+	foo := &Namespace{ID: "foo", Path: "foo/"}
+	ns, err = FromContext(ContextWithNamespace(context.Background(), foo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns != foo {
+		t.Fatalf("expected foo namespace, got %#v", ns)
+	}
+
+	if foo.TrimmedPath("foo/secret/bar") != "secret/bar" {
+		t.Fatal("unexpected trimmed path")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	sockaddr "github.com/hashicorp/go-sockaddr"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/vault"
@@ -48,6 +49,10 @@ const (
 	// headers. Do not alter the casing of this string.
 	canonicalMFAHeaderName = "X-Vault-Mfa"
 
+	// NamespaceHeaderName is the name of the header containing the path of
+	// the namespace the request is made in. Request paths are relative to it.
+	NamespaceHeaderName = "X-Vault-Namespace"
+
 	// PolicyOverrideHeaderName is the header set to request overriding
 	// soft-mandatory Sentinel policies.
 	PolicyOverrideHeaderName = "X-Vault-Policy-Override"
@@ -65,9 +70,27 @@ var (
 	uiBuiltIn = true
 )
 
+// HandlerOptions holds the settings that may differ between the listeners
+// serving the API.
+type HandlerOptions struct {
+	// UnauthenticatedMetricsAccess allows sys/metrics to be read without a
+	// token
+	UnauthenticatedMetricsAccess bool
+}
+
 // Handler returns an http.Handler for the API. This can be used on
 // its own to mount the Vault API within another web server.
 func Handler(core *vault.Core) http.Handler {
+	return HandlerWithOptions(core, nil)
+}
+
+// HandlerWithOptions returns an http.Handler for the API, adjusted by the
+// given options.
+func HandlerWithOptions(core *vault.Core, opts *HandlerOptions) http.Handler {
+	if opts == nil {
+		opts = &HandlerOptions{}
+	}
+
 	// Create the muxer to handle the actual endpoints
 	mux := http.NewServeMux()
 	mux.Handle("/v1/sys/init", handleSysInit(core))
@@ -77,6 +100,9 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/unseal", handleSysUnseal(core))
 	mux.Handle("/v1/sys/leader", handleSysLeader(core))
 	mux.Handle("/v1/sys/health", handleSysHealth(core))
+	if opts.UnauthenticatedMetricsAccess {
+		mux.Handle("/v1/sys/metrics", handleMetricsUnauthenticated(core))
+	}
 	mux.Handle("/v1/sys/generate-root/attempt", handleRequestForwarding(core, handleSysGenerateRootAttempt(core, vault.GenerateStandardRootTokenStrategy)))
 	mux.Handle("/v1/sys/generate-root/update", handleRequestForwarding(core, handleSysGenerateRootUpdate(core, vault.GenerateStandardRootTokenStrategy)))
 	mux.Handle("/v1/sys/rekey/init", handleRequestForwarding(core, handleSysRekeyInit(core, false)))
@@ -252,6 +278,12 @@ func stripPrefix(prefix, path string) (string, bool) {
 	return path, true
 }
 
+// namespacedPath prefixes the request path with the namespace given in the
+// namespace header, if any, so that the path is rooted at the root namespace
+func namespacedPath(r *http.Request, path string) string {
+	return namespace.Canonicalize(r.Header.Get(NamespaceHeaderName)) + path
+}
+
 func handleUIHeaders(core *vault.Core, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		header := w.Header()
@@ -33,7 +33,7 @@ func handleHelp(core *vault.Core, w http.ResponseWriter, req *http.Request) {
 
 	lreq := requestAuth(core, req, &logical.Request{
 		Operation:  logical.HelpOperation,
-		Path:       path,
+		Path:       namespacedPath(req, path),
 		Connection: getConnection(req),
 	})
 
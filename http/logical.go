@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"strconv"
@@ -27,13 +28,16 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 	if path == "" {
 		return nil, http.StatusNotFound, nil
 	}
+	path = namespacedPath(r, path)
 
 	// Determine the operation
 	var op logical.Operation
 	switch r.Method {
 	case "DELETE":
 		op = logical.DeleteOperation
-	case "GET":
+	case "GET", "HEAD":
+		// HEAD requests are served as reads, the HTTP server discarding the
+		// body of their responses
 		op = logical.ReadOperation
 		// Need to call ParseForm to get query params loaded
 		queryVals := r.URL.Query()
@@ -64,7 +68,17 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 
 	// Parse the request if we can
 	var data map[string]interface{}
-	if op == logical.UpdateOperation {
+	switch {
+	case op == logical.UpdateOperation && r.Header.Get("Content-Type") == "application/ocsp-request":
+		// OCSP requests are DER encoded, and passed on as raw bodies
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestSize))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		data = map[string]interface{}{
+			logical.HTTPRawBody: body,
+		}
+	case op == logical.UpdateOperation:
 		err := parseRequest(r, w, &data)
 		if err == io.EOF {
 			data = nil
@@ -75,13 +89,14 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	// If we are a read operation, try and parse any parameters
-	if op == logical.ReadOperation {
+	// If we are a read or list operation, try and parse any parameters
+	if op == logical.ReadOperation || op == logical.ListOperation {
 		getData := map[string]interface{}{}
 
 		for k, v := range r.URL.Query() {
-			// Skip the help key as this is a reserved parameter
-			if k == "help" {
+			// Skip the help key, and the list key of list operations, as
+			// these are reserved parameters
+			if k == "help" || (op == logical.ListOperation && k == "list") {
 				continue
 			}
 
@@ -291,6 +306,18 @@ func respondRaw(w http.ResponseWriter, r *http.Request, resp *logical.Response)
 	}
 
 	// Write the response
+	if headersRaw, ok := resp.Data[logical.HTTPHeaders]; ok {
+		headers, ok := headersRaw.(map[string][]string)
+		if !ok {
+			retErr(w, "cannot decode headers")
+			return
+		}
+		for k, values := range headers {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
 	if contentType != "" {
 		w.Header().Set("Content-Type", contentType)
 	}
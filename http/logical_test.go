@@ -68,6 +68,57 @@ func TestLogical(t *testing.T) {
 	testResponseStatus(t, resp, 404)
 }
 
+func TestLogical_NamespaceHeader(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/namespaces/ns1", nil)
+	testResponseStatus(t, resp, 200)
+
+	// Mount a backend in the namespace through the header
+	req, err := http.NewRequest("POST", addr+"/v1/sys/mounts/kv", strings.NewReader(`{"type": "kv"}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	req.Header.Set(NamespaceHeaderName, "ns1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testResponseStatus(t, resp, 204)
+
+	// The mount is reachable through the namespace path as well
+	resp = testHttpPut(t, token, addr+"/v1/ns1/kv/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+
+	req, err = http.NewRequest("GET", addr+"/v1/kv/foo", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	req.Header.Set(NamespaceHeaderName, "/ns1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testResponseStatus(t, resp, 200)
+
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	if actual["data"].(map[string]interface{})["data"] != "bar" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Without the header the path belongs to the root namespace
+	resp = testHttpGet(t, token, addr+"/v1/kv/foo")
+	testResponseStatus(t, resp, 404)
+}
+
 func TestLogical_noExist(t *testing.T) {
 	core, _, token := vault.TestCoreUnsealed(t)
 	ln, addr := TestServer(t, core)
@@ -161,6 +212,7 @@ func TestLogical_StandbyRedirect(t *testing.T) {
 			"explicit_max_ttl": json.Number("0"),
 			"expire_time":      nil,
 			"entity_id":        "",
+			"type":             "service",
 		},
 		"warnings":  nilWarnings,
 		"wrap_info": nil,
@@ -211,6 +263,7 @@ func TestLogical_CreateToken(t *testing.T) {
 			"lease_duration": json.Number("0"),
 			"renewable":      false,
 			"entity_id":      "",
+			"token_type":     "service",
 		},
 		"warnings": nilWarnings,
 	}
@@ -334,3 +387,48 @@ func TestLogical_RespondWithStatusCode(t *testing.T) {
 		t.Fatalf("bad response: %s", string(bodyRaw[:]))
 	}
 }
+
+func TestLogical_RespondRawHeaders(t *testing.T) {
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  http.StatusCreated,
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     []byte(`{}`),
+			logical.HTTPHeaders: map[string][]string{
+				"Location": []string{"http://127.0.0.1:8200/v1/foo/bar"},
+				"Link":     []string{"<http://127.0.0.1:8200/v1/foo>;rel=\"up\"", "<http://127.0.0.1:8200/v1/foo/index>;rel=\"index\""},
+			},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	respondLogical(w, nil, nil, false, resp)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Bad Status code: %d", w.Code)
+	}
+	if w.Header().Get("Location") != "http://127.0.0.1:8200/v1/foo/bar" {
+		t.Fatalf("bad: %#v", w.Header())
+	}
+	if len(w.Header()["Link"]) != 2 {
+		t.Fatalf("bad: %#v", w.Header())
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("bad: %#v", w.Header())
+	}
+}
+
+func TestLogical_HeadRequest(t *testing.T) {
+	core, _, _ := vault.TestCoreUnsealed(t)
+	req, _ := http.NewRequest("HEAD", "http://127.0.0.1:8200/v1/secret/foo", nil)
+	lreq, status, err := buildLogicalRequest(core, nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 0 {
+		t.Fatalf("got status %d", status)
+	}
+	if lreq.Operation != logical.ReadOperation {
+		t.Fatalf("bad operation: %s", lreq.Operation)
+	}
+}
@@ -0,0 +1,30 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleMetricsUnauthenticated serves sys/metrics without going through the
+// request handling of the core, so no token is required. It is only used by
+// listeners configured to allow unauthenticated metrics access, and always
+// returns the metrics of the node it was sent to, even when sealed or in
+// standby.
+func handleMetricsUnauthenticated(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		metricsHelper := core.MetricsHelper()
+		if metricsHelper == nil {
+			respondError(w, http.StatusNotFound, errors.New("metrics are not being collected on this node"))
+			return
+		}
+
+		respondRaw(w, r, metricsHelper.ResponseForFormat(r.URL.Query().Get("format")))
+	})
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/vault"
+)
+
+func testMetricsCluster(t *testing.T, opts *HandlerOptions) *vault.TestCluster {
+	inm := metrics.NewInmemSink(10*time.Second, time.Minute)
+	prom := metricsutil.NewPrometheusSink(time.Hour)
+	inm.SetGauge([]string{"vault", "test_gauge"}, 42)
+	prom.SetGauge([]string{"vault", "test_gauge"}, 42)
+
+	cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+		MetricsHelper: metricsutil.NewMetricsHelper(inm, prom),
+	}, &vault.TestClusterOptions{
+		HandlerFunc: func(core *vault.Core) http.Handler {
+			return HandlerWithOptions(core, opts)
+		},
+		NumCores: 1,
+	})
+	cluster.Start()
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+	return cluster
+}
+
+func testMetricsRequest(t *testing.T, client *api.Client, format string) (int, string) {
+	req := client.NewRequest("GET", "/v1/sys/metrics")
+	if format != "" {
+		req.Params.Set("format", format)
+	}
+	resp, err := client.RawRequest(req)
+	if resp == nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestSysMetrics_authenticated(t *testing.T) {
+	cluster := testMetricsCluster(t, nil)
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	code, body := testMetricsRequest(t, client, "")
+	if code != http.StatusOK || !strings.Contains(body, `"vault.test_gauge"`) {
+		t.Fatalf("bad response: %d %s", code, body)
+	}
+
+	code, body = testMetricsRequest(t, client, "prometheus")
+	if code != http.StatusOK || !strings.Contains(body, "vault_test_gauge 42") {
+		t.Fatalf("bad response: %d %s", code, body)
+	}
+
+	// A token is required unless the listener allows otherwise
+	client, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ClearToken()
+	if code, _ := testMetricsRequest(t, client, "prometheus"); code != http.StatusBadRequest {
+		t.Fatalf("expected metrics to require a token, got %d", code)
+	}
+}
+
+func TestSysMetrics_unauthenticated(t *testing.T) {
+	cluster := testMetricsCluster(t, &HandlerOptions{
+		UnauthenticatedMetricsAccess: true,
+	})
+	defer cluster.Cleanup()
+
+	client, err := cluster.Cores[0].Client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ClearToken()
+
+	code, body := testMetricsRequest(t, client, "prometheus")
+	if code != http.StatusOK || !strings.Contains(body, "vault_test_gauge 42") {
+		t.Fatalf("bad response: %d %s", code, body)
+	}
+
+	if code, _ := testMetricsRequest(t, client, "xml"); code != http.StatusBadRequest {
+		t.Fatalf("expected unknown format to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/logging"
+	"github.com/hashicorp/vault/physical/raft"
+	"github.com/hashicorp/vault/vault"
+)
+
+func testRaftBackend(t *testing.T, name string, tlsConf map[string]string) (*raft.RaftBackend, func()) {
+	dir, err := ioutil.TempDir("", "vault-raft-"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := map[string]string{
+		"path":                   dir,
+		"node_id":                name,
+		"address":                "127.0.0.1:0",
+		"performance_multiplier": "1",
+	}
+	for k, v := range tlsConf {
+		conf[k] = v
+	}
+	backend, err := raft.NewRaftBackend(conf, logging.NewVaultLogger(log.Trace).Named(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raftBackend := backend.(*raft.RaftBackend)
+	return raftBackend, func() {
+		raftBackend.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSysRaftJoin(t *testing.T) {
+	tlsConf, cleanup := raft.TestTLSConfig(t)
+	defer cleanup()
+
+	backend1, cleanup1 := testRaftBackend(t, "node1", tlsConf)
+	defer cleanup1()
+	core1, _, token := vault.TestCoreUnsealedBackend(t, backend1)
+	ln, addr := TestServer(t, core1)
+	defer ln.Close()
+
+	backend2, cleanup2 := testRaftBackend(t, "node2", tlsConf)
+	defer cleanup2()
+	core2 := vault.TestCoreWithBackend(t, backend2)
+
+	init, err := core2.Initialized(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if init {
+		t.Fatal("joining core should not be initialized")
+	}
+
+	body := map[string]interface{}{
+		"node_id": "node2",
+		"address": backend2.Address(),
+	}
+
+	// Adding servers requires a sudo capable token
+	resp := testHttpPost(t, "", addr+"/v1/sys/storage/raft/join", body)
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"policies": []string{"default"},
+	})
+	var created map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &created)
+	defaultToken := created["auth"].(map[string]interface{})["client_token"].(string)
+
+	resp = testHttpPost(t, defaultToken, addr+"/v1/sys/storage/raft/join", body)
+	testResponseStatus(t, resp, 403)
+
+	resp = testHttpPost(t, token, addr+"/v1/sys/storage/raft/join", body)
+	testResponseStatus(t, resp, 204)
+
+	// The joined core sees the cluster's data, and so is now initialized
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		init, err = core2.Initialized(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if init {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("joined core never became initialized")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/storage/raft/configuration")
+	var actual map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	servers := actual["data"].(map[string]interface{})["config"].(map[string]interface{})["servers"].([]interface{})
+	if len(servers) != 2 {
+		t.Fatalf("expected 2 servers, got %#v", servers)
+	}
+}
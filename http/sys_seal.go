@@ -124,14 +124,19 @@ func handleSysUnseal(core *vault.Core) http.Handler {
 
 			// Attempt the unseal
 			ctx := context.Background()
-			if core.SealAccess().RecoveryKeySupported() {
+			switch {
+			case req.Migrate:
+				_, err = core.UnsealMigrate(key)
+			case core.SealAccess().RecoveryKeySupported():
 				_, err = core.UnsealWithRecoveryKeys(ctx, key)
-			} else {
+			default:
 				_, err = core.Unseal(key)
 			}
 			if err != nil {
 				switch {
 				case errwrap.ContainsType(err, new(vault.ErrInvalidKey)):
+				case errwrap.Contains(err, vault.ErrSealMigrationRequired.Error()):
+				case errwrap.Contains(err, vault.ErrNotInSealMigration.Error()):
 				case errwrap.Contains(err, vault.ErrBarrierInvalidKey.Error()):
 				case errwrap.Contains(err, vault.ErrBarrierNotInit.Error()):
 				case errwrap.Contains(err, vault.ErrBarrierSealed.Error()):
@@ -170,11 +175,18 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// While migrating, the keys being collected belong to the previous seal
+	sealAccess := core.SealAccess()
+	migrationSealAccess := core.MigrationSealAccess()
+	if migrationSealAccess != nil {
+		sealAccess = migrationSealAccess
+	}
+
 	var sealConfig *vault.SealConfig
-	if core.SealAccess().RecoveryKeySupported() {
-		sealConfig, err = core.SealAccess().RecoveryConfig(ctx)
+	if sealAccess.RecoveryKeySupported() {
+		sealConfig, err = sealAccess.RecoveryConfig(ctx)
 	} else {
-		sealConfig, err = core.SealAccess().BarrierConfig(ctx)
+		sealConfig, err = sealAccess.BarrierConfig(ctx)
 	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err)
@@ -214,6 +226,7 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 		Version:     version.GetVersion().VersionNumber(),
 		ClusterName: clusterName,
 		ClusterID:   clusterID,
+		Migration:   migrationSealAccess != nil,
 	})
 }
 
@@ -227,9 +240,11 @@ type SealStatusResponse struct {
 	Version     string `json:"version"`
 	ClusterName string `json:"cluster_name,omitempty"`
 	ClusterID   string `json:"cluster_id,omitempty"`
+	Migration   bool   `json:"migration"`
 }
 
 type UnsealRequest struct {
-	Key   string
-	Reset bool
+	Key     string
+	Reset   bool
+	Migrate bool
 }
@@ -26,12 +26,13 @@ func TestSysSealStatus(t *testing.T) {
 
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
-		"sealed":   true,
-		"t":        json.Number("3"),
-		"n":        json.Number("3"),
-		"progress": json.Number("0"),
-		"nonce":    "",
-		"type":     "shamir",
+		"sealed":    true,
+		"t":         json.Number("3"),
+		"n":         json.Number("3"),
+		"progress":  json.Number("0"),
+		"nonce":     "",
+		"type":      "shamir",
+		"migration": false,
 	}
 	testResponseStatus(t, resp, 200)
 	testResponseBody(t, resp, &actual)
@@ -115,12 +116,13 @@ func TestSysUnseal(t *testing.T) {
 
 		var actual map[string]interface{}
 		expected := map[string]interface{}{
-			"sealed":   true,
-			"t":        json.Number("3"),
-			"n":        json.Number("3"),
-			"progress": json.Number(fmt.Sprintf("%d", i+1)),
-			"nonce":    "",
-			"type":     "shamir",
+			"sealed":    true,
+			"t":         json.Number("3"),
+			"n":         json.Number("3"),
+			"progress":  json.Number(fmt.Sprintf("%d", i+1)),
+			"nonce":     "",
+			"type":      "shamir",
+			"migration": false,
 		}
 		if i == len(keys)-1 {
 			expected["sealed"] = false
@@ -194,11 +196,12 @@ func TestSysUnseal_Reset(t *testing.T) {
 
 		var actual map[string]interface{}
 		expected := map[string]interface{}{
-			"sealed":   true,
-			"t":        json.Number("3"),
-			"n":        json.Number("5"),
-			"progress": json.Number(strconv.Itoa(i + 1)),
-			"type":     "shamir",
+			"sealed":    true,
+			"t":         json.Number("3"),
+			"n":         json.Number("5"),
+			"progress":  json.Number(strconv.Itoa(i + 1)),
+			"type":      "shamir",
+			"migration": false,
 		}
 		testResponseStatus(t, resp, 200)
 		testResponseBody(t, resp, &actual)
@@ -231,11 +234,12 @@ func TestSysUnseal_Reset(t *testing.T) {
 
 	actual = map[string]interface{}{}
 	expected := map[string]interface{}{
-		"sealed":   true,
-		"t":        json.Number("3"),
-		"n":        json.Number("5"),
-		"progress": json.Number("0"),
-		"type":     "shamir",
+		"sealed":    true,
+		"t":         json.Number("3"),
+		"n":         json.Number("5"),
+		"progress":  json.Number("0"),
+		"type":      "shamir",
+		"migration": false,
 	}
 	testResponseStatus(t, resp, 200)
 	testResponseBody(t, resp, &actual)
@@ -75,6 +75,11 @@ type Auth struct {
 	// The set of CIDRs that this token can be used with
 	BoundCIDRs []*sockaddr.SockAddrMarshaler `json:"bound_cidrs"`
 
+	// TokenType is the type of token the backend would like to be issued.
+	// The auth mount's token_type setting decides whether this is honored;
+	// after login it holds the type of the token that was issued.
+	TokenType TokenType `json:"token_type"`
+
 	// CreationPath is a path that the backend can return to use in the lease.
 	// This is currently only supported for the token store where roles may
 	// change the perceived path of the lease, even though they don't change
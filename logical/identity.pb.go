@@ -82,10 +82,13 @@ type Alias struct {
 	// identity belongs
 	MountAccessor string `protobuf:"bytes,2,opt,name=mount_accessor,json=mountAccessor" json:"mount_accessor,omitempty"`
 	// Name is the identifier of this identity in its authentication source
-	Name                 string   `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Name string `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+	// Metadata represents the metadata associated with the identity in its
+	// authentication source
+	Metadata             map[string]string `protobuf:"bytes,4,rep,name=metadata" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *Alias) Reset()         { *m = Alias{} }
@@ -133,27 +136,38 @@ func (m *Alias) GetName() string {
 	return ""
 }
 
+func (m *Alias) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Entity)(nil), "logical.Entity")
 	proto.RegisterType((*Alias)(nil), "logical.Alias")
+	proto.RegisterMapType((map[string]string)(nil), "logical.Alias.MetadataEntry")
 }
 
 func init() { proto.RegisterFile("logical/identity.proto", fileDescriptor_identity_63bdeae5187a0ba9) }
 
 var fileDescriptor_identity_63bdeae5187a0ba9 = []byte{
-	// 209 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x44, 0xcf, 0x31, 0x6b, 0x85, 0x30,
-	0x14, 0x05, 0x60, 0xd4, 0x56, 0xf1, 0x96, 0x3a, 0x64, 0x28, 0x2e, 0x05, 0x91, 0x16, 0x9c, 0x12,
-	0x68, 0x7f, 0x81, 0xc5, 0x0e, 0xae, 0x52, 0x3a, 0x74, 0x29, 0xd7, 0x34, 0x68, 0x20, 0x9a, 0x60,
-	0x62, 0xc1, 0x7f, 0x5f, 0x9a, 0x97, 0xf7, 0xde, 0x16, 0xbe, 0x03, 0x27, 0xe7, 0xc2, 0x83, 0xd2,
-	0x93, 0xe4, 0xa8, 0x98, 0xfc, 0x11, 0xab, 0x93, 0xee, 0xa0, 0x66, 0xd3, 0x4e, 0x93, 0x2c, 0x78,
-	0xfd, 0x09, 0xe9, 0xbb, 0x0f, 0x48, 0x01, 0x71, 0xdf, 0x95, 0x51, 0x15, 0x35, 0xf9, 0x10, 0xf7,
-	0x1d, 0x21, 0x70, 0xb3, 0xe2, 0x22, 0xca, 0xd8, 0x8b, 0x7f, 0x93, 0x06, 0x32, 0x54, 0x12, 0xad,
-	0xb0, 0x65, 0x52, 0x25, 0xcd, 0xdd, 0x4b, 0x41, 0x43, 0x11, 0x6d, 0xff, 0x7d, 0x38, 0xc7, 0x35,
-	0xc2, 0xad, 0x17, 0xf2, 0x08, 0xb0, 0xe8, 0x7d, 0x75, 0xdf, 0xee, 0x30, 0x22, 0xd4, 0xe7, 0x5e,
-	0x3e, 0x0e, 0x23, 0xc8, 0x33, 0x14, 0xa7, 0x18, 0x39, 0x17, 0xd6, 0xea, 0x2d, 0xfc, 0x77, 0xef,
-	0xb5, 0x0d, 0x78, 0x19, 0x93, 0x5c, 0xc7, 0xbc, 0x3d, 0x7d, 0xd5, 0x93, 0x74, 0xf3, 0x3e, 0x52,
-	0xae, 0x17, 0x36, 0xa3, 0x9d, 0x25, 0xd7, 0x9b, 0x61, 0xbf, 0xb8, 0x2b, 0xc7, 0xc2, 0xae, 0x31,
-	0xf5, 0x07, 0xbf, 0xfe, 0x05, 0x00, 0x00, 0xff, 0xff, 0x53, 0x90, 0x60, 0xf6, 0x0a, 0x01, 0x00,
-	0x00,
+	// 266 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x90, 0xcf, 0x4b, 0xc3, 0x30,
+	0x14, 0x80, 0x69, 0xbb, 0x1f, 0xee, 0xc9, 0x86, 0x04, 0x91, 0x22, 0x0a, 0xa3, 0x28, 0xf4, 0xd4,
+	0x82, 0x5e, 0x86, 0x9e, 0x26, 0xdb, 0x61, 0x07, 0x2f, 0x45, 0x3c, 0x78, 0x91, 0xb7, 0x2c, 0xac,
+	0xc1, 0xb4, 0x29, 0xcd, 0xeb, 0x20, 0xff, 0xa9, 0x7f, 0x8e, 0x2c, 0xcb, 0x86, 0xbb, 0xbd, 0x7e,
+	0x5f, 0x79, 0xf9, 0x12, 0xb8, 0x51, 0x7a, 0x2b, 0x39, 0xaa, 0x5c, 0x6e, 0x44, 0x4d, 0x92, 0x6c,
+	0xd6, 0xb4, 0x9a, 0x34, 0x1b, 0x7a, 0x9e, 0x7c, 0xc2, 0x60, 0xe9, 0x04, 0x9b, 0x40, 0xb8, 0x5a,
+	0xc4, 0xc1, 0x34, 0x48, 0x47, 0x45, 0xb8, 0x5a, 0x30, 0x06, 0xbd, 0x1a, 0x2b, 0x11, 0x87, 0x8e,
+	0xb8, 0x99, 0xa5, 0x30, 0x44, 0x25, 0xd1, 0x08, 0x13, 0x47, 0xd3, 0x28, 0xbd, 0x7c, 0x9a, 0x64,
+	0x7e, 0x51, 0x36, 0xdf, 0xf3, 0xe2, 0xa8, 0x93, 0xdf, 0x00, 0xfa, 0x0e, 0xb1, 0x7b, 0x80, 0x4a,
+	0x77, 0x35, 0x7d, 0x93, 0x6d, 0x84, 0xdf, 0x3f, 0x72, 0xe4, 0xc3, 0x36, 0x82, 0x3d, 0xc2, 0xe4,
+	0xa0, 0x91, 0x73, 0x61, 0x8c, 0x6e, 0xfd, 0x81, 0x63, 0x47, 0xe7, 0x1e, 0x9e, 0x6a, 0xa2, 0x7f,
+	0x35, 0x33, 0xb8, 0xa8, 0x04, 0xe1, 0x06, 0x09, 0xe3, 0x9e, 0xcb, 0xb9, 0x3b, 0xcf, 0xc9, 0xde,
+	0xbd, 0x5e, 0xd6, 0xd4, 0xda, 0xe2, 0xf4, 0xf7, 0xed, 0x2b, 0x8c, 0xcf, 0x14, 0xbb, 0x82, 0xe8,
+	0x47, 0x58, 0x5f, 0xb7, 0x1f, 0xd9, 0x35, 0xf4, 0x77, 0xa8, 0xba, 0xe3, 0xfd, 0x0f, 0x1f, 0x2f,
+	0xe1, 0x2c, 0x78, 0x7b, 0xf8, 0x4a, 0xb6, 0x92, 0xca, 0x6e, 0x9d, 0x71, 0x5d, 0xe5, 0x25, 0x9a,
+	0x52, 0x72, 0xdd, 0x36, 0xf9, 0x0e, 0x3b, 0x45, 0xb9, 0x0f, 0x58, 0x0f, 0xdc, 0x43, 0x3f, 0xff,
+	0x0d, 0x00, 0xa6, 0xbf, 0xb8, 0x97, 0x82, 0x01, 0x00, 0x00,
 }
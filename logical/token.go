@@ -0,0 +1,77 @@
+package logical
+
+import (
+	"fmt"
+)
+
+// TokenType represents the kind of token issued to a client
+type TokenType string
+
+const (
+	// TokenTypeDefault leaves the choice of token type to the next level of
+	// configuration, which ends up issuing a service token
+	TokenTypeDefault TokenType = ""
+
+	// TokenTypeService is a token that is persisted in storage, has an
+	// accessor, and can be renewed and revoked
+	TokenTypeService TokenType = "service"
+
+	// TokenTypeBatch is a token whose contents are encrypted into the token
+	// itself. It is never persisted, cannot be renewed or revoked on its own,
+	// and expires along with its parent.
+	TokenTypeBatch TokenType = "batch"
+
+	// TokenTypeDefaultService issues service tokens unless a batch token is
+	// specifically requested
+	TokenTypeDefaultService TokenType = "default-service"
+
+	// TokenTypeDefaultBatch issues batch tokens unless a service token is
+	// specifically requested
+	TokenTypeDefaultBatch TokenType = "default-batch"
+)
+
+// ParseTokenType parses the string representation of a token type. The
+// string "default" is accepted as an alias for TokenTypeDefault.
+func ParseTokenType(str string) (TokenType, error) {
+	switch TokenType(str) {
+	case TokenTypeDefault, "default":
+		return TokenTypeDefault, nil
+	case TokenTypeService, TokenTypeBatch, TokenTypeDefaultService, TokenTypeDefaultBatch:
+		return TokenType(str), nil
+	default:
+		return TokenTypeDefault, fmt.Errorf("invalid token type %q", str)
+	}
+}
+
+// Resolve returns the token type to issue when t is the configured type and
+// requested is the type asked for by the client or backend, which must be
+// one of TokenTypeDefault, TokenTypeService or TokenTypeBatch. An error is
+// returned if the request conflicts with a configured type that cannot be
+// overridden.
+func (t TokenType) Resolve(requested TokenType) (TokenType, error) {
+	switch requested {
+	case TokenTypeDefault, TokenTypeService, TokenTypeBatch:
+	default:
+		return TokenTypeDefault, fmt.Errorf("invalid requested token type %q", requested)
+	}
+
+	switch t {
+	case TokenTypeService, TokenTypeBatch:
+		if requested != TokenTypeDefault && requested != t {
+			return TokenTypeDefault, fmt.Errorf("requested token type %q conflicts with configured token type %q", requested, t)
+		}
+		return t, nil
+
+	case TokenTypeDefaultBatch:
+		if requested == TokenTypeDefault {
+			return TokenTypeBatch, nil
+		}
+		return requested, nil
+
+	default:
+		if requested == TokenTypeDefault {
+			return TokenTypeService, nil
+		}
+		return requested, nil
+	}
+}
@@ -34,6 +34,7 @@ func LogicalResponseToHTTPResponse(input *Response) *HTTPResponse {
 			LeaseDuration: int(input.Auth.TTL.Seconds()),
 			Renewable:     input.Auth.Renewable,
 			EntityID:      input.Auth.EntityID,
+			TokenType:     string(input.Auth.TokenType),
 		}
 	}
 
@@ -61,6 +62,7 @@ func HTTPResponseToLogicalResponse(input *HTTPResponse) *Response {
 			Policies:    input.Auth.Policies,
 			Metadata:    input.Auth.Metadata,
 			EntityID:    input.Auth.EntityID,
+			TokenType:   TokenType(input.Auth.TokenType),
 		}
 		logicalResp.Auth.Renewable = input.Auth.Renewable
 		logicalResp.Auth.TTL = time.Second * time.Duration(input.Auth.LeaseDuration)
@@ -88,6 +90,7 @@ type HTTPAuth struct {
 	LeaseDuration int               `json:"lease_duration"`
 	Renewable     bool              `json:"renewable"`
 	EntityID      string            `json:"entity_id"`
+	TokenType     string            `json:"token_type"`
 }
 
 type HTTPWrapInfo struct {
@@ -0,0 +1,250 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/vault/physical"
+)
+
+var _ raft.FSM = (*FSM)(nil)
+
+var dataBucketName = []byte("data")
+
+// renameFile replaces the FSM database when a snapshot is restored, and is
+// swapped in tests to make the replacement fail
+var renameFile = os.Rename
+
+// fsmOp is a single storage operation carried in a log entry
+type fsmOp struct {
+	Op    physical.Operation `json:"op"`
+	Key   string             `json:"key"`
+	Value []byte             `json:"value,omitempty"`
+}
+
+// fsmCommand is the payload of a log entry. All of its operations are
+// applied atomically.
+type fsmCommand struct {
+	Ops []*fsmOp `json:"ops"`
+}
+
+// FSM is the state machine that the raft log is applied to. It stores the
+// Vault storage entries in a BoltDB file, so the data survives restarts
+// without replaying the log, and is snapshotted by streaming that file.
+type FSM struct {
+	path string
+
+	// l guards db, which is replaced when a snapshot is restored
+	l  sync.RWMutex
+	db *bolt.DB
+}
+
+// NewFSM opens, or creates, the FSM stored in the given BoltDB file
+func NewFSM(path string) (*FSM, error) {
+	db, err := openFSMDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FSM{
+		path: path,
+		db:   db,
+	}, nil
+}
+
+func openFSMDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to open raft FSM database: {{err}}", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(dataBucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errwrap.Wrapf("failed to initialize raft FSM database: {{err}}", err)
+	}
+	return db, nil
+}
+
+// Close closes the underlying database
+func (f *FSM) Close() error {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	return f.db.Close()
+}
+
+// Get returns the entry stored at the given key
+func (f *FSM) Get(ctx context.Context, key string) (*physical.Entry, error) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	var entry *physical.Entry
+	err := f.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(dataBucketName).Get([]byte(key))
+		if value != nil {
+			// Values are only valid for the life of the transaction
+			entry = &physical.Entry{
+				Key:   key,
+				Value: append([]byte(nil), value...),
+			}
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// List returns the keys directly under the given prefix, with sub-folders
+// suffixed by a slash
+func (f *FSM) List(ctx context.Context, prefix string) ([]string, error) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	var out []string
+	err := f.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(dataBucketName).Cursor()
+		prefixBytes := []byte(prefix)
+		for k, _ := c.Seek(prefixBytes); k != nil && bytes.HasPrefix(k, prefixBytes); k, _ = c.Next() {
+			trimmed := strings.TrimPrefix(string(k), prefix)
+			sep := strings.Index(trimmed, "/")
+			if sep == -1 {
+				out = append(out, trimmed)
+				continue
+			}
+
+			// Keys are sorted, so the entries of a sub-folder are adjacent
+			folder := trimmed[:sep+1]
+			if len(out) == 0 || out[len(out)-1] != folder {
+				out = append(out, folder)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Apply applies a committed log entry, returning an error if it could not
+// be applied
+func (f *FSM) Apply(log *raft.Log) interface{} {
+	if log.Type != raft.LogCommand {
+		return nil
+	}
+
+	var command fsmCommand
+	if err := json.Unmarshal(log.Data, &command); err != nil {
+		return errwrap.Wrapf("failed to decode raft command: {{err}}", err)
+	}
+
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	// A single transaction makes the command all or nothing
+	return f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dataBucketName)
+		for _, op := range command.Ops {
+			var err error
+			switch op.Op {
+			case physical.PutOperation:
+				err = b.Put([]byte(op.Key), op.Value)
+			case physical.DeleteOperation:
+				err = b.Delete([]byte(op.Key))
+			default:
+				err = fmt.Errorf("unsupported raft command operation %q", op.Op)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Snapshot returns a snapshot of the FSM as of the last applied entry. It
+// holds a read transaction, which is consistent while later entries are
+// applied, until the snapshot is released.
+func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	tx, err := f.db.Begin(false)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to start raft FSM snapshot: {{err}}", err)
+	}
+	return &fsmSnapshot{tx: tx}, nil
+}
+
+// Restore replaces the contents of the FSM with the given snapshot, which
+// is streamed to a temporary file before atomically replacing the database.
+// If the database cannot be replaced, the previous one is reopened.
+func (f *FSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	tmpPath := f.path + ".restore"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errwrap.Wrapf("failed to create raft FSM restore file: {{err}}", err)
+	}
+	_, err = io.Copy(tmp, rc)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errwrap.Wrapf("failed to write raft FSM restore file: {{err}}", err)
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if err := f.db.Close(); err != nil {
+		return errwrap.Wrapf("failed to close raft FSM database: {{err}}", err)
+	}
+	renameErr := renameFile(tmpPath, f.path)
+	if renameErr != nil {
+		os.Remove(tmpPath)
+	}
+
+	db, err := openFSMDB(f.path)
+	if err != nil {
+		return err
+	}
+	f.db = db
+
+	if renameErr != nil {
+		return errwrap.Wrapf("failed to replace raft FSM database: {{err}}", renameErr)
+	}
+	return syncDir(f.path)
+}
+
+// fsmSnapshot streams the FSM database as of its read transaction
+type fsmSnapshot struct {
+	tx *bolt.Tx
+}
+
+// Persist writes the database to the sink, which raft streams to disk or to
+// a follower
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := s.tx.WriteTo(sink); err != nil {
+		sink.Cancel()
+		return errwrap.Wrapf("failed to write raft FSM snapshot: {{err}}", err)
+	}
+	return sink.Close()
+}
+
+// Release ends the read transaction
+func (s *fsmSnapshot) Release() {
+	s.tx.Rollback()
+}
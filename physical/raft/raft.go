@@ -0,0 +1,895 @@
+package raft
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+	"github.com/hashicorp/vault/physical"
+)
+
+// Verify RaftBackend satisfies the correct interfaces
+var _ physical.Backend = (*RaftBackend)(nil)
+var _ physical.HABackend = (*RaftBackend)(nil)
+var _ physical.Transactional = (*RaftBackend)(nil)
+var _ physical.Lock = (*RaftLock)(nil)
+
+const (
+	nodeIDFileName = "node-id"
+
+	// raftDBFileName holds the raft log and stable state, and fsmDBFileName
+	// the storage entries
+	raftDBFileName = "raft.db"
+	fsmDBFileName  = "vault.db"
+
+	// snapshotsRetained is the number of snapshots kept on disk
+	snapshotsRetained = 2
+
+	// logCacheSize is the number of recent log entries kept in memory
+	logCacheSize = 512
+
+	// defaultAddress is the address the raft RPC server listens on if none
+	// is configured
+	defaultAddress = "127.0.0.1:8301"
+
+	// defaultApplyTimeout bounds how long a write waits to be committed
+	defaultApplyTimeout = 10 * time.Second
+
+	// defaultSnapshotThreshold is the number of applied entries between
+	// snapshots
+	defaultSnapshotThreshold = 8192
+
+	// defaultTrailingLogs is the number of entries kept in the log after a
+	// snapshot, so that slightly lagging followers need not be sent one
+	defaultTrailingLogs = 10240
+
+	// transportMaxPool and transportTimeout configure the connections
+	// between the servers
+	transportMaxPool = 3
+	transportTimeout = 10 * time.Second
+
+	// maxJoinRequestSize bounds the size of a join request
+	maxJoinRequestSize = 64 * 1024
+
+	// retryJoinInterval is how often a node that is not yet part of a
+	// cluster retries the configured join addresses
+	retryJoinInterval = 5 * time.Second
+
+	// lockRetryMinBackoff and lockRetryMaxBackoff bound the wait of a leader
+	// before it retries recording the value of the lock it is acquiring
+	lockRetryMinBackoff = 100 * time.Millisecond
+	lockRetryMaxBackoff = 5 * time.Second
+)
+
+var (
+	// ErrNotLeader is returned when an operation that must be performed by
+	// the raft leader is attempted on another server
+	ErrNotLeader = raft.ErrNotLeader
+
+	// errJoinDisabled is returned to join requests when no join token is
+	// configured
+	errJoinDisabled = errors.New("joining through the raft address is not enabled on this server")
+
+	// errInvalidJoinToken is returned to join requests carrying the wrong
+	// join token
+	errInvalidJoinToken = errors.New("invalid join token")
+)
+
+// RaftBackend is a physical backend that replicates Vault's data across a
+// cluster of Vault servers using the raft consensus protocol, removing the
+// need for an external storage system. Each server persists the raft log and
+// a full copy of the data in BoltDB files in its data directory. The raft
+// leader is always the active Vault node.
+type RaftBackend struct {
+	logger     log.Logger
+	path       string
+	nodeID     string
+	address    string
+	fsm        *FSM
+	raft       *raft.Raft
+	raftDB     *raftboltdb.BoltStore
+	transport  *raft.NetworkTransport
+	stream     *tlsStreamLayer
+	permitPool *physical.PermitPool
+
+	applyTimeout time.Duration
+	retryJoin    []string
+	joinToken    string
+
+	// leaderL guards isLeader and leaderChangeCh, which is closed and
+	// replaced whenever leadership changes
+	leaderL        sync.Mutex
+	isLeader       bool
+	leaderChangeCh chan struct{}
+
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+}
+
+// RaftServer describes a member of the raft cluster
+type RaftServer struct {
+	NodeID  string `json:"node_id"`
+	Address string `json:"address"`
+	Leader  bool   `json:"leader"`
+}
+
+// RaftConfiguration describes the current membership of the raft cluster
+type RaftConfiguration struct {
+	Index   uint64        `json:"index"`
+	Servers []*RaftServer `json:"servers"`
+}
+
+// joinRequest is sent over the raft address by a server asking to be added
+// to the cluster
+type joinRequest struct {
+	NodeID  string `json:"node_id"`
+	Address string `json:"address"`
+	Token   string `json:"token"`
+}
+
+// joinResponse answers a joinRequest. A follower answers with the address of
+// the leader, to which the request should be sent instead.
+type joinResponse struct {
+	Success       bool   `json:"success"`
+	Error         string `json:"error,omitempty"`
+	LeaderAddress string `json:"leader_address,omitempty"`
+}
+
+// NewRaftBackend constructs a RaftBackend using the given directory
+func NewRaftBackend(conf map[string]string, logger log.Logger) (physical.Backend, error) {
+	path, ok := conf["path"]
+	if !ok {
+		return nil, fmt.Errorf("'path' must be set")
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, errwrap.Wrapf("failed to create raft data directory: {{err}}", err)
+	}
+
+	tlsConfig, err := loadTLSConfig(conf["tls_cert_file"], conf["tls_key_file"], conf["tls_ca_file"], conf["tls_server_name"])
+	if err != nil {
+		return nil, err
+	}
+
+	nodeID, err := loadNodeID(path, conf["node_id"])
+	if err != nil {
+		return nil, err
+	}
+
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(nodeID)
+	raftConfig.Logger = logger.Named("raft")
+	raftConfig.SnapshotThreshold = defaultSnapshotThreshold
+	raftConfig.TrailingLogs = defaultTrailingLogs
+	// The FSM is persistent, so it is already up to date with the snapshots
+	// taken from it
+	raftConfig.NoSnapshotRestoreOnStart = true
+
+	multiplier := 5
+	if raw, ok := conf["performance_multiplier"]; ok {
+		multiplier, err = strconv.Atoi(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing performance_multiplier: {{err}}", err)
+		}
+		if multiplier < 1 || multiplier > 10 {
+			return nil, fmt.Errorf("performance_multiplier must be between 1 and 10")
+		}
+	}
+	raftConfig.HeartbeatTimeout *= time.Duration(multiplier)
+	raftConfig.ElectionTimeout *= time.Duration(multiplier)
+	raftConfig.LeaderLeaseTimeout *= time.Duration(multiplier)
+
+	if raw, ok := conf["snapshot_threshold"]; ok {
+		threshold, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing snapshot_threshold: {{err}}", err)
+		}
+		if threshold < 1 {
+			return nil, fmt.Errorf("snapshot_threshold must be positive")
+		}
+		raftConfig.SnapshotThreshold = threshold
+	}
+	if raw, ok := conf["trailing_logs"]; ok {
+		trailingLogs, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing trailing_logs: {{err}}", err)
+		}
+		raftConfig.TrailingLogs = trailingLogs
+	}
+
+	address, ok := conf["address"]
+	if !ok {
+		address = defaultAddress
+	}
+
+	var retryJoin []string
+	if raw, ok := conf["retry_join"]; ok {
+		for _, addr := range strings.Split(raw, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				retryJoin = append(retryJoin, addr)
+			}
+		}
+	}
+	joinToken := conf["join_token"]
+	if len(retryJoin) > 0 && joinToken == "" {
+		return nil, fmt.Errorf("'join_token' must be set to use 'retry_join'")
+	}
+
+	fsm, err := NewFSM(filepath.Join(path, fsmDBFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	raftDB, err := raftboltdb.NewBoltStore(filepath.Join(path, raftDBFileName))
+	if err != nil {
+		fsm.Close()
+		return nil, errwrap.Wrapf("failed to open raft log: {{err}}", err)
+	}
+	logStore, err := raft.NewLogCache(logCacheSize, raftDB)
+	if err != nil {
+		fsm.Close()
+		raftDB.Close()
+		return nil, err
+	}
+
+	stdLogger := logger.StandardLogger(&log.StandardLoggerOptions{
+		InferLevels: true,
+	})
+	snapshots, err := raft.NewFileSnapshotStoreWithLogger(path, snapshotsRetained, stdLogger)
+	if err != nil {
+		fsm.Close()
+		raftDB.Close()
+		return nil, errwrap.Wrapf("failed to open raft snapshot store: {{err}}", err)
+	}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		fsm.Close()
+		raftDB.Close()
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to listen on raft address %q: {{err}}", address), err)
+	}
+
+	// The advertised address defaults to the listener's address, which also
+	// resolves a configured port of 0
+	advertise, ok := conf["advertise_address"]
+	if !ok {
+		advertise = ln.Addr().String()
+	}
+
+	b := &RaftBackend{
+		logger:         logger,
+		path:           path,
+		nodeID:         nodeID,
+		address:        advertise,
+		fsm:            fsm,
+		raftDB:         raftDB,
+		permitPool:     physical.NewPermitPool(physical.DefaultParallelOperations),
+		applyTimeout:   defaultApplyTimeout,
+		retryJoin:      retryJoin,
+		joinToken:      joinToken,
+		leaderChangeCh: make(chan struct{}),
+		shutdownCh:     make(chan struct{}),
+	}
+
+	b.stream = newTLSStreamLayer(ln, advertise, tlsConfig, logger.Named("transport"))
+	b.stream.handleJoin = b.handleJoin
+	b.transport = raft.NewNetworkTransportWithConfig(&raft.NetworkTransportConfig{
+		Stream:  b.stream,
+		MaxPool: transportMaxPool,
+		Timeout: transportTimeout,
+		Logger:  stdLogger,
+	})
+	go b.stream.serve()
+
+	notifyCh := make(chan bool, 1)
+	raftConfig.NotifyCh = notifyCh
+	go b.monitorLeadership(notifyCh)
+
+	b.raft, err = raft.NewRaft(raftConfig, fsm, logStore, raftDB, snapshots, b.transport)
+	if err != nil {
+		close(b.shutdownCh)
+		b.transport.Close()
+		fsm.Close()
+		raftDB.Close()
+		return nil, errwrap.Wrapf("failed to start raft: {{err}}", err)
+	}
+
+	if len(retryJoin) > 0 && !b.Initialized() {
+		go b.runRetryJoin()
+	}
+
+	return b, nil
+}
+
+// loadNodeID returns the configured node ID, or the one persisted in the
+// data directory, generating and persisting a new one if neither exists
+func loadNodeID(path, configured string) (string, error) {
+	idPath := filepath.Join(path, nodeIDFileName)
+
+	raw, err := ioutil.ReadFile(idPath)
+	switch {
+	case err == nil:
+		existing := strings.TrimSpace(string(raw))
+		if configured != "" && configured != existing {
+			return "", fmt.Errorf("configured node_id %q does not match the node ID %q stored in %q", configured, existing, path)
+		}
+		return existing, nil
+	case !os.IsNotExist(err):
+		return "", errwrap.Wrapf("failed to read raft node ID: {{err}}", err)
+	}
+
+	id := configured
+	if id == "" {
+		id, err = uuid.GenerateUUID()
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := writeFileAtomic(idPath, []byte(id)); err != nil {
+		return "", errwrap.Wrapf("failed to persist raft node ID: {{err}}", err)
+	}
+	return id, nil
+}
+
+// monitorLeadership tracks the leadership notifications of raft
+func (b *RaftBackend) monitorLeadership(notifyCh <-chan bool) {
+	for {
+		select {
+		case isLeader := <-notifyCh:
+			b.setLeader(isLeader)
+		case <-b.shutdownCh:
+			b.setLeader(false)
+			return
+		}
+	}
+}
+
+func (b *RaftBackend) setLeader(isLeader bool) {
+	b.leaderL.Lock()
+	defer b.leaderL.Unlock()
+
+	if b.isLeader != isLeader {
+		b.isLeader = isLeader
+		close(b.leaderChangeCh)
+		b.leaderChangeCh = make(chan struct{})
+	}
+}
+
+// leadership returns whether this server is the leader, and a channel closed
+// on the next change of leadership
+func (b *RaftBackend) leadership() (bool, <-chan struct{}) {
+	b.leaderL.Lock()
+	defer b.leaderL.Unlock()
+
+	return b.isLeader, b.leaderChangeCh
+}
+
+// NodeID returns the ID of this server in the raft cluster
+func (b *RaftBackend) NodeID() string {
+	return b.nodeID
+}
+
+// Address returns the raft address advertised by this server
+func (b *RaftBackend) Address() string {
+	return b.address
+}
+
+// Initialized reports whether this server has been bootstrapped or has
+// joined a cluster
+func (b *RaftBackend) Initialized() bool {
+	future := b.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return false
+	}
+	return len(future.Configuration().Servers) > 0
+}
+
+// Bootstrap forms a new single server cluster from this server if it is
+// not yet part of one, and waits for it to become leader
+func (b *RaftBackend) Bootstrap(ctx context.Context) error {
+	if !b.Initialized() {
+		err := b.raft.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{
+				{
+					Suffrage: raft.Voter,
+					ID:       raft.ServerID(b.nodeID),
+					Address:  raft.ServerAddress(b.address),
+				},
+			},
+		}).Error()
+		if err != nil {
+			return errwrap.Wrapf("failed to bootstrap raft cluster: {{err}}", err)
+		}
+	}
+	return b.waitForLeadership(ctx)
+}
+
+// waitForLeadership blocks until this server is the raft leader
+func (b *RaftBackend) waitForLeadership(ctx context.Context) error {
+	for {
+		isLeader, changeCh := b.leadership()
+		if isLeader {
+			return nil
+		}
+		select {
+		case <-changeCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// AddPeer adds the server with the given ID and raft address to the cluster
+// as a voter. This must be called on the leader; the new server is then sent
+// the cluster's data.
+func (b *RaftBackend) AddPeer(ctx context.Context, nodeID, address string) error {
+	if nodeID == "" || address == "" {
+		return fmt.Errorf("both a node ID and an address are required")
+	}
+	if b.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+	return b.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(address), 0, b.timeout(ctx)).Error()
+}
+
+// Join asks the server listening on the given raft address to add this
+// server to its cluster, authenticating with the configured join token.
+// Requests reaching a follower are redirected to the leader it knows about.
+func (b *RaftBackend) Join(ctx context.Context, leaderAddr string) error {
+	if b.Initialized() {
+		return fmt.Errorf("this server is already part of a raft cluster")
+	}
+
+	req := &joinRequest{
+		NodeID:  b.nodeID,
+		Address: b.address,
+		Token:   b.joinToken,
+	}
+
+	target := leaderAddr
+	for attempt := 0; attempt < 3; attempt++ {
+		resp, err := b.sendJoin(ctx, target, req)
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to join raft cluster at %q: {{err}}", target), err)
+		}
+		if resp.Success {
+			b.logger.Info("joined raft cluster", "leader", target)
+			return nil
+		}
+		if resp.Error != ErrNotLeader.Error() || resp.LeaderAddress == "" || resp.LeaderAddress == target {
+			return fmt.Errorf("failed to join raft cluster at %q: %s", target, resp.Error)
+		}
+		target = resp.LeaderAddress
+	}
+	return fmt.Errorf("failed to join raft cluster at %q: too many redirects", leaderAddr)
+}
+
+// sendJoin sends a join request over a TLS connection to the given address
+func (b *RaftBackend) sendJoin(ctx context.Context, target string, req *joinRequest) (*joinResponse, error) {
+	timeout := b.timeout(ctx)
+	conn, err := b.stream.Dial(raft.ServerAddress(target), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write([]byte{rpcJoin}); err != nil {
+		return nil, err
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+
+	resp := new(joinResponse)
+	if err := json.NewDecoder(io.LimitReader(conn, maxJoinRequestSize)).Decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// handleJoin answers a join request received on the raft address. The
+// connection is already authenticated by the cluster's TLS CA, and the
+// request must also carry the join token.
+func (b *RaftBackend) handleJoin(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(b.applyTimeout + transportTimeout))
+
+	var req joinRequest
+	if err := json.NewDecoder(io.LimitReader(conn, maxJoinRequestSize)).Decode(&req); err != nil {
+		b.logger.Warn("failed to decode raft join request", "remote_address", conn.RemoteAddr(), "error", err)
+		return
+	}
+
+	resp := &joinResponse{}
+	switch {
+	case b.joinToken == "":
+		resp.Error = errJoinDisabled.Error()
+	case subtle.ConstantTimeCompare([]byte(req.Token), []byte(b.joinToken)) != 1:
+		b.logger.Warn("rejected raft join request with an invalid join token", "remote_address", conn.RemoteAddr(), "node_id", req.NodeID)
+		resp.Error = errInvalidJoinToken.Error()
+	case b.raft.State() != raft.Leader:
+		resp.Error = ErrNotLeader.Error()
+		resp.LeaderAddress = string(b.raft.Leader())
+	default:
+		if err := b.AddPeer(context.Background(), req.NodeID, req.Address); err != nil {
+			resp.Error = err.Error()
+		} else {
+			b.logger.Info("added raft peer", "node_id", req.NodeID, "address", req.Address)
+			resp.Success = true
+		}
+	}
+
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// runRetryJoin keeps trying the configured join addresses until this
+// server becomes part of a cluster or is shut down
+func (b *RaftBackend) runRetryJoin() {
+	ticker := time.NewTicker(retryJoinInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, addr := range b.retryJoin {
+			if b.Initialized() {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), b.applyTimeout)
+			err := b.Join(ctx, addr)
+			cancel()
+			if err == nil {
+				return
+			}
+			b.logger.Debug("failed to join raft cluster", "address", addr, "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+// RemovePeer removes the server with the given ID from the cluster. This
+// must be called on the leader.
+func (b *RaftBackend) RemovePeer(ctx context.Context, nodeID string) error {
+	if b.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	future := b.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	servers := future.Configuration().Servers
+	found := false
+	for _, s := range servers {
+		if string(s.ID) == nodeID {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("server %q is not a member of the cluster", nodeID)
+	}
+	if len(servers) == 1 {
+		return fmt.Errorf("cannot remove the last server in the cluster")
+	}
+
+	return b.raft.RemoveServer(raft.ServerID(nodeID), 0, b.timeout(ctx)).Error()
+}
+
+// GetConfiguration returns the current membership of the cluster
+func (b *RaftBackend) GetConfiguration(ctx context.Context) (*RaftConfiguration, error) {
+	future := b.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	leaderAddr := b.raft.Leader()
+
+	config := &RaftConfiguration{
+		Index: future.Index(),
+	}
+	for _, s := range future.Configuration().Servers {
+		config.Servers = append(config.Servers, &RaftServer{
+			NodeID:  string(s.ID),
+			Address: string(s.Address),
+			Leader:  s.Address == leaderAddr,
+		})
+	}
+	return config, nil
+}
+
+// Close shuts down raft and closes the local databases
+func (b *RaftBackend) Close() error {
+	var err error
+	b.shutdownOnce.Do(func() {
+		err = b.raft.Shutdown().Error()
+		b.transport.Close()
+		close(b.shutdownCh)
+		b.raftDB.Close()
+		b.fsm.Close()
+	})
+	return err
+}
+
+// timeout returns how long an operation may wait to be committed, bounded by
+// the deadline of the context
+func (b *RaftBackend) timeout(ctx context.Context) time.Duration {
+	timeout := b.applyTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+	return timeout
+}
+
+// Put is used to insert or update an entry
+func (b *RaftBackend) Put(ctx context.Context, entry *physical.Entry) error {
+	defer metrics.MeasureSince([]string{"raft", "put"}, time.Now())
+
+	return b.applyOps(ctx, []*fsmOp{
+		&fsmOp{
+			Op:    physical.PutOperation,
+			Key:   entry.Key,
+			Value: entry.Value,
+		},
+	})
+}
+
+// Get is used to fetch an entry
+func (b *RaftBackend) Get(ctx context.Context, key string) (*physical.Entry, error) {
+	defer metrics.MeasureSince([]string{"raft", "get"}, time.Now())
+
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	return b.fsm.Get(ctx, key)
+}
+
+// Delete is used to permanently delete an entry
+func (b *RaftBackend) Delete(ctx context.Context, key string) error {
+	defer metrics.MeasureSince([]string{"raft", "delete"}, time.Now())
+
+	return b.applyOps(ctx, []*fsmOp{
+		&fsmOp{
+			Op:  physical.DeleteOperation,
+			Key: key,
+		},
+	})
+}
+
+// List is used to list all the keys under a given prefix, up to the next
+// prefix
+func (b *RaftBackend) List(ctx context.Context, prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"raft", "list"}, time.Now())
+
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	return b.fsm.List(ctx, prefix)
+}
+
+// Transaction applies all the given operations atomically as a single log
+// entry
+func (b *RaftBackend) Transaction(ctx context.Context, txns []*physical.TxnEntry) error {
+	defer metrics.MeasureSince([]string{"raft", "transaction"}, time.Now())
+
+	ops := make([]*fsmOp, 0, len(txns))
+	for _, txn := range txns {
+		op := &fsmOp{
+			Op:  txn.Operation,
+			Key: txn.Entry.Key,
+		}
+		switch txn.Operation {
+		case physical.PutOperation:
+			op.Value = txn.Entry.Value
+		case physical.DeleteOperation:
+		default:
+			return fmt.Errorf("%q is not a supported transaction operation", txn.Operation)
+		}
+		ops = append(ops, op)
+	}
+
+	return b.applyOps(ctx, ops)
+}
+
+// applyOps commits the operations through the raft log and waits for them
+// to be applied locally
+func (b *RaftBackend) applyOps(ctx context.Context, ops []*fsmOp) error {
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	if b.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	data, err := json.Marshal(&fsmCommand{Ops: ops})
+	if err != nil {
+		return err
+	}
+
+	future := b.raft.Apply(data, b.timeout(ctx))
+	if err := future.Error(); err != nil {
+		return err
+	}
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+// Currently always returns true.
+func (b *RaftBackend) HAEnabled() bool {
+	return true
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (b *RaftBackend) LockWith(key, value string) (physical.Lock, error) {
+	return &RaftLock{
+		key:   key,
+		value: value,
+		b:     b,
+	}, nil
+}
+
+// RaftLock implements a physical lock on top of raft leadership: only the
+// raft leader can hold it, and it is lost as soon as leadership is.
+type RaftLock struct {
+	key   string
+	value string
+	b     *RaftBackend
+
+	l      sync.Mutex
+	held   bool
+	stopCh chan struct{}
+}
+
+// Lock blocks until this server is the raft leader, then records the lock
+// value in storage so other servers can find the holder. Since the write is
+// committed after every earlier entry, the local data is then up to date.
+// Failed writes are retried with backoff for as long as this server leads.
+func (l *RaftLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	var backoff time.Duration
+	for {
+		var retryCh <-chan time.Time
+		isLeader, changeCh := l.b.leadership()
+		if isLeader {
+			err := l.b.Put(context.Background(), &physical.Entry{
+				Key:   l.key,
+				Value: []byte(l.value),
+			})
+			if err == nil {
+				l.held = true
+				l.stopCh = make(chan struct{})
+				leaderCh := make(chan struct{})
+				go l.monitor(changeCh, l.stopCh, leaderCh)
+				return leaderCh, nil
+			}
+
+			switch {
+			case backoff == 0:
+				backoff = lockRetryMinBackoff
+			case backoff < lockRetryMaxBackoff:
+				backoff *= 2
+				if backoff > lockRetryMaxBackoff {
+					backoff = lockRetryMaxBackoff
+				}
+			}
+			l.b.logger.Warn("failed to record lock value, retrying", "key", l.key, "backoff", backoff, "error", err)
+			retryCh = time.After(backoff)
+		}
+
+		select {
+		case <-changeCh:
+			backoff = 0
+		case <-retryCh:
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+}
+
+// monitor closes leaderCh once leadership is lost or the lock is released
+func (l *RaftLock) monitor(changeCh, stopCh <-chan struct{}, leaderCh chan struct{}) {
+	select {
+	case <-changeCh:
+	case <-stopCh:
+	}
+	close(leaderCh)
+}
+
+// Unlock releases the lock. Since holding the lock is tied to raft
+// leadership, a leader that unlocks also transfers leadership so that
+// another server can take over.
+func (l *RaftLock) Unlock() error {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if !l.held {
+		return nil
+	}
+	close(l.stopCh)
+	l.held = false
+
+	var err error
+	if isLeader, _ := l.b.leadership(); isLeader {
+		err = l.b.Delete(context.Background(), l.key)
+		if transferErr := l.b.raft.LeadershipTransfer().Error(); transferErr != nil {
+			l.b.logger.Debug("failed to transfer raft leadership", "error", transferErr)
+		}
+	}
+	return err
+}
+
+// Value returns the value of the lock and whether it is held
+func (l *RaftLock) Value() (bool, string, error) {
+	entry, err := l.b.fsm.Get(context.Background(), l.key)
+	if err != nil {
+		return false, "", err
+	}
+	if entry == nil {
+		return false, "", nil
+	}
+	return true, string(entry.Value), nil
+}
+
+// writeFileAtomic durably replaces the file at the given path
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(path)
+}
+
+// syncDir flushes the directory holding the given file, making a rename
+// into it durable
+func syncDir(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,639 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/vault/helper/logging"
+	"github.com/hashicorp/vault/physical"
+)
+
+const testJoinToken = "join-token"
+
+// testTLS holds the TLS configuration shared by the servers of the tests
+var testTLS map[string]string
+
+func TestMain(m *testing.M) {
+	var cleanup func()
+	testTLS, cleanup = TestTLSConfig(&testingT{})
+	code := m.Run()
+	cleanup()
+	os.Exit(code)
+}
+
+// testingT fails hard outside of a test
+type testingT struct {
+	testing.TB
+}
+
+func (t *testingT) Fatal(args ...interface{}) {
+	panic(fmt.Sprint(args...))
+}
+
+func getRaft(t testing.TB, name string, extra map[string]string) (*RaftBackend, string) {
+	dir, err := ioutil.TempDir("", "vault-raft-"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return getRaftWithDir(t, dir, name, extra), dir
+}
+
+func getRaftWithDir(t testing.TB, dir, name string, extra map[string]string) *RaftBackend {
+	conf := map[string]string{
+		"path":                   dir,
+		"node_id":                name,
+		"address":                "127.0.0.1:0",
+		"performance_multiplier": "1",
+		"join_token":             testJoinToken,
+	}
+	for k, v := range testTLS {
+		conf[k] = v
+	}
+	for k, v := range extra {
+		conf[k] = v
+	}
+
+	logger := logging.NewVaultLogger(log.Debug).Named(name)
+	b, err := NewRaftBackend(conf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*RaftBackend)
+}
+
+func bootstrap(t testing.TB, b *RaftBackend) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := b.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addPeer adds b to the cluster led by leader, as the join endpoint does
+func addPeer(t testing.TB, b *RaftBackend, leader *RaftBackend) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := leader.AddPeer(ctx, b.NodeID(), b.Address()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, b.NodeID()+" to receive the configuration", b.Initialized)
+}
+
+// waitFor polls the condition until it holds or the deadline passes
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func waitForLeader(t testing.TB, backends ...*RaftBackend) *RaftBackend {
+	t.Helper()
+	var leader *RaftBackend
+	waitFor(t, "leader election", func() bool {
+		for _, b := range backends {
+			if isLeader, _ := b.leadership(); isLeader {
+				leader = b
+				return true
+			}
+		}
+		return false
+	})
+	return leader
+}
+
+func waitForValue(t testing.TB, b *RaftBackend, key, value string) {
+	t.Helper()
+	waitFor(t, fmt.Sprintf("%q on %s", key, b.NodeID()), func() bool {
+		entry, err := b.Get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry != nil && string(entry.Value) == value
+	})
+}
+
+func TestRaft_Backend(t *testing.T) {
+	b, dir := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir)
+	defer b.Close()
+
+	bootstrap(t, b)
+
+	physical.ExerciseBackend(t, b)
+	physical.ExerciseBackend_ListPrefix(t, b)
+}
+
+func TestRaft_TransactionalBackend(t *testing.T) {
+	b, dir := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir)
+	defer b.Close()
+
+	bootstrap(t, b)
+
+	physical.ExerciseTransactionalBackend(t, b)
+}
+
+func TestRaft_NotLeader(t *testing.T) {
+	b, dir := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir)
+	defer b.Close()
+
+	if b.Initialized() {
+		t.Fatal("expected uninitialized node")
+	}
+
+	err := b.Put(context.Background(), &physical.Entry{Key: "foo", Value: []byte("bar")})
+	if err != ErrNotLeader {
+		t.Fatalf("expected not leader error, got %v", err)
+	}
+}
+
+func TestRaft_Cluster(t *testing.T) {
+	b1, dir1 := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir1)
+	defer b1.Close()
+	bootstrap(t, b1)
+
+	b2, dir2 := getRaft(t, "node2", nil)
+	defer os.RemoveAll(dir2)
+	defer b2.Close()
+	addPeer(t, b2, b1)
+
+	// The third node forms the cluster purely from its configuration, first
+	// reaching a follower which redirects it to the leader
+	b3, dir3 := getRaft(t, "node3", map[string]string{
+		"retry_join": b2.Address() + "," + b1.Address(),
+	})
+	defer os.RemoveAll(dir3)
+	defer b3.Close()
+	waitFor(t, "node3 to join", b3.Initialized)
+
+	err := b1.Put(context.Background(), &physical.Entry{Key: "foo", Value: []byte("bar")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForValue(t, b2, "foo", "bar")
+	waitForValue(t, b3, "foo", "bar")
+
+	config, err := b3.GetConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Servers) != 3 {
+		t.Fatalf("expected 3 servers, got %#v", config.Servers)
+	}
+	for _, s := range config.Servers {
+		if s.Leader != (s.NodeID == "node1") {
+			t.Fatalf("unexpected leader flag on %#v", s)
+		}
+	}
+
+	// Writes on followers are rejected
+	err = b2.Put(context.Background(), &physical.Entry{Key: "foo", Value: []byte("baz")})
+	if err != ErrNotLeader {
+		t.Fatalf("expected not leader error, got %v", err)
+	}
+
+	// Losing the leader elects a new one that still has the data
+	b1.Close()
+	leader := waitForLeader(t, b2, b3)
+	err = leader.Put(context.Background(), &physical.Entry{Key: "zip", Value: []byte("zap")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForValue(t, b2, "foo", "bar")
+	waitForValue(t, b2, "zip", "zap")
+	waitForValue(t, b3, "zip", "zap")
+}
+
+func TestRaft_JoinAuthentication(t *testing.T) {
+	b1, dir1 := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir1)
+	defer b1.Close()
+	bootstrap(t, b1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A wrong join token is rejected
+	b2, dir2 := getRaft(t, "node2", map[string]string{
+		"join_token": "wrong",
+	})
+	defer os.RemoveAll(dir2)
+	defer b2.Close()
+	err := b2.Join(ctx, b1.Address())
+	if err == nil || !strings.Contains(err.Error(), errInvalidJoinToken.Error()) {
+		t.Fatalf("expected invalid join token error, got %v", err)
+	}
+
+	// So is a server whose certificate is not signed by the cluster's CA,
+	// even with the right token
+	otherTLS, cleanup := TestTLSConfig(t)
+	defer cleanup()
+	b3, dir3 := getRaft(t, "node3", otherTLS)
+	defer os.RemoveAll(dir3)
+	defer b3.Close()
+	if err := b3.Join(ctx, b1.Address()); err == nil {
+		t.Fatal("expected error joining with an untrusted certificate")
+	}
+
+	// Plaintext connections get nothing out of the raft address
+	conn, err := net.Dial("tcp", b1.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte{rpcJoin, '{', '}', '\n'})
+	resp, _ := ioutil.ReadAll(conn)
+	conn.Close()
+	// Anything read back is the TLS alert failing the handshake
+	if len(resp) > 0 && resp[0] != 0x15 {
+		t.Fatalf("plaintext connection was answered: %q", resp)
+	}
+
+	config, err := b1.GetConfiguration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Servers) != 1 {
+		t.Fatalf("expected a single server, got %#v", config.Servers)
+	}
+
+	// Servers without a join token do not accept join requests at all
+	b4, dir4 := getRaft(t, "node4", map[string]string{
+		"join_token": "",
+	})
+	defer os.RemoveAll(dir4)
+	defer b4.Close()
+	bootstrap(t, b4)
+	b5, dir5 := getRaft(t, "node5", nil)
+	defer os.RemoveAll(dir5)
+	defer b5.Close()
+	err = b5.Join(ctx, b4.Address())
+	if err == nil || !strings.Contains(err.Error(), errJoinDisabled.Error()) {
+		t.Fatalf("expected join disabled error, got %v", err)
+	}
+
+	// A joined server cannot join again
+	if err := b1.Join(ctx, b4.Address()); err == nil {
+		t.Fatal("expected error joining from a server already in a cluster")
+	}
+}
+
+func TestRaft_RequiresTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewRaftBackend(map[string]string{
+		"path":    dir,
+		"address": "127.0.0.1:0",
+	}, logging.NewVaultLogger(log.Debug))
+	if err == nil {
+		t.Fatal("expected error without TLS configuration")
+	}
+}
+
+func TestRaft_RemovePeer(t *testing.T) {
+	b1, dir1 := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir1)
+	defer b1.Close()
+	bootstrap(t, b1)
+
+	b2, dir2 := getRaft(t, "node2", nil)
+	defer os.RemoveAll(dir2)
+	defer b2.Close()
+	addPeer(t, b2, b1)
+
+	b3, dir3 := getRaft(t, "node3", nil)
+	defer os.RemoveAll(dir3)
+	defer b3.Close()
+	addPeer(t, b3, b1)
+
+	ctx := context.Background()
+	if err := b2.RemovePeer(ctx, "node3"); err != ErrNotLeader {
+		t.Fatalf("expected not leader error, got %v", err)
+	}
+	if err := b1.RemovePeer(ctx, "node4"); err == nil {
+		t.Fatal("expected error removing unknown server")
+	}
+	if err := b1.RemovePeer(ctx, "node3"); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := b1.GetConfiguration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Servers) != 2 {
+		t.Fatalf("expected 2 servers, got %#v", config.Servers)
+	}
+
+	// The cluster keeps committing writes without the removed server
+	b3.Close()
+	if err := b1.Put(ctx, &physical.Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	waitForValue(t, b2, "foo", "bar")
+}
+
+func TestRaft_HABackend(t *testing.T) {
+	b1, dir1 := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir1)
+	defer b1.Close()
+	bootstrap(t, b1)
+
+	b2, dir2 := getRaft(t, "node2", nil)
+	defer os.RemoveAll(dir2)
+	defer b2.Close()
+	addPeer(t, b2, b1)
+
+	b3, dir3 := getRaft(t, "node3", nil)
+	defer os.RemoveAll(dir3)
+	defer b3.Close()
+	addPeer(t, b3, b1)
+
+	lock, err := b1.LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaderCh == nil {
+		t.Fatal("missing leaderCh")
+	}
+
+	// A follower cannot acquire the lock and sees the holder's value
+	lock2, err := b2.LockWith("core/lock", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() {
+		close(stopCh)
+	})
+	leaderCh2, err := lock2.Lock(stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaderCh2 != nil {
+		t.Fatal("follower should not have acquired the lock")
+	}
+	waitFor(t, "lock value to replicate", func() bool {
+		held, val, err := lock2.Value()
+		return err == nil && held && val == "bar"
+	})
+
+	// Losing leadership releases the lock and another server acquires it
+	b1.Close()
+	select {
+	case <-leaderCh:
+	case <-time.After(15 * time.Second):
+		t.Fatal("leaderCh not closed after shutdown")
+	}
+
+	acquired := make(chan struct{})
+	for _, b := range []*RaftBackend{b2, b3} {
+		go func(b *RaftBackend) {
+			l, _ := b.LockWith("core/lock", b.NodeID())
+			if ch, err := l.Lock(acquired); err == nil && ch != nil {
+				close(acquired)
+			}
+		}(b)
+	}
+	select {
+	case <-acquired:
+	case <-time.After(15 * time.Second):
+		t.Fatal("lock was not acquired after failover")
+	}
+
+	leader := waitForLeader(t, b2, b3)
+	waitFor(t, "new lock value", func() bool {
+		_, val, err := lock2.Value()
+		return err == nil && val == leader.NodeID()
+	})
+}
+
+func TestRaft_Restart(t *testing.T) {
+	b, dir := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir)
+	bootstrap(t, b)
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		err := b.Put(ctx, &physical.Entry{Key: fmt.Sprintf("key%d", i), Value: []byte("value")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Delete(ctx, "key0"); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	b = getRaftWithDir(t, dir, "node1", nil)
+	defer b.Close()
+
+	// Committed entries are readable before a leader is elected
+	entry, err := b.Get(ctx, "key9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || string(entry.Value) != "value" {
+		t.Fatalf("bad entry after restart: %#v", entry)
+	}
+	entry, err = b.Get(ctx, "key0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatalf("deleted entry present after restart: %#v", entry)
+	}
+
+	if !b.Initialized() {
+		t.Fatal("expected node to remember its configuration")
+	}
+	waitForLeader(t, b)
+	if err := b.Put(ctx, &physical.Entry{Key: "key10", Value: []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRaft_Snapshot(t *testing.T) {
+	extra := map[string]string{
+		"snapshot_threshold": "5",
+		"trailing_logs":      "2",
+	}
+
+	b1, dir1 := getRaft(t, "node1", extra)
+	defer os.RemoveAll(dir1)
+	defer b1.Close()
+	bootstrap(t, b1)
+
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		err := b1.Put(ctx, &physical.Entry{Key: fmt.Sprintf("key%d", i), Value: []byte("value")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b1.raft.Snapshot().Error(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := b1.raftDB.FirstIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first <= 1 {
+		t.Fatalf("log not compacted after snapshot, first index %d", first)
+	}
+
+	// A new server must be caught up from the snapshot, streamed by the
+	// leader, since the log no longer starts at the beginning
+	b2, dir2 := getRaft(t, "node2", extra)
+	defer os.RemoveAll(dir2)
+	defer b2.Close()
+	addPeer(t, b2, b1)
+
+	waitForValue(t, b2, "key0", "value")
+	waitForValue(t, b2, "key19", "value")
+
+	// Restarting keeps both data and membership
+	b2.Close()
+	b2 = getRaftWithDir(t, dir2, "node2", extra)
+	defer b2.Close()
+	waitForValue(t, b2, "key0", "value")
+
+	config, err := b2.GetConfiguration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Servers) != 2 {
+		t.Fatalf("expected 2 servers, got %#v", config.Servers)
+	}
+}
+
+func TestRaft_NodeIDMismatch(t *testing.T) {
+	b, dir := getRaft(t, "node1", nil)
+	defer os.RemoveAll(dir)
+	b.Close()
+
+	conf := map[string]string{
+		"path":    dir,
+		"node_id": "node2",
+		"address": "127.0.0.1:0",
+	}
+	for k, v := range testTLS {
+		conf[k] = v
+	}
+	_, err := NewRaftBackend(conf, logging.NewVaultLogger(log.Debug))
+	if err == nil {
+		t.Fatal("expected error for mismatched node ID")
+	}
+}
+
+func TestRaft_FSMRestoreRenameFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-raft-fsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	put := func(fsm *FSM, key, value string) {
+		data, err := json.Marshal(&fsmCommand{
+			Ops: []*fsmOp{{Op: physical.PutOperation, Key: key, Value: []byte(value)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err, ok := fsm.Apply(&raft.Log{Type: raft.LogCommand, Data: data}).(error); ok && err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(fsm *FSM, key string) string {
+		entry, err := fsm.Get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			return ""
+		}
+		return string(entry.Value)
+	}
+
+	// The snapshot to restore is the database of another FSM
+	source, err := NewFSM(filepath.Join(dir, "source.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(source, "foo", "restored")
+	if err := source.Close(); err != nil {
+		t.Fatal(err)
+	}
+	restore := func(fsm *FSM) error {
+		f, err := os.Open(filepath.Join(dir, "source.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fsm.Restore(f)
+	}
+
+	fsm, err := NewFSM(filepath.Join(dir, "fsm.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsm.Close()
+	put(fsm, "foo", "previous")
+
+	// A failed replacement leaves the previous database usable
+	renameFile = func(string, string) error {
+		return fmt.Errorf("rename failed")
+	}
+	err = restore(fsm)
+	renameFile = os.Rename
+	if err == nil {
+		t.Fatal("expected restore to fail")
+	}
+	if value := get(fsm, "foo"); value != "previous" {
+		t.Fatalf("bad: value after failed restore: %q", value)
+	}
+	put(fsm, "bar", "applied")
+	if value := get(fsm, "bar"); value != "applied" {
+		t.Fatalf("bad: value applied after failed restore: %q", value)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fsm.db.restore")); !os.IsNotExist(err) {
+		t.Fatalf("expected restore file to be removed, got: %v", err)
+	}
+
+	if err := restore(fsm); err != nil {
+		t.Fatal(err)
+	}
+	if value := get(fsm, "foo"); value != "restored" {
+		t.Fatalf("bad: value after restore: %q", value)
+	}
+	if value := get(fsm, "bar"); value != "" {
+		t.Fatalf("bad: value not in the snapshot after restore: %q", value)
+	}
+}
@@ -0,0 +1,205 @@
+package raft
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// rpcJoin is the first byte of connections carrying a join request. The
+	// raft RPCs use the bytes from 0 upwards.
+	rpcJoin byte = 0x80
+
+	// handshakeTimeout bounds the TLS handshake and the read of the first
+	// byte of incoming connections
+	handshakeTimeout = 10 * time.Second
+)
+
+var errStreamLayerClosed = errors.New("raft stream layer is closed")
+
+// loadTLSConfig builds the mutually authenticated TLS configuration used
+// between the servers of the cluster: every server presents its certificate
+// and only accepts peers whose certificate chains to the cluster's CA.
+func loadTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" || caFile == "" {
+		return nil, fmt.Errorf("'tls_cert_file', 'tls_key_file' and 'tls_ca_file' must be set")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to load raft TLS certificate: {{err}}", err)
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read raft TLS CA file: {{err}}", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in raft TLS CA file %q", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// tlsStreamLayer implements raft.StreamLayer over mutually authenticated TLS.
+// Connections starting with rpcJoin are handed to the join handler instead
+// of raft.
+type tlsStreamLayer struct {
+	logger    log.Logger
+	listener  net.Listener
+	advertise net.Addr
+	tlsConfig *tls.Config
+
+	handleJoin func(conn net.Conn)
+
+	connCh    chan net.Conn
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func newTLSStreamLayer(ln net.Listener, advertise string, tlsConfig *tls.Config, logger log.Logger) *tlsStreamLayer {
+	return &tlsStreamLayer{
+		logger:    logger,
+		listener:  ln,
+		advertise: advertiseAddr(advertise),
+		tlsConfig: tlsConfig,
+		connCh:    make(chan net.Conn),
+		closeCh:   make(chan struct{}),
+	}
+}
+
+// serve accepts connections until the stream layer is closed
+func (s *tlsStreamLayer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closeCh:
+				return
+			default:
+			}
+			s.logger.Error("failed to accept raft connection", "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn completes the TLS handshake of an incoming connection, which
+// requires a client certificate signed by the cluster's CA, and dispatches it
+// according to its first byte
+func (s *tlsStreamLayer) handleConn(raw net.Conn) {
+	conn := tls.Server(raw, s.tlsConfig)
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		s.logger.Warn("rejected raft connection", "remote_address", raw.RemoteAddr(), "error", err)
+		conn.Close()
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	first, err := r.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	peeked := &peekedConn{Conn: conn, r: r}
+	if first[0] == rpcJoin && s.handleJoin != nil {
+		r.Discard(1)
+		s.handleJoin(peeked)
+		return
+	}
+
+	select {
+	case s.connCh <- peeked:
+	case <-s.closeCh:
+		conn.Close()
+	}
+}
+
+// Accept returns the next raft connection
+func (s *tlsStreamLayer) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.connCh:
+		return conn, nil
+	case <-s.closeCh:
+		return nil, errStreamLayerClosed
+	}
+}
+
+// Close stops accepting connections
+func (s *tlsStreamLayer) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+		err = s.listener.Close()
+	})
+	return err
+}
+
+// Addr returns the address advertised to the other servers
+func (s *tlsStreamLayer) Addr() net.Addr {
+	return s.advertise
+}
+
+// Dial opens a TLS connection to another server, verifying its certificate
+// against the cluster's CA
+func (s *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	config := s.tlsConfig.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(string(address))
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), config)
+}
+
+// peekedConn is a connection whose first bytes were buffered while
+// dispatching it
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// advertiseAddr is the address of this server as given to the other servers,
+// which may be a host name
+type advertiseAddr string
+
+func (a advertiseAddr) Network() string {
+	return "tcp"
+}
+
+func (a advertiseAddr) String() string {
+	return string(a)
+}
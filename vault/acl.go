@@ -10,6 +10,7 @@ import (
 	"github.com/hashicorp/errwrap"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/mitchellh/copystructure"
@@ -48,7 +49,17 @@ type ACLResults struct {
 }
 
 // New is used to construct a policy based ACL from a set of policies.
+// Templated path rules are dropped since there is no identity to resolve
+// them against.
 func NewACL(policies []*Policy) (*ACL, error) {
+	return NewACLWithIdentity(policies, nil, nil)
+}
+
+// NewACLWithIdentity is used to construct a policy based ACL from a set of
+// policies, resolving any templated path rules against the given entity and
+// the groups it belongs to. Rules whose templates can't be resolved are
+// dropped.
+func NewACLWithIdentity(policies []*Policy, entity *identity.Entity, groups []*identity.Group) (*ACL, error) {
 	// Initialize
 	a := &ACL{
 		exactRules: radix.New(),
@@ -69,6 +80,25 @@ func NewACL(policies []*Policy) (*ACL, error) {
 			return nil, fmt.Errorf("unable to parse policy (wrong type)")
 		}
 
+		// Path rules are relative to the namespace of the policy
+		ns := policy.namespace
+		if ns == nil {
+			ns = namespace.RootNamespace
+		}
+
+		// Policies are shared through the policy store cache, so the
+		// templated version is parsed into a new object
+		if policy.Templated {
+			name := policy.Name
+			var err error
+			policy, err = parseACLPolicyWithTemplating(policy.Raw, true, entity, groups)
+			if err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("error parsing templated policy %q: {{err}}", name), err)
+			}
+			policy.Name = name
+			policy.namespace = ns
+		}
+
 		// Check if this is root
 		if policy.Name == "root" {
 			a.root = true
@@ -79,15 +109,16 @@ func NewACL(policies []*Policy) (*ACL, error) {
 			if pc.Glob {
 				tree = a.globRules
 			}
+			prefix := ns.Path + pc.Prefix
 
 			// Check for an existing policy
-			raw, ok := tree.Get(pc.Prefix)
+			raw, ok := tree.Get(prefix)
 			if !ok {
 				clonedPerms, err := pc.Permissions.Clone()
 				if err != nil {
 					return nil, errwrap.Wrapf("error cloning ACL permissions: {{err}}", err)
 				}
-				tree.Insert(pc.Prefix, clonedPerms)
+				tree.Insert(prefix, clonedPerms)
 				continue
 			}
 
@@ -192,7 +223,7 @@ func NewACL(policies []*Policy) (*ACL, error) {
 			}
 
 		INSERT:
-			tree.Insert(pc.Prefix, existingPerms)
+			tree.Insert(prefix, existingPerms)
 		}
 	}
 	return a, nil
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -451,6 +452,110 @@ func TestACL_CreationRace(t *testing.T) {
 	wg.Wait()
 }
 
+func TestACL_Templated(t *testing.T) {
+	policy, err := ParseACLPolicy(templatedPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entity := &identity.Entity{
+		ID:       "entity-id",
+		Name:     "entity-name",
+		Metadata: map[string]string{"team": "blue"},
+		Aliases: []*identity.Alias{
+			&identity.Alias{
+				MountAccessor: "auth_userpass_1234",
+				Name:          "jdoe",
+			},
+		},
+	}
+	groups := []*identity.Group{
+		&identity.Group{
+			ID:   "group-id",
+			Name: "ops",
+		},
+	}
+
+	acl, err := NewACLWithIdentity([]*Policy{policy}, entity, groups)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		path         string
+		capabilities []string
+	}
+	tcases := []tcase{
+		{"secret/teams/blue/app", []string{"read"}},
+		{"secret/teams/red/app", []string{"deny"}},
+		{"secret/entities/entity-id", []string{"update"}},
+		{"secret/users/jdoe/creds", []string{"list"}},
+		{"secret/groups/group-id", []string{"create"}},
+		{"secret/static", []string{"read"}},
+	}
+	for _, tc := range tcases {
+		actual := acl.Capabilities(tc.path)
+		if !reflect.DeepEqual(actual, tc.capabilities) {
+			t.Fatalf("bad: path:%s\ngot\n%#v\nexpected\n%#v\n", tc.path, actual, tc.capabilities)
+		}
+	}
+
+	// The cached policy object must not have been modified by templating
+	if len(policy.Paths) != 6 || policy.Paths[0].Prefix != "secret/teams/{{identity.entity.metadata.team}}/" {
+		t.Fatalf("templating modified the parsed policy: %#v", policy.Paths[0])
+	}
+
+	// Without the metadata, group membership or an entity at all, the
+	// templated rules are dropped instead of failing
+	entity.Metadata = nil
+	acl, err = NewACLWithIdentity([]*Policy{policy}, entity, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if actual := acl.Capabilities("secret/teams/blue/app"); !reflect.DeepEqual(actual, []string{"deny"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual := acl.Capabilities("secret/entities/entity-id"); !reflect.DeepEqual(actual, []string{"update"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual := acl.Capabilities("secret/groups/group-id"); !reflect.DeepEqual(actual, []string{"deny"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	acl, err = NewACL([]*Policy{policy})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if actual := acl.Capabilities("secret/static"); !reflect.DeepEqual(actual, []string{"read"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual := acl.Capabilities("secret/entities/"); !reflect.DeepEqual(actual, []string{"deny"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+var templatedPolicy = `
+name = "templated"
+path "secret/teams/{{identity.entity.metadata.team}}/*" {
+	capabilities = ["read"]
+}
+path "secret/entities/{{identity.entity.id}}" {
+	capabilities = ["update"]
+}
+path "secret/users/{{identity.entity.aliases.auth_userpass_1234.name}}/*" {
+	capabilities = ["list"]
+}
+path "secret/groups/{{identity.groups.names.ops.id}}" {
+	capabilities = ["create"]
+}
+path "secret/missing/{{identity.entity.aliases.auth_github_5678.name}}" {
+	capabilities = ["read"]
+}
+path "secret/static" {
+	capabilities = ["read"]
+}
+`
+
 var tokenCreationPolicy = `
 name = "tokenCreation"
 path "auth/token/create*" {
@@ -10,6 +10,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
 )
@@ -127,7 +128,11 @@ func (c *Core) disableAudit(ctx context.Context, path string) (bool, error) {
 	defer c.auditLock.Unlock()
 
 	newTable := c.audit.shallowClone()
-	entry := newTable.remove(path)
+	// Audit devices only exist in the root namespace
+	entry, err := newTable.remove(namespace.RootContext(ctx), path)
+	if err != nil {
+		return false, err
+	}
 
 	// Ensure there was a match
 	if entry == nil {
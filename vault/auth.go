@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 )
@@ -56,11 +57,20 @@ func (c *Core) enableCredential(ctx context.Context, entry *MountEntry) error {
 		return fmt.Errorf("backend path must be specified")
 	}
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	entry.setNamespace(ns)
+
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
 
 	// Look for matching name
 	for _, ent := range c.auth.Entries {
+		if ent.Namespace().ID != ns.ID {
+			continue
+		}
 		switch {
 		// Existing is oauth/github/ new is oauth/ or
 		// existing is oauth/ and new is oauth/github/
@@ -76,7 +86,7 @@ func (c *Core) enableCredential(ctx context.Context, entry *MountEntry) error {
 		return fmt.Errorf("token credential backend cannot be instantiated")
 	}
 
-	if conflict := c.router.MountConflict(credentialRoutePrefix + entry.Path); conflict != "" {
+	if conflict := c.router.MountConflict(entry.APIPath()); conflict != "" {
 		return logical.CodedError(409, fmt.Sprintf("existing mount at %s", conflict))
 	}
 
@@ -113,7 +123,6 @@ func (c *Core) enableCredential(ctx context.Context, entry *MountEntry) error {
 	view.setReadOnlyErr(logical.ErrSetupReadOnly)
 	defer view.setReadOnlyErr(nil)
 
-	var err error
 	var backend logical.Backend
 	sysView := c.mountEntrySysView(entry)
 
@@ -141,13 +150,12 @@ func (c *Core) enableCredential(ctx context.Context, entry *MountEntry) error {
 
 	c.auth = newTable
 
-	path := credentialRoutePrefix + entry.Path
-	if err := c.router.Mount(backend, path, entry, view); err != nil {
+	if err := c.router.Mount(backend, entry.APIPath(), entry, view); err != nil {
 		return err
 	}
 
 	if c.logger.IsInfo() {
-		c.logger.Info("enabled credential backend", "path", entry.Path, "type", entry.Type)
+		c.logger.Info("enabled credential backend", "path", entry.APIPath(), "type", entry.Type)
 	}
 	return nil
 }
@@ -165,8 +173,13 @@ func (c *Core) disableCredential(ctx context.Context, path string) error {
 		return fmt.Errorf("token credential backend cannot be disabled")
 	}
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Store the view for this backend
-	fullPath := credentialRoutePrefix + path
+	fullPath := ns.Path + credentialRoutePrefix + path
 	view := c.router.MatchingStorageByAPIPath(fullPath)
 	if view == nil {
 		return fmt.Errorf("no matching backend %q", fullPath)
@@ -206,7 +219,7 @@ func (c *Core) disableCredential(ctx context.Context, path string) error {
 	case entry.Local, !c.ReplicationState().HasState(consts.ReplicationPerformanceSecondary):
 		// Have writable storage, remove the whole thing
 		if err := logical.ClearView(ctx, view); err != nil {
-			c.logger.Error("failed to clear view for path being unmounted", "error", err, "path", path)
+			c.logger.Error("failed to clear view for path being unmounted", "error", err, "path", fullPath)
 			return err
 		}
 
@@ -217,7 +230,7 @@ func (c *Core) disableCredential(ctx context.Context, path string) error {
 		return err
 	}
 	if c.logger.IsInfo() {
-		c.logger.Info("disabled credential backend", "path", path)
+		c.logger.Info("disabled credential backend", "path", fullPath)
 	}
 	return nil
 }
@@ -229,7 +242,10 @@ func (c *Core) removeCredEntry(ctx context.Context, path string) error {
 
 	// Taint the entry from the auth table
 	newTable := c.auth.shallowClone()
-	entry := newTable.remove(path)
+	entry, err := newTable.remove(ctx, path)
+	if err != nil {
+		return err
+	}
 	if entry == nil {
 		c.logger.Error("nil entry found removing entry in auth table", "path", path)
 		return logical.CodedError(500, "failed to remove entry in auth table")
@@ -249,13 +265,18 @@ func (c *Core) removeCredEntry(ctx context.Context, path string) error {
 // unmounts and remounts the backend to pick up any changes, such as filtered
 // paths
 func (c *Core) remountCredEntryForce(ctx context.Context, path string) error {
-	fullPath := credentialRoutePrefix + path
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	fullPath := ns.Path + credentialRoutePrefix + path
 	me := c.router.MatchingMountEntry(fullPath)
 	if me == nil {
 		return fmt.Errorf("cannot find mount for path %q", path)
 	}
 
-	me, err := me.Clone()
+	me, err = me.Clone()
 	if err != nil {
 		return err
 	}
@@ -274,7 +295,10 @@ func (c *Core) taintCredEntry(ctx context.Context, path string) error {
 	// Taint the entry from the auth table
 	// We do this on the original since setting the taint operates
 	// on the entries which a shallow clone shares anyways
-	entry := c.auth.setTaint(path, true)
+	entry, err := c.auth.setTaint(ctx, path, true)
+	if err != nil {
+		return err
+	}
 
 	// Ensure there was a match
 	if entry == nil {
@@ -340,7 +364,22 @@ func (c *Core) loadCredentials(ctx context.Context) error {
 	}
 
 	// Upgrade to table-scoped entries
+	entries := c.auth.Entries[:0]
 	for _, entry := range c.auth.Entries {
+		// Entries created before namespaces existed belong to the root
+		// namespace
+		if entry.NamespaceID == "" {
+			entry.NamespaceID = namespace.RootNamespaceID
+			needPersist = true
+		}
+		ns := c.namespaceByID(entry.NamespaceID)
+		if ns == nil {
+			c.logger.Warn("skipping auth entry of missing namespace", "namespace_id", entry.NamespaceID, "path", entry.Path)
+			continue
+		}
+		entry.namespace = ns
+		entries = append(entries, entry)
+
 		if entry.Table == "" {
 			entry.Table = c.auth.Type
 			needPersist = true
@@ -365,6 +404,7 @@ func (c *Core) loadCredentials(ctx context.Context) error {
 		// Sync values to the cache
 		entry.SyncCache()
 	}
+	c.auth.Entries = entries
 
 	if !needPersist {
 		return nil
@@ -508,7 +548,7 @@ func (c *Core) setupCredentials(ctx context.Context) error {
 
 	ROUTER_MOUNT:
 		// Mount the backend
-		path := credentialRoutePrefix + entry.Path
+		path := entry.APIPath()
 		err = c.router.Mount(backend, path, entry, view)
 		if err != nil {
 			c.logger.Error("failed to mount auth entry", "path", entry.Path, "error", err)
@@ -546,7 +586,7 @@ func (c *Core) teardownCredentials(ctx context.Context) error {
 	if c.auth != nil {
 		authTable := c.auth.shallowClone()
 		for _, e := range authTable.Entries {
-			backend := c.router.MatchingBackend(credentialRoutePrefix + e.Path)
+			backend := c.router.MatchingBackend(e.APIPath())
 			if backend != nil {
 				backend.Cleanup(ctx)
 			}
@@ -619,6 +659,7 @@ func (c *Core) defaultAuthTable() *MountTable {
 		UUID:             tokenUUID,
 		Accessor:         tokenAccessor,
 		BackendAwareUUID: tokenBackendUUID,
+		NamespaceID:      namespace.RootNamespaceID,
 	}
 	table.Entries = append(table.Entries, tokenAuth)
 	return table
@@ -4,6 +4,7 @@ import (
 	"context"
 	"sort"
 
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -29,15 +30,6 @@ func (c *Core) Capabilities(ctx context.Context, token, path string) ([]string,
 		return []string{DenyCapability}, nil
 	}
 
-	var policies []*Policy
-	for _, tePolicy := range te.Policies {
-		policy, err := c.policyStore.GetPolicy(ctx, tePolicy, PolicyTypeToken)
-		if err != nil {
-			return nil, err
-		}
-		policies = append(policies, policy)
-	}
-
 	entity, derivedPolicies, err := c.fetchEntityAndDerivedPolicies(te.EntityID)
 	if err != nil {
 		return nil, err
@@ -47,24 +39,27 @@ func (c *Core) Capabilities(ctx context.Context, token, path string) ([]string,
 		return nil, logical.ErrPermissionDenied
 	}
 
-	for _, item := range derivedPolicies {
-		policy, err := c.policyStore.GetPolicy(ctx, item, PolicyTypeToken)
-		if err != nil {
-			return nil, err
-		}
-		policies = append(policies, policy)
+	// The policies of the token are those of the namespace it was created in
+	policyNames := map[string][]string{
+		tokenNamespaceID(te): append([]string(nil), te.Policies...),
+	}
+	for nsID, nsPolicies := range derivedPolicies {
+		policyNames[nsID] = append(policyNames[nsID], nsPolicies...)
 	}
 
-	if len(policies) == 0 {
-		return []string{DenyCapability}, nil
+	acl, err := c.policyStore.ACL(ctx, entity, policyNames)
+	if err != nil {
+		return nil, err
 	}
 
-	acl, err := NewACL(policies)
+	// Paths are given relative to the namespace of the request, while the
+	// ACL rules are rooted at the root namespace
+	ns, err := namespace.FromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	capabilities := acl.Capabilities(path)
+	capabilities := acl.Capabilities(ns.Path + path)
 	sort.Strings(capabilities)
 	return capabilities, nil
 }
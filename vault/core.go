@@ -26,7 +26,9 @@ import (
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/logging"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/reload"
 	"github.com/hashicorp/vault/helper/tlsutil"
 	"github.com/hashicorp/vault/logical"
@@ -86,6 +88,14 @@ var (
 	// is attempted to be unsealed.
 	ErrNotInit = errors.New("Vault is not initialized")
 
+	// ErrSealMigrationRequired is returned if unseal keys are provided
+	// without the migrate flag while a seal migration is pending.
+	ErrSealMigrationRequired = errors.New("Vault is in seal migration mode; unseal with the migrate flag to continue")
+
+	// ErrNotInSealMigration is returned if the migrate flag is provided
+	// when no seal migration is pending.
+	ErrNotInSealMigration = errors.New("Vault is not in seal migration mode")
+
 	// ErrInternalError is returned when we don't want to leak
 	// any information about an internal error
 	ErrInternalError = errors.New("internal error")
@@ -165,9 +175,18 @@ type Core struct {
 	// physical backend is the un-trusted backend with durable data
 	physical physical.Backend
 
+	// underlyingPhysical is the physical backend as configured, without the
+	// seal unwrapper and cache layers
+	underlyingPhysical physical.Backend
+
 	// Our Seal, for seal configuration information
 	seal Seal
 
+	// migrationSeal is the seal being migrated away from. It is set when the
+	// seal configuration in storage does not match the configured seal, and
+	// cleared once the master key has been moved to the new seal.
+	migrationSeal Seal
+
 	// barrier is the security barrier wrapping the physical backend
 	barrier SecurityBarrier
 
@@ -258,6 +277,10 @@ type Core struct {
 	// policy store is used to manage named ACL policies
 	policyStore *PolicyStore
 
+	// namespaceStore is used to manage the namespaces nested under the root
+	// namespace
+	namespaceStore *NamespaceStore
+
 	// token store is used to manage authentication tokens
 	tokenStore *TokenStore
 
@@ -382,6 +405,10 @@ type Core struct {
 
 	// Stores any funcs that should be run on successful postUnseal
 	postUnsealFuncs []func()
+
+	// metricsHelper gives access to the in-memory metrics sinks so that they
+	// can be served from sys/metrics
+	metricsHelper *metricsutil.MetricsHelper
 }
 
 // CoreConfig is used to parameterize a core
@@ -435,6 +462,9 @@ type CoreConfig struct {
 
 	ReloadFuncs     *map[string][]reload.ReloadFunc
 	ReloadFuncsLock *sync.RWMutex
+
+	// May be nil, which disables the sys/metrics endpoint
+	MetricsHelper *metricsutil.MetricsHelper
 }
 
 // NewCore is used to construct a new core
@@ -476,6 +506,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	c := &Core{
 		devToken:                         conf.DevToken,
 		physical:                         conf.Physical,
+		underlyingPhysical:               conf.Physical,
 		redirectAddr:                     conf.RedirectAddr,
 		clusterAddr:                      conf.ClusterAddr,
 		seal:                             conf.Seal,
@@ -500,6 +531,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		localClusterCert:                 new(atomic.Value),
 		localClusterParsedCert:           new(atomic.Value),
 		activeNodeReplicationState:       new(uint32),
+		metricsHelper:                    conf.MetricsHelper,
 	}
 
 	atomic.StoreUint32(c.replicationState, uint32(consts.ReplicationDRDisabled|consts.ReplicationPerformanceDisabled))
@@ -711,6 +743,10 @@ func (c *Core) Unseal(key []byte) (bool, error) {
 		return false, ErrNotInit
 	}
 
+	if c.migrationSeal != nil {
+		return false, ErrSealMigrationRequired
+	}
+
 	// Verify the key length
 	min, max := c.barrier.KeyLength()
 	max += shamir.ShareOverhead
@@ -732,7 +768,7 @@ func (c *Core) Unseal(key []byte) (bool, error) {
 		return true, nil
 	}
 
-	masterKey, err := c.unsealPart(ctx, config, key, false)
+	masterKey, err := c.unsealPart(ctx, c.seal, config, key, false)
 	if err != nil {
 		return false, err
 	}
@@ -760,6 +796,10 @@ func (c *Core) UnsealWithRecoveryKeys(ctx context.Context, key []byte) (bool, er
 		return false, ErrNotInit
 	}
 
+	if c.migrationSeal != nil {
+		return false, ErrSealMigrationRequired
+	}
+
 	var config *SealConfig
 	// If recovery keys are supported then use recovery seal config to unseal
 	if c.seal.RecoveryKeySupported() {
@@ -774,7 +814,74 @@ func (c *Core) UnsealWithRecoveryKeys(ctx context.Context, key []byte) (bool, er
 		return true, nil
 	}
 
-	masterKey, err := c.unsealPart(ctx, config, key, true)
+	masterKey, err := c.unsealPart(ctx, c.seal, config, key, true)
+	if err != nil {
+		return false, err
+	}
+	if masterKey != nil {
+		return c.unsealInternal(ctx, masterKey)
+	}
+
+	return false, nil
+}
+
+// UnsealMigrate is used to provide one of the key parts to unseal the Vault
+// while migrating the master key to a new seal. The key must be one of the
+// unseal keys when migrating away from shamir, or one of the recovery keys when
+// migrating away from an auto seal.
+func (c *Core) UnsealMigrate(key []byte) (bool, error) {
+	defer metrics.MeasureSince([]string{"core", "unseal_migrate"}, time.Now())
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	ctx := context.Background()
+
+	// Explicitly check for init status
+	init, err := c.Initialized(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !init {
+		return false, ErrNotInit
+	}
+
+	// Check if already unsealed
+	if !c.sealed {
+		return true, nil
+	}
+
+	if c.migrationSeal == nil {
+		return false, ErrNotInSealMigration
+	}
+
+	// Verify the key length
+	min, max := c.barrier.KeyLength()
+	max += shamir.ShareOverhead
+	if len(key) < min {
+		return false, &ErrInvalidKey{fmt.Sprintf("key is shorter than minimum %d bytes", min)}
+	}
+	if len(key) > max {
+		return false, &ErrInvalidKey{fmt.Sprintf("key is longer than maximum %d bytes", max)}
+	}
+
+	// The keys being provided belong to the seal we are migrating from, so
+	// use its configuration to determine the threshold
+	var config *SealConfig
+	useRecoveryKeys := c.migrationSeal.RecoveryKeySupported()
+	if useRecoveryKeys {
+		config, err = c.migrationSeal.RecoveryConfig(ctx)
+	} else {
+		config, err = c.migrationSeal.BarrierConfig(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+	if config == nil {
+		return false, fmt.Errorf("no seal configuration found for the seal being migrated from")
+	}
+
+	masterKey, err := c.unsealPart(ctx, c.migrationSeal, config, key, useRecoveryKeys)
 	if err != nil {
 		return false, err
 	}
@@ -785,9 +892,17 @@ func (c *Core) UnsealWithRecoveryKeys(ctx context.Context, key []byte) (bool, er
 	return false, nil
 }
 
+// IsInSealMigration returns whether the core is waiting to be unsealed with
+// the keys of a seal that is being migrated away from.
+func (c *Core) IsInSealMigration() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	return c.migrationSeal != nil
+}
+
 // unsealPart takes in a key share, and returns the master key if the threshold
 // is met. If recovery keys are supported, recovery key shares may be provided.
-func (c *Core) unsealPart(ctx context.Context, config *SealConfig, key []byte, useRecoveryKeys bool) ([]byte, error) {
+func (c *Core) unsealPart(ctx context.Context, seal Seal, config *SealConfig, key []byte, useRecoveryKeys bool) ([]byte, error) {
 	// Check if we already have this piece
 	if c.unlockInfo != nil {
 		for _, existing := range c.unlockInfo.Parts {
@@ -839,9 +954,9 @@ func (c *Core) unsealPart(ctx context.Context, config *SealConfig, key []byte, u
 		}
 	}
 
-	if c.seal.RecoveryKeySupported() && useRecoveryKeys {
+	if seal.RecoveryKeySupported() && useRecoveryKeys {
 		// Verify recovery key
-		if err := c.seal.VerifyRecoveryKey(ctx, recoveredKey); err != nil {
+		if err := seal.VerifyRecoveryKey(ctx, recoveredKey); err != nil {
 			return nil, err
 		}
 
@@ -851,8 +966,8 @@ func (c *Core) unsealPart(ctx context.Context, config *SealConfig, key []byte, u
 		// If insufficient shares are provided, shamir.Combine will error, and if
 		// no stored keys are found it will return masterKey as nil.
 		var masterKey []byte
-		if c.seal.StoredKeysSupported() {
-			masterKeyShares, err := c.seal.GetStoredKeys(ctx)
+		if seal.StoredKeysSupported() {
+			masterKeyShares, err := seal.GetStoredKeys(ctx)
 			if err != nil {
 				return nil, errwrap.Wrapf("unable to retrieve stored keys: {{err}}", err)
 			}
@@ -887,6 +1002,15 @@ func (c *Core) unsealInternal(ctx context.Context, masterKey []byte) (bool, erro
 		c.logger.Info("vault is unsealed")
 	}
 
+	// If a seal migration is pending, move the master key to the new seal now
+	// that it has been verified against the barrier
+	if err := c.migrateSeal(ctx, masterKey); err != nil {
+		c.logger.Error("seal migration failed", "error", err)
+		c.barrier.Seal()
+		c.logger.Warn("vault is sealed")
+		return false, err
+	}
+
 	// Do post-unseal setup if HA is not enabled
 	if c.ha == nil {
 		// We still need to set up cluster info even if it's not part of a
@@ -1000,7 +1124,7 @@ func (c *Core) sealInitCommon(ctx context.Context, req *logical.Request) (retErr
 	}
 
 	// Validate the token is a root token
-	acl, te, entity, err := c.fetchACLTokenEntryAndEntity(req)
+	acl, te, entity, err := c.fetchACLTokenEntryAndEntity(ctx, req)
 	if err != nil {
 		retErr = multierror.Append(retErr, err)
 		c.stateLock.RUnlock()
@@ -1101,6 +1225,12 @@ func (c *Core) sealInitCommon(ctx context.Context, req *logical.Request) (retErr
 	return
 }
 
+// MetricsHelper returns the helper used to serve the in-memory metrics, which
+// may be nil if metrics are not being collected
+func (c *Core) MetricsHelper() *metricsutil.MetricsHelper {
+	return c.metricsHelper
+}
+
 // UIEnabled returns if the UI is enabled
 func (c *Core) UIEnabled() bool {
 	return c.uiConfig.Enabled()
@@ -1187,7 +1317,7 @@ func (c *Core) postUnseal() (retErr error) {
 	c.postUnsealFuncs = nil
 
 	// Create a new request context
-	c.activeContext, c.activeContextCancelFunc = context.WithCancel(context.Background())
+	c.activeContext, c.activeContextCancelFunc = context.WithCancel(namespace.RootContext(nil))
 
 	defer func() {
 		if retErr != nil {
@@ -1230,6 +1360,9 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupPluginCatalog(); err != nil {
 		return err
 	}
+	if err := c.setupNamespaceStore(c.activeContext); err != nil {
+		return err
+	}
 	if err := c.loadMounts(c.activeContext); err != nil {
 		return err
 	}
@@ -1248,6 +1381,9 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupCredentials(c.activeContext); err != nil {
 		return err
 	}
+	if err := c.setupNamespaceRoutes(c.activeContext); err != nil {
+		return err
+	}
 	if err := c.startRollback(); err != nil {
 		return err
 	}
@@ -1325,6 +1461,7 @@ func (c *Core) preSeal() error {
 	if err := c.unloadMounts(c.activeContext); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error unloading mounts: {{err}}", err))
 	}
+	c.teardownNamespaceStore()
 	if err := enterprisePreSeal(c); err != nil {
 		result = multierror.Append(result, err)
 	}
@@ -1388,6 +1525,17 @@ func (c *Core) SealAccess() *SealAccess {
 	return NewSealAccess(c.seal)
 }
 
+// MigrationSealAccess returns access to the seal being migrated away from, or
+// nil if no seal migration is pending.
+func (c *Core) MigrationSealAccess() *SealAccess {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.migrationSeal == nil {
+		return nil
+	}
+	return NewSealAccess(c.migrationSeal)
+}
+
 func (c *Core) Logger() log.Logger {
 	return c.logger
 }
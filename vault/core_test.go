@@ -12,6 +12,7 @@ import (
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/logging"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/physical/inmem"
@@ -731,6 +732,8 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 		DisplayName:  "foo-armon",
 		TTL:          time.Hour * 24,
 		CreationTime: te.CreationTime,
+		Type:         logical.TokenTypeService,
+		NamespaceID:  namespace.RootNamespaceID,
 	}
 
 	if !reflect.DeepEqual(te, expect) {
@@ -1031,6 +1034,8 @@ func TestCore_HandleRequest_CreateToken_Lease(t *testing.T) {
 		DisplayName:  "token",
 		CreationTime: te.CreationTime,
 		TTL:          time.Hour * 24 * 32,
+		Type:         logical.TokenTypeService,
+		NamespaceID:  namespace.RootNamespaceID,
 	}
 	if !reflect.DeepEqual(te, expect) {
 		t.Fatalf("Bad: %#v expect: %#v", te, expect)
@@ -1076,6 +1081,8 @@ func TestCore_HandleRequest_CreateToken_NoDefaultPolicy(t *testing.T) {
 		DisplayName:  "token",
 		CreationTime: te.CreationTime,
 		TTL:          time.Hour * 24 * 32,
+		Type:         logical.TokenTypeService,
+		NamespaceID:  namespace.RootNamespaceID,
 	}
 	if !reflect.DeepEqual(te, expect) {
 		t.Fatalf("Bad: %#v expect: %#v", te, expect)
@@ -2350,3 +2357,93 @@ func TestCore_HandleRequest_Headers(t *testing.T) {
 		t.Fatalf("did not expect 'Should-Not-Passthrough' to be in the headers map")
 	}
 }
+
+func TestCore_HandleLogin_BatchToken(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies:    []string{"foo"},
+				DisplayName: "armon",
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	// Enable the credential backend, issuing batch tokens by default
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.Data["config"] = map[string]interface{}{
+		"token_type": "default-batch",
+	}
+	req.ClientToken = root
+	_, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	lresp, err := c.HandleRequest(&logical.Request{Path: "auth/foo/login"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if lresp.Auth.TokenType != logical.TokenTypeBatch || lresp.Auth.Accessor != "" || lresp.Auth.Renewable {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+
+	te, err := c.tokenStore.Lookup(context.Background(), lresp.Auth.ClientToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te == nil || te.Parent != "" || te.DisplayName != "foo-armon" {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// No lease should have been registered for the token
+	leaseTimes, err := c.expiration.FetchLeaseTimesByToken(te.Path, te.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaseTimes != nil {
+		t.Fatalf("expected no lease, got: %#v", leaseTimes)
+	}
+
+	// The backend may still ask for a service token
+	noop.Response.Auth.TokenType = logical.TokenTypeService
+	lresp, err = c.HandleRequest(&logical.Request{Path: "auth/foo/login"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if lresp.Auth.TokenType != logical.TokenTypeService || lresp.Auth.Accessor == "" {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+
+	// Forcing batch tokens through tuning overrides the backend
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo/tune")
+	req.Data["token_type"] = "batch"
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+
+	noop.Response.Auth.TokenType = logical.TokenTypeDefault
+	lresp, err = c.HandleRequest(&logical.Request{Path: "auth/foo/login"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if lresp.Auth.TokenType != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+
+	// The token store itself can't be tuned
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/token/tune")
+	req.Data["token_type"] = "batch"
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error, got: %#v", resp)
+	}
+}
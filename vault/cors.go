@@ -21,6 +21,7 @@ var StdAllowedHeaders = []string{
 	"X-Requested-With",
 	"X-Vault-AWS-IAM-Server-ID",
 	"X-Vault-MFA",
+	"X-Vault-Namespace",
 	"X-Vault-No-Request-Forwarding",
 	"X-Vault-Token",
 	"X-Vault-Wrap-Format",
@@ -217,6 +217,12 @@ func (m *ExpirationManager) Tidy() error {
 
 		var isValid, ok bool
 		revokeLease := false
+
+		// Leases created by orphan batch tokens are not tied to any token
+		if le.ClientToken == "" && le.ClientTokenType == logical.TokenTypeBatch {
+			return
+		}
+
 		if le.ClientToken == "" {
 			m.logger.Debug("revoking lease which has an empty token", "lease_id", leaseID)
 			revokeLease = true
@@ -515,7 +521,7 @@ func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool)
 	}
 
 	// Delete the secondary index, but only if it's a leased secret (not auth)
-	if le.Secret != nil {
+	if le.Secret != nil && le.ClientToken != "" {
 		if err := m.removeIndexByToken(le.ClientToken, le.LeaseID); err != nil {
 			return err
 		}
@@ -821,6 +827,23 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 
 	leaseID := path.Join(req.Path, leaseUUID)
 
+	// Batch tokens are never revoked on their own, so leases created with
+	// them are tied to their parent instead. Leases of orphan batch tokens
+	// are only revoked when they expire.
+	indexToken := req.ClientToken
+	var clientTokenType logical.TokenType
+	if strings.HasPrefix(req.ClientToken, batchTokenPrefix) {
+		te, err := m.tokenStore.Lookup(m.quitContext, req.ClientToken)
+		if err != nil {
+			return "", err
+		}
+		if te == nil {
+			return "", fmt.Errorf("cannot register a lease with an invalid batch token")
+		}
+		indexToken = te.Parent
+		clientTokenType = logical.TokenTypeBatch
+	}
+
 	defer func() {
 		// If there is an error we want to rollback as much as possible (note
 		// that errors here are ignored to do as much cleanup as we can). We
@@ -838,20 +861,23 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 				retErr = multierror.Append(retErr, errwrap.Wrapf("an additional error was encountered deleting any lease associated with the newly-generated secret: {{err}}", err))
 			}
 
-			if err := m.removeIndexByToken(req.ClientToken, leaseID); err != nil {
-				retErr = multierror.Append(retErr, errwrap.Wrapf("an additional error was encountered removing lease indexes associated with the newly-generated secret: {{err}}", err))
+			if indexToken != "" {
+				if err := m.removeIndexByToken(indexToken, leaseID); err != nil {
+					retErr = multierror.Append(retErr, errwrap.Wrapf("an additional error was encountered removing lease indexes associated with the newly-generated secret: {{err}}", err))
+				}
 			}
 		}
 	}()
 
 	le := leaseEntry{
-		LeaseID:     leaseID,
-		ClientToken: req.ClientToken,
-		Path:        req.Path,
-		Data:        resp.Data,
-		Secret:      resp.Secret,
-		IssueTime:   time.Now(),
-		ExpireTime:  resp.Secret.ExpirationTime(),
+		LeaseID:         leaseID,
+		ClientToken:     indexToken,
+		ClientTokenType: clientTokenType,
+		Path:            req.Path,
+		Data:            resp.Data,
+		Secret:          resp.Secret,
+		IssueTime:       time.Now(),
+		ExpireTime:      resp.Secret.ExpirationTime(),
 	}
 
 	// Encode the entry
@@ -860,8 +886,10 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 	}
 
 	// Maintain secondary index by token
-	if err := m.createIndexByToken(le.ClientToken, le.LeaseID); err != nil {
-		return "", err
+	if le.ClientToken != "" {
+		if err := m.createIndexByToken(le.ClientToken, le.LeaseID); err != nil {
+			return "", err
+		}
 	}
 
 	// Setup revocation timer if there is a lease
@@ -1332,6 +1360,10 @@ type leaseEntry struct {
 	IssueTime       time.Time              `json:"issue_time"`
 	ExpireTime      time.Time              `json:"expire_time"`
 	LastRenewalTime time.Time              `json:"last_renewal_time"`
+
+	// ClientTokenType is set to batch when the lease was created by a batch
+	// token, in which case ClientToken holds the batch token's parent
+	ClientTokenType logical.TokenType `json:"client_token_type,omitempty"`
 }
 
 // encode is used to JSON encode the lease entry
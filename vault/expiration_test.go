@@ -1761,3 +1761,68 @@ func badRenewFactory(ctx context.Context, conf *logical.BackendConfig) (logical.
 
 	return be, nil
 }
+
+func TestExpiration_Register_BatchToken(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exp.router.Mount(noop, "prod/aws/", &MountEntry{Path: "prod/aws/", Type: "noop", UUID: meUUID, Accessor: "noop-accessor"}, view)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := exp.tokenStore.rootToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	te := &TokenEntry{
+		Parent:       root.ID,
+		Path:         "auth/token/create",
+		Policies:     []string{"default"},
+		CreationTime: time.Now().Unix(),
+		TTL:          time.Hour,
+		Type:         logical.TokenTypeBatch,
+	}
+	if err := exp.tokenStore.create(context.Background(), te); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "prod/aws/foo",
+		ClientToken: te.ID,
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	leaseID, err := exp.Register(req, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lease is tied to the parent of the batch token
+	leases, err := exp.lookupLeasesByToken(root.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(leases, []string{leaseID}) {
+		t.Fatalf("bad: %#v", leases)
+	}
+
+	le, err := exp.loadEntry(leaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if le.ClientToken != root.ID || le.ClientTokenType != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", le)
+	}
+}
@@ -3,7 +3,9 @@ package vault
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/hashicorp/errwrap"
@@ -11,9 +13,11 @@ import (
 	memdb "github.com/hashicorp/go-memdb"
 	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/storagepacker"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	cache "github.com/patrickmn/go-cache"
 )
 
 const (
@@ -40,6 +44,9 @@ func NewIdentityStore(ctx context.Context, core *Core, config *logical.BackendCo
 		entityLocks: locksutil.CreateLocks(),
 		logger:      logger,
 		core:        core,
+
+		mfaPendingLogins: cache.New(mfaPendingLoginTTL, time.Minute),
+		mfaUsedCodes:     cache.New(0, 30*time.Second),
 	}
 
 	iStore.entityPacker, err = storagepacker.NewStoragePacker(iStore.view, iStore.logger, "")
@@ -61,7 +68,17 @@ func NewIdentityStore(ctx context.Context, core *Core, config *logical.BackendCo
 			groupPaths(iStore),
 			lookupPaths(iStore),
 			upgradePaths(iStore),
+			mfaPaths(iStore),
+			oidcPaths(iStore),
 		),
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"oidc/.well-known/*",
+			},
+		},
+		PeriodicFunc: func(ctx context.Context, req *logical.Request) error {
+			return iStore.oidcPeriodicFunc(ctx)
+		},
 		Invalidate: iStore.Invalidate,
 	}
 
@@ -343,7 +360,7 @@ func (i *IdentityStore) CreateOrFetchEntity(alias *logical.Alias) (*identity.Ent
 		return nil, err
 	}
 	if entity != nil {
-		return entity, nil
+		return i.updateAliasMetadata(entity, alias)
 	}
 
 	// Create a MemDB transaction to update both alias and entity
@@ -361,9 +378,12 @@ func (i *IdentityStore) CreateOrFetchEntity(alias *logical.Alias) (*identity.Ent
 
 	i.logger.Debug("creating a new entity", "alias", alias)
 
-	entity = &identity.Entity{}
+	// The entity belongs to the namespace of the mount the alias is for
+	entity = &identity.Entity{
+		NamespaceID: mountValidationResp.MountNamespace.ID,
+	}
 
-	err = i.sanitizeEntity(entity)
+	err = i.sanitizeEntity(namespace.ContextWithNamespace(context.Background(), mountValidationResp.MountNamespace), entity)
 	if err != nil {
 		return nil, err
 	}
@@ -375,6 +395,7 @@ func (i *IdentityStore) CreateOrFetchEntity(alias *logical.Alias) (*identity.Ent
 		MountAccessor: alias.MountAccessor,
 		MountPath:     mountValidationResp.MountPath,
 		MountType:     mountValidationResp.MountType,
+		Metadata:      alias.Metadata,
 	}
 
 	err = i.sanitizeAlias(newAlias)
@@ -397,3 +418,39 @@ func (i *IdentityStore) CreateOrFetchEntity(alias *logical.Alias) (*identity.Ent
 
 	return entity, nil
 }
+
+// updateAliasMetadata stores the metadata reported by the auth method on the
+// alias of an existing entity if it differs from what is already known.
+// Methods that report no metadata leave the stored metadata untouched.
+func (i *IdentityStore) updateAliasMetadata(entity *identity.Entity, alias *logical.Alias) (*identity.Entity, error) {
+	if len(alias.Metadata) == 0 {
+		return entity, nil
+	}
+
+	for idx, entityAlias := range entity.Aliases {
+		if entityAlias.MountAccessor != alias.MountAccessor || entityAlias.Name != alias.Name {
+			continue
+		}
+		if reflect.DeepEqual(entityAlias.Metadata, alias.Metadata) {
+			return entity, nil
+		}
+
+		if err := validateMetadata(alias.Metadata); err != nil {
+			return nil, err
+		}
+
+		clonedEntity, err := entity.Clone()
+		if err != nil {
+			return nil, err
+		}
+		clonedEntity.Aliases[idx].Metadata = alias.Metadata
+		clonedEntity.Aliases[idx].LastUpdateTime = ptypes.TimestampNow()
+
+		if err := i.upsertEntity(clonedEntity, nil, true); err != nil {
+			return nil, err
+		}
+		return clonedEntity, nil
+	}
+
+	return entity, nil
+}
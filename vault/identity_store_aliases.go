@@ -162,7 +162,7 @@ func (i *IdentityStore) pathAliasRegister() framework.OperationFunc {
 			return i.pathAliasIDUpdate()(ctx, req, d)
 		}
 
-		return i.handleAliasUpdateCommon(req, d, nil)
+		return i.handleAliasUpdateCommon(ctx, req, d, nil)
 	}
 }
 
@@ -185,12 +185,12 @@ func (i *IdentityStore) pathAliasIDUpdate() framework.OperationFunc {
 			return logical.ErrorResponse("invalid alias id"), nil
 		}
 
-		return i.handleAliasUpdateCommon(req, d, alias)
+		return i.handleAliasUpdateCommon(ctx, req, d, alias)
 	}
 }
 
 // handleAliasUpdateCommon is used to update an alias
-func (i *IdentityStore) handleAliasUpdateCommon(req *logical.Request, d *framework.FieldData, alias *identity.Alias) (*logical.Response, error) {
+func (i *IdentityStore) handleAliasUpdateCommon(ctx context.Context, req *logical.Request, d *framework.FieldData, alias *identity.Alias) (*logical.Response, error) {
 	var err error
 	var newAlias bool
 	var entity *identity.Entity
@@ -311,7 +311,7 @@ func (i *IdentityStore) handleAliasUpdateCommon(req *logical.Request, d *framewo
 	// ID creation and other validations; This is more useful for new entities
 	// and may not perform anything for the existing entities. Placing the
 	// check here to make the flow common for both new and existing entities.
-	err = i.sanitizeEntity(entity)
+	err = i.sanitizeEntity(ctx, entity)
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +149,7 @@ func (i *IdentityStore) pathEntityMergeID() framework.OperationFunc {
 			return nil, err
 		}
 
-		if toEntityForLocking == nil {
+		if toEntityForLocking == nil || !i.inRequestNamespace(ctx, toEntityForLocking.NamespaceID) {
 			return logical.ErrorResponse("entity id to merge to is invalid"), nil
 		}
 
@@ -187,7 +187,7 @@ func (i *IdentityStore) pathEntityMergeID() framework.OperationFunc {
 				return nil, err
 			}
 
-			if lockFromEntity == nil {
+			if lockFromEntity == nil || lockFromEntity.NamespaceID != toEntityForLocking.NamespaceID {
 				return logical.ErrorResponse("entity id to merge from is invalid"), nil
 			}
 
@@ -318,7 +318,7 @@ func (i *IdentityStore) pathEntityRegister() framework.OperationFunc {
 			return i.pathEntityIDUpdate()(ctx, req, d)
 		}
 
-		return i.handleEntityUpdateCommon(req, d, nil)
+		return i.handleEntityUpdateCommon(ctx, req, d, nil)
 	}
 }
 
@@ -336,16 +336,16 @@ func (i *IdentityStore) pathEntityIDUpdate() framework.OperationFunc {
 		if err != nil {
 			return nil, err
 		}
-		if entity == nil {
+		if entity == nil || !i.inRequestNamespace(ctx, entity.NamespaceID) {
 			return nil, fmt.Errorf("invalid entity id")
 		}
 
-		return i.handleEntityUpdateCommon(req, d, entity)
+		return i.handleEntityUpdateCommon(ctx, req, d, entity)
 	}
 }
 
 // handleEntityUpdateCommon is used to update an entity
-func (i *IdentityStore) handleEntityUpdateCommon(req *logical.Request, d *framework.FieldData, entity *identity.Entity) (*logical.Response, error) {
+func (i *IdentityStore) handleEntityUpdateCommon(ctx context.Context, req *logical.Request, d *framework.FieldData, entity *identity.Entity) (*logical.Response, error) {
 	var err error
 	var newEntity bool
 
@@ -370,7 +370,7 @@ func (i *IdentityStore) handleEntityUpdateCommon(req *logical.Request, d *framew
 	// Get the name
 	entityName := d.Get("name").(string)
 	if entityName != "" {
-		entityByName, err := i.MemDBEntityByName(entityName, false)
+		entityByName, err := i.MemDBEntityByName(ctx, entityName, false)
 		if err != nil {
 			return nil, err
 		}
@@ -390,7 +390,7 @@ func (i *IdentityStore) handleEntityUpdateCommon(req *logical.Request, d *framew
 		entity.Metadata = metadata.(map[string]string)
 	}
 	// ID creation and some validations
-	err = i.sanitizeEntity(entity)
+	err = i.sanitizeEntity(ctx, entity)
 	if err != nil {
 		return nil, err
 	}
@@ -432,7 +432,7 @@ func (i *IdentityStore) pathEntityIDRead() framework.OperationFunc {
 		if err != nil {
 			return nil, err
 		}
-		if entity == nil {
+		if entity == nil || !i.inRequestNamespace(ctx, entity.NamespaceID) {
 			return nil, nil
 		}
 
@@ -511,7 +511,19 @@ func (i *IdentityStore) pathEntityIDDelete() framework.OperationFunc {
 			return logical.ErrorResponse("missing entity id"), nil
 		}
 
-		return nil, i.deleteEntity(entityID)
+		entity, err := i.MemDBEntityByID(entityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil || !i.inRequestNamespace(ctx, entity.NamespaceID) {
+			return nil, nil
+		}
+
+		if err := i.deleteEntity(entityID); err != nil {
+			return nil, err
+		}
+
+		return nil, i.deleteEntityMFASecrets(ctx, entityID)
 	}
 }
 
@@ -540,6 +552,9 @@ func (i *IdentityStore) pathEntityIDList() framework.OperationFunc {
 				break
 			}
 			entity := raw.(*identity.Entity)
+			if !i.inRequestNamespace(ctx, entity.NamespaceID) {
+				continue
+			}
 			entityIDs = append(entityIDs, entity.ID)
 			entityInfoEntry := map[string]interface{}{
 				"name": entity.Name,
@@ -131,7 +131,7 @@ func (i *IdentityStore) pathGroupRegister() framework.OperationFunc {
 		i.groupLock.Lock()
 		defer i.groupLock.Unlock()
 
-		return i.handleGroupUpdateCommon(req, d, nil)
+		return i.handleGroupUpdateCommon(ctx, req, d, nil)
 	}
 }
 
@@ -149,15 +149,15 @@ func (i *IdentityStore) pathGroupIDUpdate() framework.OperationFunc {
 		if err != nil {
 			return nil, err
 		}
-		if group == nil {
+		if group == nil || !i.inRequestNamespace(ctx, group.NamespaceID) {
 			return logical.ErrorResponse("invalid group ID"), nil
 		}
 
-		return i.handleGroupUpdateCommon(req, d, group)
+		return i.handleGroupUpdateCommon(ctx, req, d, group)
 	}
 }
 
-func (i *IdentityStore) handleGroupUpdateCommon(req *logical.Request, d *framework.FieldData, group *identity.Group) (*logical.Response, error) {
+func (i *IdentityStore) handleGroupUpdateCommon(ctx context.Context, req *logical.Request, d *framework.FieldData, group *identity.Group) (*logical.Response, error) {
 	var err error
 	var newGroup bool
 	if group == nil {
@@ -194,7 +194,7 @@ func (i *IdentityStore) handleGroupUpdateCommon(req *logical.Request, d *framewo
 	groupName := d.Get("name").(string)
 	if groupName != "" {
 		// Check if there is a group already existing for the given name
-		groupByName, err := i.MemDBGroupByName(groupName, false)
+		groupByName, err := i.MemDBGroupByName(ctx, groupName, false)
 		if err != nil {
 			return nil, err
 		}
@@ -238,7 +238,7 @@ func (i *IdentityStore) handleGroupUpdateCommon(req *logical.Request, d *framewo
 		memberGroupIDs = memberGroupIDsRaw.([]string)
 	}
 
-	err = i.sanitizeAndUpsertGroup(group, memberGroupIDs)
+	err = i.sanitizeAndUpsertGroup(ctx, group, memberGroupIDs)
 	if err != nil {
 		return nil, err
 	}
@@ -263,6 +263,9 @@ func (i *IdentityStore) pathGroupIDRead() framework.OperationFunc {
 		if err != nil {
 			return nil, err
 		}
+		if group != nil && !i.inRequestNamespace(ctx, group.NamespaceID) {
+			return nil, nil
+		}
 
 		return i.handleGroupReadCommon(group)
 	}
@@ -318,6 +321,15 @@ func (i *IdentityStore) pathGroupIDDelete() framework.OperationFunc {
 		if groupID == "" {
 			return logical.ErrorResponse("empty group ID"), nil
 		}
+
+		group, err := i.MemDBGroupByID(groupID, false)
+		if err != nil {
+			return nil, err
+		}
+		if group == nil || !i.inRequestNamespace(ctx, group.NamespaceID) {
+			return nil, nil
+		}
+
 		return nil, i.deleteGroupByID(groupID)
 	}
 }
@@ -346,6 +358,9 @@ func (i *IdentityStore) pathGroupIDList() framework.OperationFunc {
 				break
 			}
 			group := raw.(*identity.Group)
+			if !i.inRequestNamespace(ctx, group.NamespaceID) {
+				continue
+			}
 			groupIDs = append(groupIDs, group.ID)
 			groupInfoEntry := map[string]interface{}{
 				"name":                group.Name,
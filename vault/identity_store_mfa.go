@@ -0,0 +1,803 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+)
+
+const (
+	// mfaTOTPMethodPrefix is the storage prefix of the TOTP MFA methods
+	mfaTOTPMethodPrefix = "mfa/method/totp/"
+
+	// mfaTOTPSecretPrefix is the storage prefix of the TOTP secrets
+	// generated for entities. Secrets are stored per method, keyed by the
+	// entity ID.
+	mfaTOTPSecretPrefix = "mfa/totp-secret/"
+
+	// mfaLoginEnforcementPrefix is the storage prefix of the login
+	// enforcement configurations
+	mfaLoginEnforcementPrefix = "mfa/login-enforcement/"
+
+	mfaMethodTypeTOTP = "totp"
+)
+
+// mfaTOTPMethod is the configuration of a TOTP MFA method. The parameters are
+// used when generating secrets for entities; each secret keeps the
+// parameters it was generated with.
+type mfaTOTPMethod struct {
+	Name      string `json:"name"`
+	Issuer    string `json:"issuer"`
+	Period    int    `json:"period"`
+	KeySize   int    `json:"key_size"`
+	QRSize    int    `json:"qr_size"`
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Skew      int    `json:"skew"`
+}
+
+// mfaTOTPSecret is the TOTP key generated for an entity, in the same format
+// the TOTP secrets engine stores its keys in
+type mfaTOTPSecret struct {
+	Key         string           `json:"key"`
+	Issuer      string           `json:"issuer"`
+	AccountName string           `json:"account_name"`
+	Period      uint             `json:"period"`
+	Algorithm   otplib.Algorithm `json:"algorithm"`
+	Digits      otplib.Digits    `json:"digits"`
+	Skew        uint             `json:"skew"`
+}
+
+// mfaLoginEnforcement requires logins matching any of its selectors to be
+// validated by one of its MFA methods before a token is issued
+type mfaLoginEnforcement struct {
+	Name                string   `json:"name"`
+	MFAMethodNames      []string `json:"mfa_method_names"`
+	AuthMethodAccessors []string `json:"auth_method_accessors"`
+	AuthMethodTypes     []string `json:"auth_method_types"`
+	IdentityGroupIDs    []string `json:"identity_group_ids"`
+	IdentityEntityIDs   []string `json:"identity_entity_ids"`
+}
+
+func mfaPaths(i *IdentityStore) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "mfa/method/totp/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathMFATOTPMethodList(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(mfaHelp["totp-method-list"][0]),
+			HelpDescription: strings.TrimSpace(mfaHelp["totp-method-list"][1]),
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+				"issuer": {
+					Type:        framework.TypeString,
+					Description: "The name of the key's issuing organization.",
+				},
+				"period": {
+					Type:        framework.TypeDurationSecond,
+					Default:     30,
+					Description: "The length of time used to generate a counter for the TOTP token calculation.",
+				},
+				"key_size": {
+					Type:        framework.TypeInt,
+					Default:     20,
+					Description: "Determines the size in bytes of the generated key.",
+				},
+				"qr_size": {
+					Type:        framework.TypeInt,
+					Default:     200,
+					Description: "The pixel size of the generated square QR code. If this value is 0, a QR code will not be returned.",
+				},
+				"algorithm": {
+					Type:        framework.TypeString,
+					Default:     "SHA1",
+					Description: "The hashing algorithm used to generate the TOTP token. Options include SHA1, SHA256 and SHA512.",
+				},
+				"digits": {
+					Type:        framework.TypeInt,
+					Default:     6,
+					Description: "The number of digits in the generated TOTP token. This value can either be 6 or 8.",
+				},
+				"skew": {
+					Type:        framework.TypeInt,
+					Default:     1,
+					Description: "The number of delay periods that are allowed when validating a TOTP token. This value can either be 0 or 1.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFATOTPMethodUpdate(),
+				logical.ReadOperation:   i.pathMFATOTPMethodRead(),
+				logical.DeleteOperation: i.pathMFATOTPMethodDelete(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(mfaHelp["totp-method"][0]),
+			HelpDescription: strings.TrimSpace(mfaHelp["totp-method"][1]),
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/generate$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFATOTPGenerate(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(mfaHelp["totp-generate"][0]),
+			HelpDescription: strings.TrimSpace(mfaHelp["totp-generate"][1]),
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-generate$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+				"entity_id": {
+					Type:        framework.TypeString,
+					Description: "ID of the entity to generate the secret for.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFATOTPAdminGenerate(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(mfaHelp["totp-admin-generate"][0]),
+			HelpDescription: strings.TrimSpace(mfaHelp["totp-admin-generate"][1]),
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-destroy$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the MFA method.",
+				},
+				"entity_id": {
+					Type:        framework.TypeString,
+					Description: "ID of the entity whose secret should be destroyed.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFATOTPAdminDestroy(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(mfaHelp["totp-admin-destroy"][0]),
+			HelpDescription: strings.TrimSpace(mfaHelp["totp-admin-destroy"][1]),
+		},
+		{
+			Pattern: "mfa/login-enforcement/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathMFALoginEnforcementList(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(mfaHelp["login-enforcement-list"][0]),
+			HelpDescription: strings.TrimSpace(mfaHelp["login-enforcement-list"][1]),
+		},
+		{
+			Pattern: "mfa/login-enforcement/" + framework.GenericNameRegex("name") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the login enforcement.",
+				},
+				"mfa_method_names": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Names of the MFA methods; a passcode of any of them satisfies the enforcement.",
+				},
+				"auth_method_accessors": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Accessors of the auth mounts the enforcement applies to.",
+				},
+				"auth_method_types": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Types of the auth methods the enforcement applies to.",
+				},
+				"identity_group_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "IDs of the groups whose member entities the enforcement applies to.",
+				},
+				"identity_entity_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "IDs of the entities the enforcement applies to.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFALoginEnforcementUpdate(),
+				logical.ReadOperation:   i.pathMFALoginEnforcementRead(),
+				logical.DeleteOperation: i.pathMFALoginEnforcementDelete(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(mfaHelp["login-enforcement"][0]),
+			HelpDescription: strings.TrimSpace(mfaHelp["login-enforcement"][1]),
+		},
+	}
+}
+
+// mfaCheckRootNamespace returns an error response if the request is not made
+// in the root namespace. MFA methods and login enforcements apply to logins
+// in every namespace and can only be managed from the root.
+func mfaCheckRootNamespace(ctx context.Context) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ns.ID != namespace.RootNamespaceID {
+		return logical.ErrorResponse("MFA can only be configured in the root namespace"), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+func (i *IdentityStore) mfaTOTPMethodByName(ctx context.Context, name string) (*mfaTOTPMethod, error) {
+	entry, err := i.view.Get(ctx, mfaTOTPMethodPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var method mfaTOTPMethod
+	if err := entry.DecodeJSON(&method); err != nil {
+		return nil, errwrap.Wrapf("failed to decode TOTP MFA method: {{err}}", err)
+	}
+	return &method, nil
+}
+
+func (i *IdentityStore) mfaTOTPSecret(ctx context.Context, methodName, entityID string) (*mfaTOTPSecret, error) {
+	entry, err := i.view.Get(ctx, mfaTOTPSecretPrefix+methodName+"/"+entityID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var secret mfaTOTPSecret
+	if err := entry.DecodeJSON(&secret); err != nil {
+		return nil, errwrap.Wrapf("failed to decode TOTP secret: {{err}}", err)
+	}
+	return &secret, nil
+}
+
+func (i *IdentityStore) mfaLoginEnforcementByName(ctx context.Context, name string) (*mfaLoginEnforcement, error) {
+	entry, err := i.view.Get(ctx, mfaLoginEnforcementPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var enforcement mfaLoginEnforcement
+	if err := entry.DecodeJSON(&enforcement); err != nil {
+		return nil, errwrap.Wrapf("failed to decode MFA login enforcement: {{err}}", err)
+	}
+	return &enforcement, nil
+}
+
+// mfaLoginEnforcements returns all the login enforcement configurations
+func (i *IdentityStore) mfaLoginEnforcements(ctx context.Context) ([]*mfaLoginEnforcement, error) {
+	names, err := i.view.List(ctx, mfaLoginEnforcementPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*mfaLoginEnforcement
+	for _, name := range names {
+		enforcement, err := i.mfaLoginEnforcementByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if enforcement != nil {
+			ret = append(ret, enforcement)
+		}
+	}
+	return ret, nil
+}
+
+// deleteEntityMFASecrets removes the MFA secrets generated for an entity
+func (i *IdentityStore) deleteEntityMFASecrets(ctx context.Context, entityID string) error {
+	methods, err := i.view.List(ctx, mfaTOTPMethodPrefix)
+	if err != nil {
+		return err
+	}
+	for _, method := range methods {
+		if err := i.view.Delete(ctx, mfaTOTPSecretPrefix+method+"/"+entityID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *IdentityStore) pathMFATOTPMethodList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		names, err := i.view.List(ctx, mfaTOTPMethodPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (i *IdentityStore) pathMFATOTPMethodUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		name := d.Get("name").(string)
+		method, err := i.mfaTOTPMethodByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		// New methods take the defaults of the fields that are not given,
+		// while existing ones keep their values
+		isNew := method == nil
+		if isNew {
+			method = &mfaTOTPMethod{
+				Name: name,
+			}
+		}
+		get := func(field string) (interface{}, bool) {
+			raw, ok := d.GetOk(field)
+			if !ok && isNew {
+				return d.Get(field), true
+			}
+			return raw, ok
+		}
+
+		if raw, ok := d.GetOk("issuer"); ok {
+			method.Issuer = raw.(string)
+		}
+		if method.Issuer == "" {
+			return logical.ErrorResponse("issuer is required"), nil
+		}
+		if raw, ok := get("period"); ok {
+			method.Period = raw.(int)
+		}
+		if raw, ok := get("key_size"); ok {
+			method.KeySize = raw.(int)
+		}
+		if raw, ok := get("qr_size"); ok {
+			method.QRSize = raw.(int)
+		}
+		if raw, ok := get("algorithm"); ok {
+			method.Algorithm = raw.(string)
+		}
+		if raw, ok := get("digits"); ok {
+			method.Digits = raw.(int)
+		}
+		if raw, ok := get("skew"); ok {
+			method.Skew = raw.(int)
+		}
+
+		if _, _, err := method.totpOpts(); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		switch {
+		case method.Period <= 0:
+			return logical.ErrorResponse("the period value must be greater than zero"), nil
+		case method.KeySize <= 0:
+			return logical.ErrorResponse("the key_size value must be greater than zero"), nil
+		case method.QRSize < 0:
+			return logical.ErrorResponse("the qr_size value must be greater than or equal to zero"), nil
+		case method.Skew != 0 && method.Skew != 1:
+			return logical.ErrorResponse("the skew value must be 0 or 1"), nil
+		}
+
+		entry, err := logical.StorageEntryJSON(mfaTOTPMethodPrefix+name, method)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.view.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (i *IdentityStore) pathMFATOTPMethodRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		method, err := i.mfaTOTPMethodByName(ctx, d.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if method == nil {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":      method.Name,
+				"type":      mfaMethodTypeTOTP,
+				"issuer":    method.Issuer,
+				"period":    method.Period,
+				"key_size":  method.KeySize,
+				"qr_size":   method.QRSize,
+				"algorithm": method.Algorithm,
+				"digits":    method.Digits,
+				"skew":      method.Skew,
+			},
+		}, nil
+	}
+}
+
+func (i *IdentityStore) pathMFATOTPMethodDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		name := d.Get("name").(string)
+
+		// Refuse to delete methods that logins depend on
+		enforcements, err := i.mfaLoginEnforcements(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, enforcement := range enforcements {
+			if strutil.StrListContains(enforcement.MFAMethodNames, name) {
+				return logical.ErrorResponse(fmt.Sprintf("MFA method is in use by login enforcement %q", enforcement.Name)), nil
+			}
+		}
+
+		secrets, err := i.view.List(ctx, mfaTOTPSecretPrefix+name+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, entityID := range secrets {
+			if err := i.view.Delete(ctx, mfaTOTPSecretPrefix+name+"/"+entityID); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, i.view.Delete(ctx, mfaTOTPMethodPrefix+name)
+	}
+}
+
+// pathMFATOTPGenerate generates a TOTP secret for the entity of the token
+// making the request
+func (i *IdentityStore) pathMFATOTPGenerate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if req.EntityID == "" {
+			return logical.ErrorResponse("no entity is associated with the request's token"), nil
+		}
+		return i.handleMFATOTPGenerateCommon(ctx, d.Get("name").(string), req.EntityID)
+	}
+}
+
+// pathMFATOTPAdminGenerate generates a TOTP secret for the given entity
+func (i *IdentityStore) pathMFATOTPAdminGenerate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		entityID := d.Get("entity_id").(string)
+		if entityID == "" {
+			return logical.ErrorResponse("missing entity_id"), nil
+		}
+		return i.handleMFATOTPGenerateCommon(ctx, d.Get("name").(string), entityID)
+	}
+}
+
+func (i *IdentityStore) handleMFATOTPGenerateCommon(ctx context.Context, methodName, entityID string) (*logical.Response, error) {
+	method, err := i.mfaTOTPMethodByName(ctx, methodName)
+	if err != nil {
+		return nil, err
+	}
+	if method == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown MFA method %q", methodName)), nil
+	}
+
+	entity, err := i.MemDBEntityByID(entityID, false)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("entity not found"), nil
+	}
+
+	existing, err := i.mfaTOTPSecret(ctx, methodName, entityID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse("entity already has a secret for this MFA method; it must be destroyed before a new one is generated"), nil
+	}
+
+	keyDigits, keyAlgorithm, err := method.totpOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate a new key, the same way the TOTP secrets engine does
+	keyObject, err := totplib.Generate(totplib.GenerateOpts{
+		Issuer:      method.Issuer,
+		AccountName: entity.Name,
+		Period:      uint(method.Period),
+		Digits:      keyDigits,
+		Algorithm:   keyAlgorithm,
+		SecretSize:  uint(method.KeySize),
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to generate TOTP key: {{err}}", err)
+	}
+
+	entry, err := logical.StorageEntryJSON(mfaTOTPSecretPrefix+methodName+"/"+entityID, &mfaTOTPSecret{
+		Key:         keyObject.Secret(),
+		Issuer:      method.Issuer,
+		AccountName: entity.Name,
+		Period:      uint(method.Period),
+		Algorithm:   keyAlgorithm,
+		Digits:      keyDigits,
+		Skew:        uint(method.Skew),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.view.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"url": keyObject.String(),
+		},
+	}
+
+	// Don't include QR code if size is set to zero
+	if method.QRSize > 0 {
+		barcode, err := keyObject.Image(method.QRSize, method.QRSize)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to generate QR code image: {{err}}", err)
+		}
+
+		var buff bytes.Buffer
+		if err := png.Encode(&buff, barcode); err != nil {
+			return nil, errwrap.Wrapf("failed to encode QR code image: {{err}}", err)
+		}
+		resp.Data["barcode"] = base64.StdEncoding.EncodeToString(buff.Bytes())
+	}
+
+	return resp, nil
+}
+
+// pathMFATOTPAdminDestroy destroys the TOTP secret of the given entity
+func (i *IdentityStore) pathMFATOTPAdminDestroy() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		entityID := d.Get("entity_id").(string)
+		if entityID == "" {
+			return logical.ErrorResponse("missing entity_id"), nil
+		}
+
+		return nil, i.view.Delete(ctx, mfaTOTPSecretPrefix+d.Get("name").(string)+"/"+entityID)
+	}
+}
+
+func (i *IdentityStore) pathMFALoginEnforcementList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		names, err := i.view.List(ctx, mfaLoginEnforcementPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (i *IdentityStore) pathMFALoginEnforcementUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		name := d.Get("name").(string)
+		enforcement, err := i.mfaLoginEnforcementByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if enforcement == nil {
+			enforcement = &mfaLoginEnforcement{
+				Name: name,
+			}
+		}
+
+		if raw, ok := d.GetOk("mfa_method_names"); ok {
+			enforcement.MFAMethodNames = strutil.RemoveDuplicates(raw.([]string), false)
+		}
+		if raw, ok := d.GetOk("auth_method_accessors"); ok {
+			enforcement.AuthMethodAccessors = strutil.RemoveDuplicates(raw.([]string), false)
+		}
+		if raw, ok := d.GetOk("auth_method_types"); ok {
+			enforcement.AuthMethodTypes = strutil.RemoveDuplicates(raw.([]string), false)
+		}
+		if raw, ok := d.GetOk("identity_group_ids"); ok {
+			enforcement.IdentityGroupIDs = strutil.RemoveDuplicates(raw.([]string), false)
+		}
+		if raw, ok := d.GetOk("identity_entity_ids"); ok {
+			enforcement.IdentityEntityIDs = strutil.RemoveDuplicates(raw.([]string), false)
+		}
+
+		if len(enforcement.MFAMethodNames) == 0 {
+			return logical.ErrorResponse("at least one MFA method name is required"), nil
+		}
+		for _, methodName := range enforcement.MFAMethodNames {
+			method, err := i.mfaTOTPMethodByName(ctx, methodName)
+			if err != nil {
+				return nil, err
+			}
+			if method == nil {
+				return logical.ErrorResponse(fmt.Sprintf("unknown MFA method %q", methodName)), nil
+			}
+		}
+
+		if len(enforcement.AuthMethodAccessors) == 0 && len(enforcement.AuthMethodTypes) == 0 &&
+			len(enforcement.IdentityGroupIDs) == 0 && len(enforcement.IdentityEntityIDs) == 0 {
+			return logical.ErrorResponse("at least one of auth_method_accessors, auth_method_types, identity_group_ids or identity_entity_ids is required"), nil
+		}
+		for _, accessor := range enforcement.AuthMethodAccessors {
+			if i.core.router.validateMountByAccessor(accessor) == nil {
+				return logical.ErrorResponse(fmt.Sprintf("invalid auth method accessor %q", accessor)), nil
+			}
+		}
+
+		entry, err := logical.StorageEntryJSON(mfaLoginEnforcementPrefix+name, enforcement)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.view.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (i *IdentityStore) pathMFALoginEnforcementRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		enforcement, err := i.mfaLoginEnforcementByName(ctx, d.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if enforcement == nil {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":                  enforcement.Name,
+				"mfa_method_names":      enforcement.MFAMethodNames,
+				"auth_method_accessors": enforcement.AuthMethodAccessors,
+				"auth_method_types":     enforcement.AuthMethodTypes,
+				"identity_group_ids":    enforcement.IdentityGroupIDs,
+				"identity_entity_ids":   enforcement.IdentityEntityIDs,
+			},
+		}, nil
+	}
+}
+
+func (i *IdentityStore) pathMFALoginEnforcementDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := mfaCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		return nil, i.view.Delete(ctx, mfaLoginEnforcementPrefix+d.Get("name").(string))
+	}
+}
+
+// totpOpts translates the digits and algorithm of the method to a format the
+// TOTP library understands
+func (m *mfaTOTPMethod) totpOpts() (otplib.Digits, otplib.Algorithm, error) {
+	var keyDigits otplib.Digits
+	switch m.Digits {
+	case 6:
+		keyDigits = otplib.DigitsSix
+	case 8:
+		keyDigits = otplib.DigitsEight
+	default:
+		return 0, 0, fmt.Errorf("the digits value can only be 6 or 8")
+	}
+
+	var keyAlgorithm otplib.Algorithm
+	switch m.Algorithm {
+	case "SHA1":
+		keyAlgorithm = otplib.AlgorithmSHA1
+	case "SHA256":
+		keyAlgorithm = otplib.AlgorithmSHA256
+	case "SHA512":
+		keyAlgorithm = otplib.AlgorithmSHA512
+	default:
+		return 0, 0, fmt.Errorf("the algorithm value is not valid")
+	}
+
+	return keyDigits, keyAlgorithm, nil
+}
+
+var mfaHelp = map[string][2]string{
+	"totp-method-list": {
+		"List the TOTP MFA methods.",
+		"",
+	},
+	"totp-method": {
+		"Create, update, read or delete a TOTP MFA method.",
+		`
+TOTP MFA methods generate a time-based one-time password secret for each
+entity. The parameters of the method are used when generating the secrets;
+changing them does not affect secrets that were already generated.
+		`,
+	},
+	"totp-generate": {
+		"Generate a TOTP secret for the entity of the calling token.",
+		`
+Generates a secret for the entity associated with the token making the request
+and returns its URL and, unless the method's qr_size is 0, a base64-encoded PNG
+QR code to be loaded into an authenticator app. A new secret can only be
+generated once the existing one is destroyed.
+		`,
+	},
+	"totp-admin-generate": {
+		"Generate a TOTP secret for the given entity.",
+		"",
+	},
+	"totp-admin-destroy": {
+		"Destroy the TOTP secret of the given entity.",
+		"",
+	},
+	"login-enforcement-list": {
+		"List the MFA login enforcements.",
+		"",
+	},
+	"login-enforcement": {
+		"Create, update, read or delete an MFA login enforcement.",
+		`
+Login enforcements require a passcode of one of their MFA methods for logins
+to the given auth mounts or auth method types, or by the given entities or
+members of the given groups. Logins that match an enforcement do not receive a
+token until the passcode is supplied to sys/mfa/validate.
+		`,
+	},
+}
@@ -0,0 +1,1283 @@
+package vault
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/identitytpl"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// oidcConfigPath is the storage path of the OIDC provider configuration
+	oidcConfigPath = "oidc/config"
+
+	// oidcKeyPrefix is the storage prefix of the named keys, which hold the
+	// current signing key and the IDs of the public keys still in use
+	oidcKeyPrefix = "oidc/key/"
+
+	// oidcPublicKeyPrefix is the storage prefix of the public keys published
+	// at the .well-known/keys endpoint, keyed by key ID
+	oidcPublicKeyPrefix = "oidc/public_key/"
+
+	// oidcRolePrefix is the storage prefix of the roles
+	oidcRolePrefix = "oidc/role/"
+
+	// oidcIssuerPath is appended to the issuer configured for the provider,
+	// so that the discovery endpoints can be found relative to the issuer
+	oidcIssuerPath = "/v1/identity/oidc"
+)
+
+// oidcReservedClaims are the claims that Vault sets on every token and that
+// role templates cannot override
+var oidcReservedClaims = []string{
+	"iat",
+	"aud",
+	"exp",
+	"iss",
+	"sub",
+	"namespace",
+}
+
+// oidcSupportedAlgs are the algorithms named keys can sign with
+var oidcSupportedAlgs = []string{
+	string(jose.RS256),
+	string(jose.RS384),
+	string(jose.RS512),
+	string(jose.ES256),
+	string(jose.ES384),
+	string(jose.ES512),
+}
+
+// oidcConfig is the configuration of the OIDC provider
+type oidcConfig struct {
+	Issuer string `json:"issuer"`
+}
+
+// namedKey is a key tokens are signed with. The signing key is replaced on
+// every rotation; the public keys of the previous ones are kept for the
+// verification TTL so that the tokens they signed can still be verified.
+type namedKey struct {
+	Name             string           `json:"name"`
+	Algorithm        string           `json:"signing_algorithm"`
+	VerificationTTL  time.Duration    `json:"verification_ttl"`
+	RotationPeriod   time.Duration    `json:"rotation_period"`
+	AllowedClientIDs []string         `json:"allowed_client_ids"`
+	KeyRing          []*expireableKey `json:"key_ring"`
+	SigningKey       *jose.JSONWebKey `json:"signing_key"`
+	NextRotation     time.Time        `json:"next_rotation"`
+}
+
+// expireableKey is the ID of a public key of a named key. The key of the
+// current signing key has no expiration.
+type expireableKey struct {
+	KeyID    string    `json:"key_id"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// oidcRole determines the audience, lifetime, signing key and additional
+// claims of the tokens issued through it
+type oidcRole struct {
+	Name     string        `json:"name"`
+	Key      string        `json:"key"`
+	Template string        `json:"template"`
+	TTL      time.Duration `json:"ttl"`
+	ClientID string        `json:"client_id"`
+}
+
+// idToken holds the claims Vault sets on every token
+type idToken struct {
+	Issuer    string `json:"iss"`
+	Namespace string `json:"namespace"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	Expiry    int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+// discovery is the OpenID Connect discovery document
+type discovery struct {
+	Issuer        string   `json:"issuer"`
+	Keys          string   `json:"jwks_uri"`
+	ResponseTypes []string `json:"response_types_supported"`
+	Subjects      []string `json:"subject_types_supported"`
+	IDTokenAlgs   []string `json:"id_token_signing_alg_values_supported"`
+}
+
+func oidcPaths(i *IdentityStore) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "oidc/config/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"issuer": {
+					Type:        framework.TypeString,
+					Description: "Issuer URL to be used in the iss claim of the tokens. If not set, Vault's api_addr will be used. The issuer is a case sensitive URL using the https scheme that contains scheme, host, and optionally, port number and path components, but no query or fragment components.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathOIDCReadConfig(),
+				logical.UpdateOperation: i.pathOIDCUpdateConfig(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["config"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["config"][1]),
+		},
+		{
+			Pattern: "oidc/key/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListKeys(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["key-list"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["key-list"][1]),
+		},
+		{
+			Pattern: "oidc/key/" + framework.GenericNameRegex("name") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the key.",
+				},
+				"rotation_period": {
+					Type:        framework.TypeDurationSecond,
+					Default:     "24h",
+					Description: "How often to generate a new keypair.",
+				},
+				"verification_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Default:     "24h",
+					Description: "Controls how long the public portion of a key will be available for verification after being rotated.",
+				},
+				"algorithm": {
+					Type:        framework.TypeString,
+					Default:     string(jose.RS256),
+					Description: "Signing algorithm to use. Options include RS256, RS384, RS512, ES256, ES384 and ES512.",
+				},
+				"allowed_client_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of role client IDs allowed to use this key for signing. If empty, no roles are allowed. If \"*\", all roles are allowed.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathOIDCCreateUpdateKey(),
+				logical.ReadOperation:   i.pathOIDCReadKey(),
+				logical.DeleteOperation: i.pathOIDCDeleteKey(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["key"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["key"][1]),
+		},
+		{
+			Pattern: "oidc/key/" + framework.GenericNameRegex("name") + "/rotate/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the key.",
+				},
+				"verification_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Controls how long the public portion of the current key will be available for verification after being rotated. Defaults to the key's verification_ttl.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathOIDCRotateKey(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["key-rotate"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["key-rotate"][1]),
+		},
+		{
+			Pattern: "oidc/role/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListRoles(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["role-list"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["role-list"][1]),
+		},
+		{
+			Pattern: "oidc/role/" + framework.GenericNameRegex("name") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the role.",
+				},
+				"key": {
+					Type:        framework.TypeString,
+					Description: "The OIDC key to use for generating tokens. The specified key must already exist.",
+				},
+				"template": {
+					Type:        framework.TypeString,
+					Description: "The template string to use for generating tokens. This may be in string-ified JSON or base64 format.",
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Default:     "24h",
+					Description: "TTL of the tokens generated against the role.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathOIDCCreateUpdateRole(),
+				logical.ReadOperation:   i.pathOIDCReadRole(),
+				logical.DeleteOperation: i.pathOIDCDeleteRole(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["role"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["role"][1]),
+		},
+		{
+			Pattern: "oidc/token/" + framework.GenericNameRegex("name") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the role.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCGenerateToken(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["token"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["token"][1]),
+		},
+		{
+			Pattern: "oidc/introspect/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"token": {
+					Type:        framework.TypeString,
+					Description: "Token to verify.",
+				},
+				"client_id": {
+					Type:        framework.TypeString,
+					Description: "Optional client ID to verify the token's audience against.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathOIDCIntrospect(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["introspect"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["introspect"][1]),
+		},
+		{
+			Pattern: "oidc/.well-known/openid-configuration/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCDiscovery(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["discovery"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["discovery"][1]),
+		},
+		{
+			Pattern: "oidc/.well-known/keys/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCReadPublicKeys(),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(oidcHelp["public-keys"][0]),
+			HelpDescription: strings.TrimSpace(oidcHelp["public-keys"][1]),
+		},
+	}
+}
+
+// oidcCheckRootNamespace returns an error response if the request is not
+// made in the root namespace. The keys and roles of the OIDC provider are
+// shared by every namespace and can only be managed from the root.
+func oidcCheckRootNamespace(ctx context.Context) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ns.ID != namespace.RootNamespaceID {
+		return logical.ErrorResponse("the OIDC provider can only be configured in the root namespace"), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+func (i *IdentityStore) oidcConfig(ctx context.Context) (*oidcConfig, error) {
+	entry, err := i.view.Get(ctx, oidcConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config oidcConfig
+	if entry != nil {
+		if err := entry.DecodeJSON(&config); err != nil {
+			return nil, errwrap.Wrapf("failed to decode OIDC configuration: {{err}}", err)
+		}
+	}
+	return &config, nil
+}
+
+// oidcIssuer returns the issuer of the tokens: the configured issuer or,
+// failing that, the API address of the cluster, followed by the path of the
+// provider
+func (i *IdentityStore) oidcIssuer(ctx context.Context) (string, error) {
+	config, err := i.oidcConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	issuer := config.Issuer
+	if issuer == "" {
+		issuer = i.core.redirectAddr
+	}
+	return strings.TrimSuffix(issuer, "/") + oidcIssuerPath, nil
+}
+
+func (i *IdentityStore) oidcKeyByName(ctx context.Context, name string) (*namedKey, error) {
+	entry, err := i.view.Get(ctx, oidcKeyPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var key namedKey
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, errwrap.Wrapf("failed to decode OIDC key: {{err}}", err)
+	}
+	return &key, nil
+}
+
+func (i *IdentityStore) oidcRoleByName(ctx context.Context, name string) (*oidcRole, error) {
+	entry, err := i.view.Get(ctx, oidcRolePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var role oidcRole
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, errwrap.Wrapf("failed to decode OIDC role: {{err}}", err)
+	}
+	return &role, nil
+}
+
+func (i *IdentityStore) oidcPublicKey(ctx context.Context, keyID string) (*jose.JSONWebKey, error) {
+	entry, err := i.view.Get(ctx, oidcPublicKeyPrefix+keyID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var key jose.JSONWebKey
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, errwrap.Wrapf("failed to decode OIDC public key: {{err}}", err)
+	}
+	return &key, nil
+}
+
+func (i *IdentityStore) putOIDCKey(ctx context.Context, key *namedKey) error {
+	entry, err := logical.StorageEntryJSON(oidcKeyPrefix+key.Name, key)
+	if err != nil {
+		return err
+	}
+	return i.view.Put(ctx, entry)
+}
+
+// rotate replaces the signing key of the named key with a new one and
+// publishes its public key. The public key of the previous signing key
+// expires after the given verification TTL.
+func (k *namedKey) rotate(ctx context.Context, s logical.Storage, verificationTTL time.Duration) error {
+	signingKey, err := generateOIDCSigningKey(k.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	public := &jose.JSONWebKey{
+		KeyID:     signingKey.KeyID,
+		Algorithm: signingKey.Algorithm,
+		Use:       signingKey.Use,
+	}
+	switch key := signingKey.Key.(type) {
+	case *rsa.PrivateKey:
+		public.Key = &key.PublicKey
+	case *ecdsa.PrivateKey:
+		public.Key = &key.PublicKey
+	}
+
+	entry, err := logical.StorageEntryJSON(oidcPublicKeyPrefix+public.KeyID, public)
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, ringKey := range k.KeyRing {
+		if ringKey.ExpireAt.IsZero() {
+			ringKey.ExpireAt = now.Add(verificationTTL)
+		}
+	}
+	k.KeyRing = append(k.KeyRing, &expireableKey{KeyID: public.KeyID})
+	k.SigningKey = signingKey
+	k.NextRotation = now.Add(k.RotationPeriod)
+
+	entry, err = logical.StorageEntryJSON(oidcKeyPrefix+k.Name, k)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// generateOIDCSigningKey generates a keypair for the given algorithm
+func generateOIDCSigningKey(algorithm string) (*jose.JSONWebKey, error) {
+	var key interface{}
+	var err error
+
+	switch algorithm {
+	case string(jose.RS256), string(jose.RS384), string(jose.RS512):
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case string(jose.ES256):
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case string(jose.ES384):
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case string(jose.ES512):
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to generate signing key: {{err}}", err)
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &jose.JSONWebKey{
+		Key:       key,
+		KeyID:     id,
+		Algorithm: algorithm,
+		Use:       "sig",
+	}, nil
+}
+
+func (i *IdentityStore) pathOIDCReadConfig() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		config, err := i.oidcConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"issuer": config.Issuer,
+			},
+		}, nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCUpdateConfig() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		config, err := i.oidcConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp *logical.Response
+		if raw, ok := d.GetOk("issuer"); ok {
+			issuer := raw.(string)
+			if issuer != "" {
+				u, err := url.Parse(issuer)
+				if err != nil {
+					return logical.ErrorResponse(fmt.Sprintf("invalid issuer: %v", err)), nil
+				}
+				switch {
+				case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+					return logical.ErrorResponse("issuer must be an http or https URL with a host"), nil
+				case u.RawQuery != "" || u.Fragment != "":
+					return logical.ErrorResponse("issuer must not contain a query or fragment"), nil
+				case u.Scheme == "http":
+					resp = &logical.Response{}
+					resp.AddWarning("The issuer is not using https; relying parties may refuse its tokens.")
+				}
+			}
+			config.Issuer = issuer
+		}
+
+		entry, err := logical.StorageEntryJSON(oidcConfigPath, config)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.view.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCListKeys() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		names, err := i.view.List(ctx, oidcKeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCCreateUpdateKey() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		i.oidcLock.Lock()
+		defer i.oidcLock.Unlock()
+
+		name := d.Get("name").(string)
+		key, err := i.oidcKeyByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		// New keys take the defaults of the fields that are not given, while
+		// existing ones keep their values
+		isNew := key == nil
+		if isNew {
+			key = &namedKey{
+				Name: name,
+			}
+		}
+		get := func(field string) (interface{}, bool) {
+			raw, ok := d.GetOk(field)
+			if !ok && isNew {
+				return d.Get(field), true
+			}
+			return raw, ok
+		}
+
+		if raw, ok := get("rotation_period"); ok {
+			key.RotationPeriod = time.Duration(raw.(int)) * time.Second
+		}
+		if raw, ok := get("verification_ttl"); ok {
+			key.VerificationTTL = time.Duration(raw.(int)) * time.Second
+		}
+		if raw, ok := d.GetOk("allowed_client_ids"); ok {
+			key.AllowedClientIDs = raw.([]string)
+		}
+
+		algorithmChanged := false
+		if raw, ok := get("algorithm"); ok {
+			algorithm := raw.(string)
+			if !strutil.StrListContains(oidcSupportedAlgs, algorithm) {
+				return logical.ErrorResponse(fmt.Sprintf("unknown signing algorithm %q", algorithm)), nil
+			}
+			algorithmChanged = algorithm != key.Algorithm
+			key.Algorithm = algorithm
+		}
+
+		switch {
+		case key.RotationPeriod < time.Minute:
+			return logical.ErrorResponse("rotation_period must be at least one minute"), nil
+		case key.VerificationTTL < 0:
+			return logical.ErrorResponse("verification_ttl cannot be negative"), nil
+		}
+
+		// A new signing key is needed when the key is created or its
+		// algorithm changes; otherwise only the next rotation is adjusted
+		if isNew || algorithmChanged {
+			return nil, key.rotate(ctx, i.view, key.VerificationTTL)
+		}
+
+		if next := time.Now().Add(key.RotationPeriod); next.Before(key.NextRotation) {
+			key.NextRotation = next
+		}
+		return nil, i.putOIDCKey(ctx, key)
+	}
+}
+
+func (i *IdentityStore) pathOIDCReadKey() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		i.oidcLock.RLock()
+		defer i.oidcLock.RUnlock()
+
+		key, err := i.oidcKeyByName(ctx, d.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, nil
+		}
+
+		allowedClientIDs := key.AllowedClientIDs
+		if allowedClientIDs == nil {
+			allowedClientIDs = []string{}
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"algorithm":          key.Algorithm,
+				"rotation_period":    int64(key.RotationPeriod.Seconds()),
+				"verification_ttl":   int64(key.VerificationTTL.Seconds()),
+				"allowed_client_ids": allowedClientIDs,
+			},
+		}, nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCDeleteKey() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		i.oidcLock.Lock()
+		defer i.oidcLock.Unlock()
+
+		name := d.Get("name").(string)
+
+		// Refuse to delete keys that roles sign with
+		roles, err := i.view.List(ctx, oidcRolePrefix)
+		if err != nil {
+			return nil, err
+		}
+		var inUse []string
+		for _, roleName := range roles {
+			role, err := i.oidcRoleByName(ctx, roleName)
+			if err != nil {
+				return nil, err
+			}
+			if role != nil && role.Key == name {
+				inUse = append(inUse, role.Name)
+			}
+		}
+		if len(inUse) > 0 {
+			return logical.ErrorResponse(fmt.Sprintf("unable to delete key %q because it is currently referenced by these roles: %s", name, strings.Join(inUse, ", "))), logical.ErrInvalidRequest
+		}
+
+		key, err := i.oidcKeyByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, nil
+		}
+
+		for _, ringKey := range key.KeyRing {
+			if err := i.view.Delete(ctx, oidcPublicKeyPrefix+ringKey.KeyID); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, i.view.Delete(ctx, oidcKeyPrefix+name)
+	}
+}
+
+func (i *IdentityStore) pathOIDCRotateKey() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		i.oidcLock.Lock()
+		defer i.oidcLock.Unlock()
+
+		key, err := i.oidcKeyByName(ctx, d.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return logical.ErrorResponse("no named key found"), logical.ErrInvalidRequest
+		}
+
+		verificationTTL := key.VerificationTTL
+		if raw, ok := d.GetOk("verification_ttl"); ok {
+			verificationTTL = time.Duration(raw.(int)) * time.Second
+		}
+
+		return nil, key.rotate(ctx, i.view, verificationTTL)
+	}
+}
+
+func (i *IdentityStore) pathOIDCListRoles() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		names, err := i.view.List(ctx, oidcRolePrefix)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCCreateUpdateRole() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		name := d.Get("name").(string)
+		role, err := i.oidcRoleByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		isNew := role == nil
+		if isNew {
+			clientID, err := uuid.GenerateUUID()
+			if err != nil {
+				return nil, err
+			}
+			role = &oidcRole{
+				Name:     name,
+				ClientID: clientID,
+				TTL:      time.Duration(d.Get("ttl").(int)) * time.Second,
+			}
+		} else if raw, ok := d.GetOk("ttl"); ok {
+			role.TTL = time.Duration(raw.(int)) * time.Second
+		}
+
+		if raw, ok := d.GetOk("key"); ok {
+			role.Key = raw.(string)
+		}
+		if role.Key == "" {
+			return logical.ErrorResponse("the key parameter is required"), nil
+		}
+		key, err := i.oidcKeyByName(ctx, role.Key)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return logical.ErrorResponse(fmt.Sprintf("key %q does not exist", role.Key)), nil
+		}
+
+		if raw, ok := d.GetOk("template"); ok {
+			template := raw.(string)
+
+			// Accept base64 encoded templates as well, as JSON can be
+			// awkward to pass on the command line
+			if decoded, err := base64.StdEncoding.DecodeString(template); err == nil {
+				template = string(decoded)
+			}
+			role.Template = template
+		}
+
+		if role.Template != "" {
+			if err := validateOIDCTemplate(role.Template); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+
+		if role.TTL <= 0 {
+			return logical.ErrorResponse("ttl must be greater than zero"), nil
+		}
+		if key.VerificationTTL > 0 && role.TTL > key.VerificationTTL {
+			return logical.ErrorResponse("a role's token ttl cannot be longer than the verification_ttl of the key it references"), nil
+		}
+
+		entry, err := logical.StorageEntryJSON(oidcRolePrefix+name, role)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.view.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+// validateOIDCTemplate checks that the template is a JSON object once its
+// directives are populated and that it does not set reserved claims
+func validateOIDCTemplate(template string) error {
+	_, populated, err := identitytpl.PopulateString(&identitytpl.PopulateStringInput{
+		Mode:              identitytpl.JSONTemplating,
+		ValidityCheckOnly: true,
+		String:            template,
+	})
+	if err != nil {
+		return errwrap.Wrapf("error parsing template: {{err}}", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal([]byte(populated), &claims); err != nil {
+		return errwrap.Wrapf("error parsing template JSON: {{err}}", err)
+	}
+
+	for claim := range claims {
+		if strutil.StrListContains(oidcReservedClaims, claim) {
+			return fmt.Errorf("top level key %q not allowed. Restricted keys: %s", claim, strings.Join(oidcReservedClaims, ", "))
+		}
+	}
+	return nil
+}
+
+func (i *IdentityStore) pathOIDCReadRole() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		role, err := i.oidcRoleByName(ctx, d.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"client_id": role.ClientID,
+				"key":       role.Key,
+				"template":  role.Template,
+				"ttl":       int64(role.TTL.Seconds()),
+			},
+		}, nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCDeleteRole() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if resp, err := oidcCheckRootNamespace(ctx); resp != nil || err != nil {
+			return resp, err
+		}
+
+		return nil, i.view.Delete(ctx, oidcRolePrefix+d.Get("name").(string))
+	}
+}
+
+// pathOIDCGenerateToken issues a token for the entity of the token making the
+// request, signed by the key of the given role
+func (i *IdentityStore) pathOIDCGenerateToken() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		if req.EntityID == "" {
+			return logical.ErrorResponse("no entity associated with the request's token"), nil
+		}
+
+		roleName := d.Get("name").(string)
+		role, err := i.oidcRoleByName(ctx, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("role %q not found", roleName)), nil
+		}
+
+		entity, err := i.MemDBEntityByID(req.EntityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			return logical.ErrorResponse("the entity of the request's token does not exist"), nil
+		}
+		if entity.Disabled {
+			return logical.ErrorResponse("the entity of the request's token is disabled"), nil
+		}
+
+		i.oidcLock.RLock()
+		defer i.oidcLock.RUnlock()
+
+		key, err := i.oidcKeyByName(ctx, role.Key)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil || key.SigningKey == nil {
+			return logical.ErrorResponse(fmt.Sprintf("key %q of role %q not found", role.Key, roleName)), nil
+		}
+		if !strutil.StrListContains(key.AllowedClientIDs, "*") && !strutil.StrListContains(key.AllowedClientIDs, role.ClientID) {
+			return logical.ErrorResponse(fmt.Sprintf("the key %q does not list the client ID of the role %q as an allowed client ID", role.Key, roleName)), nil
+		}
+
+		issuer, err := i.oidcIssuer(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		payload, err := json.Marshal(&idToken{
+			Issuer:    issuer,
+			Namespace: entity.NamespaceID,
+			Subject:   entity.ID,
+			Audience:  role.ClientID,
+			Expiry:    now.Add(role.TTL).Unix(),
+			IssuedAt:  now.Unix(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if role.Template != "" {
+			payload, err = i.mergeOIDCTemplateClaims(entity.ID, role.Template, payload)
+			if err != nil {
+				return nil, errwrap.Wrapf("failed to populate the role's template: {{err}}", err)
+			}
+		}
+
+		signer, err := jose.NewSigner(jose.SigningKey{
+			Algorithm: jose.SignatureAlgorithm(key.Algorithm),
+			Key:       key.SigningKey,
+		}, &jose.SignerOptions{})
+		if err != nil {
+			return nil, err
+		}
+		signature, err := signer.Sign(payload)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to sign token: {{err}}", err)
+		}
+		token, err := signature.CompactSerialize()
+		if err != nil {
+			return nil, err
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"token":     token,
+				"client_id": role.ClientID,
+				"ttl":       int64(role.TTL.Seconds()),
+			},
+		}, nil
+	}
+}
+
+// mergeOIDCTemplateClaims populates the template with the entity's values
+// and adds the resulting claims to the given payload. Reserved claims are
+// never overridden.
+func (i *IdentityStore) mergeOIDCTemplateClaims(entityID, template string, payload []byte) ([]byte, error) {
+	entity, err := i.MemDBEntityByID(entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	directGroups, inheritedGroups, err := i.groupsByEntityID(entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, populated, err := identitytpl.PopulateString(&identitytpl.PopulateStringInput{
+		Mode:   identitytpl.JSONTemplating,
+		String: template,
+		Entity: entity,
+		Groups: append(directGroups, inheritedGroups...),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var claims, templateClaims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(populated), &templateClaims); err != nil {
+		return nil, err
+	}
+	for claim, value := range templateClaims {
+		if !strutil.StrListContains(oidcReservedClaims, claim) {
+			claims[claim] = value
+		}
+	}
+
+	return json.Marshal(claims)
+}
+
+// pathOIDCIntrospect verifies a token issued by the provider. Beyond the
+// signature, issuer, expiration and, if given, audience, the entity the token
+// was issued to must still exist and not be disabled.
+func (i *IdentityStore) pathOIDCIntrospect() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		introspectionError := func(err error) *logical.Response {
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"active": false,
+					"error":  err.Error(),
+				},
+			}
+		}
+
+		rawToken := d.Get("token").(string)
+		if rawToken == "" {
+			return logical.ErrorResponse("missing token"), nil
+		}
+
+		token, err := jwt.ParseSigned(rawToken)
+		if err != nil {
+			return introspectionError(errwrap.Wrapf("error parsing token: {{err}}", err)), nil
+		}
+		if len(token.Headers) != 1 || token.Headers[0].KeyID == "" {
+			return introspectionError(fmt.Errorf("token must be signed by a single key with a key ID")), nil
+		}
+
+		publicKey, err := i.oidcPublicKey(ctx, token.Headers[0].KeyID)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey == nil {
+			return introspectionError(fmt.Errorf("signing key %q not found", token.Headers[0].KeyID)), nil
+		}
+		if token.Headers[0].Algorithm != publicKey.Algorithm {
+			return introspectionError(fmt.Errorf("token is not signed with the algorithm of its key")), nil
+		}
+
+		var claims jwt.Claims
+		var custom struct {
+			Namespace string `json:"namespace"`
+		}
+		if err := token.Claims(publicKey, &claims, &custom); err != nil {
+			return introspectionError(errwrap.Wrapf("error verifying token signature: {{err}}", err)), nil
+		}
+
+		issuer, err := i.oidcIssuer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		expected := jwt.Expected{
+			Issuer: issuer,
+			Time:   time.Now(),
+		}
+		if clientID := d.Get("client_id").(string); clientID != "" {
+			expected.Audience = []string{clientID}
+		}
+		if err := claims.Validate(expected); err != nil {
+			return introspectionError(errwrap.Wrapf("error validating claims: {{err}}", err)), nil
+		}
+
+		entity, err := i.MemDBEntityByID(claims.Subject, false)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entity == nil:
+			return introspectionError(fmt.Errorf("entity %q of the token does not exist", claims.Subject)), nil
+		case entity.Disabled:
+			return introspectionError(fmt.Errorf("entity %q of the token is disabled", claims.Subject)), nil
+		case entity.NamespaceID != custom.Namespace:
+			return introspectionError(fmt.Errorf("token was not issued in the namespace of its entity")), nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"active": true,
+			},
+		}, nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCDiscovery() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		issuer, err := i.oidcIssuer(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := json.Marshal(&discovery{
+			Issuer:        issuer,
+			Keys:          issuer + "/.well-known/keys",
+			ResponseTypes: []string{"id_token"},
+			Subjects:      []string{"public"},
+			IDTokenAlgs:   oidcSupportedAlgs,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return oidcRawResponse(body), nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCReadPublicKeys() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		i.oidcLock.RLock()
+		defer i.oidcLock.RUnlock()
+
+		keyIDs, err := i.view.List(ctx, oidcPublicKeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		jwks := &jose.JSONWebKeySet{
+			Keys: make([]jose.JSONWebKey, 0, len(keyIDs)),
+		}
+		for _, keyID := range keyIDs {
+			key, err := i.oidcPublicKey(ctx, keyID)
+			if err != nil {
+				return nil, err
+			}
+			if key != nil {
+				jwks.Keys = append(jwks.Keys, *key)
+			}
+		}
+
+		body, err := json.Marshal(jwks)
+		if err != nil {
+			return nil, err
+		}
+
+		return oidcRawResponse(body), nil
+	}
+}
+
+// oidcRawResponse returns the given JSON body as is, as expected by OIDC
+// clients of the discovery endpoints
+func oidcRawResponse(body []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  200,
+			logical.HTTPRawBody:     body,
+			logical.HTTPContentType: "application/json",
+		},
+	}
+}
+
+// oidcPeriodicFunc rotates the keys that are due and removes the public keys
+// whose verification TTL has passed
+func (i *IdentityStore) oidcPeriodicFunc(ctx context.Context) error {
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	names, err := i.view.List(ctx, oidcKeyPrefix)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		key, err := i.oidcKeyByName(ctx, name)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			continue
+		}
+
+		if now.After(key.NextRotation) {
+			if err := key.rotate(ctx, i.view, key.VerificationTTL); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("failed to rotate OIDC key %q: {{err}}", name), err)
+			}
+		}
+
+		var keyRing []*expireableKey
+		for _, ringKey := range key.KeyRing {
+			if ringKey.ExpireAt.IsZero() || now.Before(ringKey.ExpireAt) {
+				keyRing = append(keyRing, ringKey)
+				continue
+			}
+			if err := i.view.Delete(ctx, oidcPublicKeyPrefix+ringKey.KeyID); err != nil {
+				return err
+			}
+		}
+		if len(keyRing) != len(key.KeyRing) {
+			key.KeyRing = keyRing
+			if err := i.putOIDCKey(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var oidcHelp = map[string][2]string{
+	"config": {
+		"OIDC configuration",
+		`
+Configures the issuer of the tokens. The issuer defaults to the API address of
+the cluster; either way the path of the provider, /v1/identity/oidc, is
+appended to it.
+		`,
+	},
+	"key-list": {
+		"List OIDC keys",
+		"List all named OIDC keys",
+	},
+	"key": {
+		"CRUD operations for OIDC keys.",
+		`
+Create, read, update and delete named OIDC keys. A named key holds a keypair
+that is rotated every rotation_period. The public keys of rotated keypairs are
+published for verification_ttl so that the tokens they signed can still be
+verified.
+		`,
+	},
+	"key-rotate": {
+		"Rotate a named OIDC key.",
+		`
+Rotate a named OIDC key, generating a new keypair. The public key of the
+previous keypair stays available for verification_ttl.
+		`,
+	},
+	"role-list": {
+		"List configured OIDC roles",
+		"List all configured OIDC roles in the identity backend.",
+	},
+	"role": {
+		"CRUD operations on OIDC Roles",
+		`
+Create, read, update and delete OIDC roles. A role determines the key tokens
+are signed with, their TTL and audience, the client_id generated for the role,
+and the additional claims populated from its template.
+		`,
+	},
+	"token": {
+		"Generate an OIDC token",
+		`
+Generate an OIDC token for the entity of the token making the request. The
+token is signed by the key of the role and carries the claims of its template.
+		`,
+	},
+	"introspect": {
+		"Verify the authenticity of an OIDC token",
+		`
+Verifies the signature, issuer, expiration and, if a client_id is given,
+audience of a token, and that its entity still exists and is enabled.
+		`,
+	},
+	"discovery": {
+		"Query OIDC configurations",
+		`
+Query this path to retrieve the configured OIDC Issuer and Keys endpoints and
+the signing algorithms supported by the OIDC backend.
+		`,
+	},
+	"public-keys": {
+		"Retrieve public keys",
+		`
+Query this path to retrieve the public portion of the keys used to sign OIDC
+tokens. Clients can use this to validate the authenticity of a token.
+		`,
+	},
+}
@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/logical"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestIdentityStore_OIDC(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	c.redirectAddr = "https://vault.example.com:8200"
+	ctx := namespace.RootContext(nil)
+
+	handle := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		if req.ClientToken == "" {
+			req.ClientToken = root
+		}
+		resp, err := c.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+		return resp
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "identity/entity")
+	req.Data["name"] = "testentity"
+	req.Data["metadata"] = []string{"color=green"}
+	entityID := handle(req).Data["id"].(string)
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/group")
+	req.Data["name"] = "engineering"
+	req.Data["member_entity_ids"] = []string{entityID}
+	handle(req)
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/oidc/key/test-key")
+	req.Data["algorithm"] = "ES256"
+	handle(req)
+
+	// Roles cannot set reserved claims
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/oidc/role/test-role")
+	req.Data["key"] = "test-key"
+	req.Data["template"] = `{"sub": {{identity.entity.name}}}`
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	req.Data["template"] = `{"name": {{identity.entity.name}}, "color": {{identity.entity.metadata.color}}, "groups": {{identity.entity.groups.names}}}`
+	handle(req)
+
+	req = logical.TestRequest(t, logical.ReadOperation, "identity/oidc/role/test-role")
+	clientID := handle(req).Data["client_id"].(string)
+	if clientID == "" {
+		t.Fatal("expected a client ID")
+	}
+
+	tokenReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "oidc/token/test-role",
+		EntityID:  entityID,
+		Storage:   c.identityStore.view,
+	}
+
+	// The key does not allow the role's client ID yet
+	resp, err = c.identityStore.HandleRequest(ctx, tokenReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/oidc/key/test-key")
+	req.Data["allowed_client_ids"] = clientID
+	handle(req)
+
+	resp, err = c.identityStore.HandleRequest(ctx, tokenReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	rawToken := resp.Data["token"].(string)
+
+	// The discovery endpoints are available without a token
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "identity/oidc/.well-known/openid-configuration",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var discovered discovery
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &discovered); err != nil {
+		t.Fatal(err)
+	}
+	expectedIssuer := "https://vault.example.com:8200/v1/identity/oidc"
+	if discovered.Issuer != expectedIssuer || discovered.Keys != expectedIssuer+"/.well-known/keys" {
+		t.Fatalf("bad: %#v", discovered)
+	}
+
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "identity/oidc/.well-known/keys",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("expected one public key, got %#v", jwks)
+	}
+
+	// The token verifies against the published key
+	token, err := jwt.ParseSigned(rawToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims jwt.Claims
+	var custom map[string]interface{}
+	if err := token.Claims(&jwks.Keys[0], &claims, &custom); err != nil {
+		t.Fatal(err)
+	}
+	err = claims.Validate(jwt.Expected{
+		Issuer:   expectedIssuer,
+		Subject:  entityID,
+		Audience: []string{clientID},
+		Time:     time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom["name"] != "testentity" || custom["color"] != "green" || custom["namespace"] != namespace.RootNamespaceID {
+		t.Fatalf("bad claims: %#v", custom)
+	}
+	if groups, ok := custom["groups"].([]interface{}); !ok || len(groups) != 1 || groups[0] != "engineering" {
+		t.Fatalf("bad groups claim: %#v", custom["groups"])
+	}
+
+	introspect := func() map[string]interface{} {
+		t.Helper()
+		req := logical.TestRequest(t, logical.UpdateOperation, "identity/oidc/introspect")
+		req.Data["token"] = rawToken
+		req.Data["client_id"] = clientID
+		return handle(req).Data
+	}
+	if data := introspect(); data["active"] != true {
+		t.Fatalf("expected active token, got %#v", data)
+	}
+
+	// Tokens stay valid after a rotation until their key expires
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/oidc/key/test-key/rotate")
+	req.Data["verification_ttl"] = 0
+	handle(req)
+	if data := introspect(); data["active"] != true {
+		t.Fatalf("expected active token, got %#v", data)
+	}
+	if err := c.identityStore.oidcPeriodicFunc(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if data := introspect(); data["active"] != false {
+		t.Fatalf("expected inactive token, got %#v", data)
+	}
+
+	// Keys referenced by roles cannot be deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "identity/oidc/key/test-key")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err == nil {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+}
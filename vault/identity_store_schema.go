@@ -94,8 +94,21 @@ func entitiesTableSchema() *memdb.TableSchema {
 			"name": &memdb.IndexSchema{
 				Name:   "name",
 				Unique: true,
+				Indexer: &memdb.CompoundIndex{
+					Indexes: []memdb.Indexer{
+						&memdb.StringFieldIndex{
+							Field: "NamespaceID",
+						},
+						&memdb.StringFieldIndex{
+							Field: "Name",
+						},
+					},
+				},
+			},
+			"namespace_id": &memdb.IndexSchema{
+				Name: "namespace_id",
 				Indexer: &memdb.StringFieldIndex{
-					Field: "Name",
+					Field: "NamespaceID",
 				},
 			},
 			"metadata": &memdb.IndexSchema{
@@ -140,8 +153,21 @@ func groupsTableSchema() *memdb.TableSchema {
 			"name": {
 				Name:   "name",
 				Unique: true,
+				Indexer: &memdb.CompoundIndex{
+					Indexes: []memdb.Indexer{
+						&memdb.StringFieldIndex{
+							Field: "NamespaceID",
+						},
+						&memdb.StringFieldIndex{
+							Field: "Name",
+						},
+					},
+				},
+			},
+			"namespace_id": {
+				Name: "namespace_id",
 				Indexer: &memdb.StringFieldIndex{
-					Field: "Name",
+					Field: "NamespaceID",
 				},
 			},
 			"member_entity_ids": {
@@ -11,6 +11,7 @@ import (
 	"github.com/hashicorp/vault/helper/storagepacker"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	cache "github.com/patrickmn/go-cache"
 )
 
 const (
@@ -72,6 +73,22 @@ type IdentityStore struct {
 
 	// core is the pointer to Vault's core
 	core *Core
+
+	// mfaPendingLogins holds the logins waiting for their MFA passcodes,
+	// keyed by MFA request ID
+	mfaPendingLogins *cache.Cache
+
+	// mfaPendingLoginsLock makes taking a pending login out of
+	// mfaPendingLogins atomic, so that it is validated at most once
+	mfaPendingLoginsLock sync.Mutex
+
+	// mfaUsedCodes holds the MFA passcodes that were recently used so that
+	// they cannot be replayed
+	mfaUsedCodes *cache.Cache
+
+	// oidcLock is used to protect modifications to the OIDC keys, so that
+	// rotations do not race with each other
+	oidcLock sync.RWMutex
 }
 
 type groupDiff struct {
@@ -2,6 +2,7 @@ package vault
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
@@ -123,6 +124,56 @@ func TestIdentityStore_CreateOrFetchEntity(t *testing.T) {
 	}
 }
 
+func TestIdentityStore_CreateOrFetchEntity_AliasMetadata(t *testing.T) {
+	is, ghAccessor, _ := testIdentityStoreWithGithubAuth(t)
+	alias := &logical.Alias{
+		MountType:     "github",
+		MountAccessor: ghAccessor,
+		Name:          "githubuser",
+		Metadata: map[string]string{
+			"team": "eng",
+		},
+	}
+
+	entity, err := is.CreateOrFetchEntity(alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entity.Aliases[0].Metadata, alias.Metadata) {
+		t.Fatalf("bad: alias metadata; expected: %#v, actual: %#v", alias.Metadata, entity.Aliases[0].Metadata)
+	}
+
+	// Changed metadata is stored on the next login
+	alias.Metadata = map[string]string{
+		"team": "ops",
+	}
+	entity, err = is.CreateOrFetchEntity(alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entity.Aliases[0].Metadata, alias.Metadata) {
+		t.Fatalf("bad: alias metadata; expected: %#v, actual: %#v", alias.Metadata, entity.Aliases[0].Metadata)
+	}
+
+	stored, err := is.MemDBAliasByFactors(ghAccessor, "githubuser", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Metadata, alias.Metadata) {
+		t.Fatalf("bad: stored alias metadata; expected: %#v, actual: %#v", alias.Metadata, stored.Metadata)
+	}
+
+	// Logins without metadata leave it untouched
+	alias.Metadata = nil
+	entity, err = is.CreateOrFetchEntity(alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.Aliases[0].Metadata["team"] != "ops" {
+		t.Fatalf("bad: alias metadata; actual: %#v", entity.Aliases[0].Metadata)
+	}
+}
+
 func TestIdentityStore_EntityByAliasFactors(t *testing.T) {
 	var err error
 	var resp *logical.Response
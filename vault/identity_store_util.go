@@ -13,6 +13,7 @@ import (
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/storagepacker"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
@@ -828,6 +829,12 @@ func (i *IdentityStore) MemDBUpsertEntityInTxn(txn *memdb.Txn, entity *identity.
 		return fmt.Errorf("entity is nil")
 	}
 
+	// Entities created before namespaces existed belong to the root
+	// namespace
+	if entity.NamespaceID == "" {
+		entity.NamespaceID = namespace.RootNamespaceID
+	}
+
 	entityRaw, err := txn.First(entitiesTable, "id", entity.ID)
 	if err != nil {
 		return errwrap.Wrapf("failed to lookup entity from memdb using entity id: {{err}}", err)
@@ -905,7 +912,9 @@ func (i *IdentityStore) MemDBEntityByID(entityID string, clone bool) (*identity.
 	return i.MemDBEntityByIDInTxn(txn, entityID, clone)
 }
 
-func (i *IdentityStore) MemDBEntityByNameInTxn(txn *memdb.Txn, entityName string, clone bool) (*identity.Entity, error) {
+// MemDBEntityByNameInTxn fetches the named entity of the namespace in the
+// context
+func (i *IdentityStore) MemDBEntityByNameInTxn(ctx context.Context, txn *memdb.Txn, entityName string, clone bool) (*identity.Entity, error) {
 	if entityName == "" {
 		return nil, fmt.Errorf("missing entity name")
 	}
@@ -914,7 +923,12 @@ func (i *IdentityStore) MemDBEntityByNameInTxn(txn *memdb.Txn, entityName string
 		return nil, fmt.Errorf("txn is nil")
 	}
 
-	entityRaw, err := txn.First(entitiesTable, "name", entityName)
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entityRaw, err := txn.First(entitiesTable, "name", ns.ID, entityName)
 	if err != nil {
 		return nil, errwrap.Wrapf("failed to fetch entity from memdb using entity name: {{err}}", err)
 	}
@@ -935,14 +949,15 @@ func (i *IdentityStore) MemDBEntityByNameInTxn(txn *memdb.Txn, entityName string
 	return entity, nil
 }
 
-func (i *IdentityStore) MemDBEntityByName(entityName string, clone bool) (*identity.Entity, error) {
+// MemDBEntityByName fetches the named entity of the namespace in the context
+func (i *IdentityStore) MemDBEntityByName(ctx context.Context, entityName string, clone bool) (*identity.Entity, error) {
 	if entityName == "" {
 		return nil, fmt.Errorf("missing entity name")
 	}
 
 	txn := i.db.Txn(false)
 
-	return i.MemDBEntityByNameInTxn(txn, entityName, clone)
+	return i.MemDBEntityByNameInTxn(ctx, txn, entityName, clone)
 }
 
 func (i *IdentityStore) MemDBEntitiesByMetadata(filters map[string]string, clone bool) ([]*identity.Entity, error) {
@@ -1183,13 +1198,22 @@ func (i *IdentityStore) sanitizeAlias(alias *identity.Alias) error {
 	return nil
 }
 
-func (i *IdentityStore) sanitizeEntity(entity *identity.Entity) error {
+func (i *IdentityStore) sanitizeEntity(ctx context.Context, entity *identity.Entity) error {
 	var err error
 
 	if entity == nil {
 		return fmt.Errorf("entity is nil")
 	}
 
+	// New entities belong to the namespace they are created in
+	if entity.NamespaceID == "" {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return err
+		}
+		entity.NamespaceID = ns.ID
+	}
+
 	// Create an ID if there isn't one already
 	if entity.ID == "" {
 		entity.ID, err = uuid.GenerateUUID()
@@ -1203,7 +1227,7 @@ func (i *IdentityStore) sanitizeEntity(entity *identity.Entity) error {
 
 	// Create a name if there isn't one already
 	if entity.Name == "" {
-		entity.Name, err = i.generateName("entity")
+		entity.Name, err = i.generateName(ctx, "entity")
 		if err != nil {
 			return fmt.Errorf("failed to generate entity name")
 		}
@@ -1226,13 +1250,26 @@ func (i *IdentityStore) sanitizeEntity(entity *identity.Entity) error {
 	return nil
 }
 
-func (i *IdentityStore) sanitizeAndUpsertGroup(group *identity.Group, memberGroupIDs []string) error {
+func (i *IdentityStore) sanitizeAndUpsertGroup(ctx context.Context, group *identity.Group, memberGroupIDs []string) error {
 	var err error
 
 	if group == nil {
 		return fmt.Errorf("group is nil")
 	}
 
+	// New groups belong to the namespace they are created in
+	if group.NamespaceID == "" {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return err
+		}
+		group.NamespaceID = ns.ID
+	}
+	groupNS := i.core.namespaceByID(group.NamespaceID)
+	if groupNS == nil {
+		return fmt.Errorf("namespace of the group could not be found")
+	}
+
 	// Create an ID if there isn't one already
 	if group.ID == "" {
 		group.ID, err = uuid.GenerateUUID()
@@ -1246,7 +1283,7 @@ func (i *IdentityStore) sanitizeAndUpsertGroup(group *identity.Group, memberGrou
 
 	// Create a name if there isn't one already
 	if group.Name == "" {
-		group.Name, err = i.generateName("group")
+		group.Name, err = i.generateName(ctx, "group")
 		if err != nil {
 			return fmt.Errorf("failed to generate group name")
 		}
@@ -1269,7 +1306,7 @@ func (i *IdentityStore) sanitizeAndUpsertGroup(group *identity.Group, memberGrou
 	// Remove duplicate entity IDs and check if all IDs are valid
 	group.MemberEntityIDs = strutil.RemoveDuplicates(group.MemberEntityIDs, false)
 	for _, entityID := range group.MemberEntityIDs {
-		err = i.validateEntityID(entityID)
+		err = i.validateEntityID(groupNS, entityID)
 		if err != nil {
 			return err
 		}
@@ -1286,7 +1323,7 @@ func (i *IdentityStore) sanitizeAndUpsertGroup(group *identity.Group, memberGrou
 		if err != nil {
 			return err
 		}
-		if memberGroup == nil {
+		if memberGroup == nil || memberGroup.NamespaceID != group.NamespaceID {
 			return fmt.Errorf("invalid member group ID %q", memberGroupID)
 		}
 
@@ -1374,7 +1411,10 @@ func (i *IdentityStore) validateMemberGroupID(groupID string, memberGroupID stri
 	return nil
 }
 
-func (i *IdentityStore) validateEntityID(entityID string) error {
+// validateEntityID checks that the entity exists and can be a member of a
+// group in the given namespace, which requires it to belong to that
+// namespace or to one above it
+func (i *IdentityStore) validateEntityID(groupNS *namespace.Namespace, entityID string) error {
 	entity, err := i.MemDBEntityByID(entityID, false)
 	if err != nil {
 		return errwrap.Wrapf(fmt.Sprintf("failed to validate entity ID %q: {{err}}", entityID), err)
@@ -1382,6 +1422,10 @@ func (i *IdentityStore) validateEntityID(entityID string) error {
 	if entity == nil {
 		return fmt.Errorf("invalid entity ID %q", entityID)
 	}
+	entityNS := i.core.namespaceByID(entity.NamespaceID)
+	if entityNS == nil || !entityNS.Contains(groupNS) {
+		return fmt.Errorf("invalid entity ID %q", entityID)
+	}
 	return nil
 }
 
@@ -1528,7 +1572,9 @@ func satisfiesMetadataFilters(meta map[string]string, filters map[string]string)
 	return true
 }
 
-func (i *IdentityStore) MemDBGroupByNameInTxn(txn *memdb.Txn, groupName string, clone bool) (*identity.Group, error) {
+// MemDBGroupByNameInTxn fetches the named group of the namespace in the
+// context
+func (i *IdentityStore) MemDBGroupByNameInTxn(ctx context.Context, txn *memdb.Txn, groupName string, clone bool) (*identity.Group, error) {
 	if groupName == "" {
 		return nil, fmt.Errorf("missing group name")
 	}
@@ -1537,7 +1583,12 @@ func (i *IdentityStore) MemDBGroupByNameInTxn(txn *memdb.Txn, groupName string,
 		return nil, fmt.Errorf("txn is nil")
 	}
 
-	groupRaw, err := txn.First(groupsTable, "name", groupName)
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groupRaw, err := txn.First(groupsTable, "name", ns.ID, groupName)
 	if err != nil {
 		return nil, errwrap.Wrapf("failed to fetch group from memdb using group name: {{err}}", err)
 	}
@@ -1558,14 +1609,15 @@ func (i *IdentityStore) MemDBGroupByNameInTxn(txn *memdb.Txn, groupName string,
 	return group, nil
 }
 
-func (i *IdentityStore) MemDBGroupByName(groupName string, clone bool) (*identity.Group, error) {
+// MemDBGroupByName fetches the named group of the namespace in the context
+func (i *IdentityStore) MemDBGroupByName(ctx context.Context, groupName string, clone bool) (*identity.Group, error) {
 	if groupName == "" {
 		return nil, fmt.Errorf("missing group name")
 	}
 
 	txn := i.db.Txn(false)
 
-	return i.MemDBGroupByNameInTxn(txn, groupName, clone)
+	return i.MemDBGroupByNameInTxn(ctx, txn, groupName, clone)
 }
 
 func (i *IdentityStore) UpsertGroup(group *identity.Group, persist bool) error {
@@ -1644,6 +1696,11 @@ func (i *IdentityStore) MemDBUpsertGroupInTxn(txn *memdb.Txn, group *identity.Gr
 		return fmt.Errorf("group is nil")
 	}
 
+	// Groups created before namespaces existed belong to the root namespace
+	if group.NamespaceID == "" {
+		group.NamespaceID = namespace.RootNamespaceID
+	}
+
 	groupRaw, err := txn.First(groupsTable, "id", group.ID)
 	if err != nil {
 		return errwrap.Wrapf("failed to lookup group from memdb using group id: {{err}}", err)
@@ -1741,7 +1798,7 @@ func (i *IdentityStore) MemDBDeleteGroupByIDInTxn(txn *memdb.Txn, groupID string
 	return nil
 }
 
-func (i *IdentityStore) deleteGroupByName(groupName string) error {
+func (i *IdentityStore) deleteGroupByName(ctx context.Context, groupName string) error {
 	var err error
 	var group *identity.Group
 
@@ -1758,7 +1815,7 @@ func (i *IdentityStore) deleteGroupByName(groupName string) error {
 	defer txn.Abort()
 
 	// Fetch the group using its ID
-	group, err = i.MemDBGroupByNameInTxn(txn, groupName, false)
+	group, err = i.MemDBGroupByNameInTxn(ctx, txn, groupName, false)
 	if err != nil {
 		return err
 	}
@@ -1769,7 +1826,7 @@ func (i *IdentityStore) deleteGroupByName(groupName string) error {
 	}
 
 	// Delete the group using the same transaction
-	err = i.MemDBDeleteGroupByNameInTxn(txn, group.Name)
+	err = i.MemDBDeleteGroupByNameInTxn(ctx, txn, group.Name)
 	if err != nil {
 		return err
 	}
@@ -1786,7 +1843,7 @@ func (i *IdentityStore) deleteGroupByName(groupName string) error {
 	return nil
 }
 
-func (i *IdentityStore) MemDBDeleteGroupByNameInTxn(txn *memdb.Txn, groupName string) error {
+func (i *IdentityStore) MemDBDeleteGroupByNameInTxn(ctx context.Context, txn *memdb.Txn, groupName string) error {
 	if groupName == "" {
 		return nil
 	}
@@ -1795,7 +1852,7 @@ func (i *IdentityStore) MemDBDeleteGroupByNameInTxn(txn *memdb.Txn, groupName st
 		return fmt.Errorf("txn is nil")
 	}
 
-	group, err := i.MemDBGroupByNameInTxn(txn, groupName, false)
+	group, err := i.MemDBGroupByNameInTxn(ctx, txn, groupName, false)
 	if err != nil {
 		return err
 	}
@@ -1980,6 +2037,30 @@ func (i *IdentityStore) groupPoliciesByEntityID(entityID string) ([]string, erro
 	return strutil.RemoveDuplicates(policies, false), nil
 }
 
+// groupPoliciesByEntityIDPerNamespace returns the policies of the groups the
+// given entity is a direct or inherited member of, keyed by the ID of the
+// namespace of the group they are attached to
+func (i *IdentityStore) groupPoliciesByEntityIDPerNamespace(entityID string) (map[string][]string, error) {
+	directGroups, inheritedGroups, err := i.groupsByEntityID(entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string][]string)
+	for _, group := range append(directGroups, inheritedGroups...) {
+		if len(group.Policies) == 0 {
+			continue
+		}
+		nsID := group.NamespaceID
+		if nsID == "" {
+			nsID = namespace.RootNamespaceID
+		}
+		policies[nsID] = strutil.RemoveDuplicates(append(policies[nsID], group.Policies...), false)
+	}
+
+	return policies, nil
+}
+
 func (i *IdentityStore) groupsByEntityID(entityID string) ([]*identity.Group, []*identity.Group, error) {
 	if entityID == "" {
 		return nil, nil, fmt.Errorf("empty entity ID")
@@ -2146,7 +2227,66 @@ func (i *IdentityStore) MemDBGroupIterator(ws memdb.WatchSet) (memdb.ResultItera
 	return iter, nil
 }
 
-func (i *IdentityStore) generateName(entryType string) (string, error) {
+// inRequestNamespace reports whether an entity or group with the given
+// namespace ID belongs to the namespace in the context
+func (i *IdentityStore) inRequestNamespace(ctx context.Context, namespaceID string) bool {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return false
+	}
+	if namespaceID == "" {
+		namespaceID = namespace.RootNamespaceID
+	}
+	return namespaceID == ns.ID
+}
+
+// deleteNamespaceArtifacts removes the groups and entities of the namespace
+// in the context. It is used when the namespace is deleted.
+func (i *IdentityStore) deleteNamespaceArtifacts(ctx context.Context) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if ns.ID == namespace.RootNamespaceID {
+		return fmt.Errorf("cannot delete the identity artifacts of the root namespace")
+	}
+
+	txn := i.db.Txn(false)
+
+	var groupIDs []string
+	iter, err := txn.Get(groupsTable, "namespace_id", ns.ID)
+	if err != nil {
+		return errwrap.Wrapf("failed to fetch groups of the namespace: {{err}}", err)
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		groupIDs = append(groupIDs, raw.(*identity.Group).ID)
+	}
+
+	var entityIDs []string
+	iter, err = txn.Get(entitiesTable, "namespace_id", ns.ID)
+	if err != nil {
+		return errwrap.Wrapf("failed to fetch entities of the namespace: {{err}}", err)
+	}
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		entityIDs = append(entityIDs, raw.(*identity.Entity).ID)
+	}
+
+	// Groups go first so that no membership refers to a deleted entity
+	for _, groupID := range groupIDs {
+		if err := i.deleteGroupByID(groupID); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to delete group %q: {{err}}", groupID), err)
+		}
+	}
+	for _, entityID := range entityIDs {
+		if err := i.deleteEntity(entityID); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to delete entity %q: {{err}}", entityID), err)
+		}
+	}
+
+	return nil
+}
+
+func (i *IdentityStore) generateName(ctx context.Context, entryType string) (string, error) {
 	var name string
 OUTER:
 	for {
@@ -2158,7 +2298,7 @@ OUTER:
 
 		switch entryType {
 		case "entity":
-			entity, err := i.MemDBEntityByName(name, false)
+			entity, err := i.MemDBEntityByName(ctx, name, false)
 			if err != nil {
 				return "", err
 			}
@@ -2166,7 +2306,7 @@ OUTER:
 				break OUTER
 			}
 		case "group":
-			group, err := i.MemDBGroupByName(name, false)
+			group, err := i.MemDBGroupByName(ctx, name, false)
 			if err != nil {
 				return "", err
 			}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/pgpkeys"
 	"github.com/hashicorp/vault/shamir"
 )
@@ -129,6 +130,13 @@ func (c *Core) Initialize(ctx context.Context, initParams *InitParams) (*InitRes
 		return nil, ErrAlreadyInit
 	}
 
+	// Integrated storage needs a cluster, and a leader, before anything can
+	// be written
+	if err := c.bootstrapRaft(ctx); err != nil {
+		c.logger.Error("failed to bootstrap raft storage", "error", err)
+		return nil, err
+	}
+
 	err = c.seal.Init(ctx)
 	if err != nil {
 		c.logger.Error("failed to initialize seal", "error", err)
@@ -268,6 +276,13 @@ func (c *Core) UnsealWithStoredKeys(ctx context.Context) error {
 		return nil
 	}
 
+	// Stored keys for the new seal don't exist until the migration is
+	// performed with the keys of the previous seal
+	if c.migrationSeal != nil {
+		c.logger.Info("seal migration pending, skipping unseal with stored keys")
+		return nil
+	}
+
 	c.logger.Info("stored unseal keys supported, attempting fetch")
 	keys, err := c.seal.GetStoredKeys(ctx)
 	if err != nil {
@@ -303,3 +318,223 @@ func (c *Core) UnsealWithStoredKeys(ctx context.Context) error {
 
 	return nil
 }
+
+// PhysicalSealConfigs returns the barrier and recovery seal configurations as
+// they are currently persisted, regardless of the configured seal. Either may
+// be nil if it does not exist.
+func (c *Core) PhysicalSealConfigs(ctx context.Context) (*SealConfig, *SealConfig, error) {
+	pe, err := c.physical.Get(ctx, barrierSealConfigPath)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to fetch barrier seal configuration at migration check time: {{err}}", err)
+	}
+	if pe == nil {
+		return nil, nil, nil
+	}
+
+	barrierConf := new(SealConfig)
+	if err := jsonutil.DecodeJSON(pe.Value, barrierConf); err != nil {
+		return nil, nil, errwrap.Wrapf("failed to decode barrier seal configuration at migration check time: {{err}}", err)
+	}
+	if barrierConf.Type == "" {
+		barrierConf.Type = SealTypeShamir
+	}
+
+	var recoveryConf *SealConfig
+	pe, err = c.physical.Get(ctx, recoverySealConfigPlaintextPath)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to fetch recovery seal configuration at migration check time: {{err}}", err)
+	}
+	if pe != nil {
+		recoveryConf = &SealConfig{}
+		if err := jsonutil.DecodeJSON(pe.Value, recoveryConf); err != nil {
+			return nil, nil, errwrap.Wrapf("failed to decode recovery seal configuration at migration check time: {{err}}", err)
+		}
+	}
+
+	return barrierConf, recoveryConf, nil
+}
+
+// AdjustForSealMigration compares the persisted seal configuration with the
+// configured seal and, if they differ, prepares the core to migrate the master
+// key to the configured seal. unwrapSeal is the seal being migrated away from;
+// it is only required when that seal is not shamir. Once prepared, the core
+// must be unsealed with UnsealMigrate using the keys of the previous seal.
+func (c *Core) AdjustForSealMigration(ctx context.Context, unwrapSeal Seal) error {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	existBarrierSealConfig, existRecoverySealConfig, err := c.PhysicalSealConfigs(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Nothing to migrate before initialization
+	if existBarrierSealConfig == nil {
+		if unwrapSeal != nil {
+			c.logger.Warn("vault is not initialized, ignoring disabled seal")
+		}
+		return nil
+	}
+
+	if existBarrierSealConfig.Type == c.seal.BarrierType() {
+		if unwrapSeal != nil {
+			c.logger.Warn("seal migration already performed, ignoring disabled seal", "seal_type", existBarrierSealConfig.Type)
+		}
+		return nil
+	}
+
+	var existSeal Seal
+	switch existBarrierSealConfig.Type {
+	case SealTypeShamir:
+		// The unseal keys of the shamir seal become the recovery keys of the
+		// new seal, which stores the master key itself
+		if !c.seal.RecoveryKeySupported() {
+			return fmt.Errorf("cannot migrate from shamir to seal type %q", c.seal.BarrierType())
+		}
+		existSeal = NewDefaultSeal()
+
+	default:
+		if unwrapSeal == nil {
+			return fmt.Errorf("existing seal of type %q must be present in the configuration and marked as disabled to migrate to seal type %q", existBarrierSealConfig.Type, c.seal.BarrierType())
+		}
+		if unwrapSeal.BarrierType() != existBarrierSealConfig.Type {
+			return fmt.Errorf("disabled seal of type %q does not match existing seal type %q", unwrapSeal.BarrierType(), existBarrierSealConfig.Type)
+		}
+		if existRecoverySealConfig == nil {
+			return fmt.Errorf("recovery seal configuration not found for existing seal")
+		}
+		existSeal = unwrapSeal
+	}
+
+	existSeal.SetCore(c)
+	existSeal.SetCachedBarrierConfig(existBarrierSealConfig)
+	if existRecoverySealConfig != nil && existSeal.RecoveryKeySupported() {
+		existSeal.SetCachedRecoveryConfig(existRecoverySealConfig)
+	}
+
+	// Cache the configuration the new seal will have after migration. These
+	// are persisted by migrateSeal once the keys have been moved over.
+	if c.seal.RecoveryKeySupported() {
+		newRecoveryConfig := existBarrierSealConfig.Clone()
+		if existSeal.RecoveryKeySupported() {
+			newRecoveryConfig = existRecoverySealConfig.Clone()
+		}
+		newRecoveryConfig.Type = RecoveryTypeShamir
+		newRecoveryConfig.StoredShares = 0
+
+		c.seal.SetCachedBarrierConfig(&SealConfig{
+			Type:            c.seal.BarrierType(),
+			SecretShares:    1,
+			SecretThreshold: 1,
+			StoredShares:    1,
+		})
+		c.seal.SetCachedRecoveryConfig(newRecoveryConfig)
+	} else {
+		// The recovery keys of the existing seal become the unseal keys
+		newBarrierConfig := existRecoverySealConfig.Clone()
+		newBarrierConfig.Type = c.seal.BarrierType()
+		newBarrierConfig.StoredShares = 0
+		c.seal.SetCachedBarrierConfig(newBarrierConfig)
+	}
+
+	c.migrationSeal = existSeal
+	c.logger.Warn("entering seal migration mode; vault must be unsealed with the migrate flag", "from_seal_type", existBarrierSealConfig.Type, "to_seal_type", c.seal.BarrierType())
+
+	return nil
+}
+
+// migrateSeal moves the master key from the migration seal to the configured
+// seal. It must be called with the state lock held, after the barrier has been
+// unsealed with the given master key.
+func (c *Core) migrateSeal(ctx context.Context, masterKey []byte) error {
+	if c.migrationSeal == nil {
+		return nil
+	}
+
+	existBarrierSealConfig, _, err := c.PhysicalSealConfigs(ctx)
+	if err != nil {
+		return err
+	}
+	if existBarrierSealConfig != nil && existBarrierSealConfig.Type == c.seal.BarrierType() {
+		c.logger.Info("seal migration already performed")
+		c.migrationSeal = nil
+		return nil
+	}
+
+	c.logger.Info("seal migration initiated", "from_seal_type", c.migrationSeal.BarrierType(), "to_seal_type", c.seal.BarrierType())
+
+	newBarrierConfig, err := c.seal.BarrierConfig(ctx)
+	if err != nil {
+		return errwrap.Wrapf("failed to fetch new barrier seal configuration: {{err}}", err)
+	}
+
+	switch {
+	case c.migrationSeal.RecoveryKeySupported() && c.seal.RecoveryKeySupported():
+		// Moving between auto seals, so the recovery key stays the same
+		recoveryKey, err := c.migrationSeal.RecoveryKey(ctx)
+		if err != nil {
+			return errwrap.Wrapf("error getting recovery key to set on new seal: {{err}}", err)
+		}
+		if err := c.setAutoSealKeys(ctx, masterKey, recoveryKey); err != nil {
+			return err
+		}
+
+	case c.migrationSeal.RecoveryKeySupported():
+		// Moving to shamir, so the recovery key becomes the master key and
+		// the recovery shares become the unseal shares
+		recoveryKey, err := c.migrationSeal.RecoveryKey(ctx)
+		if err != nil {
+			return errwrap.Wrapf("error getting recovery key to set as master key: {{err}}", err)
+		}
+		if err := c.barrier.Rekey(ctx, recoveryKey); err != nil {
+			return errwrap.Wrapf("error rekeying barrier during migration: {{err}}", err)
+		}
+
+		for _, path := range []string{storedBarrierKeysPath, recoveryKeyPath, recoverySealConfigPlaintextPath} {
+			if err := c.physical.Delete(ctx, path); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("error removing %q during migration: {{err}}", path), err)
+			}
+		}
+
+	case c.seal.RecoveryKeySupported():
+		// Moving from shamir, so the master key becomes the recovery key and
+		// the unseal shares become the recovery shares
+		if err := c.setAutoSealKeys(ctx, masterKey, masterKey); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unsupported seal migration from %q to %q", c.migrationSeal.BarrierType(), c.seal.BarrierType())
+	}
+
+	if err := c.seal.SetBarrierConfig(ctx, newBarrierConfig); err != nil {
+		return errwrap.Wrapf("error storing barrier seal configuration: {{err}}", err)
+	}
+
+	c.logger.Info("seal migration complete")
+	c.migrationSeal = nil
+
+	return nil
+}
+
+// setAutoSealKeys stores the master and recovery keys through an auto seal
+// along with its recovery configuration.
+func (c *Core) setAutoSealKeys(ctx context.Context, masterKey, recoveryKey []byte) error {
+	recoveryConfig, err := c.seal.RecoveryConfig(ctx)
+	if err != nil {
+		return errwrap.Wrapf("failed to fetch new recovery seal configuration: {{err}}", err)
+	}
+
+	if err := c.seal.SetRecoveryConfig(ctx, recoveryConfig); err != nil {
+		return errwrap.Wrapf("error storing recovery seal configuration: {{err}}", err)
+	}
+	if err := c.seal.SetRecoveryKey(ctx, recoveryKey); err != nil {
+		return errwrap.Wrapf("error setting recovery key on new seal: {{err}}", err)
+	}
+
+	if err := c.seal.SetStoredKeys(ctx, [][]byte{masterKey}); err != nil {
+		return errwrap.Wrapf("error setting master key on new seal: {{err}}", err)
+	}
+
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/helper/wrapping"
@@ -88,6 +89,8 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 				"leases/revoke-prefix/*",
 				"leases/revoke-force/*",
 				"leases/lookup/*",
+				"storage/raft/join",
+				"storage/raft/remove-peer",
 			},
 
 			Unauthenticated: []string{
@@ -96,6 +99,7 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 				"replication/status",
 				"internal/ui/mounts",
 				"internal/ui/mounts/*",
+				"mfa/validate",
 			},
 		},
 
@@ -320,6 +324,10 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 						Type:        framework.TypeCommaStringSlice,
 						Description: strings.TrimSpace(sysHelp["passthrough_request_headers"][0]),
 					},
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["token_type"][0]),
+					},
 				},
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.ReadOperation:   b.handleAuthTuneRead,
@@ -369,6 +377,10 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 						Type:        framework.TypeCommaStringSlice,
 						Description: strings.TrimSpace(sysHelp["passthrough_request_headers"][0]),
 					},
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["token_type"][0]),
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -1105,6 +1117,10 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 	}
 
 	b.Backend.Paths = append(b.Backend.Paths, replicationPaths(b)...)
+	b.Backend.Paths = append(b.Backend.Paths, b.raftStoragePaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.metricsPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.namespacesPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.mfaPaths()...)
 
 	if core.rawEnabled {
 		b.Backend.Paths = append(b.Backend.Paths, &framework.Path{
@@ -1575,6 +1591,11 @@ func mountInfo(entry *MountEntry) map[string]interface{} {
 
 // handleMountTable handles the "mounts" endpoint to provide the mount table
 func (b *SystemBackend) handleMountTable(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	b.Core.mountsLock.RLock()
 	defer b.Core.mountsLock.RUnlock()
 
@@ -1583,6 +1604,11 @@ func (b *SystemBackend) handleMountTable(ctx context.Context, req *logical.Reque
 	}
 
 	for _, entry := range b.Core.mounts.Entries {
+		// Only the mounts of the request's namespace are listed
+		if entry.Namespace().ID != ns.ID {
+			continue
+		}
+
 		// Populate mount info
 		info := mountInfo(entry)
 		resp.Data[entry.Path] = info
@@ -1718,6 +1744,10 @@ func (b *SystemBackend) handleMount(ctx context.Context, req *logical.Request, d
 	}
 	config.ListingVisibility = apiConfig.ListingVisibility
 
+	if apiConfig.TokenType != "" {
+		return logical.ErrorResponse("token_type can only be set on auth methods"), logical.ErrInvalidRequest
+	}
+
 	if len(apiConfig.AuditNonHMACRequestKeys) > 0 {
 		config.AuditNonHMACRequestKeys = apiConfig.AuditNonHMACRequestKeys
 	}
@@ -1780,19 +1810,25 @@ func handleErrorNoReadOnlyForward(
 
 // handleUnmount is used to unmount a path
 func (b *SystemBackend) handleUnmount(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	path := data.Get("path").(string)
 	path = sanitizeMountPath(path)
+	fullPath := ns.Path + path
 
 	repState := b.Core.ReplicationState()
-	entry := b.Core.router.MatchingMountEntry(path)
+	entry := b.Core.router.MatchingMountEntry(fullPath)
 	if entry != nil && !entry.Local && repState.HasState(consts.ReplicationPerformanceSecondary) {
 		return logical.ErrorResponse("cannot unmount a non-local mount on a replication secondary"), nil
 	}
 
 	// We return success when the mount does not exists to not expose if the
 	// mount existed or not
-	match := b.Core.router.MatchingMount(path)
-	if match == "" || path != match {
+	match := b.Core.router.MatchingMount(fullPath)
+	if match == "" || fullPath != match {
 		return nil, nil
 	}
 
@@ -1821,7 +1857,12 @@ func (b *SystemBackend) handleRemount(ctx context.Context, req *logical.Request,
 	fromPath = sanitizeMountPath(fromPath)
 	toPath = sanitizeMountPath(toPath)
 
-	entry := b.Core.router.MatchingMountEntry(fromPath)
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := b.Core.router.MatchingMountEntry(ns.Path + fromPath)
 	if entry != nil && !entry.Local && repState.HasState(consts.ReplicationPerformanceSecondary) {
 		return logical.ErrorResponse("cannot remount a non-local mount on a replication secondary"), nil
 	}
@@ -1843,7 +1884,7 @@ func (b *SystemBackend) handleAuthTuneRead(ctx context.Context, req *logical.Req
 				"path must be specified as a string"),
 			logical.ErrInvalidRequest
 	}
-	return b.handleTuneReadCommon("auth/" + path)
+	return b.handleTuneReadCommon(ctx, "auth/"+path)
 }
 
 // handleMountTuneRead is used to get config settings on a backend
@@ -1858,20 +1899,26 @@ func (b *SystemBackend) handleMountTuneRead(ctx context.Context, req *logical.Re
 	// This call will read both logical backend's configuration as well as auth methods'.
 	// Retaining this behavior for backward compatibility. If this behavior is not desired,
 	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneReadCommon(path)
+	return b.handleTuneReadCommon(ctx, path)
 }
 
 // handleTuneReadCommon returns the config settings of a path
-func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, error) {
+func (b *SystemBackend) handleTuneReadCommon(ctx context.Context, path string) (*logical.Response, error) {
 	path = sanitizeMountPath(path)
 
-	sysView := b.Core.router.MatchingSystemView(path)
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fullPath := ns.Path + path
+
+	sysView := b.Core.router.MatchingSystemView(fullPath)
 	if sysView == nil {
 		b.Backend.Logger().Error("cannot fetch sysview", "path", path)
 		return handleError(fmt.Errorf("sys: cannot fetch sysview for path %q", path))
 	}
 
-	mountEntry := b.Core.router.MatchingMountEntry(path)
+	mountEntry := b.Core.router.MatchingMountEntry(fullPath)
 	if mountEntry == nil {
 		b.Backend.Logger().Error("cannot fetch mount entry", "path", path)
 		return handleError(fmt.Errorf("sys: cannot fetch mount entry for path %q", path))
@@ -1897,6 +1944,10 @@ func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, er
 		resp.Data["listing_visibility"] = mountEntry.Config.ListingVisibility
 	}
 
+	if len(mountEntry.Config.TokenType) > 0 {
+		resp.Data["token_type"] = mountEntry.Config.TokenType
+	}
+
 	if rawVal, ok := mountEntry.synthesizedConfigCache.Load("passthrough_request_headers"); ok {
 		resp.Data["passthrough_request_headers"] = rawVal.([]string)
 	}
@@ -1945,7 +1996,13 @@ func (b *SystemBackend) handleTuneWriteCommon(ctx context.Context, path string,
 		}
 	}
 
-	mountEntry := b.Core.router.MatchingMountEntry(path)
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fullPath := ns.Path + path
+
+	mountEntry := b.Core.router.MatchingMountEntry(fullPath)
 	if mountEntry == nil {
 		b.Backend.Logger().Error("tune failed: no mount entry found", "path", path)
 		return handleError(fmt.Errorf("tune of path %q failed: no mount entry found", path))
@@ -1966,7 +2023,7 @@ func (b *SystemBackend) handleTuneWriteCommon(ctx context.Context, path string,
 	defer lock.Unlock()
 
 	// Check again after grabbing the lock
-	mountEntry = b.Core.router.MatchingMountEntry(path)
+	mountEntry = b.Core.router.MatchingMountEntry(fullPath)
 	if mountEntry == nil {
 		b.Backend.Logger().Error("tune failed: no mount entry found", "path", path)
 		return handleError(fmt.Errorf("tune of path %q failed: no mount entry found", path))
@@ -2119,6 +2176,33 @@ func (b *SystemBackend) handleTuneWriteCommon(ctx context.Context, path string,
 		}
 	}
 
+	if rawVal, ok := data.GetOk("token_type"); ok {
+		if !strings.HasPrefix(path, credentialRoutePrefix) {
+			return logical.ErrorResponse("token_type can only be tuned on auth methods"), logical.ErrInvalidRequest
+		}
+		if mountEntry.Type == "token" {
+			return logical.ErrorResponse("token_type cannot be tuned on the token auth method; use token store roles instead"), logical.ErrInvalidRequest
+		}
+
+		tokenType, err := logical.ParseTokenType(rawVal.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+
+		oldVal := mountEntry.Config.TokenType
+		mountEntry.Config.TokenType = tokenType
+
+		// Update the mount table
+		if err := b.Core.persistAuth(ctx, b.Core.auth, &mountEntry.Local); err != nil {
+			mountEntry.Config.TokenType = oldVal
+			return handleError(err)
+		}
+
+		if b.Core.logger.IsInfo() {
+			b.Core.logger.Info("mount tuning of token_type successful", "path", path)
+		}
+	}
+
 	if rawVal, ok := data.GetOk("passthrough_request_headers"); ok {
 		headers := rawVal.([]string)
 
@@ -2145,7 +2229,6 @@ func (b *SystemBackend) handleTuneWriteCommon(ctx context.Context, path string,
 		}
 	}
 
-	var err error
 	var resp *logical.Response
 	var options map[string]string
 	if optionsRaw, ok := data.GetOk("options"); ok {
@@ -2341,10 +2424,20 @@ func (b *SystemBackend) handleAuthTable(ctx context.Context, req *logical.Reques
 	b.Core.authLock.RLock()
 	defer b.Core.authLock.RUnlock()
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	resp := &logical.Response{
 		Data: make(map[string]interface{}),
 	}
 	for _, entry := range b.Core.auth.Entries {
+		// Only the auth methods of the request's namespace are listed
+		if entry.Namespace().ID != ns.ID {
+			continue
+		}
+
 		info := map[string]interface{}{
 			"type":        entry.Type,
 			"description": entry.Description,
@@ -2372,6 +2465,9 @@ func (b *SystemBackend) handleAuthTable(ctx context.Context, req *logical.Reques
 		if rawVal, ok := entry.synthesizedConfigCache.Load("passthrough_request_headers"); ok {
 			entryConfig["passthrough_request_headers"] = rawVal.([]string)
 		}
+		if len(entry.Config.TokenType) > 0 {
+			entryConfig["token_type"] = entry.Config.TokenType
+		}
 
 		info["config"] = entryConfig
 		resp.Data[entry.Path] = info
@@ -2479,6 +2575,12 @@ func (b *SystemBackend) handleEnableAuth(ctx context.Context, req *logical.Reque
 	}
 	config.ListingVisibility = apiConfig.ListingVisibility
 
+	tokenType, err := logical.ParseTokenType(apiConfig.TokenType)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	config.TokenType = tokenType
+
 	if len(apiConfig.AuditNonHMACRequestKeys) > 0 {
 		config.AuditNonHMACRequestKeys = apiConfig.AuditNonHMACRequestKeys
 	}
@@ -2514,7 +2616,11 @@ func (b *SystemBackend) handleDisableAuth(ctx context.Context, req *logical.Requ
 	path := data.Get("path").(string)
 	path = sanitizeMountPath(path)
 
-	fullPath := credentialRoutePrefix + path
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fullPath := ns.Path + credentialRoutePrefix + path
 
 	repState := b.Core.ReplicationState()
 	entry := b.Core.router.MatchingMountEntry(fullPath)
@@ -3472,7 +3578,7 @@ func (b *SystemBackend) pathInternalUIMountsRead(ctx context.Context, req *logic
 
 		var entity *identity.Entity
 		// Load the ACL policies so we can walk the prefix for this mount
-		acl, _, entity, err = b.Core.fetchACLTokenEntryAndEntity(req)
+		acl, _, entity, err = b.Core.fetchACLTokenEntryAndEntity(ctx, req)
 		if err != nil {
 			return nil, err
 		}
@@ -3482,13 +3588,23 @@ func (b *SystemBackend) pathInternalUIMountsRead(ctx context.Context, req *logic
 
 	}
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	hasAccess := func(me *MountEntry) bool {
+		// Only the mounts of the request's namespace are listed
+		if me.Namespace().ID != ns.ID {
+			return false
+		}
+
 		if me.Config.ListingVisibility == ListingVisibilityUnauth {
 			return true
 		}
 
 		if isAuthed {
-			return hasMountAccess(acl, me.Path)
+			return hasMountAccess(acl, ns.Path+me.Path)
 		}
 
 		return false
@@ -3540,7 +3656,12 @@ func (b *SystemBackend) pathInternalUIMountRead(ctx context.Context, req *logica
 
 	errResp := logical.ErrorResponse(fmt.Sprintf("Preflight capability check returned 403, please ensure client's policies grant access to path \"%s\"", path))
 
-	me := b.Core.router.MatchingMountEntry(path)
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	me := b.Core.router.MatchingMountEntry(ns.Path + path)
 	if me == nil {
 		// Return a permission denied error here so this path cannot be used to
 		// brute force a list of mounts.
@@ -3553,7 +3674,7 @@ func (b *SystemBackend) pathInternalUIMountRead(ctx context.Context, req *logica
 	resp.Data["path"] = me.Path
 
 	// Load the ACL policies so we can walk the prefix for this mount
-	acl, _, entity, err := b.Core.fetchACLTokenEntryAndEntity(req)
+	acl, _, entity, err := b.Core.fetchACLTokenEntryAndEntity(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -3561,7 +3682,7 @@ func (b *SystemBackend) pathInternalUIMountRead(ctx context.Context, req *logica
 		return errResp, logical.ErrPermissionDenied
 	}
 
-	if !hasMountAccess(acl, me.Path) {
+	if !hasMountAccess(acl, ns.Path+me.Path) {
 		return errResp, logical.ErrPermissionDenied
 	}
 
@@ -3574,7 +3695,7 @@ func (b *SystemBackend) pathInternalUIResultantACL(ctx context.Context, req *log
 		return nil, nil
 	}
 
-	acl, _, entity, err := b.Core.fetchACLTokenEntryAndEntity(req)
+	acl, _, entity, err := b.Core.fetchACLTokenEntryAndEntity(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -4288,6 +4409,10 @@ This path responds to the following HTTP methods.
 		"A list of headers to whitelist and pass from the request to the backend.",
 		"",
 	},
+	"token_type": {
+		"The type of token to issue (service, batch, default-service or default-batch).",
+		"",
+	},
 	"raw": {
 		"Write, Read, and Delete data directly in the Storage backend.",
 		"",
@@ -4300,4 +4425,79 @@ This path responds to the following HTTP methods.
 		"Information about a token's resultant ACL. Internal API; its location, inputs, and outputs may change.",
 		"",
 	},
+	"raft-join": {
+		"Add a server to the raft cluster.",
+		`
+Adds the server with the given node ID and raft address to the raft cluster
+used for integrated storage. The server must be running with the cluster's
+TLS configuration; it then receives the cluster's data, including its seal
+configuration, and can be unsealed with the cluster's keys.
+		`,
+	},
+	"raft-remove-peer": {
+		"Remove a server from the raft cluster.",
+		`
+Removes the server with the given node ID from the raft cluster used for
+integrated storage. The server stops receiving data and no longer counts
+towards the quorum.
+		`,
+	},
+	"raft-configuration": {
+		"Returns the membership of the raft cluster.",
+		`
+Returns the servers that make up the raft cluster used for integrated
+storage, along with their addresses and which of them is the leader.
+		`,
+	},
+	"mfa-validate": {
+		"Complete a login that requires MFA.",
+		`
+Logins matching an MFA login enforcement do not return a token. Instead, they
+return an MFA request ID and the MFA methods that can satisfy each
+enforcement. Supplying the request ID along with valid passcodes to this
+endpoint returns the token of the original login. Pending logins expire after
+five minutes.
+		`,
+	},
+	"mfa-request-id": {
+		"The MFA request ID returned by the login.",
+		"",
+	},
+	"mfa-payload": {
+		"A map of MFA method names to the passcodes supplied for them.",
+		"",
+	},
+	"namespaces-list": {
+		"List the namespaces nested under the current namespace.",
+		`
+Lists the namespaces directly nested under the namespace of the request along
+with their IDs.
+		`,
+	},
+	"namespaces": {
+		"Create, read, or delete a namespace.",
+		`
+Namespaces are isolated hierarchies of mounts, auth methods, policies, tokens
+and identities. Creating a namespace nests it under the namespace of the
+request. Deleting a namespace unmounts everything it contains, revokes its
+leases and tokens, and removes its policies; child namespaces must be deleted
+first.
+		`,
+	},
+	"namespaces-path": {
+		"The name of the namespace, relative to the current namespace.",
+		"",
+	},
+	"metrics": {
+		"Export the metrics aggregated for telemetry purpose.",
+		`
+Returns the metrics collected by this node. By default a JSON summary of the
+most recent interval is returned; set "format" to "prometheus" to receive the
+metrics in the Prometheus text exposition format.
+		`,
+	},
+	"metrics-format": {
+		"Format to export metrics into. Currently accepts only \"prometheus\".",
+		"",
+	},
 }
@@ -0,0 +1,44 @@
+package vault
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// metricsPaths returns the path used to export the metrics collected by
+// this node. Listeners configured to allow it also serve the same data
+// without authentication directly from the HTTP layer.
+func (b *SystemBackend) metricsPaths() []*framework.Path {
+	return []*framework.Path{
+		&framework.Path{
+			Pattern: "metrics$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"format": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["metrics-format"][0]),
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.handleMetricsRead,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["metrics"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["metrics"][1]),
+		},
+	}
+}
+
+// handleMetricsRead returns the metrics in the requested format
+func (b *SystemBackend) handleMetricsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	metricsHelper := b.Core.MetricsHelper()
+	if metricsHelper == nil {
+		return logical.ErrorResponse("metrics are not being collected on this node"), logical.ErrUnsupportedPath
+	}
+
+	return metricsHelper.ResponseForFormat(d.Get("format").(string)), nil
+}
@@ -0,0 +1,44 @@
+package vault
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// mfaPaths returns the path used to complete logins held for MFA. Requests
+// to it are handled by the core while processing login requests; the path is
+// registered to document it and to mark it unauthenticated.
+func (b *SystemBackend) mfaPaths() []*framework.Path {
+	return []*framework.Path{
+		&framework.Path{
+			Pattern: "mfa/validate$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"mfa_request_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["mfa-request-id"][0]),
+				},
+				"mfa_payload": &framework.FieldSchema{
+					Type:        framework.TypeMap,
+					Description: strings.TrimSpace(sysHelp["mfa-payload"][0]),
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleMFAValidate,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-validate"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-validate"][1]),
+		},
+	}
+}
+
+// handleMFAValidate is never reached since the core completes the login
+// before routing the request
+func (b *SystemBackend) handleMFAValidate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return logical.ErrorResponse("MFA validation must be made as a login request"), logical.ErrInvalidRequest
+}
@@ -0,0 +1,142 @@
+package vault
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// namespacesPaths returns the paths used to manage the namespaces nested
+// directly under the namespace of the request
+func (b *SystemBackend) namespacesPaths() []*framework.Path {
+	return []*framework.Path{
+		&framework.Path{
+			Pattern: "namespaces/?$",
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.handleNamespacesList,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["namespaces-list"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["namespaces-list"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "namespaces/(?P<path>.+)",
+
+			Fields: map[string]*framework.FieldSchema{
+				"path": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["namespaces-path"][0]),
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.handleNamespacesRead,
+				logical.UpdateOperation: b.handleNamespacesSet,
+				logical.DeleteOperation: b.handleNamespacesDelete,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["namespaces"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["namespaces"][1]),
+		},
+	}
+}
+
+// namespaceResponseData returns the data describing a namespace. The path is
+// given relative to the namespace of the request.
+func namespaceResponseData(parent, ns *namespace.Namespace) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   ns.ID,
+		"path": parent.TrimmedPath(ns.Path),
+	}
+}
+
+// childNamespace returns the namespace with the given name nested directly
+// under the parent, or nil if it does not exist
+func (b *SystemBackend) childNamespace(parent *namespace.Namespace, name string) *namespace.Namespace {
+	nsPath := parent.Path + namespace.Canonicalize(name)
+	for _, child := range b.Core.namespaceStore.children(parent) {
+		if child.Path == nsPath {
+			return child
+		}
+	}
+	return nil
+}
+
+// handleNamespacesList lists the namespaces nested directly under the
+// namespace of the request
+func (b *SystemBackend) handleNamespacesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	parent, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	keyInfo := make(map[string]interface{})
+	for _, child := range b.Core.namespaceStore.children(parent) {
+		key := parent.TrimmedPath(child.Path)
+		keys = append(keys, key)
+		keyInfo[key] = namespaceResponseData(parent, child)
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+// handleNamespacesRead returns the namespace with the given name
+func (b *SystemBackend) handleNamespacesRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	parent, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := b.childNamespace(parent, d.Get("path").(string))
+	if ns == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: namespaceResponseData(parent, ns),
+	}, nil
+}
+
+// handleNamespacesSet creates a namespace nested under the namespace of the
+// request
+func (b *SystemBackend) handleNamespacesSet(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	parent, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ns, err := b.Core.createNamespace(ctx, parent, d.Get("path").(string))
+	if err != nil {
+		return handleError(err)
+	}
+
+	return &logical.Response{
+		Data: namespaceResponseData(parent, ns),
+	}, nil
+}
+
+// handleNamespacesDelete deletes the namespace with the given name along with
+// everything it contains
+func (b *SystemBackend) handleNamespacesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	parent, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := b.childNamespace(parent, d.Get("path").(string))
+	if ns == nil {
+		return nil, nil
+	}
+
+	if err := b.Core.deleteNamespace(ctx, ns); err != nil {
+		return handleError(err)
+	}
+
+	return nil, nil
+}
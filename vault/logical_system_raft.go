@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// raftStoragePaths returns the paths used to manage the membership of the
+// raft cluster when integrated storage is in use. They are served by the
+// active node, so new servers are added by an operator of the cluster rather
+// than by the joining server itself.
+func (b *SystemBackend) raftStoragePaths() []*framework.Path {
+	return []*framework.Path{
+		&framework.Path{
+			Pattern: "storage/raft/join$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"node_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The node ID of the server to add to the cluster.",
+				},
+				"address": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The raft address of the server to add to the cluster.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleRaftJoinUpdate,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["raft-join"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["raft-join"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "storage/raft/remove-peer$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"server_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The node ID of the server to remove from the cluster.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleRaftRemovePeerUpdate,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["raft-remove-peer"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["raft-remove-peer"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "storage/raft/configuration$",
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.handleRaftConfigurationGet,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["raft-configuration"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["raft-configuration"][1]),
+		},
+	}
+}
+
+// handleRaftJoinUpdate adds a server to the raft cluster
+func (b *SystemBackend) handleRaftJoinUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	nodeID := d.Get("node_id").(string)
+	if nodeID == "" {
+		return logical.ErrorResponse("no node id provided"), logical.ErrInvalidRequest
+	}
+	address := d.Get("address").(string)
+	if address == "" {
+		return logical.ErrorResponse("no address provided"), logical.ErrInvalidRequest
+	}
+
+	raftBackend := b.Core.raftBackend()
+	if raftBackend == nil {
+		return logical.ErrorResponse(ErrRaftNotInUse.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := raftBackend.AddPeer(ctx, nodeID, address); err != nil {
+		return handleError(err)
+	}
+	b.logger.Info("added raft peer", "node_id", nodeID, "address", address)
+
+	return nil, nil
+}
+
+// handleRaftRemovePeerUpdate removes a server from the raft cluster
+func (b *SystemBackend) handleRaftRemovePeerUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	serverID := d.Get("server_id").(string)
+	if serverID == "" {
+		return logical.ErrorResponse("no server id provided"), logical.ErrInvalidRequest
+	}
+
+	raftBackend := b.Core.raftBackend()
+	if raftBackend == nil {
+		return logical.ErrorResponse(ErrRaftNotInUse.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := raftBackend.RemovePeer(ctx, serverID); err != nil {
+		return handleError(err)
+	}
+	b.logger.Info("removed raft peer", "server_id", serverID)
+
+	return nil, nil
+}
+
+// handleRaftConfigurationGet returns the current membership of the raft
+// cluster
+func (b *SystemBackend) handleRaftConfigurationGet(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	raftBackend := b.Core.raftBackend()
+	if raftBackend == nil {
+		return logical.ErrorResponse(ErrRaftNotInUse.Error()), logical.ErrInvalidRequest
+	}
+
+	config, err := raftBackend.GetConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]map[string]interface{}, 0, len(config.Servers))
+	for _, s := range config.Servers {
+		servers = append(servers, map[string]interface{}{
+			"node_id": s.NodeID,
+			"address": s.Address,
+			"leader":  s.Leader,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"config": map[string]interface{}{
+				"index":   config.Index,
+				"servers": servers,
+			},
+		},
+	}, nil
+}
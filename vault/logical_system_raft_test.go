@@ -0,0 +1,87 @@
+package vault
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/logging"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical/raft"
+)
+
+func TestSystemBackend_raftNotInUse(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "storage/raft/configuration")
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request, got %v", err)
+	}
+	if resp == nil || resp.Data["error"] != ErrRaftNotInUse.Error() {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestSystemBackend_raftConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tlsConf, cleanup := raft.TestTLSConfig(t)
+	defer cleanup()
+
+	conf := map[string]string{
+		"path":                   dir,
+		"node_id":                "node1",
+		"address":                "127.0.0.1:0",
+		"performance_multiplier": "1",
+	}
+	for k, v := range tlsConf {
+		conf[k] = v
+	}
+	backend, err := raft.NewRaftBackend(conf, logging.NewVaultLogger(log.Trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.(*raft.RaftBackend).Close()
+
+	// Initialization bootstraps the cluster
+	c, _, _ := TestCoreUnsealedBackend(t, backend)
+	b := c.systemBackend
+
+	req := logical.TestRequest(t, logical.ReadOperation, "storage/raft/configuration")
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := resp.Data["config"].(map[string]interface{})
+	servers := config["servers"].([]map[string]interface{})
+	if len(servers) != 1 {
+		t.Fatalf("expected a single server, got %#v", servers)
+	}
+	if servers[0]["node_id"] != "node1" || servers[0]["leader"] != true {
+		t.Fatalf("bad server: %#v", servers[0])
+	}
+
+	// Adding a server requires its node ID and address
+	req = logical.TestRequest(t, logical.UpdateOperation, "storage/raft/join")
+	req.Data["node_id"] = "node2"
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request, got %v: %#v", err, resp)
+	}
+
+	// The only server cannot be removed
+	req = logical.TestRequest(t, logical.UpdateOperation, "storage/raft/remove-peer")
+	req.Data["server_id"] = "node1"
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request, got %v: %#v", err, resp)
+	}
+}
@@ -43,6 +43,8 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"leases/revoke-prefix/*",
 		"leases/revoke-force/*",
 		"leases/lookup/*",
+		"storage/raft/join",
+		"storage/raft/remove-peer",
 	}
 
 	b := testSystemBackend(t)
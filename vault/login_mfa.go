@@ -0,0 +1,261 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+)
+
+const (
+	// mfaValidatePath is the system backend path that completes logins held
+	// pending by an MFA login enforcement
+	mfaValidatePath = "sys/mfa/validate"
+
+	// mfaPendingLoginTTL is how long a login waits for its MFA passcodes
+	// before it has to be made again
+	mfaPendingLoginTTL = 5 * time.Minute
+)
+
+// mfaPendingLogin is a successful login that is held until the passcodes of
+// the MFA login enforcements it matched are validated
+type mfaPendingLogin struct {
+	// namespaceID and path are those of the original login request
+	namespaceID string
+	path        string
+
+	resp     *logical.Response
+	entityID string
+
+	// requirements maps the name of each enforcement that applies to the
+	// login to the MFA methods that can satisfy it
+	requirements map[string][]string
+}
+
+// mfaLoginRequirements returns the MFA requirements of a login made through
+// the given auth mount by the given entity, keyed by enforcement name
+func (i *IdentityStore) mfaLoginRequirements(ctx context.Context, mEntry *MountEntry, entity *identity.Entity) (map[string][]string, error) {
+	enforcements, err := i.mfaLoginEnforcements(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(enforcements) == 0 {
+		return nil, nil
+	}
+
+	var groupIDs []string
+	if entity != nil {
+		directGroups, inheritedGroups, err := i.groupsByEntityID(entity.ID)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to fetch group memberships: {{err}}", err)
+		}
+		for _, group := range append(directGroups, inheritedGroups...) {
+			groupIDs = append(groupIDs, group.ID)
+		}
+	}
+
+	requirements := make(map[string][]string)
+	for _, enforcement := range enforcements {
+		applies := false
+		switch {
+		case mEntry != nil && strutil.StrListContains(enforcement.AuthMethodAccessors, mEntry.Accessor):
+			applies = true
+		case mEntry != nil && strutil.StrListContains(enforcement.AuthMethodTypes, mEntry.Type):
+			applies = true
+		case entity != nil && strutil.StrListContains(enforcement.IdentityEntityIDs, entity.ID):
+			applies = true
+		default:
+			for _, groupID := range groupIDs {
+				if strutil.StrListContains(enforcement.IdentityGroupIDs, groupID) {
+					applies = true
+					break
+				}
+			}
+		}
+
+		if applies {
+			requirements[enforcement.Name] = enforcement.MFAMethodNames
+		}
+	}
+
+	return requirements, nil
+}
+
+// holdLoginForMFA stores the login until its MFA requirements are met and
+// returns the response telling the client which passcodes are expected
+func (i *IdentityStore) holdLoginForMFA(ns *namespace.Namespace, path string, resp *logical.Response, entity *identity.Entity, requirements map[string][]string) (*logical.Response, error) {
+	if entity == nil {
+		return logical.ErrorResponse("MFA is required for this login but it is not associated with an entity"), logical.ErrPermissionDenied
+	}
+
+	requestID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	i.mfaPendingLogins.Set(requestID, &mfaPendingLogin{
+		namespaceID:  ns.ID,
+		path:         path,
+		resp:         resp,
+		entityID:     entity.ID,
+		requirements: requirements,
+	}, mfaPendingLoginTTL)
+
+	constraints := make(map[string]interface{}, len(requirements))
+	for name, methods := range requirements {
+		constraints[name] = methods
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"mfa_request_id":  requestID,
+			"mfa_constraints": constraints,
+		},
+		Warnings: resp.Warnings,
+	}, nil
+}
+
+// validateLoginMFA checks the passcodes given for a pending login. On
+// success the login is released so that its token can be created. The
+// pending login is used up by the first validation attempt whether it
+// succeeds or not, so passcodes cannot be guessed against it.
+func (i *IdentityStore) validateLoginMFA(ctx context.Context, req *logical.Request) (*mfaPendingLogin, *logical.Response, error) {
+	requestID, _ := req.Data["mfa_request_id"].(string)
+	if requestID == "" {
+		return nil, logical.ErrorResponse("missing mfa_request_id"), logical.ErrInvalidRequest
+	}
+
+	payload, ok := req.Data["mfa_payload"].(map[string]interface{})
+	if !ok || len(payload) == 0 {
+		return nil, logical.ErrorResponse("missing mfa_payload"), logical.ErrInvalidRequest
+	}
+
+	passcodes := make(map[string]string, len(payload))
+	for methodName, raw := range payload {
+		passcode, err := mfaPasscode(raw)
+		if err != nil {
+			return nil, logical.ErrorResponse(fmt.Sprintf("invalid passcode for MFA method %q: %v", methodName, err)), logical.ErrInvalidRequest
+		}
+		passcodes[methodName] = passcode
+	}
+
+	pending := i.takeMFAPendingLogin(requestID)
+	if pending == nil {
+		return nil, logical.ErrorResponse("invalid or expired mfa_request_id"), logical.ErrInvalidRequest
+	}
+
+	// Each enforcement must be satisfied by the passcode of one of its methods
+	names := make([]string, 0, len(pending.requirements))
+	for name := range pending.requirements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		satisfied := false
+		for _, methodName := range pending.requirements[name] {
+			passcode, ok := passcodes[methodName]
+			if !ok {
+				continue
+			}
+			valid, err := i.validateTOTPPasscode(ctx, methodName, pending.entityID, passcode)
+			if err != nil {
+				return nil, nil, err
+			}
+			if valid {
+				satisfied = true
+				break
+			}
+		}
+
+		if !satisfied {
+			return nil, logical.ErrorResponse(fmt.Sprintf("MFA requirement of login enforcement %q was not satisfied, the login must be retried", name)), logical.ErrPermissionDenied
+		}
+	}
+
+	return pending, nil, nil
+}
+
+// takeMFAPendingLogin removes the pending login with the given request ID
+// and returns it, or nil if there is none
+func (i *IdentityStore) takeMFAPendingLogin(requestID string) *mfaPendingLogin {
+	i.mfaPendingLoginsLock.Lock()
+	defer i.mfaPendingLoginsLock.Unlock()
+
+	raw, ok := i.mfaPendingLogins.Get(requestID)
+	if !ok {
+		return nil
+	}
+	i.mfaPendingLogins.Delete(requestID)
+	return raw.(*mfaPendingLogin)
+}
+
+// mfaPasscode returns the single passcode given for a method, either as a
+// string or as a list holding one string
+func mfaPasscode(raw interface{}) (string, error) {
+	switch passcode := raw.(type) {
+	case string:
+		return passcode, nil
+	case []string:
+		if len(passcode) == 1 {
+			return passcode[0], nil
+		}
+	case []interface{}:
+		if len(passcode) == 1 {
+			if s, ok := passcode[0].(string); ok {
+				return s, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("exactly one passcode string must be given")
+}
+
+// validateTOTPPasscode validates a passcode against the entity's secret of
+// the given TOTP method. As in the TOTP secrets engine, a passcode can only
+// be used once during the periods it is valid in.
+func (i *IdentityStore) validateTOTPPasscode(ctx context.Context, methodName, entityID, passcode string) (bool, error) {
+	secret, err := i.mfaTOTPSecret(ctx, methodName, entityID)
+	if err != nil {
+		return false, err
+	}
+	if secret == nil || passcode == "" {
+		return false, nil
+	}
+
+	usedName := strings.Join([]string{methodName, entityID, passcode}, "_")
+	if _, ok := i.mfaUsedCodes.Get(usedName); ok {
+		return false, nil
+	}
+
+	valid, err := totplib.ValidateCustom(passcode, secret.Key, time.Now(), totplib.ValidateOpts{
+		Period:    secret.Period,
+		Skew:      secret.Skew,
+		Digits:    secret.Digits,
+		Algorithm: secret.Algorithm,
+	})
+	if err != nil && err != otplib.ErrValidateInputInvalidLength {
+		return false, errwrap.Wrapf("failed to validate TOTP passcode: {{err}}", err)
+	}
+	if !valid {
+		return false, nil
+	}
+
+	// Take the key skew, add two for behind and in front, and multiply that
+	// by the period to cover the full possibility of the validity of the key
+	i.mfaUsedCodes.Set(usedName, nil, time.Duration(
+		int64(time.Second)*
+			int64(secret.Period)*
+			int64((2+secret.Skew))))
+
+	return true, nil
+}
@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+)
+
+func TestLoginMFA_TOTP(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies: []string{"foo"},
+				Alias: &logical.Alias{
+					Name: "armon",
+				},
+				DisplayName: "armon",
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	handle := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		resp, err := c.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+		return resp
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	handle(req)
+	accessor := c.router.MatchingMountEntry("auth/foo/").Accessor
+
+	// Log in once to create the entity
+	resp := handle(&logical.Request{
+		Path: "auth/foo/login",
+	})
+	entityID := resp.Auth.EntityID
+	if entityID == "" {
+		t.Fatalf("expected an entity, got %#v", resp.Auth)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/mfa/method/totp/my_totp")
+	req.Data["issuer"] = "vault"
+	req.ClientToken = root
+	handle(req)
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/mfa/method/totp/my_totp/admin-generate")
+	req.Data["entity_id"] = entityID
+	req.ClientToken = root
+	resp = handle(req)
+	key, err := otplib.NewKeyFromURL(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second secret cannot be generated for the same entity
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error generating a second secret, got %#v", resp)
+	}
+
+	// Enforcements cannot refer to unknown methods
+	req = logical.TestRequest(t, logical.UpdateOperation, "identity/mfa/login-enforcement/foo")
+	req.Data["mfa_method_names"] = "unknown"
+	req.Data["auth_method_accessors"] = accessor
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	req.Data["mfa_method_names"] = "my_totp"
+	handle(req)
+
+	// The login is now held until the passcode is validated
+	resp = handle(&logical.Request{
+		Path: "auth/foo/login",
+	})
+	if resp.Auth != nil {
+		t.Fatalf("expected no auth, got %#v", resp.Auth)
+	}
+	requestID := resp.Data["mfa_request_id"].(string)
+	if requestID == "" {
+		t.Fatalf("expected an MFA request ID, got %#v", resp.Data)
+	}
+
+	validateRaw := func(passcode interface{}) (*logical.Response, error) {
+		return c.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "sys/mfa/validate",
+			Data: map[string]interface{}{
+				"mfa_request_id": requestID,
+				"mfa_payload": map[string]interface{}{
+					"my_totp": passcode,
+				},
+			},
+		})
+	}
+	validate := func(passcode string) (*logical.Response, error) {
+		return validateRaw(passcode)
+	}
+	login := func() string {
+		resp := handle(&logical.Request{
+			Path: "auth/foo/login",
+		})
+		return resp.Data["mfa_request_id"].(string)
+	}
+
+	passcode, err := totplib.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a single passcode can be given for a method
+	resp, err = validateRaw([]interface{}{"000000", passcode})
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request, got %v, resp: %#v", err, resp)
+	}
+
+	// A wrong passcode uses up the request ID, even for the right passcode
+	resp, err = validate("000000")
+	if err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got %v, resp: %#v", err, resp)
+	}
+	resp, err = validate(passcode)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request, got %v, resp: %#v", err, resp)
+	}
+
+	requestID = login()
+	resp, err = validateRaw([]interface{}{passcode})
+	if err != nil {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		t.Fatalf("expected a token, got %#v", resp)
+	}
+
+	te, err := c.tokenStore.Lookup(context.Background(), resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te.Path != "auth/foo/login" || te.EntityID != entityID {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// The pending login can only be completed once
+	resp, err = validate(passcode)
+	if err == nil {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	// Methods in use cannot be deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "identity/mfa/method/totp/my_totp")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+}
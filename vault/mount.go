@@ -13,6 +13,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/mitchellh/copystructure"
@@ -135,30 +136,41 @@ func (t *MountTable) shallowClone() *MountTable {
 	return mt
 }
 
-// setTaint is used to set the taint on given entry
-func (t *MountTable) setTaint(path string, value bool) *MountEntry {
+// setTaint is used to set the taint on given entry of the namespace in the
+// context
+func (t *MountTable) setTaint(ctx context.Context, path string, value bool) (*MountEntry, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	n := len(t.Entries)
 	for i := 0; i < n; i++ {
-		if t.Entries[i].Path == path {
+		if entry := t.Entries[i]; entry.Path == path && entry.Namespace().ID == ns.ID {
 			t.Entries[i].Tainted = value
-			return t.Entries[i]
+			return t.Entries[i], nil
 		}
 	}
-	return nil
+	return nil, nil
 }
 
-// remove is used to remove a given path entry; returns the entry that was
-// removed
-func (t *MountTable) remove(path string) *MountEntry {
+// remove is used to remove a given path entry of the namespace in the
+// context; returns the entry that was removed
+func (t *MountTable) remove(ctx context.Context, path string) (*MountEntry, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	n := len(t.Entries)
 	for i := 0; i < n; i++ {
-		if entry := t.Entries[i]; entry.Path == path {
+		if entry := t.Entries[i]; entry.Path == path && entry.Namespace().ID == ns.ID {
 			t.Entries[i], t.Entries[n-1] = t.Entries[n-1], nil
 			t.Entries = t.Entries[:n-1]
-			return entry
+			return entry, nil
 		}
 	}
-	return nil
+	return nil, nil
 }
 
 // sortEntriesByPath sorts the entries in the table by path and returns the
@@ -184,6 +196,11 @@ type MountEntry struct {
 	Local            bool              `json:"local"`              // Local mounts are not replicated or affected by replication
 	SealWrap         bool              `json:"seal_wrap"`          // Whether to wrap CSPs
 	Tainted          bool              `json:"tainted,omitempty"`  // Set as a Write-Ahead flag for unmount/remount
+	NamespaceID      string            `json:"namespace_id"`       // ID of the namespace the mount belongs to; Path is relative to it
+
+	// namespace is the namespace referred to by NamespaceID, set when the
+	// entry is mounted or loaded
+	namespace *namespace.Namespace
 
 	// synthesizedConfigCache is used to cache configuration values. These
 	// particular values are cached since we want to get them at a point-in-time
@@ -202,6 +219,7 @@ type MountConfig struct {
 	AuditNonHMACResponseKeys  []string              `json:"audit_non_hmac_response_keys,omitempty" structs:"audit_non_hmac_response_keys" mapstructure:"audit_non_hmac_response_keys"`
 	ListingVisibility         ListingVisibilityType `json:"listing_visibility,omitempty" structs:"listing_visibility" mapstructure:"listing_visibility"`
 	PassthroughRequestHeaders []string              `json:"passthrough_request_headers,omitempty" structs:"passthrough_request_headers" mapstructure:"passthrough_request_headers"`
+	TokenType                 logical.TokenType     `json:"token_type,omitempty" structs:"token_type" mapstructure:"token_type"`
 }
 
 // APIMountConfig is an embedded struct of api.MountConfigInput
@@ -214,6 +232,7 @@ type APIMountConfig struct {
 	AuditNonHMACResponseKeys  []string              `json:"audit_non_hmac_response_keys,omitempty" structs:"audit_non_hmac_response_keys" mapstructure:"audit_non_hmac_response_keys"`
 	ListingVisibility         ListingVisibilityType `json:"listing_visibility,omitempty" structs:"listing_visibility" mapstructure:"listing_visibility"`
 	PassthroughRequestHeaders []string              `json:"passthrough_request_headers,omitempty" structs:"passthrough_request_headers" mapstructure:"passthrough_request_headers"`
+	TokenType                 string                `json:"token_type,omitempty" structs:"token_type" mapstructure:"token_type"`
 }
 
 // Clone returns a deep copy of the mount entry
@@ -222,7 +241,33 @@ func (e *MountEntry) Clone() (*MountEntry, error) {
 	if err != nil {
 		return nil, err
 	}
-	return cp.(*MountEntry), nil
+	cpEntry := cp.(*MountEntry)
+	cpEntry.namespace = e.namespace
+	return cpEntry, nil
+}
+
+// Namespace returns the namespace the mount belongs to
+func (e *MountEntry) Namespace() *namespace.Namespace {
+	if e.namespace == nil {
+		return namespace.RootNamespace
+	}
+	return e.namespace
+}
+
+// APIPath returns the full path requests to the mount are routed by,
+// including the namespace path and, for auth methods, the auth/ prefix
+func (e *MountEntry) APIPath() string {
+	path := e.Path
+	if e.Table == credentialTableType {
+		path = credentialRoutePrefix + path
+	}
+	return e.Namespace().Path + path
+}
+
+// setNamespace sets the namespace of the entry to the given one
+func (e *MountEntry) setNamespace(ns *namespace.Namespace) {
+	e.NamespaceID = ns.ID
+	e.namespace = ns
 }
 
 // SyncCache syncs tunable configuration values to the cache. In the case of
@@ -272,11 +317,17 @@ func (c *Core) mount(ctx context.Context, entry *MountEntry) error {
 }
 
 func (c *Core) mountInternal(ctx context.Context, entry *MountEntry) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	entry.setNamespace(ns)
+
 	c.mountsLock.Lock()
 	defer c.mountsLock.Unlock()
 
 	// Verify there are no conflicting mounts
-	if match := c.router.MountConflict(entry.Path); match != "" {
+	if match := c.router.MountConflict(entry.APIPath()); match != "" {
 		return logical.CodedError(409, fmt.Sprintf("existing mount at %s", match))
 	}
 
@@ -317,7 +368,6 @@ func (c *Core) mountInternal(ctx context.Context, entry *MountEntry) error {
 	defer view.setReadOnlyErr(nil)
 
 	var backend logical.Backend
-	var err error
 	sysView := c.mountEntrySysView(entry)
 
 	// Consider having plugin name under entry.Options
@@ -345,12 +395,12 @@ func (c *Core) mountInternal(ctx context.Context, entry *MountEntry) error {
 	}
 	c.mounts = newTable
 
-	if err := c.router.Mount(backend, entry.Path, entry, view); err != nil {
+	if err := c.router.Mount(backend, entry.APIPath(), entry, view); err != nil {
 		return err
 	}
 
 	if c.logger.IsInfo() {
-		c.logger.Info("successful mount", "path", entry.Path, "type", entry.Type)
+		c.logger.Info("successful mount", "path", entry.APIPath(), "type", entry.Type)
 	}
 	return nil
 }
@@ -373,40 +423,46 @@ func (c *Core) unmount(ctx context.Context, path string) error {
 }
 
 func (c *Core) unmountInternal(ctx context.Context, path string) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	fullPath := ns.Path + path
+
 	// Verify exact match of the route
-	match := c.router.MatchingMount(path)
-	if match == "" || path != match {
+	match := c.router.MatchingMount(fullPath)
+	if match == "" || fullPath != match {
 		return fmt.Errorf("no matching mount")
 	}
 
 	// Get the view for this backend
-	view := c.router.MatchingStorageByAPIPath(path)
+	view := c.router.MatchingStorageByAPIPath(fullPath)
 
 	// Get the backend/mount entry for this path, used to remove ignored
 	// replication prefixes
-	backend := c.router.MatchingBackend(path)
-	entry := c.router.MatchingMountEntry(path)
+	backend := c.router.MatchingBackend(fullPath)
+	entry := c.router.MatchingMountEntry(fullPath)
 
 	// Mark the entry as tainted
 	if err := c.taintMountEntry(ctx, path); err != nil {
-		c.logger.Error("failed to taint mount entry for path being unmounted", "error", err, "path", path)
+		c.logger.Error("failed to taint mount entry for path being unmounted", "error", err, "path", fullPath)
 		return err
 	}
 
 	// Taint the router path to prevent routing. Note that in-flight requests
 	// are uncertain, right now.
-	if err := c.router.Taint(path); err != nil {
+	if err := c.router.Taint(fullPath); err != nil {
 		return err
 	}
 
 	if backend != nil {
 		// Invoke the rollback manager a final time
-		if err := c.rollback.Rollback(path); err != nil {
+		if err := c.rollback.Rollback(fullPath); err != nil {
 			return err
 		}
 
 		// Revoke all the dynamic keys
-		if err := c.expiration.RevokePrefix(path); err != nil {
+		if err := c.expiration.RevokePrefix(fullPath); err != nil {
 			return err
 		}
 
@@ -415,7 +471,7 @@ func (c *Core) unmountInternal(ctx context.Context, path string) error {
 	}
 
 	// Unmount the backend entirely
-	if err := c.router.Unmount(ctx, path); err != nil {
+	if err := c.router.Unmount(ctx, fullPath); err != nil {
 		return err
 	}
 
@@ -423,19 +479,19 @@ func (c *Core) unmountInternal(ctx context.Context, path string) error {
 	case entry.Local, !c.ReplicationState().HasState(consts.ReplicationPerformanceSecondary):
 		// Have writable storage, remove the whole thing
 		if err := logical.ClearView(ctx, view); err != nil {
-			c.logger.Error("failed to clear view for path being unmounted", "error", err, "path", path)
+			c.logger.Error("failed to clear view for path being unmounted", "error", err, "path", fullPath)
 			return err
 		}
 	}
 
 	// Remove the mount table entry
 	if err := c.removeMountEntry(ctx, path); err != nil {
-		c.logger.Error("failed to remove mount entry for path being unmounted", "error", err, "path", path)
+		c.logger.Error("failed to remove mount entry for path being unmounted", "error", err, "path", fullPath)
 		return err
 	}
 
 	if c.logger.IsInfo() {
-		c.logger.Info("successfully unmounted", "path", path)
+		c.logger.Info("successfully unmounted", "path", fullPath)
 	}
 	return nil
 }
@@ -447,7 +503,10 @@ func (c *Core) removeMountEntry(ctx context.Context, path string) error {
 
 	// Remove the entry from the mount table
 	newTable := c.mounts.shallowClone()
-	entry := newTable.remove(path)
+	entry, err := newTable.remove(ctx, path)
+	if err != nil {
+		return err
+	}
 	if entry == nil {
 		c.logger.Error("nil entry found removing entry in mounts table", "path", path)
 		return logical.CodedError(500, "failed to remove entry in mounts table")
@@ -476,7 +535,10 @@ func (c *Core) taintMountEntry(ctx context.Context, path string) error {
 
 	// As modifying the taint of an entry affects shallow clones,
 	// we simply use the original
-	entry := c.mounts.setTaint(path, true)
+	entry, err := c.mounts.setTaint(ctx, path, true)
+	if err != nil {
+		return err
+	}
 	if entry == nil {
 		c.logger.Error("nil entry found tainting entry in mounts table", "path", path)
 		return logical.CodedError(500, "failed to taint entry in mounts table")
@@ -494,12 +556,17 @@ func (c *Core) taintMountEntry(ctx context.Context, path string) error {
 // remountForce takes a copy of the mount entry for the path and fully unmounts
 // and remounts the backend to pick up any changes, such as filtered paths
 func (c *Core) remountForce(ctx context.Context, path string) error {
-	me := c.router.MatchingMountEntry(path)
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	me := c.router.MatchingMountEntry(ns.Path + path)
 	if me == nil {
 		return fmt.Errorf("cannot find mount for path %q", path)
 	}
 
-	me, err := me.Clone()
+	me, err = me.Clone()
 	if err != nil {
 		return err
 	}
@@ -527,14 +594,21 @@ func (c *Core) remount(ctx context.Context, src, dst string) error {
 		}
 	}
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	fullSrc := ns.Path + src
+	fullDst := ns.Path + dst
+
 	// Verify exact match of the route
-	match := c.router.MatchingMount(src)
-	if match == "" || src != match {
+	match := c.router.MatchingMount(fullSrc)
+	if match == "" || fullSrc != match {
 		return fmt.Errorf("no matching mount at %q", src)
 	}
 
-	if match := c.router.MatchingMount(dst); match != "" {
-		return fmt.Errorf("existing mount at %q", match)
+	if match := c.router.MatchingMount(fullDst); match != "" {
+		return fmt.Errorf("existing mount at %q", ns.TrimmedPath(match))
 	}
 
 	// Mark the entry as tainted
@@ -543,24 +617,25 @@ func (c *Core) remount(ctx context.Context, src, dst string) error {
 	}
 
 	// Taint the router path to prevent routing
-	if err := c.router.Taint(src); err != nil {
+	if err := c.router.Taint(fullSrc); err != nil {
 		return err
 	}
 
 	// Invoke the rollback manager a final time
-	if err := c.rollback.Rollback(src); err != nil {
+	if err := c.rollback.Rollback(fullSrc); err != nil {
 		return err
 	}
 
 	// Revoke all the dynamic keys
-	if err := c.expiration.RevokePrefix(src); err != nil {
+	if err := c.expiration.RevokePrefix(fullSrc); err != nil {
 		return err
 	}
 
 	c.mountsLock.Lock()
 	var entry *MountEntry
-	for _, entry = range c.mounts.Entries {
-		if entry.Path == src {
+	for _, mountEntry := range c.mounts.Entries {
+		if mountEntry.Path == src && mountEntry.Namespace().ID == ns.ID {
+			entry = mountEntry
 			entry.Path = dst
 			entry.Tainted = false
 			break
@@ -584,17 +659,17 @@ func (c *Core) remount(ctx context.Context, src, dst string) error {
 	c.mountsLock.Unlock()
 
 	// Remount the backend
-	if err := c.router.Remount(src, dst); err != nil {
+	if err := c.router.Remount(fullSrc, fullDst); err != nil {
 		return err
 	}
 
 	// Un-taint the path
-	if err := c.router.Untaint(dst); err != nil {
+	if err := c.router.Untaint(fullDst); err != nil {
 		return err
 	}
 
 	if c.logger.IsInfo() {
-		c.logger.Info("successful remount", "old_path", src, "new_path", dst)
+		c.logger.Info("successful remount", "old_path", fullSrc, "new_path", fullDst)
 	}
 	return nil
 }
@@ -678,7 +753,22 @@ func (c *Core) loadMounts(ctx context.Context) error {
 	}
 
 	// Upgrade to table-scoped entries
+	entries := c.mounts.Entries[:0]
 	for _, entry := range c.mounts.Entries {
+		// Entries created before namespaces existed belong to the root
+		// namespace
+		if entry.NamespaceID == "" {
+			entry.NamespaceID = namespace.RootNamespaceID
+			needPersist = true
+		}
+		ns := c.namespaceByID(entry.NamespaceID)
+		if ns == nil {
+			c.logger.Warn("skipping mount entry of missing namespace", "namespace_id", entry.NamespaceID, "path", entry.Path)
+			continue
+		}
+		entry.namespace = ns
+		entries = append(entries, entry)
+
 		if entry.Type == "cubbyhole" && !entry.Local {
 			entry.Local = true
 			needPersist = true
@@ -707,6 +797,7 @@ func (c *Core) loadMounts(ctx context.Context) error {
 		// Sync values to the cache
 		entry.SyncCache()
 	}
+	c.mounts.Entries = entries
 
 	// Done if we have restored the mount table and we don't need
 	// to persist
@@ -861,19 +952,19 @@ func (c *Core) setupMounts(ctx context.Context) error {
 
 	ROUTER_MOUNT:
 		// Mount the backend
-		err = c.router.Mount(backend, entry.Path, entry, view)
+		err = c.router.Mount(backend, entry.APIPath(), entry, view)
 		if err != nil {
-			c.logger.Error("failed to mount entry", "path", entry.Path, "error", err)
+			c.logger.Error("failed to mount entry", "path", entry.APIPath(), "error", err)
 			return errLoadMountsFailed
 		}
 
 		if c.logger.IsInfo() {
-			c.logger.Info("successfully mounted backend", "type", entry.Type, "path", entry.Path)
+			c.logger.Info("successfully mounted backend", "type", entry.Type, "path", entry.APIPath())
 		}
 
 		// Ensure the path is tainted if set in the mount table
 		if entry.Tainted {
-			c.router.Taint(entry.Path)
+			c.router.Taint(entry.APIPath())
 		}
 	}
 	return nil
@@ -888,7 +979,7 @@ func (c *Core) unloadMounts(ctx context.Context) error {
 	if c.mounts != nil {
 		mountTable := c.mounts.shallowClone()
 		for _, e := range mountTable.Entries {
-			backend := c.router.MatchingBackend(e.Path)
+			backend := c.router.MatchingBackend(e.APIPath())
 			if backend != nil {
 				backend.Cleanup(ctx)
 			}
@@ -975,6 +1066,7 @@ func (c *Core) defaultMountTable() *MountTable {
 		UUID:             mountUUID,
 		Accessor:         mountAccessor,
 		BackendAwareUUID: bUUID,
+		NamespaceID:      namespace.RootNamespaceID,
 		Options: map[string]string{
 			"version": "1",
 		},
@@ -1014,6 +1106,7 @@ func (c *Core) requiredMountTable() *MountTable {
 		Accessor:         cubbyholeAccessor,
 		Local:            true,
 		BackendAwareUUID: cubbyholeBackendUUID,
+		NamespaceID:      namespace.RootNamespaceID,
 	}
 
 	sysUUID, err := uuid.GenerateUUID()
@@ -1036,6 +1129,7 @@ func (c *Core) requiredMountTable() *MountTable {
 		UUID:             sysUUID,
 		Accessor:         sysAccessor,
 		BackendAwareUUID: sysBackendUUID,
+		NamespaceID:      namespace.RootNamespaceID,
 	}
 
 	identityUUID, err := uuid.GenerateUUID()
@@ -1058,6 +1152,7 @@ func (c *Core) requiredMountTable() *MountTable {
 		UUID:             identityUUID,
 		Accessor:         identityAccessor,
 		BackendAwareUUID: identityBackendUUID,
+		NamespaceID:      namespace.RootNamespaceID,
 	}
 
 	table.Entries = append(table.Entries, cubbyholeMount)
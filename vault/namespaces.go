@@ -0,0 +1,433 @@
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/armon/go-radix"
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// namespaceStoreSubPath is the sub-path used for the namespace store
+	// view. This is nested under the core prefix.
+	namespaceStoreSubPath = "core/namespaces/"
+
+	// namespaceBarrierPrefix is the prefix to the namespace ID used in the
+	// barrier view for data that is scoped to a namespace, such as its
+	// policies
+	namespaceBarrierPrefix = "namespaces/"
+
+	// namespaceIDLength is the length of the random IDs given to namespaces
+	namespaceIDLength = 5
+
+	namespaceIDChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+var (
+	// namespaceSingletonPaths are the paths of the singleton backends of the
+	// root namespace that are exposed in every other namespace as well. The
+	// backends scope their behavior by the namespace of the request.
+	namespaceSingletonPaths = []string{
+		"sys/",
+		"cubbyhole/",
+		"identity/",
+		credentialRoutePrefix + "token/",
+	}
+
+	// namespaceSysPaths are the system backend paths that can be used
+	// outside of the root namespace. Everything else under sys/ operates on
+	// the Vault server as a whole and is only available in the root
+	// namespace.
+	namespaceSysPaths = []string{
+		"auth",
+		"capabilities",
+		"capabilities-accessor",
+		"capabilities-self",
+		"internal/ui/mounts",
+		"internal/ui/resultant-acl",
+		"leases/lookup",
+		"leases/renew",
+		"leases/revoke",
+		"leases/revoke-prefix",
+		"mfa/validate",
+		"mounts",
+		"namespaces",
+		"policies/acl",
+		"policy",
+		"remount",
+		"renew",
+		"revoke",
+		"revoke-prefix",
+		"tools/hash",
+		"tools/random",
+		"wrapping/lookup",
+		"wrapping/rewrap",
+		"wrapping/unwrap",
+		"wrapping/wrap",
+	}
+
+	// errNamespaceNotFound is returned when operating on a namespace that
+	// does not exist
+	errNamespaceNotFound = errors.New("namespace not found")
+)
+
+// NamespaceStore is used to persist the namespaces nested under the root
+// namespace and to find the namespace a request path belongs to
+type NamespaceStore struct {
+	core   *Core
+	view   *BarrierView
+	logger log.Logger
+
+	// lock protects the indexes below and serializes the creation and
+	// deletion of namespaces
+	lock   sync.RWMutex
+	byID   map[string]*namespace.Namespace
+	byPath *radix.Tree
+}
+
+// NewNamespaceStore creates a namespace store backed by the given view and
+// loads the existing namespaces from it
+func NewNamespaceStore(ctx context.Context, core *Core, view *BarrierView, logger log.Logger) (*NamespaceStore, error) {
+	ns := &NamespaceStore{
+		core:   core,
+		view:   view,
+		logger: logger,
+		byID:   make(map[string]*namespace.Namespace),
+		byPath: radix.New(),
+	}
+
+	keys, err := logical.CollectKeys(ctx, view)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to list namespaces: {{err}}", err)
+	}
+
+	for _, key := range keys {
+		entry, err := view.Get(ctx, key)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to read namespace %q: {{err}}", key), err)
+		}
+		if entry == nil {
+			continue
+		}
+
+		n := new(namespace.Namespace)
+		if err := entry.DecodeJSON(n); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to decode namespace %q: {{err}}", key), err)
+		}
+
+		ns.byID[n.ID] = n
+		ns.byPath.Insert(n.Path, n)
+	}
+
+	return ns, nil
+}
+
+// setupNamespaceStore is used to load the namespaces when the vault is being
+// unsealed. It must run before the mount tables are loaded since mount
+// entries refer to the namespace they belong to.
+func (c *Core) setupNamespaceStore(ctx context.Context) error {
+	view := NewBarrierView(c.barrier, namespaceStoreSubPath)
+	store, err := NewNamespaceStore(ctx, c, view, c.logger.ResetNamed("namespaces"))
+	if err != nil {
+		c.logger.Error("failed to load namespaces", "error", err)
+		return err
+	}
+
+	c.namespaceStore = store
+	return nil
+}
+
+// setupNamespaceRoutes exposes the singleton backends under every namespace
+// once the root namespace's mounts and auth methods have been set up
+func (c *Core) setupNamespaceRoutes(ctx context.Context) error {
+	for _, ns := range c.namespaceStore.all() {
+		if err := c.router.mountNamespace(ns.Path, namespaceSingletonPaths); err != nil {
+			c.logger.Error("failed to set up namespace routes", "path", ns.Path, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// teardownNamespaceStore is used to reverse setupNamespaceStore when the
+// vault is being sealed
+func (c *Core) teardownNamespaceStore() {
+	c.namespaceStore = nil
+}
+
+// namespaceByPath returns the deepest namespace the given request path
+// belongs to, which is the root namespace if it isn't inside any other
+func (c *Core) namespaceByPath(path string) *namespace.Namespace {
+	if c.namespaceStore == nil {
+		return namespace.RootNamespace
+	}
+	return c.namespaceStore.namespaceByPath(path)
+}
+
+// namespaceByID returns the namespace with the given ID, or nil if it does
+// not exist. Entries persisted before namespaces existed have an empty ID
+// and belong to the root namespace.
+func (c *Core) namespaceByID(id string) *namespace.Namespace {
+	if id == "" || id == namespace.RootNamespaceID {
+		return namespace.RootNamespace
+	}
+	if c == nil || c.namespaceStore == nil {
+		return nil
+	}
+	return c.namespaceStore.namespaceByID(id)
+}
+
+func (ns *NamespaceStore) namespaceByPath(path string) *namespace.Namespace {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+
+	// Namespace paths end in a slash, so a request to the namespace path
+	// itself without one still belongs to it
+	if !strings.HasSuffix(path, "/") {
+		if raw, ok := ns.byPath.Get(path + "/"); ok {
+			return raw.(*namespace.Namespace)
+		}
+	}
+
+	_, raw, ok := ns.byPath.LongestPrefix(path)
+	if !ok {
+		return namespace.RootNamespace
+	}
+	return raw.(*namespace.Namespace)
+}
+
+func (ns *NamespaceStore) namespaceByID(id string) *namespace.Namespace {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	return ns.byID[id]
+}
+
+// all returns every namespace other than the root namespace, sorted by path
+// so that parents come before their children
+func (ns *NamespaceStore) all() []*namespace.Namespace {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+
+	ret := make([]*namespace.Namespace, 0, len(ns.byID))
+	ns.byPath.Walk(func(_ string, raw interface{}) bool {
+		ret = append(ret, raw.(*namespace.Namespace))
+		return false
+	})
+	return ret
+}
+
+// children returns the namespaces directly nested under the given one
+func (ns *NamespaceStore) children(parent *namespace.Namespace) []*namespace.Namespace {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	return ns.childrenLocked(parent)
+}
+
+func (ns *NamespaceStore) childrenLocked(parent *namespace.Namespace) []*namespace.Namespace {
+	var ret []*namespace.Namespace
+	ns.byPath.WalkPrefix(parent.Path, func(path string, raw interface{}) bool {
+		rest := strings.TrimSuffix(strings.TrimPrefix(path, parent.Path), "/")
+		if rest != "" && !strings.Contains(rest, "/") {
+			ret = append(ret, raw.(*namespace.Namespace))
+		}
+		return false
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
+
+// generateID returns a random namespace ID that is not already in use. The
+// lock must be held.
+func (ns *NamespaceStore) generateID() (string, error) {
+	buf := make([]byte, namespaceIDLength)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for i, b := range buf {
+			buf[i] = namespaceIDChars[int(b)%len(namespaceIDChars)]
+		}
+
+		id := string(buf)
+		if _, ok := ns.byID[id]; !ok && id != namespace.RootNamespaceID {
+			return id, nil
+		}
+	}
+}
+
+// createNamespace creates a namespace with the given name nested under the
+// parent namespace. If it already exists the existing namespace is returned.
+func (c *Core) createNamespace(ctx context.Context, parent *namespace.Namespace, name string) (*namespace.Namespace, error) {
+	store := c.namespaceStore
+	if store == nil {
+		return nil, ErrInternalError
+	}
+
+	name = strings.Trim(name, "/")
+	switch {
+	case name == "":
+		return nil, logical.CodedError(400, "missing namespace name")
+	case strings.Contains(name, "/"):
+		return nil, logical.CodedError(400, "namespace names cannot contain slashes")
+	}
+	for _, p := range protectedMounts {
+		if name+"/" == p {
+			return nil, logical.CodedError(400, fmt.Sprintf("%q is a reserved path and cannot be used as a namespace name", name))
+		}
+	}
+
+	nsPath := parent.Path + name + "/"
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if raw, ok := store.byPath.Get(nsPath); ok {
+		return raw.(*namespace.Namespace), nil
+	}
+
+	if conflict := c.router.MountConflict(nsPath); conflict != "" {
+		return nil, logical.CodedError(409, fmt.Sprintf("existing mount at %s", conflict))
+	}
+
+	id, err := store.generateID()
+	if err != nil {
+		return nil, err
+	}
+	ns := &namespace.Namespace{
+		ID:   id,
+		Path: nsPath,
+	}
+
+	entry, err := logical.StorageEntryJSON(ns.ID, ns)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to create namespace entry: {{err}}", err)
+	}
+	if err := store.view.Put(ctx, entry); err != nil {
+		return nil, errwrap.Wrapf("failed to persist namespace: {{err}}", err)
+	}
+
+	store.byID[ns.ID] = ns
+	store.byPath.Insert(ns.Path, ns)
+
+	if err := c.router.mountNamespace(ns.Path, namespaceSingletonPaths); err != nil {
+		return nil, err
+	}
+
+	// Every namespace gets its own default policy, which its tokens are
+	// given unless asked otherwise
+	nsCtx := namespace.ContextWithNamespace(ctx, ns)
+	if err := c.policyStore.loadACLPolicy(nsCtx, defaultPolicyName, defaultPolicy); err != nil {
+		return nil, err
+	}
+
+	if c.logger.IsInfo() {
+		c.logger.Info("created namespace", "path", ns.Path, "id", ns.ID)
+	}
+	return ns, nil
+}
+
+// deleteNamespace removes the given namespace. Everything it contains is
+// torn down first: mounts and auth methods are removed, which revokes their
+// leases and the tokens issued by them, and its policies, token roles and
+// identity artifacts are deleted.
+func (c *Core) deleteNamespace(ctx context.Context, ns *namespace.Namespace) error {
+	store := c.namespaceStore
+	if store == nil {
+		return ErrInternalError
+	}
+	if ns.ID == namespace.RootNamespaceID {
+		return logical.CodedError(400, "cannot delete the root namespace")
+	}
+
+	if len(store.children(ns)) > 0 {
+		return logical.CodedError(400, fmt.Sprintf("namespace %q contains child namespaces which must be deleted first", ns.Path))
+	}
+
+	nsCtx := namespace.ContextWithNamespace(ctx, ns)
+
+	// Collect the mounts and auth methods of the namespace
+	var mountPaths, authPaths []string
+	c.mountsLock.RLock()
+	for _, entry := range c.mounts.Entries {
+		if entry.NamespaceID == ns.ID {
+			mountPaths = append(mountPaths, entry.Path)
+		}
+	}
+	c.mountsLock.RUnlock()
+	c.authLock.RLock()
+	for _, entry := range c.auth.Entries {
+		if entry.NamespaceID == ns.ID {
+			authPaths = append(authPaths, entry.Path)
+		}
+	}
+	c.authLock.RUnlock()
+
+	for _, path := range mountPaths {
+		if err := c.unmount(nsCtx, path); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to unmount %q: {{err}}", ns.Path+path), err)
+		}
+	}
+	for _, path := range authPaths {
+		if err := c.disableCredential(nsCtx, path); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to disable auth method %q: {{err}}", ns.Path+credentialRoutePrefix+path), err)
+		}
+	}
+
+	// Revoke whatever is left, such as tokens created through the
+	// namespace's token store
+	if err := c.expiration.RevokePrefix(ns.Path); err != nil {
+		return errwrap.Wrapf("failed to revoke leases: {{err}}", err)
+	}
+
+	if c.identityStore != nil {
+		if err := c.identityStore.deleteNamespaceArtifacts(nsCtx); err != nil {
+			return errwrap.Wrapf("failed to delete identity artifacts: {{err}}", err)
+		}
+	}
+
+	if err := c.tokenStore.deleteNamespaceRoles(nsCtx); err != nil {
+		return errwrap.Wrapf("failed to delete token roles: {{err}}", err)
+	}
+
+	if err := c.policyStore.deleteNamespacePolicies(nsCtx); err != nil {
+		return errwrap.Wrapf("failed to delete policies: {{err}}", err)
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	c.router.unmountNamespace(ns.Path)
+
+	if err := store.view.Delete(ctx, ns.ID); err != nil {
+		return errwrap.Wrapf("failed to delete namespace: {{err}}", err)
+	}
+	delete(store.byID, ns.ID)
+	store.byPath.Delete(ns.Path)
+
+	if c.logger.IsInfo() {
+		c.logger.Info("deleted namespace", "path", ns.Path, "id", ns.ID)
+	}
+	return nil
+}
+
+// namespaceSysPathAllowed returns whether the given path, relative to the
+// system backend, can be used from a namespace other than the root
+func namespaceSysPathAllowed(path string) bool {
+	for _, p := range namespaceSysPaths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package vault
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testCreateNamespace(t *testing.T, c *Core, token, path string) string {
+	t.Helper()
+
+	resp, err := c.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        path,
+		ClientToken: token,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	if resp.Data["id"].(string) == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	return resp.Data["id"].(string)
+}
+
+func TestNamespaces_CRUD(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	id := testCreateNamespace(t, c, root, "sys/namespaces/ns1")
+
+	// Creating it again returns the same namespace
+	if again := testCreateNamespace(t, c, root, "sys/namespaces/ns1"); again != id {
+		t.Fatalf("expected %q, got %q", id, again)
+	}
+
+	// Nest a namespace under it
+	childID := testCreateNamespace(t, c, root, "ns1/sys/namespaces/child")
+
+	resp, err := c.HandleRequest(&logical.Request{
+		Operation:   logical.ListOperation,
+		Path:        "sys/namespaces",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"ns1/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "ns1/sys/namespaces/child",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"id":   childID,
+		"path": "child/",
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, resp.Data)
+	}
+
+	// A namespace with children cannot be deleted
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.DeleteOperation,
+		Path:        "sys/namespaces/ns1",
+		ClientToken: root,
+	})
+	if err == nil {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	for _, path := range []string{"ns1/sys/namespaces/child", "sys/namespaces/ns1"} {
+		resp, err = c.HandleRequest(&logical.Request{
+			Operation:   logical.DeleteOperation,
+			Path:        path,
+			ClientToken: root,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+	}
+
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "sys/namespaces/ns1",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("expected no namespace, got %#v", resp)
+	}
+}
+
+func TestNamespaces_Isolation(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	testCreateNamespace(t, c, root, "sys/namespaces/ns1")
+
+	// Mount a backend inside the namespace
+	resp, err := c.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "ns1/sys/mounts/kv",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"type": "kv",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	// The mount is only listed in its namespace
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "ns1/sys/mounts",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := resp.Data["kv/"]; !ok {
+		t.Fatalf("expected kv/ mount in namespace, got %#v", resp.Data)
+	}
+	if _, ok := resp.Data["secret/"]; ok {
+		t.Fatalf("did not expect root mounts in namespace, got %#v", resp.Data)
+	}
+
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "sys/mounts",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := resp.Data["kv/"]; ok {
+		t.Fatalf("did not expect namespace mounts in root, got %#v", resp.Data)
+	}
+
+	// Create a policy and a token in the namespace
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "ns1/sys/policy/kv-reader",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"policy": `path "kv/*" { capabilities = ["read"] }`,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "ns1/kv/foo",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"bar": "baz",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "ns1/auth/token/create",
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"policies": []string{"kv-reader"},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+	nsToken := resp.Auth.ClientToken
+
+	// The policy grants access to the namespace's mount
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "ns1/kv/foo",
+		ClientToken: nsToken,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["bar"] != "baz" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The token cannot be used outside of its namespace
+	_, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "secret/foo",
+		ClientToken: nsToken,
+	})
+	if err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	// Server-wide system paths are not available in a namespace
+	_, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "ns1/sys/audit",
+		ClientToken: root,
+	})
+	if err == nil || !errwrap.Contains(err, logical.ErrUnsupportedPath.Error()) {
+		t.Fatalf("expected unsupported path, got %v", err)
+	}
+
+	// Deleting the namespace revokes its tokens and removes its mounts
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation:   logical.DeleteOperation,
+		Path:        "sys/namespaces/ns1",
+		ClientToken: root,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	te, err := c.tokenStore.Lookup(context.Background(), nsToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te != nil {
+		t.Fatalf("expected token to be revoked, got %#v", te)
+	}
+	if match := c.router.MatchingMount("ns1/kv/foo"); match != "" {
+		t.Fatalf("expected no mount, got %q", match)
+	}
+}
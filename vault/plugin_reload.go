@@ -85,11 +85,7 @@ func (c *Core) reloadBackendCommon(ctx context.Context, entry *MountEntry, isAut
 		return nil
 	}
 
-	path := entry.Path
-
-	if isAuth {
-		path = credentialRoutePrefix + path
-	}
+	path := entry.APIPath()
 
 	// Fast-path out if the backend doesn't exist
 	raw, ok := c.router.root.Get(path)
@@ -10,6 +10,9 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/identitytpl"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/mitchellh/copystructure"
 )
@@ -84,6 +87,15 @@ type Policy struct {
 	Paths []*PathRules `hcl:"-"`
 	Raw   string
 	Type  PolicyType
+
+	// Templated is set if any of the path rules contain identity templates,
+	// in which case the policy must be parsed again with the requesting
+	// entity before it can be used
+	Templated bool `hcl:"-"`
+
+	// namespace is the namespace the policy belongs to. Its path rules are
+	// relative to it.
+	namespace *namespace.Namespace
 }
 
 // PathRules represents a policy for a path in the namespace.
@@ -151,6 +163,13 @@ func (p *ACLPermissions) Clone() (*ACLPermissions, error) {
 // intermediary set of policies, before being compiled into
 // the ACL
 func ParseACLPolicy(rules string) (*Policy, error) {
+	return parseACLPolicyWithTemplating(rules, false, nil, nil)
+}
+
+// parseACLPolicyWithTemplating parses the ACL rules, populating any identity
+// templates in the paths from the given entity and groups if requested.
+// Path rules whose templates cannot be populated are dropped.
+func parseACLPolicyWithTemplating(rules string, performTemplating bool, entity *identity.Entity, groups []*identity.Group) (*Policy, error) {
 	// Parse the rules
 	root, err := hcl.Parse(rules)
 	if err != nil {
@@ -181,7 +200,7 @@ func ParseACLPolicy(rules string) (*Policy, error) {
 	}
 
 	if o := list.Filter("path"); len(o.Items) > 0 {
-		if err := parsePaths(&p, o); err != nil {
+		if err := parsePaths(&p, o, performTemplating, entity, groups); err != nil {
 			return nil, errwrap.Wrapf("failed to parse policy: {{err}}", err)
 		}
 	}
@@ -189,13 +208,37 @@ func ParseACLPolicy(rules string) (*Policy, error) {
 	return &p, nil
 }
 
-func parsePaths(result *Policy, list *ast.ObjectList) error {
+func parsePaths(result *Policy, list *ast.ObjectList, performTemplating bool, entity *identity.Entity, groups []*identity.Group) error {
 	paths := make([]*PathRules, 0, len(list.Items))
 	for _, item := range list.Items {
 		key := "path"
 		if len(item.Keys) > 0 {
 			key = item.Keys[0].Token.Value().(string)
 		}
+
+		// Whether the rule globs is decided by the path as written, so that
+		// a templated value ending in '*' can't widen the rule
+		glob := strings.HasSuffix(key, "*")
+
+		hasTemplating, templated, err := identitytpl.PopulateString(&identitytpl.PopulateStringInput{
+			ValidityCheckOnly: !performTemplating,
+			String:            key,
+			Entity:            entity,
+			Groups:            groups,
+		})
+		switch {
+		case err != nil && performTemplating:
+			// The templates can't be populated for this entity, so the
+			// rule doesn't apply to it
+			continue
+		case err != nil:
+			return errwrap.Wrapf(fmt.Sprintf("path %q: failed to parse templated path: {{err}}", key), err)
+		case hasTemplating:
+			result.Templated = true
+			if performTemplating {
+				key = templated
+			}
+		}
 		valid := []string{
 			"policy",
 			"capabilities",
@@ -225,7 +268,7 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 		}
 
 		// Strip the glob character if found
-		if strings.HasSuffix(pc.Prefix, "*") {
+		if glob && strings.HasSuffix(pc.Prefix, "*") {
 			pc.Prefix = strings.TrimSuffix(pc.Prefix, "*")
 			pc.Glob = true
 		}
@@ -12,6 +12,8 @@ import (
 	log "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/golang-lru"
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 )
@@ -151,7 +153,8 @@ type PolicyStore struct {
 	// path tree don't happen concurrently. We are okay reading stale data so
 	// long as there aren't concurrent writes.
 	modifyLock *sync.RWMutex
-	// Stores whether a token policy is ACL or RGP
+	// Stores whether a token policy is ACL or RGP, keyed by namespace ID and
+	// policy name
 	policyTypeMap sync.Map
 	// logger is the server logger copied over from core
 	logger log.Logger
@@ -184,10 +187,10 @@ func NewPolicyStore(ctx context.Context, core *Core, baseView *BarrierView, syst
 		return nil
 	}
 	for _, key := range keys {
-		ps.policyTypeMap.Store(ps.sanitizeName(key), PolicyTypeACL)
+		ps.policyTypeMap.Store(ps.cacheKey(namespace.RootNamespace, ps.sanitizeName(key)), PolicyTypeACL)
 	}
 	// Special-case root; doesn't exist on disk but does need to be found
-	ps.policyTypeMap.Store("root", PolicyTypeACL)
+	ps.policyTypeMap.Store(ps.cacheKey(namespace.RootNamespace, "root"), PolicyTypeACL)
 	return ps
 }
 
@@ -212,6 +215,17 @@ func (c *Core) setupPolicyStore(ctx context.Context) error {
 		return err
 	}
 
+	// Index the policies of the other namespaces
+	for _, ns := range c.namespaceStore.all() {
+		keys, err := logical.CollectKeys(ctx, c.policyStore.getACLView(ns))
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to collect policies of namespace %q: {{err}}", ns.Path), err)
+		}
+		for _, key := range keys {
+			c.policyStore.policyTypeMap.Store(c.policyStore.cacheKey(ns, key), PolicyTypeACL)
+		}
+	}
+
 	return nil
 }
 
@@ -222,16 +236,37 @@ func (c *Core) teardownPolicyStore() error {
 	return nil
 }
 
+// getACLView returns the view ACL policies of the given namespace are
+// stored in
+func (ps *PolicyStore) getACLView(ns *namespace.Namespace) *BarrierView {
+	if ns.ID == namespace.RootNamespaceID {
+		return ps.aclView
+	}
+	return NewBarrierView(ps.core.barrier, namespaceBarrierPrefix+ns.ID+"/"+systemBarrierPrefix+policyACLSubPath)
+}
+
+// cacheKey returns the key the named policy of the given namespace is cached
+// under, since policy names are only unique within a namespace
+func (ps *PolicyStore) cacheKey(ns *namespace.Namespace, name string) string {
+	return ns.ID + "/" + name
+}
+
 func (ps *PolicyStore) invalidate(ctx context.Context, name string, policyType PolicyType) {
 	// This may come with a prefixed "/" due to joining the file path
 	saneName := strings.TrimPrefix(name, "/")
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		ps.logger.Error("error fetching namespace for policy invalidation", "name", saneName, "error", err)
+		return
+	}
+
 	// We don't lock before removing from the LRU here because the worst that
 	// can happen is we load again if something since added it
 	switch policyType {
 	case PolicyTypeACL:
 		if ps.tokenPoliciesLRU != nil {
-			ps.tokenPoliciesLRU.Remove(saneName)
+			ps.tokenPoliciesLRU.Remove(ps.cacheKey(ns, saneName))
 		}
 
 	default:
@@ -240,7 +275,7 @@ func (ps *PolicyStore) invalidate(ctx context.Context, name string, policyType P
 	}
 
 	// Force a reload
-	_, err := ps.GetPolicy(ctx, name, policyType)
+	_, err = ps.GetPolicy(ctx, name, policyType)
 	if err != nil {
 		ps.logger.Error("error fetching policy after invalidation", "name", saneName)
 	}
@@ -265,6 +300,12 @@ func (ps *PolicyStore) SetPolicy(ctx context.Context, p *Policy) error {
 }
 
 func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	p.namespace = ns
+
 	ps.modifyLock.Lock()
 	defer ps.modifyLock.Unlock()
 	// Create the entry
@@ -278,14 +319,14 @@ func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
 	}
 	switch p.Type {
 	case PolicyTypeACL:
-		if err := ps.aclView.Put(ctx, entry); err != nil {
+		if err := ps.getACLView(ns).Put(ctx, entry); err != nil {
 			return errwrap.Wrapf("failed to persist policy: {{err}}", err)
 		}
-		ps.policyTypeMap.Store(p.Name, PolicyTypeACL)
+		ps.policyTypeMap.Store(ps.cacheKey(ns, p.Name), PolicyTypeACL)
 
 		if ps.tokenPoliciesLRU != nil {
 			// Update the LRU cache
-			ps.tokenPoliciesLRU.Add(p.Name, p)
+			ps.tokenPoliciesLRU.Add(ps.cacheKey(ns, p.Name), p)
 		}
 
 	default:
@@ -295,30 +336,40 @@ func (ps *PolicyStore) setPolicyInternal(ctx context.Context, p *Policy) error {
 	return nil
 }
 
-// GetPolicy is used to fetch the named policy
+// GetPolicy is used to fetch the named policy of the namespace in the context
 func (ps *PolicyStore) GetPolicy(ctx context.Context, name string, policyType PolicyType) (*Policy, error) {
 	defer metrics.MeasureSince([]string{"policy", "get_policy"}, time.Now())
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Policies are normalized to lower-case
 	name = ps.sanitizeName(name)
+	key := ps.cacheKey(ns, name)
 
 	var cache *lru.TwoQueueCache
 	var view *BarrierView
 	switch policyType {
 	case PolicyTypeACL:
 		cache = ps.tokenPoliciesLRU
-		view = ps.aclView
+		view = ps.getACLView(ns)
 	case PolicyTypeToken:
 		cache = ps.tokenPoliciesLRU
-		val, ok := ps.policyTypeMap.Load(name)
+		val, ok := ps.policyTypeMap.Load(key)
 		if !ok {
-			// Doesn't exist
-			return nil, nil
+			// The fixed policies exist in every namespace
+			if ns.ID == namespace.RootNamespaceID || !strutil.StrListContains(nonAssignablePolicies, name) {
+				// Doesn't exist
+				return nil, nil
+			}
+			val = PolicyTypeACL
 		}
 		policyType = val.(PolicyType)
 		switch policyType {
 		case PolicyTypeACL:
-			view = ps.aclView
+			view = ps.getACLView(ns)
 		default:
 			return nil, fmt.Errorf("invalid type of policy in type map: %q", policyType)
 		}
@@ -326,16 +377,36 @@ func (ps *PolicyStore) GetPolicy(ctx context.Context, name string, policyType Po
 
 	if cache != nil {
 		// Check for cached policy
-		if raw, ok := cache.Get(name); ok {
+		if raw, ok := cache.Get(key); ok {
 			return raw.(*Policy), nil
 		}
 	}
 
-	// Special case the root policy
+	// Special case the root policy, which only exists in the root namespace
 	if policyType == PolicyTypeACL && name == "root" {
-		p := &Policy{Name: "root"}
+		if ns.ID != namespace.RootNamespaceID {
+			return nil, nil
+		}
+		p := &Policy{Name: "root", namespace: ns}
 		if cache != nil {
-			cache.Add(p.Name, p)
+			cache.Add(key, p)
+		}
+		return p, nil
+	}
+
+	// The response wrapping policy is not stored outside of the root
+	// namespace but applies to the response-wrapping tokens of every
+	// namespace
+	if policyType == PolicyTypeACL && name == responseWrappingPolicyName && ns.ID != namespace.RootNamespaceID {
+		p, err := ParseACLPolicy(responseWrappingPolicy)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to parse policy: {{err}}", err)
+		}
+		p.Name = name
+		p.Type = PolicyTypeACL
+		p.namespace = ns
+		if cache != nil {
+			cache.Add(key, p)
 		}
 		return p, nil
 	}
@@ -345,7 +416,7 @@ func (ps *PolicyStore) GetPolicy(ctx context.Context, name string, policyType Po
 
 	// See if anything has added it since we got the lock
 	if cache != nil {
-		if raw, ok := cache.Get(name); ok {
+		if raw, ok := cache.Get(key); ok {
 			return raw.(*Policy), nil
 		}
 	}
@@ -371,6 +442,7 @@ func (ps *PolicyStore) GetPolicy(ctx context.Context, name string, policyType Po
 	policy.Name = name
 	policy.Raw = policyEntry.Raw
 	policy.Type = policyEntry.Type
+	policy.namespace = ns
 	switch policyEntry.Type {
 	case PolicyTypeACL:
 		// Parse normally
@@ -379,10 +451,11 @@ func (ps *PolicyStore) GetPolicy(ctx context.Context, name string, policyType Po
 			return nil, errwrap.Wrapf("failed to parse policy: {{err}}", err)
 		}
 		policy.Paths = p.Paths
+		policy.Templated = p.Templated
 		// Reset this in case they set the name in the policy itself
 		policy.Name = name
 
-		ps.policyTypeMap.Store(name, PolicyTypeACL)
+		ps.policyTypeMap.Store(key, PolicyTypeACL)
 
 	default:
 		return nil, fmt.Errorf("unknown policy type %q", policyEntry.Type.String())
@@ -390,22 +463,28 @@ func (ps *PolicyStore) GetPolicy(ctx context.Context, name string, policyType Po
 
 	if cache != nil {
 		// Update the LRU cache
-		cache.Add(name, policy)
+		cache.Add(key, policy)
 	}
 
 	return policy, nil
 }
 
-// ListPolicies is used to list the available policies
+// ListPolicies is used to list the available policies of the namespace in
+// the context
 func (ps *PolicyStore) ListPolicies(ctx context.Context, policyType PolicyType) ([]string, error) {
 	defer metrics.MeasureSince([]string{"policy", "list_policies"}, time.Now())
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Scan the view, since the policy names are the same as the
 	// key names.
 	var keys []string
-	var err error
 	switch policyType {
 	case PolicyTypeACL:
-		keys, err = logical.CollectKeys(ctx, ps.aclView)
+		keys, err = logical.CollectKeys(ctx, ps.getACLView(ns))
 	default:
 		return nil, fmt.Errorf("unknown policy type %q", policyType)
 	}
@@ -434,6 +513,11 @@ func (ps *PolicyStore) ListPolicies(ctx context.Context, policyType PolicyType)
 func (ps *PolicyStore) DeletePolicy(ctx context.Context, name string, policyType PolicyType) error {
 	defer metrics.MeasureSince([]string{"policy", "delete_policy"}, time.Now())
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+
 	ps.modifyLock.Lock()
 	defer ps.modifyLock.Unlock()
 
@@ -449,37 +533,101 @@ func (ps *PolicyStore) DeletePolicy(ctx context.Context, name string, policyType
 			return fmt.Errorf("cannot delete default policy")
 		}
 
-		err := ps.aclView.Delete(ctx, name)
+		err := ps.getACLView(ns).Delete(ctx, name)
 		if err != nil {
 			return errwrap.Wrapf("failed to delete policy: {{err}}", err)
 		}
 
 		if ps.tokenPoliciesLRU != nil {
 			// Clear the cache
-			ps.tokenPoliciesLRU.Remove(name)
+			ps.tokenPoliciesLRU.Remove(ps.cacheKey(ns, name))
 		}
 
-		ps.policyTypeMap.Delete(name)
+		ps.policyTypeMap.Delete(ps.cacheKey(ns, name))
 
 	}
 	return nil
 }
 
-// ACL is used to return an ACL which is built using the
-// named policies.
-func (ps *PolicyStore) ACL(ctx context.Context, names ...string) (*ACL, error) {
+// deleteNamespacePolicies removes every policy of the namespace in the
+// context. It is used when the namespace is deleted.
+func (ps *PolicyStore) deleteNamespacePolicies(ctx context.Context) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if ns.ID == namespace.RootNamespaceID {
+		return fmt.Errorf("cannot delete the policies of the root namespace")
+	}
+
+	ps.modifyLock.Lock()
+	defer ps.modifyLock.Unlock()
+
+	view := ps.getACLView(ns)
+	keys, err := logical.CollectKeys(ctx, view)
+	if err != nil {
+		return err
+	}
+	for _, name := range keys {
+		if ps.tokenPoliciesLRU != nil {
+			ps.tokenPoliciesLRU.Remove(ps.cacheKey(ns, name))
+		}
+		ps.policyTypeMap.Delete(ps.cacheKey(ns, name))
+	}
+	if ps.tokenPoliciesLRU != nil {
+		ps.tokenPoliciesLRU.Remove(ps.cacheKey(ns, responseWrappingPolicyName))
+	}
+
+	return logical.ClearView(ctx, view)
+}
+
+// ACL is used to return an ACL which is built using the named policies,
+// keyed by the ID of the namespace they belong to. Templated policies are
+// resolved against the given entity, which may be nil.
+func (ps *PolicyStore) ACL(ctx context.Context, entity *identity.Entity, policyNames map[string][]string) (*ACL, error) {
 	// Fetch the policies
 	var policies []*Policy
-	for _, name := range names {
-		p, err := ps.GetPolicy(ctx, name, PolicyTypeToken)
-		if err != nil {
-			return nil, errwrap.Wrapf("failed to get policy: {{err}}", err)
+	for nsID, names := range policyNames {
+		ns := ps.core.namespaceByID(nsID)
+		if ns == nil {
+			// The namespace is gone, and its policies along with it
+			continue
+		}
+		nsCtx := namespace.ContextWithNamespace(ctx, ns)
+		for _, name := range names {
+			p, err := ps.GetPolicy(nsCtx, name, PolicyTypeToken)
+			if err != nil {
+				return nil, errwrap.Wrapf("failed to get policy: {{err}}", err)
+			}
+			policies = append(policies, p)
+		}
+	}
+
+	return ps.newACL(policies, entity)
+}
+
+// newACL constructs an ACL from the given policies. If any of them are
+// templated, the groups the entity belongs to are looked up so that group
+// templates can be resolved as well.
+func (ps *PolicyStore) newACL(policies []*Policy, entity *identity.Entity) (*ACL, error) {
+	var groups []*identity.Group
+	if entity != nil && ps.core != nil && ps.core.identityStore != nil {
+		for _, policy := range policies {
+			if policy == nil || !policy.Templated {
+				continue
+			}
+
+			directGroups, inheritedGroups, err := ps.core.identityStore.groupsByEntityID(entity.ID)
+			if err != nil {
+				return nil, errwrap.Wrapf("failed to fetch group memberships: {{err}}", err)
+			}
+			groups = append(directGroups, inheritedGroups...)
+			break
 		}
-		policies = append(policies, p)
 	}
 
 	// Construct the ACL
-	acl, err := NewACL(policies)
+	acl, err := NewACLWithIdentity(policies, entity, groups)
 	if err != nil {
 		return nil, errwrap.Wrapf("failed to construct ACL: {{err}}", err)
 	}
@@ -330,3 +330,32 @@ path "/" {
 		t.Errorf("bad error: %s", err)
 	}
 }
+
+func TestPolicy_ParseTemplated(t *testing.T) {
+	p, err := ParseACLPolicy(strings.TrimSpace(`
+path "secret/teams/{{identity.entity.metadata.team}}/*" {
+	capabilities = ["read"]
+}
+path "secret/static" {
+	capabilities = ["read"]
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Templated {
+		t.Fatal("expected policy to be marked as templated")
+	}
+
+	_, err = ParseACLPolicy(strings.TrimSpace(`
+path "secret/{{identity.entity.bogus}}" {
+	capabilities = ["read"]
+}
+`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `failed to parse templated path`) {
+		t.Errorf("bad error: %s", err)
+	}
+}
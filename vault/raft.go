@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/physical/raft"
+)
+
+const (
+	// raftBootstrapTimeout bounds how long initialization waits for a newly
+	// bootstrapped raft cluster to elect this node
+	raftBootstrapTimeout = 30 * time.Second
+)
+
+var (
+	// ErrRaftNotInUse is returned by raft cluster operations when the
+	// storage backend is not raft
+	ErrRaftNotInUse = errors.New("raft storage is not in use")
+)
+
+// raftBackend returns the raft storage backend, or nil if another storage
+// backend is configured
+func (c *Core) raftBackend() *raft.RaftBackend {
+	raftBackend, _ := c.underlyingPhysical.(*raft.RaftBackend)
+	return raftBackend
+}
+
+// bootstrapRaft forms a new raft cluster out of this node if raft storage is
+// in use and the node is not already part of a cluster. It is called during
+// initialization, before anything is written to storage.
+func (c *Core) bootstrapRaft(ctx context.Context) error {
+	raftBackend := c.raftBackend()
+	if raftBackend == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, raftBootstrapTimeout)
+	defer cancel()
+
+	if err := raftBackend.Bootstrap(ctx); err != nil {
+		return errwrap.Wrapf("failed to bootstrap raft storage: {{err}}", err)
+	}
+	c.logger.Info("raft cluster bootstrapped", "node_id", raftBackend.NodeID())
+	return nil
+}
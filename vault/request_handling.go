@@ -15,6 +15,7 @@ import (
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/helper/wrapping"
@@ -29,10 +30,11 @@ const (
 // fetchEntityAndDerivedPolicies returns the entity object for the given entity
 // ID. If the entity is merged into a different entity object, the entity into
 // which the given entity ID is merged into will be returned. This function
-// also returns the cumulative list of policies that the entity is entitled to.
-// This list includes the policies from the entity itself and from all the
-// groups in which the given entity ID is a member of.
-func (c *Core) fetchEntityAndDerivedPolicies(entityID string) (*identity.Entity, []string, error) {
+// also returns the cumulative list of policies that the entity is entitled to,
+// keyed by the ID of the namespace the policies belong to. This list includes
+// the policies from the entity itself and from all the groups in which the
+// given entity ID is a member of.
+func (c *Core) fetchEntityAndDerivedPolicies(entityID string) (*identity.Entity, map[string][]string, error) {
 	if entityID == "" || c.identityStore == nil {
 		return nil, nil, nil
 	}
@@ -57,27 +59,31 @@ func (c *Core) fetchEntityAndDerivedPolicies(entityID string) (*identity.Entity,
 		}
 	}
 
-	var policies []string
+	policies := make(map[string][]string)
 	if entity != nil {
 		//c.logger.Debug("entity successfully fetched; adding entity policies to token's policies to create ACL")
 
 		// Attach the policies on the entity
-		policies = append(policies, entity.Policies...)
+		if len(entity.Policies) > 0 {
+			policies[entity.NamespaceID] = append(policies[entity.NamespaceID], entity.Policies...)
+		}
 
-		groupPolicies, err := c.identityStore.groupPoliciesByEntityID(entity.ID)
+		groupPolicies, err := c.identityStore.groupPoliciesByEntityIDPerNamespace(entity.ID)
 		if err != nil {
 			c.logger.Error("failed to fetch group policies", "error", err)
 			return nil, nil, err
 		}
 
 		// Attach the policies from all the groups
-		policies = append(policies, groupPolicies...)
+		for nsID, nsPolicies := range groupPolicies {
+			policies[nsID] = strutil.RemoveDuplicates(append(policies[nsID], nsPolicies...), false)
+		}
 	}
 
 	return entity, policies, err
 }
 
-func (c *Core) fetchACLTokenEntryAndEntity(req *logical.Request) (*ACL, *TokenEntry, *identity.Entity, error) {
+func (c *Core) fetchACLTokenEntryAndEntity(ctx context.Context, req *logical.Request) (*ACL, *TokenEntry, *identity.Entity, error) {
 	defer metrics.MeasureSince([]string{"core", "fetch_acl_and_token"}, time.Now())
 
 	// Ensure there is a client token
@@ -102,8 +108,22 @@ func (c *Core) fetchACLTokenEntryAndEntity(req *logical.Request) (*ACL, *TokenEn
 		return nil, nil, nil, logical.ErrPermissionDenied
 	}
 
+	// Tokens can only be used in the namespace they were created in and the
+	// ones below it
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tokenNS := c.namespaceByID(tokenNamespaceID(te))
+	if tokenNS == nil || !tokenNS.Contains(ns) {
+		return nil, nil, nil, logical.ErrPermissionDenied
+	}
+
 	// CIDR checks bind all tokens except non-expiring root tokens
 	if te.TTL != 0 && len(te.BoundCIDRs) > 0 {
+		if req.Connection == nil || req.Connection.RemoteAddr == "" {
+			return nil, nil, nil, logical.ErrPermissionDenied
+		}
 		var valid bool
 		remoteSockAddr, err := sockaddr.NewSockAddr(req.Connection.RemoteAddr)
 		if err != nil {
@@ -123,17 +143,21 @@ func (c *Core) fetchACLTokenEntryAndEntity(req *logical.Request) (*ACL, *TokenEn
 		}
 	}
 
-	tokenPolicies := te.Policies
-
-	entity, derivedPolicies, err := c.fetchEntityAndDerivedPolicies(te.EntityID)
+	entity, identityPolicies, err := c.fetchEntityAndDerivedPolicies(te.EntityID)
 	if err != nil {
 		return nil, nil, nil, ErrInternalError
 	}
 
-	tokenPolicies = append(tokenPolicies, derivedPolicies...)
+	// The policies of the token are those of the namespace it was created in
+	tokenNamespaceID := tokenNamespaceID(te)
+	policyNames := make(map[string][]string, len(identityPolicies)+1)
+	policyNames[tokenNamespaceID] = append([]string(nil), te.Policies...)
+	for nsID, nsPolicies := range identityPolicies {
+		policyNames[nsID] = append(policyNames[nsID], nsPolicies...)
+	}
 
 	// Construct the corresponding ACL object
-	acl, err := c.policyStore.ACL(c.activeContext, tokenPolicies...)
+	acl, err := c.policyStore.ACL(c.activeContext, entity, policyNames)
 	if err != nil {
 		c.logger.Error("failed to construct ACL", "error", err)
 		return nil, nil, nil, ErrInternalError
@@ -154,7 +178,7 @@ func (c *Core) checkToken(ctx context.Context, req *logical.Request, unauth bool
 	// gather as much info as possible for the audit log and to e.g. control
 	// trace mode for EGPs.
 	if !unauth || (unauth && req.ClientToken != "") {
-		acl, te, entity, err = c.fetchACLTokenEntryAndEntity(req)
+		acl, te, entity, err = c.fetchACLTokenEntryAndEntity(ctx, req)
 		// In the unauth case we don't want to fail the command, since it's
 		// unauth, we just have no information to attach to the request, so
 		// ignore errors...this was best-effort anyways
@@ -268,6 +292,17 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		return logical.ErrorResponse("cannot write to a path ending in '/'"), nil
 	}
 
+	// Requests are scoped to the namespace their path falls into. Only the
+	// system paths that make sense within a namespace are available there.
+	ns := c.namespaceByPath(req.Path)
+	if ns.ID != namespace.RootNamespaceID {
+		nsPath := ns.TrimmedPath(req.Path)
+		if strings.HasPrefix(nsPath, "sys/") && !namespaceSysPathAllowed(strings.TrimPrefix(nsPath, "sys/")) {
+			return logical.ErrorResponse(fmt.Sprintf("path %q is not available in a namespace", nsPath)), logical.ErrUnsupportedPath
+		}
+	}
+	ctx = namespace.ContextWithNamespace(ctx, ns)
+
 	var auth *logical.Auth
 	if c.router.LoginPath(req.Path) {
 		resp, auth, err = c.handleLoginRequest(ctx, req)
@@ -318,7 +353,7 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	// When unwrapping we want to log the actual response that will be written
 	// out. We still want to return the raw value to avoid automatic updating
 	// to any of it.
-	if req.Path == "sys/wrapping/unwrap" &&
+	if ns.TrimmedPath(req.Path) == "sys/wrapping/unwrap" &&
 		resp != nil &&
 		resp.Data != nil &&
 		resp.Data[logical.HTTPRawBody] != nil {
@@ -375,6 +410,13 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp *logical.Response, retAuth *logical.Auth, retErr error) {
 	defer metrics.MeasureSince([]string{"core", "handle_request"}, time.Now())
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// nsPath is the request path relative to its namespace
+	nsPath := ns.TrimmedPath(req.Path)
+
 	var nonHMACReqDataKeys []string
 	entry := c.router.MatchingMountEntry(req.Path)
 	if entry != nil {
@@ -468,6 +510,13 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 		return nil, auth, retErr
 	}
 
+	// Batch tokens are never persisted, so there is nothing a cubbyhole could
+	// be tied to and destroyed with
+	if te != nil && te.Type == logical.TokenTypeBatch && strings.HasPrefix(nsPath, "cubbyhole/") {
+		retErr = multierror.Append(retErr, logical.ErrInvalidRequest)
+		return logical.ErrorResponse("cubbyhole operations are only supported by service tokens"), auth, retErr
+	}
+
 	// Route the request
 	resp, routeErr := c.router.Route(ctx, req)
 	if resp != nil {
@@ -515,8 +564,8 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 
 	// If there is a secret, we must register it with the expiration manager.
 	// We exclude renewal of a lease, since it does not need to be re-registered
-	if resp != nil && resp.Secret != nil && !strings.HasPrefix(req.Path, "sys/renew") &&
-		!strings.HasPrefix(req.Path, "sys/leases/renew") {
+	if resp != nil && resp.Secret != nil && !strings.HasPrefix(nsPath, "sys/renew") &&
+		!strings.HasPrefix(nsPath, "sys/leases/renew") {
 		// KV mounts should return the TTL but not register
 		// for a lease as this provides a massive slowdown
 		registerLease := true
@@ -586,7 +635,7 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 
 	// If the request was to renew a token, and if there are group aliases set
 	// in the auth object, then the group memberships should be refreshed
-	if strings.HasPrefix(req.Path, "auth/token/renew") &&
+	if strings.HasPrefix(nsPath, "auth/token/renew") &&
 		resp != nil &&
 		resp.Auth != nil &&
 		resp.Auth.EntityID != "" &&
@@ -603,23 +652,26 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 	// Only the token store is allowed to return an auth block, for any
 	// other request this is an internal error. We exclude renewal of a token,
 	// since it does not need to be re-registered
-	if resp != nil && resp.Auth != nil && !strings.HasPrefix(req.Path, "auth/token/renew") {
-		if !strings.HasPrefix(req.Path, "auth/token/") {
+	if resp != nil && resp.Auth != nil && !strings.HasPrefix(nsPath, "auth/token/renew") {
+		if !strings.HasPrefix(nsPath, "auth/token/") {
 			c.logger.Error("unexpected Auth response for non-token backend", "request_path", req.Path)
 			retErr = multierror.Append(retErr, ErrInternalError)
 			return nil, auth, retErr
 		}
 
-		if err := c.expiration.RegisterAuth(resp.Auth.CreationPath, resp.Auth); err != nil {
-			c.tokenStore.revokeOrphan(ctx, te.ID)
-			c.logger.Error("failed to register token lease", "request_path", req.Path, "error", err)
-			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+		// Batch tokens have no lease to register
+		if resp.Auth.TokenType != logical.TokenTypeBatch {
+			if err := c.expiration.RegisterAuth(resp.Auth.CreationPath, resp.Auth); err != nil {
+				c.tokenStore.revokeOrphan(ctx, te.ID)
+				c.logger.Error("failed to register token lease", "request_path", req.Path, "error", err)
+				retErr = multierror.Append(retErr, ErrInternalError)
+				return nil, auth, retErr
+			}
 		}
 	}
 
 	if resp != nil &&
-		req.Path == "cubbyhole/response" &&
+		nsPath == "cubbyhole/response" &&
 		len(te.Policies) == 1 &&
 		te.Policies[0] == responseWrappingPolicyName {
 		resp.AddWarning("Reading from 'cubbyhole/response' is deprecated. Please use sys/wrapping/unwrap to unwrap responses, as it provides additional security checks and other benefits.")
@@ -653,15 +705,45 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 		return nil, nil, ErrInternalError
 	}
 
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// The token store uses authentication even when creating a new token,
 	// so it's handled in handleRequest. It should not be reached here.
-	if strings.HasPrefix(req.Path, "auth/token/") {
+	if strings.HasPrefix(ns.TrimmedPath(req.Path), "auth/token/") {
 		c.logger.Error("unexpected login request for token backend", "request_path", req.Path)
 		return nil, nil, ErrInternalError
 	}
 
-	// Route the request
-	resp, routeErr := c.router.Route(ctx, req)
+	// Logins held for MFA are completed by validating their passcodes, which
+	// yields the response of the original login request
+	var resp *logical.Response
+	var routeErr error
+	var mfaPending *mfaPendingLogin
+	if ns.TrimmedPath(req.Path) == mfaValidatePath {
+		if c.identityStore == nil {
+			return nil, nil, ErrInternalError
+		}
+
+		var errResp *logical.Response
+		mfaPending, errResp, err = c.identityStore.validateLoginMFA(ctx, req)
+		if err != nil {
+			return errResp, nil, err
+		}
+
+		ns = c.namespaceByID(mfaPending.namespaceID)
+		if ns == nil {
+			return logical.ErrorResponse("the namespace of the login no longer exists"), nil, logical.ErrInvalidRequest
+		}
+		ctx = namespace.ContextWithNamespace(ctx, ns)
+		resp = mfaPending.resp
+	} else {
+		// Route the request
+		resp, routeErr = c.router.Route(ctx, req)
+	}
+
 	if resp != nil {
 		// If wrapping is used, use the shortest between the request and response
 		var wrapTTL time.Duration
@@ -709,6 +791,19 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 		return nil, nil, ErrInternalError
 	}
 
+	// Tokens of logins held for MFA are created once the passcodes are
+	// validated; the entity was already resolved when the login was made
+	if mfaPending != nil {
+		auth = resp.Auth
+		resp, err = c.loginCreateToken(ctx, ns, mfaPending.path, resp)
+		if err != nil {
+			return resp, auth, err
+		}
+
+		req.DisplayName = auth.DisplayName
+		return resp, auth, nil
+	}
+
 	// If the response generated an authentication, then generate the token
 	if resp != nil && resp.Auth != nil {
 
@@ -760,71 +855,125 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 			return logical.ErrorResponse("auth methods cannot create root tokens"), nil, logical.ErrInvalidRequest
 		}
 
-		// Determine the source of the login
-		source := c.router.MatchingMount(req.Path)
-		source = strings.TrimPrefix(source, credentialRoutePrefix)
-		source = strings.Replace(source, "/", "-", -1)
-
-		// Prepend the source to the display name
-		auth.DisplayName = strings.TrimSuffix(source+auth.DisplayName, "-")
-
-		sysView := c.router.MatchingSystemView(req.Path)
-		if sysView == nil {
-			c.logger.Error("unable to look up sys view for login path", "request_path", req.Path)
-			return nil, nil, ErrInternalError
+		// Hold the login if an MFA login enforcement applies to it
+		if c.identityStore != nil {
+			requirements, err := c.identityStore.mfaLoginRequirements(ctx, mEntry, entity)
+			if err != nil {
+				c.logger.Error("failed to evaluate MFA login enforcements", "request_path", req.Path, "error", err)
+				return nil, nil, ErrInternalError
+			}
+			if len(requirements) > 0 {
+				resp, err := c.identityStore.holdLoginForMFA(ns, req.Path, resp, entity, requirements)
+				return resp, nil, err
+			}
 		}
 
-		tokenTTL, warnings, err := framework.CalculateTTL(sysView, 0, auth.TTL, auth.Period, auth.MaxTTL, auth.ExplicitMaxTTL, time.Time{})
+		resp, err = c.loginCreateToken(ctx, ns, req.Path, resp)
 		if err != nil {
-			return nil, nil, err
-		}
-		for _, warning := range warnings {
-			resp.AddWarning(warning)
+			return resp, auth, err
 		}
 
-		// Generate a token
-		te := TokenEntry{
-			Path:         req.Path,
-			Policies:     auth.Policies,
-			Meta:         auth.Metadata,
-			DisplayName:  auth.DisplayName,
-			CreationTime: time.Now().Unix(),
-			TTL:          tokenTTL,
-			NumUses:      auth.NumUses,
-			EntityID:     auth.EntityID,
-			BoundCIDRs:   auth.BoundCIDRs,
-		}
+		// Attach the display name, might be used by audit backends
+		req.DisplayName = auth.DisplayName
+	}
 
-		te.Policies = policyutil.SanitizePolicies(te.Policies, true)
+	return resp, auth, routeErr
+}
 
-		// Prevent internal policies from being assigned to tokens
-		for _, policy := range te.Policies {
-			if strutil.StrListContains(nonAssignablePolicies, policy) {
-				return logical.ErrorResponse(fmt.Sprintf("cannot assign policy %q", policy)), nil, logical.ErrInvalidRequest
-			}
-		}
+// loginCreateToken creates the token of a successful login request made to
+// the given path and registers it with the expiration manager. The auth of
+// the response is updated with the token.
+func (c *Core) loginCreateToken(ctx context.Context, ns *namespace.Namespace, path string, resp *logical.Response) (*logical.Response, error) {
+	auth := resp.Auth
+	mEntry := c.router.MatchingMountEntry(path)
+
+	// Determine the source of the login
+	source := c.router.MatchingMount(path)
+	source = strings.TrimPrefix(source, credentialRoutePrefix)
+	source = strings.Replace(source, "/", "-", -1)
+
+	// Prepend the source to the display name
+	auth.DisplayName = strings.TrimSuffix(source+auth.DisplayName, "-")
+
+	sysView := c.router.MatchingSystemView(path)
+	if sysView == nil {
+		c.logger.Error("unable to look up sys view for login path", "request_path", path)
+		return nil, ErrInternalError
+	}
 
-		if err := c.tokenStore.create(ctx, &te); err != nil {
-			c.logger.Error("failed to create token", "error", err)
-			return nil, auth, ErrInternalError
+	tokenTTL, warnings, err := framework.CalculateTTL(sysView, 0, auth.TTL, auth.Period, auth.MaxTTL, auth.ExplicitMaxTTL, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+
+	// The mount's token_type decides whether the type requested by the
+	// backend is honored
+	var configuredType logical.TokenType
+	if mEntry != nil {
+		configuredType = mEntry.Config.TokenType
+	}
+	tokenType, err := configuredType.Resolve(auth.TokenType)
+	if err != nil {
+		c.logger.Error("failed to determine token type", "request_path", path, "error", err)
+		return nil, ErrInternalError
+	}
+	if tokenType == logical.TokenTypeBatch && auth.NumUses != 0 {
+		return logical.ErrorResponse("batch tokens cannot have a limited number of uses"), logical.ErrInvalidRequest
+	}
+
+	// Generate a token
+	te := TokenEntry{
+		Path:         path,
+		Policies:     auth.Policies,
+		Meta:         auth.Metadata,
+		DisplayName:  auth.DisplayName,
+		CreationTime: time.Now().Unix(),
+		TTL:          tokenTTL,
+		NumUses:      auth.NumUses,
+		EntityID:     auth.EntityID,
+		BoundCIDRs:   auth.BoundCIDRs,
+		Type:         tokenType,
+		NamespaceID:  ns.ID,
+	}
+
+	te.Policies = policyutil.SanitizePolicies(te.Policies, true)
+
+	// Prevent internal policies from being assigned to tokens
+	for _, policy := range te.Policies {
+		if strutil.StrListContains(nonAssignablePolicies, policy) {
+			return logical.ErrorResponse(fmt.Sprintf("cannot assign policy %q", policy)), logical.ErrInvalidRequest
 		}
+	}
 
-		// Populate the client token, accessor, and TTL
-		auth.ClientToken = te.ID
-		auth.Accessor = te.Accessor
-		auth.Policies = te.Policies
-		auth.TTL = te.TTL
+	if err := c.tokenStore.create(ctx, &te); err != nil {
+		c.logger.Error("failed to create token", "error", err)
+		return nil, ErrInternalError
+	}
+
+	// Populate the client token, accessor, TTL and type
+	auth.ClientToken = te.ID
+	auth.Accessor = te.Accessor
+	auth.Policies = te.Policies
+	auth.TTL = te.TTL
+	auth.TokenType = te.Type
 
+	switch te.Type {
+	case logical.TokenTypeBatch:
+		// Batch tokens are not tracked by the expiration manager and
+		// can never be renewed
+		auth.Renewable = false
+
+	default:
 		// Register with the expiration manager
 		if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
 			c.tokenStore.revokeOrphan(ctx, te.ID)
-			c.logger.Error("failed to register token lease", "request_path", req.Path, "error", err)
-			return nil, auth, ErrInternalError
+			c.logger.Error("failed to register token lease", "request_path", path, "error", err)
+			return nil, ErrInternalError
 		}
-
-		// Attach the display name, might be used by audit backends
-		req.DisplayName = auth.DisplayName
 	}
 
-	return resp, auth, routeErr
+	return resp, nil
 }
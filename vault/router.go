@@ -10,6 +10,7 @@ import (
 
 	"github.com/armon/go-metrics"
 	"github.com/armon/go-radix"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
 )
@@ -55,6 +56,10 @@ type validateMountResponse struct {
 	MountAccessor string `json:"mount_accessor" structs:"mount_accessor" mapstructure:"mount_accessor"`
 	MountPath     string `json:"mount_path" structs:"mount_path" mapstructure:"mount_path"`
 	MountLocal    bool   `json:"mount_local" structs:"mount_local" mapstructure:"mount_local"`
+
+	// MountNamespace is the namespace the mount belongs to; MountPath is
+	// relative to it
+	MountNamespace *namespace.Namespace `json:"-" structs:"-" mapstructure:"-"`
 }
 
 // validateMountByAccessor returns the mount type and ID for a given mount
@@ -79,6 +84,8 @@ func (r *Router) validateMountByAccessor(accessor string) *validateMountResponse
 		MountType:     mountEntry.Type,
 		MountPath:     mountPath,
 		MountLocal:    mountEntry.Local,
+
+		MountNamespace: mountEntry.Namespace(),
 	}
 }
 
@@ -163,6 +170,41 @@ func (r *Router) Unmount(ctx context.Context, prefix string) error {
 	return nil
 }
 
+// mountNamespace exposes the backends mounted at the given paths of the root
+// namespace under the namespace path as well. The route entries are shared,
+// so the backends see the namespace only through the request.
+func (r *Router) mountNamespace(nsPath string, paths []string) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	for _, path := range paths {
+		raw, ok := r.root.Get(path)
+		if !ok {
+			return fmt.Errorf("no mount at %q to expose in namespace %q", path, nsPath)
+		}
+		r.root.Insert(nsPath+path, raw)
+	}
+
+	return nil
+}
+
+// unmountNamespace removes every route under the given namespace path. The
+// backends are not cleaned up, since the only routes left by then are the
+// ones added by mountNamespace.
+func (r *Router) unmountNamespace(nsPath string) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	var prefixes []string
+	r.root.WalkPrefix(nsPath, func(prefix string, _ interface{}) bool {
+		prefixes = append(prefixes, prefix)
+		return false
+	})
+	for _, prefix := range prefixes {
+		r.root.Delete(prefix)
+	}
+}
+
 // Remount is used to change the mount location of a logical backend
 func (r *Router) Remount(src, dst string) error {
 	r.l.Lock()
@@ -440,10 +482,10 @@ func (r *Router) routeCommon(ctx context.Context, req *logical.Request, existenc
 	// Hash the request token unless the request is being routed to the token
 	// or system backend.
 	clientToken := req.ClientToken
-	switch {
-	case strings.HasPrefix(originalPath, "auth/token/"):
-	case strings.HasPrefix(originalPath, "sys/"):
-	case strings.HasPrefix(originalPath, "cubbyhole/"):
+	switch re.mountEntry.Type {
+	case "token":
+	case "system":
+	case "cubbyhole":
 		// In order for the token store to revoke later, we need to have the same
 		// salted ID, so we double-salt what's going to the cubbyhole backend
 		salt, err := r.tokenStoreSaltFunc(ctx)
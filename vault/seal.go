@@ -45,10 +45,11 @@ const (
 )
 
 const (
-	SealTypeShamir = "shamir"
-	SealTypePKCS11 = "pkcs11"
-	SealTypeAWSKMS = "awskms"
-	SealTypeTest   = "test-auto"
+	SealTypeShamir  = "shamir"
+	SealTypePKCS11  = "pkcs11"
+	SealTypeAWSKMS  = "awskms"
+	SealTypeTransit = "transit"
+	SealTypeTest    = "test-auto"
 
 	RecoveryTypeUnsupported = "unsupported"
 	RecoveryTypeShamir      = "shamir"
@@ -78,13 +79,16 @@ type Seal interface {
 	BarrierType() string
 	BarrierConfig(context.Context) (*SealConfig, error)
 	SetBarrierConfig(context.Context, *SealConfig) error
+	SetCachedBarrierConfig(*SealConfig)
 
 	RecoveryKeySupported() bool
 	RecoveryType() string
 	RecoveryConfig(context.Context) (*SealConfig, error)
 	SetRecoveryConfig(context.Context, *SealConfig) error
+	SetCachedRecoveryConfig(*SealConfig)
 	SetRecoveryKey(context.Context, []byte) error
 	VerifyRecoveryKey(context.Context, []byte) error
+	RecoveryKey(context.Context) ([]byte, error)
 }
 
 type defaultSeal struct {
@@ -226,6 +230,13 @@ func (d *defaultSeal) SetBarrierConfig(ctx context.Context, config *SealConfig)
 	return nil
 }
 
+// SetCachedBarrierConfig sets the cached barrier configuration without
+// persisting it. This is used while migrating between seals, when the
+// configuration in storage belongs to the seal being migrated from.
+func (d *defaultSeal) SetCachedBarrierConfig(config *SealConfig) {
+	d.config.Store(config)
+}
+
 func (d *defaultSeal) RecoveryType() string {
 	if d.PretendToAllowRecoveryKeys {
 		return RecoveryTypeShamir
@@ -250,6 +261,10 @@ func (d *defaultSeal) SetRecoveryConfig(ctx context.Context, config *SealConfig)
 	return fmt.Errorf("recovery not supported")
 }
 
+func (d *defaultSeal) SetCachedRecoveryConfig(config *SealConfig) {
+	// Recovery configuration is not stored for the default seal
+}
+
 func (d *defaultSeal) VerifyRecoveryKey(ctx context.Context, key []byte) error {
 	if d.PretendToAllowRecoveryKeys {
 		if subtle.ConstantTimeCompare(key, d.PretendRecoveryKey) == 1 {
@@ -268,6 +283,13 @@ func (d *defaultSeal) SetRecoveryKey(ctx context.Context, key []byte) error {
 	return fmt.Errorf("recovery not supported")
 }
 
+func (d *defaultSeal) RecoveryKey(ctx context.Context) ([]byte, error) {
+	if d.PretendToAllowRecoveryKeys {
+		return d.PretendRecoveryKey, nil
+	}
+	return nil, fmt.Errorf("recovery not supported")
+}
+
 // SealConfig is used to describe the seal configuration
 type SealConfig struct {
 	// The type, for sanity checking
@@ -0,0 +1,49 @@
+package seal
+
+import (
+	"context"
+)
+
+const (
+	Transit = "transit"
+	Test    = "test-auto"
+)
+
+// Access is the embedded implementation of autoSeal that contains logic
+// specific to encrypting and decrypting data, or in this case keys.
+type Access interface {
+	SealType() string
+	KeyID() string
+
+	Init(context.Context) error
+	Finalize(context.Context) error
+
+	Encrypt(context.Context, []byte) (*EncryptedBlobInfo, error)
+	Decrypt(context.Context, *EncryptedBlobInfo) ([]byte, error)
+}
+
+// EncryptedBlobInfo contains the encrypted value along with the information
+// needed to decrypt it.
+type EncryptedBlobInfo struct {
+	// Ciphertext is the encrypted bytes
+	Ciphertext []byte `json:"ciphertext"`
+
+	// IV is the initialization value used during encryption, if the seal
+	// performs encryption locally
+	IV []byte `json:"iv,omitempty"`
+
+	// KeyInfo contains information about the key used to encrypt the value
+	KeyInfo *KeyInfo `json:"key_info,omitempty"`
+}
+
+// KeyInfo contains information regarding which key was used to encrypt the
+// entry
+type KeyInfo struct {
+	// Mechanism is the method used by the seal to encrypt and sign the
+	// data as defined by the seal.
+	Mechanism uint64 `json:"mechanism"`
+
+	// KeyID is the identifier of the key used by the seal, such as the
+	// version of a transit key.
+	KeyID string `json:"key_id"`
+}
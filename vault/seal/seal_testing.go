@@ -0,0 +1,71 @@
+package seal
+
+import (
+	"context"
+)
+
+// TestSeal is an Access implementation that performs a reversible, insecure
+// transformation of the data. It is only suitable for tests.
+type TestSeal struct {
+	Type  string
+	keyID string
+}
+
+var _ Access = (*TestSeal)(nil)
+
+// NewTestSeal returns a TestSeal with the test-auto type unless another type
+// is requested.
+func NewTestSeal(sealType string) *TestSeal {
+	if sealType == "" {
+		sealType = Test
+	}
+	return &TestSeal{
+		Type:  sealType,
+		keyID: "static-key",
+	}
+}
+
+func (t *TestSeal) Init(_ context.Context) error {
+	return nil
+}
+
+func (t *TestSeal) Finalize(_ context.Context) error {
+	return nil
+}
+
+func (t *TestSeal) SealType() string {
+	return t.Type
+}
+
+func (t *TestSeal) KeyID() string {
+	return t.keyID
+}
+
+// SetKeyID changes the key ID reported for newly encrypted values, which
+// allows tests to simulate key rotation.
+func (t *TestSeal) SetKeyID(keyID string) {
+	t.keyID = keyID
+}
+
+func (t *TestSeal) Encrypt(_ context.Context, plaintext []byte) (*EncryptedBlobInfo, error) {
+	return &EncryptedBlobInfo{
+		Ciphertext: reverseBytes(plaintext),
+		KeyInfo: &KeyInfo{
+			KeyID: t.keyID,
+		},
+	}, nil
+}
+
+func (t *TestSeal) Decrypt(_ context.Context, dwi *EncryptedBlobInfo) ([]byte, error) {
+	return reverseBytes(dwi.Ciphertext), nil
+}
+
+// reverseBytes is a helper to simulate "encryption/decryption" on protected
+// values.
+func reverseBytes(in []byte) []byte {
+	out := make([]byte, len(in))
+	for i := 0; i < len(in); i++ {
+		out[i] = in[len(in)-1-i]
+	}
+	return out
+}
@@ -0,0 +1,304 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+const (
+	// EnvTransitAddress and friends override the matching values in the
+	// seal configuration block
+	EnvTransitAddress   = "VAULT_TRANSIT_SEAL_ADDR"
+	EnvTransitToken     = "VAULT_TRANSIT_SEAL_TOKEN"
+	EnvTransitMountPath = "VAULT_TRANSIT_SEAL_MOUNT_PATH"
+	EnvTransitKeyName   = "VAULT_TRANSIT_SEAL_KEY_NAME"
+)
+
+// Seal is a seal that leverages the transit secrets engine of another Vault
+// server to encrypt and decrypt the barrier's keys.
+type Seal struct {
+	logger       log.Logger
+	client       *api.Client
+	renewer      *api.Renewer
+	mountPath    string
+	keyName      string
+	currentKeyID *atomic.Value
+}
+
+var _ seal.Access = (*Seal)(nil)
+
+// NewSeal creates a new transit seal. SetConfig must be called before the
+// seal can be used.
+func NewSeal(logger log.Logger) *Seal {
+	s := &Seal{
+		logger:       logger,
+		currentKeyID: new(atomic.Value),
+	}
+	s.currentKeyID.Store("")
+	return s
+}
+
+// SetConfig processes the config map, creating the client used to talk to the
+// remote Vault server. It returns a map of values suitable for display to the
+// operator.
+func (s *Seal) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = map[string]string{}
+	}
+
+	mountPath := config["mount_path"]
+	if v := os.Getenv(EnvTransitMountPath); v != "" {
+		mountPath = v
+	}
+	mountPath = strings.Trim(mountPath, "/")
+	if mountPath == "" {
+		return nil, errors.New("mount_path is required")
+	}
+
+	keyName := config["key_name"]
+	if v := os.Getenv(EnvTransitKeyName); v != "" {
+		keyName = v
+	}
+	if keyName == "" {
+		return nil, errors.New("key_name is required")
+	}
+
+	disableRenewal := false
+	if v, ok := config["disable_renewal"]; ok && v != "" {
+		var err error
+		disableRenewal, err = parseutil.ParseBool(v)
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing 'disable_renewal': {{err}}", err)
+		}
+	}
+
+	apiConfig := api.DefaultConfig()
+	if apiConfig.Error != nil {
+		return nil, apiConfig.Error
+	}
+
+	if v := os.Getenv(EnvTransitAddress); v != "" {
+		apiConfig.Address = v
+	} else if v, ok := config["address"]; ok && v != "" {
+		apiConfig.Address = v
+	}
+
+	tlsConfig := &api.TLSConfig{
+		CACert:        config["tls_ca_cert"],
+		ClientCert:    config["tls_client_cert"],
+		ClientKey:     config["tls_client_key"],
+		TLSServerName: config["tls_server_name"],
+	}
+	if v, ok := config["tls_skip_verify"]; ok && v != "" {
+		var err error
+		tlsConfig.Insecure, err = parseutil.ParseBool(v)
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing 'tls_skip_verify': {{err}}", err)
+		}
+	}
+	if tlsConfig.CACert != "" || tlsConfig.ClientCert != "" || tlsConfig.ClientKey != "" || tlsConfig.TLSServerName != "" || tlsConfig.Insecure {
+		if err := apiConfig.ConfigureTLS(tlsConfig); err != nil {
+			return nil, errwrap.Wrapf("error configuring TLS for transit seal: {{err}}", err)
+		}
+	}
+
+	client, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, errwrap.Wrapf("error creating transit seal client: {{err}}", err)
+	}
+
+	token := os.Getenv(EnvTransitToken)
+	if token == "" {
+		token = config["token"]
+	}
+	if token == "" {
+		token = client.Token()
+	}
+	if token == "" {
+		return nil, errors.New("missing token for transit seal")
+	}
+	client.SetToken(token)
+
+	if !disableRenewal {
+		secret, err := client.Auth().Token().LookupSelf()
+		if err != nil {
+			return nil, errwrap.Wrapf("error looking up transit seal token: {{err}}", err)
+		}
+		renewable, err := secret.TokenIsRenewable()
+		if err != nil {
+			return nil, errwrap.Wrapf("error determining if transit seal token is renewable: {{err}}", err)
+		}
+		if renewable {
+			// The lookup response doesn't carry an auth block, which the
+			// renewer expects, so build one from the data we have
+			ttl, err := secret.TokenTTL()
+			if err != nil {
+				return nil, errwrap.Wrapf("error determining transit seal token TTL: {{err}}", err)
+			}
+			renewer, err := client.NewRenewer(&api.RenewerInput{
+				Secret: &api.Secret{
+					Auth: &api.SecretAuth{
+						ClientToken:   token,
+						Renewable:     true,
+						LeaseDuration: int(ttl.Seconds()),
+					},
+				},
+			})
+			if err != nil {
+				return nil, errwrap.Wrapf("error creating transit seal token renewer: {{err}}", err)
+			}
+			s.renewer = renewer
+			go s.watchRenewer()
+		}
+	}
+
+	s.client = client
+	s.mountPath = mountPath
+	s.keyName = keyName
+
+	sealInfo := map[string]string{
+		"address":    client.Address(),
+		"mount_path": mountPath,
+		"key_name":   keyName,
+	}
+
+	return sealInfo, nil
+}
+
+// watchRenewer keeps the transit token alive for as long as the seal is in
+// use, logging any problems renewing it.
+func (s *Seal) watchRenewer() {
+	go s.renewer.Renew()
+	for {
+		select {
+		case err := <-s.renewer.DoneCh():
+			if err != nil {
+				s.logger.Error("error renewing transit seal token", "error", err)
+			}
+			return
+		case <-s.renewer.RenewCh():
+			s.logger.Trace("successfully renewed transit seal token")
+		}
+	}
+}
+
+// Init is called during core.Initialize. This is a no-op.
+func (s *Seal) Init(_ context.Context) error {
+	return nil
+}
+
+// Finalize is called during shutdown and stops renewing the token.
+func (s *Seal) Finalize(_ context.Context) error {
+	if s.renewer != nil {
+		s.renewer.Stop()
+	}
+	return nil
+}
+
+// SealType returns the seal mechanism type.
+func (s *Seal) SealType() string {
+	return seal.Transit
+}
+
+// KeyID returns the last known version of the transit key.
+func (s *Seal) KeyID() string {
+	return s.currentKeyID.Load().(string)
+}
+
+// Encrypt is used to encrypt using the remote transit key
+func (s *Seal) Encrypt(_ context.Context, plaintext []byte) (*seal.EncryptedBlobInfo, error) {
+	if plaintext == nil {
+		return nil, errors.New("given plaintext for encryption is nil")
+	}
+	if s.client == nil {
+		return nil, errors.New("transit seal has not been configured")
+	}
+
+	secret, err := s.client.Logical().Write(path.Join(s.mountPath, "encrypt", s.keyName), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("error encrypting with transit seal: {{err}}", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("empty response encrypting with transit seal")
+	}
+
+	ciphertext, ok := secret.Data["ciphertext"].(string)
+	if !ok || ciphertext == "" {
+		return nil, errors.New("no ciphertext returned by transit seal")
+	}
+
+	keyID, err := keyIDFromCiphertext(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.currentKeyID.Store(keyID)
+
+	return &seal.EncryptedBlobInfo{
+		Ciphertext: []byte(ciphertext),
+		KeyInfo: &seal.KeyInfo{
+			KeyID: keyID,
+		},
+	}, nil
+}
+
+// Decrypt is used to decrypt the ciphertext using the remote transit key
+func (s *Seal) Decrypt(_ context.Context, in *seal.EncryptedBlobInfo) ([]byte, error) {
+	if in == nil {
+		return nil, errors.New("given input for decryption is nil")
+	}
+	if s.client == nil {
+		return nil, errors.New("transit seal has not been configured")
+	}
+
+	secret, err := s.client.Logical().Write(path.Join(s.mountPath, "decrypt", s.keyName), map[string]interface{}{
+		"ciphertext": string(in.Ciphertext),
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("error decrypting with transit seal: {{err}}", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("empty response decrypting with transit seal")
+	}
+
+	encoded, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, errors.New("no plaintext returned by transit seal")
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errwrap.Wrapf("error decoding plaintext from transit seal: {{err}}", err)
+	}
+
+	return plaintext, nil
+}
+
+// keyIDFromCiphertext extracts the key version from transit ciphertext of the
+// form vault:v<version>:<ciphertext>
+func keyIDFromCiphertext(ciphertext string) (string, error) {
+	splitted := strings.SplitN(ciphertext, ":", 3)
+	if len(splitted) != 3 || splitted[0] != "vault" || !strings.HasPrefix(splitted[1], "v") {
+		return "", fmt.Errorf("invalid ciphertext returned by transit seal")
+	}
+
+	version := strings.TrimPrefix(splitted[1], "v")
+	if _, err := strconv.Atoi(version); err != nil {
+		return "", fmt.Errorf("invalid key version in ciphertext returned by transit seal")
+	}
+
+	return version, nil
+}
@@ -0,0 +1,187 @@
+package transit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	transitbackend "github.com/hashicorp/vault/builtin/logical/transit"
+	"github.com/hashicorp/vault/helper/logging"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+// testTransitCluster starts a cluster with the transit secrets engine mounted
+// and a key created, returning the cluster and a client for it.
+func testTransitCluster(t *testing.T) (*vault.TestCluster, *api.Client) {
+	t.Helper()
+
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"transit": transitbackend.Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+		NumCores:    1,
+	})
+	cluster.Start()
+
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+	client := cluster.Cores[0].Client
+
+	if err := client.Sys().Mount("transit", &api.MountInput{
+		Type: "transit",
+	}); err != nil {
+		cluster.Cleanup()
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("transit/keys/unseal", nil); err != nil {
+		cluster.Cleanup()
+		t.Fatal(err)
+	}
+
+	return cluster, client
+}
+
+func testTransitSealConfig(cluster *vault.TestCluster, client *api.Client) map[string]string {
+	return map[string]string{
+		"address":     client.Address(),
+		"token":       cluster.RootToken,
+		"mount_path":  "transit",
+		"key_name":    "unseal",
+		"tls_ca_cert": cluster.CACertPEMFile,
+	}
+}
+
+func TestTransitSeal_SetConfig(t *testing.T) {
+	s := NewSeal(logging.NewVaultLogger(log.Trace))
+
+	if _, err := s.SetConfig(map[string]string{"address": "https://127.0.0.1:8200", "token": "foo"}); err == nil {
+		t.Fatal("expected error without mount_path")
+	}
+	if _, err := s.SetConfig(map[string]string{"mount_path": "transit", "token": "foo"}); err == nil {
+		t.Fatal("expected error without key_name")
+	}
+	if _, err := s.SetConfig(map[string]string{"mount_path": "transit", "key_name": "unseal", "disable_renewal": "nope"}); err == nil {
+		t.Fatal("expected error with invalid disable_renewal")
+	}
+}
+
+func TestTransitSeal_Lifecycle(t *testing.T) {
+	cluster, client := testTransitCluster(t)
+	defer cluster.Cleanup()
+
+	s := NewSeal(logging.NewVaultLogger(log.Trace))
+	sealInfo, err := s.SetConfig(testTransitSealConfig(cluster, client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Finalize(context.Background())
+
+	if sealInfo["mount_path"] != "transit" || sealInfo["key_name"] != "unseal" {
+		t.Fatalf("bad seal info: %#v", sealInfo)
+	}
+
+	input := []byte("foo")
+	swi, err := s.Encrypt(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swi.KeyInfo == nil || swi.KeyInfo.KeyID != "1" {
+		t.Fatalf("bad key info: %#v", swi.KeyInfo)
+	}
+	if s.KeyID() != "1" {
+		t.Fatalf("bad key id: %q", s.KeyID())
+	}
+
+	pt, err := s.Decrypt(context.Background(), swi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(input, pt) {
+		t.Fatalf("expected %s, got %s", input, pt)
+	}
+
+	// Values encrypted before a rotation must still decrypt afterwards
+	if _, err := client.Logical().Write("transit/keys/unseal/rotate", nil); err != nil {
+		t.Fatal(err)
+	}
+	swi2, err := s.Encrypt(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swi2.KeyInfo.KeyID != "2" {
+		t.Fatalf("bad key id after rotation: %q", swi2.KeyInfo.KeyID)
+	}
+	pt, err = s.Decrypt(context.Background(), swi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(input, pt) {
+		t.Fatalf("expected %s, got %s", input, pt)
+	}
+}
+
+func TestTransitSeal_AutoUnseal(t *testing.T) {
+	cluster, client := testTransitCluster(t)
+	defer cluster.Cleanup()
+
+	s := NewSeal(logging.NewVaultLogger(log.Trace))
+	if _, err := s.SetConfig(testTransitSealConfig(cluster, client)); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Finalize(context.Background())
+
+	core := vault.TestCoreWithSeal(t, vault.NewAutoSeal(s), false)
+
+	ctx := context.Background()
+	result, err := core.Initialize(ctx, &vault.InitParams{
+		BarrierConfig: &vault.SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+			StoredShares:    1,
+		},
+		RecoveryConfig: &vault.SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.RecoveryShares) != 1 {
+		t.Fatalf("expected a recovery key, got %d", len(result.RecoveryShares))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := core.UnsealWithStoredKeys(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if sealed, _ := core.Sealed(); sealed {
+			t.Fatal("should not be sealed")
+		}
+		if err := core.Seal(result.RootToken); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The barrier keys must be unrecoverable without the transit key
+	if _, err := client.Logical().Write("transit/keys/unseal/config", map[string]interface{}{
+		"deletion_allowed": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Delete("transit/keys/unseal"); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.UnsealWithStoredKeys(ctx); err == nil {
+		t.Fatal("expected error unsealing after the transit key was deleted")
+	}
+	if sealed, _ := core.Sealed(); !sealed {
+		t.Fatal("should be sealed")
+	}
+}
@@ -0,0 +1,399 @@
+package vault
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+// autoSeal is a Seal implementation that contains logic for encrypting and
+// decrypting stored keys via an underlying seal.Access implementation, as
+// well as logic related to recovery keys and barrier config.
+type autoSeal struct {
+	seal.Access
+
+	barrierConfig  atomic.Value
+	recoveryConfig atomic.Value
+	core           *Core
+}
+
+// Ensure we are implementing the Seal interface
+var _ Seal = (*autoSeal)(nil)
+
+// NewAutoSeal returns a Seal that uses the given seal.Access to protect the
+// master key, storing it alongside the barrier so that Vault can unseal
+// itself. Recovery keys take the place of unseal keys for operations that
+// require a quorum of operators.
+func NewAutoSeal(lowLevel seal.Access) Seal {
+	ret := &autoSeal{
+		Access: lowLevel,
+	}
+	ret.barrierConfig.Store((*SealConfig)(nil))
+	ret.recoveryConfig.Store((*SealConfig)(nil))
+	return ret
+}
+
+func (d *autoSeal) checkCore() error {
+	if d.core == nil {
+		return fmt.Errorf("seal does not have a core set")
+	}
+	return nil
+}
+
+func (d *autoSeal) SetCore(core *Core) {
+	d.core = core
+}
+
+func (d *autoSeal) Init(ctx context.Context) error {
+	return d.Access.Init(ctx)
+}
+
+func (d *autoSeal) Finalize(ctx context.Context) error {
+	return d.Access.Finalize(ctx)
+}
+
+func (d *autoSeal) BarrierType() string {
+	return d.SealType()
+}
+
+func (d *autoSeal) StoredKeysSupported() bool {
+	return true
+}
+
+func (d *autoSeal) RecoveryKeySupported() bool {
+	return true
+}
+
+// SetStoredKeys uses the autoSeal.Access.Encrypts method to wrap the keys. The
+// stored entry is the encoded seal.EncryptedBlobInfo.
+func (d *autoSeal) SetStoredKeys(ctx context.Context, keys [][]byte) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+	if keys == nil {
+		return fmt.Errorf("keys were nil")
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys provided")
+	}
+
+	buf, err := json.Marshal(keys)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode keys for storage: {{err}}", err)
+	}
+
+	return d.putEncrypted(ctx, storedBarrierKeysPath, buf)
+}
+
+// GetStoredKeys retrieves the key shares by unwrapping the encrypted key
+// using the autoseal.
+func (d *autoSeal) GetStoredKeys(ctx context.Context) ([][]byte, error) {
+	if err := d.checkCore(); err != nil {
+		return nil, err
+	}
+
+	pt, err := d.getEncrypted(ctx, storedBarrierKeysPath)
+	if err != nil {
+		return nil, err
+	}
+	if pt == nil {
+		return nil, fmt.Errorf("failed to find stored keys")
+	}
+
+	var keys [][]byte
+	if err := json.Unmarshal(pt, &keys); err != nil {
+		return nil, errwrap.Wrapf("failed to decode stored keys: {{err}}", err)
+	}
+
+	return keys, nil
+}
+
+func (d *autoSeal) BarrierConfig(ctx context.Context) (*SealConfig, error) {
+	if d.barrierConfig.Load().(*SealConfig) != nil {
+		return d.barrierConfig.Load().(*SealConfig).Clone(), nil
+	}
+
+	if err := d.checkCore(); err != nil {
+		return nil, err
+	}
+
+	sealType := "barrier"
+
+	entry, err := d.core.physical.Get(ctx, barrierSealConfigPath)
+	if err != nil {
+		d.core.logger.Error("autoseal: failed to read seal configuration", "seal_type", sealType, "error", err)
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to read %q seal configuration: {{err}}", sealType), err)
+	}
+
+	// If the seal configuration is missing, we are not initialized
+	if entry == nil {
+		if d.core.logger.IsInfo() {
+			d.core.logger.Info("autoseal: seal configuration missing, not initialized", "seal_type", sealType)
+		}
+		return nil, nil
+	}
+
+	conf := &SealConfig{}
+	err = json.Unmarshal(entry.Value, conf)
+	if err != nil {
+		d.core.logger.Error("autoseal: failed to decode seal configuration", "seal_type", sealType, "error", err)
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to decode %q seal configuration: {{err}}", sealType), err)
+	}
+
+	// Check for a valid seal configuration
+	if err := conf.Validate(); err != nil {
+		d.core.logger.Error("autoseal: invalid seal configuration", "seal_type", sealType, "error", err)
+		return nil, errwrap.Wrapf(fmt.Sprintf("%q seal validation failed: {{err}}", sealType), err)
+	}
+
+	if conf.Type != d.BarrierType() {
+		d.core.logger.Error("autoseal: barrier seal type does not match loaded type", "seal_type", conf.Type, "loaded_type", d.BarrierType())
+		return nil, fmt.Errorf("barrier seal type of %q does not match loaded type of %q", conf.Type, d.BarrierType())
+	}
+
+	d.barrierConfig.Store(conf)
+	return conf.Clone(), nil
+}
+
+func (d *autoSeal) SetBarrierConfig(ctx context.Context, conf *SealConfig) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	if conf == nil {
+		d.barrierConfig.Store((*SealConfig)(nil))
+		return nil
+	}
+
+	conf.Type = d.BarrierType()
+
+	// Encode the seal configuration
+	buf, err := json.Marshal(conf)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode barrier seal configuration: {{err}}", err)
+	}
+
+	// Store the seal configuration
+	pe := &physical.Entry{
+		Key:   barrierSealConfigPath,
+		Value: buf,
+	}
+
+	if err := d.core.physical.Put(ctx, pe); err != nil {
+		d.core.logger.Error("autoseal: failed to write barrier seal configuration", "error", err)
+		return errwrap.Wrapf("failed to write barrier seal configuration: {{err}}", err)
+	}
+
+	d.barrierConfig.Store(conf.Clone())
+
+	return nil
+}
+
+// SetCachedBarrierConfig sets the cached barrier configuration without
+// persisting it.
+func (d *autoSeal) SetCachedBarrierConfig(config *SealConfig) {
+	d.barrierConfig.Store(config)
+}
+
+func (d *autoSeal) RecoveryType() string {
+	return RecoveryTypeShamir
+}
+
+// RecoveryConfig returns the recovery config on recoverySealConfigPlaintextPath.
+func (d *autoSeal) RecoveryConfig(ctx context.Context) (*SealConfig, error) {
+	if d.recoveryConfig.Load().(*SealConfig) != nil {
+		return d.recoveryConfig.Load().(*SealConfig).Clone(), nil
+	}
+
+	if err := d.checkCore(); err != nil {
+		return nil, err
+	}
+
+	sealType := "recovery"
+
+	entry, err := d.core.physical.Get(ctx, recoverySealConfigPlaintextPath)
+	if err != nil {
+		d.core.logger.Error("autoseal: failed to read seal configuration", "seal_type", sealType, "error", err)
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to read %q seal configuration: {{err}}", sealType), err)
+	}
+
+	if entry == nil {
+		if d.core.logger.IsInfo() {
+			d.core.logger.Info("autoseal: seal configuration missing, not initialized", "seal_type", sealType)
+		}
+		return nil, nil
+	}
+
+	conf := &SealConfig{}
+	if err := json.Unmarshal(entry.Value, conf); err != nil {
+		d.core.logger.Error("autoseal: failed to decode seal configuration", "seal_type", sealType, "error", err)
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to decode %q seal configuration: {{err}}", sealType), err)
+	}
+
+	// Check for a valid seal configuration
+	if err := conf.Validate(); err != nil {
+		d.core.logger.Error("autoseal: invalid seal configuration", "seal_type", sealType, "error", err)
+		return nil, errwrap.Wrapf(fmt.Sprintf("%q seal validation failed: {{err}}", sealType), err)
+	}
+
+	if conf.Type != d.RecoveryType() {
+		d.core.logger.Error("autoseal: recovery seal type does not match loaded type", "seal_type", conf.Type, "loaded_type", d.RecoveryType())
+		return nil, fmt.Errorf("recovery seal type of %q does not match loaded type of %q", conf.Type, d.RecoveryType())
+	}
+
+	d.recoveryConfig.Store(conf)
+	return conf.Clone(), nil
+}
+
+// SetRecoveryConfig writes the recovery configuration to the physical storage
+// and sets it as the seal's recoveryConfig.
+func (d *autoSeal) SetRecoveryConfig(ctx context.Context, conf *SealConfig) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	if conf == nil {
+		d.recoveryConfig.Store((*SealConfig)(nil))
+		return nil
+	}
+
+	conf.Type = d.RecoveryType()
+
+	// Encode the seal configuration
+	buf, err := json.Marshal(conf)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode recovery seal configuration: {{err}}", err)
+	}
+
+	// Store the seal configuration directly in the physical storage
+	pe := &physical.Entry{
+		Key:   recoverySealConfigPlaintextPath,
+		Value: buf,
+	}
+
+	if err := d.core.physical.Put(ctx, pe); err != nil {
+		d.core.logger.Error("autoseal: failed to write recovery seal configuration", "error", err)
+		return errwrap.Wrapf("failed to write recovery seal configuration: {{err}}", err)
+	}
+
+	d.recoveryConfig.Store(conf.Clone())
+
+	return nil
+}
+
+// SetCachedRecoveryConfig sets the cached recovery configuration without
+// persisting it.
+func (d *autoSeal) SetCachedRecoveryConfig(config *SealConfig) {
+	d.recoveryConfig.Store(config)
+}
+
+// VerifyRecoveryKey checks the given key against the recovery key stored
+// through the seal.
+func (d *autoSeal) VerifyRecoveryKey(ctx context.Context, key []byte) error {
+	if key == nil {
+		return fmt.Errorf("recovery key to verify is nil")
+	}
+
+	pt, err := d.getRecoveryKeyInternal(ctx)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(key, pt) != 1 {
+		return fmt.Errorf("recovery key does not match submitted values")
+	}
+
+	return nil
+}
+
+// SetRecoveryKey encrypts the given key through the seal and stores it.
+func (d *autoSeal) SetRecoveryKey(ctx context.Context, key []byte) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	if key == nil {
+		return fmt.Errorf("recovery key to store is nil")
+	}
+
+	return d.putEncrypted(ctx, recoveryKeyPath, key)
+}
+
+// RecoveryKey returns the recovery key after decrypting it through the seal.
+func (d *autoSeal) RecoveryKey(ctx context.Context) ([]byte, error) {
+	return d.getRecoveryKeyInternal(ctx)
+}
+
+func (d *autoSeal) getRecoveryKeyInternal(ctx context.Context) ([]byte, error) {
+	if err := d.checkCore(); err != nil {
+		return nil, err
+	}
+
+	pt, err := d.getEncrypted(ctx, recoveryKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if pt == nil {
+		return nil, fmt.Errorf("no recovery key found")
+	}
+
+	return pt, nil
+}
+
+// putEncrypted encrypts the value through the seal and writes the resulting
+// blob directly to physical storage, since these values must be readable
+// while the barrier is sealed.
+func (d *autoSeal) putEncrypted(ctx context.Context, path string, value []byte) error {
+	blobInfo, err := d.Encrypt(ctx, value)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to encrypt value for %q: {{err}}", path), err)
+	}
+
+	buf, err := json.Marshal(blobInfo)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to encode encrypted value for %q: {{err}}", path), err)
+	}
+
+	pe := &physical.Entry{
+		Key:   path,
+		Value: buf,
+	}
+	if err := d.core.physical.Put(ctx, pe); err != nil {
+		d.core.logger.Error("autoseal: failed to write encrypted value", "path", path, "error", err)
+		return errwrap.Wrapf(fmt.Sprintf("failed to write encrypted value for %q: {{err}}", path), err)
+	}
+
+	return nil
+}
+
+// getEncrypted reads an entry written by putEncrypted and decrypts it through
+// the seal. A nil value is returned if no entry exists.
+func (d *autoSeal) getEncrypted(ctx context.Context, path string) ([]byte, error) {
+	pe, err := d.core.physical.Get(ctx, path)
+	if err != nil {
+		d.core.logger.Error("autoseal: failed to read encrypted value", "path", path, "error", err)
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to read encrypted value for %q: {{err}}", path), err)
+	}
+	if pe == nil {
+		return nil, nil
+	}
+
+	blobInfo := &seal.EncryptedBlobInfo{}
+	if err := jsonutil.DecodeJSON(pe.Value, blobInfo); err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to decode encrypted value for %q: {{err}}", path), err)
+	}
+
+	pt, err := d.Decrypt(ctx, blobInfo)
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to decrypt value for %q: {{err}}", path), err)
+	}
+
+	return pt, nil
+}
@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+func TestAutoSeal_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	autoSeal := NewAutoSeal(seal.NewTestSeal(""))
+	core := TestCoreWithSeal(t, autoSeal, false)
+
+	result, err := core.Initialize(ctx, &InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+			StoredShares:    1,
+		},
+		RecoveryConfig: &SealConfig{
+			SecretShares:    3,
+			SecretThreshold: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.SecretShares) != 0 {
+		t.Fatalf("expected no unseal keys to be returned, got %d", len(result.SecretShares))
+	}
+	if len(result.RecoveryShares) != 3 {
+		t.Fatalf("expected 3 recovery keys, got %d", len(result.RecoveryShares))
+	}
+
+	// The stored keys should be usable to unseal without any operator input
+	if err := core.UnsealWithStoredKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+
+	barrierConf, err := autoSeal.BarrierConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if barrierConf.Type != seal.Test {
+		t.Fatalf("bad barrier type: %q", barrierConf.Type)
+	}
+
+	if err := core.Seal(result.RootToken); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); !sealed {
+		t.Fatal("should be sealed")
+	}
+
+	// Clear the cached configs to ensure they are read back from storage
+	core.SealAccess().ClearCaches(ctx)
+
+	if err := core.UnsealWithStoredKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+
+	recoveryConf, err := autoSeal.RecoveryConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recoveryConf.Type != RecoveryTypeShamir || recoveryConf.SecretShares != 3 || recoveryConf.SecretThreshold != 2 {
+		t.Fatalf("bad recovery config: %#v", recoveryConf)
+	}
+
+	// Recovery keys can be used in place of unseal keys
+	if err := core.Seal(result.RootToken); err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range result.RecoveryShares[:2] {
+		unsealed, err := core.UnsealWithRecoveryKeys(ctx, TestKeyCopy(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && unsealed {
+			t.Fatal("should not be unsealed with a single recovery key")
+		}
+		if i == 1 && !unsealed {
+			t.Fatal("should be unsealed")
+		}
+	}
+}
+
+func TestAutoSeal_TypeMismatch(t *testing.T) {
+	ctx := context.Background()
+
+	core := TestCoreWithSeal(t, NewAutoSeal(seal.NewTestSeal("")), false)
+	TestCoreInit(t, core)
+
+	// A seal of a different type must refuse the stored configuration
+	otherSeal := NewAutoSeal(seal.NewTestSeal(SealTypeTransit))
+	otherSeal.SetCore(core)
+	if _, err := otherSeal.BarrierConfig(ctx); err == nil {
+		t.Fatal("expected error loading barrier config with mismatched seal type")
+	}
+}
+
+func TestAutoSeal_RecoveryKey(t *testing.T) {
+	ctx := context.Background()
+
+	core := TestCoreWithSeal(t, NewAutoSeal(seal.NewTestSeal("")), false)
+	TestCoreInit(t, core)
+
+	if err := core.seal.SetRecoveryKey(ctx, []byte("recovery")); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.seal.VerifyRecoveryKey(ctx, []byte("recovery")); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.seal.VerifyRecoveryKey(ctx, []byte("not the key")); err == nil {
+		t.Fatal("expected error verifying wrong recovery key")
+	}
+}
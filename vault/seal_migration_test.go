@@ -0,0 +1,300 @@
+package vault
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/helper/logging"
+	"github.com/hashicorp/vault/physical"
+	physInmem "github.com/hashicorp/vault/physical/inmem"
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+// testCoreWithSealAndBackend returns an uninitialized core using the given
+// seal and physical backend, so that a restart with a different seal can be
+// simulated.
+func testCoreWithSealAndBackend(t *testing.T, testSeal Seal, backend physical.Backend) *Core {
+	t.Helper()
+	conf := testCoreConfig(t, backend, logging.NewVaultLogger(log.Trace))
+	conf.Seal = testSeal
+
+	c, err := NewCore(conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return c
+}
+
+func testSealMigrationBackend(t *testing.T) physical.Backend {
+	t.Helper()
+	backend, err := physInmem.NewInmem(nil, logging.NewVaultLogger(log.Trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func testUnsealMigrate(t *testing.T, core *Core, keys [][]byte) {
+	t.Helper()
+	for i, key := range keys {
+		unsealed, err := core.UnsealMigrate(TestKeyCopy(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(keys)-1 && unsealed {
+			t.Fatal("unsealed before threshold was reached")
+		}
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+	if core.IsInSealMigration() {
+		t.Fatal("should not be in seal migration mode after unsealing")
+	}
+}
+
+func TestSealMigration_ShamirToAutoAndBack(t *testing.T) {
+	ctx := context.Background()
+	backend := testSealMigrationBackend(t)
+
+	// Start with a shamir sealed core
+	core := testCoreWithSealAndBackend(t, NewDefaultSeal(), backend)
+	result, err := core.Initialize(ctx, &InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    5,
+			SecretThreshold: 3,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsealKeys := result.SecretShares
+	rootToken := result.RootToken
+
+	// Restart with an auto seal, which should require migration
+	core = testCoreWithSealAndBackend(t, NewAutoSeal(seal.NewTestSeal("")), backend)
+	if err := core.AdjustForSealMigration(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !core.IsInSealMigration() {
+		t.Fatal("expected core to be in seal migration mode")
+	}
+	if err := core.UnsealWithStoredKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); !sealed {
+		t.Fatal("should not auto-unseal before migration")
+	}
+	if _, err := core.Unseal(TestKeyCopy(unsealKeys[0])); err != ErrSealMigrationRequired {
+		t.Fatalf("expected seal migration required error, got %v", err)
+	}
+
+	testUnsealMigrate(t, core, unsealKeys[:3])
+
+	barrierConf, err := core.seal.BarrierConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if barrierConf.Type != SealTypeTest || barrierConf.StoredShares != 1 {
+		t.Fatalf("bad barrier config after migration: %#v", barrierConf)
+	}
+	recoveryConf, err := core.seal.RecoveryConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recoveryConf.SecretShares != 5 || recoveryConf.SecretThreshold != 3 {
+		t.Fatalf("bad recovery config after migration: %#v", recoveryConf)
+	}
+
+	// The root token must still be valid
+	if err := core.Seal(rootToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart with the same seal should auto-unseal without migrating
+	core = testCoreWithSealAndBackend(t, NewAutoSeal(seal.NewTestSeal("")), backend)
+	if err := core.AdjustForSealMigration(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if core.IsInSealMigration() {
+		t.Fatal("should not be in seal migration mode")
+	}
+	if err := core.UnsealWithStoredKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should be unsealed with stored keys")
+	}
+	if err := core.Seal(rootToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous unseal keys are now recovery keys
+	for _, key := range unsealKeys[2:] {
+		if _, err := core.UnsealWithRecoveryKeys(ctx, TestKeyCopy(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should be unsealed with recovery keys")
+	}
+	if err := core.Seal(rootToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrate back to shamir, which requires the auto seal to unwrap the keys
+	core = testCoreWithSealAndBackend(t, NewDefaultSeal(), backend)
+	if err := core.AdjustForSealMigration(ctx, nil); err == nil {
+		t.Fatal("expected error migrating away from auto seal without the disabled seal")
+	}
+	if err := core.AdjustForSealMigration(ctx, NewAutoSeal(seal.NewTestSeal(""))); err != nil {
+		t.Fatal(err)
+	}
+	testUnsealMigrate(t, core, unsealKeys[1:4])
+	if err := core.Seal(rootToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// The original unseal keys work again with the shamir seal
+	core = testCoreWithSealAndBackend(t, NewDefaultSeal(), backend)
+	if err := core.AdjustForSealMigration(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range unsealKeys[:3] {
+		if _, err := core.Unseal(TestKeyCopy(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should be unsealed with the original unseal keys")
+	}
+	barrierConf, err = core.seal.BarrierConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if barrierConf.Type != SealTypeShamir || barrierConf.SecretShares != 5 || barrierConf.SecretThreshold != 3 || barrierConf.StoredShares != 0 {
+		t.Fatalf("bad barrier config after migration: %#v", barrierConf)
+	}
+}
+
+func TestSealMigration_AutoToShamir(t *testing.T) {
+	ctx := context.Background()
+	backend := testSealMigrationBackend(t)
+
+	core := testCoreWithSealAndBackend(t, NewAutoSeal(seal.NewTestSeal("")), backend)
+	result, err := core.Initialize(ctx, &InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+			StoredShares:    1,
+		},
+		RecoveryConfig: &SealConfig{
+			SecretShares:    3,
+			SecretThreshold: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The disabled seal must match the seal the data was written with
+	core = testCoreWithSealAndBackend(t, NewDefaultSeal(), backend)
+	if err := core.AdjustForSealMigration(ctx, NewAutoSeal(seal.NewTestSeal(SealTypeTransit))); err == nil {
+		t.Fatal("expected error with mismatched disabled seal type")
+	}
+
+	core = testCoreWithSealAndBackend(t, NewDefaultSeal(), backend)
+	if err := core.AdjustForSealMigration(ctx, NewAutoSeal(seal.NewTestSeal(""))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.UnsealWithRecoveryKeys(ctx, TestKeyCopy(result.RecoveryShares[0])); err != ErrSealMigrationRequired {
+		t.Fatalf("expected seal migration required error, got %v", err)
+	}
+	testUnsealMigrate(t, core, result.RecoveryShares[:2])
+	if err := core.Seal(result.RootToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recovery keys have become the unseal keys
+	core = testCoreWithSealAndBackend(t, NewDefaultSeal(), backend)
+	if err := core.AdjustForSealMigration(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.UnsealMigrate(TestKeyCopy(result.RecoveryShares[0])); err != ErrNotInSealMigration {
+		t.Fatalf("expected not in seal migration error, got %v", err)
+	}
+	for _, key := range result.RecoveryShares[1:] {
+		if _, err := core.Unseal(TestKeyCopy(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should be unsealed with the previous recovery keys")
+	}
+
+	// Values only meaningful to the auto seal should have been removed
+	for _, path := range []string{storedBarrierKeysPath, recoveryKeyPath, recoverySealConfigPlaintextPath} {
+		entry, err := backend.Get(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry != nil {
+			t.Fatalf("expected %q to be removed", path)
+		}
+	}
+}
+
+func TestSealMigration_AutoToAuto(t *testing.T) {
+	ctx := context.Background()
+	backend := testSealMigrationBackend(t)
+
+	core := testCoreWithSealAndBackend(t, NewAutoSeal(seal.NewTestSeal("")), backend)
+	result, err := core.Initialize(ctx, &InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+			StoredShares:    1,
+		},
+		RecoveryConfig: &SealConfig{
+			SecretShares:    3,
+			SecretThreshold: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSeal := seal.NewTestSeal(SealTypeTransit)
+	newSeal.SetKeyID("new-key")
+	core = testCoreWithSealAndBackend(t, NewAutoSeal(newSeal), backend)
+	if err := core.AdjustForSealMigration(ctx, NewAutoSeal(seal.NewTestSeal(""))); err != nil {
+		t.Fatal(err)
+	}
+	testUnsealMigrate(t, core, result.RecoveryShares[1:])
+	if err := core.Seal(result.RootToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new seal unseals on its own and keeps the same recovery keys
+	core = testCoreWithSealAndBackend(t, NewAutoSeal(newSeal), backend)
+	if err := core.AdjustForSealMigration(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.UnsealWithStoredKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should be unsealed with stored keys")
+	}
+	if err := core.seal.VerifyRecoveryKey(ctx, nil); err == nil {
+		t.Fatal("expected error verifying nil recovery key")
+	}
+	recoveryConf, err := core.seal.RecoveryConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recoveryConf.SecretShares != 3 || recoveryConf.SecretThreshold != 2 {
+		t.Fatalf("bad recovery config after migration: %#v", recoveryConf)
+	}
+}
@@ -129,6 +129,21 @@ func TestCoreWithSeal(t testing.T, testSeal Seal, enableRaw bool) *Core {
 	return c
 }
 
+// TestCoreWithBackend returns an uninitialized core using the given physical
+// backend and the new seal configuration.
+func TestCoreWithBackend(t testing.T, backend physical.Backend) *Core {
+	logger := logging.NewVaultLogger(log.Trace)
+	conf := testCoreConfig(t, backend, logger)
+	conf.Seal = NewTestSeal(t, nil)
+
+	c, err := NewCore(conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return c
+}
+
 func testCoreConfig(t testing.T, physicalBackend physical.Backend, logger log.Logger) *CoreConfig {
 	t.Helper()
 	noopAudits := map[string]audit.Factory{
@@ -1165,6 +1180,7 @@ func NewTestCluster(t testing.T, base *CoreConfig, opts *TestClusterOptions) *Te
 		coreConfig.Seal = base.Seal
 		coreConfig.DevToken = base.DevToken
 		coreConfig.EnableRaw = base.EnableRaw
+		coreConfig.MetricsHelper = base.MetricsHelper
 
 		if !coreConfig.DisableMlock {
 			base.DisableMlock = false
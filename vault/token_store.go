@@ -2,6 +2,7 @@ package vault
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,6 +24,7 @@ import (
 	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/helper/salt"
@@ -52,11 +54,27 @@ const (
 	// rolesPrefix is the prefix used to store role information
 	rolesPrefix = "roles/"
 
+	// indexPrefix is the prefix used to store the secondary indexes of
+	// tokens by entity, policy and metadata. Index entries are keyed by the
+	// salted value followed by the salted accessor of the token.
+	indexPrefix       = "index/"
+	entityIndexPrefix = indexPrefix + "entity/"
+	policyIndexPrefix = indexPrefix + "policy/"
+	metaIndexPrefix   = indexPrefix + "meta/"
+
 	// tokenRevocationPending indicates that the token should not be used
 	// again. If this is encountered during an existing request flow, it means
 	// that the token is but is currently fulfilling its final use; after this
 	// request it will not be able to be looked up as being valid.
 	tokenRevocationPending = -1
+
+	// batchTokenPrefix is the prefix of every batch token ID, used to tell
+	// them apart from service tokens without a storage lookup
+	batchTokenPrefix = "b."
+
+	// batchTokenEncryptionKey is the key passed to the barrier when
+	// encrypting and decrypting the contents of batch tokens
+	batchTokenEncryptionKey = "token/batch"
 )
 
 var (
@@ -107,13 +125,15 @@ func (c *Core) LookupToken(token string) (*TokenEntry, error) {
 type TokenStore struct {
 	*framework.Backend
 
+	core *Core
+
 	view *BarrierView
 
 	expiration *ExpirationManager
 
 	cubbyholeBackend *CubbyholeBackend
 
-	policyLookupFunc func(string) (*Policy, error)
+	policyLookupFunc func(context.Context, string) (*Policy, error)
 
 	tokenLocks []*locksutil.LockEntry
 
@@ -132,7 +152,11 @@ type TokenStore struct {
 
 	tidyLock int64
 
-	identityPoliciesDeriverFunc func(string) (*identity.Entity, []string, error)
+	identityPoliciesDeriverFunc func(string) (*identity.Entity, map[string][]string, error)
+
+	// batchTokenEncryptor encrypts the contents of batch tokens into their
+	// IDs using the active keyring term
+	batchTokenEncryptor BarrierEncryptor
 }
 
 // NewTokenStore is used to construct a token store that is
@@ -143,6 +167,7 @@ func NewTokenStore(ctx context.Context, logger log.Logger, c *Core, config *logi
 
 	// Initialize the store
 	t := &TokenStore{
+		core:                        c,
 		view:                        view,
 		cubbyholeDestroyer:          destroyCubbyhole,
 		logger:                      logger,
@@ -150,10 +175,11 @@ func NewTokenStore(ctx context.Context, logger log.Logger, c *Core, config *logi
 		tokensPendingDeletion:       &sync.Map{},
 		saltLock:                    sync.RWMutex{},
 		identityPoliciesDeriverFunc: c.fetchEntityAndDerivedPolicies,
+		batchTokenEncryptor:         c.barrier,
 	}
 
 	if c.policyStore != nil {
-		t.policyLookupFunc = func(name string) (*Policy, error) {
+		t.policyLookupFunc = func(ctx context.Context, name string) (*Policy, error) {
 			return c.policyStore.GetPolicy(ctx, name, PolicyTypeToken)
 		}
 	}
@@ -174,6 +200,7 @@ func NewTokenStore(ctx context.Context, logger log.Logger, c *Core, config *logi
 				lookupPrefix,
 				accessorPrefix,
 				parentPrefix,
+				indexPrefix,
 				salt.DefaultLocation,
 			},
 		},
@@ -193,6 +220,8 @@ func NewTokenStore(ctx context.Context, logger log.Logger, c *Core, config *logi
 			&framework.Path{
 				Pattern: "accessors/$",
 
+				Fields: tokenFilterFields(),
+
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.ListOperation: t.tokenStoreAccessorList,
 				},
@@ -201,6 +230,19 @@ func NewTokenStore(ctx context.Context, logger log.Logger, c *Core, config *logi
 				HelpDescription: tokenListAccessorsHelp,
 			},
 
+			&framework.Path{
+				Pattern: "accessors/revoke$",
+
+				Fields: tokenFilterFields(),
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: t.handleRevokeAccessors,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(tokenRevokeAccessorsHelp),
+				HelpDescription: strings.TrimSpace(tokenRevokeAccessorsDesc),
+			},
+
 			&framework.Path{
 				Pattern: "roles/" + framework.GenericNameRegex("role_name"),
 				Fields: map[string]*framework.FieldSchema{
@@ -250,9 +292,20 @@ func NewTokenStore(ctx context.Context, logger log.Logger, c *Core, config *logi
 					},
 
 					"bound_cidrs": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: `Deprecated: use "token_bound_cidrs" instead. If this and "token_bound_cidrs" are both specified, only "token_bound_cidrs" will be used.`,
+					},
+
+					"token_bound_cidrs": &framework.FieldSchema{
 						Type:        framework.TypeCommaStringSlice,
 						Description: `Comma separated string or JSON list of CIDR blocks. If set, specifies the blocks of IP addresses which are allowed to use the generated token.`,
 					},
+
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     string(logical.TokenTypeDefaultService),
+						Description: tokenTypeHelp,
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -610,6 +663,32 @@ type TokenEntry struct {
 
 	// The set of CIDRs that this token can be used with
 	BoundCIDRs []*sockaddr.SockAddrMarshaler `json:"bound_cidrs"`
+
+	// The type of the token. Entries persisted before token types were
+	// introduced have an empty type and are service tokens.
+	Type logical.TokenType `json:"type" mapstructure:"type" structs:"type"`
+
+	// The ID of the namespace the token was created in. Entries persisted
+	// before namespaces were introduced have an empty ID and belong to the
+	// root namespace.
+	NamespaceID string `json:"namespace_id" mapstructure:"namespace_id" structs:"namespace_id" sentinel:""`
+}
+
+// batchTokenContents holds the parts of a batch token's entry that are
+// encrypted into its ID. Short keys keep the resulting token compact.
+type batchTokenContents struct {
+	Parent         string                        `json:"p,omitempty"`
+	Policies       []string                      `json:"pol,omitempty"`
+	Path           string                        `json:"pa"`
+	Meta           map[string]string             `json:"m,omitempty"`
+	DisplayName    string                        `json:"dn,omitempty"`
+	CreationTime   int64                         `json:"ct"`
+	TTL            time.Duration                 `json:"ttl"`
+	ExplicitMaxTTL time.Duration                 `json:"emt,omitempty"`
+	Role           string                        `json:"r,omitempty"`
+	EntityID       string                        `json:"e,omitempty"`
+	BoundCIDRs     []*sockaddr.SockAddrMarshaler `json:"c,omitempty"`
+	NamespaceID    string                        `json:"ns,omitempty"`
 }
 
 func (te *TokenEntry) SentinelGet(key string) (interface{}, error) {
@@ -695,11 +774,16 @@ type tsRoleEntry struct {
 
 	// The set of CIDRs that tokens generated using this role will be bound to
 	BoundCIDRs []*sockaddr.SockAddrMarshaler `json:"bound_cidrs"`
+
+	// The type of token to issue. Roles created before token types were
+	// introduced have an empty type, which behaves as default-service.
+	TokenType logical.TokenType `json:"token_type" mapstructure:"token_type" structs:"token_type"`
 }
 
 type accessorEntry struct {
-	TokenID    string `json:"token_id"`
-	AccessorID string `json:"accessor_id"`
+	TokenID     string `json:"token_id"`
+	AccessorID  string `json:"accessor_id"`
+	NamespaceID string `json:"namespace_id"`
 }
 
 // SetExpirationManager is used to provide the token store with
@@ -734,6 +818,20 @@ func (ts *TokenStore) rootToken(ctx context.Context) (*TokenEntry, error) {
 }
 
 func (ts *TokenStore) tokenStoreAccessorList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	filter := parseTokenFilter(req, d)
+	if !filter.empty() {
+		aEntries, err := ts.lookupByFilter(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]string, 0, len(aEntries))
+		for _, aEntry := range aEntries {
+			ret = append(ret, aEntry.AccessorID)
+		}
+		return logical.ListResponse(ret), nil
+	}
+
 	entries, err := ts.view.List(ctx, accessorPrefix)
 	if err != nil {
 		return nil, err
@@ -750,9 +848,14 @@ func (ts *TokenStore) tokenStoreAccessorList(ctx context.Context, req *logical.R
 		}
 		if aEntry.TokenID == "" {
 			resp.AddWarning(fmt.Sprintf("Found an accessor entry missing a token: %v", aEntry.AccessorID))
-		} else {
-			ret = append(ret, aEntry.AccessorID)
+			continue
+		}
+
+		// Only list the tokens of this namespace and the ones below it
+		if ts.checkNamespaceID(ctx, aEntry.NamespaceID) != nil {
+			continue
 		}
+		ret = append(ret, aEntry.AccessorID)
 	}
 
 	resp.Data = map[string]interface{}{
@@ -761,6 +864,206 @@ func (ts *TokenStore) tokenStoreAccessorList(ctx context.Context, req *logical.R
 	return resp, nil
 }
 
+// tokenFilter selects tokens by entity, policy and metadata, using the
+// secondary indexes. Tokens must match all the conditions that are set.
+type tokenFilter struct {
+	EntityID string
+	Policy   string
+	Meta     map[string]string
+}
+
+func tokenFilterFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"entity_id": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "If set, only tokens of this entity are selected",
+		},
+		"policy": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "If set, only tokens with this policy are selected",
+		},
+		"meta": &framework.FieldSchema{
+			Type: framework.TypeKVPairs,
+			Description: `If set, only tokens with these metadata key/value pairs are
+selected. Pairs can also be given as "meta.<key>=<value>" parameters.`,
+		},
+	}
+}
+
+// parseTokenFilter returns the filter of the request. Metadata conditions
+// are given in the "meta" field, or as "meta.<key>" parameters, which are
+// convenient in query strings.
+func parseTokenFilter(req *logical.Request, d *framework.FieldData) *tokenFilter {
+	filter := &tokenFilter{
+		EntityID: d.Get("entity_id").(string),
+		Policy:   d.Get("policy").(string),
+		Meta:     d.Get("meta").(map[string]string),
+	}
+	for key, value := range req.Data {
+		if !strings.HasPrefix(key, "meta.") {
+			continue
+		}
+		if filter.Meta == nil {
+			filter.Meta = make(map[string]string)
+		}
+		filter.Meta[strings.TrimPrefix(key, "meta.")] = fmt.Sprintf("%v", value)
+	}
+	return filter
+}
+
+func (f *tokenFilter) empty() bool {
+	return f.EntityID == "" && f.Policy == "" && len(f.Meta) == 0
+}
+
+func (f *tokenFilter) matches(te *TokenEntry) bool {
+	if f.EntityID != "" && te.EntityID != f.EntityID {
+		return false
+	}
+	if f.Policy != "" && !strutil.StrListContains(te.Policies, f.Policy) {
+		return false
+	}
+	for key, value := range f.Meta {
+		if actual, ok := te.Meta[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// indexPaths returns the paths of the entity, policy and metadata index
+// entries of the token. Tokens without accessors are not indexed.
+func (ts *TokenStore) indexPaths(ctx context.Context, entry *TokenEntry) ([]string, error) {
+	if entry.Accessor == "" {
+		return nil, nil
+	}
+
+	s, err := ts.Salt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	saltedAccessor := s.SaltID(entry.Accessor)
+
+	var paths []string
+	if entry.EntityID != "" {
+		paths = append(paths, entityIndexPrefix+s.SaltID(entry.EntityID)+"/"+saltedAccessor)
+	}
+	for _, policy := range entry.Policies {
+		paths = append(paths, policyIndexPrefix+s.SaltID(policy)+"/"+saltedAccessor)
+	}
+	for key, value := range entry.Meta {
+		paths = append(paths, metaIndexPrefix+s.SaltID(key)+"/"+s.SaltID(value)+"/"+saltedAccessor)
+	}
+	return paths, nil
+}
+
+// validIndexEntry returns whether the index entry at path belongs to an
+// existing token
+func (ts *TokenStore) validIndexEntry(ctx context.Context, path string) (bool, error) {
+	saltedAccessor := path[strings.LastIndex(path, "/")+1:]
+	aEntry, err := ts.lookupBySaltedAccessor(ctx, saltedAccessor, true)
+	if err != nil {
+		if _, ok := err.(*logical.StatusBadRequest); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	if aEntry.TokenID == "" {
+		return false, nil
+	}
+
+	te, err := ts.lookupTainted(ctx, aEntry.TokenID)
+	if err != nil {
+		return false, err
+	}
+	if te == nil {
+		return false, nil
+	}
+
+	indexPaths, err := ts.indexPaths(ctx, te)
+	if err != nil {
+		return false, err
+	}
+	return strutil.StrListContains(indexPaths, path), nil
+}
+
+// lookupByFilter returns the accessor entries of the valid tokens matching
+// the filter in the namespace of the request and the ones below it. The
+// indexes of the conditions are intersected, and the tokens are checked
+// against the filter in case the indexes are stale.
+func (ts *TokenStore) lookupByFilter(ctx context.Context, filter *tokenFilter) ([]accessorEntry, error) {
+	s, err := ts.Salt(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefixes []string
+	if filter.EntityID != "" {
+		prefixes = append(prefixes, entityIndexPrefix+s.SaltID(filter.EntityID)+"/")
+	}
+	if filter.Policy != "" {
+		prefixes = append(prefixes, policyIndexPrefix+s.SaltID(filter.Policy)+"/")
+	}
+	for key, value := range filter.Meta {
+		prefixes = append(prefixes, metaIndexPrefix+s.SaltID(key)+"/"+s.SaltID(value)+"/")
+	}
+
+	var candidates []string
+	for i, prefix := range prefixes {
+		saltedAccessors, err := ts.view.List(ctx, prefix)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to read token index: {{err}}", err)
+		}
+		if i == 0 {
+			candidates = saltedAccessors
+			continue
+		}
+
+		listed := make(map[string]struct{}, len(saltedAccessors))
+		for _, saltedAccessor := range saltedAccessors {
+			listed[saltedAccessor] = struct{}{}
+		}
+		var matched []string
+		for _, saltedAccessor := range candidates {
+			if _, ok := listed[saltedAccessor]; ok {
+				matched = append(matched, saltedAccessor)
+			}
+		}
+		candidates = matched
+	}
+
+	var ret []accessorEntry
+	for _, saltedAccessor := range candidates {
+		aEntry, err := ts.lookupBySaltedAccessor(ctx, saltedAccessor, false)
+		if err != nil {
+			// Index entries of revoked tokens may be left over until tidied
+			if _, ok := err.(*logical.StatusBadRequest); ok {
+				continue
+			}
+			return nil, err
+		}
+		if aEntry.TokenID == "" {
+			continue
+		}
+
+		// Only select the tokens of this namespace and the ones below it
+		if ts.checkNamespaceID(ctx, aEntry.NamespaceID) != nil {
+			continue
+		}
+
+		te, err := ts.Lookup(ctx, aEntry.TokenID)
+		if err != nil {
+			return nil, err
+		}
+		if te == nil || !filter.matches(te) {
+			continue
+		}
+
+		ret = append(ret, aEntry)
+	}
+
+	return ret, nil
+}
+
 // createAccessor is used to create an identifier for the token ID.
 // A storage index, mapping the accessor to the token ID is also created.
 func (ts *TokenStore) createAccessor(ctx context.Context, entry *TokenEntry) error {
@@ -781,8 +1084,9 @@ func (ts *TokenStore) createAccessor(ctx context.Context, entry *TokenEntry) err
 
 	path := accessorPrefix + saltID
 	aEntry := &accessorEntry{
-		TokenID:    entry.ID,
-		AccessorID: entry.Accessor,
+		TokenID:     entry.ID,
+		AccessorID:  entry.Accessor,
+		NamespaceID: entry.NamespaceID,
 	}
 	aEntryBytes, err := jsonutil.EncodeJSON(aEntry)
 	if err != nil {
@@ -800,6 +1104,25 @@ func (ts *TokenStore) createAccessor(ctx context.Context, entry *TokenEntry) err
 // a newly generated ID if not provided.
 func (ts *TokenStore) create(ctx context.Context, entry *TokenEntry) error {
 	defer metrics.MeasureSince([]string{"token", "create"}, time.Now())
+
+	// Tokens belong to the namespace they are created in unless told
+	// otherwise
+	if entry.NamespaceID == "" {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return err
+		}
+		entry.NamespaceID = ns.ID
+	}
+
+	if entry.Type == logical.TokenTypeBatch {
+		return ts.createBatchToken(ctx, entry)
+	}
+
+	if strings.HasPrefix(entry.ID, batchTokenPrefix) {
+		return fmt.Errorf("token IDs cannot begin with %q", batchTokenPrefix)
+	}
+
 	// Generate an ID if necessary
 	if entry.ID == "" {
 		entryUUID, err := uuid.GenerateUUID()
@@ -828,6 +1151,128 @@ func (ts *TokenStore) create(ctx context.Context, entry *TokenEntry) error {
 	return ts.storeCommon(ctx, entry, true)
 }
 
+// createBatchToken fills in the ID of a batch token entry by encrypting its
+// contents with the barrier. Nothing is persisted, and batch tokens have no
+// accessor.
+func (ts *TokenStore) createBatchToken(ctx context.Context, entry *TokenEntry) error {
+	if entry.ID != "" {
+		return fmt.Errorf("batch tokens cannot have a custom ID")
+	}
+	if entry.NumUses != 0 {
+		return fmt.Errorf("batch tokens cannot have a limited number of uses")
+	}
+	if entry.TTL == 0 {
+		return fmt.Errorf("batch tokens must have a TTL")
+	}
+	if ts.batchTokenEncryptor == nil {
+		return fmt.Errorf("batch tokens are not supported by this token store")
+	}
+
+	if entry.Parent != "" {
+		parent, err := ts.Lookup(ctx, entry.Parent)
+		if err != nil {
+			return errwrap.Wrapf("failed to lookup parent: {{err}}", err)
+		}
+		if parent == nil {
+			return fmt.Errorf("parent token not found")
+		}
+	}
+
+	entry.Policies = policyutil.SanitizePolicies(entry.Policies, policyutil.DoNotAddDefaultPolicy)
+
+	enc, err := json.Marshal(&batchTokenContents{
+		Parent:         entry.Parent,
+		Policies:       entry.Policies,
+		Path:           entry.Path,
+		Meta:           entry.Meta,
+		DisplayName:    entry.DisplayName,
+		CreationTime:   entry.CreationTime,
+		TTL:            entry.TTL,
+		ExplicitMaxTTL: entry.ExplicitMaxTTL,
+		Role:           entry.Role,
+		EntityID:       entry.EntityID,
+		BoundCIDRs:     entry.BoundCIDRs,
+		NamespaceID:    entry.NamespaceID,
+	})
+	if err != nil {
+		return errwrap.Wrapf("failed to encode batch token: {{err}}", err)
+	}
+
+	ciphertext, err := ts.batchTokenEncryptor.Encrypt(ctx, batchTokenEncryptionKey, enc)
+	if err != nil {
+		return errwrap.Wrapf("failed to encrypt batch token: {{err}}", err)
+	}
+
+	entry.ID = batchTokenPrefix + base64.RawURLEncoding.EncodeToString(ciphertext)
+	entry.Accessor = ""
+	return nil
+}
+
+// lookupBatchToken decrypts the entry of a batch token. Nil is returned if
+// the token cannot be decrypted, has expired, or if its parent is no longer
+// valid.
+func (ts *TokenStore) lookupBatchToken(ctx context.Context, id string) (*TokenEntry, error) {
+	if ts.batchTokenEncryptor == nil {
+		return nil, nil
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(id, batchTokenPrefix))
+	if err != nil {
+		return nil, nil
+	}
+
+	plaintext, err := ts.batchTokenEncryptor.Decrypt(ctx, batchTokenEncryptionKey, ciphertext)
+	if err != nil {
+		// Tokens that fail to decrypt were not issued by this cluster
+		return nil, nil
+	}
+
+	var contents batchTokenContents
+	if err := jsonutil.DecodeJSON(plaintext, &contents); err != nil {
+		return nil, errwrap.Wrapf("failed to decode batch token: {{err}}", err)
+	}
+
+	entry := &TokenEntry{
+		ID:             id,
+		Parent:         contents.Parent,
+		Policies:       contents.Policies,
+		Path:           contents.Path,
+		Meta:           contents.Meta,
+		DisplayName:    contents.DisplayName,
+		CreationTime:   contents.CreationTime,
+		TTL:            contents.TTL,
+		ExplicitMaxTTL: contents.ExplicitMaxTTL,
+		Role:           contents.Role,
+		EntityID:       contents.EntityID,
+		BoundCIDRs:     contents.BoundCIDRs,
+		NamespaceID:    contents.NamespaceID,
+		Type:           logical.TokenTypeBatch,
+	}
+
+	if time.Now().After(entry.expireTime()) {
+		return nil, nil
+	}
+
+	// Batch tokens are never revoked on their own, they become invalid once
+	// their parent is gone
+	if entry.Parent != "" {
+		parent, err := ts.Lookup(ctx, entry.Parent)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to lookup parent: {{err}}", err)
+		}
+		if parent == nil {
+			return nil, nil
+		}
+	}
+
+	return entry, nil
+}
+
+// expireTime returns the time at which a batch token expires
+func (te *TokenEntry) expireTime() time.Time {
+	return time.Unix(te.CreationTime, 0).Add(te.TTL)
+}
+
 // Store is used to store an updated token entry without writing the
 // secondary index.
 func (ts *TokenStore) store(ctx context.Context, entry *TokenEntry) error {
@@ -875,6 +1320,17 @@ func (ts *TokenStore) storeCommon(ctx context.Context, entry *TokenEntry, writeS
 				return errwrap.Wrapf("failed to persist entry: {{err}}", err)
 			}
 		}
+
+		// Write the entity, policy and metadata indexes
+		indexPaths, err := ts.indexPaths(ctx, entry)
+		if err != nil {
+			return err
+		}
+		for _, path := range indexPaths {
+			if err := ts.view.Put(ctx, &logical.StorageEntry{Key: path}); err != nil {
+				return errwrap.Wrapf("failed to persist index entry: {{err}}", err)
+			}
+		}
 	}
 
 	// Write the primary ID
@@ -971,6 +1427,10 @@ func (ts *TokenStore) Lookup(ctx context.Context, id string) (*TokenEntry, error
 		return nil, fmt.Errorf("cannot lookup blank token")
 	}
 
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		return ts.lookupBatchToken(ctx, id)
+	}
+
 	lock := locksutil.LockForKey(ts.tokenLocks, id)
 	lock.RLock()
 	defer lock.RUnlock()
@@ -990,6 +1450,10 @@ func (ts *TokenStore) lookupTainted(ctx context.Context, id string) (*TokenEntry
 		return nil, fmt.Errorf("cannot lookup blank token")
 	}
 
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		return ts.lookupBatchToken(ctx, id)
+	}
+
 	lock := locksutil.LockForKey(ts.tokenLocks, id)
 	lock.RLock()
 	defer lock.RUnlock()
@@ -1214,6 +1678,19 @@ func (ts *TokenStore) revokeSalted(ctx context.Context, saltedID string, skipOrp
 		}
 	}
 
+	// Clear the entity, policy and metadata indexes. This is done before
+	// clearing the accessor index, which is needed to find leftover entries
+	// when tidying.
+	indexPaths, err := ts.indexPaths(ctx, entry)
+	if err != nil {
+		return err
+	}
+	for _, path := range indexPaths {
+		if err = ts.view.Delete(ctx, path); err != nil {
+			return errwrap.Wrapf("failed to delete index entry: {{err}}", err)
+		}
+	}
+
 	// Clear the accessor index if any
 	if entry.Accessor != "" {
 		accessorSaltedID, err := ts.SaltID(ctx, entry.Accessor)
@@ -1490,10 +1967,24 @@ func (ts *TokenStore) handleTidy(ctx context.Context, req *logical.Request, data
 		}
 	}
 
+	// Collect the entity, policy and metadata index entries, so that the
+	// missing ones can be rebuilt and the invalid ones deleted
+	existingIndexes := make(map[string]bool)
+	indexKeys, err := logical.CollectKeys(ctx, ts.view.SubView(indexPrefix))
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to fetch token index entries: {{err}}", err)
+	}
+	for _, key := range indexKeys {
+		existingIndexes[indexPrefix+key] = true
+	}
+	validIndexes := make(map[string]bool, len(existingIndexes))
+
 	var countAccessorList,
 		deletedCountAccessorEmptyToken,
 		deletedCountAccessorInvalidToken,
-		deletedCountInvalidTokenInAccessor int64
+		deletedCountInvalidTokenInAccessor,
+		createdCountIndex,
+		deletedCountIndex int64
 
 	// For each of the accessor, see if the token ID associated with it is
 	// a valid one. If not, delete the leases associated with that token
@@ -1579,7 +2070,51 @@ func (ts *TokenStore) handleTidy(ctx context.Context, req *logical.Request, data
 				continue
 			}
 			deletedCountAccessorInvalidToken++
+			continue
+		}
+
+		// Rebuild the missing index entries of the token
+		indexPaths, err := ts.indexPaths(ctx, te)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, errwrap.Wrapf("failed to compute token index entries: {{err}}", err))
+			continue
+		}
+		for _, path := range indexPaths {
+			validIndexes[path] = true
+			if existingIndexes[path] {
+				continue
+			}
+			if err := ts.view.Put(ctx, &logical.StorageEntry{Key: path}); err != nil {
+				tidyErrors = multierror.Append(tidyErrors, errwrap.Wrapf("failed to persist token index entry: {{err}}", err))
+				continue
+			}
+			createdCountIndex++
+		}
+	}
+
+	// Delete the index entries of tokens that no longer exist. Entries of
+	// tokens created since the accessors were listed are checked again
+	// before deletion.
+	for path := range existingIndexes {
+		if validIndexes[path] {
+			continue
+		}
+
+		valid, err := ts.validIndexEntry(ctx, path)
+		if err != nil {
+			tidyErrors = multierror.Append(tidyErrors, errwrap.Wrapf("failed to check token index entry: {{err}}", err))
+			continue
 		}
+		if valid {
+			continue
+		}
+
+		ts.logger.Debug("deleting invalid token index entry", "index", path)
+		if err := ts.view.Delete(ctx, path); err != nil {
+			tidyErrors = multierror.Append(tidyErrors, errwrap.Wrapf("failed to delete token index entry: {{err}}", err))
+			continue
+		}
+		deletedCountIndex++
 	}
 
 	ts.logger.Info("number of entries scanned in parent prefix", "count", countParentEntries)
@@ -1590,6 +2125,8 @@ func (ts *TokenStore) handleTidy(ctx context.Context, req *logical.Request, data
 	ts.logger.Info("number of deleted accessors which had empty tokens", "count", deletedCountAccessorEmptyToken)
 	ts.logger.Info("number of revoked tokens which were invalid but present in accessors", "count", deletedCountInvalidTokenInAccessor)
 	ts.logger.Info("number of deleted accessors which had invalid tokens", "count", deletedCountAccessorInvalidToken)
+	ts.logger.Info("number of token index entries created", "count", createdCountIndex)
+	ts.logger.Info("number of invalid token index entries deleted", "count", deletedCountIndex)
 
 	return nil, tidyErrors.ErrorOrNil()
 }
@@ -1675,6 +2212,10 @@ func (ts *TokenStore) handleUpdateRevokeAccessor(ctx context.Context, req *logic
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
 
+	if err := ts.checkTokenNamespace(ctx, te); err != nil {
+		return nil, err
+	}
+
 	leaseID, err := ts.expiration.CreateOrFetchRevocationLeaseByToken(te)
 	if err != nil {
 		return nil, err
@@ -1694,6 +2235,57 @@ func (ts *TokenStore) handleUpdateRevokeAccessor(ctx context.Context, req *logic
 	return nil, nil
 }
 
+// handleRevokeAccessors handles the auth/token/accessors/revoke path for
+// revoking the tokens matching a filter, along with their child tokens
+func (ts *TokenStore) handleRevokeAccessors(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	filter := parseTokenFilter(req, data)
+	if filter.empty() {
+		return logical.ErrorResponse("at least one of entity_id, policy or meta must be set"), logical.ErrInvalidRequest
+	}
+
+	aEntries, err := ts.lookupByFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var revokeErrors *multierror.Error
+	revoked := make([]string, 0, len(aEntries))
+	for _, aEntry := range aEntries {
+		// Tokens may have been revoked along with a parent token matching the
+		// filter
+		te, err := ts.Lookup(ctx, aEntry.TokenID)
+		if err != nil {
+			revokeErrors = multierror.Append(revokeErrors, err)
+			continue
+		}
+		if te == nil {
+			continue
+		}
+
+		leaseID, err := ts.expiration.CreateOrFetchRevocationLeaseByToken(te)
+		if err == nil {
+			err = ts.expiration.Revoke(leaseID)
+		}
+		if err != nil {
+			revokeErrors = multierror.Append(revokeErrors, errwrap.Wrapf(fmt.Sprintf("failed to revoke token with accessor %q: {{err}}", aEntry.AccessorID), err))
+			continue
+		}
+
+		ts.logger.Info("revoked token matching filter", "accessor", aEntry.AccessorID)
+		revoked = append(revoked, aEntry.AccessorID)
+	}
+
+	if err := revokeErrors.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"accessors": revoked,
+		},
+	}, nil
+}
+
 // handleCreate handles the auth/token/create path for creation of new orphan
 // tokens
 func (ts *TokenStore) handleCreateOrphan(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -1724,6 +2316,21 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 			logical.ErrInvalidRequest
 	}
 
+	// Batch tokens cannot be revoked, so they cannot be the root of a
+	// revocation tree either
+	if parent.Type == logical.TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot create more tokens"),
+			logical.ErrInvalidRequest
+	}
+
+	// Tokens created in a namespace below the parent's are orphans, since
+	// the parent's policies have no meaning there
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	crossNamespace := tokenNamespaceID(parent) != ns.ID
+
 	// Check if the client token has sudo/root privileges for the requested path
 	isSudo := ts.System().SudoPrivilege(ctx, req.MountPoint+req.Path, req.ClientToken)
 
@@ -1741,6 +2348,7 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 		DisplayName     string `mapstructure:"display_name"`
 		NumUses         int    `mapstructure:"num_uses"`
 		Period          string
+		Type            string
 	}
 	if err := mapstructure.WeakDecode(req.Data, &data); err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -1753,19 +2361,36 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 			logical.ErrInvalidRequest
 	}
 
+	// Determine the token type; roles may force a type or provide a default
+	requestedType, err := logical.ParseTokenType(data.Type)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	configuredType := logical.TokenTypeDefaultService
+	if role != nil && role.TokenType != logical.TokenTypeDefault {
+		configuredType = role.TokenType
+	}
+	tokenType, err := configuredType.Resolve(requestedType)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
 	// Setup the token entry
 	te := TokenEntry{
 		Parent: req.ClientToken,
 
 		// The mount point is always the same since we have only one token
 		// store; using req.MountPoint causes trouble in tests since they don't
-		// have an official mount
-		Path: fmt.Sprintf("auth/token/%s", req.Path),
+		// have an official mount. The namespace path is kept so that revoking
+		// by the prefix of a namespace revokes its tokens.
+		Path: fmt.Sprintf("%sauth/token/%s", ns.Path, req.Path),
 
 		Meta:         data.Metadata,
 		DisplayName:  "token",
 		NumUses:      data.NumUses,
 		CreationTime: time.Now().Unix(),
+		Type:         tokenType,
+		NamespaceID:  ns.ID,
 	}
 
 	renewable := true
@@ -1773,6 +2398,22 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 		renewable = *data.Renewable
 	}
 
+	if te.Type == logical.TokenTypeBatch {
+		switch {
+		case data.ID != "":
+			return logical.ErrorResponse("batch tokens cannot have a custom ID"), logical.ErrInvalidRequest
+		case data.NumUses != 0:
+			return logical.ErrorResponse("batch tokens cannot have a limited number of uses"), logical.ErrInvalidRequest
+		case data.Period != "" && data.Period != "0":
+			return logical.ErrorResponse("batch tokens cannot be periodic"), logical.ErrInvalidRequest
+		case role != nil && role.Period != 0:
+			return logical.ErrorResponse("batch tokens cannot be created against a periodic role"), logical.ErrInvalidRequest
+		}
+
+		// Batch tokens can never be renewed
+		renewable = false
+	}
+
 	// If the role is not nil, we add the role name as part of the token's
 	// path. This makes it much easier to later revoke tokens that were issued
 	// by a role (using revoke-prefix). Users can further specify a PathSuffix
@@ -1879,6 +2520,11 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 
 		data.Policies = finalPolicies
 
+	// Policies of the parent don't carry over to another namespace, so the
+	// requested ones are used as-is
+	case crossNamespace:
+		addDefault = !data.NoDefaultPolicy
+
 	// No policies specified, inherit parent
 	case len(data.Policies) == 0:
 		// Only inherit "default" if the parent already has it, so don't touch addDefault here
@@ -1930,6 +2576,11 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 		return logical.ErrorResponse("root tokens may not be created without parent token being root"), logical.ErrInvalidRequest
 	}
 
+	// The root policy only exists in the root namespace
+	if strutil.StrListContains(te.Policies, "root") && ns.ID != namespace.RootNamespaceID {
+		return logical.ErrorResponse("root tokens may not be created in a namespace"), logical.ErrInvalidRequest
+	}
+
 	//
 	// NOTE: Do not modify policies below this line. We need the checks above
 	// to be the last checks as they must look at the final policy set.
@@ -1961,6 +2612,10 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 		}
 	}
 
+	if crossNamespace {
+		te.Parent = ""
+	}
+
 	// At this point, it is clear whether the token is going to be an orphan or
 	// not. If the token is not going to be an orphan, inherit the parent's
 	// entity identifier into the child token.
@@ -2075,10 +2730,32 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 		if parent.TTL != 0 {
 			return logical.ErrorResponse("expiring root tokens cannot create non-expiring root tokens"), logical.ErrInvalidRequest
 		}
+		if te.Type == logical.TokenTypeBatch {
+			return logical.ErrorResponse("batch tokens must have a TTL"), logical.ErrInvalidRequest
+		}
 		renewable = false
 		te.BoundCIDRs = nil
 	}
 
+	// A batch token cannot outlive its parent, as it becomes invalid once the
+	// parent's lease expires
+	if te.Type == logical.TokenTypeBatch && te.Parent != "" {
+		parentLease, err := ts.expiration.FetchLeaseTimesByToken(parent.Path, parent.ID)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to fetch parent lease times: {{err}}", err)
+		}
+		if parentLease != nil && !parentLease.ExpireTime.IsZero() {
+			remaining := parentLease.ExpireTime.Sub(time.Unix(te.CreationTime, 0))
+			if remaining <= 0 {
+				return logical.ErrorResponse("parent token has expired"), logical.ErrInvalidRequest
+			}
+			if remaining < te.TTL {
+				te.TTL = remaining
+				resp.AddWarning(fmt.Sprintf("TTL of batch token capped to the remaining TTL of its parent of %d seconds", int64(remaining.Seconds())))
+			}
+		}
+	}
+
 	// Create the token
 	if err := ts.create(ctx, &te); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
@@ -2100,11 +2777,12 @@ func (ts *TokenStore) handleCreateCommon(ctx context.Context, req *logical.Reque
 		Period:         periodToUse,
 		ExplicitMaxTTL: explicitMaxTTLToUse,
 		CreationPath:   te.Path,
+		TokenType:      te.Type,
 	}
 
 	if ts.policyLookupFunc != nil {
 		for _, p := range te.Policies {
-			policy, err := ts.policyLookupFunc(p)
+			policy, err := ts.policyLookupFunc(ctx, p)
 			if err != nil {
 				return logical.ErrorResponse(fmt.Sprintf("could not look up policy %s", p)), nil
 			}
@@ -2130,6 +2808,10 @@ func (ts *TokenStore) handleRevokeSelf(ctx context.Context, req *logical.Request
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
 
+	if te.Type == logical.TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot be revoked"), logical.ErrInvalidRequest
+	}
+
 	leaseID, err := ts.expiration.CreateOrFetchRevocationLeaseByToken(te)
 	if err != nil {
 		return nil, err
@@ -2166,6 +2848,14 @@ func (ts *TokenStore) handleRevokeTree(ctx context.Context, req *logical.Request
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
 
+	if err := ts.checkTokenNamespace(ctx, te); err != nil {
+		return nil, err
+	}
+
+	if te.Type == logical.TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot be revoked"), logical.ErrInvalidRequest
+	}
+
 	leaseID, err := ts.expiration.CreateOrFetchRevocationLeaseByToken(te)
 	if err != nil {
 		return nil, err
@@ -2216,6 +2906,20 @@ func (ts *TokenStore) handleRevokeOrphan(ctx context.Context, req *logical.Reque
 			logical.ErrInvalidRequest
 	}
 
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		return logical.ErrorResponse("batch tokens cannot be revoked"), logical.ErrInvalidRequest
+	}
+
+	te, err := ts.Lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if te != nil {
+		if err := ts.checkTokenNamespace(ctx, te); err != nil {
+			return nil, err
+		}
+	}
+
 	// Revoke and orphan
 	if err := ts.revokeOrphan(ctx, id); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
@@ -2253,24 +2957,41 @@ func (ts *TokenStore) handleLookup(ctx context.Context, req *logical.Request, da
 		return logical.ErrorResponse("missing token ID"), logical.ErrInvalidRequest
 	}
 
-	lock := locksutil.LockForKey(ts.tokenLocks, id)
-	lock.RLock()
-	defer lock.RUnlock()
+	var out *TokenEntry
+	if strings.HasPrefix(id, batchTokenPrefix) {
+		var err error
+		out, err = ts.lookupBatchToken(ctx, id)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	} else {
+		lock := locksutil.LockForKey(ts.tokenLocks, id)
+		lock.RLock()
+		defer lock.RUnlock()
 
-	// Lookup the token
-	saltedID, err := ts.SaltID(ctx, id)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-	}
-	out, err := ts.lookupSalted(ctx, saltedID, true)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		// Lookup the token
+		saltedID, err := ts.SaltID(ctx, id)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		out, err = ts.lookupSalted(ctx, saltedID, true)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
 	}
 
 	if out == nil {
 		return logical.ErrorResponse("bad token"), logical.ErrPermissionDenied
 	}
 
+	// A client can always look up its own token, even from a namespace
+	// below the token's
+	if id != req.ClientToken {
+		if err := ts.checkTokenNamespace(ctx, out); err != nil {
+			return nil, err
+		}
+	}
+
 	// Generate a response. We purposely omit the parent reference otherwise
 	// you could escalate your privileges.
 	resp := &logical.Response{
@@ -2289,9 +3010,14 @@ func (ts *TokenStore) handleLookup(ctx context.Context, req *logical.Request, da
 			"ttl":              int64(0),
 			"explicit_max_ttl": int64(out.ExplicitMaxTTL.Seconds()),
 			"entity_id":        out.EntityID,
+			"type":             string(logical.TokenTypeService),
 		},
 	}
 
+	if out.Type != logical.TokenTypeDefault {
+		resp.Data["type"] = string(out.Type)
+	}
+
 	if out.Parent == "" {
 		resp.Data["orphan"] = true
 	}
@@ -2308,6 +3034,15 @@ func (ts *TokenStore) handleLookup(ctx context.Context, req *logical.Request, da
 		resp.Data["bound_cidrs"] = out.BoundCIDRs
 	}
 
+	// Batch tokens have no lease; their expiration is part of the token
+	if out.Type == logical.TokenTypeBatch {
+		expireTime := out.expireTime()
+		resp.Data["expire_time"] = expireTime
+		resp.Data["ttl"] = int64(time.Until(expireTime).Round(time.Second).Seconds())
+		resp.Data["renewable"] = false
+		resp.Data["issue_time"] = time.Unix(out.CreationTime, 0)
+	}
+
 	// Fetch the last renewal time
 	leaseTimes, err := ts.expiration.FetchLeaseTimesByToken(out.Path, out.ID)
 	if err != nil {
@@ -2332,8 +3067,8 @@ func (ts *TokenStore) handleLookup(ctx context.Context, req *logical.Request, da
 		if err != nil {
 			return nil, err
 		}
-		if len(identityPolicies) != 0 {
-			resp.Data["identity_policies"] = identityPolicies
+		if nsPolicies := identityPolicies[tokenNamespaceID(out)]; len(nsPolicies) != 0 {
+			resp.Data["identity_policies"] = nsPolicies
 		}
 	}
 
@@ -2377,6 +3112,16 @@ func (ts *TokenStore) handleRenew(ctx context.Context, req *logical.Request, dat
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
 
+	if id != req.ClientToken {
+		if err := ts.checkTokenNamespace(ctx, te); err != nil {
+			return nil, err
+		}
+	}
+
+	if te.Type == logical.TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot be renewed"), logical.ErrInvalidRequest
+	}
+
 	// Renew the token and its children
 	resp, err := ts.expiration.RenewToken(req, te.Path, te.ID, increment)
 
@@ -2414,7 +3159,12 @@ func (ts *TokenStore) authRenew(ctx context.Context, req *logical.Request, d *fr
 		return &logical.Response{Auth: req.Auth}, nil
 	}
 
-	role, err := ts.tokenStoreRole(ctx, te.Role)
+	// The role lives in the namespace the token was created in
+	tokenNS := ts.core.namespaceByID(tokenNamespaceID(te))
+	if tokenNS == nil {
+		return nil, fmt.Errorf("namespace of the token could not be found, not renewing")
+	}
+	role, err := ts.tokenStoreRole(namespace.ContextWithNamespace(ctx, tokenNS), te.Role)
 	if err != nil {
 		return nil, errwrap.Wrapf(fmt.Sprintf("error looking up role %q: {{err}}", te.Role), err)
 	}
@@ -2427,8 +3177,77 @@ func (ts *TokenStore) authRenew(ctx context.Context, req *logical.Request, d *fr
 	return &logical.Response{Auth: req.Auth}, nil
 }
 
+// rolesPrefixForNamespace returns the storage prefix of the token roles of
+// the namespace in the context. Roles of the root namespace stay at the top
+// level for compatibility.
+func rolesPrefixForNamespace(ctx context.Context) (string, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if ns.ID == namespace.RootNamespaceID {
+		return rolesPrefix, nil
+	}
+	return namespaceBarrierPrefix + ns.ID + "/" + rolesPrefix, nil
+}
+
+// deleteNamespaceRoles removes the token roles of the namespace in the
+// context. It is used when the namespace is deleted.
+func (ts *TokenStore) deleteNamespaceRoles(ctx context.Context) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if ns.ID == namespace.RootNamespaceID {
+		return fmt.Errorf("cannot delete the roles of the root namespace")
+	}
+	prefix, err := rolesPrefixForNamespace(ctx)
+	if err != nil {
+		return err
+	}
+	return logical.ClearView(ctx, ts.view.SubView(prefix))
+}
+
+// tokenNamespaceID returns the ID of the namespace of the given token
+func tokenNamespaceID(te *TokenEntry) string {
+	if te.NamespaceID == "" {
+		return namespace.RootNamespaceID
+	}
+	return te.NamespaceID
+}
+
+// checkTokenNamespace returns a permission denied error unless the given
+// token belongs to the namespace in the context or one below it
+func (ts *TokenStore) checkTokenNamespace(ctx context.Context, te *TokenEntry) error {
+	return ts.checkNamespaceID(ctx, tokenNamespaceID(te))
+}
+
+// checkNamespaceID returns a permission denied error unless the namespace
+// with the given ID is the namespace in the context or one below it
+func (ts *TokenStore) checkNamespaceID(ctx context.Context, nsID string) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if ns.ID == namespace.RootNamespaceID {
+		return nil
+	}
+	if nsID == "" {
+		nsID = namespace.RootNamespaceID
+	}
+	tokenNS := ts.core.namespaceByID(nsID)
+	if tokenNS == nil || !ns.Contains(tokenNS) {
+		return logical.ErrPermissionDenied
+	}
+	return nil
+}
+
 func (ts *TokenStore) tokenStoreRole(ctx context.Context, name string) (*tsRoleEntry, error) {
-	entry, err := ts.view.Get(ctx, fmt.Sprintf("%s%s", rolesPrefix, name))
+	prefix, err := rolesPrefixForNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := ts.view.Get(ctx, fmt.Sprintf("%s%s", prefix, name))
 	if err != nil {
 		return nil, err
 	}
@@ -2445,21 +3264,29 @@ func (ts *TokenStore) tokenStoreRole(ctx context.Context, name string) (*tsRoleE
 }
 
 func (ts *TokenStore) tokenStoreRoleList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	entries, err := ts.view.List(ctx, rolesPrefix)
+	prefix, err := rolesPrefixForNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ts.view.List(ctx, prefix)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := make([]string, len(entries))
 	for i, entry := range entries {
-		ret[i] = strings.TrimPrefix(entry, rolesPrefix)
+		ret[i] = strings.TrimPrefix(entry, prefix)
 	}
 
 	return logical.ListResponse(ret), nil
 }
 
 func (ts *TokenStore) tokenStoreRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	err := ts.view.Delete(ctx, fmt.Sprintf("%s%s", rolesPrefix, data.Get("role_name").(string)))
+	prefix, err := rolesPrefixForNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = ts.view.Delete(ctx, fmt.Sprintf("%s%s", prefix, data.Get("role_name").(string)))
 	if err != nil {
 		return nil, err
 	}
@@ -2486,11 +3313,17 @@ func (ts *TokenStore) tokenStoreRoleRead(ctx context.Context, req *logical.Reque
 			"orphan":              role.Orphan,
 			"path_suffix":         role.PathSuffix,
 			"renewable":           role.Renewable,
+			"token_type":          string(logical.TokenTypeDefaultService),
 		},
 	}
 
+	if role.TokenType != logical.TokenTypeDefault {
+		resp.Data["token_type"] = string(role.TokenType)
+	}
+
 	if len(role.BoundCIDRs) > 0 {
 		resp.Data["bound_cidrs"] = role.BoundCIDRs
+		resp.Data["token_bound_cidrs"] = role.BoundCIDRs
 	}
 
 	return resp, nil
@@ -2552,8 +3385,13 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(ctx context.Context, req *logic
 		entry.Renewable = data.Get("renewable").(bool)
 	}
 
-	boundCIDRsRaw, ok := data.GetOk("bound_cidrs")
-	if ok {
+	if tokenBoundCIDRsRaw, ok := data.GetOk("token_bound_cidrs"); ok {
+		parsedCIDRs, err := parseutil.ParseAddrs(tokenBoundCIDRsRaw)
+		if err != nil {
+			return logical.ErrorResponse(errwrap.Wrapf("invalid value when parsing token_bound_cidrs: {{err}}", err).Error()), nil
+		}
+		entry.BoundCIDRs = parsedCIDRs
+	} else if boundCIDRsRaw, ok := data.GetOk("bound_cidrs"); ok {
 		boundCIDRs := boundCIDRsRaw.([]string)
 		if len(boundCIDRs) > 0 {
 			var parsedCIDRs []*sockaddr.SockAddrMarshaler
@@ -2568,6 +3406,24 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(ctx context.Context, req *logic
 		}
 	}
 
+	tokenTypeRaw, ok := data.GetOk("token_type")
+	if !ok && req.Operation == logical.CreateOperation {
+		tokenTypeRaw = data.Get("token_type")
+	}
+	if tokenTypeRaw != nil {
+		tokenType, err := logical.ParseTokenType(tokenTypeRaw.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if tokenType == logical.TokenTypeDefault {
+			tokenType = logical.TokenTypeDefaultService
+		}
+		entry.TokenType = tokenType
+	}
+	if entry.TokenType == logical.TokenTypeBatch && entry.Period != 0 {
+		return logical.ErrorResponse("roles that issue batch tokens cannot be periodic"), nil
+	}
+
 	var resp *logical.Response
 
 	explicitMaxTTLInt, ok := data.GetOk("explicit_max_ttl")
@@ -2624,7 +3480,11 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(ctx context.Context, req *logic
 	}
 
 	// Store it
-	jsonEntry, err := logical.StorageEntryJSON(fmt.Sprintf("%s%s", rolesPrefix, name), entry)
+	prefix, err := rolesPrefixForNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jsonEntry, err := logical.StorageEntryJSON(fmt.Sprintf("%s%s", prefix, name), entry)
 	if err != nil {
 		return nil, err
 	}
@@ -2645,6 +3505,9 @@ This endpoint performs cleanup tasks that can be run to clean up token and
 lease entries after certain error conditions. Usually running this is not
 necessary, and is only required if upgrade notes or support personnel suggest
 it.
+
+It also rebuilds the indexes of tokens by entity, policy and metadata, which
+is needed for tokens created before the indexes were introduced.
 `
 	tokenBackendHelp = `The token credential backend is always enabled and builtin to Vault.
 Client tokens are used to identify a client and to allow Vault to associate policies and ACLs
@@ -2691,10 +3554,33 @@ no effect on the token being renewed.`
 	tokenRenewableHelp = `Tokens created via this role will be
 renewable or not according to this value.
 Defaults to "true".`
+	tokenTypeHelp = `The type of token to generate: "service",
+"batch", "default-service" or "default-batch".
+The "default-" types let the creation call
+choose the type with its "type" parameter.
+Defaults to "default-service".`
 	tokenListAccessorsHelp = `List token accessors, which can then be
 be used to iterate and discover their properties
 or revoke them. Because this can be used to
 cause a denial of service, this endpoint
 requires 'sudo' capability in addition to
-'list'.`
+'list'.
+
+The accessors can be filtered by the "entity_id",
+"policy" and "meta.<key>" parameters, in which
+case only the tokens matching all of them are
+listed.`
+	tokenRevokeAccessorsHelp = `
+This endpoint revokes the tokens matching the given filters, and all of their
+child tokens.
+`
+	tokenRevokeAccessorsDesc = `
+This endpoint revokes the tokens of an entity, with a policy, or with metadata
+key/value pairs, and all of their child tokens. Tokens must match all the given
+filters, and at least one filter is required. The accessors of the revoked
+tokens are returned.
+
+Like the listing of accessors, this endpoint requires 'sudo' capability.
+Batch tokens are not stored, and cannot be selected by filters.
+`
 )
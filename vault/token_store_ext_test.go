@@ -338,6 +338,56 @@ func TestTokenStore_CIDRBlocks(t *testing.T) {
 	if !strings.Contains(err.Error(), "permission denied") {
 		t.Fatalf("unexpected error: %v", err)
 	}
+
+	// token_bound_cidrs, not containing localhost (should fail)
+	client.SetToken(rootToken)
+	_, err = client.Logical().Write("auth/token/roles/testrole", map[string]interface{}{
+		"token_bound_cidrs": []string{"1.2.3.4/8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err = client.Logical().Read("auth/token/roles/testrole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cidrs := secret.Data["token_bound_cidrs"].([]interface{}); len(cidrs) != 1 || cidrs[0].(string) != "1.2.3.4/8" {
+		t.Fatalf("bad: token_bound_cidrs: %#v", secret.Data["token_bound_cidrs"])
+	}
+	secret, err = client.Auth().Token().CreateWithRole(&api.TokenCreateRequest{
+		Policies: []string{"default"},
+	}, "testrole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(secret.Auth.ClientToken)
+	_, err = client.Auth().Token().LookupSelf()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Clearing token_bound_cidrs unbinds new tokens
+	client.SetToken(rootToken)
+	_, err = client.Logical().Write("auth/token/roles/testrole", map[string]interface{}{
+		"token_bound_cidrs": []string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err = client.Auth().Token().CreateWithRole(&api.TokenCreateRequest{
+		Policies: []string{"default"},
+	}, "testrole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(secret.Auth.ClientToken)
+	_, err = client.Auth().Token().LookupSelf()
+	if err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestTokenStore_RevocationOnStartup(t *testing.T) {
@@ -16,6 +16,7 @@ import (
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -496,6 +497,167 @@ func TestTokenStore_HandleRequest_ListAccessors(t *testing.T) {
 	}
 }
 
+func TestTokenStore_HandleRequest_ListAccessors_filtered(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+
+	entries := []*TokenEntry{
+		&TokenEntry{Path: "test", Policies: []string{"dev"}, EntityID: "entity1", Meta: map[string]string{"team": "a", "env": "prod"}, TTL: time.Hour},
+		&TokenEntry{Path: "test", Policies: []string{"dev", "ops"}, EntityID: "entity1", Meta: map[string]string{"team": "b", "env": "prod"}, TTL: time.Hour},
+		&TokenEntry{Path: "test", Policies: []string{"ops"}, EntityID: "entity2", Meta: map[string]string{"team": "a/b"}, TTL: time.Hour},
+	}
+	for _, te := range entries {
+		testMakeTokenDirectly(t, ts, te)
+	}
+
+	cases := []struct {
+		data     map[string]interface{}
+		expected []*TokenEntry
+	}{
+		{map[string]interface{}{"entity_id": "entity1"}, entries[:2]},
+		{map[string]interface{}{"policy": "ops"}, entries[1:]},
+		{map[string]interface{}{"policy": "ops", "entity_id": "entity1"}, entries[1:2]},
+		{map[string]interface{}{"meta.env": "prod"}, entries[:2]},
+		{map[string]interface{}{"meta": map[string]interface{}{"team": "a/b"}}, entries[2:]},
+		{map[string]interface{}{"meta.env": "prod", "meta.team": "a"}, entries[:1]},
+		{map[string]interface{}{"policy": "unknown"}, nil},
+	}
+	for i, tc := range cases {
+		req := &logical.Request{
+			Operation:   logical.ListOperation,
+			Path:        "accessors/",
+			ClientToken: root,
+			Data:        tc.data,
+		}
+		resp, err := ts.HandleRequest(namespace.RootContext(nil), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%d: err: %v\nresp: %#v", i, err, resp)
+		}
+
+		keys, _ := resp.Data["keys"].([]string)
+		var expected []string
+		for _, te := range tc.expected {
+			expected = append(expected, te.Accessor)
+		}
+		sort.Strings(keys)
+		sort.Strings(expected)
+		if len(keys) != len(expected) || (len(keys) > 0 && !reflect.DeepEqual(keys, expected)) {
+			t.Fatalf("%d: bad: expected %v, got %v", i, expected, keys)
+		}
+	}
+}
+
+func TestTokenStore_HandleRequest_RevokeAccessors(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+
+	entries := []*TokenEntry{
+		&TokenEntry{Path: "test", Policies: []string{"dev"}, EntityID: "entity1", TTL: time.Hour},
+		&TokenEntry{Path: "test", Policies: []string{"ops"}, EntityID: "entity1", TTL: time.Hour},
+		&TokenEntry{Path: "test", Policies: []string{"dev"}, EntityID: "entity2", TTL: time.Hour},
+	}
+	for _, te := range entries {
+		testMakeTokenDirectly(t, ts, te)
+	}
+
+	req := &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "accessors/revoke",
+		ClientToken: root,
+	}
+	resp, err := ts.HandleRequest(namespace.RootContext(nil), req)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error without filters, got err: %v resp: %#v", err, resp)
+	}
+
+	req.Data = map[string]interface{}{
+		"entity_id": "entity1",
+	}
+	resp, err = ts.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+
+	revoked := resp.Data["accessors"].([]string)
+	sort.Strings(revoked)
+	expected := []string{entries[0].Accessor, entries[1].Accessor}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(revoked, expected) {
+		t.Fatalf("bad: expected %v, got %v", expected, revoked)
+	}
+
+	for i, te := range entries {
+		out, err := ts.Lookup(namespace.RootContext(nil), te.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (out == nil) != (i < 2) {
+			t.Fatalf("%d: bad: %#v", i, out)
+		}
+	}
+
+	// The index entries of the revoked tokens are deleted
+	keys, err := logical.CollectKeys(namespace.RootContext(nil), ts.view.SubView(entityIndexPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestTokenStore_HandleTidy_indexes(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+	ctx := namespace.RootContext(nil)
+
+	te := &TokenEntry{Path: "test", Policies: []string{"dev"}, EntityID: "entity1", Meta: map[string]string{"team": "a"}, TTL: time.Hour}
+	testMakeTokenDirectly(t, ts, te)
+
+	indexPaths, err := ts.indexPaths(ctx, te)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexPaths) != 3 {
+		t.Fatalf("bad: %v", indexPaths)
+	}
+
+	expected, err := logical.CollectKeys(ctx, ts.view.SubView(indexPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete an index entry, as for tokens created before the indexes, and
+	// add a stale one
+	if err := ts.view.Delete(ctx, indexPaths[0]); err != nil {
+		t.Fatal(err)
+	}
+	stalePath := policyIndexPrefix + "stale/" + "accessor"
+	if err := ts.view.Put(ctx, &logical.StorageEntry{Key: stalePath}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := ts.HandleRequest(ctx, &logical.Request{
+		Path:        "tidy",
+		Operation:   logical.UpdateOperation,
+		ClientToken: root,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+
+	keys, err := logical.CollectKeys(ctx, ts.view.SubView(indexPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(keys)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("bad: expected %v, got %v", expected, keys)
+	}
+}
+
 func TestTokenStore_HandleRequest_RevokeAccessor(t *testing.T) {
 	exp := mockExpiration(t)
 	ts := exp.tokenStore
@@ -1143,6 +1305,8 @@ func TestTokenStore_HandleRequest_CreateToken_DisplayName(t *testing.T) {
 		Path:        "auth/token/create",
 		DisplayName: "token-foo-bar-baz",
 		TTL:         0,
+		Type:        logical.TokenTypeService,
+		NamespaceID: namespace.RootNamespaceID,
 	}
 	out, err := ts.Lookup(context.Background(), resp.Auth.ClientToken)
 	if err != nil {
@@ -1176,6 +1340,8 @@ func TestTokenStore_HandleRequest_CreateToken_NumUses(t *testing.T) {
 		DisplayName: "token",
 		NumUses:     1,
 		TTL:         0,
+		Type:        logical.TokenTypeService,
+		NamespaceID: namespace.RootNamespaceID,
 	}
 	out, err := ts.Lookup(context.Background(), resp.Auth.ClientToken)
 	if err != nil {
@@ -1242,6 +1408,8 @@ func TestTokenStore_HandleRequest_CreateToken_NoPolicy(t *testing.T) {
 		Path:        "auth/token/create",
 		DisplayName: "token",
 		TTL:         0,
+		Type:        logical.TokenTypeService,
+		NamespaceID: namespace.RootNamespaceID,
 	}
 	out, err := ts.Lookup(context.Background(), resp.Auth.ClientToken)
 	if err != nil {
@@ -1786,6 +1954,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"explicit_max_ttl": int64(0),
 		"expire_time":      nil,
 		"entity_id":        "",
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1826,6 +1995,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
 		"entity_id":        "",
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1877,6 +2047,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
 		"entity_id":        "",
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1960,6 +2131,7 @@ func TestTokenStore_HandleRequest_LookupSelf(t *testing.T) {
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
 		"entity_id":        "",
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -2132,6 +2304,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           true,
+		"token_type":          "default-service",
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -2177,6 +2350,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           false,
+		"token_type":          "default-service",
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -2214,6 +2388,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"period":              int64(0),
 		"renewable":           false,
+		"token_type":          "default-service",
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -4073,3 +4248,203 @@ func TestTokenStore_TidyLeaseRevocation(t *testing.T) {
 		t.Fatal("found leases")
 	}
 }
+
+func TestTokenStore_BatchTokens(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+
+	testMakeTokenViaCore(t, c, root, "parent", "1h", []string{"root"})
+
+	storedBefore, err := ts.view.List(context.Background(), lookupPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = "parent"
+	req.Data = map[string]interface{}{
+		"type":     "batch",
+		"policies": "foo",
+		"ttl":      "30m",
+	}
+	resp, err := c.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+	batch := resp.Auth.ClientToken
+	if !strings.HasPrefix(batch, batchTokenPrefix) {
+		t.Fatalf("bad: batch token ID %q", batch)
+	}
+	if resp.Auth.Accessor != "" || resp.Auth.Renewable || resp.Auth.TokenType != logical.TokenTypeBatch {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Nothing should have been persisted
+	storedAfter, err := ts.view.List(context.Background(), lookupPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(storedAfter) != len(storedBefore) {
+		t.Fatalf("expected no stored tokens to be added, before: %d after: %d", len(storedBefore), len(storedAfter))
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = batch
+	resp, err = c.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+	if resp.Data["type"] != "batch" || resp.Data["renewable"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if !reflect.DeepEqual(resp.Data["policies"], []string{"default", "foo"}) {
+		t.Fatalf("bad: %#v", resp.Data["policies"])
+	}
+	if ttl := resp.Data["ttl"].(int64); ttl <= 0 || ttl > 1800 {
+		t.Fatalf("bad: ttl %d", ttl)
+	}
+
+	// Batch tokens can't be renewed, revoked, create tokens or use a cubbyhole
+	for _, path := range []string{"auth/token/renew-self", "auth/token/revoke-self", "auth/token/create", "cubbyhole/foo"} {
+		req = logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = batch
+		req.Data["foo"] = "bar"
+		resp, err = c.HandleRequest(req)
+		if err == nil || resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected an error, got: %#v", path, resp)
+		}
+	}
+
+	// A tampered token must not be accepted. A character in the middle is
+	// changed since the last one may only carry padding bits.
+	mid := len(batch) / 2
+	tampered := "A"
+	if batch[mid] == 'A' {
+		tampered = "B"
+	}
+	te, err := ts.Lookup(context.Background(), batch[:mid]+tampered+batch[mid+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te != nil {
+		t.Fatal("expected tampered batch token to be invalid")
+	}
+
+	// Revoking the parent invalidates the batch token
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/revoke")
+	req.ClientToken = root
+	req.Data["token"] = "parent"
+	resp, err = c.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+
+	te, err = ts.Lookup(context.Background(), batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te != nil {
+		t.Fatal("expected batch token to be invalid once its parent is revoked")
+	}
+}
+
+func TestTokenStore_BatchTokens_CappedByParent(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	testMakeTokenViaCore(t, c, root, "parent", "10m", []string{"root"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = "parent"
+	req.Data = map[string]interface{}{
+		"type": "batch",
+		"ttl":  "1h",
+	}
+	resp, err := c.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+	// Creation times have a granularity of a second
+	if resp.Auth.TTL > 10*time.Minute+time.Second {
+		t.Fatalf("expected the batch token TTL to be capped by its parent, got %s", resp.Auth.TTL)
+	}
+	if len(resp.Warnings) == 0 {
+		t.Fatal("expected a warning about the capped TTL")
+	}
+}
+
+func TestTokenStore_RoleTokenType(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+
+	createRole := func(name, tokenType string) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "roles/"+name)
+		req.ClientToken = root
+		req.Data["token_type"] = tokenType
+		resp, err := ts.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v\nresp: %#v", err, resp)
+		}
+	}
+	createToken := func(role, tokenType string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "create/"+role)
+		req.ClientToken = root
+		req.Data["ttl"] = "1h"
+		if tokenType != "" {
+			req.Data["type"] = tokenType
+		}
+		return ts.HandleRequest(context.Background(), req)
+	}
+
+	createRole("batch", "batch")
+	createRole("defbatch", "default-batch")
+	createRole("service", "service")
+
+	cases := []struct {
+		role      string
+		requested string
+		expected  logical.TokenType
+		err       bool
+	}{
+		{"batch", "", logical.TokenTypeBatch, false},
+		{"batch", "batch", logical.TokenTypeBatch, false},
+		{"batch", "service", "", true},
+		{"defbatch", "", logical.TokenTypeBatch, false},
+		{"defbatch", "service", logical.TokenTypeService, false},
+		{"service", "", logical.TokenTypeService, false},
+		{"service", "batch", "", true},
+	}
+	for _, tc := range cases {
+		resp, err := createToken(tc.role, tc.requested)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("%s/%s: expected an error", tc.role, tc.requested)
+			}
+			continue
+		}
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s/%s: err: %v\nresp: %#v", tc.role, tc.requested, err, resp)
+		}
+		if resp.Auth.TokenType != tc.expected {
+			t.Fatalf("%s/%s: expected %q, got %q", tc.role, tc.requested, tc.expected, resp.Auth.TokenType)
+		}
+	}
+
+	// Batch tokens cannot be periodic
+	req := logical.TestRequest(t, logical.UpdateOperation, "roles/batch")
+	req.ClientToken = root
+	req.Data["period"] = "1h"
+	resp, err := ts.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error, got: %#v", resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "roles/defbatch")
+	req.ClientToken = root
+	resp, err = ts.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v\nresp: %#v", err, resp)
+	}
+	if resp.Data["token_type"] != "default-batch" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
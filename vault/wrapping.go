@@ -16,6 +16,7 @@ import (
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -74,6 +75,12 @@ func (c *Core) ensureWrappingKey(ctx context.Context) error {
 }
 
 func (c *Core) wrapInCubbyhole(ctx context.Context, req *logical.Request, resp *logical.Response, auth *logical.Auth) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	isRewrap := ns.TrimmedPath(req.Path) == "sys/wrapping/rewrap"
+
 	// Before wrapping, obey special rules for listing: if no entries are
 	// found, 404. This prevents unwrapping only to find empty data.
 	if req.Operation == logical.ListOperation {
@@ -101,7 +108,6 @@ func (c *Core) wrapInCubbyhole(ctx context.Context, req *logical.Request, resp *
 	}
 
 DONELISTHANDLING:
-	var err error
 	sealWrap := resp.WrapInfo.SealWrap
 
 	// If we are wrapping, the first part (performed in this functions) happens
@@ -127,7 +133,7 @@ DONELISTHANDLING:
 	resp.WrapInfo.Accessor = te.Accessor
 	resp.WrapInfo.CreationTime = creationTime
 	// If this is not a rewrap, store the request path as creation_path
-	if req.Path != "sys/wrapping/rewrap" {
+	if !isRewrap {
 		resp.WrapInfo.CreationPath = req.Path
 	}
 
@@ -181,7 +187,7 @@ DONELISTHANDLING:
 	}
 
 	// During a rewrap, store the original response, don't wrap it again.
-	if req.Path == "sys/wrapping/rewrap" {
+	if isRewrap {
 		cubbyReq.Data = map[string]interface{}{
 			"response": resp.Data["response"],
 		}
@@ -231,7 +237,7 @@ DONELISTHANDLING:
 		"creation_time": creationTime,
 	}
 	// Store creation_path if not a rewrap
-	if req.Path != "sys/wrapping/rewrap" {
+	if !isRewrap {
 		cubbyReq.Data["creation_path"] = req.Path
 	} else {
 		cubbyReq.Data["creation_path"] = resp.WrapInfo.CreationPath